@@ -0,0 +1,17 @@
+// This file contains the interfaces for the cache layer.
+// The cache layer is responsible for keeping copies of values read from slower storage until they expire.
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+type Store interface {
+	// Get : value of the key, found is false when the key is missing or expired
+	Get(ctx context.Context, key string) (value []byte, found bool, err error)
+	// Set : keep the value of the key until the ttl passed
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) (err error)
+	// Delete : remove the keys, missing keys are ignored
+	Delete(ctx context.Context, keys ...string) (err error)
+}
@@ -0,0 +1,104 @@
+// This file contains the in memory implementation of Store, values are not shared between instances.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultMemoryStoreSize : values kept by a memory store when no size is given
+const DefaultMemoryStoreSize = 10000
+
+// MemoryStore : least recently used values are evicted once the store is full, expired values are removed when they are read or evicted
+type MemoryStore struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	// recent is ordered from the most to the least recently used entry
+	recent *list.List
+	now    func() time.Time
+}
+
+type memoryEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+type NewMemoryStoreOptions struct {
+	// Size is the number of values kept, default to DefaultMemoryStoreSize
+	Size int
+}
+
+func NewMemoryStore(opts NewMemoryStoreOptions) *MemoryStore {
+	if opts.Size <= 0 {
+		opts.Size = DefaultMemoryStoreSize
+	}
+	return &MemoryStore{
+		size:    opts.Size,
+		entries: map[string]*list.Element{},
+		recent:  list.New(),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (value []byte, found bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, exist := s.entries[key]
+	if !exist {
+		return nil, false, nil
+	}
+	entry := element.Value.(*memoryEntry)
+	if !s.now().Before(entry.expiresAt) {
+		s.remove(element)
+		return nil, false, nil
+	}
+	s.recent.MoveToFront(element)
+	// Callers own the returned value, the stored one must not change with it
+	return append([]byte(nil), entry.value...), true, nil
+}
+
+func (s *MemoryStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := &memoryEntry{key: key, value: append([]byte(nil), value...), expiresAt: s.now().Add(ttl)}
+	if element, exist := s.entries[key]; exist {
+		element.Value = entry
+		s.recent.MoveToFront(element)
+		return nil
+	}
+	s.entries[key] = s.recent.PushFront(entry)
+	for s.recent.Len() > s.size {
+		s.remove(s.recent.Back())
+	}
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, keys ...string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		if element, exist := s.entries[key]; exist {
+			s.remove(element)
+		}
+	}
+	return nil
+}
+
+// Len : number of values in the store, expired values are counted until they are removed
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.recent.Len()
+}
+
+func (s *MemoryStore) remove(element *list.Element) {
+	s.recent.Remove(element)
+	delete(s.entries, element.Value.(*memoryEntry).key)
+}
@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(NewMemoryStoreOptions{Size: 2})
+	now := time.Date(2023, 10, 20, 10, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	_, found, err := store.Get(ctx, "user:id:1")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	require.NoError(t, store.Set(ctx, "user:id:1", []byte("one"), time.Minute))
+	value, found, err := store.Get(ctx, "user:id:1")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []byte("one"), value)
+
+	// Returned value is a copy
+	value[0] = 'x'
+	value, _, _ = store.Get(ctx, "user:id:1")
+	assert.Equal(t, []byte("one"), value)
+
+	// Set replace the value and its expiry
+	require.NoError(t, store.Set(ctx, "user:id:1", []byte("uno"), 2*time.Minute))
+	value, _, _ = store.Get(ctx, "user:id:1")
+	assert.Equal(t, []byte("uno"), value)
+	assert.Equal(t, 1, store.Len())
+
+	require.NoError(t, store.Delete(ctx, "user:id:1", "user:id:missing"))
+	_, found, _ = store.Get(ctx, "user:id:1")
+	assert.False(t, found)
+	assert.Equal(t, 0, store.Len())
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(NewMemoryStoreOptions{})
+	now := time.Date(2023, 10, 20, 10, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	require.NoError(t, store.Set(ctx, "key", []byte("value"), time.Minute))
+
+	now = now.Add(59 * time.Second)
+	_, found, _ := store.Get(ctx, "key")
+	assert.True(t, found)
+
+	// Expired value is removed when read
+	now = now.Add(time.Second)
+	_, found, _ = store.Get(ctx, "key")
+	assert.False(t, found)
+	assert.Equal(t, 0, store.Len())
+}
+
+func TestMemoryStoreEviction(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(NewMemoryStoreOptions{Size: 2})
+
+	store.Set(ctx, "a", []byte("a"), time.Minute)
+	store.Set(ctx, "b", []byte("b"), time.Minute)
+	// Reading a makes b the least recently used
+	store.Get(ctx, "a")
+	store.Set(ctx, "c", []byte("c"), time.Minute)
+
+	_, found, _ := store.Get(ctx, "b")
+	assert.False(t, found)
+	for _, key := range []string{"a", "c"} {
+		_, found, _ = store.Get(ctx, key)
+		assert.True(t, found, key)
+	}
+	assert.Equal(t, 2, store.Len())
+}
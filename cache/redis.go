@@ -0,0 +1,51 @@
+// This file contains the Redis implementation of Store, values are shared by every instance using the same Redis.
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type RedisStore struct {
+	Client redis.UniversalClient
+	// Prefix is added to every key, so the Redis can be shared with other services
+	Prefix string
+}
+
+type NewRedisStoreOptions struct {
+	Client redis.UniversalClient
+	Prefix string
+}
+
+func NewRedisStore(opts NewRedisStoreOptions) *RedisStore {
+	return &RedisStore{Client: opts.Client, Prefix: opts.Prefix}
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) (value []byte, found bool, err error) {
+	value, err = s.Client.Get(ctx, s.Prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) (err error) {
+	return s.Client.Set(ctx, s.Prefix+key, value, ttl).Err()
+}
+
+func (s *RedisStore) Delete(ctx context.Context, keys ...string) (err error) {
+	if len(keys) == 0 {
+		return nil
+	}
+	prefixed := make([]string, 0, len(keys))
+	for _, key := range keys {
+		prefixed = append(prefixed, s.Prefix+key)
+	}
+	return s.Client.Del(ctx, prefixed...).Err()
+}
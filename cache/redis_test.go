@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	store := NewRedisStore(NewRedisStoreOptions{Client: client, Prefix: "user-service:"})
+
+	_, found, err := store.Get(ctx, "user:id:1")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	require.NoError(t, store.Set(ctx, "user:id:1", []byte("one"), time.Minute))
+	value, found, err := store.Get(ctx, "user:id:1")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []byte("one"), value)
+
+	// Keys are prefixed and expire in Redis
+	assert.True(t, server.Exists("user-service:user:id:1"))
+	assert.Equal(t, time.Minute, server.TTL("user-service:user:id:1"))
+	server.FastForward(time.Minute)
+	_, found, _ = store.Get(ctx, "user:id:1")
+	assert.False(t, found)
+
+	store.Set(ctx, "user:id:1", []byte("one"), time.Minute)
+	store.Set(ctx, "user:id:2", []byte("two"), time.Minute)
+	require.NoError(t, store.Delete(ctx, "user:id:1", "user:id:2", "user:id:missing"))
+	assert.False(t, server.Exists("user-service:user:id:1"))
+	assert.False(t, server.Exists("user-service:user:id:2"))
+	require.NoError(t, store.Delete(ctx))
+
+	// Unreachable Redis is an error, not a miss
+	server.Close()
+	_, _, err = store.Get(ctx, "user:id:1")
+	assert.Error(t, err)
+}
@@ -0,0 +1,267 @@
+// Command admin manages the service from the command line, e.g. registering the first OAuth client.
+//
+//	admin client create -name billing -scopes users:read
+//	admin client create -name dashboard -scopes openid,profile,email -redirect-uris https://dashboard.example.com/callback
+//	admin client create -name okta -scopes scim -tenant plantation
+//	admin client list
+//	admin client revoke -id <client id>
+//	admin user import -file workers.csv -dry-run
+//	admin user import -file workers.csv -activation-otp
+//	admin user export -format parquet -tenant plantation -out users.parquet
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/handler"
+	"github.com/SawitProRecruitment/UserService/notification"
+	"github.com/SawitProRecruitment/UserService/oauth"
+	"github.com/SawitProRecruitment/UserService/phone"
+	"github.com/SawitProRecruitment/UserService/repository"
+)
+
+func main() {
+	if len(os.Args) < 3 {
+		usage()
+	}
+
+	repo := repository.NewRepository(repository.NewRepositoryOptions{
+		Dsn:    os.Getenv("DATABASE_URL"),
+		Driver: os.Getenv("DATABASE_DRIVER"),
+	})
+	ctx := context.Background()
+
+	var err error
+	switch os.Args[1] + " " + os.Args[2] {
+	case "client create":
+		err = createClient(ctx, repo, os.Args[3:])
+	case "client list":
+		err = listClients(ctx, repo)
+	case "client revoke":
+		err = revokeClient(ctx, repo, os.Args[3:])
+	case "user import":
+		err = importUsers(ctx, repo, os.Args[3:])
+	case "user export":
+		err = exportUsers(ctx, repo, os.Args[3:])
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: admin client create -name <name> -scopes <scope,...> [-redirect-uris <uri,...>] [-tenant <tenant>]")
+	fmt.Fprintln(os.Stderr, "       admin client list")
+	fmt.Fprintln(os.Stderr, "       admin client revoke -id <client id>")
+	fmt.Fprintln(os.Stderr, "       admin user import -file <csv> [-dry-run] [-activation-otp]")
+	fmt.Fprintln(os.Stderr, "       admin user export [-format csv|jsonl|parquet] [-columns <column,...>] [-tenant <tenant>] [-estate <estate>] [-region <region>] [-created-after <time>] [-created-before <time>] [-out <file>]")
+	os.Exit(2)
+}
+
+// createClient : register OAuth client and print its secret, the secret cannot be shown again
+func createClient(ctx context.Context, repo repository.RepositoryInterface, args []string) error {
+	flags := flag.NewFlagSet("client create", flag.ExitOnError)
+	name := flags.String("name", "", "name of the service using the client")
+	scopes := flags.String("scopes", oauth.ScopeUsersRead, "comma separated scopes, users:read, users:import, users:export, tokens:introspect, clients:admin, scim, openid, profile, email or phone")
+	redirectURIs := flags.String("redirect-uris", "", "comma separated redirect uris, required with the openid scope")
+	tenant := flags.String("tenant", "", "tenant the client provisions, required with the scim scope")
+	flags.Parse(args)
+
+	opts := oauth.NewClientOptions{Name: *name, Scopes: strings.Split(*scopes, ","), Tenant: *tenant}
+	if *redirectURIs != "" {
+		opts.RedirectURIs = strings.Split(*redirectURIs, ",")
+	}
+	client, secret, err := oauth.NewClient(opts)
+	if err != nil {
+		return err
+	}
+	err = repo.CreateOAuthClient(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("client_id:     %s\n", client.ID)
+	fmt.Printf("client_secret: %s\n", secret)
+	fmt.Printf("scopes:        %s\n", strings.Join(client.Scopes, " "))
+	if len(client.RedirectURIs) > 0 {
+		fmt.Printf("redirect_uris: %s\n", strings.Join(client.RedirectURIs, " "))
+	}
+	if client.Tenant != nil {
+		fmt.Printf("tenant:        %s\n", *client.Tenant)
+	}
+	return nil
+}
+
+func listClients(ctx context.Context, repo repository.RepositoryInterface) error {
+	clients, err := repo.ListOAuthClients(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tSCOPES\tTENANT\tCREATED")
+	for _, client := range clients {
+		tenant := "-"
+		if client.Tenant != nil {
+			tenant = *client.Tenant
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", client.ID, client.Name, strings.Join(client.Scopes, " "), tenant, client.CreatedAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+func revokeClient(ctx context.Context, repo repository.RepositoryInterface, args []string) error {
+	flags := flag.NewFlagSet("client revoke", flag.ExitOnError)
+	id := flags.String("id", "", "client id")
+	flags.Parse(args)
+
+	if *id == "" {
+		return fmt.Errorf("-id is required")
+	}
+	err := repo.RevokeOAuthClient(ctx, *id)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("client %s revoked\n", *id)
+	return nil
+}
+
+// importUsers : register users from CSV with the same rules as POST /users/import and print the report as JSON
+func importUsers(ctx context.Context, repo repository.RepositoryInterface, args []string) error {
+	flags := flag.NewFlagSet("user import", flag.ExitOnError)
+	file := flags.String("file", "", "CSV with phone, name and password columns, - for stdin")
+	dryRun := flags.Bool("dry-run", false, "only validate the rows, nothing is registered")
+	activationOTP := flags.Bool("activation-otp", false, "register rows without password with OTP login and send them a login code by SMS")
+	flags.Parse(args)
+
+	if *file == "" {
+		return fmt.Errorf("-file is required")
+	}
+	input := os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		input = f
+	}
+
+	server := handler.NewServer(handler.NewServerOptions{
+		Repository:  repo,
+		Phone:       newPhoneNormalizer(),
+		SMSNotifier: newSMSNotifier(),
+	})
+	report, err := server.ImportUsers(ctx, input, handler.ImportOptions{DryRun: *dryRun, ActivationOTP: *activationOTP})
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	if report.Failed > 0 {
+		return fmt.Errorf("%d of %d rows failed", report.Failed, report.Total)
+	}
+	return nil
+}
+
+// exportUsers : write users to a file or stdout, the number of exported users is logged to stderr
+func exportUsers(ctx context.Context, repo repository.RepositoryInterface, args []string) (err error) {
+	flags := flag.NewFlagSet("user export", flag.ExitOnError)
+	format := flags.String("format", "csv", "csv, jsonl or parquet")
+	columns := flags.String("columns", "", "comma separated columns, default every column")
+	tenant := flags.String("tenant", "", "only users of the tenant")
+	estate := flags.String("estate", "", "only users of the estate")
+	region := flags.String("region", "", "only users of the region")
+	createdAfter := flags.String("created-after", "", "only users registered at or after this RFC 3339 time")
+	createdBefore := flags.String("created-before", "", "only users registered before this RFC 3339 time")
+	out := flags.String("out", "-", "file to write, - for stdout")
+	flags.Parse(args)
+
+	opts := handler.ExportOptions{
+		Format: *format,
+		Filter: repository.ExportFilter{Tenant: *tenant, Estate: *estate, Region: *region},
+	}
+	if *columns != "" {
+		opts.Columns = strings.Split(*columns, ",")
+	}
+	if opts.Filter.CreatedAfter, err = parseTimeFlag("created-after", *createdAfter); err != nil {
+		return err
+	}
+	if opts.Filter.CreatedBefore, err = parseTimeFlag("created-before", *createdBefore); err != nil {
+		return err
+	}
+
+	output := os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+		output = f
+	}
+
+	server := handler.NewServer(handler.NewServerOptions{Repository: repo})
+	exported, err := server.ExportUsers(ctx, output, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%d users exported\n", exported)
+	return nil
+}
+
+func parseTimeFlag(name string, value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("-%s must be RFC 3339 time, e.g. 2024-01-31T00:00:00+07:00", name)
+	}
+	return &t, nil
+}
+
+// newPhoneNormalizer : same PHONE_ALLOWED_COUNTRIES and PHONE_DEFAULT_COUNTRY as the API
+func newPhoneNormalizer() *phone.Normalizer {
+	var allowed []string
+	if countries := os.Getenv("PHONE_ALLOWED_COUNTRIES"); countries != "" {
+		allowed = strings.Split(countries, ",")
+	}
+	normalizer, err := phone.NewNormalizer(phone.NewNormalizerOptions{
+		AllowedCountries: allowed,
+		DefaultCountry:   os.Getenv("PHONE_DEFAULT_COUNTRY"),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return normalizer
+}
+
+// newSMSNotifier : same SMS_GATEWAY_URL and SMS_GATEWAY_TOKEN as the API, messages are only logged without them
+func newSMSNotifier() notification.Notifier {
+	if os.Getenv("SMS_GATEWAY_URL") == "" {
+		return notification.NewLogNotifier()
+	}
+	return notification.NewSMSGatewayNotifier(notification.NewSMSGatewayNotifierOptions{
+		URL:   os.Getenv("SMS_GATEWAY_URL"),
+		Token: os.Getenv("SMS_GATEWAY_TOKEN"),
+	})
+}
@@ -1,31 +1,303 @@
 package main
 
 import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"expvar"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/SawitProRecruitment/UserService/cache"
 	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/generated/userpb"
 	"github.com/SawitProRecruitment/UserService/handler"
+	"github.com/SawitProRecruitment/UserService/notification"
+	"github.com/SawitProRecruitment/UserService/phone"
+	"github.com/SawitProRecruitment/UserService/ratelimit"
 	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/storage"
 
 	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 func main() {
 	e := echo.New()
 
-	var server generated.ServerInterface = newServer()
+	dbDsn := os.Getenv("DATABASE_URL")
+	repo := repository.NewRepository(repository.NewRepositoryOptions{
+		Dsn:    dbDsn,
+		Driver: os.Getenv("DATABASE_DRIVER"),
+	})
+	server := newServer(newUserCache(repo))
+
+	spec, err := generated.GetSwagger()
+	if err != nil {
+		log.Fatal(err)
+	}
+	rateLimitStore := newRateLimitStore(repo)
+	rateLimit, err := server.RateLimitMiddleware(rateLimitStore, spec)
+	if err != nil {
+		log.Fatal(err)
+	}
+	e.Use(rateLimit)
+	if postgres, ok := rateLimitStore.(*ratelimit.PostgresStore); ok {
+		idle, err := handler.LongestRateLimitPeriod(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go deleteIdleRateLimitBuckets(postgres, idle)
+	}
+
+	// Client ip is a rate limit key, X-Forwarded-For can be forged unless a trusted proxy set it
+	if os.Getenv("TRUST_PROXY") == "true" {
+		e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	} else {
+		e.IPExtractor = echo.ExtractIPDirect()
+	}
+
+	// gRPC Register and Login take from the same buckets as their REST routes
+	grpcRateLimit, err := server.GRPCRateLimitInterceptor(rateLimitStore, spec)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	generated.RegisterHandlers(e, server)
-	e.Logger.Fatal(e.Start(":1323"))
+	go serveGRPC(server, grpcRateLimit)
+	go serveMetrics()
+	go func() {
+		if err := e.Start(":1323"); err != nil && err != http.ErrServerClosed {
+			e.Logger.Fatal(err)
+		}
+	}()
+
+	// Finish in flight requests and SMS still sent in background, e.g. login passcodes, before exiting
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		e.Logger.Error(err)
+	}
+	server.Users.Wait()
 }
 
-func newServer() *handler.Server {
-	dbDsn := os.Getenv("DATABASE_URL")
-	var repo repository.RepositoryInterface = repository.NewRepository(repository.NewRepositoryOptions{
-		Dsn: dbDsn,
-	})
+// serveGRPC : gRPC API for internal services next to the REST API, GRPC_ADDR default to :9090.
+// Passwords are sent in plaintext unless GRPC_TLS_CERT_FILE and GRPC_TLS_KEY_FILE are set, it must not be reachable outside the internal network without them
+func serveGRPC(server *handler.Server, rateLimit grpc.UnaryServerInterceptor) {
+	addr := os.Getenv("GRPC_ADDR")
+	if addr == "" {
+		addr = ":9090"
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Logging is outermost so it records the status code after errors are mapped
+	opts := []grpc.ServerOption{grpc.ChainUnaryInterceptor(
+		handler.GRPCLoggingInterceptor,
+		handler.GRPCErrorInterceptor,
+		rateLimit,
+		server.GRPCAuthInterceptor,
+	)}
+	if certFile, keyFile := os.Getenv("GRPC_TLS_CERT_FILE"), os.Getenv("GRPC_TLS_KEY_FILE"); certFile != "" || keyFile != "" {
+		creds, err := credentials.NewServerTLSFromFile(certFile, keyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	grpcServer := grpc.NewServer(opts...)
+	userpb.RegisterUserServiceServer(grpcServer, server.GRPCService())
+	log.Fatal(grpcServer.Serve(listener))
+}
+
+// serveMetrics : expvar counters, e.g. user_cache, on METRICS_ADDR for internal monitoring, not served when it is not set
+func serveMetrics() {
+	addr := os.Getenv("METRICS_ADDR")
+	if addr == "" {
+		return
+	}
+	log.Fatal(http.ListenAndServe(addr, expvar.Handler()))
+}
+
+func newServer(repo repository.RepositoryInterface) *handler.Server {
+	baseURL := os.Getenv("APP_BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
 	opts := handler.NewServerOptions{
-		Repository: repo,
+		Repository:    repo,
+		BlobStore:     newBlobStore(),
+		EmailNotifier: newEmailNotifier(),
+		SMSNotifier:   newSMSNotifier(),
+		BaseURL:       baseURL,
+		Phone:         newPhoneNormalizer(),
+		// Hide whether a phone number or email is registered, login and registration errors become generic
+		EnumerationProtection: os.Getenv("ENUMERATION_PROTECTION") == "true",
+		SigningKey:            newSigningKey(),
 	}
 	return handler.NewServer(opts)
 }
+
+// newPhoneNormalizer : PHONE_ALLOWED_COUNTRIES is comma separated country codes, e.g. ID,MY,TH
+func newPhoneNormalizer() *phone.Normalizer {
+	var allowed []string
+	if countries := os.Getenv("PHONE_ALLOWED_COUNTRIES"); countries != "" {
+		allowed = strings.Split(countries, ",")
+	}
+	normalizer, err := phone.NewNormalizer(phone.NewNormalizerOptions{
+		AllowedCountries: allowed,
+		DefaultCountry:   os.Getenv("PHONE_DEFAULT_COUNTRY"),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return normalizer
+}
+
+// newSigningKey : OIDC_SIGNING_KEY_FILE is PEM encoded RSA private key, without it id tokens are signed with a key that changes on restart
+func newSigningKey() *rsa.PrivateKey {
+	path := os.Getenv("OIDC_SIGNING_KEY_FILE")
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		log.Fatal(fmt.Errorf("%s is not PEM encoded", path))
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		log.Fatal(err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		log.Fatal(fmt.Errorf("%s is not an RSA private key", path))
+	}
+	return key
+}
+
+func newBlobStore() storage.BlobStore {
+	if os.Getenv("AVATAR_STORAGE") == "s3" {
+		return storage.NewS3Store(storage.NewS3StoreOptions{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		})
+	}
+
+	root := os.Getenv("AVATAR_STORAGE_PATH")
+	if root == "" {
+		root = "data/avatars"
+	}
+	return storage.NewLocalStore(storage.NewLocalStoreOptions{
+		Root: root,
+	})
+}
+
+func newEmailNotifier() notification.Notifier {
+	if os.Getenv("SMTP_ADDR") == "" {
+		return notification.NewLogNotifier()
+	}
+	return notification.NewSMTPNotifier(notification.NewSMTPNotifierOptions{
+		Addr:     os.Getenv("SMTP_ADDR"),
+		From:     os.Getenv("SMTP_FROM"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+	})
+}
+
+func newSMSNotifier() notification.Notifier {
+	if os.Getenv("SMS_GATEWAY_URL") == "" {
+		return notification.NewLogNotifier()
+	}
+	return notification.NewSMSGatewayNotifier(notification.NewSMSGatewayNotifierOptions{
+		URL:   os.Getenv("SMS_GATEWAY_URL"),
+		Token: os.Getenv("SMS_GATEWAY_TOKEN"),
+	})
+}
+
+// deleteIdleRateLimitBuckets : buckets kept in Postgres are not removed by Take, delete the ones idle for longer than the longest rule period every minute
+func deleteIdleRateLimitBuckets(store *ratelimit.PostgresStore, idle time.Duration) {
+	for range time.Tick(time.Minute) {
+		if err := store.DeleteIdle(context.Background(), time.Now().Add(-idle)); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// newRateLimitStore : RATE_LIMIT_STORE=postgres share buckets between instances, default keep them in memory
+func newRateLimitStore(repo repository.RepositoryInterface) ratelimit.Store {
+	if os.Getenv("RATE_LIMIT_STORE") == "postgres" {
+		postgres, ok := repo.(*repository.Repository)
+		if !ok {
+			log.Fatal("RATE_LIMIT_STORE=postgres requires a Postgres DATABASE_URL")
+		}
+		return ratelimit.NewPostgresStore(ratelimit.NewPostgresStoreOptions{Db: postgres.Db})
+	}
+	return ratelimit.NewMemoryStore()
+}
+
+// newUserCache : USER_CACHE=memory or USER_CACHE=redis cache users read by id, default read them from the database every time.
+// The memory cache is per instance, so a user changed on another instance can be stale for USER_CACHE_TTL.
+func newUserCache(repo repository.RepositoryInterface) repository.RepositoryInterface {
+	var store cache.Store
+	switch os.Getenv("USER_CACHE") {
+	case "":
+		return repo
+	case "memory":
+		var size int
+		if value := os.Getenv("USER_CACHE_SIZE"); value != "" {
+			var err error
+			if size, err = strconv.Atoi(value); err != nil {
+				log.Fatalf("invalid USER_CACHE_SIZE: %v", err)
+			}
+		}
+		store = cache.NewMemoryStore(cache.NewMemoryStoreOptions{Size: size})
+	case "redis":
+		opts, err := redis.ParseURL(os.Getenv("REDIS_URL"))
+		if err != nil {
+			log.Fatalf("invalid REDIS_URL: %v", err)
+		}
+		store = cache.NewRedisStore(cache.NewRedisStoreOptions{Client: redis.NewClient(opts), Prefix: "user-service:"})
+	default:
+		log.Fatalf("unsupported USER_CACHE %s", os.Getenv("USER_CACHE"))
+	}
+
+	var ttl time.Duration
+	if value := os.Getenv("USER_CACHE_TTL"); value != "" {
+		var err error
+		if ttl, err = time.ParseDuration(value); err != nil {
+			log.Fatalf("invalid USER_CACHE_TTL: %v", err)
+		}
+	}
+	cached := repository.NewCachedRepository(repository.NewCachedRepositoryOptions{Repository: repo, Store: store, TTL: ttl})
+	expvar.Publish("user_cache", expvar.Func(func() interface{} {
+		return cached.Stats()
+	}))
+	return cached
+}
@@ -16,13 +16,171 @@ CREATE TABLE IF NOT EXISTS test (
 INSERT INTO test (name) VALUES ('test1');
 INSERT INTO test (name) VALUES ('test2');
 
+/** Order of changes to users across the whole table, offline devices resume incremental sync from the last change sequence they saw */
+CREATE SEQUENCE IF NOT EXISTS public.user_change_seq;
+
 CREATE TABLE IF NOT EXISTS public.user (
     id UUID PRIMARY KEY,
-    phone VARCHAR ( 13 ) UNIQUE NOT NULL,
+    phone VARCHAR ( 16 ) UNIQUE NOT NULL,
     name VARCHAR ( 60 ) NOT NULL,
     password VARCHAR ( 64 ) NOT NULL,
     salt VARCHAR ( 64 ) NOT NULL,
     created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
     success_login INTEGER NOT NULL DEFAULT 0,
+    version INTEGER NOT NULL DEFAULT 1,
+    email VARCHAR ( 254 ),
+    email_verified_at TIMESTAMP WITH TIME ZONE,
+    preferred_language VARCHAR ( 35 ),
+    avatar_url VARCHAR ( 255 ),
+    date_of_birth DATE,
+    address VARCHAR ( 255 ),
+    estate VARCHAR ( 100 ),
+    region VARCHAR ( 100 ),
+    tenant VARCHAR ( 64 ) NOT NULL DEFAULT 'default',
+    attributes JSONB NOT NULL DEFAULT '{}',
+    avatar_key VARCHAR ( 255 ),
+    otp_login_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    phone_verified_at TIMESTAMP WITH TIME ZONE,
+    /** Id of the user in the identity provider of the tenant that provisioned it with SCIM */
+    external_id VARCHAR ( 255 ),
+    /** Deactivated users cannot login, set when the identity provider deprovisions the user */
+    deactivated_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE,
+    /** Taken from user_change_seq every time the version is incremented */
+    change_seq BIGINT NOT NULL DEFAULT nextval('public.user_change_seq'),
+    /** Set together with change_seq, unlike updated_at it is not changed by logins or email verification. Offline edits made before it lose conflicts */
+    profile_updated_at TIMESTAMP WITH TIME ZONE
+);
+
+/**
+  Email is an optional login identifier, stored in lower case. Only verified emails are unique,
+  so an address claimed by someone who does not own it cannot block its owner from adding it.
+  */
+CREATE UNIQUE INDEX IF NOT EXISTS user_email_key ON public.user (email) WHERE email_verified_at IS NOT NULL;
+
+/** SCIM lists the users of a tenant by external id or page by page */
+CREATE INDEX IF NOT EXISTS user_tenant_external_id_idx ON public.user (tenant, external_id);
+
+/** JSON Schema used to validate the custom attributes of users that belong to a tenant */
+CREATE TABLE IF NOT EXISTS public.tenant_attribute_schema (
+    tenant VARCHAR ( 64 ) PRIMARY KEY,
+    schema JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE
-);
\ No newline at end of file
+);
+
+/** One time passcodes sent by SMS for passwordless login, only the hash of the code is stored */
+CREATE TABLE IF NOT EXISTS public.login_otp (
+    id BIGSERIAL PRIMARY KEY,
+    phone VARCHAR ( 16 ) NOT NULL,
+    code_hash VARCHAR ( 64 ) NOT NULL,
+    salt VARCHAR ( 64 ) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+/** Latest passcode lookup and per phone rate limiting */
+CREATE INDEX IF NOT EXISTS login_otp_phone_created_at_idx ON public.login_otp (phone, created_at);
+
+/** Token buckets of the rate limiter, shared by every instance of the service */
+CREATE TABLE IF NOT EXISTS public.rate_limit_bucket (
+    key VARCHAR ( 255 ) PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+/** Personal access tokens used by integrations instead of the password, only the SHA-256 of the token is stored */
+CREATE TABLE IF NOT EXISTS public.personal_access_token (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES public.user (id) ON DELETE CASCADE,
+    name VARCHAR ( 100 ) NOT NULL,
+    token_hash CHAR ( 64 ) UNIQUE NOT NULL,
+    prefix VARCHAR ( 20 ) NOT NULL,
+    scopes TEXT[] NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS personal_access_token_user_id_idx ON public.personal_access_token (user_id);
+
+/** OAuth clients of internal services using the client credentials grant, only the SHA-256 of the secret is stored */
+CREATE TABLE IF NOT EXISTS public.oauth_client (
+    id VARCHAR ( 64 ) PRIMARY KEY,
+    name VARCHAR ( 100 ) NOT NULL,
+    secret_hash CHAR ( 64 ) NOT NULL,
+    scopes TEXT[] NOT NULL,
+    redirect_uris TEXT[] NOT NULL DEFAULT '{}',
+    /** Tenant whose users and groups the client provisions with SCIM */
+    tenant VARCHAR ( 64 ),
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+/** OpenID Connect authorization codes, single use and short lived, only the SHA-256 of the code is stored */
+CREATE TABLE IF NOT EXISTS public.oauth_authorization_code (
+    code_hash CHAR ( 64 ) PRIMARY KEY,
+    client_id VARCHAR ( 64 ) NOT NULL REFERENCES public.oauth_client (id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES public.user (id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT[] NOT NULL,
+    nonce VARCHAR ( 255 ) NOT NULL DEFAULT '',
+    code_challenge VARCHAR ( 128 ) NOT NULL,
+    auth_time TIMESTAMP WITH TIME ZONE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE
+);
+
+/** Organizations such as estates and cooperatives, users belong to one or more of them */
+CREATE TABLE IF NOT EXISTS public.organization (
+    id UUID PRIMARY KEY,
+    name VARCHAR ( 100 ) NOT NULL,
+    /** Tenant of organizations provisioned as SCIM groups, NULL for organizations created by users */
+    tenant VARCHAR ( 64 ),
+    external_id VARCHAR ( 255 ),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS organization_tenant_idx ON public.organization (tenant) WHERE tenant IS NOT NULL;
+
+/** Members of organizations with their per organization role */
+CREATE TABLE IF NOT EXISTS public.organization_member (
+    organization_id UUID NOT NULL REFERENCES public.organization (id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES public.user (id) ON DELETE CASCADE,
+    role VARCHAR ( 16 ) NOT NULL CHECK (role IN ('owner', 'admin', 'member')),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS organization_member_user_id_idx ON public.organization_member (user_id);
+
+/** Invitations to join an organization sent by SMS, only the SHA-256 of the token is stored */
+CREATE TABLE IF NOT EXISTS public.organization_invitation (
+    id UUID PRIMARY KEY,
+    organization_id UUID NOT NULL REFERENCES public.organization (id) ON DELETE CASCADE,
+    phone VARCHAR ( 16 ) NOT NULL,
+    role VARCHAR ( 16 ) NOT NULL CHECK (role IN ('owner', 'admin', 'member')),
+    token_hash CHAR ( 64 ) UNIQUE NOT NULL,
+    invited_by UUID REFERENCES public.user (id) ON DELETE SET NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    accepted_at TIMESTAMP WITH TIME ZONE,
+    accepted_by UUID REFERENCES public.user (id) ON DELETE SET NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS organization_invitation_organization_id_idx ON public.organization_invitation (organization_id, created_at);
+
+/** Outcome of profile mutations submitted by offline devices, a replayed mutation returns the stored outcome instead of being applied again */
+CREATE TABLE IF NOT EXISTS public.user_sync_mutation (
+    user_id UUID NOT NULL REFERENCES public.user (id) ON DELETE CASCADE,
+    id VARCHAR ( 64 ) NOT NULL,
+    field VARCHAR ( 32 ) NOT NULL,
+    status VARCHAR ( 16 ) NOT NULL CHECK (status IN ('applied', 'rejected')),
+    message VARCHAR ( 255 ) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, id)
+);
@@ -0,0 +1,188 @@
+// Package export writes rows as CSV, JSON Lines or Parquet, one row at a time so large exports are streamed.
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatCSV     = "csv"
+	FormatJSONL   = "jsonl"
+	FormatParquet = "parquet"
+)
+
+// Formats : supported formats and their content type
+var Formats = map[string]string{
+	FormatCSV:     "text/csv",
+	FormatJSONL:   "application/x-ndjson",
+	FormatParquet: "application/vnd.apache.parquet",
+}
+
+// ErrUnsupportedFormat is returned by NewWriter when the format is not one of Formats
+var ErrUnsupportedFormat = errors.New("unsupported export format")
+
+// Type : type of the values of a column, typed formats such as Parquet keep it in their schema
+type Type int
+
+const (
+	// String values are string
+	String Type = iota
+	// Bool values are bool
+	Bool
+	// Int values are int64
+	Int
+	// Timestamp values are time.Time
+	Timestamp
+	// Date values are time.Time, only the date in UTC is written
+	Date
+	// JSON values are json.RawMessage, written as is in JSON Lines and as text in the other formats
+	JSON
+)
+
+type Column struct {
+	Name string
+	Type Type
+}
+
+// Writer : write rows of values in the order of the columns, nil is written as empty or null
+type Writer interface {
+	Write(row []interface{}) (err error)
+	// Flush writes the buffered rows, Parquet ends its row group
+	Flush() (err error)
+	// Close flushes and finishes the file, the underlying writer is not closed
+	Close() (err error)
+}
+
+// NewWriter : writer of the format, rows are buffered until Flush and the file is only complete after Close
+func NewWriter(format string, w io.Writer, columns []Column) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, columns)
+	case FormatJSONL:
+		return &jsonlWriter{w: bufio.NewWriter(w), columns: columns}, nil
+	case FormatParquet:
+		return newParquetWriter(w, columns)
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+type csvWriter struct {
+	w       *csv.Writer
+	columns []Column
+	record  []string
+}
+
+func newCSVWriter(w io.Writer, columns []Column) (*csvWriter, error) {
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.Name
+	}
+
+	cw := &csvWriter{w: csv.NewWriter(w), columns: columns, record: make([]string, len(columns))}
+	if err := cw.w.Write(header); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func (cw *csvWriter) Write(row []interface{}) error {
+	for i, column := range cw.columns {
+		cw.record[i] = formatText(column.Type, row[i])
+		if column.Type == String {
+			cw.record[i] = escapeFormula(cw.record[i])
+		}
+	}
+	return cw.w.Write(cw.record)
+}
+
+func (cw *csvWriter) Flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+func (cw *csvWriter) Close() error {
+	return cw.Flush()
+}
+
+type jsonlWriter struct {
+	w       *bufio.Writer
+	columns []Column
+}
+
+// Write : one JSON object per line, keys are written in the order of the columns
+func (jw *jsonlWriter) Write(row []interface{}) error {
+	jw.w.WriteByte('{')
+	for i, column := range jw.columns {
+		if i > 0 {
+			jw.w.WriteByte(',')
+		}
+		key, _ := json.Marshal(column.Name)
+		jw.w.Write(key)
+		jw.w.WriteByte(':')
+
+		value, err := formatJSON(column.Type, row[i])
+		if err != nil {
+			return err
+		}
+		jw.w.Write(value)
+	}
+	jw.w.WriteByte('}')
+	return jw.w.WriteByte('\n')
+}
+
+func (jw *jsonlWriter) Flush() error {
+	return jw.w.Flush()
+}
+
+func (jw *jsonlWriter) Close() error {
+	return jw.Flush()
+}
+
+// formatText : value as text of CSV, times are RFC 3339 in UTC
+func formatText(typ Type, value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	switch typ {
+	case Bool:
+		return strconv.FormatBool(value.(bool))
+	case Int:
+		return strconv.FormatInt(value.(int64), 10)
+	case Timestamp:
+		return value.(time.Time).UTC().Format(time.RFC3339)
+	case Date:
+		return value.(time.Time).UTC().Format("2006-01-02")
+	case JSON:
+		return string(value.(json.RawMessage))
+	}
+	return value.(string)
+}
+
+// escapeFormula : prefix text a spreadsheet would run as a formula with ', e.g. names like =HYPERLINK(...)
+func escapeFormula(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+// formatJSON : value as JSON, times are strings in the same format as CSV
+func formatJSON(typ Type, value interface{}) ([]byte, error) {
+	if value == nil {
+		return []byte("null"), nil
+	}
+	switch typ {
+	case Timestamp, Date:
+		return json.Marshal(formatText(typ, value))
+	case JSON:
+		return value.(json.RawMessage), nil
+	}
+	return json.Marshal(value)
+}
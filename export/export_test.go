@@ -0,0 +1,69 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testColumns = []Column{
+	{Name: "id", Type: String},
+	{Name: "otp_login_enabled", Type: Bool},
+	{Name: "version", Type: Int},
+	{Name: "created_at", Type: Timestamp},
+	{Name: "date_of_birth", Type: Date},
+	{Name: "attributes", Type: JSON},
+}
+
+var testRows = [][]interface{}{
+	{"a1", true, int64(3), time.Date(2024, 1, 2, 10, 4, 5, 0, time.FixedZone("WIB", 7*3600)), time.Date(1990, 5, 17, 0, 0, 0, 0, time.UTC), json.RawMessage(`{"nik":"1234"}`)},
+	{"b2, \"Jr\"", false, nil, time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC), nil, json.RawMessage(`{}`)},
+}
+
+func writeRows(t *testing.T, format string) string {
+	var buf bytes.Buffer
+	w, err := NewWriter(format, &buf, testColumns)
+	assert.NoError(t, err)
+	for _, row := range testRows {
+		assert.NoError(t, w.Write(row))
+	}
+	assert.NoError(t, w.Close())
+	return buf.String()
+}
+
+func TestCSVWriter(t *testing.T) {
+	assert.Equal(t, "id,otp_login_enabled,version,created_at,date_of_birth,attributes\n"+
+		"a1,true,3,2024-01-02T03:04:05Z,1990-05-17,\"{\"\"nik\"\":\"\"1234\"\"}\"\n"+
+		"\"b2, \"\"Jr\"\"\",false,,2024-01-03T00:00:00Z,,{}\n", writeRows(t, FormatCSV))
+}
+
+func TestCSVWriterEscapeFormula(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(FormatCSV, &buf, []Column{{Name: "name", Type: String}, {Name: "version", Type: Int}})
+	assert.NoError(t, err)
+	for _, name := range []string{"=HYPERLINK(\"http://example.com\")", "+62812", "-1", "@SUM(A1)", "Budi = Andi"} {
+		assert.NoError(t, w.Write([]interface{}{name, int64(-1)}))
+	}
+	assert.NoError(t, w.Close())
+
+	// Numbers are not text a spreadsheet could run, only string columns are escaped
+	assert.Equal(t, "name,version\n"+
+		"\"'=HYPERLINK(\"\"http://example.com\"\")\",-1\n"+
+		"'+62812,-1\n"+
+		"'-1,-1\n"+
+		"'@SUM(A1),-1\n"+
+		"Budi = Andi,-1\n", buf.String())
+}
+
+func TestJSONLWriter(t *testing.T) {
+	assert.Equal(t, "{\"id\":\"a1\",\"otp_login_enabled\":true,\"version\":3,\"created_at\":\"2024-01-02T03:04:05Z\",\"date_of_birth\":\"1990-05-17\",\"attributes\":{\"nik\":\"1234\"}}\n"+
+		"{\"id\":\"b2, \\\"Jr\\\"\",\"otp_login_enabled\":false,\"version\":null,\"created_at\":\"2024-01-03T00:00:00Z\",\"date_of_birth\":null,\"attributes\":{}}\n", writeRows(t, FormatJSONL))
+}
+
+func TestNewWriterUnsupportedFormat(t *testing.T) {
+	_, err := NewWriter("xlsx", &bytes.Buffer{}, testColumns)
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+}
@@ -0,0 +1,378 @@
+// This file contains the Parquet writer, every column is optional, PLAIN encoded and uncompressed.
+// Each Flush writes one row group with a single data page per column, so memory is bounded by the rows between flushes.
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"time"
+)
+
+// parquetMagic : first and last bytes of a Parquet file
+const parquetMagic = "PAR1"
+
+// Parquet physical types, converted types, encodings and repetition of the thrift definitions in parquet-format
+const (
+	parquetBoolean   = 0
+	parquetInt32     = 1
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetUTF8            = 0
+	parquetDate            = 6
+	parquetTimestampMillis = 9
+	parquetJSON            = 19
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetOptional = 1
+	parquetDataPage = 0
+)
+
+// parquetColumn : values of a column buffered for the current row group
+type parquetColumn struct {
+	Column
+	// defined is false for null values, which are not in values
+	defined []bool
+	values  bytes.Buffer
+	bools   []bool
+}
+
+type parquetColumnChunk struct {
+	physical  int32
+	name      string
+	offset    int64
+	size      int64
+	numValues int64
+}
+
+type parquetRowGroup struct {
+	chunks  []parquetColumnChunk
+	size    int64
+	numRows int64
+}
+
+type parquetWriter struct {
+	w         io.Writer
+	offset    int64
+	columns   []*parquetColumn
+	rows      int64
+	rowGroups []parquetRowGroup
+}
+
+func newParquetWriter(w io.Writer, columns []Column) (*parquetWriter, error) {
+	pw := &parquetWriter{w: w}
+	for _, column := range columns {
+		pw.columns = append(pw.columns, &parquetColumn{Column: column})
+	}
+	return pw, nil
+}
+
+func (pw *parquetWriter) Write(row []interface{}) error {
+	for i, column := range pw.columns {
+		value := row[i]
+		column.defined = append(column.defined, value != nil)
+		if value == nil {
+			continue
+		}
+
+		switch column.Type {
+		case Bool:
+			column.bools = append(column.bools, value.(bool))
+		case Int:
+			binary.Write(&column.values, binary.LittleEndian, value.(int64))
+		case Timestamp:
+			binary.Write(&column.values, binary.LittleEndian, value.(time.Time).UnixMilli())
+		case Date:
+			days := int32(math.Floor(float64(value.(time.Time).Unix()) / 86400))
+			binary.Write(&column.values, binary.LittleEndian, days)
+		case JSON:
+			writeByteArray(&column.values, []byte(value.(json.RawMessage)))
+		default:
+			writeByteArray(&column.values, []byte(value.(string)))
+		}
+	}
+	pw.rows++
+	return nil
+}
+
+// Flush : write the buffered rows as one row group
+func (pw *parquetWriter) Flush() error {
+	if pw.offset == 0 {
+		if err := pw.write([]byte(parquetMagic)); err != nil {
+			return err
+		}
+	}
+	if pw.rows == 0 {
+		return nil
+	}
+
+	rowGroup := parquetRowGroup{numRows: pw.rows}
+	for _, column := range pw.columns {
+		chunk, err := pw.writeColumnChunk(column)
+		if err != nil {
+			return err
+		}
+		rowGroup.chunks = append(rowGroup.chunks, chunk)
+		rowGroup.size += chunk.size
+	}
+	pw.rowGroups = append(pw.rowGroups, rowGroup)
+	pw.rows = 0
+	return nil
+}
+
+// Close : write the last row group and the footer with the schema and the location of every column chunk
+func (pw *parquetWriter) Close() error {
+	if err := pw.Flush(); err != nil {
+		return err
+	}
+
+	footer := pw.footer()
+	if err := pw.write(footer); err != nil {
+		return err
+	}
+	length := make([]byte, 4)
+	binary.LittleEndian.PutUint32(length, uint32(len(footer)))
+	if err := pw.write(length); err != nil {
+		return err
+	}
+	return pw.write([]byte(parquetMagic))
+}
+
+// writeColumnChunk : write the column values as one data page, definition levels mark the null values
+func (pw *parquetWriter) writeColumnChunk(column *parquetColumn) (parquetColumnChunk, error) {
+	if column.Type == Bool {
+		column.values.Write(packBits(column.bools))
+	}
+
+	// RLE/bit-packed hybrid with one bit-packed run of bit width 1, the header is the number of 8 value groups
+	packed := packBits(column.defined)
+	levels := binary.AppendUvarint(nil, uint64(len(packed))<<1|1)
+	levels = append(levels, packed...)
+
+	var page bytes.Buffer
+	// Data page v1 prefixes the levels with their length
+	binary.Write(&page, binary.LittleEndian, uint32(len(levels)))
+	page.Write(levels)
+	page.Write(column.values.Bytes())
+
+	var header thriftWriter
+	header.structBegin()
+	header.i32(1, parquetDataPage)
+	header.i32(2, int32(page.Len()))
+	header.i32(3, int32(page.Len()))
+	header.structField(5)
+	header.i32(1, int32(len(column.defined)))
+	header.i32(2, parquetPlain)
+	header.i32(3, parquetRLE)
+	header.i32(4, parquetRLE)
+	header.structEnd()
+	header.structEnd()
+
+	chunk := parquetColumnChunk{
+		physical:  column.physical(),
+		name:      column.Name,
+		offset:    pw.offset,
+		size:      int64(header.buf.Len() + page.Len()),
+		numValues: int64(len(column.defined)),
+	}
+	if err := pw.write(header.buf.Bytes()); err != nil {
+		return chunk, err
+	}
+	if err := pw.write(page.Bytes()); err != nil {
+		return chunk, err
+	}
+
+	column.defined = column.defined[:0]
+	column.bools = column.bools[:0]
+	column.values.Reset()
+	return chunk, nil
+}
+
+// footer : FileMetaData in thrift compact protocol
+func (pw *parquetWriter) footer() []byte {
+	var numRows int64
+	for _, rowGroup := range pw.rowGroups {
+		numRows += rowGroup.numRows
+	}
+
+	var t thriftWriter
+	t.structBegin()
+	t.i32(1, 1)
+
+	t.listBegin(2, thriftStruct, len(pw.columns)+1)
+	t.structBegin()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(pw.columns)))
+	t.structEnd()
+	for _, column := range pw.columns {
+		t.structBegin()
+		t.i32(1, column.physical())
+		t.i32(3, parquetOptional)
+		t.binary(4, column.Name)
+		if converted, ok := column.converted(); ok {
+			t.i32(6, converted)
+		}
+		t.structEnd()
+	}
+
+	t.i64(3, numRows)
+
+	t.listBegin(4, thriftStruct, len(pw.rowGroups))
+	for _, rowGroup := range pw.rowGroups {
+		t.structBegin()
+		t.listBegin(1, thriftStruct, len(rowGroup.chunks))
+		for _, chunk := range rowGroup.chunks {
+			t.structBegin()
+			t.i64(2, chunk.offset)
+			t.structField(3)
+			t.i32(1, chunk.physical)
+			t.listBegin(2, thriftI32, 2)
+			t.buf.Write(appendZigzag(nil, parquetPlain))
+			t.buf.Write(appendZigzag(nil, parquetRLE))
+			t.listBegin(3, thriftBinary, 1)
+			t.buf.Write(binary.AppendUvarint(nil, uint64(len(chunk.name))))
+			t.buf.WriteString(chunk.name)
+			t.i32(4, 0)
+			t.i64(5, chunk.numValues)
+			t.i64(6, chunk.size)
+			t.i64(7, chunk.size)
+			t.i64(9, chunk.offset)
+			t.structEnd()
+			t.structEnd()
+		}
+		t.i64(2, rowGroup.size)
+		t.i64(3, rowGroup.numRows)
+		t.structEnd()
+	}
+
+	t.binary(6, "SawitPro UserService")
+	t.structEnd()
+	return t.buf.Bytes()
+}
+
+func (pw *parquetWriter) write(b []byte) error {
+	n, err := pw.w.Write(b)
+	pw.offset += int64(n)
+	return err
+}
+
+func (column *parquetColumn) physical() int32 {
+	switch column.Type {
+	case Bool:
+		return parquetBoolean
+	case Int, Timestamp:
+		return parquetInt64
+	case Date:
+		return parquetInt32
+	}
+	return parquetByteArray
+}
+
+func (column *parquetColumn) converted() (int32, bool) {
+	switch column.Type {
+	case String:
+		return parquetUTF8, true
+	case Timestamp:
+		return parquetTimestampMillis, true
+	case Date:
+		return parquetDate, true
+	case JSON:
+		return parquetJSON, true
+	}
+	return 0, false
+}
+
+// writeByteArray : PLAIN encoded byte array, prefixed by its length
+func writeByteArray(buf *bytes.Buffer, b []byte) {
+	binary.Write(buf, binary.LittleEndian, uint32(len(b)))
+	buf.Write(b)
+}
+
+// packBits : values packed eight per byte from the least significant bit
+func packBits(values []bool) []byte {
+	packed := make([]byte, (len(values)+7)/8)
+	for i, value := range values {
+		if value {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return packed
+}
+
+// Thrift compact protocol types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter : the part of thrift compact protocol needed for Parquet metadata, fields must be written in increasing id
+type thriftWriter struct {
+	buf bytes.Buffer
+	// lastField is the last field id of every open struct, field headers are a delta from it
+	lastField []int16
+}
+
+func (t *thriftWriter) structBegin() {
+	t.lastField = append(t.lastField, 0)
+}
+
+func (t *thriftWriter) structEnd() {
+	t.buf.WriteByte(0)
+	t.lastField = t.lastField[:len(t.lastField)-1]
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	last := &t.lastField[len(t.lastField)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.buf.Write(appendZigzag(nil, int64(id)))
+	}
+	*last = id
+}
+
+func (t *thriftWriter) i32(id int16, value int32) {
+	t.field(id, thriftI32)
+	t.buf.Write(appendZigzag(nil, int64(value)))
+}
+
+func (t *thriftWriter) i64(id int16, value int64) {
+	t.field(id, thriftI64)
+	t.buf.Write(appendZigzag(nil, value))
+}
+
+func (t *thriftWriter) binary(id int16, value string) {
+	t.field(id, thriftBinary)
+	t.buf.Write(binary.AppendUvarint(nil, uint64(len(value))))
+	t.buf.WriteString(value)
+}
+
+// structField : begin struct field, end it with structEnd
+func (t *thriftWriter) structField(id int16) {
+	t.field(id, thriftStruct)
+	t.structBegin()
+}
+
+// listBegin : list field header, the elements are written right after without field headers
+func (t *thriftWriter) listBegin(id int16, elemType byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | elemType)
+		return
+	}
+	t.buf.WriteByte(0xf0 | elemType)
+	t.buf.Write(binary.AppendUvarint(nil, uint64(size)))
+}
+
+func appendZigzag(b []byte, value int64) []byte {
+	return binary.AppendUvarint(b, uint64(value<<1^value>>63))
+}
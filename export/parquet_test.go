@@ -0,0 +1,243 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+// thriftReader : decode thrift compact protocol into maps of field id, enough to check the metadata written by thriftWriter
+type thriftReader struct {
+	r *bytes.Reader
+}
+
+func (t *thriftReader) zigzag() int64 {
+	value, _ := binary.ReadUvarint(t.r)
+	return int64(value>>1) ^ -int64(value&1)
+}
+
+func (t *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case 1, 2:
+		return typ == 1
+	case thriftI32, thriftI64:
+		return t.zigzag()
+	case thriftBinary:
+		length, _ := binary.ReadUvarint(t.r)
+		value := make([]byte, length)
+		t.r.Read(value)
+		return string(value)
+	case thriftList:
+		header, _ := t.r.ReadByte()
+		size := int(header >> 4)
+		if size == 15 {
+			length, _ := binary.ReadUvarint(t.r)
+			size = int(length)
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			list[i] = t.value(header & 0x0f)
+		}
+		return list
+	case thriftStruct:
+		fields := map[int16]interface{}{}
+		var id int16
+		for {
+			header, _ := t.r.ReadByte()
+			if header == 0 {
+				return fields
+			}
+			if delta := int16(header >> 4); delta != 0 {
+				id += delta
+			} else {
+				id = int16(t.zigzag())
+			}
+			fields[id] = t.value(header & 0x0f)
+		}
+	}
+	panic("unsupported thrift type")
+}
+
+func readStruct(data []byte) (map[int16]interface{}, int) {
+	r := bytes.NewReader(data)
+	fields := (&thriftReader{r: r}).value(thriftStruct).(map[int16]interface{})
+	return fields, len(data) - r.Len()
+}
+
+// readParquet : values of every column by name, decoded from the pages of every row group
+func readParquet(t *testing.T, file []byte) (map[int16]interface{}, map[string][]interface{}) {
+	assert.Equal(t, parquetMagic, string(file[:4]))
+	assert.Equal(t, parquetMagic, string(file[len(file)-4:]))
+	footerLength := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	metadata, n := readStruct(file[len(file)-8-footerLength : len(file)-8])
+	assert.Equal(t, footerLength, n)
+
+	columns := map[string][]interface{}{}
+	for _, rowGroup := range metadata[4].([]interface{}) {
+		for _, chunk := range rowGroup.(map[int16]interface{})[1].([]interface{}) {
+			meta := chunk.(map[int16]interface{})[3].(map[int16]interface{})
+			name := meta[3].([]interface{})[0].(string)
+			offset := meta[9].(int64)
+
+			header, n := readStruct(file[offset:])
+			numValues := int(header[5].(map[int16]interface{})[1].(int64))
+			page := file[int(offset)+n : int(offset)+n+int(header[3].(int64))]
+			assert.Equal(t, meta[7].(int64), int64(n+len(page)))
+
+			levelsLength := binary.LittleEndian.Uint32(page)
+			levels := bytes.NewReader(page[4 : 4+levelsLength])
+			run, _ := binary.ReadUvarint(levels)
+			assert.Equal(t, uint64(1), run&1, "bit-packed run")
+			packed := make([]byte, run>>1)
+			levels.Read(packed)
+			values := bytes.NewReader(page[4+levelsLength:])
+
+			var bit int
+			for i := 0; i < numValues; i++ {
+				if packed[i/8]&(1<<(i%8)) == 0 {
+					columns[name] = append(columns[name], nil)
+					continue
+				}
+				switch meta[1].(int64) {
+				case parquetBoolean:
+					b := page[int(4+levelsLength)+bit/8]
+					columns[name] = append(columns[name], b&(1<<(bit%8)) != 0)
+					bit++
+				case parquetInt32:
+					var value int32
+					binary.Read(values, binary.LittleEndian, &value)
+					columns[name] = append(columns[name], value)
+				case parquetInt64:
+					var value int64
+					binary.Read(values, binary.LittleEndian, &value)
+					columns[name] = append(columns[name], value)
+				case parquetByteArray:
+					var length uint32
+					binary.Read(values, binary.LittleEndian, &length)
+					value := make([]byte, length)
+					values.Read(value)
+					columns[name] = append(columns[name], string(value))
+				}
+			}
+		}
+	}
+	return metadata, columns
+}
+
+func TestParquetWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(FormatParquet, &buf, testColumns)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Write(testRows[0]))
+	// Every flush ends a row group
+	assert.NoError(t, w.Flush())
+	assert.NoError(t, w.Write(testRows[1]))
+	assert.NoError(t, w.Close())
+
+	metadata, columns := readParquet(t, buf.Bytes())
+	assert.Equal(t, int64(2), metadata[3])
+	assert.Len(t, metadata[4], 2)
+
+	schema := metadata[2].([]interface{})
+	assert.Len(t, schema, len(testColumns)+1)
+	assert.Equal(t, int64(len(testColumns)), schema[0].(map[int16]interface{})[5])
+	for i, column := range testColumns {
+		element := schema[i+1].(map[int16]interface{})
+		assert.Equal(t, column.Name, element[4])
+		assert.Equal(t, int64(parquetOptional), element[3])
+	}
+	assert.Equal(t, int64(parquetTimestampMillis), schema[4].(map[int16]interface{})[6])
+
+	assert.Equal(t, []interface{}{"a1", "b2, \"Jr\""}, columns["id"])
+	assert.Equal(t, []interface{}{true, false}, columns["otp_login_enabled"])
+	assert.Equal(t, []interface{}{int64(3), nil}, columns["version"])
+	assert.Equal(t, []interface{}{int64(1704164645000), int64(1704240000000)}, columns["created_at"])
+	assert.Equal(t, []interface{}{int32(7441), nil}, columns["date_of_birth"])
+	assert.Equal(t, []interface{}{`{"nik":"1234"}`, `{}`}, columns["attributes"])
+}
+
+func TestParquetWriterManyColumnsAndRows(t *testing.T) {
+	var columns []Column
+	row := make([]interface{}, 20)
+	for i := range row {
+		columns = append(columns, Column{Name: string(rune('a' + i)), Type: Int})
+		row[i] = int64(i)
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(FormatParquet, &buf, columns)
+	assert.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		if i%7 == 0 {
+			row[19] = nil
+		} else {
+			row[19] = int64(math.MaxInt64)
+		}
+		assert.NoError(t, w.Write(row))
+	}
+	assert.NoError(t, w.Close())
+
+	metadata, values := readParquet(t, buf.Bytes())
+	assert.Equal(t, int64(1000), metadata[3])
+	assert.Len(t, values["t"], 1000)
+	assert.Nil(t, values["t"][0])
+	assert.Equal(t, int64(math.MaxInt64), values["t"][1])
+	assert.Equal(t, int64(4), values["e"][999])
+}
+
+func TestParquetWriterEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(FormatParquet, &buf, testColumns)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	metadata, columns := readParquet(t, buf.Bytes())
+	assert.Equal(t, int64(0), metadata[3])
+	assert.Empty(t, columns)
+}
+
+// parquetTestRow : testColumns as read by parquet-go, names and types are taken from the file schema
+type parquetTestRow struct {
+	ID              *string `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	OTPLoginEnabled *bool   `parquet:"name=otp_login_enabled, type=BOOLEAN, repetitiontype=OPTIONAL"`
+	Version         *int64  `parquet:"name=version, type=INT64, repetitiontype=OPTIONAL"`
+	CreatedAt       *int64  `parquet:"name=created_at, type=INT64, convertedtype=TIMESTAMP_MILLIS, repetitiontype=OPTIONAL"`
+	DateOfBirth     *int32  `parquet:"name=date_of_birth, type=INT32, convertedtype=DATE, repetitiontype=OPTIONAL"`
+	Attributes      *string `parquet:"name=attributes, type=BYTE_ARRAY, convertedtype=JSON, repetitiontype=OPTIONAL"`
+}
+
+func TestParquetWriterReadByParquetGo(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(FormatParquet, &buf, testColumns)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Write(testRows[0]))
+	assert.NoError(t, w.Flush())
+	assert.NoError(t, w.Write(testRows[1]))
+	assert.NoError(t, w.Close())
+
+	file, err := buffer.NewBufferFile(buf.Bytes())
+	assert.NoError(t, err)
+	pr, err := reader.NewParquetReader(file, new(parquetTestRow), 1)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer pr.ReadStop()
+	assert.Equal(t, int64(2), pr.GetNumRows())
+
+	rows := make([]parquetTestRow, pr.GetNumRows())
+	assert.NoError(t, pr.Read(&rows))
+
+	str := func(s string) *string { return &s }
+	boolean := func(b bool) *bool { return &b }
+	i64 := func(i int64) *int64 { return &i }
+	i32 := func(i int32) *int32 { return &i }
+	assert.Equal(t, []parquetTestRow{
+		{ID: str("a1"), OTPLoginEnabled: boolean(true), Version: i64(3), CreatedAt: i64(1704164645000), DateOfBirth: i32(7441), Attributes: str(`{"nik":"1234"}`)},
+		{ID: str("b2, \"Jr\""), OTPLoginEnabled: boolean(false), CreatedAt: i64(1704240000000), Attributes: str(`{}`)},
+	}, rows)
+}
@@ -0,0 +1,310 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/oauth"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// authorizationCodeTTL : lifetime of authorization codes, the relying party exchanges them right after the redirect
+const authorizationCodeTTL = time.Minute
+
+// scopeDescriptions : what the user allows the relying party to read, shown on the consent page
+var scopeDescriptions = map[string]string{
+	oauth.ScopeOpenID:  "Your account id",
+	oauth.ScopeProfile: "Your name, language, date of birth and photo",
+	oauth.ScopeEmail:   "Your email address",
+	oauth.ScopePhone:   "Your phone number",
+}
+
+// authorizeTemplate : minimal login and consent page, request parameters are carried in hidden fields
+var authorizeTemplate = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Sign in to {{.ClientName}}</title>
+<style>
+body { font-family: sans-serif; max-width: 24rem; margin: 3rem auto; padding: 0 1rem; }
+label, input, button { display: block; width: 100%; box-sizing: border-box; margin-bottom: .75rem; }
+input { padding: .5rem; }
+button { padding: .6rem; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+{{if .Fatal}}
+<h1>Sign in failed</h1>
+<p class="error">{{.Error}}</p>
+{{else}}
+<h1>Sign in to {{.ClientName}}</h1>
+<p>{{.ClientName}} will be able to read:</p>
+<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="post" action="authorize">
+{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<label for="login">Phone number or email</label>
+<input id="login" name="login" value="{{.Login}}" autocomplete="username" required>
+<label for="password">Password</label>
+<input id="password" name="password" type="password" autocomplete="current-password" required>
+<button type="submit" name="consent" value="allow">Sign in and allow</button>
+<button type="submit" name="consent" value="deny" formnovalidate>Deny</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+// authorizePage : data of the authorize template
+type authorizePage struct {
+	ClientName string
+	Scopes     []string
+	Params     map[string]string
+	Login      string
+	Error      string
+	// Fatal is set when the request cannot be redirected back to the relying party
+	Fatal bool
+}
+
+// authorizeRequest : validated authorization request of the relying party
+type authorizeRequest struct {
+	Client        repository.OAuthClient
+	RedirectURI   string
+	Scopes        []string
+	State         string
+	Nonce         string
+	CodeChallenge string
+}
+
+// authorizeError : error of authorization request, redirected to the relying party unless the client or redirect uri is invalid
+type authorizeError struct {
+	redirect    bool
+	code        string
+	description string
+}
+
+func (e *authorizeError) Error() string {
+	return e.code + ": " + e.description
+}
+
+// hashAuthorizationCode : SHA-256 of the authorization code, codes are random so a fast hash is enough
+func hashAuthorizationCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// parseAuthorizeRequest : validate authorization request, read from the query on GET and from the form on POST
+func (s *Server) parseAuthorizeRequest(ctx echo.Context) (authorizeRequest, error) {
+	req := authorizeRequest{
+		RedirectURI:   ctx.FormValue("redirect_uri"),
+		State:         ctx.FormValue("state"),
+		Nonce:         ctx.FormValue("nonce"),
+		CodeChallenge: ctx.FormValue("code_challenge"),
+	}
+
+	// Errors about the client or redirect uri are shown to the user, redirecting would send them to an unknown site
+	clientID := ctx.FormValue("client_id")
+	if clientID == "" {
+		return req, &authorizeError{code: "invalid_request", description: "client_id is required"}
+	}
+	client, err := s.Repository.FindOAuthClient(ctx.Request().Context(), clientID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return req, &authorizeError{code: "invalid_client", description: "Unknown client"}
+	}
+	if err != nil {
+		return req, err
+	}
+	req.Client = client
+	if !oauth.HasRedirectURI(client, req.RedirectURI) {
+		return req, &authorizeError{code: "invalid_request", description: "redirect_uri is not registered for the client"}
+	}
+
+	if ctx.FormValue("response_type") != "code" {
+		return req, &authorizeError{redirect: true, code: "unsupported_response_type", description: "Only code response type is supported"}
+	}
+	scopes := strings.Fields(ctx.FormValue("scope"))
+	if !containsScope(scopes, oauth.ScopeOpenID) {
+		return req, &authorizeError{redirect: true, code: "invalid_scope", description: "openid scope is required"}
+	}
+	req.Scopes, err = oauth.GrantScopes(client, scopes, oauth.UserScopes)
+	if err != nil {
+		return req, &authorizeError{redirect: true, code: "invalid_scope", description: "Requested scope is not allowed for the client"}
+	}
+	if req.CodeChallenge == "" || ctx.FormValue("code_challenge_method") != "S256" {
+		return req, &authorizeError{redirect: true, code: "invalid_request", description: "PKCE code_challenge with S256 method is required"}
+	}
+	if len(req.Nonce) > 255 {
+		return req, &authorizeError{redirect: true, code: "invalid_request", description: "nonce must be at most 255 characters"}
+	}
+	return req, nil
+}
+
+// authorizeRedirect : send the user back to the relying party with the response parameters
+func authorizeRedirect(ctx echo.Context, req authorizeRequest, params url.Values) error {
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	redirectURI, _ := url.Parse(req.RedirectURI)
+	query := redirectURI.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	redirectURI.RawQuery = query.Encode()
+	return ctx.Redirect(http.StatusFound, redirectURI.String())
+}
+
+// renderAuthorize : render login and consent page, it must not be framed or cached
+func renderAuthorize(ctx echo.Context, status int, req authorizeRequest, page authorizePage) error {
+	header := ctx.Response().Header()
+	header.Set("Cache-Control", "no-store")
+	header.Set("X-Frame-Options", "DENY")
+	header.Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+
+	if !page.Fatal {
+		page.ClientName = req.Client.Name
+		for _, scope := range req.Scopes {
+			page.Scopes = append(page.Scopes, scopeDescriptions[scope])
+		}
+		page.Params = map[string]string{
+			"response_type":         "code",
+			"client_id":             req.Client.ID,
+			"redirect_uri":          req.RedirectURI,
+			"scope":                 strings.Join(req.Scopes, " "),
+			"state":                 req.State,
+			"nonce":                 req.Nonce,
+			"code_challenge":        req.CodeChallenge,
+			"code_challenge_method": "S256",
+		}
+	}
+
+	var body strings.Builder
+	if err := authorizeTemplate.Execute(&body, page); err != nil {
+		log.Error(err)
+		return ctx.String(http.StatusInternalServerError, "Internal Server Error")
+	}
+	return ctx.HTML(status, body.String())
+}
+
+// authorizeFailed : show or redirect error of the authorization request
+func authorizeFailed(ctx echo.Context, req authorizeRequest, err error) error {
+	var authErr *authorizeError
+	if !errors.As(err, &authErr) {
+		log.Error(err)
+		return renderAuthorize(ctx, http.StatusInternalServerError, req, authorizePage{Fatal: true, Error: "Something went wrong, please try again later"})
+	}
+	if !authErr.redirect {
+		return renderAuthorize(ctx, http.StatusBadRequest, req, authorizePage{Fatal: true, Error: authErr.description})
+	}
+	return authorizeRedirect(ctx, req, url.Values{"error": {authErr.code}, "error_description": {authErr.description}})
+}
+
+// GetAuthorize : this handler is for OpenID Connect authorization request, rendering the login and consent page
+func (s *Server) GetAuthorize(ctx echo.Context, _ generated.GetAuthorizeParams) error {
+	// Parameters are read with FormValue so GET and POST share the same validation
+	req, err := s.parseAuthorizeRequest(ctx)
+	if err != nil {
+		return authorizeFailed(ctx, req, err)
+	}
+	return renderAuthorize(ctx, http.StatusOK, req, authorizePage{})
+}
+
+// PostAuthorize : this handler is for the submitted login and consent page, redirecting with authorization code
+func (s *Server) PostAuthorize(ctx echo.Context) error {
+	req, err := s.parseAuthorizeRequest(ctx)
+	if err != nil {
+		return authorizeFailed(ctx, req, err)
+	}
+
+	if ctx.FormValue("consent") != "allow" {
+		return authorizeRedirect(ctx, req, url.Values{"error": {"access_denied"}, "error_description": {"The user denied the request"}})
+	}
+
+	login := strings.TrimSpace(ctx.FormValue("login"))
+	user, ok, err := s.checkCredentials(ctx, login, ctx.FormValue("password"))
+	if err != nil {
+		return authorizeFailed(ctx, req, err)
+	}
+	if !ok {
+		return renderAuthorize(ctx, http.StatusBadRequest, req, authorizePage{Login: login, Error: invalidCredentialsMessage})
+	}
+
+	codeBytes := make([]byte, 32)
+	if _, err := rand.Read(codeBytes); err != nil {
+		return authorizeFailed(ctx, req, err)
+	}
+	code := hex.EncodeToString(codeBytes)
+
+	now := time.Now()
+	err = s.Repository.CreateAuthorizationCode(ctx.Request().Context(), repository.AuthorizationCode{
+		CodeHash:      hashAuthorizationCode(code),
+		ClientID:      req.Client.ID,
+		UserID:        user.ID,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        req.Scopes,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		AuthTime:      now,
+		ExpiresAt:     now.Add(authorizationCodeTTL),
+	})
+	if err != nil {
+		return authorizeFailed(ctx, req, err)
+	}
+
+	// Signing in through a relying party counts as a login like the other login methods
+	if err := s.Repository.IncreaseLoginAttempt(ctx.Request().Context(), user.Phone); err != nil {
+		log.Error(err)
+	}
+
+	return authorizeRedirect(ctx, req, url.Values{"code": {code}})
+}
+
+// checkCredentials : find user by phone number or email and compare the password, unknown users take the same time as a wrong password
+func (s *Server) checkCredentials(ctx echo.Context, login, password string) (repository.User, bool, error) {
+	identifier := repository.Param{
+		Logic:    "AND",
+		Field:    "email",
+		Operator: "=",
+		Value:    strings.ToLower(login),
+	}
+	if !strings.Contains(login, "@") {
+		phoneNumber, err := s.Phone.Normalize(login)
+		if err != nil {
+			return repository.User{}, false, nil
+		}
+		identifier.Field = "phone"
+		identifier.Value = phoneNumber
+	}
+
+	user, err := s.Users.FindLoginUser(ctx.Request().Context(), identifier)
+	if errors.Is(err, repository.ErrNotFound) {
+		s.Users.CheckPassword(nil, password)
+		return repository.User{}, false, nil
+	}
+	if err != nil {
+		return repository.User{}, false, err
+	}
+
+	if !s.Users.CheckPassword(&user, password) {
+		return repository.User{}, false, nil
+	}
+	// Unverified email cannot be used to login, same as the login endpoint
+	if identifier.Field == "email" && user.EmailVerifiedAt == nil {
+		return repository.User{}, false, nil
+	}
+	if user.DeactivatedAt != nil {
+		return repository.User{}, false, nil
+	}
+	return user, true, nil
+}
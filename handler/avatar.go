@@ -0,0 +1,233 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"net/http"
+
+	"github.com/SawitProRecruitment/UserService/service"
+)
+
+const (
+	// maxAvatarSize : maximum size of uploaded avatar file in bytes
+	maxAvatarSize = 5 << 20
+	// maxAvatarPixels : maximum width * height of uploaded avatar, protect against decompression bomb
+	maxAvatarPixels = 40_000_000
+	// defaultAvatarSize : thumbnail size returned when size is not requested
+	defaultAvatarSize = 256
+)
+
+var (
+	errUnsupportedImage = errors.New("unsupported image type")
+	errImageTooLarge    = errors.New("image dimension too large")
+)
+
+func isAvatarSize(size int) bool {
+	for _, avatarSize := range service.AvatarSizes {
+		if avatarSize == size {
+			return true
+		}
+	}
+	return false
+}
+
+// processAvatar : decode uploaded image and encode square JPEG thumbnails, re-encoding drop all metadata including EXIF
+func processAvatar(data []byte) (map[int][]byte, error) {
+	switch http.DetectContentType(data) {
+	case "image/jpeg", "image/png", "image/gif":
+	default:
+		return nil, errUnsupportedImage
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxAvatarPixels {
+		return nil, errImageTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	// Camera photos are stored sideways with EXIF orientation, apply it before the EXIF is dropped
+	if format == "jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+
+	// Crop center square
+	bounds := img.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	crop := image.Rect(0, 0, side, side).Add(bounds.Min).Add(image.Pt((bounds.Dx()-side)/2, (bounds.Dy()-side)/2))
+
+	thumbnails := make(map[int][]byte, len(service.AvatarSizes))
+	var previous image.Image
+	for _, size := range service.AvatarSizes {
+		// Downscale from the previous thumbnail so the original is only scanned once
+		var thumbnail *image.RGBA
+		if previous == nil {
+			thumbnail = resizeSquare(img, crop, size)
+		} else {
+			thumbnail = resizeSquare(previous, previous.Bounds(), size)
+		}
+		previous = thumbnail
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, thumbnail, &jpeg.Options{Quality: 85}); err != nil {
+			return nil, err
+		}
+		thumbnails[size] = buf.Bytes()
+	}
+	return thumbnails, nil
+}
+
+// resizeSquare : scale square region of the image to size x size using box filter, transparent pixels are flattened on white
+func resizeSquare(src image.Image, crop image.Rectangle, size int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	side := crop.Dx()
+	for y := 0; y < size; y++ {
+		sy0 := crop.Min.Y + y*side/size
+		sy1 := crop.Min.Y + (y+1)*side/size
+		if sy1 <= sy0 {
+			sy1 = sy0 + 1
+		}
+		for x := 0; x < size; x++ {
+			sx0 := crop.Min.X + x*side/size
+			sx1 := crop.Min.X + (x+1)*side/size
+			if sx1 <= sx0 {
+				sx1 = sx0 + 1
+			}
+
+			var r, g, b, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					// Colors are alpha premultiplied, adding the missing alpha composite over white
+					r += uint64(cr + 0xffff - ca)
+					g += uint64(cg + 0xffff - ca)
+					b += uint64(cb + 0xffff - ca)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(b / n >> 8), A: 0xff})
+		}
+	}
+	return dst
+}
+
+// jpegOrientation : read EXIF orientation tag of JPEG data, 1 (normal) when absent
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		// Metadata segments come before start of scan
+		if marker == 0xDA || marker == 0xD9 {
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		if marker == 0xE1 {
+			if orientation := exifOrientation(data[i+4 : i+2+length]); orientation != 0 {
+				return orientation
+			}
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// exifOrientation : read orientation tag from IFD0 of APP1 EXIF segment, 0 when absent or invalid
+func exifOrientation(segment []byte) int {
+	if len(segment) < 14 || string(segment[:6]) != "Exif\x00\x00" {
+		return 0
+	}
+	tiff := segment[6:]
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for n := 0; n < count; n++ {
+		entry := offset + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation < 1 || orientation > 8 {
+				return 0
+			}
+			return orientation
+		}
+	}
+	return 0
+}
+
+// applyOrientation : rotate or flip the image so EXIF orientation becomes normal
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		for x := 0; x < dstW; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // flip horizontal
+				sx, sy = w-1-x, y
+			case 3: // rotate 180
+				sx, sy = w-1-x, h-1-y
+			case 4: // flip vertical
+				sx, sy = x, h-1-y
+			case 5: // transpose
+				sx, sy = y, x
+			case 6: // rotate 90 clockwise
+				sx, sy = y, h-1-x
+			case 7: // transverse
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotate 90 counter clockwise
+				sx, sy = w-1-y, x
+			}
+			dst.Set(x, y, img.At(bounds.Min.X+sx, bounds.Min.Y+sy))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/SawitProRecruitment/UserService/service"
+	"github.com/stretchr/testify/assert"
+)
+
+// testImage : encode image where left half is red and right half is blue
+func testImage(t *testing.T, width, height int, encode func(*bytes.Buffer, image.Image) error) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < width/2 {
+				img.Set(x, y, color.RGBA{R: 0xff, A: 0xff})
+			} else {
+				img.Set(x, y, color.RGBA{B: 0xff, A: 0xff})
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, encode(&buf, img))
+	return buf.Bytes()
+}
+
+func encodePNG(buf *bytes.Buffer, img image.Image) error {
+	return png.Encode(buf, img)
+}
+
+func encodeJPEG(buf *bytes.Buffer, img image.Image) error {
+	return jpeg.Encode(buf, img, nil)
+}
+
+// withOrientation : insert APP1 EXIF segment with orientation tag right after JPEG SOI marker
+func withOrientation(data []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	entry := make([]byte, 12)
+	binary.BigEndian.PutUint16(entry[0:], 0x0112)
+	binary.BigEndian.PutUint16(entry[2:], 3)
+	binary.BigEndian.PutUint32(entry[4:], 1)
+	binary.BigEndian.PutUint16(entry[8:], orientation)
+	segment := append([]byte("Exif\x00\x00"), append(append(tiff, entry...), 0, 0, 0, 0)...)
+
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	result := append([]byte{}, data[:2]...)
+	result = append(result, app1...)
+	return append(result, data[2:]...)
+}
+
+func TestProcessAvatar(t *testing.T) {
+	thumbnails, err := processAvatar(testImage(t, 300, 200, encodePNG))
+	assert.NoError(t, err)
+	assert.Len(t, thumbnails, len(service.AvatarSizes))
+
+	for _, size := range service.AvatarSizes {
+		img, format, err := image.Decode(bytes.NewReader(thumbnails[size]))
+		assert.NoError(t, err)
+		assert.Equal(t, "jpeg", format)
+		assert.Equal(t, image.Rect(0, 0, size, size), img.Bounds())
+	}
+}
+
+func TestProcessAvatarStripExif(t *testing.T) {
+	data := withOrientation(testImage(t, 40, 40, encodeJPEG), 1)
+	assert.True(t, bytes.Contains(data, []byte("Exif")))
+
+	thumbnails, err := processAvatar(data)
+	assert.NoError(t, err)
+	for _, thumbnail := range thumbnails {
+		assert.False(t, bytes.Contains(thumbnail, []byte("Exif")))
+	}
+}
+
+func TestProcessAvatarUnsupported(t *testing.T) {
+	_, err := processAvatar([]byte("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"))
+	assert.ErrorIs(t, err, errUnsupportedImage)
+
+	_, err = processAvatar([]byte("plain text"))
+	assert.ErrorIs(t, err, errUnsupportedImage)
+}
+
+func TestJpegOrientation(t *testing.T) {
+	data := testImage(t, 8, 8, encodeJPEG)
+	assert.Equal(t, 1, jpegOrientation(data))
+
+	for orientation := uint16(1); orientation <= 8; orientation++ {
+		assert.Equal(t, int(orientation), jpegOrientation(withOrientation(data, orientation)))
+	}
+
+	// Invalid orientation value is ignored
+	assert.Equal(t, 1, jpegOrientation(withOrientation(data, 9)))
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// 2x1 image, red on the left and blue on the right
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	red := color.RGBA{R: 0xff, A: 0xff}
+	blue := color.RGBA{B: 0xff, A: 0xff}
+	img.Set(0, 0, red)
+	img.Set(1, 0, blue)
+
+	// Flip horizontal swap the colors
+	flipped := applyOrientation(img, 2)
+	assert.Equal(t, blue, flipped.At(0, 0))
+	assert.Equal(t, red, flipped.At(1, 0))
+
+	// Rotate 90 clockwise put left pixel on top
+	rotated := applyOrientation(img, 6)
+	assert.Equal(t, image.Rect(0, 0, 1, 2), rotated.Bounds())
+	assert.Equal(t, red, rotated.At(0, 0))
+	assert.Equal(t, blue, rotated.At(0, 1))
+
+	// Rotate 90 counter clockwise put right pixel on top
+	rotated = applyOrientation(img, 8)
+	assert.Equal(t, blue, rotated.At(0, 0))
+	assert.Equal(t, red, rotated.At(0, 1))
+
+	// Normal orientation keep the image
+	assert.Equal(t, image.Image(img), applyOrientation(img, 1))
+}
+
+func TestResizeSquare(t *testing.T) {
+	// Transparent pixels are flattened on white
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	resized := resizeSquare(img, img.Bounds(), 2)
+	assert.Equal(t, color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}, resized.At(0, 0))
+
+	// Box filter average the source pixels
+	img.Set(0, 0, color.NRGBA{A: 0xff})
+	img.Set(1, 0, color.NRGBA{A: 0xff})
+	img.Set(0, 1, color.NRGBA{A: 0xff})
+	img.Set(1, 1, color.NRGBA{A: 0xff})
+	resized = resizeSquare(img, img.Bounds(), 2)
+	assert.Equal(t, color.RGBA{A: 0xff}, resized.At(0, 0))
+	assert.Equal(t, color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}, resized.At(1, 1))
+}
@@ -5,13 +5,16 @@ import (
 	"fmt"
 	"github.com/SawitProRecruitment/UserService/generated"
 	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/service"
+	"github.com/SawitProRecruitment/UserService/storage"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/gommon/log"
-	"github.com/lib/pq"
-	"golang.org/x/crypto/bcrypt"
+	"io"
+	"mime"
 	"net/http"
-	"time"
+	"path"
+	"strconv"
 )
 
 // Todo : create standard response helper
@@ -32,117 +35,223 @@ func (s *Server) PostRegistration(ctx echo.Context) error {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request payload"})
 	}
 
-	// Perform validation
-	if !isValidPhoneNumber(req.Phone) {
-		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid phone number. Phone numbers must start with +62 and be 10 to 13 characters in total"})
+	id, err := s.Users.Register(ctx.Request().Context(), req.Phone, req.Name, req.Password)
+	if err != nil {
+		return respondError(ctx, registrationError(err))
 	}
+	return ctx.JSON(http.StatusOK, map[string]string{"message": "Registration successful", "id": id})
+}
+
+// PostLogin : This handler is for login, returning jwt token
+func (s *Server) PostLogin(ctx echo.Context) error {
+	req := new(generated.PostLoginJSONRequestBody)
 
-	if len(req.Name) < 3 || len(req.Name) > 60 {
-		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid full name. Full names must be 3 to 60 characters"})
+	if err := ctx.Bind(req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request payload"})
 	}
 
-	if !isValidPassword(req.Password) {
-		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid password. Passwords must be 6 to 64 characters and contain at least 1 uppercase letter, 1 digit, and 1 special character"})
+	result, err := s.Users.Login(ctx.Request().Context(), service.LoginInput{
+		Phone:    req.Phone,
+		Email:    req.Email,
+		Password: req.Password,
+	})
+	if err != nil {
+		return respondError(ctx, serviceError(err, "Internal Server Error"))
 	}
+	return ctx.JSON(http.StatusOK, map[string]string{"message": "Login successful", "token": result.Token, "phone": result.User.Phone})
+}
 
-	// Generate a random salt
-	salt, err := generateRandomSalt()
-	if err != nil { // Todo : make this function as interface, this error cannot covered by unit test by now
+// GetProfile : this handler is for getting profile of user
+func (s *Server) GetProfile(ctx echo.Context) error {
+	// Todo : create middleware to check the token
+	// Validate token
+	ID, err := s.authenticate(ctx, scopeProfileRead)
+	if err != nil {
 		log.Error(err)
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
 	}
 
-	// Combine the password and salt, then hash the result
-	hashedPassword, err := hashPassword(req.Password, salt)
-	if err != nil { // Todo : make this function as interface, this error cannot covered by unit test by now
-		log.Error(err)
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	user, err := s.Users.GetUser(ctx.Request().Context(), ID)
+	if err != nil {
+		return respondError(ctx, serviceError(err, "Internal Server Error"))
 	}
 
-	output, err := s.Repository.Registration(ctx.Request().Context(), repository.RegistrationInput{
-		ID:       uuid.NewString(),
-		Phone:    req.Phone,
-		Name:     req.Name,
-		Password: hashedPassword,
-		Salt:     salt,
-	})
+	ctx.Response().Header().Set("ETag", formatETag(user.Version))
+	return ctx.JSON(http.StatusOK, toUserProfile(user))
+}
 
+// PutProfile : this handler is for updating profile of user, If-Match header is checked against current ETag
+func (s *Server) PutProfile(ctx echo.Context, params generated.PutProfileParams) error {
+	// Todo : create middleware to check the token
+	// Validate token
+	ID, err := s.authenticate(ctx, scopeProfileWrite)
 	if err != nil {
-		var pqErr *pq.Error
-		if errors.As(err, &pqErr) {
-			// Check if the error code is 23505 (unique violation)
-			if pqErr.Code == "23505" {
-				return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Phone number already exist"})
-			}
-		}
 		log.Error(err)
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Error when registering user"})
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
 	}
-	return ctx.JSON(http.StatusOK, map[string]string{"message": "Registration successful", "id": output.ID})
-}
 
-// PostLogin : This handler is for login, returning jwt token
-func (s *Server) PostLogin(ctx echo.Context) error {
-	req := new(generated.PostLoginJSONRequestBody)
+	req := new(generated.PutProfileJSONRequestBody)
 
 	if err := ctx.Bind(req); err != nil {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request payload"})
 	}
 
-	// Perform validation
-	if !isValidPhoneNumber(req.Phone) {
-		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid phone number. Phone numbers must start with +62 and be 10 to 13 characters in total"})
+	// Apply requested fields on top of current profile, absent fields keep old value
+	version, err := s.Users.UpdateProfile(ctx.Request().Context(), service.ProfileUpdate{
+		UserID: ID,
+		Fields: map[string]*string{
+			"phone":              req.Phone,
+			"name":               req.Name,
+			"email":              req.Email,
+			"preferred_language": req.PreferredLanguage,
+			"avatar_url":         req.AvatarUrl,
+			"date_of_birth":      req.DateOfBirth,
+			"address":            req.Address,
+			"estate":             req.Estate,
+			"region":             req.Region,
+		},
+		Attributes:   req.Attributes,
+		Precondition: ifMatchPrecondition(params.IfMatch),
+	})
+	if err != nil {
+		return respondError(ctx, serviceError(err, "Error when registering user"))
 	}
 
-	if !isValidPassword(req.Password) {
-		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid password. Passwords must be 6 to 64 characters and contain at least 1 uppercase letter, 1 digit, and 1 special character"})
+	ctx.Response().Header().Set("ETag", formatETag(version))
+	return ctx.JSON(http.StatusOK, map[string]string{"message": "User updated"})
+}
+
+// PatchProfile : this handler is for partially updating profile of user using JSON Merge Patch or JSON Patch
+func (s *Server) PatchProfile(ctx echo.Context, params generated.PatchProfileParams) error {
+	// Validate token
+	ID, err := s.authenticate(ctx, scopeProfileWrite)
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
 	}
 
-	// Find user by phone to database
-	user, err := s.Repository.FindUser(ctx.Request().Context(), repository.Param{
-		Logic:    "AND",
-		Field:    "phone",
-		Operator: "=",
-		Value:    req.Phone,
+	contentType := ctx.Request().Header.Get(echo.HeaderContentType)
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = mediaType
+	}
+	if contentType != mergePatchContentType && contentType != jsonPatchContentType {
+		return ctx.JSON(http.StatusUnsupportedMediaType, map[string]string{"message": "Unsupported patch format"})
+	}
+
+	patch, err := io.ReadAll(http.MaxBytesReader(ctx.Response(), ctx.Request().Body, maxPatchSize))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return ctx.JSON(http.StatusRequestEntityTooLarge, map[string]string{"message": "Patch document must be at most 64 KB"})
+	}
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request payload"})
+	}
+
+	user, err := s.Users.PatchProfile(ctx.Request().Context(), service.ProfilePatch{
+		UserID: ID,
+		// Apply patch to current profile document
+		Apply: func(current map[string]interface{}) (patched map[string]interface{}, err error) {
+			if contentType == mergePatchContentType {
+				patched, err = applyMergePatch(current, patch)
+			} else {
+				patched, err = applyJSONPatch(current, patch)
+			}
+			if err != nil {
+				log.Error(err)
+				return nil, &service.ValidationError{Message: "Invalid patch document"}
+			}
+			return patched, nil
+		},
+		Precondition: ifMatchPrecondition(params.IfMatch),
 	})
+	if err != nil {
+		return respondError(ctx, serviceError(err, "Error when updating user"))
+	}
+
+	ctx.Response().Header().Set("ETag", formatETag(user.Version))
+	return ctx.JSON(http.StatusOK, toUserProfile(user))
+}
+
+// ifMatchPrecondition : check of the current version against the If-Match header, nil when the header is not set
+func ifMatchPrecondition(ifMatch *string) func(version int) bool {
+	if ifMatch == nil {
+		return nil
+	}
+	return func(version int) bool {
+		return matchETag(*ifMatch, version)
+	}
+}
+
+// PutProfileAvatar : this handler is for uploading profile photo, stored as resized thumbnails
+func (s *Server) PutProfileAvatar(ctx echo.Context) error {
+	// Validate token
+	ID, err := s.authenticate(ctx, scopeProfileWrite)
 	if err != nil {
 		log.Error(err)
-		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "User not found"})
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
 	}
 
-	// Compare password
-	passwordWithSalt := req.Password + user.Salt
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(passwordWithSalt)); err != nil {
+	// Limit the whole request body, multipart overhead is allowed on top of the file size
+	ctx.Request().Body = http.MaxBytesReader(ctx.Response(), ctx.Request().Body, maxAvatarSize+1<<20)
+
+	fileHeader, err := ctx.FormFile("avatar")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return ctx.JSON(http.StatusRequestEntityTooLarge, map[string]string{"message": "Avatar must be at most 5 MB"})
+		}
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request payload"})
+	}
+	if fileHeader.Size > maxAvatarSize {
+		return ctx.JSON(http.StatusRequestEntityTooLarge, map[string]string{"message": "Avatar must be at most 5 MB"})
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
 		log.Error(err)
-		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid password"})
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request payload"})
 	}
+	defer file.Close()
 
-	// create jwt token
-	exp := time.Now().Add(time.Hour * 1)
-	token, err := createToken(user.ID, exp)
-	if err != nil { // Todo : make this function as interface, this error cannot covered by unit test by now
+	data, err := io.ReadAll(io.LimitReader(file, maxAvatarSize))
+	if err != nil {
 		log.Error(err)
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request payload"})
 	}
 
-	// Login attempt increment
-	err = s.Repository.IncreaseLoginAttempt(ctx.Request().Context(), req.Phone)
+	// Sniff, decode and resize the image
+	thumbnails, err := processAvatar(data)
+	if errors.Is(err, errUnsupportedImage) {
+		return ctx.JSON(http.StatusUnsupportedMediaType, map[string]string{"message": "Avatar must be a JPEG, PNG or GIF image"})
+	}
+	if errors.Is(err, errImageTooLarge) {
+		return ctx.JSON(http.StatusRequestEntityTooLarge, map[string]string{"message": "Avatar dimension is too large"})
+	}
 	if err != nil {
 		log.Error(err)
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid image"})
 	}
 
-	return ctx.JSON(http.StatusOK, map[string]string{"message": "Login successful", "token": token, "phone": user.Phone})
+	err = s.Users.UpdateAvatar(ctx.Request().Context(), ID, thumbnails)
+	if err != nil {
+		return respondError(ctx, serviceError(err, "Internal Server Error"))
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]string{"message": "Avatar updated"})
 }
 
-// GetProfile : this handler is for getting profile of user
-func (s *Server) GetProfile(ctx echo.Context) error {
-	// Todo : create middleware to check the token
-	// Validate token
-	ID, err := validateToken(ctx)
-	if err != nil {
-		log.Error(err)
-		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
+// GetUsersIdAvatar : this handler is for getting avatar thumbnail of user
+func (s *Server) GetUsersIdAvatar(ctx echo.Context, id string, params generated.GetUsersIdAvatarParams) error {
+	size := defaultAvatarSize
+	if params.Size != nil {
+		size = *params.Size
+	}
+	if !isAvatarSize(size) {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid size. Size must be one of 64, 128, 256 or 512"})
+	}
+
+	if _, err := uuid.Parse(id); err != nil {
+		return ctx.JSON(http.StatusNotFound, map[string]string{"message": "User not found"})
 	}
 
 	// Find user by ID
@@ -150,84 +259,132 @@ func (s *Server) GetProfile(ctx echo.Context) error {
 		Logic:    "AND",
 		Field:    "id",
 		Operator: "=",
-		Value:    ID,
+		Value:    id,
 	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return ctx.JSON(http.StatusNotFound, map[string]string{"message": "User not found"})
+	}
 	if err != nil {
 		log.Error(err)
-		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "User not found"})
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+	if user.AvatarKey == nil {
+		return ctx.JSON(http.StatusNotFound, map[string]string{"message": "Avatar not found"})
+	}
+
+	objectKey := service.AvatarObjectKey(*user.AvatarKey, size)
+	etag := `"` + path.Base(*user.AvatarKey) + "-" + strconv.Itoa(size) + `"`
+	ctx.Response().Header().Set("ETag", etag)
+	ctx.Response().Header().Set("Cache-Control", "public, max-age=300")
+	if ctx.Request().Header.Get("If-None-Match") == etag {
+		return ctx.NoContent(http.StatusNotModified)
+	}
+
+	body, info, err := s.BlobStore.Get(ctx.Request().Context(), objectKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return ctx.JSON(http.StatusNotFound, map[string]string{"message": "Avatar not found"})
+	}
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
 	}
+	defer body.Close()
 
-	return ctx.JSON(http.StatusOK, map[string]string{"phone": user.Phone, "name": user.Name})
+	return ctx.Stream(http.StatusOK, info.ContentType, body)
 }
 
-func (s *Server) PutProfile(ctx echo.Context) error {
-	// Todo : create middleware to check the token
+// PostProfileEmailVerification : this handler is for sending verification link to the email of user
+func (s *Server) PostProfileEmailVerification(ctx echo.Context) error {
 	// Validate token
-	ID, err := validateToken(ctx)
+	ID, err := s.authenticate(ctx, scopeProfileWrite)
 	if err != nil {
 		log.Error(err)
 		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
 	}
 
-	req := new(generated.PutProfileJSONRequestBody)
+	err = s.Users.SendEmailVerification(ctx.Request().Context(), ID)
+	if errors.Is(err, service.ErrNotificationFailed) {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Error when sending verification email"})
+	}
+	if err != nil {
+		return respondError(ctx, serviceError(err, "Internal Server Error"))
+	}
+
+	return ctx.JSON(http.StatusAccepted, map[string]string{"message": "Verification email sent"})
+}
+
+// GetEmailVerify : this handler is for verifying email from the link sent by PostProfileEmailVerification
+func (s *Server) GetEmailVerify(ctx echo.Context, params generated.GetEmailVerifyParams) error {
+	err := s.Users.VerifyEmail(ctx.Request().Context(), params.Token)
+	if err != nil {
+		return respondError(ctx, serviceError(err, "Internal Server Error"))
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]string{"message": "Email verified"})
+}
+
+// PostLoginOtpStart : this handler is for sending one time passcode by SMS to login without password
+func (s *Server) PostLoginOtpStart(ctx echo.Context) error {
+	req := new(generated.PostLoginOtpStartJSONRequestBody)
 
 	if err := ctx.Bind(req); err != nil {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request payload"})
 	}
 
-	// Find user by ID
-	user, err := s.Repository.FindUser(ctx.Request().Context(), repository.Param{
-		Logic:    "AND",
-		Field:    "id",
-		Operator: "=",
-		Value:    ID,
-	})
-	if err != nil {
+	err := s.Users.StartLoginOTP(ctx.Request().Context(), req.Phone)
+	if errors.Is(err, service.ErrTooManyOTPRequests) {
+		ctx.Response().Header().Set("Retry-After", strconv.Itoa(int(service.OTPRateWindow.Seconds())))
+	}
+	if errors.Is(err, service.ErrNotificationFailed) {
 		log.Error(err)
-		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "User not found"})
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Error when sending OTP"})
+	}
+	if err != nil {
+		return respondError(ctx, serviceError(err, "Internal Server Error"))
 	}
 
-	userUpdate := repository.UpdateUser{}
-	userUpdate.ID = user.ID
-	if req.Phone != nil {
-		// Perform validation
-		if !isValidPhoneNumber(*req.Phone) { // Todo : create function for standard response, because some response are similar
-			return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid phone number. Phone numbers must start with +62 and be 10 to 13 characters in total"})
-		}
+	return ctx.JSON(http.StatusAccepted, map[string]string{"message": "OTP sent"})
+}
+
+// PostLoginOtpVerify : this handler is for login with one time passcode sent by PostLoginOtpStart, returning jwt token
+func (s *Server) PostLoginOtpVerify(ctx echo.Context) error {
+	req := new(generated.PostLoginOtpVerifyJSONRequestBody)
+
+	if err := ctx.Bind(req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request payload"})
+	}
 
-		// set to new value
-		userUpdate.Phone = *req.Phone
-	} else {
-		// set to old value
-		userUpdate.Phone = user.Phone
+	result, err := s.Users.VerifyLoginOTP(ctx.Request().Context(), req.Phone, req.Code)
+	if err != nil {
+		return respondError(ctx, serviceError(err, "Internal Server Error"))
 	}
 
-	if req.Name != nil {
-		// Perform validation
-		if len(*req.Name) < 3 || len(*req.Name) > 60 {
-			return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid full name. Full names must be 3 to 60 characters"})
-		}
+	return ctx.JSON(http.StatusOK, map[string]string{"message": "Login successful", "token": result.Token, "phone": result.User.Phone})
+}
 
-		// set to new value
-		userUpdate.Name = *req.Name
-	} else {
-		// set to old value
-		userUpdate.Name = user.Name
+// PutProfileOtpLogin : this handler is for allowing or disallowing login with SMS one time passcode
+func (s *Server) PutProfileOtpLogin(ctx echo.Context) error {
+	// Validate token
+	ID, err := s.authenticate(ctx, "")
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
 	}
 
-	// Update user
-	err = s.Repository.UpdateUser(ctx.Request().Context(), userUpdate)
+	req := new(generated.PutProfileOtpLoginJSONRequestBody)
+	if err := ctx.Bind(req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request payload"})
+	}
+
+	err = s.Repository.UpdateOTPLogin(ctx.Request().Context(), ID, req.Enabled)
 	if err != nil {
-		var pqErr *pq.Error
-		if errors.As(err, &pqErr) {
-			// Check if the error code is 23505 (unique violation)
-			if pqErr.Code == "23505" {
-				return ctx.JSON(http.StatusConflict, map[string]string{"message": "Phone number already exist"})
-			}
-		}
 		log.Error(err)
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Error when registering user"})
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
 	}
 
-	return ctx.JSON(http.StatusOK, map[string]string{"message": "User updated"})
+	if req.Enabled {
+		return ctx.JSON(http.StatusOK, map[string]string{"message": "OTP login enabled"})
+	}
+	return ctx.JSON(http.StatusOK, map[string]string{"message": "OTP login disabled"})
 }
@@ -1,12 +1,15 @@
 package handler
 
 import (
-	"encoding/base64"
+	"bytes"
+	"context"
 	"fmt"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/golang/mock/gomock"
-	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
+	"mime/multipart"
+	"net/url"
+	"regexp"
 	"strings"
 	"time"
 
@@ -15,7 +18,10 @@ import (
 	"testing"
 
 	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/notification"
 	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/service"
+	"github.com/SawitProRecruitment/UserService/storage"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 )
@@ -82,6 +88,20 @@ func TestPostRegistration(t *testing.T) {
 				content:    "{\"id\":\"123\",\"message\":\"Registration successful\"}\n",
 			},
 			wantErr: false,
+		}, {
+			name: "Success with local phone format",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().Registration(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, input repository.RegistrationInput) (repository.RegistrationOutput, error) {
+					assert.Equal(t, "+62856712332", input.Phone)
+					return repository.RegistrationOutput{ID: "123"}, nil
+				})
+			},
+			args: fmt.Sprintf(`{"phone": "%s", "name": "%s", "password": "%s"}`, "0856 712 332", "Success User", "Password1!"),
+			want: want{
+				httpStatus: http.StatusOK,
+				content:    "{\"id\":\"123\",\"message\":\"Registration successful\"}\n",
+			},
+			wantErr: false,
 		}, {
 			name: "Invalid request payload",
 			prepare: func(f *fields) {
@@ -101,7 +121,7 @@ func TestPostRegistration(t *testing.T) {
 			args: fmt.Sprintf(`{"phone": "%s", "name": "%s", "password": "%s"}`, "123", "User", "Password1!"),
 			want: want{
 				httpStatus: http.StatusBadRequest,
-				content:    "{\"error\":\"Invalid phone number. Phone numbers must start with +62 and be 10 to 13 characters in total\"}\n",
+				content:    "{\"message\":\"Invalid phone number. Phone numbers must be a valid number of a supported country, e.g. +62812345678 or 0812345678\"}\n",
 			},
 			wantErr: false,
 		}, {
@@ -129,7 +149,7 @@ func TestPostRegistration(t *testing.T) {
 		}, {
 			name: "Phone number already exist",
 			prepare: func(f *fields) {
-				f.repo.EXPECT().Registration(gomock.Any(), gomock.Any()).Return(repository.RegistrationOutput{}, &pq.Error{Code: "23505"})
+				f.repo.EXPECT().Registration(gomock.Any(), gomock.Any()).Return(repository.RegistrationOutput{}, repository.ErrDuplicatePhone)
 			},
 			args: fmt.Sprintf(`{"phone": "%s", "name": "%s", "password": "%s"}`, "+62856712332", "User", "Password1!"),
 			want: want{
@@ -193,6 +213,39 @@ func TestPostRegistration(t *testing.T) {
 	}
 }
 
+func TestPostRegistrationMemoryRepository(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	s := NewServer(NewServerOptions{Repository: repo})
+	e := echo.New()
+
+	post := func(handler echo.HandlerFunc, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/registration", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		assert.NoError(t, handler(e.NewContext(req, rec)))
+		return rec
+	}
+
+	rec := post(s.PostRegistration, `{"phone": "+62856712332", "name": "First User", "password": "Password1!"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// Same number in local format is the same phone once normalized, the repository refuses it like Postgres does
+	rec = post(s.PostRegistration, `{"phone": "0856 712 332", "name": "Second User", "password": "Password2!"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "{\"message\":\"Phone number already exist\"}\n", rec.Body.String())
+
+	rec = post(s.PostLogin, `{"phone": "+62856712332", "password": "Password1!"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	s.Users.Wait()
+
+	rec = post(s.PostLogin, `{"phone": "+62856712332", "password": "Password2!"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	user, err := repo.FindUser(context.Background(), repository.Param{Field: "phone", Operator: "=", Value: "+62856712332"})
+	assert.NoError(t, err)
+	assert.Equal(t, "First User", user.Name)
+}
+
 func TestPostLogin(t *testing.T) {
 	// Mock
 	type fields struct {
@@ -205,6 +258,9 @@ func TestPostLogin(t *testing.T) {
 		content    string
 	}
 
+	verifiedEmail := "user@example.com"
+	verifiedAt := time.Now()
+
 	// Test Case
 	tests := []struct {
 		prepare    func(f *fields)
@@ -224,6 +280,7 @@ func TestPostLogin(t *testing.T) {
 					Password: "$2a$10$Ke5Sl0ra2VeYSmmqjnlE9OLl.I1Bmc8Ou5ix7M2lrPhB6FzV8raJC",
 					Salt:     "63RDLuJv8Kmeehqgeg35FA==",
 				}, nil)
+				f.repo.EXPECT().ListUserMemberships(gomock.Any(), "123").Return(nil, nil)
 				f.repo.EXPECT().IncreaseLoginAttempt(gomock.Any(), gomock.Any()).Return(nil)
 			},
 			args: fmt.Sprintf(`{"phone": "%s", "password": "%s"}`, "+62856712332", "QWErty123!@#"),
@@ -232,6 +289,25 @@ func TestPostLogin(t *testing.T) {
 			},
 			wantErr:    false,
 			assertBody: false,
+		}, {
+			name: "Deactivated user",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{
+					ID:            "123",
+					Phone:         "+62856712332",
+					Name:          "User",
+					Password:      "$2a$10$Ke5Sl0ra2VeYSmmqjnlE9OLl.I1Bmc8Ou5ix7M2lrPhB6FzV8raJC",
+					Salt:          "63RDLuJv8Kmeehqgeg35FA==",
+					DeactivatedAt: &verifiedAt,
+				}, nil)
+			},
+			args: fmt.Sprintf(`{"phone": "%s", "password": "%s"}`, "+62856712332", "QWErty123!@#"),
+			want: want{
+				httpStatus: http.StatusForbidden,
+				content:    "{\"message\":\"Account is deactivated\"}\n",
+			},
+			wantErr:    false,
+			assertBody: true,
 		}, {
 			name: "Invalid request payload",
 			prepare: func(f *fields) {
@@ -252,7 +328,7 @@ func TestPostLogin(t *testing.T) {
 			args: fmt.Sprintf(`{"phone": "%s", "name": "%s", "password": "%s"}`, "123", "User", "Password1!"),
 			want: want{
 				httpStatus: http.StatusBadRequest,
-				content:    "{\"error\":\"Invalid phone number. Phone numbers must start with +62 and be 10 to 13 characters in total\"}\n",
+				content:    "{\"message\":\"Invalid phone number. Phone numbers must be a valid number of a supported country, e.g. +62812345678 or 0812345678\"}\n",
 			},
 			wantErr:    false,
 			assertBody: true,
@@ -304,6 +380,95 @@ func TestPostLogin(t *testing.T) {
 			},
 			wantErr:    false,
 			assertBody: true,
+		}, {
+			name: "Success with local phone format",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), repository.Param{
+					Logic:    "AND",
+					Field:    "phone",
+					Operator: "=",
+					Value:    "+62856712332",
+				}).Return(repository.User{
+					ID:       "123",
+					Phone:    "+62856712332",
+					Name:     "User",
+					Password: "$2a$10$Ke5Sl0ra2VeYSmmqjnlE9OLl.I1Bmc8Ou5ix7M2lrPhB6FzV8raJC",
+					Salt:     "63RDLuJv8Kmeehqgeg35FA==",
+				}, nil)
+				f.repo.EXPECT().ListUserMemberships(gomock.Any(), "123").Return(nil, nil)
+				f.repo.EXPECT().IncreaseLoginAttempt(gomock.Any(), "+62856712332").Return(nil)
+			},
+			args: fmt.Sprintf(`{"phone": "%s", "password": "%s"}`, "0856712332", "QWErty123!@#"),
+			want: want{
+				httpStatus: http.StatusOK,
+			},
+			wantErr:    false,
+			assertBody: false,
+		}, {
+			name: "Success with email",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindVerifiedEmailUser(gomock.Any(), "user@example.com").Return(repository.User{
+					ID:              "123",
+					Phone:           "+62856712332",
+					Name:            "User",
+					Password:        "$2a$10$Ke5Sl0ra2VeYSmmqjnlE9OLl.I1Bmc8Ou5ix7M2lrPhB6FzV8raJC",
+					Salt:            "63RDLuJv8Kmeehqgeg35FA==",
+					Email:           &verifiedEmail,
+					EmailVerifiedAt: &verifiedAt,
+				}, nil)
+				f.repo.EXPECT().ListUserMemberships(gomock.Any(), "123").Return(nil, nil)
+				f.repo.EXPECT().IncreaseLoginAttempt(gomock.Any(), "+62856712332").Return(nil)
+			},
+			args: fmt.Sprintf(`{"email": "%s", "password": "%s"}`, "User@Example.com", "QWErty123!@#"),
+			want: want{
+				httpStatus: http.StatusOK,
+			},
+			wantErr:    false,
+			assertBody: false,
+		}, {
+			name: "Email not verified",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindVerifiedEmailUser(gomock.Any(), "user@example.com").Return(repository.User{}, repository.ErrNotFound)
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{
+					ID:       "123",
+					Phone:    "+62856712332",
+					Name:     "User",
+					Password: "$2a$10$Ke5Sl0ra2VeYSmmqjnlE9OLl.I1Bmc8Ou5ix7M2lrPhB6FzV8raJC",
+					Salt:     "63RDLuJv8Kmeehqgeg35FA==",
+					Email:    &verifiedEmail,
+				}, nil)
+			},
+			args: fmt.Sprintf(`{"email": "%s", "password": "%s"}`, "user@example.com", "QWErty123!@#"),
+			want: want{
+				httpStatus: http.StatusBadRequest,
+				content:    "{\"message\":\"Email is not verified\"}\n",
+			},
+			wantErr:    false,
+			assertBody: true,
+		}, {
+			name: "Invalid email",
+			prepare: func(f *fields) {
+
+			},
+			args: fmt.Sprintf(`{"email": "%s", "password": "%s"}`, "not-an-email", "QWErty123!@#"),
+			want: want{
+				httpStatus: http.StatusBadRequest,
+				content:    "{\"message\":\"Invalid email. Email must be a valid address of at most 254 characters\"}\n",
+			},
+			wantErr:    false,
+			assertBody: true,
+		}, {
+			name: "Both phone and email",
+			prepare: func(f *fields) {
+
+			},
+			args: fmt.Sprintf(`{"phone": "%s", "email": "%s", "password": "%s"}`, "+62856712332", "user@example.com", "QWErty123!@#"),
+			want: want{
+				httpStatus: http.StatusBadRequest,
+				content:    "{\"message\":\"Either phone number or email is required\"}\n",
+			},
+			wantErr:    false,
+			assertBody: true,
 		}, {
 			name: "Failed increase login attempt",
 			prepare: func(f *fields) {
@@ -314,6 +479,7 @@ func TestPostLogin(t *testing.T) {
 					Password: "$2a$10$Ke5Sl0ra2VeYSmmqjnlE9OLl.I1Bmc8Ou5ix7M2lrPhB6FzV8raJC",
 					Salt:     "63RDLuJv8Kmeehqgeg35FA==",
 				}, nil)
+				f.repo.EXPECT().ListUserMemberships(gomock.Any(), "123").Return(nil, nil)
 				f.repo.EXPECT().IncreaseLoginAttempt(gomock.Any(), gomock.Any()).Return(fmt.Errorf("error"))
 			},
 			args: fmt.Sprintf(`{"phone": "%s", "password": "%s"}`, "+62856712332", "QWErty123!@#"),
@@ -370,10 +536,14 @@ func TestPostLogin(t *testing.T) {
 	}
 }
 
-func TestGetProfile(t *testing.T) {
+// otpCodeInMessage : passcode inside the SMS body
+var otpCodeInMessage = regexp.MustCompile(`\d{6}`)
+
+func TestPostLoginOtpStart(t *testing.T) {
 	// Mock
 	type fields struct {
-		repo *repository.MockRepositoryInterface
+		repo     *repository.MockRepositoryInterface
+		notifier *notification.MockNotifier
 	}
 
 	// Output parameters
@@ -382,79 +552,93 @@ func TestGetProfile(t *testing.T) {
 		content    string
 	}
 
-	exp := time.Now().Add(time.Hour * 1)
-	token, _ := createToken("123", exp)
-	token = "Bearer " + token
+	enabledUser := repository.User{ID: "123", Phone: "+62856712332", Name: "User", OTPLoginEnabled: true}
 
 	// Test Case
 	tests := []struct {
-		prepare    func(f *fields)
-		name       string
-		args       string
-		want       want
-		wantErr    bool
-		assertBody bool
+		prepare func(f *fields)
+		name    string
+		args    string
+		want    want
 	}{
 		{
 			name: "Success",
 			prepare: func(f *fields) {
-				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{
-					ID:       "123",
-					Phone:    "+62856712332",
-					Name:     "User",
-					Password: "$2a$10$Ke5Sl0ra2VeYSmmqjnlE9OLl.I1Bmc8Ou5ix7M2lrPhB6FzV8raJC",
-					Salt:     "63RDLuJv8Kmeehqgeg35FA==",
-				}, nil)
+				f.repo.EXPECT().CountLoginOTP(gomock.Any(), "+62856712332", gomock.Any()).Return(0, nil)
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(enabledUser, nil)
+				var stored repository.LoginOTP
+				f.repo.EXPECT().CreateLoginOTP(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, otp repository.LoginOTP) error {
+					stored = otp
+					return nil
+				})
+				f.notifier.EXPECT().Notify(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, message notification.Message) error {
+					assert.Equal(t, "+62856712332", message.To)
+
+					// Sent code match the stored hash, the code itself is not stored
+					code := otpCodeInMessage.FindString(message.Body)
+					assert.NotEqual(t, code, stored.CodeHash)
+					assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(stored.CodeHash), []byte(code+stored.Salt)))
+					assert.WithinDuration(t, time.Now().Add(service.OTPTTL), stored.ExpiresAt, time.Minute)
+					return nil
+				})
+			},
+			args: `{"phone": "+62856712332"}`,
+			want: want{
+				httpStatus: http.StatusAccepted,
+				content:    "{\"message\":\"OTP sent\"}\n",
 			},
-			args: token,
+		}, {
+			name: "Invalid phone number",
+			args: `{"phone": "123"}`,
 			want: want{
-				httpStatus: http.StatusOK,
-				content:    "{\"name\":\"User\",\"phone\":\"+62856712332\"}\n",
+				httpStatus: http.StatusBadRequest,
+				content:    "{\"message\":\"Invalid phone number. Phone numbers must be a valid number of a supported country, e.g. +62812345678 or 0812345678\"}\n",
 			},
-			wantErr:    false,
-			assertBody: true,
 		}, {
-			name: "Forbidden code",
+			name: "Too many requests",
 			prepare: func(f *fields) {
-
+				f.repo.EXPECT().CountLoginOTP(gomock.Any(), "+62856712332", gomock.Any()).Return(service.OTPRateLimit, nil)
 			},
-			args: "asd",
+			args: `{"phone": "+62856712332"}`,
 			want: want{
-				httpStatus: http.StatusForbidden,
-				content:    "{\"error\":\"Forbidden code\"}\n",
+				httpStatus: http.StatusTooManyRequests,
+				content:    "{\"message\":\"Too many OTP requests, please try again later\"}\n",
+			},
+		}, {
+			name: "OTP login not enabled",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().CountLoginOTP(gomock.Any(), gomock.Any(), gomock.Any()).Return(0, nil)
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{ID: "123", Phone: "+62856712332"}, nil)
+			},
+			args: `{"phone": "+62856712332"}`,
+			want: want{
+				httpStatus: http.StatusBadRequest,
+				content:    "{\"message\":\"OTP login is not enabled for this account\"}\n",
 			},
-			wantErr:    false,
-			assertBody: true,
 		}, {
 			name: "User not found",
 			prepare: func(f *fields) {
-				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{
-					ID:       "123",
-					Phone:    "+62856712332",
-					Name:     "User",
-					Password: "$2a$10$Ke5Sl0ra2VeYSmmqjnlE9OLl.I1Bmc8Ou5ix7M2lrPhB6FzV8raJC",
-					Salt:     "63RDLuJv8Kmeehqgeg35FA==",
-				}, fmt.Errorf("error"))
+				f.repo.EXPECT().CountLoginOTP(gomock.Any(), gomock.Any(), gomock.Any()).Return(0, nil)
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{}, repository.ErrNotFound)
 			},
-			args: token,
+			args: `{"phone": "+62856712332"}`,
 			want: want{
 				httpStatus: http.StatusBadRequest,
-				content:    "{\"error\":\"User not found\"}\n",
+				content:    "{\"message\":\"User not found\"}\n",
 			},
-			wantErr:    false,
-			assertBody: true,
 		}, {
-			name: "Authorization token empty",
+			name: "Failed send SMS",
 			prepare: func(f *fields) {
-
+				f.repo.EXPECT().CountLoginOTP(gomock.Any(), gomock.Any(), gomock.Any()).Return(0, nil)
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(enabledUser, nil)
+				f.repo.EXPECT().CreateLoginOTP(gomock.Any(), gomock.Any()).Return(nil)
+				f.notifier.EXPECT().Notify(gomock.Any(), gomock.Any()).Return(fmt.Errorf("error"))
 			},
-			args: "",
+			args: `{"phone": "+62856712332"}`,
 			want: want{
-				httpStatus: http.StatusForbidden,
-				content:    "{\"error\":\"Forbidden code\"}\n",
+				httpStatus: http.StatusInternalServerError,
+				content:    "{\"message\":\"Error when sending OTP\"}\n",
 			},
-			wantErr:    false,
-			assertBody: true,
 		},
 	}
 
@@ -463,7 +647,8 @@ func TestGetProfile(t *testing.T) {
 			// prepare mock
 			ctrl := gomock.NewController(t)
 			f := &fields{
-				repo: repository.NewMockRepositoryInterface(ctrl),
+				repo:     repository.NewMockRepositoryInterface(ctrl),
+				notifier: notification.NewMockNotifier(ctrl),
 			}
 			if tt.prepare != nil {
 				tt.prepare(f)
@@ -473,183 +658,269 @@ func TestGetProfile(t *testing.T) {
 			e := echo.New()
 
 			// Create a new instance of your server
-			s := NewServer(NewServerOptions{Repository: f.repo})
+			s := NewServer(NewServerOptions{Repository: f.repo, SMSNotifier: f.notifier})
 
 			// Create a request
-			req := httptest.NewRequest(http.MethodGet, "/profile", strings.NewReader(tt.args))
+			req := httptest.NewRequest(http.MethodPost, "/login/otp/start", strings.NewReader(tt.args))
 			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("Authorization", tt.args)
 			rec := httptest.NewRecorder()
 			c := e.NewContext(req, rec)
 
 			// Call the handler
-			err := s.GetProfile(c)
-
-			if tt.wantErr {
-				assert.Error(t, err)
-			}
-
-			// Assert that there is no error
+			err := s.PostLoginOtpStart(c)
 			assert.NoError(t, err)
 
-			// Assert the HTTP status code
+			// Assert the HTTP status code and response body
 			assert.Equal(t, tt.want.httpStatus, rec.Code)
-
-			if tt.assertBody {
-				// Assert the response body
-				assert.Equal(t, tt.want.content, rec.Body.String())
-			}
+			assert.Equal(t, tt.want.content, rec.Body.String())
 		})
 	}
 }
 
-func TestPutProfile(t *testing.T) {
+func TestPostLoginOtpVerify(t *testing.T) {
 	// Mock
 	type fields struct {
 		repo *repository.MockRepositoryInterface
 	}
 
-	// Input parameters
-	type args struct {
-		jwt     string
-		content string
-	}
-
 	// Output parameters
 	type want struct {
 		httpStatus int
 		content    string
 	}
 
-	exp := time.Now().Add(time.Hour * 1)
-	token, _ := createToken("123", exp)
+	enabledUser := repository.User{ID: "123", Phone: "+62856712332", Name: "User", OTPLoginEnabled: true}
+	codeHash, _ := service.BcryptHasher{}.Hash("123456", "otp-salt")
+	otp := repository.LoginOTP{ID: 7, Phone: "+62856712332", CodeHash: codeHash, Salt: "otp-salt", ExpiresAt: time.Now().Add(service.OTPTTL)}
 
 	// Test Case
 	tests := []struct {
 		prepare    func(f *fields)
 		name       string
-		args       args
+		args       string
 		want       want
-		wantErr    bool
 		assertBody bool
 	}{
 		{
 			name: "Success",
 			prepare: func(f *fields) {
-				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{
-					ID:       "123",
-					Phone:    "+62856712332",
-					Name:     "User",
-					Password: "$2a$10$Ke5Sl0ra2VeYSmmqjnlE9OLl.I1Bmc8Ou5ix7M2lrPhB6FzV8raJC",
-					Salt:     "63RDLuJv8Kmeehqgeg35FA==",
-				}, nil)
-				f.repo.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Return(nil)
-			},
-			args: args{
-				jwt:     token,
-				content: "{\"name\":\"User\",\"phone\":\"+62856712332\"}",
-			},
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(enabledUser, nil)
+				f.repo.EXPECT().FindLoginOTP(gomock.Any(), "+62856712332").Return(otp, nil)
+				f.repo.EXPECT().IncreaseLoginOTPAttempt(gomock.Any(), int64(7), service.OTPMaxAttempts).Return(nil)
+				f.repo.EXPECT().UseLoginOTP(gomock.Any(), int64(7)).Return(nil)
+				f.repo.EXPECT().ListUserMemberships(gomock.Any(), "123").Return(nil, nil)
+				f.repo.EXPECT().IncreaseLoginAttempt(gomock.Any(), "+62856712332").Return(nil)
+			},
+			args: `{"phone": "+62856712332", "code": "123456"}`,
 			want: want{
 				httpStatus: http.StatusOK,
-				content:    "{\"message\":\"User updated\"}\n",
 			},
-			wantErr:    false,
-			assertBody: true,
 		}, {
-			name: "Success",
+			name: "Wrong code",
 			prepare: func(f *fields) {
-
-			},
-			args: args{
-				jwt:     "asd",
-				content: "{\"name\":\"User\",\"phone\":\"+62856712332\"}",
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(enabledUser, nil)
+				f.repo.EXPECT().FindLoginOTP(gomock.Any(), gomock.Any()).Return(otp, nil)
+				f.repo.EXPECT().IncreaseLoginOTPAttempt(gomock.Any(), int64(7), service.OTPMaxAttempts).Return(nil)
 			},
+			args: `{"phone": "+62856712332", "code": "654321"}`,
 			want: want{
-				httpStatus: http.StatusForbidden,
-				content:    "{\"error\":\"Forbidden code\"}\n",
+				httpStatus: http.StatusBadRequest,
+				content:    "{\"message\":\"Invalid or expired OTP\"}\n",
 			},
-			wantErr:    false,
 			assertBody: true,
 		}, {
-			name: "Success",
+			name: "Too many attempts",
 			prepare: func(f *fields) {
-
-			},
-			args: args{
-				jwt:     token,
-				content: "asd",
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(enabledUser, nil)
+				f.repo.EXPECT().FindLoginOTP(gomock.Any(), gomock.Any()).Return(otp, nil)
+				f.repo.EXPECT().IncreaseLoginOTPAttempt(gomock.Any(), int64(7), service.OTPMaxAttempts).Return(repository.ErrNotFound)
 			},
+			args: `{"phone": "+62856712332", "code": "123456"}`,
 			want: want{
 				httpStatus: http.StatusBadRequest,
-				content:    "{\"error\":\"Invalid request payload\"}\n",
+				content:    "{\"message\":\"Invalid or expired OTP\"}\n",
 			},
-			wantErr:    false,
 			assertBody: true,
 		}, {
-			name: "User not found",
+			name: "Expired or not sent",
 			prepare: func(f *fields) {
-				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{
-					ID:       "123",
-					Phone:    "+62856712332",
-					Name:     "User",
-					Password: "$2a$10$Ke5Sl0ra2VeYSmmqjnlE9OLl.I1Bmc8Ou5ix7M2lrPhB6FzV8raJC",
-					Salt:     "63RDLuJv8Kmeehqgeg35FA==",
-				}, fmt.Errorf("User not found"))
-			},
-			args: args{
-				jwt:     token,
-				content: "{\"name\":\"User\",\"phone\":\"+62856712332\"}",
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(enabledUser, nil)
+				f.repo.EXPECT().FindLoginOTP(gomock.Any(), gomock.Any()).Return(repository.LoginOTP{}, repository.ErrNotFound)
 			},
+			args: `{"phone": "+62856712332", "code": "123456"}`,
 			want: want{
 				httpStatus: http.StatusBadRequest,
-				content:    "{\"error\":\"User not found\"}\n",
+				content:    "{\"message\":\"Invalid or expired OTP\"}\n",
 			},
-			wantErr:    false,
 			assertBody: true,
 		}, {
-			name: "Invalid phone number",
+			name: "Already used",
 			prepare: func(f *fields) {
-				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{
-					ID:       "123",
-					Phone:    "+62856712332",
-					Name:     "User",
-					Password: "$2a$10$Ke5Sl0ra2VeYSmmqjnlE9OLl.I1Bmc8Ou5ix7M2lrPhB6FzV8raJC",
-					Salt:     "63RDLuJv8Kmeehqgeg35FA==",
-				}, nil)
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(enabledUser, nil)
+				f.repo.EXPECT().FindLoginOTP(gomock.Any(), gomock.Any()).Return(otp, nil)
+				f.repo.EXPECT().IncreaseLoginOTPAttempt(gomock.Any(), int64(7), service.OTPMaxAttempts).Return(nil)
+				f.repo.EXPECT().UseLoginOTP(gomock.Any(), int64(7)).Return(repository.ErrNotFound)
 			},
-			args: args{
-				jwt:     token,
-				content: "{\"name\":\"User\",\"phone\":\"+122\"}",
+			args: `{"phone": "+62856712332", "code": "123456"}`,
+			want: want{
+				httpStatus: http.StatusBadRequest,
+				content:    "{\"message\":\"Invalid or expired OTP\"}\n",
 			},
+			assertBody: true,
+		}, {
+			name: "Malformed code",
+			args: `{"phone": "+62856712332", "code": "12ab"}`,
 			want: want{
 				httpStatus: http.StatusBadRequest,
-				content:    "{\"error\":\"Invalid phone number. Phone numbers must start with +62 and be 10 to 13 characters in total\"}\n",
+				content:    "{\"message\":\"Invalid or expired OTP\"}\n",
 			},
-			wantErr:    false,
 			assertBody: true,
 		}, {
-			name: "Invalid full name",
+			name: "OTP login disabled after code was sent",
 			prepare: func(f *fields) {
-				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{
-					ID:       "123",
-					Phone:    "+62856712332",
-					Name:     "User",
-					Password: "$2a$10$Ke5Sl0ra2VeYSmmqjnlE9OLl.I1Bmc8Ou5ix7M2lrPhB6FzV8raJC",
-					Salt:     "63RDLuJv8Kmeehqgeg35FA==",
-				}, nil)
-			},
-			args: args{
-				jwt:     token,
-				content: "{\"name\":\"\",\"phone\":\"+62212412422\"}",
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{ID: "123", Phone: "+62856712332"}, nil)
 			},
+			args: `{"phone": "+62856712332", "code": "123456"}`,
 			want: want{
 				httpStatus: http.StatusBadRequest,
-				content:    "{\"error\":\"Invalid full name. Full names must be 3 to 60 characters\"}\n",
+				content:    "{\"message\":\"OTP login is not enabled for this account\"}\n",
 			},
-			wantErr:    false,
 			assertBody: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// prepare mock
+			ctrl := gomock.NewController(t)
+			f := &fields{
+				repo: repository.NewMockRepositoryInterface(ctrl),
+			}
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			// Create a new Echo instance
+			e := echo.New()
+
+			// Create a new instance of your server
+			s := NewServer(NewServerOptions{Repository: f.repo})
+
+			// Create a request
+			req := httptest.NewRequest(http.MethodPost, "/login/otp/verify", strings.NewReader(tt.args))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			// Call the handler
+			err := s.PostLoginOtpVerify(c)
+			assert.NoError(t, err)
+
+			// Assert the HTTP status code
+			assert.Equal(t, tt.want.httpStatus, rec.Code)
+
+			if tt.assertBody {
+				// Assert the response body
+				assert.Equal(t, tt.want.content, rec.Body.String())
+			} else {
+				assert.Contains(t, rec.Body.String(), "\"token\":")
+			}
+		})
+	}
+}
+
+func TestPutProfileOtpLogin(t *testing.T) {
+	exp := time.Now().Add(time.Hour * 1)
+	token, _ := createToken("123", exp)
+
+	tests := []struct {
+		name    string
+		prepare func(repo *repository.MockRepositoryInterface)
+		token   string
+		args    string
+		status  int
+		content string
+	}{
+		{
+			name: "Enable",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().UpdateOTPLogin(gomock.Any(), "123", true).Return(nil)
+			},
+			token:   "Bearer " + token,
+			args:    `{"enabled": true}`,
+			status:  http.StatusOK,
+			content: "{\"message\":\"OTP login enabled\"}\n",
 		}, {
-			name: "Phone number already exist",
+			name: "Disable",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().UpdateOTPLogin(gomock.Any(), "123", false).Return(nil)
+			},
+			token:   "Bearer " + token,
+			args:    `{"enabled": false}`,
+			status:  http.StatusOK,
+			content: "{\"message\":\"OTP login disabled\"}\n",
+		}, {
+			name:    "Forbidden code",
+			token:   "asd",
+			args:    `{"enabled": true}`,
+			status:  http.StatusForbidden,
+			content: "{\"message\":\"Forbidden code\"}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := repository.NewMockRepositoryInterface(ctrl)
+			expectActiveUser(repo, "123")
+			if tt.prepare != nil {
+				tt.prepare(repo)
+			}
+
+			e := echo.New()
+			s := NewServer(NewServerOptions{Repository: repo})
+
+			req := httptest.NewRequest(http.MethodPut, "/profile/otp-login", strings.NewReader(tt.args))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", tt.token)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := s.PutProfileOtpLogin(c)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Equal(t, tt.content, rec.Body.String())
+		})
+	}
+}
+
+func TestGetProfile(t *testing.T) {
+	// Mock
+	type fields struct {
+		repo *repository.MockRepositoryInterface
+	}
+
+	// Output parameters
+	type want struct {
+		httpStatus int
+		content    string
+	}
+
+	exp := time.Now().Add(time.Hour * 1)
+	token, _ := createToken("123", exp)
+	token = "Bearer " + token
+
+	// Test Case
+	tests := []struct {
+		prepare    func(f *fields)
+		name       string
+		args       string
+		want       want
+		wantErr    bool
+		assertBody bool
+	}{
+		{
+			name: "Success",
 			prepare: func(f *fields) {
 				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{
 					ID:       "123",
@@ -658,42 +929,28 @@ func TestPutProfile(t *testing.T) {
 					Password: "$2a$10$Ke5Sl0ra2VeYSmmqjnlE9OLl.I1Bmc8Ou5ix7M2lrPhB6FzV8raJC",
 					Salt:     "63RDLuJv8Kmeehqgeg35FA==",
 				}, nil)
-				f.repo.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Return(&pq.Error{Code: "23505"})
-			},
-			args: args{
-				jwt:     token,
-				content: "{\"name\":\"User\",\"phone\":\"+62856712332\"}",
 			},
+			args: token,
 			want: want{
-				httpStatus: http.StatusConflict,
-				content:    "{\"error\":\"Phone number already exist\"}\n",
+				httpStatus: http.StatusOK,
+				content:    "{\"name\":\"User\",\"phone\":\"+62856712332\"}\n",
 			},
 			wantErr:    false,
 			assertBody: true,
 		}, {
-			name: "Error registering user",
+			name: "Forbidden code",
 			prepare: func(f *fields) {
-				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{
-					ID:       "123",
-					Phone:    "+62856712332",
-					Name:     "User",
-					Password: "$2a$10$Ke5Sl0ra2VeYSmmqjnlE9OLl.I1Bmc8Ou5ix7M2lrPhB6FzV8raJC",
-					Salt:     "63RDLuJv8Kmeehqgeg35FA==",
-				}, nil)
-				f.repo.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Return(fmt.Errorf("Error when registering user"))
-			},
-			args: args{
-				jwt:     token,
-				content: "{\"name\":\"User\",\"phone\":\"+62856712332\"}",
+
 			},
+			args: "asd",
 			want: want{
-				httpStatus: http.StatusInternalServerError,
-				content:    "{\"error\":\"Error when registering user\"}\n",
+				httpStatus: http.StatusForbidden,
+				content:    "{\"error\":\"Forbidden code\"}\n",
 			},
 			wantErr:    false,
 			assertBody: true,
 		}, {
-			name: "Success without phone",
+			name: "User not found",
 			prepare: func(f *fields) {
 				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{
 					ID:       "123",
@@ -701,38 +958,24 @@ func TestPutProfile(t *testing.T) {
 					Name:     "User",
 					Password: "$2a$10$Ke5Sl0ra2VeYSmmqjnlE9OLl.I1Bmc8Ou5ix7M2lrPhB6FzV8raJC",
 					Salt:     "63RDLuJv8Kmeehqgeg35FA==",
-				}, nil)
-				f.repo.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Return(nil)
-			},
-			args: args{
-				jwt:     token,
-				content: "{\"name\":\"User\"}",
+				}, fmt.Errorf("error"))
 			},
+			args: token,
 			want: want{
-				httpStatus: http.StatusOK,
-				content:    "{\"message\":\"User updated\"}\n",
+				httpStatus: http.StatusBadRequest,
+				content:    "{\"error\":\"User not found\"}\n",
 			},
 			wantErr:    false,
 			assertBody: true,
 		}, {
-			name: "Success without name",
+			name: "Authorization token empty",
 			prepare: func(f *fields) {
-				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{
-					ID:       "123",
-					Phone:    "+62856712332",
-					Name:     "User",
-					Password: "$2a$10$Ke5Sl0ra2VeYSmmqjnlE9OLl.I1Bmc8Ou5ix7M2lrPhB6FzV8raJC",
-					Salt:     "63RDLuJv8Kmeehqgeg35FA==",
-				}, nil)
-				f.repo.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Return(nil)
-			},
-			args: args{
-				jwt:     token,
-				content: "{\"phone\":\"+621234567890\"}",
+
 			},
+			args: "",
 			want: want{
-				httpStatus: http.StatusOK,
-				content:    "{\"message\":\"User updated\"}\n",
+				httpStatus: http.StatusForbidden,
+				content:    "{\"error\":\"Forbidden code\"}\n",
 			},
 			wantErr:    false,
 			assertBody: true,
@@ -746,6 +989,7 @@ func TestPutProfile(t *testing.T) {
 			f := &fields{
 				repo: repository.NewMockRepositoryInterface(ctrl),
 			}
+			expectActiveUser(f.repo, "123")
 			if tt.prepare != nil {
 				tt.prepare(f)
 			}
@@ -757,14 +1001,14 @@ func TestPutProfile(t *testing.T) {
 			s := NewServer(NewServerOptions{Repository: f.repo})
 
 			// Create a request
-			req := httptest.NewRequest(http.MethodGet, "/profile", strings.NewReader(tt.args.content))
+			req := httptest.NewRequest(http.MethodGet, "/profile", strings.NewReader(tt.args))
 			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("Authorization", "Bearer "+tt.args.jwt)
+			req.Header.Set("Authorization", tt.args)
 			rec := httptest.NewRecorder()
 			c := e.NewContext(req, rec)
 
 			// Call the handler
-			err := s.PutProfile(c)
+			err := s.GetProfile(c)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -784,88 +1028,1258 @@ func TestPutProfile(t *testing.T) {
 	}
 }
 
-func TestIsValidPhoneNumber(t *testing.T) {
-	// Valid phone numbers
-	validNumbers := []string{"+62123456789", "+621234567890", "+6212345678901", "+629876543210"}
-
-	// Invalid phone numbers
-	invalidNumbers := []string{"123456789", "+6201239", "012345678", "+621234567890525412"}
-
-	for _, num := range validNumbers {
-		// Call the isValidPhoneNumber function for valid numbers
-		isValid := isValidPhoneNumber(num)
-
-		// Assert that the number is valid
-		assert.True(t, isValid, "Expected %s to be a valid phone number", num)
-	}
-
-	for _, num := range invalidNumbers {
-		// Call the isValidPhoneNumber function for invalid numbers
-		isValid := isValidPhoneNumber(num)
-
-		// Assert that the number is invalid
-		assert.False(t, isValid, "Expected %s to be an invalid phone number", num)
+func TestPutProfile(t *testing.T) {
+	// Mock
+	type fields struct {
+		repo *repository.MockRepositoryInterface
 	}
-}
-
-func TestIsValidPassword(t *testing.T) {
-	// Valid passwords
-	validPasswords := []string{"Abcd123!", "StrongP@ss123", "SecurePwd987!"}
-
-	// Invalid passwords
-	invalidPasswords := []string{"short", "weakpassword", "NoSpecialCharacter123", "NoNumber!@#$%^&*()"}
 
-	for _, password := range validPasswords {
-		// Call the isValidPassword function for valid passwords
-		isValid := isValidPassword(password)
-
-		// Assert that the password is valid
-		assert.True(t, isValid, "Expected %s to be a valid password", password)
+	// Input parameters
+	type args struct {
+		jwt     string
+		content string
+		ifMatch *string
 	}
 
-	for _, password := range invalidPasswords {
-		// Call the isValidPassword function for invalid passwords
-		isValid := isValidPassword(password)
-
-		// Assert that the password is invalid
-		assert.False(t, isValid, "Expected %s to be an invalid password", password)
+	// Output parameters
+	type want struct {
+		httpStatus int
+		content    string
 	}
-}
-
-func TestGenerateRandomSalt(t *testing.T) {
-	// Call the generateRandomSalt function
-	salt, err := generateRandomSalt()
-
-	// Assert that there is no error
-	assert.NoError(t, err)
-
-	// Assert that the length of the generated salt is 24 characters (encoded base64 representation of 16 random bytes)
-	assert.Equal(t, 24, len(salt))
 
-	// Decode the salt and assert that it is a valid base64 string
-	decodedSalt, decodeErr := base64.StdEncoding.DecodeString(salt)
-	assert.NoError(t, decodeErr)
-
-	// Assert that the length of the decoded salt is 16 bytes
-	assert.Equal(t, 16, len(decodedSalt))
-}
-
-func TestHashPassword(t *testing.T) {
-	// Set a known password and salt
-	password := "MySecurePassword"
-	salt := "RandomSalt123"
-
-	// Call the hashPassword function
-	hashedPassword, err := hashPassword(password, salt)
+	exp := time.Now().Add(time.Hour * 1)
+	token, _ := createToken("123", exp)
+	currentETag := formatETag(2)
 
-	// Assert that there is no error
-	assert.NoError(t, err)
+	// Test Case
+	tests := []struct {
+		prepare    func(f *fields)
+		name       string
+		args       args
+		want       want
+		wantErr    bool
+		assertBody bool
+	}{
+		{
+			name: "Success",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{
+					ID:       "123",
+					Phone:    "+62856712332",
+					Name:     "User",
+					Password: "$2a$10$Ke5Sl0ra2VeYSmmqjnlE9OLl.I1Bmc8Ou5ix7M2lrPhB6FzV8raJC",
+					Salt:     "63RDLuJv8Kmeehqgeg35FA==",
+				}, nil)
+				f.repo.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Return(nil)
+			},
+			args: args{
+				jwt:     token,
+				content: "{\"name\":\"User\",\"phone\":\"+62856712332\"}",
+			},
+			want: want{
+				httpStatus: http.StatusOK,
+				content:    "{\"message\":\"User updated\"}\n",
+			},
+			wantErr:    false,
+			assertBody: true,
+		}, {
+			name: "Success",
+			prepare: func(f *fields) {
 
-	// Compare the hashed password with the expected hash using bcrypt.CompareHashAndPassword
-	matchErr := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password+salt))
+			},
+			args: args{
+				jwt:     "asd",
+				content: "{\"name\":\"User\",\"phone\":\"+62856712332\"}",
+			},
+			want: want{
+				httpStatus: http.StatusForbidden,
+				content:    "{\"error\":\"Forbidden code\"}\n",
+			},
+			wantErr:    false,
+			assertBody: true,
+		}, {
+			name: "Success",
+			prepare: func(f *fields) {
 
-	// Assert that there is no error in comparing the hashed password
-	assert.NoError(t, matchErr, "Expected hashed password to match the original password and salt")
+			},
+			args: args{
+				jwt:     token,
+				content: "asd",
+			},
+			want: want{
+				httpStatus: http.StatusBadRequest,
+				content:    "{\"error\":\"Invalid request payload\"}\n",
+			},
+			wantErr:    false,
+			assertBody: true,
+		}, {
+			name: "User not found",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{
+					ID:       "123",
+					Phone:    "+62856712332",
+					Name:     "User",
+					Password: "$2a$10$Ke5Sl0ra2VeYSmmqjnlE9OLl.I1Bmc8Ou5ix7M2lrPhB6FzV8raJC",
+					Salt:     "63RDLuJv8Kmeehqgeg35FA==",
+				}, fmt.Errorf("User not found"))
+			},
+			args: args{
+				jwt:     token,
+				content: "{\"name\":\"User\",\"phone\":\"+62856712332\"}",
+			},
+			want: want{
+				httpStatus: http.StatusBadRequest,
+				content:    "{\"error\":\"User not found\"}\n",
+			},
+			wantErr:    false,
+			assertBody: true,
+		}, {
+			name: "Invalid phone number",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{
+					ID:       "123",
+					Phone:    "+62856712332",
+					Name:     "User",
+					Password: "$2a$10$Ke5Sl0ra2VeYSmmqjnlE9OLl.I1Bmc8Ou5ix7M2lrPhB6FzV8raJC",
+					Salt:     "63RDLuJv8Kmeehqgeg35FA==",
+				}, nil)
+			},
+			args: args{
+				jwt:     token,
+				content: "{\"name\":\"User\",\"phone\":\"+122\"}",
+			},
+			want: want{
+				httpStatus: http.StatusBadRequest,
+				content:    "{\"message\":\"Invalid phone number. Phone numbers must be a valid number of a supported country, e.g. +62812345678 or 0812345678\"}\n",
+			},
+			wantErr:    false,
+			assertBody: true,
+		}, {
+			name: "Invalid full name",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{
+					ID:       "123",
+					Phone:    "+62856712332",
+					Name:     "User",
+					Password: "$2a$10$Ke5Sl0ra2VeYSmmqjnlE9OLl.I1Bmc8Ou5ix7M2lrPhB6FzV8raJC",
+					Salt:     "63RDLuJv8Kmeehqgeg35FA==",
+				}, nil)
+			},
+			args: args{
+				jwt:     token,
+				content: "{\"name\":\"\",\"phone\":\"+62212412422\"}",
+			},
+			want: want{
+				httpStatus: http.StatusBadRequest,
+				content:    "{\"error\":\"Invalid full name. Full names must be 3 to 60 characters\"}\n",
+			},
+			wantErr:    false,
+			assertBody: true,
+		}, {
+			name: "Phone number already exist",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{
+					ID:       "123",
+					Phone:    "+62856712332",
+					Name:     "User",
+					Password: "$2a$10$Ke5Sl0ra2VeYSmmqjnlE9OLl.I1Bmc8Ou5ix7M2lrPhB6FzV8raJC",
+					Salt:     "63RDLuJv8Kmeehqgeg35FA==",
+				}, nil)
+				f.repo.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Return(repository.ErrDuplicatePhone)
+			},
+			args: args{
+				jwt:     token,
+				content: "{\"name\":\"User\",\"phone\":\"+62856712332\"}",
+			},
+			want: want{
+				httpStatus: http.StatusConflict,
+				content:    "{\"error\":\"Phone number already exist\"}\n",
+			},
+			wantErr:    false,
+			assertBody: true,
+		}, {
+			name: "Error registering user",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{
+					ID:       "123",
+					Phone:    "+62856712332",
+					Name:     "User",
+					Password: "$2a$10$Ke5Sl0ra2VeYSmmqjnlE9OLl.I1Bmc8Ou5ix7M2lrPhB6FzV8raJC",
+					Salt:     "63RDLuJv8Kmeehqgeg35FA==",
+				}, nil)
+				f.repo.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Return(fmt.Errorf("Error when registering user"))
+			},
+			args: args{
+				jwt:     token,
+				content: "{\"name\":\"User\",\"phone\":\"+62856712332\"}",
+			},
+			want: want{
+				httpStatus: http.StatusInternalServerError,
+				content:    "{\"error\":\"Error when registering user\"}\n",
+			},
+			wantErr:    false,
+			assertBody: true,
+		}, {
+			name: "Success without phone",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{
+					ID:       "123",
+					Phone:    "+62856712332",
+					Name:     "User",
+					Password: "$2a$10$Ke5Sl0ra2VeYSmmqjnlE9OLl.I1Bmc8Ou5ix7M2lrPhB6FzV8raJC",
+					Salt:     "63RDLuJv8Kmeehqgeg35FA==",
+				}, nil)
+				f.repo.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Return(nil)
+			},
+			args: args{
+				jwt:     token,
+				content: "{\"name\":\"User\"}",
+			},
+			want: want{
+				httpStatus: http.StatusOK,
+				content:    "{\"message\":\"User updated\"}\n",
+			},
+			wantErr:    false,
+			assertBody: true,
+		}, {
+			name: "Success without name",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{
+					ID:       "123",
+					Phone:    "+62856712332",
+					Name:     "User",
+					Password: "$2a$10$Ke5Sl0ra2VeYSmmqjnlE9OLl.I1Bmc8Ou5ix7M2lrPhB6FzV8raJC",
+					Salt:     "63RDLuJv8Kmeehqgeg35FA==",
+				}, nil)
+				f.repo.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Return(nil)
+			},
+			args: args{
+				jwt:     token,
+				content: "{\"phone\":\"+621234567890\"}",
+			},
+			want: want{
+				httpStatus: http.StatusOK,
+				content:    "{\"message\":\"User updated\"}\n",
+			},
+			wantErr:    false,
+			assertBody: true,
+		}, {
+			name: "Success with matching If-Match",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{
+					ID:      "123",
+					Phone:   "+62856712332",
+					Name:    "User",
+					Version: 2,
+				}, nil)
+				f.repo.EXPECT().UpdateUser(gomock.Any(), repository.UpdateUser{
+					ID:      "123",
+					Phone:   "+62856712332",
+					Name:    "New User",
+					Version: 2,
+				}).Return(nil)
+			},
+			args: args{
+				jwt:     token,
+				content: "{\"name\":\"New User\"}",
+				ifMatch: &currentETag,
+			},
+			want: want{
+				httpStatus: http.StatusOK,
+				content:    "{\"message\":\"User updated\"}\n",
+			},
+			wantErr:    false,
+			assertBody: true,
+		}, {
+			name: "Stale If-Match",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{
+					ID:      "123",
+					Phone:   "+62856712332",
+					Name:    "User",
+					Version: 3,
+				}, nil)
+			},
+			args: args{
+				jwt:     token,
+				content: "{\"name\":\"New User\"}",
+				ifMatch: &currentETag,
+			},
+			want: want{
+				httpStatus: http.StatusPreconditionFailed,
+				content:    "{\"message\":\"Profile has been modified\"}\n",
+			},
+			wantErr:    false,
+			assertBody: true,
+		}, {
+			name: "Concurrent update",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{
+					ID:      "123",
+					Phone:   "+62856712332",
+					Name:    "User",
+					Version: 2,
+				}, nil)
+				f.repo.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Return(repository.ErrVersionConflict)
+			},
+			args: args{
+				jwt:     token,
+				content: "{\"name\":\"New User\"}",
+			},
+			want: want{
+				httpStatus: http.StatusPreconditionFailed,
+				content:    "{\"message\":\"Profile has been modified\"}\n",
+			},
+			wantErr:    false,
+			assertBody: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// prepare mock
+			ctrl := gomock.NewController(t)
+			f := &fields{
+				repo: repository.NewMockRepositoryInterface(ctrl),
+			}
+			expectActiveUser(f.repo, "123")
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			// Create a new Echo instance
+			e := echo.New()
+
+			// Create a new instance of your server
+			s := NewServer(NewServerOptions{Repository: f.repo})
+
+			// Create a request
+			req := httptest.NewRequest(http.MethodGet, "/profile", strings.NewReader(tt.args.content))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+tt.args.jwt)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			// Call the handler
+			err := s.PutProfile(c, generated.PutProfileParams{IfMatch: tt.args.ifMatch})
+
+			if tt.wantErr {
+				assert.Error(t, err)
+			}
+
+			// Assert that there is no error
+			assert.NoError(t, err)
+
+			// Assert the HTTP status code
+			assert.Equal(t, tt.want.httpStatus, rec.Code)
+
+			if tt.assertBody {
+				// Assert the response body
+				assert.Equal(t, tt.want.content, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestPatchProfile(t *testing.T) {
+	// Mock
+	type fields struct {
+		repo *repository.MockRepositoryInterface
+	}
+
+	// Input parameters
+	type args struct {
+		jwt         string
+		contentType string
+		content     string
+		ifMatch     *string
+	}
+
+	// Output parameters
+	type want struct {
+		httpStatus int
+		content    string
+		etag       string
+	}
+
+	exp := time.Now().Add(time.Hour * 1)
+	token, _ := createToken("123", exp)
+	staleETag := formatETag(1)
+
+	user := repository.User{
+		ID:      "123",
+		Phone:   "+62856712332",
+		Name:    "User",
+		Version: 2,
+		Tenant:  "default",
+	}
+
+	email := "user@example.com"
+	userWithEmail := user
+	userWithEmail.Email = &email
+
+	attributeSchema := `{"type":"object","properties":{"block":{"type":"string"}}}`
+
+	// Test Case
+	tests := []struct {
+		prepare func(f *fields)
+		name    string
+		args    args
+		want    want
+	}{
+		{
+			name: "Success merge patch",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(user, nil)
+				f.repo.EXPECT().PatchUser(gomock.Any(), repository.PatchUser{
+					ID:      "123",
+					Version: 2,
+					Fields:  map[string]interface{}{"name": "New User"},
+				}).Return(nil)
+			},
+			args: args{
+				jwt:         token,
+				contentType: "application/merge-patch+json",
+				content:     "{\"name\":\"New User\"}",
+			},
+			want: want{
+				httpStatus: http.StatusOK,
+				content:    "{\"name\":\"New User\",\"phone\":\"+62856712332\"}\n",
+				etag:       "\"3\"",
+			},
+		}, {
+			name: "Success JSON patch",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(user, nil)
+				f.repo.EXPECT().PatchUser(gomock.Any(), repository.PatchUser{
+					ID:      "123",
+					Version: 2,
+					Fields:  map[string]interface{}{"phone": "+62812345678"},
+				}).Return(nil)
+			},
+			args: args{
+				jwt:         token,
+				contentType: "application/json-patch+json",
+				content:     "[{\"op\":\"replace\",\"path\":\"/phone\",\"value\":\"+62812345678\"}]",
+			},
+			want: want{
+				httpStatus: http.StatusOK,
+				content:    "{\"name\":\"User\",\"phone\":\"+62812345678\"}\n",
+				etag:       "\"3\"",
+			},
+		}, {
+			name: "No changes",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(user, nil)
+			},
+			args: args{
+				jwt:         token,
+				contentType: "application/merge-patch+json",
+				content:     "{\"name\":\"User\"}",
+			},
+			want: want{
+				httpStatus: http.StatusOK,
+				content:    "{\"name\":\"User\",\"phone\":\"+62856712332\"}\n",
+				etag:       "\"2\"",
+			},
+		}, {
+			name: "Clear optional field",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(userWithEmail, nil)
+				f.repo.EXPECT().PatchUser(gomock.Any(), repository.PatchUser{
+					ID:      "123",
+					Version: 2,
+					Fields:  map[string]interface{}{"email": nil},
+				}).Return(nil)
+			},
+			args: args{
+				jwt:         token,
+				contentType: "application/merge-patch+json",
+				content:     "{\"email\":null}",
+			},
+			want: want{
+				httpStatus: http.StatusOK,
+				content:    "{\"name\":\"User\",\"phone\":\"+62856712332\"}\n",
+				etag:       "\"3\"",
+			},
+		}, {
+			name: "Attributes valid against tenant schema",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(user, nil)
+				f.repo.EXPECT().FindAttributeSchema(gomock.Any(), "default").Return([]byte(attributeSchema), nil)
+				f.repo.EXPECT().PatchUser(gomock.Any(), repository.PatchUser{
+					ID:      "123",
+					Version: 2,
+					Fields:  map[string]interface{}{"attributes": map[string]interface{}{"block": "A1"}},
+				}).Return(nil)
+			},
+			args: args{
+				jwt:         token,
+				contentType: "application/merge-patch+json",
+				content:     "{\"attributes\":{\"block\":\"A1\"}}",
+			},
+			want: want{
+				httpStatus: http.StatusOK,
+				content:    "{\"attributes\":{\"block\":\"A1\"},\"name\":\"User\",\"phone\":\"+62856712332\"}\n",
+				etag:       "\"3\"",
+			},
+		}, {
+			name: "Attributes invalid against tenant schema",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(user, nil)
+				f.repo.EXPECT().FindAttributeSchema(gomock.Any(), "default").Return([]byte(attributeSchema), nil)
+			},
+			args: args{
+				jwt:         token,
+				contentType: "application/merge-patch+json",
+				content:     "{\"attributes\":{\"block\":7}}",
+			},
+			want: want{
+				httpStatus: http.StatusBadRequest,
+				content:    "{\"message\":\"Invalid attributes. value must be a string\"}\n",
+			},
+		}, {
+			name: "Tenant without schema",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(user, nil)
+				f.repo.EXPECT().FindAttributeSchema(gomock.Any(), "default").Return(nil, repository.ErrNotFound)
+				f.repo.EXPECT().PatchUser(gomock.Any(), gomock.Any()).Return(nil)
+			},
+			args: args{
+				jwt:         token,
+				contentType: "application/merge-patch+json",
+				content:     "{\"attributes\":{\"block\":7}}",
+			},
+			want: want{
+				httpStatus: http.StatusOK,
+				content:    "{\"attributes\":{\"block\":7},\"name\":\"User\",\"phone\":\"+62856712332\"}\n",
+				etag:       "\"3\"",
+			},
+		}, {
+			name: "Forbidden code",
+			args: args{
+				jwt:         "invalid",
+				contentType: "application/merge-patch+json",
+				content:     "{\"name\":\"New User\"}",
+			},
+			want: want{
+				httpStatus: http.StatusForbidden,
+				content:    "{\"message\":\"Forbidden code\"}\n",
+			},
+		}, {
+			name: "Unsupported media type",
+			args: args{
+				jwt:         token,
+				contentType: "application/json",
+				content:     "{\"name\":\"New User\"}",
+			},
+			want: want{
+				httpStatus: http.StatusUnsupportedMediaType,
+				content:    "{\"message\":\"Unsupported patch format\"}\n",
+			},
+		}, {
+			name: "Patch document too large",
+			args: args{
+				jwt:         token,
+				contentType: "application/merge-patch+json",
+				content:     "{\"name\":\"" + strings.Repeat("a", maxPatchSize) + "\"}",
+			},
+			want: want{
+				httpStatus: http.StatusRequestEntityTooLarge,
+				content:    "{\"message\":\"Patch document must be at most 64 KB\"}\n",
+			},
+		}, {
+			name: "Stale If-Match",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(user, nil)
+			},
+			args: args{
+				jwt:         token,
+				contentType: "application/merge-patch+json",
+				content:     "{\"name\":\"New User\"}",
+				ifMatch:     &staleETag,
+			},
+			want: want{
+				httpStatus: http.StatusPreconditionFailed,
+				content:    "{\"message\":\"Profile has been modified\"}\n",
+			},
+		}, {
+			name: "Invalid patch document",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(user, nil)
+			},
+			args: args{
+				jwt:         token,
+				contentType: "application/json-patch+json",
+				content:     "[{\"op\":\"test\",\"path\":\"/name\",\"value\":\"Other\"}]",
+			},
+			want: want{
+				httpStatus: http.StatusBadRequest,
+				content:    "{\"message\":\"Invalid patch document\"}\n",
+			},
+		}, {
+			name: "Remove required field",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(user, nil)
+			},
+			args: args{
+				jwt:         token,
+				contentType: "application/merge-patch+json",
+				content:     "{\"name\":null}",
+			},
+			want: want{
+				httpStatus: http.StatusBadRequest,
+				content:    "{\"message\":\"Invalid full name. Full names must be 3 to 60 characters\"}\n",
+			},
+		}, {
+			name: "Unknown field",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(user, nil)
+			},
+			args: args{
+				jwt:         token,
+				contentType: "application/merge-patch+json",
+				content:     "{\"password\":\"Password1!\"}",
+			},
+			want: want{
+				httpStatus: http.StatusBadRequest,
+				content:    "{\"message\":\"Unknown profile field password\"}\n",
+			},
+		}, {
+			name: "Phone number already exist",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(user, nil)
+				f.repo.EXPECT().PatchUser(gomock.Any(), gomock.Any()).Return(repository.ErrDuplicatePhone)
+			},
+			args: args{
+				jwt:         token,
+				contentType: "application/merge-patch+json",
+				content:     "{\"phone\":\"+62812345678\"}",
+			},
+			want: want{
+				httpStatus: http.StatusConflict,
+				content:    "{\"message\":\"Phone number already exist\"}\n",
+			},
+		}, {
+			name: "Concurrent update",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(user, nil)
+				f.repo.EXPECT().PatchUser(gomock.Any(), gomock.Any()).Return(repository.ErrVersionConflict)
+			},
+			args: args{
+				jwt:         token,
+				contentType: "application/merge-patch+json",
+				content:     "{\"name\":\"New User\"}",
+			},
+			want: want{
+				httpStatus: http.StatusPreconditionFailed,
+				content:    "{\"message\":\"Profile has been modified\"}\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// prepare mock
+			ctrl := gomock.NewController(t)
+			f := &fields{
+				repo: repository.NewMockRepositoryInterface(ctrl),
+			}
+			expectActiveUser(f.repo, "123")
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			// Create a new Echo instance
+			e := echo.New()
+
+			// Create a new instance of your server
+			s := NewServer(NewServerOptions{Repository: f.repo})
+
+			// Create a request
+			req := httptest.NewRequest(http.MethodPatch, "/profile", strings.NewReader(tt.args.content))
+			req.Header.Set("Content-Type", tt.args.contentType)
+			req.Header.Set("Authorization", "Bearer "+tt.args.jwt)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			// Call the handler
+			err := s.PatchProfile(c, generated.PatchProfileParams{IfMatch: tt.args.ifMatch})
+
+			// Assert that there is no error
+			assert.NoError(t, err)
+
+			// Assert the HTTP status code
+			assert.Equal(t, tt.want.httpStatus, rec.Code)
+
+			// Assert the response body and ETag
+			assert.Equal(t, tt.want.content, rec.Body.String())
+			assert.Equal(t, tt.want.etag, rec.Header().Get("ETag"))
+		})
+	}
+}
+
+func TestPutProfileAvatar(t *testing.T) {
+	// Mock
+	type fields struct {
+		repo  *repository.MockRepositoryInterface
+		store *storage.LocalStore
+	}
+
+	// Input parameters
+	type args struct {
+		jwt     string
+		content []byte
+	}
+
+	// Output parameters
+	type want struct {
+		httpStatus int
+		content    string
+	}
+
+	exp := time.Now().Add(time.Hour * 1)
+	token, _ := createToken("123", exp)
+	oldKey := "avatars/123/old"
+
+	// Test Case
+	tests := []struct {
+		prepare func(f *fields)
+		name    string
+		args    args
+		want    want
+		check   func(t *testing.T, f *fields)
+	}{
+		{
+			name: "Success",
+			prepare: func(f *fields) {
+				f.store.Put(context.Background(), service.AvatarObjectKey(oldKey, 64), strings.NewReader("old"), "image/jpeg")
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{ID: "123", AvatarKey: &oldKey}, nil)
+				f.repo.EXPECT().UpdateAvatarKey(gomock.Any(), "123", gomock.Any()).Return(nil)
+			},
+			args: args{
+				jwt:     token,
+				content: testImage(t, 300, 200, encodePNG),
+			},
+			want: want{
+				httpStatus: http.StatusOK,
+				content:    "{\"message\":\"Avatar updated\"}\n",
+			},
+			check: func(t *testing.T, f *fields) {
+				// Old avatar is removed
+				_, _, err := f.store.Get(context.Background(), service.AvatarObjectKey(oldKey, 64))
+				assert.ErrorIs(t, err, storage.ErrNotFound)
+			},
+		}, {
+			name: "Forbidden code",
+			args: args{
+				jwt:     "invalid",
+				content: testImage(t, 10, 10, encodePNG),
+			},
+			want: want{
+				httpStatus: http.StatusForbidden,
+				content:    "{\"message\":\"Forbidden code\"}\n",
+			},
+		}, {
+			name: "Unsupported image",
+			args: args{
+				jwt:     token,
+				content: []byte("plain text"),
+			},
+			want: want{
+				httpStatus: http.StatusUnsupportedMediaType,
+				content:    "{\"message\":\"Avatar must be a JPEG, PNG or GIF image\"}\n",
+			},
+		}, {
+			name: "Corrupted image",
+			args: args{
+				jwt:     token,
+				content: testImage(t, 10, 10, encodePNG)[:40],
+			},
+			want: want{
+				httpStatus: http.StatusBadRequest,
+				content:    "{\"message\":\"Invalid image\"}\n",
+			},
+		}, {
+			name: "Too large",
+			args: args{
+				jwt:     token,
+				content: bytes.Repeat([]byte{0}, maxAvatarSize+1),
+			},
+			want: want{
+				httpStatus: http.StatusRequestEntityTooLarge,
+				content:    "{\"message\":\"Avatar must be at most 5 MB\"}\n",
+			},
+		}, {
+			name: "Failed update avatar key",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{ID: "123"}, nil)
+				f.repo.EXPECT().UpdateAvatarKey(gomock.Any(), "123", gomock.Any()).Return(fmt.Errorf("error"))
+			},
+			args: args{
+				jwt:     token,
+				content: testImage(t, 10, 10, encodePNG),
+			},
+			want: want{
+				httpStatus: http.StatusInternalServerError,
+				content:    "{\"message\":\"Internal Server Error\"}\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// prepare mock
+			ctrl := gomock.NewController(t)
+			f := &fields{
+				repo:  repository.NewMockRepositoryInterface(ctrl),
+				store: storage.NewLocalStore(storage.NewLocalStoreOptions{Root: t.TempDir()}),
+			}
+			expectActiveUser(f.repo, "123")
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			// Create a new Echo instance
+			e := echo.New()
+
+			// Create a new instance of your server
+			s := NewServer(NewServerOptions{Repository: f.repo, BlobStore: f.store})
+
+			// Create a multipart request
+			body := new(bytes.Buffer)
+			writer := multipart.NewWriter(body)
+			part, _ := writer.CreateFormFile("avatar", "avatar.png")
+			part.Write(tt.args.content)
+			writer.Close()
+
+			req := httptest.NewRequest(http.MethodPut, "/profile/avatar", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			req.Header.Set("Authorization", "Bearer "+tt.args.jwt)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			// Call the handler
+			err := s.PutProfileAvatar(c)
+
+			// Assert that there is no error
+			assert.NoError(t, err)
+
+			// Assert the HTTP status code
+			assert.Equal(t, tt.want.httpStatus, rec.Code)
+
+			// Assert the response body
+			assert.Equal(t, tt.want.content, rec.Body.String())
+
+			if tt.check != nil {
+				tt.check(t, f)
+			}
+		})
+	}
+}
+
+func TestPostProfileEmailVerification(t *testing.T) {
+	// Mock
+	type fields struct {
+		repo     *repository.MockRepositoryInterface
+		notifier *notification.MockNotifier
+	}
+
+	// Output parameters
+	type want struct {
+		httpStatus int
+		content    string
+	}
+
+	exp := time.Now().Add(time.Hour * 1)
+	token, _ := createToken("123", exp)
+	token = "Bearer " + token
+
+	email := "user@example.com"
+	verifiedAt := time.Now()
+
+	// Test Case
+	tests := []struct {
+		prepare func(f *fields)
+		name    string
+		args    string
+		want    want
+	}{
+		{
+			name: "Success",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{ID: "123", Name: "User", Email: &email}, nil)
+				f.notifier.EXPECT().Notify(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, message notification.Message) error {
+					assert.Equal(t, email, message.To)
+					assert.Contains(t, message.Body, "http://localhost:8080/email/verify?token=")
+
+					// Link carry token for the current id and email
+					link := message.Body[strings.Index(message.Body, "token=")+len("token="):]
+					linkToken, err := url.QueryUnescape(strings.TrimSpace(link))
+					assert.NoError(t, err)
+					id, linkEmail, err := parseEmailVerificationToken(linkToken)
+					assert.NoError(t, err)
+					assert.Equal(t, "123", id)
+					assert.Equal(t, email, linkEmail)
+					return nil
+				})
+			},
+			args: token,
+			want: want{
+				httpStatus: http.StatusAccepted,
+				content:    "{\"message\":\"Verification email sent\"}\n",
+			},
+		}, {
+			name: "Forbidden code",
+			args: "asd",
+			want: want{
+				httpStatus: http.StatusForbidden,
+				content:    "{\"message\":\"Forbidden code\"}\n",
+			},
+		}, {
+			name: "Email is not set",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{ID: "123", Name: "User"}, nil)
+			},
+			args: token,
+			want: want{
+				httpStatus: http.StatusBadRequest,
+				content:    "{\"message\":\"Email is not set\"}\n",
+			},
+		}, {
+			name: "Email already verified",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{ID: "123", Name: "User", Email: &email, EmailVerifiedAt: &verifiedAt}, nil)
+			},
+			args: token,
+			want: want{
+				httpStatus: http.StatusBadRequest,
+				content:    "{\"message\":\"Email already verified\"}\n",
+			},
+		}, {
+			name: "Failed send email",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{ID: "123", Name: "User", Email: &email}, nil)
+				f.notifier.EXPECT().Notify(gomock.Any(), gomock.Any()).Return(fmt.Errorf("error"))
+			},
+			args: token,
+			want: want{
+				httpStatus: http.StatusInternalServerError,
+				content:    "{\"message\":\"Error when sending verification email\"}\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// prepare mock
+			ctrl := gomock.NewController(t)
+			f := &fields{
+				repo:     repository.NewMockRepositoryInterface(ctrl),
+				notifier: notification.NewMockNotifier(ctrl),
+			}
+			expectActiveUser(f.repo, "123")
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			// Create a new Echo instance
+			e := echo.New()
+
+			// Create a new instance of your server
+			s := NewServer(NewServerOptions{Repository: f.repo, EmailNotifier: f.notifier, BaseURL: "http://localhost:8080"})
+
+			// Create a request
+			req := httptest.NewRequest(http.MethodPost, "/profile/email/verification", nil)
+			req.Header.Set("Authorization", tt.args)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			// Call the handler
+			err := s.PostProfileEmailVerification(c)
+			assert.NoError(t, err)
+
+			// Assert the HTTP status code and response body
+			assert.Equal(t, tt.want.httpStatus, rec.Code)
+			assert.Equal(t, tt.want.content, rec.Body.String())
+		})
+	}
+}
+
+func TestGetEmailVerify(t *testing.T) {
+	// Mock
+	type fields struct {
+		repo *repository.MockRepositoryInterface
+	}
+
+	// Output parameters
+	type want struct {
+		httpStatus int
+		content    string
+	}
+
+	validToken, _ := createEmailVerificationToken("123", "user@example.com", time.Now().Add(time.Hour))
+	expiredToken, _ := createEmailVerificationToken("123", "user@example.com", time.Now().Add(-time.Hour))
+	loginToken, _ := createToken("123", time.Now().Add(time.Hour))
+
+	// Test Case
+	tests := []struct {
+		prepare func(f *fields)
+		name    string
+		args    string
+		want    want
+	}{
+		{
+			name: "Success",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().VerifyEmail(gomock.Any(), "123", "user@example.com").Return(nil)
+			},
+			args: validToken,
+			want: want{
+				httpStatus: http.StatusOK,
+				content:    "{\"message\":\"Email verified\"}\n",
+			},
+		}, {
+			name: "Expired link",
+			args: expiredToken,
+			want: want{
+				httpStatus: http.StatusBadRequest,
+				content:    "{\"message\":\"Invalid or expired verification link\"}\n",
+			},
+		}, {
+			name: "Login token is not a verification link",
+			args: loginToken,
+			want: want{
+				httpStatus: http.StatusBadRequest,
+				content:    "{\"message\":\"Invalid or expired verification link\"}\n",
+			},
+		}, {
+			name: "Email changed after link was sent",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().VerifyEmail(gomock.Any(), "123", "user@example.com").Return(repository.ErrNotFound)
+			},
+			args: validToken,
+			want: want{
+				httpStatus: http.StatusBadRequest,
+				content:    "{\"message\":\"Invalid or expired verification link\"}\n",
+			},
+		}, {
+			name: "Email verified by another user first",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().VerifyEmail(gomock.Any(), "123", "user@example.com").Return(repository.ErrDuplicateEmail)
+			},
+			args: validToken,
+			want: want{
+				httpStatus: http.StatusConflict,
+				content:    "{\"message\":\"Email already exist\"}\n",
+			},
+		}, {
+			name: "Failed verify email",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().VerifyEmail(gomock.Any(), "123", "user@example.com").Return(fmt.Errorf("error"))
+			},
+			args: validToken,
+			want: want{
+				httpStatus: http.StatusInternalServerError,
+				content:    "{\"message\":\"Internal Server Error\"}\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// prepare mock
+			ctrl := gomock.NewController(t)
+			f := &fields{
+				repo: repository.NewMockRepositoryInterface(ctrl),
+			}
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			// Create a new Echo instance
+			e := echo.New()
+
+			// Create a new instance of your server
+			s := NewServer(NewServerOptions{Repository: f.repo})
+
+			// Create a request
+			req := httptest.NewRequest(http.MethodGet, "/email/verify", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			// Call the handler
+			err := s.GetEmailVerify(c, generated.GetEmailVerifyParams{Token: tt.args})
+			assert.NoError(t, err)
+
+			// Assert the HTTP status code and response body
+			assert.Equal(t, tt.want.httpStatus, rec.Code)
+			assert.Equal(t, tt.want.content, rec.Body.String())
+		})
+	}
+}
+
+func TestGetUsersIdAvatar(t *testing.T) {
+	// Mock
+	type fields struct {
+		repo *repository.MockRepositoryInterface
+	}
+
+	// Input parameters
+	type args struct {
+		id          string
+		size        *int
+		ifNoneMatch string
+	}
+
+	// Output parameters
+	type want struct {
+		httpStatus  int
+		contentType string
+		content     string
+	}
+
+	id := "8a1e2b6f-4c1d-4a8e-9f4b-2d3c4e5f6a7b"
+	avatarKey := "avatars/" + id + "/abc"
+	invalidSize := 100
+	smallSize := 64
+
+	store := storage.NewLocalStore(storage.NewLocalStoreOptions{Root: t.TempDir()})
+	store.Put(context.Background(), service.AvatarObjectKey(avatarKey, 256), strings.NewReader("avatar-256"), "image/jpeg")
+	store.Put(context.Background(), service.AvatarObjectKey(avatarKey, 64), strings.NewReader("avatar-64"), "image/jpeg")
+
+	// Test Case
+	tests := []struct {
+		prepare func(f *fields)
+		name    string
+		args    args
+		want    want
+	}{
+		{
+			name: "Success default size",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{ID: id, AvatarKey: &avatarKey}, nil)
+			},
+			args: args{id: id},
+			want: want{
+				httpStatus:  http.StatusOK,
+				contentType: "image/jpeg",
+				content:     "avatar-256",
+			},
+		}, {
+			name: "Success small size",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{ID: id, AvatarKey: &avatarKey}, nil)
+			},
+			args: args{id: id, size: &smallSize},
+			want: want{
+				httpStatus:  http.StatusOK,
+				contentType: "image/jpeg",
+				content:     "avatar-64",
+			},
+		}, {
+			name: "Not modified",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{ID: id, AvatarKey: &avatarKey}, nil)
+			},
+			args: args{id: id, ifNoneMatch: "\"abc-256\""},
+			want: want{
+				httpStatus: http.StatusNotModified,
+			},
+		}, {
+			name: "Invalid size",
+			args: args{id: id, size: &invalidSize},
+			want: want{
+				httpStatus:  http.StatusBadRequest,
+				contentType: "application/json; charset=UTF-8",
+				content:     "{\"message\":\"Invalid size. Size must be one of 64, 128, 256 or 512\"}\n",
+			},
+		}, {
+			name: "Invalid user id",
+			args: args{id: "123"},
+			want: want{
+				httpStatus:  http.StatusNotFound,
+				contentType: "application/json; charset=UTF-8",
+				content:     "{\"message\":\"User not found\"}\n",
+			},
+		}, {
+			name: "User not found",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{}, repository.ErrNotFound)
+			},
+			args: args{id: id},
+			want: want{
+				httpStatus:  http.StatusNotFound,
+				contentType: "application/json; charset=UTF-8",
+				content:     "{\"message\":\"User not found\"}\n",
+			},
+		}, {
+			name: "Avatar not uploaded",
+			prepare: func(f *fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{ID: id}, nil)
+			},
+			args: args{id: id},
+			want: want{
+				httpStatus:  http.StatusNotFound,
+				contentType: "application/json; charset=UTF-8",
+				content:     "{\"message\":\"Avatar not found\"}\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// prepare mock
+			ctrl := gomock.NewController(t)
+			f := &fields{
+				repo: repository.NewMockRepositoryInterface(ctrl),
+			}
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			// Create a new Echo instance
+			e := echo.New()
+
+			// Create a new instance of your server
+			s := NewServer(NewServerOptions{Repository: f.repo, BlobStore: store})
+
+			// Create a request
+			req := httptest.NewRequest(http.MethodGet, "/users/"+tt.args.id+"/avatar", nil)
+			if tt.args.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.args.ifNoneMatch)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			// Call the handler
+			err := s.GetUsersIdAvatar(c, tt.args.id, generated.GetUsersIdAvatarParams{Size: tt.args.size})
+
+			// Assert that there is no error
+			assert.NoError(t, err)
+
+			// Assert the HTTP status code, content type and body
+			assert.Equal(t, tt.want.httpStatus, rec.Code)
+			assert.Equal(t, tt.want.contentType, rec.Header().Get("Content-Type"))
+			assert.Equal(t, tt.want.content, rec.Body.String())
+		})
+	}
+}
+
+func TestMatchETag(t *testing.T) {
+	// Matching If-Match values for version 2
+	matching := []string{`"2"`, `"1", "2"`, `*`}
+
+	// Not matching If-Match values for version 2
+	notMatching := []string{`"1"`, `2`, `W/"2"`, ``}
+
+	for _, ifMatch := range matching {
+		assert.True(t, matchETag(ifMatch, 2), "Expected %s to match version 2", ifMatch)
+	}
+
+	for _, ifMatch := range notMatching {
+		assert.False(t, matchETag(ifMatch, 2), "Expected %s to not match version 2", ifMatch)
+	}
 }
 
 func TestCreateToken(t *testing.T) {
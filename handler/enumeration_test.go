@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/notification"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/service"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// enumerationResponse : status and body of a response, with the time the handler took
+type enumerationResponse struct {
+	status  int
+	body    string
+	elapsed time.Duration
+}
+
+func callEnumerationHandler(s *Server, path, body string, handler func(*Server, echo.Context) error) enumerationResponse {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+
+	start := time.Now()
+	handler(s, c)
+	return enumerationResponse{status: rec.Code, body: rec.Body.String(), elapsed: time.Since(start)}
+}
+
+func TestPostLoginEnumerationProtection(t *testing.T) {
+	email := "user@example.com"
+	verifiedAt := time.Now()
+	user := repository.User{
+		ID:              "123",
+		Phone:           "+62856712332",
+		Name:            "User",
+		Password:        "$2a$10$Ke5Sl0ra2VeYSmmqjnlE9OLl.I1Bmc8Ou5ix7M2lrPhB6FzV8raJC",
+		Salt:            "63RDLuJv8Kmeehqgeg35FA==",
+		Email:           &email,
+		EmailVerifiedAt: &verifiedAt,
+	}
+	unverified := user
+	unverified.EmailVerifiedAt = nil
+
+	scenarios := []struct {
+		name  string
+		user  repository.User
+		err   error
+		input string
+	}{
+		{"Unknown phone", repository.User{}, repository.ErrNotFound, `{"phone": "+62856712333", "password": "QWErty123!@#"}`},
+		{"Wrong password for phone", user, nil, `{"phone": "+62856712332", "password": "Wrong123!@#"}`},
+		{"Unknown email", repository.User{}, repository.ErrNotFound, `{"email": "other@example.com", "password": "QWErty123!@#"}`},
+		{"Wrong password for email", user, nil, `{"email": "user@example.com", "password": "Wrong123!@#"}`},
+		{"Wrong password for unverified email", unverified, nil, `{"email": "user@example.com", "password": "Wrong123!@#"}`},
+	}
+
+	responses := map[string]enumerationResponse{}
+	for _, scenario := range scenarios {
+		ctrl := gomock.NewController(t)
+		repo := repository.NewMockRepositoryInterface(ctrl)
+		// Email without a verified owner is looked up again among the users that did not verify it
+		if scenario.user.EmailVerifiedAt != nil {
+			repo.EXPECT().FindVerifiedEmailUser(gomock.Any(), gomock.Any()).Return(scenario.user, scenario.err).AnyTimes()
+		} else {
+			repo.EXPECT().FindVerifiedEmailUser(gomock.Any(), gomock.Any()).Return(repository.User{}, repository.ErrNotFound).AnyTimes()
+		}
+		repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(scenario.user, scenario.err).AnyTimes()
+
+		s := NewServer(NewServerOptions{Repository: repo, EnumerationProtection: true})
+		responses[scenario.name] = callEnumerationHandler(s, "/login", scenario.input, (*Server).PostLogin)
+		ctrl.Finish()
+	}
+
+	// Every failure is the same generic error
+	expected := responses["Wrong password for phone"]
+	assert.Equal(t, http.StatusBadRequest, expected.status)
+	assert.Equal(t, "{\"message\":\"Invalid phone number, email or password\"}\n", expected.body)
+	for name, response := range responses {
+		assert.Equal(t, expected.status, response.status, name)
+		assert.Equal(t, expected.body, response.body, name)
+	}
+
+	// Unknown users pay for a bcrypt comparison too, allow a wide margin for noisy machines
+	assert.Greater(t, responses["Unknown phone"].elapsed, expected.elapsed/4)
+	assert.Greater(t, responses["Unknown email"].elapsed, expected.elapsed/4)
+}
+
+func TestPostLoginWithoutEnumerationProtection(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	repo := repository.NewMockRepositoryInterface(ctrl)
+	repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{}, repository.ErrNotFound)
+
+	s := NewServer(NewServerOptions{Repository: repo})
+	response := callEnumerationHandler(s, "/login", `{"phone": "+62856712333", "password": "QWErty123!@#"}`, (*Server).PostLogin)
+	assert.Equal(t, "{\"message\":\"User not found\"}\n", response.body)
+}
+
+func TestPostRegistrationEnumerationProtection(t *testing.T) {
+	input := `{"phone": "0856712332", "name": "User", "password": "Password1!"}`
+
+	// New phone number
+	ctrl := gomock.NewController(t)
+	repo := repository.NewMockRepositoryInterface(ctrl)
+	repo.EXPECT().Registration(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, input repository.RegistrationInput) (repository.RegistrationOutput, error) {
+		return repository.RegistrationOutput{ID: input.ID}, nil
+	})
+	s := NewServer(NewServerOptions{Repository: repo, EnumerationProtection: true})
+	created := callEnumerationHandler(s, "/registration", input, (*Server).PostRegistration)
+
+	// Existing phone number, the owner is notified instead
+	repo = repository.NewMockRepositoryInterface(ctrl)
+	repo.EXPECT().Registration(gomock.Any(), gomock.Any()).Return(repository.RegistrationOutput{}, repository.ErrDuplicatePhone)
+	notifier := notification.NewMockNotifier(ctrl)
+	notifier.EXPECT().Notify(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, message notification.Message) error {
+		assert.Equal(t, "+62856712332", message.To)
+		assert.Contains(t, message.Body, "tried to register")
+		return nil
+	})
+	s = NewServer(NewServerOptions{Repository: repo, SMSNotifier: notifier, EnumerationProtection: true})
+	existing := callEnumerationHandler(s, "/registration", input, (*Server).PostRegistration)
+	s.Users.Wait()
+
+	// Same status and message, the id is a fresh uuid in both cases
+	assert.Equal(t, http.StatusOK, created.status)
+	assert.Equal(t, created.status, existing.status)
+
+	var createdBody, existingBody map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(created.body), &createdBody))
+	assert.NoError(t, json.Unmarshal([]byte(existing.body), &existingBody))
+	assert.Equal(t, createdBody["message"], existingBody["message"])
+	assert.Len(t, existingBody, len(createdBody))
+	_, err := uuid.Parse(createdBody["id"])
+	assert.NoError(t, err)
+	_, err = uuid.Parse(existingBody["id"])
+	assert.NoError(t, err)
+}
+
+func TestPostLoginOtpStartEnumerationProtection(t *testing.T) {
+	scenarios := []struct {
+		name    string
+		prepare func(repo *repository.MockRepositoryInterface, notifier *notification.MockNotifier)
+	}{
+		{"Unknown phone", func(repo *repository.MockRepositoryInterface, notifier *notification.MockNotifier) {
+			repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{}, repository.ErrNotFound)
+			repo.EXPECT().CreateLoginOTP(gomock.Any(), gomock.Any()).Return(nil)
+		}},
+		{"OTP login not enabled", func(repo *repository.MockRepositoryInterface, notifier *notification.MockNotifier) {
+			repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{ID: "123", Phone: "+62856712332"}, nil)
+			repo.EXPECT().CreateLoginOTP(gomock.Any(), gomock.Any()).Return(nil)
+		}},
+		{"Sent", func(repo *repository.MockRepositoryInterface, notifier *notification.MockNotifier) {
+			repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{ID: "123", Phone: "+62856712332", OTPLoginEnabled: true}, nil)
+			repo.EXPECT().CreateLoginOTP(gomock.Any(), gomock.Any()).Return(nil)
+			notifier.EXPECT().Notify(gomock.Any(), gomock.Any()).Return(nil)
+		}},
+		{"SMS failed", func(repo *repository.MockRepositoryInterface, notifier *notification.MockNotifier) {
+			repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{ID: "123", Phone: "+62856712332", OTPLoginEnabled: true}, nil)
+			repo.EXPECT().CreateLoginOTP(gomock.Any(), gomock.Any()).Return(nil)
+			notifier.EXPECT().Notify(gomock.Any(), gomock.Any()).Return(errors.New("gateway unavailable"))
+		}},
+	}
+
+	responses := map[string]enumerationResponse{}
+	for _, scenario := range scenarios {
+		ctrl := gomock.NewController(t)
+		repo := repository.NewMockRepositoryInterface(ctrl)
+		notifier := notification.NewMockNotifier(ctrl)
+		repo.EXPECT().CountLoginOTP(gomock.Any(), gomock.Any(), gomock.Any()).Return(0, nil)
+		scenario.prepare(repo, notifier)
+
+		s := NewServer(NewServerOptions{Repository: repo, SMSNotifier: notifier, EnumerationProtection: true})
+		responses[scenario.name] = callEnumerationHandler(s, "/login/otp/start", `{"phone": "+62856712332"}`, (*Server).PostLoginOtpStart)
+		s.Users.Wait()
+		ctrl.Finish()
+	}
+
+	for name, response := range responses {
+		assert.Equal(t, http.StatusAccepted, response.status, name)
+		assert.Equal(t, responses["Sent"].body, response.body, name)
+	}
+}
+
+func TestPostLoginOtpStartRateLimitUnknownPhone(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	s := NewServer(NewServerOptions{Repository: repo, SMSNotifier: notification.NewLogNotifier(), EnumerationProtection: true})
+
+	// Unknown phones are limited like registered ones, otherwise only registered phones would ever get 429
+	for i := 0; i < service.OTPRateLimit; i++ {
+		response := callEnumerationHandler(s, "/login/otp/start", `{"phone": "+62856712332"}`, (*Server).PostLoginOtpStart)
+		assert.Equal(t, http.StatusAccepted, response.status)
+	}
+	response := callEnumerationHandler(s, "/login/otp/start", `{"phone": "+62856712332"}`, (*Server).PostLoginOtpStart)
+	assert.Equal(t, http.StatusTooManyRequests, response.status)
+}
@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/export"
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/oauth"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// exportPageSize : users read from the database at a time, each page is flushed to the client
+const exportPageSize = 1000
+
+// userExportColumn : column that can be exported and how its value is read from the user
+type userExportColumn struct {
+	export.Column
+	value func(user repository.ExportUser) interface{}
+}
+
+// userExportColumns : every column that can be exported in default order, secrets are not in repository.ExportUser
+var userExportColumns = []userExportColumn{
+	{export.Column{Name: "id", Type: export.String}, func(u repository.ExportUser) interface{} { return u.ID }},
+	{export.Column{Name: "phone", Type: export.String}, func(u repository.ExportUser) interface{} { return u.Phone }},
+	{export.Column{Name: "name", Type: export.String}, func(u repository.ExportUser) interface{} { return u.Name }},
+	{export.Column{Name: "version", Type: export.Int}, func(u repository.ExportUser) interface{} { return int64(u.Version) }},
+	{export.Column{Name: "email", Type: export.String}, func(u repository.ExportUser) interface{} { return nullableString(u.Email) }},
+	{export.Column{Name: "email_verified_at", Type: export.Timestamp}, func(u repository.ExportUser) interface{} { return nullableTime(u.EmailVerifiedAt) }},
+	{export.Column{Name: "preferred_language", Type: export.String}, func(u repository.ExportUser) interface{} { return nullableString(u.PreferredLanguage) }},
+	{export.Column{Name: "avatar_url", Type: export.String}, func(u repository.ExportUser) interface{} { return nullableString(u.AvatarURL) }},
+	{export.Column{Name: "date_of_birth", Type: export.Date}, func(u repository.ExportUser) interface{} { return nullableTime(u.DateOfBirth) }},
+	{export.Column{Name: "address", Type: export.String}, func(u repository.ExportUser) interface{} { return nullableString(u.Address) }},
+	{export.Column{Name: "estate", Type: export.String}, func(u repository.ExportUser) interface{} { return nullableString(u.Estate) }},
+	{export.Column{Name: "region", Type: export.String}, func(u repository.ExportUser) interface{} { return nullableString(u.Region) }},
+	{export.Column{Name: "tenant", Type: export.String}, func(u repository.ExportUser) interface{} { return u.Tenant }},
+	{export.Column{Name: "attributes", Type: export.JSON}, func(u repository.ExportUser) interface{} { return nullableJSON(u.Attributes) }},
+	{export.Column{Name: "otp_login_enabled", Type: export.Bool}, func(u repository.ExportUser) interface{} { return u.OTPLoginEnabled }},
+	{export.Column{Name: "phone_verified_at", Type: export.Timestamp}, func(u repository.ExportUser) interface{} { return nullableTime(u.PhoneVerifiedAt) }},
+	{export.Column{Name: "created_at", Type: export.Timestamp}, func(u repository.ExportUser) interface{} { return u.CreatedAt }},
+	{export.Column{Name: "updated_at", Type: export.Timestamp}, func(u repository.ExportUser) interface{} { return nullableTime(u.UpdatedAt) }},
+}
+
+// ExportOptions : options of ExportUsers
+type ExportOptions struct {
+	// Format is csv, jsonl or parquet, default csv
+	Format string
+	// Columns are exported in this order, default every column
+	Columns []string
+	// Filter selects the users, its After and Limit are set by ExportUsers
+	Filter repository.ExportFilter
+	// PageSize is the users read from the database at a time, default exportPageSize
+	PageSize int
+}
+
+// ExportOptionsError : the export cannot start because of its options, the message can be shown to the user
+type ExportOptionsError struct {
+	Message string
+}
+
+func (e *ExportOptionsError) Error() string {
+	return e.Message
+}
+
+// GetUsersExport : this handler is for exporting users in bulk by an admin client, the file is streamed page by page
+func (s *Server) GetUsersExport(ctx echo.Context, params generated.GetUsersExportParams) error {
+	_, err := s.authenticateClient(ctx, oauth.ScopeUsersExport)
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
+	}
+
+	opts := ExportOptions{
+		Filter: repository.ExportFilter{
+			CreatedAfter:  params.CreatedAfter,
+			CreatedBefore: params.CreatedBefore,
+		},
+	}
+	if params.Format != nil {
+		opts.Format = *params.Format
+	}
+	if params.Columns != nil {
+		opts.Columns = strings.Split(*params.Columns, ",")
+	}
+	if params.Tenant != nil {
+		opts.Filter.Tenant = *params.Tenant
+	}
+	if params.Estate != nil {
+		opts.Filter.Estate = *params.Estate
+	}
+	if params.Region != nil {
+		opts.Filter.Region = *params.Region
+	}
+
+	if _, err := opts.columns(); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": err.Error()})
+	}
+	format := opts.format()
+	header := ctx.Response().Header()
+	header.Set(echo.HeaderContentType, export.Formats[format])
+	header.Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=\"users.%s\"", format))
+
+	_, err = s.ExportUsers(ctx.Request().Context(), ctx.Response(), opts)
+	if err != nil {
+		log.Error(err)
+		if ctx.Response().Committed {
+			// The status was sent with the first page, abort so the client does not keep an incomplete file
+			panic(http.ErrAbortHandler)
+		}
+		header.Del(echo.HeaderContentDisposition)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+	return nil
+}
+
+// ExportUsers : write users in the format of the options page by page, used by the API and the admin CLI
+func (s *Server) ExportUsers(ctx context.Context, w io.Writer, opts ExportOptions) (exported int, err error) {
+	columns, err := opts.columns()
+	if err != nil {
+		return 0, err
+	}
+	exportColumns := make([]export.Column, len(columns))
+	for i, column := range columns {
+		exportColumns[i] = column.Column
+	}
+	writer, err := export.NewWriter(opts.format(), w, exportColumns)
+	if err != nil {
+		return 0, err
+	}
+
+	filter := opts.Filter
+	filter.After = ""
+	filter.Limit = opts.PageSize
+	if filter.Limit <= 0 {
+		filter.Limit = exportPageSize
+	}
+
+	row := make([]interface{}, len(columns))
+	for {
+		users, err := s.Repository.ExportUsers(ctx, filter)
+		if err != nil {
+			return exported, err
+		}
+		for _, user := range users {
+			for i, column := range columns {
+				row[i] = column.value(user)
+			}
+			if err := writer.Write(row); err != nil {
+				return exported, err
+			}
+		}
+		exported += len(users)
+
+		// A short page is the last one
+		if len(users) < filter.Limit {
+			break
+		}
+		if err := writer.Flush(); err != nil {
+			return exported, err
+		}
+		flushResponse(w)
+		filter.After = users[len(users)-1].ID
+	}
+
+	if err := writer.Close(); err != nil {
+		return exported, err
+	}
+	flushResponse(w)
+	return exported, nil
+}
+
+// flushResponse : send the written page to the client when w is a response
+func flushResponse(w io.Writer) {
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (opts ExportOptions) format() string {
+	if opts.Format == "" {
+		return export.FormatCSV
+	}
+	return opts.Format
+}
+
+// columns : the columns to export, every column when none is given
+func (opts ExportOptions) columns() ([]userExportColumn, error) {
+	if _, ok := export.Formats[opts.format()]; !ok {
+		return nil, &ExportOptionsError{Message: "Invalid format. Format must be csv, jsonl or parquet"}
+	}
+	if len(opts.Columns) == 0 {
+		return userExportColumns, nil
+	}
+
+	columns := make([]userExportColumn, 0, len(opts.Columns))
+	selected := make(map[string]bool, len(opts.Columns))
+	for _, name := range opts.Columns {
+		name = strings.TrimSpace(name)
+		column, ok := findExportColumn(name)
+		if !ok {
+			return nil, &ExportOptionsError{Message: fmt.Sprintf("Invalid column %s. Columns must be %s", name, exportColumnNames())}
+		}
+		if selected[name] {
+			return nil, &ExportOptionsError{Message: fmt.Sprintf("Duplicate column %s", name)}
+		}
+		selected[name] = true
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+func findExportColumn(name string) (userExportColumn, bool) {
+	for _, column := range userExportColumns {
+		if column.Name == name {
+			return column, true
+		}
+	}
+	return userExportColumn{}, false
+}
+
+func exportColumnNames() string {
+	names := make([]string, len(userExportColumns))
+	for i, column := range userExportColumns {
+		names[i] = column.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// nullableString : nil interface for nil pointer, so the column is written as empty or null
+func nullableString(value *string) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+func nullableTime(value *time.Time) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+func nullableJSON(value []byte) interface{} {
+	if len(value) == 0 {
+		return nil
+	}
+	return json.RawMessage(value)
+}
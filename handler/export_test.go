@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/export"
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/oauth"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func testExportUser(id string, phone string) repository.ExportUser {
+	estate := "Riau 1"
+	return repository.ExportUser{
+		ID:         id,
+		Phone:      phone,
+		Name:       "Budi Santoso",
+		Version:    1,
+		Estate:     &estate,
+		Tenant:     "default",
+		Attributes: []byte(`{}`),
+		CreatedAt:  time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+}
+
+func TestExportUsersPages(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	repo := repository.NewMockRepositoryInterface(ctrl)
+	gomock.InOrder(
+		repo.EXPECT().ExportUsers(gomock.Any(), repository.ExportFilter{Tenant: "default", Limit: 2}).
+			Return([]repository.ExportUser{testExportUser("id-1", "+62856712331"), testExportUser("id-2", "+62856712332")}, nil),
+		repo.EXPECT().ExportUsers(gomock.Any(), repository.ExportFilter{Tenant: "default", After: "id-2", Limit: 2}).
+			Return([]repository.ExportUser{testExportUser("id-3", "+62856712333")}, nil),
+	)
+	s := NewServer(NewServerOptions{Repository: repo})
+
+	var buf bytes.Buffer
+	exported, err := s.ExportUsers(context.Background(), &buf, ExportOptions{
+		Columns:  []string{"phone", "id", "estate", "region", "created_at"},
+		Filter:   repository.ExportFilter{Tenant: "default"},
+		PageSize: 2,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, exported)
+	assert.Equal(t, "phone,id,estate,region,created_at\n"+
+		"'+62856712331,id-1,Riau 1,,2024-01-02T03:04:05Z\n"+
+		"'+62856712332,id-2,Riau 1,,2024-01-02T03:04:05Z\n"+
+		"'+62856712333,id-3,Riau 1,,2024-01-02T03:04:05Z\n", buf.String())
+}
+
+func TestExportUsersFullPageThenEmpty(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	repo := repository.NewMockRepositoryInterface(ctrl)
+	gomock.InOrder(
+		repo.EXPECT().ExportUsers(gomock.Any(), repository.ExportFilter{Limit: 1}).Return([]repository.ExportUser{testExportUser("id-1", "+62856712331")}, nil),
+		repo.EXPECT().ExportUsers(gomock.Any(), repository.ExportFilter{After: "id-1", Limit: 1}).Return(nil, nil),
+	)
+	s := NewServer(NewServerOptions{Repository: repo})
+
+	var buf bytes.Buffer
+	exported, err := s.ExportUsers(context.Background(), &buf, ExportOptions{Format: export.FormatJSONL, PageSize: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, exported)
+	assert.Equal(t, "{\"id\":\"id-1\",\"phone\":\"+62856712331\",\"name\":\"Budi Santoso\",\"version\":1,\"email\":null,\"email_verified_at\":null,"+
+		"\"preferred_language\":null,\"avatar_url\":null,\"date_of_birth\":null,\"address\":null,\"estate\":\"Riau 1\",\"region\":null,"+
+		"\"tenant\":\"default\",\"attributes\":{},\"otp_login_enabled\":false,\"phone_verified_at\":null,\"created_at\":\"2024-01-02T03:04:05Z\",\"updated_at\":null}\n", buf.String())
+}
+
+func TestExportUsersOptions(t *testing.T) {
+	s := NewServer(NewServerOptions{Repository: repository.NewMockRepositoryInterface(gomock.NewController(t))})
+
+	tests := []struct {
+		name    string
+		opts    ExportOptions
+		message string
+	}{
+		{
+			name:    "Unsupported format",
+			opts:    ExportOptions{Format: "xlsx"},
+			message: "Invalid format. Format must be csv, jsonl or parquet",
+		}, {
+			name:    "Secret column",
+			opts:    ExportOptions{Columns: []string{"id", "password"}},
+			message: "Invalid column password. Columns must be id, phone, name, version, email, email_verified_at, preferred_language, avatar_url, date_of_birth, address, estate, region, tenant, attributes, otp_login_enabled, phone_verified_at, created_at, updated_at",
+		}, {
+			name:    "Duplicate column",
+			opts:    ExportOptions{Columns: []string{"id", " id"}},
+			message: "Duplicate column id",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			_, err := s.ExportUsers(context.Background(), &buf, tt.opts)
+			var optionsErr *ExportOptionsError
+			assert.ErrorAs(t, err, &optionsErr)
+			assert.Equal(t, tt.message, optionsErr.Message)
+			assert.Empty(t, buf.String())
+		})
+	}
+}
+
+func TestGetUsersExport(t *testing.T) {
+	exporter, _, err := oauth.NewClient(oauth.NewClientOptions{Name: "analytics", Scopes: []string{oauth.ScopeUsersExport}})
+	assert.NoError(t, err)
+	reader, _, err := oauth.NewClient(oauth.NewClientOptions{Name: "billing", Scopes: []string{oauth.ScopeUsersRead}})
+	assert.NoError(t, err)
+	exportToken, _ := createClientToken(exporter.ID, exporter.Scopes, time.Now().Add(time.Hour))
+	readToken, _ := createClientToken(reader.ID, reader.Scopes, time.Now().Add(time.Hour))
+	parquet := export.FormatParquet
+	columns := "id,phone"
+	xlsx := "xlsx"
+	region := "Sumatra"
+
+	tests := []struct {
+		name        string
+		prepare     func(repo *repository.MockRepositoryInterface)
+		token       string
+		params      generated.GetUsersExportParams
+		status      int
+		contentType string
+		content     string
+	}{
+		{
+			name: "CSV",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindOAuthClient(gomock.Any(), exporter.ID).Return(exporter, nil)
+				repo.EXPECT().ExportUsers(gomock.Any(), repository.ExportFilter{Region: region, Limit: exportPageSize}).
+					Return([]repository.ExportUser{testExportUser("id-1", "+62856712331")}, nil)
+			},
+			token:       exportToken,
+			params:      generated.GetUsersExportParams{Columns: &columns, Region: &region},
+			status:      http.StatusOK,
+			contentType: "text/csv",
+			content:     "id,phone\nid-1,'+62856712331\n",
+		}, {
+			name: "Parquet",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindOAuthClient(gomock.Any(), exporter.ID).Return(exporter, nil)
+				repo.EXPECT().ExportUsers(gomock.Any(), gomock.Any()).Return([]repository.ExportUser{testExportUser("id-1", "+62856712331")}, nil)
+			},
+			token:       exportToken,
+			params:      generated.GetUsersExportParams{Format: &parquet},
+			status:      http.StatusOK,
+			contentType: "application/vnd.apache.parquet",
+		}, {
+			name: "Invalid format",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindOAuthClient(gomock.Any(), exporter.ID).Return(exporter, nil)
+			},
+			token:   exportToken,
+			params:  generated.GetUsersExportParams{Format: &xlsx},
+			status:  http.StatusBadRequest,
+			content: "{\"message\":\"Invalid format. Format must be csv, jsonl or parquet\"}\n",
+		}, {
+			name: "Error before the first page",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindOAuthClient(gomock.Any(), exporter.ID).Return(exporter, nil)
+				repo.EXPECT().ExportUsers(gomock.Any(), gomock.Any()).Return(nil, errors.New("connection refused"))
+			},
+			token:   exportToken,
+			status:  http.StatusInternalServerError,
+			content: "{\"message\":\"Internal Server Error\"}\n",
+		}, {
+			name:   "Client without export scope",
+			token:  readToken,
+			status: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := repository.NewMockRepositoryInterface(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(repo)
+			}
+			s := NewServer(NewServerOptions{Repository: repo})
+
+			req := httptest.NewRequest(http.MethodGet, "/users/export", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+
+			err := s.GetUsersExport(echo.New().NewContext(req, rec), tt.params)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.status, rec.Code)
+			if tt.contentType != "" {
+				assert.Equal(t, tt.contentType, rec.Header().Get("Content-Type"))
+				assert.True(t, strings.HasPrefix(rec.Header().Get("Content-Disposition"), "attachment; filename=\"users."))
+			}
+			if tt.content != "" {
+				assert.Equal(t, tt.content, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetUsersExportAbortsAfterFirstPage(t *testing.T) {
+	exporter, _, err := oauth.NewClient(oauth.NewClientOptions{Name: "analytics", Scopes: []string{oauth.ScopeUsersExport}})
+	assert.NoError(t, err)
+	token, _ := createClientToken(exporter.ID, exporter.Scopes, time.Now().Add(time.Hour))
+
+	ctrl := gomock.NewController(t)
+	repo := repository.NewMockRepositoryInterface(ctrl)
+	repo.EXPECT().FindOAuthClient(gomock.Any(), exporter.ID).Return(exporter, nil)
+	page := make([]repository.ExportUser, exportPageSize)
+	for i := range page {
+		page[i] = testExportUser("id", "+62856712331")
+	}
+	gomock.InOrder(
+		repo.EXPECT().ExportUsers(gomock.Any(), gomock.Any()).Return(page, nil),
+		repo.EXPECT().ExportUsers(gomock.Any(), gomock.Any()).Return(nil, errors.New("connection reset")),
+	)
+	s := NewServer(NewServerOptions{Repository: repo})
+
+	req := httptest.NewRequest(http.MethodGet, "/users/export", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		s.GetUsersExport(echo.New().NewContext(req, rec), generated.GetUsersExportParams{})
+	})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, rec.Flushed)
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"context"
+	"errors"
+
+	"github.com/SawitProRecruitment/UserService/generated/userpb"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// grpcService : gRPC interface of the server, business rules are shared with the REST handlers
+type grpcService struct {
+	userpb.UnimplementedUserServiceServer
+	server *Server
+}
+
+// GRPCService : gRPC user service backed by the server, register it on a grpc.Server with GRPCAuthInterceptor
+func (s *Server) GRPCService() userpb.UserServiceServer {
+	return &grpcService{server: s}
+}
+
+// Register : register new user
+func (g *grpcService) Register(ctx context.Context, req *userpb.RegisterRequest) (*userpb.RegisterResponse, error) {
+	id, err := g.server.Users.Register(ctx, req.Phone, req.Name, req.Password)
+	if err != nil {
+		return nil, registrationError(err)
+	}
+	return &userpb.RegisterResponse{Id: id}, nil
+}
+
+// Login : login with phone number or email and password, returning jwt token
+func (g *grpcService) Login(ctx context.Context, req *userpb.LoginRequest) (*userpb.LoginResponse, error) {
+	var phone, email *string
+	switch identifier := req.Identifier.(type) {
+	case *userpb.LoginRequest_Phone:
+		phone = &identifier.Phone
+	case *userpb.LoginRequest_Email:
+		email = &identifier.Email
+	}
+
+	result, err := g.server.Users.Login(ctx, service.LoginInput{Phone: phone, Email: email, Password: req.Password})
+	if err != nil {
+		return nil, serviceError(err, "Internal Server Error")
+	}
+	return &userpb.LoginResponse{Token: result.Token, Phone: result.User.Phone}, nil
+}
+
+// GetProfile : profile of the user of the token
+func (g *grpcService) GetProfile(ctx context.Context, req *userpb.GetProfileRequest) (*userpb.Profile, error) {
+	user, err := g.server.Users.GetUser(ctx, grpcUserID(ctx))
+	if errors.Is(err, service.ErrUserNotFound) {
+		return nil, status.Error(codes.NotFound, "User not found")
+	}
+	if err != nil {
+		return nil, serviceError(err, "Internal Server Error")
+	}
+	return toProfileMessage(user)
+}
+
+// UpdateProfile : update profile of the user of the token, absent fields keep their value
+func (g *grpcService) UpdateProfile(ctx context.Context, req *userpb.UpdateProfileRequest) (*userpb.UpdateProfileResponse, error) {
+	var attributes *map[string]interface{}
+	if req.Attributes != nil {
+		value := req.Attributes.AsMap()
+		attributes = &value
+	}
+
+	version, err := g.server.Users.UpdateProfile(ctx, service.ProfileUpdate{
+		UserID: grpcUserID(ctx),
+		Fields: map[string]*string{
+			"phone":              req.Phone,
+			"name":               req.Name,
+			"email":              req.Email,
+			"preferred_language": req.PreferredLanguage,
+			"avatar_url":         req.AvatarUrl,
+			"date_of_birth":      req.DateOfBirth,
+			"address":            req.Address,
+			"estate":             req.Estate,
+			"region":             req.Region,
+		},
+		Attributes:   attributes,
+		Precondition: ifMatchPrecondition(req.IfMatch),
+	})
+	if err != nil {
+		return nil, serviceError(err, "Error when registering user")
+	}
+	return &userpb.UpdateProfileResponse{Etag: formatETag(version)}, nil
+}
+
+// ValidateToken : tell whether the token is active, same rules as OAuth token introspection
+func (g *grpcService) ValidateToken(ctx context.Context, req *userpb.ValidateTokenRequest) (*userpb.ValidateTokenResponse, error) {
+	if req.Token == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	resp, err := g.server.introspect(ctx, req.Token)
+	if err != nil {
+		return nil, err
+	}
+	active, _ := resp["active"].(bool)
+	if !active {
+		return &userpb.ValidateTokenResponse{}, nil
+	}
+
+	result := &userpb.ValidateTokenResponse{Active: true}
+	result.Sub, _ = resp["sub"].(string)
+	result.ClientId, _ = resp["client_id"].(string)
+	result.Scope, _ = resp["scope"].(string)
+	result.OrgId, _ = resp["org_id"].(string)
+	result.Exp, _ = resp["exp"].(int64)
+	return result, nil
+}
+
+// toProfileMessage : build gRPC response of the user profile
+func toProfileMessage(user repository.User) (*userpb.Profile, error) {
+	profile := toUserProfile(user)
+	message := &userpb.Profile{
+		Phone:             user.Phone,
+		Name:              user.Name,
+		Email:             profile.Email,
+		PreferredLanguage: profile.PreferredLanguage,
+		AvatarUrl:         profile.AvatarUrl,
+		DateOfBirth:       profile.DateOfBirth,
+		Address:           profile.Address,
+		Estate:            profile.Estate,
+		Region:            profile.Region,
+		Etag:              formatETag(user.Version),
+	}
+	if profile.Attributes != nil {
+		attributes, err := structpb.NewStruct(*profile.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		message.Attributes = attributes
+	}
+	return message, nil
+}
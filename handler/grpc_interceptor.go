@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated/userpb"
+	"github.com/SawitProRecruitment/UserService/oauth"
+	"github.com/SawitProRecruitment/UserService/ratelimit"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/labstack/gommon/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// grpcAuth : token a gRPC method requires
+type grpcAuth struct {
+	// Public : the method needs no token
+	Public bool
+	// UserScope : the method needs a user token, personal access tokens are accepted when they are granted this scope
+	UserScope string
+	// ClientScope : the method needs a client access token granted this scope
+	ClientScope string
+}
+
+// grpcMethodAuth : authentication of every gRPC method, methods not listed are rejected
+var grpcMethodAuth = map[string]grpcAuth{
+	userpb.UserService_Register_FullMethodName:      {Public: true},
+	userpb.UserService_Login_FullMethodName:         {Public: true},
+	userpb.UserService_GetProfile_FullMethodName:    {UserScope: scopeProfileRead},
+	userpb.UserService_UpdateProfile_FullMethodName: {UserScope: scopeProfileWrite},
+	userpb.UserService_ValidateToken_FullMethodName: {ClientScope: oauth.ScopeTokensIntrospect},
+}
+
+// grpcRateLimitRoutes : REST route whose rate limit rules apply to the gRPC method too, both take from the same buckets
+var grpcRateLimitRoutes = map[string]string{
+	userpb.UserService_Register_FullMethodName: "POST /registration",
+	userpb.UserService_Login_FullMethodName:    "POST /login",
+}
+
+// grpcContextKey : key of the values the auth interceptor adds to the context
+type grpcContextKey int
+
+const grpcUserIDKey grpcContextKey = iota
+
+// grpcUserID : id of the user authenticated by GRPCAuthInterceptor
+func grpcUserID(ctx context.Context) string {
+	id, _ := ctx.Value(grpcUserIDKey).(string)
+	return id
+}
+
+// grpcBearerToken : token of the authorization metadata
+func grpcBearerToken(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(values[0], "Bearer ")
+}
+
+// GRPCAuthInterceptor : check the token of the authorization metadata against the requirement of the method
+func (s *Server) GRPCAuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	auth, ok := grpcMethodAuth[info.FullMethod]
+	if !ok {
+		return nil, status.Error(codes.PermissionDenied, "Forbidden code")
+	}
+
+	switch {
+	case auth.Public:
+	case auth.ClientScope != "":
+		if _, err := s.authenticateClientToken(ctx, grpcBearerToken(ctx), auth.ClientScope); err != nil {
+			log.Error(err)
+			return nil, status.Error(codes.Unauthenticated, "Invalid bearer token")
+		}
+	default:
+		id, err := s.authenticateToken(ctx, grpcBearerToken(ctx), auth.UserScope)
+		if err != nil {
+			log.Error(err)
+			return nil, status.Error(codes.Unauthenticated, "Invalid bearer token")
+		}
+		ctx = context.WithValue(ctx, grpcUserIDKey, id)
+	}
+	return handler(ctx, req)
+}
+
+// GRPCRateLimitInterceptor : limit calls with the x-rate-limit rules of the REST route of the method, calls over the limit get ResourceExhausted
+func (s *Server) GRPCRateLimitInterceptor(store ratelimit.Store, spec *openapi3.T) (grpc.UnaryServerInterceptor, error) {
+	rules, err := rateLimitRules(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		methodRules := rules[grpcRateLimitRoutes[info.FullMethod]]
+		if len(methodRules) == 0 {
+			return handler(ctx, req)
+		}
+
+		_, denied := takeRateLimit(ctx, store, methodRules, func(key string) (string, bool) {
+			return s.grpcRateLimitIdentity(ctx, req, key)
+		})
+		if denied != nil {
+			grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(ceilSeconds(denied.RetryAfter))))
+			return nil, status.Error(codes.ResourceExhausted, "Too many requests, please try again later")
+		}
+		return handler(ctx, req)
+	}, nil
+}
+
+// grpcRateLimitIdentity : value the bucket is kept for, the same as the REST request would have
+func (s *Server) grpcRateLimitIdentity(ctx context.Context, req interface{}, key string) (string, bool) {
+	switch key {
+	case "ip":
+		client, ok := peer.FromContext(ctx)
+		if !ok {
+			return "", false
+		}
+		host, _, err := net.SplitHostPort(client.Addr.String())
+		if err != nil {
+			return client.Addr.String(), true
+		}
+		return host, true
+	case "user":
+		tokenString := grpcBearerToken(ctx)
+		if strings.HasPrefix(tokenString, personalAccessTokenPrefix) {
+			return "pat:" + hashPersonalAccessToken(tokenString), true
+		}
+		id, err := userIDOfToken(tokenString)
+		return id, err == nil
+	case "phone":
+		// Login with email has no phone, like a REST request without phone member
+		withPhone, ok := req.(interface{ GetPhone() string })
+		if !ok || withPhone.GetPhone() == "" {
+			return "", false
+		}
+		return s.rateLimitPhone(withPhone.GetPhone()), true
+	}
+	return "", false
+}
+
+// GRPCLoggingInterceptor : log method, status code and duration of every gRPC call
+func GRPCLoggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	log.Infof("grpc %s %s %s", info.FullMethod, status.Code(err), time.Since(start))
+	return resp, err
+}
+
+// GRPCErrorInterceptor : convert errors of the shared business logic to gRPC status, unexpected errors are logged and hidden
+func GRPCErrorInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if err == nil {
+		return resp, nil
+	}
+	return nil, grpcError(err)
+}
+
+// grpcError : gRPC status of the error, the message of request errors is kept
+func grpcError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		return status.Error(grpcCode(reqErr.Status), reqErr.Message)
+	}
+	if errors.Is(err, context.Canceled) {
+		return status.Error(codes.Canceled, err.Error())
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+
+	log.Error(err)
+	return status.Error(codes.Internal, "Internal Server Error")
+}
+
+// grpcCode : gRPC status code closest to the HTTP status of the REST interface
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusInternalServerError:
+		return codes.Internal
+	default:
+		return codes.Unknown
+	}
+}
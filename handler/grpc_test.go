@@ -0,0 +1,431 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/generated/userpb"
+	"github.com/SawitProRecruitment/UserService/oauth"
+	"github.com/SawitProRecruitment/UserService/ratelimit"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// newGRPCTestClient : client of the gRPC service served in memory with the same interceptors as cmd/main.go
+func newGRPCTestClient(t *testing.T, s *Server) userpb.UserServiceClient {
+	listener := bufconn.Listen(1024 * 1024)
+	spec, err := generated.GetSwagger()
+	assert.NoError(t, err)
+	rateLimit, err := s.GRPCRateLimitInterceptor(ratelimit.NewMemoryStore(), spec)
+	assert.NoError(t, err)
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		GRPCLoggingInterceptor,
+		GRPCErrorInterceptor,
+		rateLimit,
+		s.GRPCAuthInterceptor,
+	))
+	userpb.RegisterUserServiceServer(grpcServer, s.GRPCService())
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return userpb.NewUserServiceClient(conn)
+}
+
+func TestGRPCUserService(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+	userID := "7f2b6c1e-0a41-4f4e-9a55-2f9e6f3b8d10"
+	userParam := repository.Param{Logic: "AND", Field: "id", Operator: "=", Value: userID}
+	userToken, _ := createToken(userID, exp)
+	gateway, _, _ := oauth.NewClient(oauth.NewClientOptions{Name: "gateway", Scopes: []string{oauth.ScopeTokensIntrospect}})
+	gatewayToken, _ := createClientToken(gateway.ID, gateway.Scopes, exp)
+	lookupToken, _ := createClientToken(gateway.ID, []string{oauth.ScopeUsersRead}, exp)
+	deactivatedAt := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	user := repository.User{
+		ID:       userID,
+		Phone:    "+62856712332",
+		Name:     "User",
+		Password: "$2a$10$Ke5Sl0ra2VeYSmmqjnlE9OLl.I1Bmc8Ou5ix7M2lrPhB6FzV8raJC",
+		Salt:     "63RDLuJv8Kmeehqgeg35FA==",
+		Version:  3,
+	}
+	email := "user@example.com"
+	newName := "New Name"
+	staleETag := `"2"`
+
+	tests := []struct {
+		name    string
+		prepare func(repo *repository.MockRepositoryInterface)
+		token   string
+		call    func(ctx context.Context, client userpb.UserServiceClient) (proto.Message, error)
+		code    codes.Code
+		message string
+		resp    proto.Message
+	}{
+		{
+			name: "Register",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().Registration(gomock.Any(), gomock.Any()).Return(repository.RegistrationOutput{ID: userID}, nil)
+			},
+			call: func(ctx context.Context, client userpb.UserServiceClient) (proto.Message, error) {
+				return client.Register(ctx, &userpb.RegisterRequest{Phone: "0856712332", Name: "User", Password: "QWErty123!@#"})
+			},
+			code: codes.OK,
+			resp: &userpb.RegisterResponse{Id: userID},
+		}, {
+			name: "Register with invalid password",
+			call: func(ctx context.Context, client userpb.UserServiceClient) (proto.Message, error) {
+				return client.Register(ctx, &userpb.RegisterRequest{Phone: "0856712332", Name: "User", Password: "short"})
+			},
+			code:    codes.InvalidArgument,
+			message: "Invalid password. Passwords must be 6 to 64 characters and contain at least 1 uppercase letter, 1 digit, and 1 special character",
+		}, {
+			name: "Register with registered phone number",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().Registration(gomock.Any(), gomock.Any()).Return(repository.RegistrationOutput{}, repository.ErrDuplicatePhone)
+			},
+			call: func(ctx context.Context, client userpb.UserServiceClient) (proto.Message, error) {
+				return client.Register(ctx, &userpb.RegisterRequest{Phone: "0856712332", Name: "User", Password: "QWErty123!@#"})
+			},
+			code:    codes.InvalidArgument,
+			message: "Phone number already exist",
+		}, {
+			name: "Register database error",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().Registration(gomock.Any(), gomock.Any()).Return(repository.RegistrationOutput{}, fmt.Errorf("error"))
+			},
+			call: func(ctx context.Context, client userpb.UserServiceClient) (proto.Message, error) {
+				return client.Register(ctx, &userpb.RegisterRequest{Phone: "0856712332", Name: "User", Password: "QWErty123!@#"})
+			},
+			code:    codes.Internal,
+			message: "Error when registering user",
+		}, {
+			name: "Login with phone number",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindUser(gomock.Any(), repository.Param{Logic: "AND", Field: "phone", Operator: "=", Value: "+62856712332"}).Return(user, nil)
+				repo.EXPECT().ListUserMemberships(gomock.Any(), userID).Return(nil, nil)
+				repo.EXPECT().IncreaseLoginAttempt(gomock.Any(), "+62856712332").Return(nil)
+			},
+			call: func(ctx context.Context, client userpb.UserServiceClient) (proto.Message, error) {
+				resp, err := client.Login(ctx, &userpb.LoginRequest{Identifier: &userpb.LoginRequest_Phone{Phone: "+62856712332"}, Password: "QWErty123!@#"})
+				if err != nil {
+					return nil, err
+				}
+				// Token is random, check it belongs to the user instead
+				id, err := userIDOfToken(resp.Token)
+				return &userpb.LoginResponse{Token: id, Phone: resp.Phone}, err
+			},
+			code: codes.OK,
+			resp: &userpb.LoginResponse{Token: userID, Phone: "+62856712332"},
+		}, {
+			name: "Login with wrong password",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(user, nil)
+			},
+			call: func(ctx context.Context, client userpb.UserServiceClient) (proto.Message, error) {
+				return client.Login(ctx, &userpb.LoginRequest{Identifier: &userpb.LoginRequest_Phone{Phone: "+62856712332"}, Password: "QWErty123!@#x"})
+			},
+			code:    codes.InvalidArgument,
+			message: "Invalid password",
+		}, {
+			name: "Login without identifier",
+			call: func(ctx context.Context, client userpb.UserServiceClient) (proto.Message, error) {
+				return client.Login(ctx, &userpb.LoginRequest{Password: "QWErty123!@#"})
+			},
+			code:    codes.InvalidArgument,
+			message: "Either phone number or email is required",
+		}, {
+			name: "Login of deactivated user",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				deactivated := user
+				deactivated.Email = &email
+				deactivated.EmailVerifiedAt = &deactivatedAt
+				deactivated.DeactivatedAt = &deactivatedAt
+				repo.EXPECT().FindVerifiedEmailUser(gomock.Any(), email).Return(deactivated, nil)
+			},
+			call: func(ctx context.Context, client userpb.UserServiceClient) (proto.Message, error) {
+				return client.Login(ctx, &userpb.LoginRequest{Identifier: &userpb.LoginRequest_Email{Email: "User@Example.com"}, Password: "QWErty123!@#"})
+			},
+			code:    codes.PermissionDenied,
+			message: "Account is deactivated",
+		}, {
+			name: "Get profile",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				withEmail := user
+				withEmail.Email = &email
+				withEmail.Attributes = map[string]interface{}{"estate_code": "KAL-01"}
+				repo.EXPECT().FindUser(gomock.Any(), userParam).Return(withEmail, nil)
+			},
+			token: userToken,
+			call: func(ctx context.Context, client userpb.UserServiceClient) (proto.Message, error) {
+				resp, err := client.GetProfile(ctx, &userpb.GetProfileRequest{})
+				if err == nil {
+					assert.Equal(t, map[string]interface{}{"estate_code": "KAL-01"}, resp.Attributes.AsMap())
+					resp.Attributes = nil
+				}
+				return resp, err
+			},
+			code: codes.OK,
+			resp: &userpb.Profile{Phone: "+62856712332", Name: "User", Email: &email, Etag: `"3"`},
+		}, {
+			name: "Get profile without token",
+			call: func(ctx context.Context, client userpb.UserServiceClient) (proto.Message, error) {
+				return client.GetProfile(ctx, &userpb.GetProfileRequest{})
+			},
+			code:    codes.Unauthenticated,
+			message: "Invalid bearer token",
+		}, {
+			name:  "Get profile with client token",
+			token: gatewayToken,
+			call: func(ctx context.Context, client userpb.UserServiceClient) (proto.Message, error) {
+				return client.GetProfile(ctx, &userpb.GetProfileRequest{})
+			},
+			code:    codes.Unauthenticated,
+			message: "Invalid bearer token",
+		}, {
+			name: "Get profile of deleted user",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindUser(gomock.Any(), userParam).Return(repository.User{}, repository.ErrNotFound)
+			},
+			token: userToken,
+			call: func(ctx context.Context, client userpb.UserServiceClient) (proto.Message, error) {
+				return client.GetProfile(ctx, &userpb.GetProfileRequest{})
+			},
+			code:    codes.NotFound,
+			message: "User not found",
+		}, {
+			name: "Update profile",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindUser(gomock.Any(), userParam).Return(user, nil)
+				repo.EXPECT().UpdateUser(gomock.Any(), repository.UpdateUser{ID: userID, Phone: "+62856712332", Name: newName, Version: 3}).Return(nil)
+			},
+			token: userToken,
+			call: func(ctx context.Context, client userpb.UserServiceClient) (proto.Message, error) {
+				return client.UpdateProfile(ctx, &userpb.UpdateProfileRequest{Name: &newName})
+			},
+			code: codes.OK,
+			resp: &userpb.UpdateProfileResponse{Etag: `"4"`},
+		}, {
+			name: "Update stale profile",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindUser(gomock.Any(), userParam).Return(user, nil)
+			},
+			token: userToken,
+			call: func(ctx context.Context, client userpb.UserServiceClient) (proto.Message, error) {
+				return client.UpdateProfile(ctx, &userpb.UpdateProfileRequest{Name: &newName, IfMatch: &staleETag})
+			},
+			code:    codes.FailedPrecondition,
+			message: "Profile has been modified",
+		}, {
+			name: "Update profile with registered email",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindUser(gomock.Any(), userParam).Return(user, nil)
+				repo.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Return(repository.ErrDuplicateEmail)
+			},
+			token: userToken,
+			call: func(ctx context.Context, client userpb.UserServiceClient) (proto.Message, error) {
+				return client.UpdateProfile(ctx, &userpb.UpdateProfileRequest{Email: &email})
+			},
+			code:    codes.AlreadyExists,
+			message: "Email already exist",
+		}, {
+			name: "Validate user token",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindOAuthClient(gomock.Any(), gateway.ID).Return(gateway, nil)
+				repo.EXPECT().FindUser(gomock.Any(), userParam).Return(user, nil)
+			},
+			token: gatewayToken,
+			call: func(ctx context.Context, client userpb.UserServiceClient) (proto.Message, error) {
+				return client.ValidateToken(ctx, &userpb.ValidateTokenRequest{Token: userToken})
+			},
+			code: codes.OK,
+			resp: &userpb.ValidateTokenResponse{Active: true, Sub: userID, Exp: exp.Unix()},
+		}, {
+			name: "Validate token of deactivated user",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				deactivated := user
+				deactivated.DeactivatedAt = &deactivatedAt
+				repo.EXPECT().FindOAuthClient(gomock.Any(), gateway.ID).Return(gateway, nil)
+				repo.EXPECT().FindUser(gomock.Any(), userParam).Return(deactivated, nil)
+			},
+			token: gatewayToken,
+			call: func(ctx context.Context, client userpb.UserServiceClient) (proto.Message, error) {
+				return client.ValidateToken(ctx, &userpb.ValidateTokenRequest{Token: userToken})
+			},
+			code: codes.OK,
+			resp: &userpb.ValidateTokenResponse{},
+		}, {
+			name: "Validate malformed token",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindOAuthClient(gomock.Any(), gateway.ID).Return(gateway, nil)
+			},
+			token: gatewayToken,
+			call: func(ctx context.Context, client userpb.UserServiceClient) (proto.Message, error) {
+				return client.ValidateToken(ctx, &userpb.ValidateTokenRequest{Token: "not-a-token"})
+			},
+			code: codes.OK,
+			resp: &userpb.ValidateTokenResponse{},
+		}, {
+			name: "Validate token with revoked client",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindOAuthClient(gomock.Any(), gateway.ID).Return(repository.OAuthClient{}, repository.ErrNotFound)
+			},
+			token: gatewayToken,
+			call: func(ctx context.Context, client userpb.UserServiceClient) (proto.Message, error) {
+				return client.ValidateToken(ctx, &userpb.ValidateTokenRequest{Token: userToken})
+			},
+			code:    codes.Unauthenticated,
+			message: "Invalid bearer token",
+		}, {
+			name:  "Validate token without introspect scope",
+			token: lookupToken,
+			call: func(ctx context.Context, client userpb.UserServiceClient) (proto.Message, error) {
+				return client.ValidateToken(ctx, &userpb.ValidateTokenRequest{Token: userToken})
+			},
+			code:    codes.Unauthenticated,
+			message: "Invalid bearer token",
+		}, {
+			name:  "Validate token with user token",
+			token: userToken,
+			call: func(ctx context.Context, client userpb.UserServiceClient) (proto.Message, error) {
+				return client.ValidateToken(ctx, &userpb.ValidateTokenRequest{Token: userToken})
+			},
+			code:    codes.Unauthenticated,
+			message: "Invalid bearer token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := repository.NewMockRepositoryInterface(ctrl)
+			if tt.token == userToken {
+				expectActiveUser(repo, userID)
+			}
+			if tt.prepare != nil {
+				tt.prepare(repo)
+			}
+			s := NewServer(NewServerOptions{Repository: repo})
+			client := newGRPCTestClient(t, s)
+
+			ctx := context.Background()
+			if tt.token != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+tt.token)
+			}
+			resp, err := tt.call(ctx, client)
+
+			assert.Equal(t, tt.code, status.Code(err))
+			if tt.code != codes.OK {
+				assert.Equal(t, tt.message, status.Convert(err).Message())
+				return
+			}
+			assert.True(t, proto.Equal(tt.resp, resp), "got %v", resp)
+		})
+	}
+}
+
+func TestGRPCError(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		code    codes.Code
+		message string
+	}{
+		{
+			name:    "Request error",
+			err:     &requestError{Status: 409, Message: "Phone number already exist"},
+			code:    codes.AlreadyExists,
+			message: "Phone number already exist",
+		}, {
+			name:    "Wrapped request error",
+			err:     fmt.Errorf("update: %w", &requestError{Status: 412, Message: "Profile has been modified"}),
+			code:    codes.FailedPrecondition,
+			message: "Profile has been modified",
+		}, {
+			name:    "Status is kept",
+			err:     status.Error(codes.NotFound, "User not found"),
+			code:    codes.NotFound,
+			message: "User not found",
+		}, {
+			name:    "Canceled",
+			err:     fmt.Errorf("find user: %w", context.Canceled),
+			code:    codes.Canceled,
+			message: "find user: context canceled",
+		}, {
+			name:    "Unexpected error is hidden",
+			err:     errors.New("pq: connection refused"),
+			code:    codes.Internal,
+			message: "Internal Server Error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := grpcError(tt.err)
+			assert.Equal(t, tt.code, status.Code(err))
+			assert.Equal(t, tt.message, status.Convert(err).Message())
+		})
+	}
+}
+
+func TestGRPCRateLimitInterceptor(t *testing.T) {
+	store := ratelimit.NewMemoryStore()
+	s := NewServer(NewServerOptions{})
+	interceptor, err := s.GRPCRateLimitInterceptor(store, loadRateLimitSpec(t, rateLimitTestSpec))
+	assert.NoError(t, err)
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 12345}})
+	handled := 0
+	call := func(method string, req interface{}) error {
+		_, err := interceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			handled++
+			return nil, nil
+		})
+		return err
+	}
+	phoneLogin := &userpb.LoginRequest{Identifier: &userpb.LoginRequest_Phone{Phone: "+62856712332"}}
+	emailLogin := &userpb.LoginRequest{Identifier: &userpb.LoginRequest_Email{Email: "user@example.com"}}
+
+	// REST and gRPC login take from the same phone bucket, 2 per minute
+	rec := serveRateLimit(newRateLimitEcho(t, store), http.MethodPost, "/login", "10.0.0.9", `{"phone": "+62856712332"}`, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, call(userpb.UserService_Login_FullMethodName, phoneLogin))
+	err = call(userpb.UserService_Login_FullMethodName, phoneLogin)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// Email login is only limited by the peer address, 3 per minute
+	assert.NoError(t, call(userpb.UserService_Login_FullMethodName, emailLogin))
+	err = call(userpb.UserService_Login_FullMethodName, emailLogin)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, 2, handled)
+
+	// Methods without REST rules are not limited
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, call(userpb.UserService_GetProfile_FullMethodName, &userpb.GetProfileRequest{}))
+	}
+	assert.Equal(t, 7, handled)
+}
@@ -1,83 +1,66 @@
 package handler
 
 import (
-	"crypto/rand"
-	"encoding/base64"
+	"context"
+	"errors"
 	"fmt"
+	"github.com/SawitProRecruitment/UserService/service"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/labstack/echo/v4"
-	"golang.org/x/crypto/bcrypt"
-	"regexp"
+	"github.com/labstack/gommon/log"
+	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
 
 var secret = []byte("33cfdeb6-a200-483d-84c8-ac0242682a40") // Todo : move this to config file or env variable or database
-func isValidPhoneNumber(phoneNumber string) bool {
-	// Phone numbers must start with "+62" and be 10 to 13 characters in total
-	re := regexp.MustCompile(`^\+62\d{9,11}$`)
-	return re.MatchString(phoneNumber)
-}
-
-func isValidPassword(password string) bool {
-	// Check length
-	if len(password) < 6 || len(password) > 64 {
-		return false
-	}
 
-	// Define regex patterns
-	uppercasePattern := `[A-Z]`
-	numberPattern := `[0-9]`
-	specialCharPattern := `[^a-zA-Z0-9]`
+const emailVerificationPurpose = "email_verification"
 
-	// Compile the regular expressions
-	uppercaseRegex := regexp.MustCompile(uppercasePattern)
-	numberRegex := regexp.MustCompile(numberPattern)
-	specialCharRegex := regexp.MustCompile(specialCharPattern)
+// invalidCredentialsMessage : login error when enumeration protection is enabled, same for unknown user and wrong password
+const invalidCredentialsMessage = "Invalid phone number, email or password"
 
-	// Check for at least one uppercase letter
-	if !uppercaseRegex.MatchString(password) {
-		return false
-	}
+// requestError : failure of a request shown to the client, shared by the REST and gRPC interfaces, Status is the HTTP status
+type requestError struct {
+	Status  int
+	Message string
+}
 
-	// Check for at least one number
-	if !numberRegex.MatchString(password) {
-		return false
-	}
+func (e *requestError) Error() string {
+	return e.Message
+}
 
-	// Check for at least one special character
-	if !specialCharRegex.MatchString(password) {
-		return false
+// respondError : JSON response of the error, unexpected errors are logged and hidden behind a generic message
+func respondError(ctx echo.Context, err error) error {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		return ctx.JSON(reqErr.Status, map[string]string{"message": reqErr.Message})
 	}
-
-	// All conditions passed
-	return true
+	log.Error(err)
+	return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
 }
 
-func generateRandomSalt() (string, error) {
-	randomBytes := make([]byte, 16)
-	_, err := rand.Read(randomBytes)
-	if err != nil {
-		return "", err
-	}
-	return base64.StdEncoding.EncodeToString(randomBytes), nil
+func createToken(id string, exp time.Time) (string, error) {
+	return createOrganizationToken(id, "", exp)
 }
 
-func hashPassword(password, salt string) (string, error) {
-	passwordWithSalt := []byte(password + salt)
-	hash, err := bcrypt.GenerateFromPassword(passwordWithSalt, bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
+// createOrganizationToken : create token of the user with the active organization in the org_id claim, omitted when empty
+func createOrganizationToken(id string, organizationID string, exp time.Time) (string, error) {
+	claims := jwt.MapClaims{
+		"id":  id,
+		"exp": exp.Unix(), // Token expires in 1 hour
+	}
+	if organizationID != "" {
+		claims["org_id"] = organizationID
 	}
-	return string(hash), nil
+	return signToken(claims)
 }
 
-func createToken(id string, exp time.Time) (string, error) {
+// signToken : sign claims with the service secret, shared by every token the service issues
+func signToken(claims jwt.MapClaims) (string, error) {
 	// Create a new token object, specifying the signing method and the claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":  id,
-		"exp": exp.Unix(), // Token expires in 1 hour
-	})
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	// Sign and get the complete encoded token as a string
 	tokenString, err := token.SignedString(secret)
@@ -88,6 +71,26 @@ func createToken(id string, exp time.Time) (string, error) {
 	return tokenString, nil
 }
 
+// parseToken : parse and validate token signed by signToken
+func parseToken(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		// Validate the signing method
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return secret, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return claims, nil
+}
+
 // Todo : this should be on middleware, but still don't know how to generate code using deepmap open api codegen with jwt auth support
 func validateToken(ctx echo.Context) (string, error) {
 	// Get authorization header
@@ -98,29 +101,138 @@ func validateToken(ctx echo.Context) (string, error) {
 
 	// Extract the token from the Authorization header
 	tokenString := strings.Replace(authorization, "Bearer ", "", 1)
+	return userIDOfToken(tokenString)
+}
 
+// userIDOfToken : id of the user of login token, shared by the REST and gRPC authentication
+func userIDOfToken(tokenString string) (string, error) {
 	// Parse the token
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return "", err
+	}
+
+	// Purpose specific tokens such as email verification must not be used as access token
+	if _, ok := claims["purpose"]; ok {
+		return "", fmt.Errorf("token cannot be used for authentication")
+	}
+
+	return claims["id"].(string), nil
+}
+
+// formatETag : build strong ETag value from user version
+func formatETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// matchETag : check if If-Match header value contains the ETag of given version, "*" match any version
+func matchETag(ifMatch string, version int) bool {
+	etag := formatETag(version)
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// createEmailVerificationToken : create signed token used in email verification link
+func createEmailVerificationToken(id, email string, exp time.Time) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"id":      id,
+		"email":   email,
+		"purpose": emailVerificationPurpose,
+		"exp":     exp.Unix(),
+	})
+	return token.SignedString(secret)
+}
+
+// parseEmailVerificationToken : validate email verification token and return the user id and email it was issued for
+func parseEmailVerificationToken(tokenString string) (id, email string, err error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Validate the signing method
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 		return secret, nil
 	})
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	// Check token validity
-	if !token.Valid {
-		return "", fmt.Errorf("invalid token")
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["purpose"] != emailVerificationPurpose {
+		return "", "", fmt.Errorf("invalid email verification token")
 	}
 
-	// Extract claims
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return "", fmt.Errorf("invalid token claims")
+	id, _ = claims["id"].(string)
+	email, _ = claims["email"].(string)
+	if id == "" || email == "" {
+		return "", "", fmt.Errorf("invalid email verification token claims")
 	}
+	return id, email, nil
+}
 
-	return claims["id"].(string), nil
+// serviceError : request error of the typed errors of the user service, unexpected errors are logged and hidden behind the fallback message
+func serviceError(err error, fallback string) error {
+	var validationErr *service.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return &requestError{Status: http.StatusBadRequest, Message: validationErr.Message}
+	case errors.Is(err, service.ErrDuplicatePhone):
+		return &requestError{Status: http.StatusConflict, Message: "Phone number already exist"}
+	case errors.Is(err, service.ErrDuplicateEmail):
+		return &requestError{Status: http.StatusConflict, Message: "Email already exist"}
+	case errors.Is(err, service.ErrUserNotFound):
+		return &requestError{Status: http.StatusBadRequest, Message: "User not found"}
+	case errors.Is(err, service.ErrInvalidPassword):
+		return &requestError{Status: http.StatusBadRequest, Message: "Invalid password"}
+	case errors.Is(err, service.ErrInvalidCredentials):
+		return &requestError{Status: http.StatusBadRequest, Message: invalidCredentialsMessage}
+	case errors.Is(err, service.ErrEmailNotVerified):
+		return &requestError{Status: http.StatusBadRequest, Message: "Email is not verified"}
+	case errors.Is(err, service.ErrUserDeactivated):
+		return &requestError{Status: http.StatusForbidden, Message: "Account is deactivated"}
+	case errors.Is(err, service.ErrProfileModified):
+		return &requestError{Status: http.StatusPreconditionFailed, Message: "Profile has been modified"}
+	case errors.Is(err, service.ErrInvalidOTP):
+		return &requestError{Status: http.StatusBadRequest, Message: "Invalid or expired OTP"}
+	case errors.Is(err, service.ErrOTPLoginDisabled):
+		return &requestError{Status: http.StatusBadRequest, Message: "OTP login is not enabled for this account"}
+	case errors.Is(err, service.ErrTooManyOTPRequests):
+		return &requestError{Status: http.StatusTooManyRequests, Message: "Too many OTP requests, please try again later"}
+	case errors.Is(err, service.ErrEmailNotSet):
+		return &requestError{Status: http.StatusBadRequest, Message: "Email is not set"}
+	case errors.Is(err, service.ErrEmailAlreadyVerified):
+		return &requestError{Status: http.StatusBadRequest, Message: "Email already verified"}
+	case errors.Is(err, service.ErrInvalidVerificationLink):
+		return &requestError{Status: http.StatusBadRequest, Message: "Invalid or expired verification link"}
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return err
+	}
+	log.Error(err)
+	return &requestError{Status: http.StatusInternalServerError, Message: fallback}
+}
+
+// registrationError : request error of failed registration, a registered phone number is a bad request as it always was
+func registrationError(err error) error {
+	if errors.Is(err, service.ErrDuplicatePhone) {
+		return &requestError{Status: http.StatusBadRequest, Message: "Phone number already exist"}
+	}
+	return serviceError(err, "Error when registering user")
+}
+
+// jwtTokenIssuer : issue user and email verification tokens of the user service as jwt signed with the server secret
+type jwtTokenIssuer struct{}
+
+func (jwtTokenIssuer) IssueUserToken(userID string, organizationID string, exp time.Time) (string, error) {
+	return createOrganizationToken(userID, organizationID, exp)
+}
+
+func (jwtTokenIssuer) IssueEmailVerificationToken(userID string, email string, exp time.Time) (string, error) {
+	return createEmailVerificationToken(userID, email, exp)
+}
+
+func (jwtTokenIssuer) ParseEmailVerificationToken(token string) (string, string, error) {
+	return parseEmailVerificationToken(token)
 }
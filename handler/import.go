@@ -0,0 +1,345 @@
+package handler
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/notification"
+	"github.com/SawitProRecruitment/UserService/oauth"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+const (
+	// importBatchSize : rows registered in one transaction
+	importBatchSize = 100
+	// maxImportRows : rows read from one file, the rest is reported as failed
+	maxImportRows = 10000
+	// activationOTPTTL : how long the login code sent to imported users without password can be used
+	activationOTPTTL = 72 * time.Hour
+)
+
+// ImportOptions : options of ImportUsers
+type ImportOptions struct {
+	// DryRun only validates the rows, nothing is registered
+	DryRun bool
+	// ActivationOTP registers rows without password with OTP login enabled and sends them a login code by SMS
+	ActivationOTP bool
+	// BatchSize is the rows registered in one transaction, default importBatchSize
+	BatchSize int
+}
+
+// ImportHeaderError : the CSV cannot be imported because of its header, the message can be shown to the user
+type ImportHeaderError struct {
+	Message string
+}
+
+func (e *ImportHeaderError) Error() string {
+	return e.Message
+}
+
+// importRow : row that passed validation, waiting for its batch
+type importRow struct {
+	line     int
+	phone    string
+	name     string
+	password string
+}
+
+// importer : state of one import, rows are collected into batches as the CSV is read
+type importer struct {
+	server  *Server
+	opts    ImportOptions
+	report  generated.ImportReport
+	batch   []importRow
+	seen    map[string]int
+	columns map[string]int
+}
+
+// PostUsersImport : this handler is for registering users in bulk from CSV uploaded by an admin client
+func (s *Server) PostUsersImport(ctx echo.Context, params generated.PostUsersImportParams) error {
+	_, err := s.authenticateClient(ctx, oauth.ScopeUsersImport)
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
+	}
+
+	opts := ImportOptions{}
+	if params.DryRun != nil {
+		opts.DryRun = *params.DryRun
+	}
+	if params.ActivationOtp != nil {
+		opts.ActivationOTP = *params.ActivationOtp
+	}
+
+	report, err := s.ImportUsers(ctx.Request().Context(), ctx.Request().Body, opts)
+	var headerErr *ImportHeaderError
+	if errors.As(err, &headerErr) {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": headerErr.Message})
+	}
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+	return ctx.JSON(http.StatusOK, report)
+}
+
+// ImportUsers : register users from CSV with the same rules as PostRegistration, used by the API and the admin CLI
+func (s *Server) ImportUsers(ctx context.Context, r io.Reader, opts ImportOptions) (generated.ImportReport, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = importBatchSize
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return generated.ImportReport{}, &ImportHeaderError{Message: "The CSV is empty"}
+	}
+	if err != nil {
+		return generated.ImportReport{}, &ImportHeaderError{Message: fmt.Sprintf("Invalid CSV header. %v", err)}
+	}
+
+	imp := &importer{
+		server: s,
+		opts:   opts,
+		report: generated.ImportReport{DryRun: opts.DryRun, Errors: []generated.ImportRowError{}},
+		seen:   make(map[string]int),
+	}
+	if err := imp.readHeader(header); err != nil {
+		return generated.ImportReport{}, err
+	}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			imp.report.Total++
+			imp.fail(parseErr.StartLine, "", fmt.Sprintf("Invalid CSV row. %v", parseErr.Err))
+			continue
+		}
+		if err != nil {
+			return imp.report, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		if imp.report.Total == maxImportRows {
+			imp.fail(line, "", fmt.Sprintf("Too many rows. Only the first %d rows are imported", maxImportRows))
+			break
+		}
+		imp.report.Total++
+		imp.add(line, record)
+
+		if len(imp.batch) == opts.BatchSize {
+			if err := imp.flush(ctx); err != nil {
+				return imp.report, err
+			}
+		}
+	}
+
+	if err := imp.flush(ctx); err != nil {
+		return imp.report, err
+	}
+	return imp.report, nil
+}
+
+// readHeader : find the columns by name, in any order and case, other columns are ignored
+func (imp *importer) readHeader(header []string) error {
+	imp.columns = make(map[string]int, len(header))
+	for i, column := range header {
+		// Spreadsheets often save CSV with a byte order mark
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		imp.columns[column] = i
+	}
+
+	required := []string{"phone", "name"}
+	if !imp.opts.ActivationOTP {
+		required = append(required, "password")
+	}
+	for _, column := range required {
+		if _, ok := imp.columns[column]; !ok {
+			return &ImportHeaderError{Message: fmt.Sprintf("Invalid CSV header. The header must have %s columns, missing %s", strings.Join(required, ", "), column)}
+		}
+	}
+	return nil
+}
+
+// value : value of the column in the record, empty when the record is shorter than the header
+func (imp *importer) value(record []string, column string) string {
+	i, ok := imp.columns[column]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+// add : validate the row and add it to the batch, invalid rows are reported
+func (imp *importer) add(line int, record []string) {
+	// CSV export prefix phone numbers with ' so spreadsheets do not read the + as a formula
+	phone := strings.TrimPrefix(imp.value(record, "phone"), "'")
+	phoneNumber, err := imp.server.Users.NormalizePhone(phone)
+	if err != nil {
+		imp.fail(line, phone, err.Error())
+		return
+	}
+	if previous, ok := imp.seen[phoneNumber]; ok {
+		imp.fail(line, phoneNumber, fmt.Sprintf("Duplicate phone number of line %d", previous))
+		return
+	}
+	imp.seen[phoneNumber] = line
+
+	name := imp.value(record, "name")
+	if err := service.ValidateName(name); err != nil {
+		imp.fail(line, phoneNumber, err.Error())
+		return
+	}
+
+	// Rows without password get a login code instead when activation OTP is enabled
+	password := imp.value(record, "password")
+	if password != "" || !imp.opts.ActivationOTP {
+		if err := service.ValidatePassword(password); err != nil {
+			imp.fail(line, phoneNumber, err.Error())
+			return
+		}
+	}
+
+	imp.batch = append(imp.batch, importRow{line: line, phone: phoneNumber, name: name, password: password})
+}
+
+// fail : report the row as not imported
+func (imp *importer) fail(line int, phone string, message string) {
+	rowErr := generated.ImportRowError{Row: line, Message: message}
+	if phone != "" {
+		rowErr.Phone = &phone
+	}
+	imp.report.Errors = append(imp.report.Errors, rowErr)
+	imp.report.Failed++
+}
+
+// flush : register the rows of the batch in one transaction, already registered phone numbers are reported
+func (imp *importer) flush(ctx context.Context) error {
+	if len(imp.batch) == 0 {
+		return nil
+	}
+	batch := imp.batch
+	imp.batch = nil
+
+	phones := make([]string, 0, len(batch))
+	for _, row := range batch {
+		phones = append(phones, row.phone)
+	}
+	registered, err := imp.server.Repository.FindRegisteredPhones(ctx, phones)
+	if err != nil {
+		return err
+	}
+	exists := make(map[string]bool, len(registered))
+	for _, phone := range registered {
+		exists[phone] = true
+	}
+
+	rows := make([]importRow, 0, len(batch))
+	inputs := make([]repository.RegistrationInput, 0, len(batch))
+	for _, row := range batch {
+		if exists[row.phone] {
+			imp.fail(row.line, row.phone, "Phone number already exist")
+			continue
+		}
+		rows = append(rows, row)
+		if imp.opts.DryRun {
+			continue
+		}
+
+		input, err := imp.newImportInput(row)
+		if err != nil {
+			return err
+		}
+		inputs = append(inputs, input)
+	}
+
+	if imp.opts.DryRun || len(rows) == 0 {
+		imp.report.Imported += len(rows)
+		return nil
+	}
+
+	err = imp.server.Repository.CreateUsers(ctx, inputs)
+	if err != nil {
+		// Usually a phone number registered since it was checked, the other rows can be imported again
+		log.Error(err)
+		for _, row := range rows {
+			imp.fail(row.line, row.phone, "Error when registering user, none of the users of its batch are registered")
+		}
+		return nil
+	}
+	imp.report.Imported += len(rows)
+
+	for _, row := range rows {
+		if row.password != "" {
+			continue
+		}
+		if err := imp.server.sendActivationOTP(ctx, row.phone); err != nil {
+			log.Error(err)
+			rowErr := generated.ImportRowError{Row: row.line, Phone: &row.phone, Message: "Registered, but the activation code could not be sent. The user can request a login code"}
+			imp.report.Errors = append(imp.report.Errors, rowErr)
+		}
+	}
+	return nil
+}
+
+// newImportInput : registration of the row, rows without password get a random one and login with OTP
+func (imp *importer) newImportInput(row importRow) (repository.RegistrationInput, error) {
+	password := row.password
+	if password == "" {
+		random, err := imp.server.Users.Salts.Generate()
+		if err != nil {
+			return repository.RegistrationInput{}, err
+		}
+		password = random
+	}
+
+	hashedPassword, salt, err := imp.server.Users.HashPassword(password)
+	if err != nil {
+		return repository.RegistrationInput{}, err
+	}
+
+	return repository.RegistrationInput{
+		ID:              uuid.NewString(),
+		Phone:           row.phone,
+		Name:            row.name,
+		Password:        hashedPassword,
+		Salt:            salt,
+		OTPLoginEnabled: row.password == "",
+	}, nil
+}
+
+// sendActivationOTP : send login code to imported user without password, the code can be used for activationOTPTTL
+func (s *Server) sendActivationOTP(ctx context.Context, phone string) error {
+	code, otp, err := s.Users.NewLoginOTP(phone, activationOTPTTL)
+	if err != nil {
+		return err
+	}
+	err = s.Repository.CreateLoginOTP(ctx, otp)
+	if err != nil {
+		return err
+	}
+
+	return s.SMSNotifier.Notify(ctx, notification.Message{
+		To:   phone,
+		Body: fmt.Sprintf("Your SawitPro account has been created. Login with your phone number and the code %s within %d hours, do not share it with anyone.", code, int(activationOTPTTL.Hours())),
+	})
+}
@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/notification"
+	"github.com/SawitProRecruitment/UserService/oauth"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// importErrors : line and message of every reported row
+func importErrors(report generated.ImportReport) map[int]string {
+	errs := make(map[int]string, len(report.Errors))
+	for _, rowErr := range report.Errors {
+		errs[rowErr.Row] = rowErr.Message
+	}
+	return errs
+}
+
+func TestImportUsersValidation(t *testing.T) {
+	csv := "\ufeffPhone,Name,Password\n" +
+		"0856712331,Budi Santoso,QWErty123!@#\n" +
+		"12345,Siti Aminah,QWErty123!@#\n" +
+		"+62856712331,Budi Lagi,QWErty123!@#\n" +
+		"0856712333,Al,QWErty123!@#\n" +
+		"0856712334,Dewi Lestari,weak\n" +
+		"0856712335,Agus Salim,QWErty123!@#\n" +
+		"0856712336,\"Rina \"Wati,QWErty123!@#\n"
+
+	ctrl := gomock.NewController(t)
+	repo := repository.NewMockRepositoryInterface(ctrl)
+	repo.EXPECT().FindRegisteredPhones(gomock.Any(), []string{"+62856712331", "+62856712335"}).Return([]string{"+62856712335"}, nil)
+	s := NewServer(NewServerOptions{Repository: repo})
+
+	report, err := s.ImportUsers(context.Background(), strings.NewReader(csv), ImportOptions{DryRun: true})
+	assert.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 7, report.Total)
+	assert.Equal(t, 1, report.Imported)
+	assert.Equal(t, 6, report.Failed)
+
+	errs := importErrors(report)
+	assert.Contains(t, errs[3], "Invalid phone number")
+	assert.Equal(t, "Duplicate phone number of line 2", errs[4])
+	assert.Contains(t, errs[5], "Invalid full name")
+	assert.Contains(t, errs[6], "Invalid password")
+	assert.Equal(t, "Phone number already exist", errs[7])
+	assert.Contains(t, errs[8], "Invalid CSV row")
+}
+
+func TestImportUsersBatches(t *testing.T) {
+	csv := "name,phone,password,estate\n" +
+		"Budi Santoso,0856712331,QWErty123!@#,Riau\n" +
+		"Siti Aminah,0856712332,QWErty123!@#,Riau\n" +
+		"Agus Salim,0856712333,QWErty123!@#,Jambi\n"
+
+	ctrl := gomock.NewController(t)
+	repo := repository.NewMockRepositoryInterface(ctrl)
+	gomock.InOrder(
+		repo.EXPECT().FindRegisteredPhones(gomock.Any(), []string{"+62856712331", "+62856712332"}).Return(nil, nil),
+		repo.EXPECT().CreateUsers(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, inputs []repository.RegistrationInput) error {
+			assert.Len(t, inputs, 2)
+			assert.Equal(t, "Budi Santoso", inputs[0].Name)
+			assert.Equal(t, "+62856712331", inputs[0].Phone)
+			assert.NotEmpty(t, inputs[0].ID)
+			assert.NotEqual(t, "QWErty123!@#", inputs[0].Password)
+			assert.False(t, inputs[0].OTPLoginEnabled)
+			return nil
+		}),
+		repo.EXPECT().FindRegisteredPhones(gomock.Any(), []string{"+62856712333"}).Return(nil, nil),
+		repo.EXPECT().CreateUsers(gomock.Any(), gomock.Any()).Return(errors.New("duplicate key")),
+	)
+	s := NewServer(NewServerOptions{Repository: repo})
+
+	report, err := s.ImportUsers(context.Background(), strings.NewReader(csv), ImportOptions{BatchSize: 2})
+	assert.NoError(t, err)
+	assert.False(t, report.DryRun)
+	assert.Equal(t, 3, report.Total)
+	assert.Equal(t, 2, report.Imported)
+	assert.Equal(t, 1, report.Failed)
+	assert.Contains(t, importErrors(report)[4], "Error when registering user")
+}
+
+func TestImportUsersActivationOTP(t *testing.T) {
+	csv := "phone,name,password\n" +
+		"0856712331,Budi Santoso,\n" +
+		"0856712332,Siti Aminah,QWErty123!@#\n"
+
+	ctrl := gomock.NewController(t)
+	repo := repository.NewMockRepositoryInterface(ctrl)
+	notifier := notification.NewMockNotifier(ctrl)
+	repo.EXPECT().FindRegisteredPhones(gomock.Any(), gomock.Any()).Return(nil, nil)
+	repo.EXPECT().CreateUsers(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, inputs []repository.RegistrationInput) error {
+		assert.True(t, inputs[0].OTPLoginEnabled)
+		assert.NotEmpty(t, inputs[0].Password)
+		assert.False(t, inputs[1].OTPLoginEnabled)
+		return nil
+	})
+	var stored repository.LoginOTP
+	repo.EXPECT().CreateLoginOTP(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, otp repository.LoginOTP) error {
+		stored = otp
+		assert.Equal(t, "+62856712331", otp.Phone)
+		assert.WithinDuration(t, time.Now().Add(activationOTPTTL), otp.ExpiresAt, time.Minute)
+		return nil
+	})
+	notifier.EXPECT().Notify(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, message notification.Message) error {
+		assert.Equal(t, "+62856712331", message.To)
+		code := otpCodeInMessage.FindString(message.Body)
+		assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(stored.CodeHash), []byte(code+stored.Salt)))
+		return nil
+	})
+	s := NewServer(NewServerOptions{Repository: repo, SMSNotifier: notifier})
+
+	report, err := s.ImportUsers(context.Background(), strings.NewReader(csv), ImportOptions{ActivationOTP: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Imported)
+	assert.Equal(t, 0, report.Failed)
+	assert.Empty(t, report.Errors)
+}
+
+func TestImportUsersHeader(t *testing.T) {
+	s := NewServer(NewServerOptions{Repository: repository.NewMockRepositoryInterface(gomock.NewController(t))})
+
+	_, err := s.ImportUsers(context.Background(), strings.NewReader("phone,name\n0856712331,Budi Santoso\n"), ImportOptions{DryRun: true})
+	var headerErr *ImportHeaderError
+	assert.ErrorAs(t, err, &headerErr)
+	assert.Equal(t, "Invalid CSV header. The header must have phone, name, password columns, missing password", headerErr.Message)
+
+	_, err = s.ImportUsers(context.Background(), strings.NewReader(""), ImportOptions{})
+	assert.ErrorAs(t, err, &headerErr)
+}
+
+func TestPostUsersImport(t *testing.T) {
+	importer, _, err := oauth.NewClient(oauth.NewClientOptions{Name: "onboarding", Scopes: []string{oauth.ScopeUsersImport}})
+	assert.NoError(t, err)
+	reader, _, err := oauth.NewClient(oauth.NewClientOptions{Name: "billing", Scopes: []string{oauth.ScopeUsersRead}})
+	assert.NoError(t, err)
+	importToken, _ := createClientToken(importer.ID, importer.Scopes, time.Now().Add(time.Hour))
+	readToken, _ := createClientToken(reader.ID, reader.Scopes, time.Now().Add(time.Hour))
+	dryRun := true
+
+	tests := []struct {
+		name    string
+		prepare func(repo *repository.MockRepositoryInterface)
+		token   string
+		body    string
+		status  int
+		content string
+	}{
+		{
+			name: "Dry run",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindOAuthClient(gomock.Any(), importer.ID).Return(importer, nil)
+				repo.EXPECT().FindRegisteredPhones(gomock.Any(), []string{"+62856712331"}).Return(nil, nil)
+			},
+			token:   importToken,
+			body:    "phone,name,password\n0856712331,Budi Santoso,QWErty123!@#\n",
+			status:  http.StatusOK,
+			content: "{\"dry_run\":true,\"errors\":[],\"failed\":0,\"imported\":1,\"total\":1}\n",
+		}, {
+			name: "Phone escaped by export",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindOAuthClient(gomock.Any(), importer.ID).Return(importer, nil)
+				repo.EXPECT().FindRegisteredPhones(gomock.Any(), []string{"+62856712331"}).Return(nil, nil)
+			},
+			token:   importToken,
+			body:    "phone,name,password\n'+62856712331,Budi Santoso,QWErty123!@#\n",
+			status:  http.StatusOK,
+			content: "{\"dry_run\":true,\"errors\":[],\"failed\":0,\"imported\":1,\"total\":1}\n",
+		}, {
+			name: "Invalid header",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindOAuthClient(gomock.Any(), importer.ID).Return(importer, nil)
+			},
+			token:   importToken,
+			body:    "nama,telepon\n",
+			status:  http.StatusBadRequest,
+			content: "{\"message\":\"Invalid CSV header. The header must have phone, name, password columns, missing phone\"}\n",
+		}, {
+			name:   "Client without import scope",
+			token:  readToken,
+			body:   "phone,name,password\n",
+			status: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := repository.NewMockRepositoryInterface(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(repo)
+			}
+			s := NewServer(NewServerOptions{Repository: repo})
+
+			req := httptest.NewRequest(http.MethodPost, "/users/import?dry_run=true", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "text/csv")
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+
+			err := s.PostUsersImport(echo.New().NewContext(req, rec), generated.PostUsersImportParams{DryRun: &dryRun})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.status, rec.Code)
+			if tt.content != "" {
+				assert.Equal(t, tt.content, rec.Body.String())
+			}
+
+			if tt.status == http.StatusOK {
+				var report generated.ImportReport
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+			}
+		})
+	}
+}
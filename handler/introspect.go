@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/SawitProRecruitment/UserService/oauth"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// inactiveToken : introspection response of unknown, expired or revoked tokens, nothing else is revealed about them
+var inactiveToken = map[string]interface{}{"active": false}
+
+// PostOauthIntrospect : this handler is for telling authenticated clients whether a token is active, as defined in RFC 7662
+func (s *Server) PostOauthIntrospect(ctx echo.Context) error {
+	ctx.Response().Header().Set("Cache-Control", "no-store")
+
+	client, err := s.authenticateOAuthClient(ctx)
+	if errors.Is(err, errInvalidClient) {
+		return oauthError(ctx, http.StatusUnauthorized, "invalid_client", "Invalid or missing client credentials")
+	}
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": "server_error"})
+	}
+	if !containsScope(client.Scopes, oauth.ScopeTokensIntrospect) {
+		return oauthError(ctx, http.StatusForbidden, "insufficient_scope", "Client is not allowed to introspect tokens")
+	}
+
+	token := ctx.FormValue("token")
+	if token == "" {
+		return oauthError(ctx, http.StatusBadRequest, "invalid_request", "token is required")
+	}
+
+	// token_type_hint is only an optimization in RFC 7662, every kind of token is recognized by its format
+	resp, err := s.introspect(ctx.Request().Context(), token)
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": "server_error"})
+	}
+	return ctx.JSON(http.StatusOK, resp)
+}
+
+// introspect : introspection response of the token, active only while the token, its user and its client are not revoked
+func (s *Server) introspect(ctx context.Context, token string) (map[string]interface{}, error) {
+	if strings.HasPrefix(token, personalAccessTokenPrefix) {
+		return s.introspectPersonalAccessToken(ctx, token)
+	}
+
+	// Signature and expiry are checked here, revocation below
+	claims, err := parseToken(token)
+	if err != nil {
+		return inactiveToken, nil
+	}
+	sub, _ := claims["sub"].(string)
+	clientID, _ := claims["client_id"].(string)
+	scope, _ := claims["scope"].(string)
+	organizationID, _ := claims["org_id"].(string)
+
+	switch claims["purpose"] {
+	case nil:
+		// User token from login, active while the user exists
+		sub, _ = claims["id"].(string)
+		active, err := s.userActive(ctx, sub)
+		if err != nil || !active {
+			return inactiveToken, err
+		}
+		active, err = s.memberActive(ctx, organizationID, sub)
+		if err != nil || !active {
+			return inactiveToken, err
+		}
+	case clientCredentialsPurpose:
+		sub = clientID
+		active, err := s.clientActive(ctx, clientID)
+		if err != nil || !active {
+			return inactiveToken, err
+		}
+	case oidcAccessPurpose:
+		active, err := s.clientActive(ctx, clientID)
+		if err != nil || !active {
+			return inactiveToken, err
+		}
+		active, err = s.userActive(ctx, sub)
+		if err != nil || !active {
+			return inactiveToken, err
+		}
+	default:
+		// Purpose specific tokens such as email verification links are not access tokens
+		return inactiveToken, nil
+	}
+
+	resp := map[string]interface{}{
+		"active":     true,
+		"sub":        sub,
+		"token_type": "Bearer",
+		"exp":        claimTime(claims, "exp"),
+	}
+	if iss := s.issuer(); iss != "" {
+		resp["iss"] = iss
+	}
+	if clientID != "" {
+		resp["client_id"] = clientID
+	}
+	if scope != "" {
+		resp["scope"] = scope
+	}
+	if organizationID != "" {
+		resp["org_id"] = organizationID
+	}
+	return resp, nil
+}
+
+// introspectPersonalAccessToken : personal access tokens are looked up by hash, revoked and expired tokens are not found
+func (s *Server) introspectPersonalAccessToken(ctx context.Context, token string) (map[string]interface{}, error) {
+	pat, err := s.Repository.FindPersonalAccessToken(ctx, hashPersonalAccessToken(token))
+	if errors.Is(err, repository.ErrNotFound) {
+		return inactiveToken, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp := map[string]interface{}{
+		"active":     true,
+		"sub":        pat.UserID,
+		"token_type": "Bearer",
+		"scope":      strings.Join(pat.Scopes, " "),
+		"exp":        pat.ExpiresAt.Unix(),
+		"iat":        pat.CreatedAt.Unix(),
+	}
+	if iss := s.issuer(); iss != "" {
+		resp["iss"] = iss
+	}
+	return resp, nil
+}
+
+// userActive : check the user of the token still exists and is not deactivated
+func (s *Server) userActive(ctx context.Context, id string) (bool, error) {
+	if id == "" {
+		return false, nil
+	}
+	user, err := s.Repository.FindUser(ctx, repository.Param{
+		Logic:    "AND",
+		Field:    "id",
+		Operator: "=",
+		Value:    id,
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return user.DeactivatedAt == nil, nil
+}
+
+// clientActive : check the client of the token is not revoked
+func (s *Server) clientActive(ctx context.Context, id string) (bool, error) {
+	if id == "" {
+		return false, nil
+	}
+	_, err := s.Repository.FindOAuthClient(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// memberActive : check the user is still member of the active organization of the token, tokens without one have nothing to check
+func (s *Server) memberActive(ctx context.Context, organizationID string, userID string) (bool, error) {
+	if organizationID == "" {
+		return true, nil
+	}
+	_, err := s.Repository.FindMembership(ctx, organizationID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// claimTime : numeric date claim as unix seconds, JSON numbers are decoded as float64
+func claimTime(claims jwt.MapClaims, name string) int64 {
+	value, _ := claims[name].(float64)
+	return int64(value)
+}
@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/oauth"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostOauthIntrospect(t *testing.T) {
+	gateway, secret, err := oauth.NewClient(oauth.NewClientOptions{Name: "gateway", Scopes: []string{oauth.ScopeTokensIntrospect}})
+	assert.NoError(t, err)
+	lookup, lookupSecret, err := oauth.NewClient(oauth.NewClientOptions{Name: "billing", Scopes: []string{oauth.ScopeUsersRead}})
+	assert.NoError(t, err)
+
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+	userID := "7f2b6c1e-0a41-4f4e-9a55-2f9e6f3b8d10"
+	userParam := repository.Param{Logic: "AND", Field: "id", Operator: "=", Value: userID}
+	userToken, _ := createToken(userID, exp)
+	expiredToken, _ := createToken(userID, time.Now().Add(-time.Minute))
+	orgToken, _ := createOrganizationToken(userID, testOrganizationID, exp)
+	clientToken, _ := createClientToken(lookup.ID, []string{oauth.ScopeUsersRead}, exp)
+	oidcToken, _ := createOIDCAccessToken(userID, lookup.ID, []string{oauth.ScopeOpenID, oauth.ScopeEmail}, exp)
+	verificationToken, _ := createEmailVerificationToken(userID, "budi@example.com", exp)
+	pat := personalAccessTokenPrefix + strings.Repeat("a", 40)
+	patCreated := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	deactivatedAt := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		prepare func(repo *repository.MockRepositoryInterface)
+		token   string
+		status  int
+		resp    map[string]interface{}
+	}{
+		{
+			name: "User token",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindUser(gomock.Any(), userParam).Return(repository.User{ID: userID}, nil)
+			},
+			token:  userToken,
+			status: http.StatusOK,
+			resp:   map[string]interface{}{"active": true, "sub": userID, "token_type": "Bearer", "exp": float64(exp.Unix())},
+		}, {
+			name: "User token of deleted user",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindUser(gomock.Any(), userParam).Return(repository.User{}, repository.ErrNotFound)
+			},
+			token:  userToken,
+			status: http.StatusOK,
+			resp:   map[string]interface{}{"active": false},
+		}, {
+			name: "User token of deactivated user",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindUser(gomock.Any(), userParam).Return(repository.User{ID: userID, DeactivatedAt: &deactivatedAt}, nil)
+			},
+			token:  userToken,
+			status: http.StatusOK,
+			resp:   map[string]interface{}{"active": false},
+		}, {
+			name: "User token with active organization",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindUser(gomock.Any(), userParam).Return(repository.User{ID: userID}, nil)
+				repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, userID).Return(repository.Membership{Role: repository.RoleMember}, nil)
+			},
+			token:  orgToken,
+			status: http.StatusOK,
+			resp:   map[string]interface{}{"active": true, "sub": userID, "org_id": testOrganizationID, "token_type": "Bearer", "exp": float64(exp.Unix())},
+		}, {
+			name: "User token of removed member",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindUser(gomock.Any(), userParam).Return(repository.User{ID: userID}, nil)
+				repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, userID).Return(repository.Membership{}, repository.ErrNotFound)
+			},
+			token:  orgToken,
+			status: http.StatusOK,
+			resp:   map[string]interface{}{"active": false},
+		}, {
+			name:   "Expired token",
+			token:  expiredToken,
+			status: http.StatusOK,
+			resp:   map[string]interface{}{"active": false},
+		}, {
+			name:   "Unknown token",
+			token:  "asd",
+			status: http.StatusOK,
+			resp:   map[string]interface{}{"active": false},
+		}, {
+			name:   "Email verification token",
+			token:  verificationToken,
+			status: http.StatusOK,
+			resp:   map[string]interface{}{"active": false},
+		}, {
+			name: "Client token",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindOAuthClient(gomock.Any(), lookup.ID).Return(lookup, nil)
+			},
+			token:  clientToken,
+			status: http.StatusOK,
+			resp:   map[string]interface{}{"active": true, "sub": lookup.ID, "client_id": lookup.ID, "scope": "users:read", "token_type": "Bearer", "exp": float64(exp.Unix())},
+		}, {
+			name: "Client token of revoked client",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindOAuthClient(gomock.Any(), lookup.ID).Return(repository.OAuthClient{}, repository.ErrNotFound)
+			},
+			token:  clientToken,
+			status: http.StatusOK,
+			resp:   map[string]interface{}{"active": false},
+		}, {
+			name: "OpenID Connect access token",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindOAuthClient(gomock.Any(), lookup.ID).Return(lookup, nil)
+				repo.EXPECT().FindUser(gomock.Any(), userParam).Return(repository.User{ID: userID}, nil)
+			},
+			token:  oidcToken,
+			status: http.StatusOK,
+			resp:   map[string]interface{}{"active": true, "sub": userID, "client_id": lookup.ID, "scope": "openid email", "token_type": "Bearer", "exp": float64(exp.Unix())},
+		}, {
+			name: "Personal access token",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindPersonalAccessToken(gomock.Any(), hashPersonalAccessToken(pat)).Return(repository.PersonalAccessToken{
+					ID:        "t1",
+					UserID:    userID,
+					Scopes:    []string{scopeProfileRead},
+					ExpiresAt: exp,
+					CreatedAt: patCreated,
+				}, nil)
+			},
+			token:  pat,
+			status: http.StatusOK,
+			resp:   map[string]interface{}{"active": true, "sub": userID, "scope": "profile:read", "token_type": "Bearer", "exp": float64(exp.Unix()), "iat": float64(patCreated.Unix())},
+		}, {
+			name: "Revoked personal access token",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindPersonalAccessToken(gomock.Any(), hashPersonalAccessToken(pat)).Return(repository.PersonalAccessToken{}, repository.ErrNotFound)
+			},
+			token:  pat,
+			status: http.StatusOK,
+			resp:   map[string]interface{}{"active": false},
+		}, {
+			name:   "Missing token",
+			token:  "",
+			status: http.StatusBadRequest,
+			resp:   map[string]interface{}{"error": "invalid_request", "error_description": "token is required"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := repository.NewMockRepositoryInterface(ctrl)
+			repo.EXPECT().FindOAuthClient(gomock.Any(), gateway.ID).Return(gateway, nil)
+			if tt.prepare != nil {
+				tt.prepare(repo)
+			}
+			s := NewServer(NewServerOptions{Repository: repo})
+
+			req := httptest.NewRequest(http.MethodPost, "/oauth/introspect", strings.NewReader(url.Values{"token": {tt.token}}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.SetBasicAuth(gateway.ID, secret)
+			rec := httptest.NewRecorder()
+
+			err := s.PostOauthIntrospect(echo.New().NewContext(req, rec))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.status, rec.Code)
+
+			var resp map[string]interface{}
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, tt.resp, resp)
+		})
+	}
+
+	t.Run("Client without introspect scope", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		repo := repository.NewMockRepositoryInterface(ctrl)
+		repo.EXPECT().FindOAuthClient(gomock.Any(), lookup.ID).Return(lookup, nil)
+		s := NewServer(NewServerOptions{Repository: repo})
+
+		req := httptest.NewRequest(http.MethodPost, "/oauth/introspect", strings.NewReader(url.Values{"token": {userToken}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(lookup.ID, lookupSecret)
+		rec := httptest.NewRecorder()
+
+		err := s.PostOauthIntrospect(echo.New().NewContext(req, rec))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("Unauthenticated client", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		s := NewServer(NewServerOptions{Repository: repository.NewMockRepositoryInterface(ctrl)})
+
+		req := httptest.NewRequest(http.MethodPost, "/oauth/introspect", strings.NewReader(url.Values{"token": {userToken}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+
+		err := s.PostOauthIntrospect(echo.New().NewContext(req, rec))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, `Basic realm="oauth"`, rec.Header().Get("WWW-Authenticate"))
+	})
+}
@@ -0,0 +1,374 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/notification"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+const (
+	invitationTokenPrefix    = "sawit_inv_"
+	defaultInvitationDays    = 7
+	maxInvitationDays        = 30
+	invalidInvitationMessage = "Invalid or expired invitation"
+)
+
+// Status of invitations in listings
+const (
+	invitationStatusPending  = "pending"
+	invitationStatusAccepted = "accepted"
+	invitationStatusRevoked  = "revoked"
+	invitationStatusExpired  = "expired"
+)
+
+// generateInvitationToken : random token sent by SMS, whoever receives it on the invited phone can accept the invitation
+func generateInvitationToken() (string, error) {
+	randomBytes := make([]byte, 20)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	return invitationTokenPrefix + hex.EncodeToString(randomBytes), nil
+}
+
+// hashInvitationToken : SHA-256 of the token, tokens are random so a fast hash is enough to look them up
+func hashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// invitationStatus : status of the invitation at the given time
+func invitationStatus(invitation repository.Invitation, now time.Time) string {
+	switch {
+	case invitation.AcceptedAt != nil:
+		return invitationStatusAccepted
+	case invitation.RevokedAt != nil:
+		return invitationStatusRevoked
+	case !invitation.ExpiresAt.After(now):
+		return invitationStatusExpired
+	default:
+		return invitationStatusPending
+	}
+}
+
+// toInvitation : convert repository invitation to response, the token hash is never returned
+func toInvitation(invitation repository.Invitation, now time.Time) generated.Invitation {
+	resp := generated.Invitation{
+		Id:         invitation.ID,
+		Phone:      invitation.Phone,
+		Role:       invitation.Role,
+		Status:     invitationStatus(invitation, now),
+		ExpiresAt:  invitation.ExpiresAt,
+		AcceptedAt: invitation.AcceptedAt,
+		CreatedAt:  invitation.CreatedAt,
+	}
+	if invitation.InvitedBy != "" {
+		resp.InvitedBy = &invitation.InvitedBy
+	}
+	return resp
+}
+
+// manager : membership of the user when the user can manage the organization, the error response is already written otherwise
+func (s *Server) manager(ctx echo.Context, organizationID string, userID string) (repository.Membership, bool, error) {
+	actor, err := s.findMembership(ctx, organizationID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return actor, false, ctx.JSON(http.StatusNotFound, map[string]string{"message": "Organization not found"})
+	}
+	if err != nil {
+		log.Error(err)
+		return actor, false, ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+	if !canManage(actor.Role, repository.RoleMember) {
+		return actor, false, ctx.JSON(http.StatusForbidden, map[string]string{"message": "Only owners and admins can manage invitations"})
+	}
+	return actor, true, nil
+}
+
+// PostOrganizationsIdInvitations : this handler is for inviting phone number to the organization, the link is sent by SMS
+func (s *Server) PostOrganizationsIdInvitations(ctx echo.Context, id string) error {
+	ID, err := s.authenticate(ctx, "")
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
+	}
+
+	req := new(generated.PostOrganizationsIdInvitationsJSONRequestBody)
+	if err := ctx.Bind(req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request payload"})
+	}
+	if !organizationRoles[req.Role] {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": invalidRoleMessage})
+	}
+	phoneNumber, err := s.Users.NormalizePhone(req.Phone)
+	if err != nil {
+		return respondError(ctx, serviceError(err, "Internal Server Error"))
+	}
+	days := defaultInvitationDays
+	if req.ExpiresInDays != nil {
+		days = *req.ExpiresInDays
+	}
+	if days < 1 || days > maxInvitationDays {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid expires_in_days. Invitation must expire within 1 to 30 days"})
+	}
+
+	actor, ok, err := s.manager(ctx, id, ID)
+	if !ok {
+		return err
+	}
+	if !canManage(actor.Role, req.Role) {
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Only owners and admins can invite members, and only owners can invite owners"})
+	}
+
+	// Registered users that are already members do not need an invitation
+	user, err := s.Repository.FindUser(ctx.Request().Context(), repository.Param{
+		Logic:    "AND",
+		Field:    "phone",
+		Operator: "=",
+		Value:    phoneNumber,
+	})
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+	if err == nil {
+		_, err = s.Repository.FindMembership(ctx.Request().Context(), id, user.ID)
+		if err == nil {
+			return ctx.JSON(http.StatusConflict, map[string]string{"message": "User is already a member"})
+		}
+		if !errors.Is(err, repository.ErrNotFound) {
+			log.Error(err)
+			return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+		}
+	}
+
+	token, err := generateInvitationToken()
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	now := time.Now()
+	invitation := repository.Invitation{
+		ID:               uuid.NewString(),
+		OrganizationID:   id,
+		OrganizationName: actor.OrganizationName,
+		Phone:            phoneNumber,
+		Role:             req.Role,
+		TokenHash:        hashInvitationToken(token),
+		InvitedBy:        ID,
+		ExpiresAt:        now.Add(time.Duration(days) * 24 * time.Hour),
+		CreatedAt:        now,
+	}
+	err = s.Repository.CreateInvitation(ctx.Request().Context(), invitation)
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	err = s.SMSNotifier.Notify(ctx.Request().Context(), notification.Message{
+		To: phoneNumber,
+		Body: fmt.Sprintf("You are invited to join %s on SawitPro as %s. Open %s/invitations/accept?token=%s within %d days to accept.",
+			actor.OrganizationName, req.Role, s.BaseURL, url.QueryEscape(token), days),
+	})
+	if err != nil {
+		log.Error(err)
+		// The invitee never received the token, a pending invitation nobody can accept only blocks a retry
+		if err := s.Repository.RevokeInvitation(ctx.Request().Context(), id, invitation.ID); err != nil {
+			log.Error(err)
+		}
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Error when sending invitation"})
+	}
+
+	return ctx.JSON(http.StatusCreated, toInvitation(invitation, now))
+}
+
+// GetOrganizationsIdInvitations : this handler is for listing invitations of the organization with their status
+func (s *Server) GetOrganizationsIdInvitations(ctx echo.Context, id string) error {
+	ID, err := s.authenticate(ctx, "")
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
+	}
+
+	_, ok, err := s.manager(ctx, id, ID)
+	if !ok {
+		return err
+	}
+
+	invitations, err := s.Repository.ListInvitations(ctx.Request().Context(), id)
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	now := time.Now()
+	resp := make([]generated.Invitation, 0, len(invitations))
+	for _, invitation := range invitations {
+		resp = append(resp, toInvitation(invitation, now))
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"invitations": resp})
+}
+
+// DeleteOrganizationsIdInvitationsInvitationId : this handler is for revoking pending invitation
+func (s *Server) DeleteOrganizationsIdInvitationsInvitationId(ctx echo.Context, id string, invitationId string) error {
+	ID, err := s.authenticate(ctx, "")
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
+	}
+
+	_, ok, err := s.manager(ctx, id, ID)
+	if !ok {
+		return err
+	}
+
+	if _, err := uuid.Parse(invitationId); err != nil {
+		return ctx.JSON(http.StatusNotFound, map[string]string{"message": "Invitation not found"})
+	}
+	err = s.Repository.RevokeInvitation(ctx.Request().Context(), id, invitationId)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ctx.JSON(http.StatusNotFound, map[string]string{"message": "Invitation not found"})
+	}
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// GetInvitationsAccept : this handler is for showing invitation from the link, so the client knows whether to login or register
+func (s *Server) GetInvitationsAccept(ctx echo.Context, params generated.GetInvitationsAcceptParams) error {
+	invitation, err := s.Repository.FindInvitation(ctx.Request().Context(), hashInvitationToken(params.Token))
+	if errors.Is(err, repository.ErrNotFound) {
+		return ctx.JSON(http.StatusNotFound, map[string]string{"message": invalidInvitationMessage})
+	}
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	_, err = s.Repository.FindUser(ctx.Request().Context(), repository.Param{
+		Logic:    "AND",
+		Field:    "phone",
+		Operator: "=",
+		Value:    invitation.Phone,
+	})
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"organization_id":   invitation.OrganizationID,
+		"organization_name": invitation.OrganizationName,
+		"role":              invitation.Role,
+		"phone":             invitation.Phone,
+		"expires_at":        invitation.ExpiresAt,
+		"registered":        err == nil,
+	})
+}
+
+// PostInvitationsAccept : this handler is for accepting invitation, existing users must be logged in and new users are registered
+func (s *Server) PostInvitationsAccept(ctx echo.Context) error {
+	req := new(generated.PostInvitationsAcceptJSONRequestBody)
+	if err := ctx.Bind(req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request payload"})
+	}
+
+	invitation, err := s.Repository.FindInvitation(ctx.Request().Context(), hashInvitationToken(req.Token))
+	if errors.Is(err, repository.ErrNotFound) {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": invalidInvitationMessage})
+	}
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	user, err := s.Repository.FindUser(ctx.Request().Context(), repository.Param{
+		Logic:    "AND",
+		Field:    "phone",
+		Operator: "=",
+		Value:    invitation.Phone,
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return s.registerInvitedUser(ctx, invitation, req)
+	}
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	// The account of the invited phone is linked, only by its owner
+	ID, err := s.authenticate(ctx, "")
+	if err != nil {
+		return ctx.JSON(http.StatusUnauthorized, map[string]string{"message": "Login with the invited phone number to accept the invitation"})
+	}
+	if ID != user.ID {
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Invitation was sent to another phone number"})
+	}
+
+	err = s.Repository.AcceptInvitation(ctx.Request().Context(), invitation.ID, user.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": invalidInvitationMessage})
+	}
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	return ctx.JSON(http.StatusOK, generated.AcceptedInvitation{
+		Message: "Invitation accepted",
+		UserId:  user.ID,
+		OrgId:   invitation.OrganizationID,
+	})
+}
+
+// registerInvitedUser : register the invited phone number, receiving the invitation by SMS verifies the phone
+func (s *Server) registerInvitedUser(ctx echo.Context, invitation repository.Invitation, req *generated.PostInvitationsAcceptJSONRequestBody) error {
+	var name, password string
+	if req.Name != nil {
+		name = *req.Name
+	}
+	if req.Password != nil {
+		password = *req.Password
+	}
+
+	input, err := s.Users.NewRegistration(invitation.Phone, name, password)
+	if err != nil {
+		return respondError(ctx, serviceError(err, "Internal Server Error"))
+	}
+	now := time.Now()
+	input.PhoneVerifiedAt = &now
+
+	err = s.Repository.RegisterInvitedUser(ctx.Request().Context(), invitation.ID, input)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": invalidInvitationMessage})
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrDuplicatePhone) {
+			// Registered since the invitation was looked up, the user has to login to accept
+			return ctx.JSON(http.StatusUnauthorized, map[string]string{"message": "Login with the invited phone number to accept the invitation"})
+		}
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Error when registering user"})
+	}
+
+	return ctx.JSON(http.StatusCreated, generated.AcceptedInvitation{
+		Message: "Registration successful",
+		UserId:  input.ID,
+		OrgId:   invitation.OrganizationID,
+	})
+}
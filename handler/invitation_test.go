@@ -0,0 +1,392 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/notification"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// invitationLinkToken : token of the invitation link inside the SMS body
+func invitationLinkToken(t *testing.T, body string) string {
+	start := strings.Index(body, "http")
+	assert.NotEqual(t, -1, start)
+	link, err := url.Parse(strings.Fields(body[start:])[0])
+	assert.NoError(t, err)
+	return link.Query().Get("token")
+}
+
+func TestInvitationStatus(t *testing.T) {
+	now := time.Now()
+	pending := repository.Invitation{ExpiresAt: now.Add(time.Hour)}
+	assert.Equal(t, invitationStatusPending, invitationStatus(pending, now))
+
+	expired := repository.Invitation{ExpiresAt: now.Add(-time.Hour)}
+	assert.Equal(t, invitationStatusExpired, invitationStatus(expired, now))
+
+	revoked := repository.Invitation{ExpiresAt: now.Add(time.Hour), RevokedAt: &now}
+	assert.Equal(t, invitationStatusRevoked, invitationStatus(revoked, now))
+
+	accepted := repository.Invitation{ExpiresAt: now.Add(-time.Hour), AcceptedAt: &now}
+	assert.Equal(t, invitationStatusAccepted, invitationStatus(accepted, now))
+}
+
+func TestPostOrganizationsIdInvitations(t *testing.T) {
+	phoneParam := repository.Param{Logic: "AND", Field: "phone", Operator: "=", Value: "+62856712332"}
+
+	tests := []struct {
+		name    string
+		prepare func(repo *repository.MockRepositoryInterface, notifier *notification.MockNotifier)
+		actor   string
+		args    string
+		status  int
+		content string
+	}{
+		{
+			name: "Success",
+			prepare: func(repo *repository.MockRepositoryInterface, notifier *notification.MockNotifier) {
+				repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testAdminID).Return(testMembership(testAdminID, repository.RoleAdmin), nil)
+				repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(repository.User{}, repository.ErrNotFound)
+				var stored repository.Invitation
+				repo.EXPECT().CreateInvitation(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, invitation repository.Invitation) error {
+					stored = invitation
+					assert.Equal(t, testOrganizationID, invitation.OrganizationID)
+					assert.Equal(t, "+62856712332", invitation.Phone)
+					assert.Equal(t, repository.RoleMember, invitation.Role)
+					assert.Equal(t, testAdminID, invitation.InvitedBy)
+					assert.WithinDuration(t, time.Now().Add(3*24*time.Hour), invitation.ExpiresAt, time.Minute)
+					return nil
+				})
+				notifier.EXPECT().Notify(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, message notification.Message) error {
+					assert.Equal(t, "+62856712332", message.To)
+					assert.Contains(t, message.Body, "Kebun Sawit Riau")
+					token := invitationLinkToken(t, message.Body)
+					assert.True(t, strings.HasPrefix(token, invitationTokenPrefix))
+					assert.Equal(t, stored.TokenHash, hashInvitationToken(token))
+					return nil
+				})
+			},
+			actor:  testAdminID,
+			args:   `{"phone": "0856712332", "role": "member", "expires_in_days": 3}`,
+			status: http.StatusCreated,
+		}, {
+			name:   "Invalid expiry",
+			actor:  testAdminID,
+			args:   `{"phone": "0856712332", "role": "member", "expires_in_days": 31}`,
+			status: http.StatusBadRequest,
+		}, {
+			name: "Member cannot invite",
+			prepare: func(repo *repository.MockRepositoryInterface, notifier *notification.MockNotifier) {
+				repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testMemberID).Return(testMembership(testMemberID, repository.RoleMember), nil)
+			},
+			actor:   testMemberID,
+			args:    `{"phone": "0856712332", "role": "member"}`,
+			status:  http.StatusForbidden,
+			content: "{\"message\":\"Only owners and admins can manage invitations\"}\n",
+		}, {
+			name: "Admin cannot invite owner",
+			prepare: func(repo *repository.MockRepositoryInterface, notifier *notification.MockNotifier) {
+				repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testAdminID).Return(testMembership(testAdminID, repository.RoleAdmin), nil)
+			},
+			actor:  testAdminID,
+			args:   `{"phone": "0856712332", "role": "owner"}`,
+			status: http.StatusForbidden,
+		}, {
+			name: "Already a member",
+			prepare: func(repo *repository.MockRepositoryInterface, notifier *notification.MockNotifier) {
+				repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testOwnerID).Return(testMembership(testOwnerID, repository.RoleOwner), nil)
+				repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(repository.User{ID: testMemberID}, nil)
+				repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testMemberID).Return(testMembership(testMemberID, repository.RoleMember), nil)
+			},
+			actor:   testOwnerID,
+			args:    `{"phone": "0856712332", "role": "admin"}`,
+			status:  http.StatusConflict,
+			content: "{\"message\":\"User is already a member\"}\n",
+		}, {
+			name: "SMS failure",
+			prepare: func(repo *repository.MockRepositoryInterface, notifier *notification.MockNotifier) {
+				repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testOwnerID).Return(testMembership(testOwnerID, repository.RoleOwner), nil)
+				repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(repository.User{ID: testMemberID}, nil)
+				repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testMemberID).Return(repository.Membership{}, repository.ErrNotFound)
+				var created repository.Invitation
+				repo.EXPECT().CreateInvitation(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, invitation repository.Invitation) error {
+					created = invitation
+					return nil
+				})
+				notifier.EXPECT().Notify(gomock.Any(), gomock.Any()).Return(sql.ErrConnDone)
+				repo.EXPECT().RevokeInvitation(gomock.Any(), testOrganizationID, gomock.Any()).DoAndReturn(func(_ context.Context, _ string, id string) error {
+					assert.Equal(t, created.ID, id)
+					return nil
+				})
+			},
+			actor:   testOwnerID,
+			args:    `{"phone": "0856712332", "role": "admin"}`,
+			status:  http.StatusInternalServerError,
+			content: "{\"message\":\"Error when sending invitation\"}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := repository.NewMockRepositoryInterface(ctrl)
+			notifier := notification.NewMockNotifier(ctrl)
+			expectActiveUser(repo, tt.actor)
+			if tt.prepare != nil {
+				tt.prepare(repo, notifier)
+			}
+			s := NewServer(NewServerOptions{Repository: repo, SMSNotifier: notifier, BaseURL: "https://sawitpro.example.com"})
+
+			token, _ := createToken(tt.actor, time.Now().Add(time.Hour))
+			req := httptest.NewRequest(http.MethodPost, "/organizations/"+testOrganizationID+"/invitations", strings.NewReader(tt.args))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+
+			err := s.PostOrganizationsIdInvitations(echo.New().NewContext(req, rec), testOrganizationID)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.status, rec.Code)
+			if tt.content != "" {
+				assert.Equal(t, tt.content, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetOrganizationsIdInvitations(t *testing.T) {
+	now := time.Now()
+	rec := organizationRequest(t, func(repo *repository.MockRepositoryInterface) {
+		repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testOwnerID).Return(testMembership(testOwnerID, repository.RoleOwner), nil)
+		repo.EXPECT().ListInvitations(gomock.Any(), testOrganizationID).Return([]repository.Invitation{
+			{ID: "i2", Phone: "+62856712332", Role: repository.RoleMember, InvitedBy: testOwnerID, ExpiresAt: now.Add(time.Hour), CreatedAt: now},
+			{ID: "i1", Phone: "+62856712333", Role: repository.RoleAdmin, ExpiresAt: now.Add(-time.Hour), CreatedAt: now.Add(-48 * time.Hour)},
+		}, nil)
+	}, http.MethodGet, testOwnerID, "", func(s *Server, c echo.Context) error {
+		return s.GetOrganizationsIdInvitations(c, testOrganizationID)
+	})
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var resp struct {
+		Invitations []map[string]interface{} `json:"invitations"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Len(t, resp.Invitations, 2)
+	assert.Equal(t, invitationStatusPending, resp.Invitations[0]["status"])
+	assert.Equal(t, testOwnerID, resp.Invitations[0]["invited_by"])
+	assert.Equal(t, invitationStatusExpired, resp.Invitations[1]["status"])
+	assert.NotContains(t, resp.Invitations[0], "token_hash")
+}
+
+func TestDeleteOrganizationsIdInvitationsInvitationId(t *testing.T) {
+	invitationID := "4fad5a1c-0b4a-4ba5-9ebc-7a6d9b2e5c05"
+
+	t.Run("Success", func(t *testing.T) {
+		rec := organizationRequest(t, func(repo *repository.MockRepositoryInterface) {
+			repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testAdminID).Return(testMembership(testAdminID, repository.RoleAdmin), nil)
+			repo.EXPECT().RevokeInvitation(gomock.Any(), testOrganizationID, invitationID).Return(nil)
+		}, http.MethodDelete, testAdminID, "", func(s *Server, c echo.Context) error {
+			return s.DeleteOrganizationsIdInvitationsInvitationId(c, testOrganizationID, invitationID)
+		})
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	})
+
+	t.Run("Not pending", func(t *testing.T) {
+		rec := organizationRequest(t, func(repo *repository.MockRepositoryInterface) {
+			repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testAdminID).Return(testMembership(testAdminID, repository.RoleAdmin), nil)
+			repo.EXPECT().RevokeInvitation(gomock.Any(), testOrganizationID, invitationID).Return(repository.ErrNotFound)
+		}, http.MethodDelete, testAdminID, "", func(s *Server, c echo.Context) error {
+			return s.DeleteOrganizationsIdInvitationsInvitationId(c, testOrganizationID, invitationID)
+		})
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("Member cannot revoke", func(t *testing.T) {
+		rec := organizationRequest(t, func(repo *repository.MockRepositoryInterface) {
+			repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testMemberID).Return(testMembership(testMemberID, repository.RoleMember), nil)
+		}, http.MethodDelete, testMemberID, "", func(s *Server, c echo.Context) error {
+			return s.DeleteOrganizationsIdInvitationsInvitationId(c, testOrganizationID, invitationID)
+		})
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
+
+func TestGetInvitationsAccept(t *testing.T) {
+	token := invitationTokenPrefix + strings.Repeat("b", 40)
+	invitation := repository.Invitation{OrganizationID: testOrganizationID, OrganizationName: "Kebun Sawit Riau", Phone: "+62856712332", Role: repository.RoleAdmin, ExpiresAt: time.Now().Add(time.Hour)}
+
+	tests := []struct {
+		name       string
+		prepare    func(repo *repository.MockRepositoryInterface)
+		status     int
+		registered interface{}
+	}{
+		{
+			name: "Registered phone",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindInvitation(gomock.Any(), hashInvitationToken(token)).Return(invitation, nil)
+				repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{ID: testMemberID}, nil)
+			},
+			status:     http.StatusOK,
+			registered: true,
+		}, {
+			name: "New phone",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindInvitation(gomock.Any(), hashInvitationToken(token)).Return(invitation, nil)
+				repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{}, repository.ErrNotFound)
+			},
+			status:     http.StatusOK,
+			registered: false,
+		}, {
+			name: "Invalid invitation",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindInvitation(gomock.Any(), hashInvitationToken(token)).Return(repository.Invitation{}, repository.ErrNotFound)
+			},
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := repository.NewMockRepositoryInterface(ctrl)
+			tt.prepare(repo)
+			s := NewServer(NewServerOptions{Repository: repo})
+
+			req := httptest.NewRequest(http.MethodGet, "/invitations/accept?token="+token, nil)
+			rec := httptest.NewRecorder()
+
+			err := s.GetInvitationsAccept(echo.New().NewContext(req, rec), generated.GetInvitationsAcceptParams{Token: token})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.status, rec.Code)
+
+			var resp map[string]interface{}
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, tt.registered, resp["registered"])
+		})
+	}
+}
+
+func TestPostInvitationsAccept(t *testing.T) {
+	token := invitationTokenPrefix + strings.Repeat("b", 40)
+	invitation := repository.Invitation{
+		ID:               "4fad5a1c-0b4a-4ba5-9ebc-7a6d9b2e5c05",
+		OrganizationID:   testOrganizationID,
+		OrganizationName: "Kebun Sawit Riau",
+		Phone:            "+62856712332",
+		Role:             repository.RoleMember,
+		ExpiresAt:        time.Now().Add(time.Hour),
+	}
+	phoneParam := repository.Param{Logic: "AND", Field: "phone", Operator: "=", Value: "+62856712332"}
+
+	tests := []struct {
+		name    string
+		prepare func(repo *repository.MockRepositoryInterface)
+		user    string
+		args    string
+		status  int
+		content string
+	}{
+		{
+			name: "Register new user",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindInvitation(gomock.Any(), hashInvitationToken(token)).Return(invitation, nil)
+				repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(repository.User{}, repository.ErrNotFound)
+				repo.EXPECT().RegisterInvitedUser(gomock.Any(), invitation.ID, gomock.Any()).DoAndReturn(func(_ context.Context, _ string, input repository.RegistrationInput) error {
+					assert.Equal(t, "+62856712332", input.Phone)
+					assert.Equal(t, "Budi Santoso", input.Name)
+					assert.NotEmpty(t, input.Salt)
+					assert.NotNil(t, input.PhoneVerifiedAt)
+					return nil
+				})
+			},
+			args:   `{"token": "` + token + `", "name": "Budi Santoso", "password": "QWErty123!@#"}`,
+			status: http.StatusCreated,
+		}, {
+			name: "Register with invalid password",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindInvitation(gomock.Any(), hashInvitationToken(token)).Return(invitation, nil)
+				repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(repository.User{}, repository.ErrNotFound)
+			},
+			args:    `{"token": "` + token + `", "name": "Budi Santoso", "password": "weak"}`,
+			status:  http.StatusBadRequest,
+			content: "{\"message\":\"Invalid password. Passwords must be 6 to 64 characters and contain at least 1 uppercase letter, 1 digit, and 1 special character\"}\n",
+		}, {
+			name: "Existing user accepts",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindInvitation(gomock.Any(), hashInvitationToken(token)).Return(invitation, nil)
+				repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(repository.User{ID: testMemberID}, nil)
+				repo.EXPECT().AcceptInvitation(gomock.Any(), invitation.ID, testMemberID).Return(nil)
+			},
+			user:    testMemberID,
+			args:    `{"token": "` + token + `"}`,
+			status:  http.StatusOK,
+			content: "{\"message\":\"Invitation accepted\",\"org_id\":\"" + testOrganizationID + "\",\"user_id\":\"" + testMemberID + "\"}\n",
+		}, {
+			name: "Existing user must login",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindInvitation(gomock.Any(), hashInvitationToken(token)).Return(invitation, nil)
+				repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(repository.User{ID: testMemberID}, nil)
+			},
+			args:   `{"token": "` + token + `"}`,
+			status: http.StatusUnauthorized,
+		}, {
+			name: "Another user",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindInvitation(gomock.Any(), hashInvitationToken(token)).Return(invitation, nil)
+				repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(repository.User{ID: testMemberID}, nil)
+			},
+			user:   testAdminID,
+			args:   `{"token": "` + token + `"}`,
+			status: http.StatusForbidden,
+		}, {
+			name: "Expired or revoked invitation",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindInvitation(gomock.Any(), hashInvitationToken(token)).Return(repository.Invitation{}, repository.ErrNotFound)
+			},
+			args:    `{"token": "` + token + `"}`,
+			status:  http.StatusBadRequest,
+			content: "{\"message\":\"Invalid or expired invitation\"}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := repository.NewMockRepositoryInterface(ctrl)
+			if tt.user != "" {
+				expectActiveUser(repo, tt.user)
+			}
+			if tt.prepare != nil {
+				tt.prepare(repo)
+			}
+			s := NewServer(NewServerOptions{Repository: repo})
+
+			req := httptest.NewRequest(http.MethodPost, "/invitations/accept", strings.NewReader(tt.args))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.user != "" {
+				userToken, _ := createToken(tt.user, time.Now().Add(time.Hour))
+				req.Header.Set("Authorization", "Bearer "+userToken)
+			}
+			rec := httptest.NewRecorder()
+
+			err := s.PostInvitationsAccept(echo.New().NewContext(req, rec))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.status, rec.Code)
+			if tt.content != "" {
+				assert.Equal(t, tt.content, rec.Body.String())
+			}
+		})
+	}
+}
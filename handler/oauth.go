@@ -0,0 +1,335 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/oauth"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+const (
+	// clientCredentialsPurpose : purpose claim of client access tokens, keeps them from being accepted as user tokens
+	clientCredentialsPurpose = "client_credentials"
+	// clientTokenTTL : lifetime of client access tokens
+	clientTokenTTL = time.Hour
+)
+
+// errInvalidClient : client credentials of the request are missing or wrong
+var errInvalidClient = errors.New("invalid client credentials")
+
+// createClientToken : create signed access token of OAuth client with granted scopes
+func createClientToken(clientID string, scopes []string, exp time.Time) (string, error) {
+	return signToken(jwt.MapClaims{
+		"client_id": clientID,
+		"scope":     strings.Join(scopes, " "),
+		"purpose":   clientCredentialsPurpose,
+		"exp":       exp.Unix(),
+	})
+}
+
+// authenticateClient : OAuth client of the access token, the client must still be active and granted the scope
+func (s *Server) authenticateClient(ctx echo.Context, scope string) (repository.OAuthClient, error) {
+	return s.authenticateClientToken(ctx.Request().Context(), bearerToken(ctx), scope)
+}
+
+// authenticateClientToken : OAuth client of the access token without the Bearer prefix, shared by the REST and gRPC authentication
+func (s *Server) authenticateClientToken(ctx context.Context, tokenString string, scope string) (repository.OAuthClient, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return repository.OAuthClient{}, err
+	}
+	if claims["purpose"] != clientCredentialsPurpose {
+		return repository.OAuthClient{}, fmt.Errorf("token is not a client access token")
+	}
+
+	clientID, _ := claims["client_id"].(string)
+	granted, _ := claims["scope"].(string)
+	if !containsScope(strings.Fields(granted), scope) {
+		return repository.OAuthClient{}, fmt.Errorf("client access token does not have scope %s", scope)
+	}
+
+	// Revoked clients lose access immediately instead of when their tokens expire
+	client, err := s.Repository.FindOAuthClient(ctx, clientID)
+	if err != nil {
+		return repository.OAuthClient{}, err
+	}
+	// Clients created before tenants were limited may still have scopes of every tenant
+	if client.Tenant != nil && oauth.ServiceScopes[scope] && !oauth.TenantServiceScopes[scope] {
+		return repository.OAuthClient{}, fmt.Errorf("client %s of tenant %s cannot use scope %s", client.ID, *client.Tenant, scope)
+	}
+	return client, nil
+}
+
+// containsScope : check scope is one of the granted scopes
+func containsScope(granted []string, scope string) bool {
+	for _, candidate := range granted {
+		if candidate == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// oauthError : error response in the format of RFC 6749 section 5.2
+func oauthError(ctx echo.Context, status int, code, description string) error {
+	if status == http.StatusUnauthorized {
+		ctx.Response().Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	return ctx.JSON(status, map[string]string{"error": code, "error_description": description})
+}
+
+// clientCredentials : client id and secret from HTTP Basic authorization or the request body
+func clientCredentials(ctx echo.Context) (id, secret string, ok bool) {
+	if id, secret, ok = ctx.Request().BasicAuth(); ok {
+		// RFC 6749 section 2.3.1 form encode the credentials before they are put in the header
+		var idErr, secretErr error
+		id, idErr = url.QueryUnescape(id)
+		secret, secretErr = url.QueryUnescape(secret)
+		return id, secret, idErr == nil && secretErr == nil
+	}
+	id, secret = ctx.FormValue("client_id"), ctx.FormValue("client_secret")
+	return id, secret, id != "" && secret != ""
+}
+
+// authenticateOAuthClient : client of the request authenticated with its secret, errInvalidClient when the credentials are missing or wrong
+func (s *Server) authenticateOAuthClient(ctx echo.Context) (repository.OAuthClient, error) {
+	clientID, clientSecret, ok := clientCredentials(ctx)
+	if !ok {
+		return repository.OAuthClient{}, errInvalidClient
+	}
+
+	client, err := s.Repository.FindOAuthClient(ctx.Request().Context(), clientID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return repository.OAuthClient{}, errInvalidClient
+	}
+	if err != nil {
+		return repository.OAuthClient{}, err
+	}
+	if !oauth.VerifySecret(client, clientSecret) {
+		return repository.OAuthClient{}, errInvalidClient
+	}
+	return client, nil
+}
+
+// PostOauthToken : this handler is for issuing access token with the client credentials or authorization code grant
+func (s *Server) PostOauthToken(ctx echo.Context) error {
+	// Token responses must never be cached
+	ctx.Response().Header().Set("Cache-Control", "no-store")
+	ctx.Response().Header().Set("Pragma", "no-cache")
+
+	grantType := ctx.FormValue("grant_type")
+	if grantType == "" {
+		return oauthError(ctx, http.StatusBadRequest, "invalid_request", "grant_type is required")
+	}
+	if grantType != "client_credentials" && grantType != "authorization_code" {
+		return oauthError(ctx, http.StatusBadRequest, "unsupported_grant_type", "Only client_credentials and authorization_code grants are supported")
+	}
+
+	client, err := s.authenticateOAuthClient(ctx)
+	if errors.Is(err, errInvalidClient) {
+		return oauthError(ctx, http.StatusUnauthorized, "invalid_client", "Invalid or missing client credentials")
+	}
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": "server_error"})
+	}
+
+	if grantType == "authorization_code" {
+		return s.authorizationCodeGrant(ctx, client)
+	}
+
+	scopes, err := oauth.GrantScopes(client, strings.Fields(ctx.FormValue("scope")), oauth.ServiceScopes)
+	if err != nil || len(scopes) == 0 {
+		return oauthError(ctx, http.StatusBadRequest, "invalid_scope", "Requested scope is not allowed for the client")
+	}
+
+	token, err := createClientToken(client.ID, scopes, time.Now().Add(clientTokenTTL))
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": "server_error"})
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(clientTokenTTL.Seconds()),
+		"scope":        strings.Join(scopes, " "),
+	})
+}
+
+// toOAuthClient : convert repository client to response, the secret hash is never returned
+func toOAuthClient(client repository.OAuthClient) generated.OAuthClient {
+	return generated.OAuthClient{
+		Id:           client.ID,
+		Name:         client.Name,
+		Scopes:       client.Scopes,
+		RedirectUris: client.RedirectURIs,
+		Tenant:       client.Tenant,
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+// PostAdminClients : this handler is for registering OAuth client
+func (s *Server) PostAdminClients(ctx echo.Context) error {
+	_, err := s.authenticateClient(ctx, oauth.ScopeClientsAdmin)
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
+	}
+
+	req := new(generated.PostAdminClientsJSONRequestBody)
+	if err := ctx.Bind(req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request payload"})
+	}
+
+	opts := oauth.NewClientOptions{Name: req.Name, Scopes: req.Scopes}
+	if req.RedirectUris != nil {
+		opts.RedirectURIs = *req.RedirectUris
+	}
+	if req.Tenant != nil {
+		opts.Tenant = *req.Tenant
+	}
+	client, secret, err := oauth.NewClient(opts)
+	if errors.Is(err, oauth.ErrInvalidName) {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid name. Name must be between 1 and 100 characters"})
+	}
+	if errors.Is(err, oauth.ErrInvalidScope) {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid scopes. Scopes must be users:read, users:import, users:export, tokens:introspect, clients:admin, scim, openid, profile, email or phone"})
+	}
+	if errors.Is(err, oauth.ErrInvalidRedirectURI) {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid redirect_uris. Redirect URIs must be https urls without fragment, http only for localhost, and are required with the openid scope"})
+	}
+	if errors.Is(err, oauth.ErrInvalidTenant) {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid tenant. Tenant must be at most 64 characters, is required with the scim scope and is only allowed with the scim, openid, profile, email and phone scopes"})
+	}
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+	client.CreatedAt = time.Now()
+
+	err = s.Repository.CreateOAuthClient(ctx.Request().Context(), client)
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	return ctx.JSON(http.StatusCreated, generated.CreatedOAuthClient{
+		Id:           client.ID,
+		Name:         client.Name,
+		Scopes:       client.Scopes,
+		RedirectUris: client.RedirectURIs,
+		Tenant:       client.Tenant,
+		CreatedAt:    client.CreatedAt,
+		ClientSecret: secret,
+	})
+}
+
+// GetAdminClients : this handler is for listing active OAuth clients
+func (s *Server) GetAdminClients(ctx echo.Context) error {
+	_, err := s.authenticateClient(ctx, oauth.ScopeClientsAdmin)
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
+	}
+
+	clients, err := s.Repository.ListOAuthClients(ctx.Request().Context())
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	resp := make([]generated.OAuthClient, 0, len(clients))
+	for _, client := range clients {
+		resp = append(resp, toOAuthClient(client))
+	}
+	return ctx.JSON(http.StatusOK, map[string][]generated.OAuthClient{"clients": resp})
+}
+
+// DeleteAdminClientsId : this handler is for revoking OAuth client
+func (s *Server) DeleteAdminClientsId(ctx echo.Context, id string) error {
+	_, err := s.authenticateClient(ctx, oauth.ScopeClientsAdmin)
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
+	}
+
+	err = s.Repository.RevokeOAuthClient(ctx.Request().Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ctx.JSON(http.StatusNotFound, map[string]string{"message": "Client not found"})
+	}
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// GetUsers : this handler is for looking up user by phone number
+func (s *Server) GetUsers(ctx echo.Context, params generated.GetUsersParams) error {
+	_, err := s.authenticateClient(ctx, oauth.ScopeUsersRead)
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
+	}
+
+	phoneNumber, err := s.Users.NormalizePhone(params.Phone)
+	if err != nil {
+		return respondError(ctx, serviceError(err, "Internal Server Error"))
+	}
+
+	return s.lookupUser(ctx, repository.Param{
+		Logic:    "AND",
+		Field:    "phone",
+		Operator: "=",
+		Value:    phoneNumber,
+	})
+}
+
+// GetUsersId : this handler is for looking up user by id
+func (s *Server) GetUsersId(ctx echo.Context, id string) error {
+	_, err := s.authenticateClient(ctx, oauth.ScopeUsersRead)
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
+	}
+
+	if _, err := uuid.Parse(id); err != nil {
+		return ctx.JSON(http.StatusNotFound, map[string]string{"message": "User not found"})
+	}
+
+	return s.lookupUser(ctx, repository.Param{
+		Logic:    "AND",
+		Field:    "id",
+		Operator: "=",
+		Value:    id,
+	})
+}
+
+// lookupUser : respond with profile of the user matching the param, including the id
+func (s *Server) lookupUser(ctx echo.Context, param repository.Param) error {
+	user, err := s.Repository.FindUser(ctx.Request().Context(), param)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ctx.JSON(http.StatusNotFound, map[string]string{"message": "User not found"})
+	}
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	profile := toUserProfile(user)
+	profile.Id = &user.ID
+	return ctx.JSON(http.StatusOK, profile)
+}
@@ -0,0 +1,415 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/oauth"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostOauthToken(t *testing.T) {
+	client, secret, err := oauth.NewClient(oauth.NewClientOptions{Name: "billing", Scopes: []string{oauth.ScopeUsersRead}})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		prepare func(repo *repository.MockRepositoryInterface)
+		form    url.Values
+		basic   []string
+		status  int
+		error   string
+		scope   string
+	}{
+		{
+			name:   "Missing grant type",
+			form:   url.Values{},
+			status: http.StatusBadRequest,
+			error:  "invalid_request",
+		}, {
+			name:   "Unsupported grant type",
+			form:   url.Values{"grant_type": {"password"}},
+			status: http.StatusBadRequest,
+			error:  "unsupported_grant_type",
+		}, {
+			name:   "Missing client credentials",
+			form:   url.Values{"grant_type": {"client_credentials"}},
+			status: http.StatusUnauthorized,
+			error:  "invalid_client",
+		}, {
+			name: "Unknown client",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindOAuthClient(gomock.Any(), "unknown").Return(repository.OAuthClient{}, repository.ErrNotFound)
+			},
+			form:   url.Values{"grant_type": {"client_credentials"}, "client_id": {"unknown"}, "client_secret": {secret}},
+			status: http.StatusUnauthorized,
+			error:  "invalid_client",
+		}, {
+			name: "Wrong secret",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindOAuthClient(gomock.Any(), client.ID).Return(client, nil)
+			},
+			form:   url.Values{"grant_type": {"client_credentials"}, "client_id": {client.ID}, "client_secret": {"wrong"}},
+			status: http.StatusUnauthorized,
+			error:  "invalid_client",
+		}, {
+			name: "Scope not allowed",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindOAuthClient(gomock.Any(), client.ID).Return(client, nil)
+			},
+			form:   url.Values{"grant_type": {"client_credentials"}, "scope": {oauth.ScopeClientsAdmin}},
+			basic:  []string{client.ID, secret},
+			status: http.StatusBadRequest,
+			error:  "invalid_scope",
+		}, {
+			name: "Credentials in body",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindOAuthClient(gomock.Any(), client.ID).Return(client, nil)
+			},
+			form:   url.Values{"grant_type": {"client_credentials"}, "client_id": {client.ID}, "client_secret": {secret}},
+			status: http.StatusOK,
+			scope:  oauth.ScopeUsersRead,
+		}, {
+			name: "HTTP Basic",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindOAuthClient(gomock.Any(), client.ID).Return(client, nil)
+			},
+			form:   url.Values{"grant_type": {"client_credentials"}, "scope": {oauth.ScopeUsersRead}},
+			basic:  []string{client.ID, secret},
+			status: http.StatusOK,
+			scope:  oauth.ScopeUsersRead,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := repository.NewMockRepositoryInterface(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(repo)
+			}
+			s := NewServer(NewServerOptions{Repository: repo})
+
+			req := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.basic != nil {
+				req.SetBasicAuth(url.QueryEscape(tt.basic[0]), url.QueryEscape(tt.basic[1]))
+			}
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+
+			err := s.PostOauthToken(c)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+
+			var resp map[string]interface{}
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			if tt.error != "" {
+				assert.Equal(t, tt.error, resp["error"])
+				return
+			}
+			assert.Equal(t, "Bearer", resp["token_type"])
+			assert.Equal(t, tt.scope, resp["scope"])
+			assert.EqualValues(t, 3600, resp["expires_in"])
+
+			// Client access tokens must not authenticate as a user
+			req.Header.Set("Authorization", "Bearer "+resp["access_token"].(string))
+			_, err = validateToken(c)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAuthenticateClient(t *testing.T) {
+	exp := time.Now().Add(time.Hour)
+	readToken, _ := createClientToken("c1", []string{oauth.ScopeUsersRead}, exp)
+	userToken, _ := createToken("123", exp)
+
+	tests := []struct {
+		name    string
+		prepare func(repo *repository.MockRepositoryInterface)
+		token   string
+		wantErr bool
+	}{
+		{
+			name: "Granted scope",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindOAuthClient(gomock.Any(), "c1").Return(repository.OAuthClient{ID: "c1"}, nil)
+			},
+			token: readToken,
+		}, {
+			name: "Revoked client",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindOAuthClient(gomock.Any(), "c1").Return(repository.OAuthClient{}, repository.ErrNotFound)
+			},
+			token:   readToken,
+			wantErr: true,
+		}, {
+			name:    "User token",
+			token:   userToken,
+			wantErr: true,
+		}, {
+			name:    "Invalid token",
+			token:   "asd",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := repository.NewMockRepositoryInterface(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(repo)
+			}
+			s := NewServer(NewServerOptions{Repository: repo})
+
+			req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+
+			client, err := s.authenticateClient(c, oauth.ScopeUsersRead)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "c1", client.ID)
+		})
+	}
+
+	// Scope not granted is rejected before the client is looked up
+	ctrl := gomock.NewController(t)
+	s := NewServer(NewServerOptions{Repository: repository.NewMockRepositoryInterface(ctrl)})
+	req := httptest.NewRequest(http.MethodGet, "/admin/clients", nil)
+	req.Header.Set("Authorization", "Bearer "+readToken)
+	_, err := s.authenticateClient(echo.New().NewContext(req, httptest.NewRecorder()), oauth.ScopeClientsAdmin)
+	assert.Error(t, err)
+}
+
+func TestGetUsersId(t *testing.T) {
+	exp := time.Now().Add(time.Hour)
+	readToken, _ := createClientToken("c1", []string{oauth.ScopeUsersRead}, exp)
+	adminToken, _ := createClientToken("c1", []string{oauth.ScopeClientsAdmin}, exp)
+	userID := "7f2b6c1e-0a41-4f4e-9a55-2f9e6f3b8d10"
+
+	tests := []struct {
+		name    string
+		prepare func(repo *repository.MockRepositoryInterface)
+		token   string
+		id      string
+		status  int
+		content string
+	}{
+		{
+			name: "Successful",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindOAuthClient(gomock.Any(), "c1").Return(repository.OAuthClient{ID: "c1"}, nil)
+				repo.EXPECT().FindUser(gomock.Any(), repository.Param{Logic: "AND", Field: "id", Operator: "=", Value: userID}).Return(repository.User{ID: userID, Name: "Budi", Phone: "+62812345678"}, nil)
+			},
+			token:   readToken,
+			id:      userID,
+			status:  http.StatusOK,
+			content: "{\"id\":\"" + userID + "\",\"name\":\"Budi\",\"phone\":\"+62812345678\"}\n",
+		}, {
+			name: "Not found",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindOAuthClient(gomock.Any(), "c1").Return(repository.OAuthClient{ID: "c1"}, nil)
+				repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{}, repository.ErrNotFound)
+			},
+			token:   readToken,
+			id:      userID,
+			status:  http.StatusNotFound,
+			content: "{\"message\":\"User not found\"}\n",
+		}, {
+			name: "Invalid id",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindOAuthClient(gomock.Any(), "c1").Return(repository.OAuthClient{ID: "c1"}, nil)
+			},
+			token:   readToken,
+			id:      "abc",
+			status:  http.StatusNotFound,
+			content: "{\"message\":\"User not found\"}\n",
+		}, {
+			name:    "Missing scope",
+			token:   adminToken,
+			id:      userID,
+			status:  http.StatusForbidden,
+			content: "{\"message\":\"Forbidden code\"}\n",
+		}, {
+			name: "Client of a tenant",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				tenant := "plantation"
+				repo.EXPECT().FindOAuthClient(gomock.Any(), "c1").Return(repository.OAuthClient{ID: "c1", Tenant: &tenant}, nil)
+			},
+			token:   readToken,
+			id:      userID,
+			status:  http.StatusForbidden,
+			content: "{\"message\":\"Forbidden code\"}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := repository.NewMockRepositoryInterface(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(repo)
+			}
+			s := NewServer(NewServerOptions{Repository: repo})
+
+			req := httptest.NewRequest(http.MethodGet, "/users/"+tt.id, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+
+			err := s.GetUsersId(c, tt.id)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Equal(t, tt.content, rec.Body.String())
+		})
+	}
+}
+
+func TestGetUsers(t *testing.T) {
+	readToken, _ := createClientToken("c1", []string{oauth.ScopeUsersRead}, time.Now().Add(time.Hour))
+
+	ctrl := gomock.NewController(t)
+	repo := repository.NewMockRepositoryInterface(ctrl)
+	repo.EXPECT().FindOAuthClient(gomock.Any(), "c1").Return(repository.OAuthClient{ID: "c1"}, nil).Times(2)
+	repo.EXPECT().FindUser(gomock.Any(), repository.Param{Logic: "AND", Field: "phone", Operator: "=", Value: "+62812345678"}).Return(repository.User{ID: "u1", Phone: "+62812345678"}, nil)
+	s := NewServer(NewServerOptions{Repository: repo})
+
+	for _, tt := range []struct {
+		phone   string
+		status  int
+		content string
+	}{
+		{"0812345678", http.StatusOK, "{\"id\":\"u1\",\"name\":\"\",\"phone\":\"+62812345678\"}\n"},
+		{"123", http.StatusBadRequest, "{\"message\":\"Invalid phone number. Phone numbers must be a valid number of a supported country, e.g. +62812345678 or 0812345678\"}\n"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/users?phone="+url.QueryEscape(tt.phone), nil)
+		req.Header.Set("Authorization", "Bearer "+readToken)
+		rec := httptest.NewRecorder()
+
+		err := s.GetUsers(echo.New().NewContext(req, rec), generated.GetUsersParams{Phone: tt.phone})
+		assert.NoError(t, err)
+		assert.Equal(t, tt.status, rec.Code)
+		assert.Equal(t, tt.content, rec.Body.String())
+	}
+}
+
+func TestAdminClients(t *testing.T) {
+	adminToken, _ := createClientToken("admin", []string{oauth.ScopeClientsAdmin}, time.Now().Add(time.Hour))
+	readToken, _ := createClientToken("admin", []string{oauth.ScopeUsersRead}, time.Now().Add(time.Hour))
+
+	t.Run("Create", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		repo := repository.NewMockRepositoryInterface(ctrl)
+		repo.EXPECT().FindOAuthClient(gomock.Any(), "admin").Return(repository.OAuthClient{ID: "admin"}, nil)
+		var stored repository.OAuthClient
+		repo.EXPECT().CreateOAuthClient(gomock.Any(), gomock.Any()).DoAndReturn(func(_ interface{}, client repository.OAuthClient) error {
+			stored = client
+			return nil
+		})
+		s := NewServer(NewServerOptions{Repository: repo})
+
+		req := httptest.NewRequest(http.MethodPost, "/admin/clients", strings.NewReader(`{"name": "billing", "scopes": ["users:read"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		rec := httptest.NewRecorder()
+
+		err := s.PostAdminClients(echo.New().NewContext(req, rec))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		var resp map[string]interface{}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, stored.ID, resp["id"])
+		assert.True(t, oauth.VerifySecret(stored, resp["client_secret"].(string)))
+		assert.NotContains(t, rec.Body.String(), stored.SecretHash)
+	})
+
+	t.Run("Invalid scope", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		repo := repository.NewMockRepositoryInterface(ctrl)
+		repo.EXPECT().FindOAuthClient(gomock.Any(), "admin").Return(repository.OAuthClient{ID: "admin"}, nil)
+		s := NewServer(NewServerOptions{Repository: repo})
+
+		req := httptest.NewRequest(http.MethodPost, "/admin/clients", strings.NewReader(`{"name": "billing", "scopes": ["profile:read"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		rec := httptest.NewRecorder()
+
+		err := s.PostAdminClients(echo.New().NewContext(req, rec))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, "{\"message\":\"Invalid scopes. Scopes must be users:read, users:import, users:export, tokens:introspect, clients:admin, scim, openid, profile, email or phone\"}\n", rec.Body.String())
+	})
+
+	t.Run("Forbidden without admin scope", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		s := NewServer(NewServerOptions{Repository: repository.NewMockRepositoryInterface(ctrl)})
+
+		req := httptest.NewRequest(http.MethodGet, "/admin/clients", nil)
+		req.Header.Set("Authorization", "Bearer "+readToken)
+		rec := httptest.NewRecorder()
+
+		err := s.GetAdminClients(echo.New().NewContext(req, rec))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("List", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		repo := repository.NewMockRepositoryInterface(ctrl)
+		repo.EXPECT().FindOAuthClient(gomock.Any(), "admin").Return(repository.OAuthClient{ID: "admin"}, nil)
+		repo.EXPECT().ListOAuthClients(gomock.Any()).Return([]repository.OAuthClient{{
+			ID:           "c1",
+			Name:         "billing",
+			SecretHash:   "secret-hash",
+			Scopes:       []string{oauth.ScopeUsersRead},
+			RedirectURIs: []string{},
+			CreatedAt:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		}}, nil)
+		s := NewServer(NewServerOptions{Repository: repo})
+
+		req := httptest.NewRequest(http.MethodGet, "/admin/clients", nil)
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		rec := httptest.NewRecorder()
+
+		err := s.GetAdminClients(echo.New().NewContext(req, rec))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "{\"clients\":[{\"created_at\":\"2024-01-02T03:04:05Z\",\"id\":\"c1\",\"name\":\"billing\",\"redirect_uris\":[],\"scopes\":[\"users:read\"]}]}\n", rec.Body.String())
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		repo := repository.NewMockRepositoryInterface(ctrl)
+		repo.EXPECT().FindOAuthClient(gomock.Any(), "admin").Return(repository.OAuthClient{ID: "admin"}, nil).Times(2)
+		repo.EXPECT().RevokeOAuthClient(gomock.Any(), "c1").Return(nil)
+		repo.EXPECT().RevokeOAuthClient(gomock.Any(), "c2").Return(repository.ErrNotFound)
+		s := NewServer(NewServerOptions{Repository: repo})
+
+		for id, status := range map[string]int{"c1": http.StatusNoContent, "c2": http.StatusNotFound} {
+			req := httptest.NewRequest(http.MethodDelete, "/admin/clients/"+id, nil)
+			req.Header.Set("Authorization", "Bearer "+adminToken)
+			rec := httptest.NewRecorder()
+
+			err := s.DeleteAdminClientsId(echo.New().NewContext(req, rec), id)
+			assert.NoError(t, err)
+			assert.Equal(t, status, rec.Code)
+		}
+	})
+}
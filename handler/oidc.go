@@ -0,0 +1,269 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/oauth"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/service"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+const (
+	// oidcAccessPurpose : purpose claim of access tokens issued to relying parties, only accepted by /userinfo
+	oidcAccessPurpose = "oidc_access"
+	// oidcTokenTTL : lifetime of id tokens and access tokens issued to relying parties
+	oidcTokenTTL = time.Hour
+	// signingKeyBits : size of the ephemeral RSA signing key
+	signingKeyBits = 2048
+)
+
+// codeVerifierRegex : PKCE code verifier as defined in RFC 7636 section 4.1
+var codeVerifierRegex = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// signingKey : key signing id tokens, generated once when the server was not given one
+func (s *Server) signingKey() (*rsa.PrivateKey, error) {
+	s.signingKeyOnce.Do(func() {
+		if s.SigningKey != nil {
+			return
+		}
+		log.Warn("OIDC signing key is not configured, id tokens are signed with an ephemeral key")
+		s.SigningKey, s.signingKeyErr = rsa.GenerateKey(rand.Reader, signingKeyBits)
+	})
+	return s.SigningKey, s.signingKeyErr
+}
+
+// keyID : JWK thumbprint of the public key as defined in RFC 7638, changes when the key is rotated
+func keyID(key *rsa.PublicKey) string {
+	thumbprint, _ := json.Marshal(map[string]string{
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		"kty": "RSA",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+	})
+	sum := sha256.Sum256(thumbprint)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// issuer : OpenID Connect issuer identifier, the public url of the service
+func (s *Server) issuer() string {
+	return strings.TrimSuffix(s.BaseURL, "/")
+}
+
+// createIDToken : sign id token of the user for the relying party
+func (s *Server) createIDToken(user repository.User, code repository.AuthorizationCode, now time.Time) (string, error) {
+	key, err := s.signingKey()
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{
+		"iss":       s.issuer(),
+		"sub":       user.ID,
+		"aud":       code.ClientID,
+		"azp":       code.ClientID,
+		"iat":       now.Unix(),
+		"exp":       now.Add(oidcTokenTTL).Unix(),
+		"auth_time": code.AuthTime.Unix(),
+	}
+	if code.Nonce != "" {
+		claims["nonce"] = code.Nonce
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID(&key.PublicKey)
+	return token.SignedString(key)
+}
+
+// createOIDCAccessToken : create access token of the relying party to read the user claims from /userinfo
+func createOIDCAccessToken(userID, clientID string, scopes []string, exp time.Time) (string, error) {
+	return signToken(jwt.MapClaims{
+		"sub":       userID,
+		"client_id": clientID,
+		"scope":     strings.Join(scopes, " "),
+		"purpose":   oidcAccessPurpose,
+		"exp":       exp.Unix(),
+	})
+}
+
+// userClaims : standard claims of the user released for the granted scopes
+func userClaims(user repository.User, scopes []string) map[string]interface{} {
+	claims := map[string]interface{}{"sub": user.ID}
+	if containsScope(scopes, oauth.ScopeProfile) {
+		claims["name"] = user.Name
+		if user.PreferredLanguage != nil {
+			claims["locale"] = *user.PreferredLanguage
+		}
+		if user.DateOfBirth != nil {
+			claims["birthdate"] = user.DateOfBirth.Format(service.DateLayout)
+		}
+		if user.AvatarURL != nil {
+			claims["picture"] = *user.AvatarURL
+		}
+	}
+	if containsScope(scopes, oauth.ScopeEmail) && user.Email != nil {
+		claims["email"] = *user.Email
+		claims["email_verified"] = user.EmailVerifiedAt != nil
+	}
+	if containsScope(scopes, oauth.ScopePhone) {
+		claims["phone_number"] = user.Phone
+	}
+	return claims
+}
+
+// verifyCodeChallenge : check the PKCE code verifier hashes to the S256 challenge sent to /authorize
+func verifyCodeChallenge(verifier, challenge string) bool {
+	if !codeVerifierRegex.MatchString(verifier) {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:]) == challenge
+}
+
+// authorizationCodeGrant : exchange authorization code of authenticated client for id token and access token
+func (s *Server) authorizationCodeGrant(ctx echo.Context, client repository.OAuthClient) error {
+	codeValue := ctx.FormValue("code")
+	verifier := ctx.FormValue("code_verifier")
+	if codeValue == "" || verifier == "" {
+		return oauthError(ctx, http.StatusBadRequest, "invalid_request", "code and code_verifier are required")
+	}
+
+	// The code is used even when the checks below fail, a leaked code cannot be retried
+	code, err := s.Repository.UseAuthorizationCode(ctx.Request().Context(), hashAuthorizationCode(codeValue))
+	if errors.Is(err, repository.ErrNotFound) {
+		return oauthError(ctx, http.StatusBadRequest, "invalid_grant", "Authorization code is invalid, expired or already used")
+	}
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": "server_error"})
+	}
+	if code.ClientID != client.ID || code.RedirectURI != ctx.FormValue("redirect_uri") {
+		return oauthError(ctx, http.StatusBadRequest, "invalid_grant", "Authorization code was issued to another client or redirect uri")
+	}
+	if !verifyCodeChallenge(verifier, code.CodeChallenge) {
+		return oauthError(ctx, http.StatusBadRequest, "invalid_grant", "code_verifier does not match code_challenge")
+	}
+
+	user, err := s.Repository.FindUser(ctx.Request().Context(), repository.Param{
+		Logic:    "AND",
+		Field:    "id",
+		Operator: "=",
+		Value:    code.UserID,
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return oauthError(ctx, http.StatusBadRequest, "invalid_grant", "User no longer exists")
+	}
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": "server_error"})
+	}
+
+	now := time.Now()
+	idToken, err := s.createIDToken(user, code, now)
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": "server_error"})
+	}
+	accessToken, err := createOIDCAccessToken(user.ID, client.ID, code.Scopes, now.Add(oidcTokenTTL))
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": "server_error"})
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(oidcTokenTTL.Seconds()),
+		"scope":        strings.Join(code.Scopes, " "),
+		"id_token":     idToken,
+	})
+}
+
+// GetUserinfo : this handler is for returning claims of the user to relying party, as defined in OpenID Connect Core section 5.3
+func (s *Server) GetUserinfo(ctx echo.Context) error {
+	claims, err := parseToken(bearerToken(ctx))
+	if err == nil && claims["purpose"] != oidcAccessPurpose {
+		err = fmt.Errorf("token is not an OpenID Connect access token")
+	}
+	if err != nil {
+		log.Error(err)
+		ctx.Response().Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid_token"})
+	}
+
+	userID, _ := claims["sub"].(string)
+	scope, _ := claims["scope"].(string)
+	user, err := s.Repository.FindUser(ctx.Request().Context(), repository.Param{
+		Logic:    "AND",
+		Field:    "id",
+		Operator: "=",
+		Value:    userID,
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		ctx.Response().Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid_token"})
+	}
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": "server_error"})
+	}
+
+	return ctx.JSON(http.StatusOK, userClaims(user, strings.Fields(scope)))
+}
+
+// GetOpenIDConfiguration : this handler is for the discovery document, as defined in OpenID Connect Discovery section 3
+func (s *Server) GetOpenIDConfiguration(ctx echo.Context) error {
+	issuer := s.issuer()
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/authorize",
+		"token_endpoint":                        issuer + "/oauth/token",
+		"userinfo_endpoint":                     issuer + "/userinfo",
+		"introspection_endpoint":                issuer + "/oauth/introspect",
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "client_credentials"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      []string{oauth.ScopeOpenID, oauth.ScopeProfile, oauth.ScopeEmail, oauth.ScopePhone},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported": []string{
+			"iss", "sub", "aud", "azp", "exp", "iat", "auth_time", "nonce",
+			"name", "locale", "birthdate", "picture", "email", "email_verified", "phone_number",
+		},
+	})
+}
+
+// GetJWKS : this handler is for the public keys relying parties verify id tokens with
+func (s *Server) GetJWKS(ctx echo.Context) error {
+	key, err := s.signingKey()
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	publicKey := &key.PublicKey
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": keyID(publicKey),
+			"n":   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		}},
+	})
+}
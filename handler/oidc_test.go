@@ -0,0 +1,403 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/oauth"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/service"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	oidcTestRedirectURI = "http://localhost:3000/callback"
+	oidcTestPassword    = "Passw0rd!"
+)
+
+// oidcProvider : user service serving the generated routes over http, repository backed by maps
+type oidcProvider struct {
+	server *httptest.Server
+	client repository.OAuthClient
+	secret string
+	user   repository.User
+}
+
+func newOIDCProvider(t *testing.T) *oidcProvider {
+	client, secret, err := oauth.NewClient(oauth.NewClientOptions{
+		Name:         "Dashboard",
+		Scopes:       []string{oauth.ScopeOpenID, oauth.ScopeProfile, oauth.ScopeEmail, oauth.ScopePhone},
+		RedirectURIs: []string{oidcTestRedirectURI},
+	})
+	require.NoError(t, err)
+
+	salt, _ := service.RandomSaltGenerator{}.Generate()
+	password, _ := service.BcryptHasher{}.Hash(oidcTestPassword, salt)
+	email := "budi@example.com"
+	verifiedAt := time.Now()
+	user := repository.User{
+		ID:              "7f2b6c1e-0a41-4f4e-9a55-2f9e6f3b8d10",
+		Phone:           "+62812345678",
+		Name:            "Budi",
+		Password:        password,
+		Salt:            salt,
+		Email:           &email,
+		EmailVerifiedAt: &verifiedAt,
+	}
+
+	var mu sync.Mutex
+	codes := map[string]repository.AuthorizationCode{}
+
+	ctrl := gomock.NewController(t)
+	repo := repository.NewMockRepositoryInterface(ctrl)
+	repo.EXPECT().FindOAuthClient(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, id string) (repository.OAuthClient, error) {
+		if id != client.ID {
+			return repository.OAuthClient{}, repository.ErrNotFound
+		}
+		return client, nil
+	}).AnyTimes()
+	repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, params ...repository.Param) (repository.User, error) {
+		param := params[0]
+		if (param.Field == "id" && param.Value == user.ID) || (param.Field == "phone" && param.Value == user.Phone) || (param.Field == "email" && param.Value == email) {
+			return user, nil
+		}
+		return repository.User{}, repository.ErrNotFound
+	}).AnyTimes()
+	repo.EXPECT().FindVerifiedEmailUser(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, value string) (repository.User, error) {
+		if value == email {
+			return user, nil
+		}
+		return repository.User{}, repository.ErrNotFound
+	}).AnyTimes()
+	repo.EXPECT().CreateAuthorizationCode(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, code repository.AuthorizationCode) error {
+		mu.Lock()
+		defer mu.Unlock()
+		codes[code.CodeHash] = code
+		return nil
+	}).AnyTimes()
+	repo.EXPECT().UseAuthorizationCode(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, codeHash string) (repository.AuthorizationCode, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		code, ok := codes[codeHash]
+		if !ok || time.Now().After(code.ExpiresAt) {
+			return repository.AuthorizationCode{}, repository.ErrNotFound
+		}
+		delete(codes, codeHash)
+		return code, nil
+	}).AnyTimes()
+	repo.EXPECT().IncreaseLoginAttempt(gomock.Any(), user.Phone).Return(nil).AnyTimes()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	s := NewServer(NewServerOptions{Repository: repo, SigningKey: key})
+	e := echo.New()
+	generated.RegisterHandlers(e, s)
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+	s.BaseURL = server.URL
+
+	return &oidcProvider{server: server, client: client, secret: secret, user: user}
+}
+
+// relyingParty : minimal OpenID Connect client, as a web dashboard would use the provider
+type relyingParty struct {
+	t        *testing.T
+	http     *http.Client
+	clientID string
+	secret   string
+	config   map[string]interface{}
+}
+
+func newRelyingParty(t *testing.T, issuer, clientID, secret string) *relyingParty {
+	rp := &relyingParty{
+		t: t,
+		http: &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			// The redirect to the relying party is inspected instead of followed
+			return http.ErrUseLastResponse
+		}},
+		clientID: clientID,
+		secret:   secret,
+	}
+	rp.getJSON(issuer+"/.well-known/openid-configuration", "", &rp.config)
+	assert.Equal(t, issuer, rp.config["issuer"])
+	return rp
+}
+
+func (rp *relyingParty) endpoint(name string) string {
+	return rp.config[name].(string)
+}
+
+func (rp *relyingParty) getJSON(endpoint, bearer string, v interface{}) int {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	require.NoError(rp.t, err)
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	resp, err := rp.http.Do(req)
+	require.NoError(rp.t, err)
+	defer resp.Body.Close()
+	require.NoError(rp.t, json.NewDecoder(resp.Body).Decode(v))
+	return resp.StatusCode
+}
+
+// authorizeParams : authorization request with PKCE, returning the code verifier kept by the relying party
+func (rp *relyingParty) authorizeParams(scope, state, nonce string) (url.Values, string) {
+	random := make([]byte, 32)
+	_, _ = rand.Read(random)
+	verifier := base64.RawURLEncoding.EncodeToString(random)
+	challenge := sha256.Sum256([]byte(verifier))
+
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {rp.clientID},
+		"redirect_uri":          {oidcTestRedirectURI},
+		"scope":                 {scope},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}, verifier
+}
+
+// submitLogin : post the login and consent page as the browser of the user would
+func (rp *relyingParty) submitLogin(params url.Values, login, password, consent string) *http.Response {
+	form := url.Values{}
+	for name, values := range params {
+		form[name] = values
+	}
+	form.Set("login", login)
+	form.Set("password", password)
+	form.Set("consent", consent)
+
+	resp, err := rp.http.PostForm(rp.endpoint("authorization_endpoint"), form)
+	require.NoError(rp.t, err)
+	resp.Body.Close()
+	return resp
+}
+
+func (rp *relyingParty) exchange(code, verifier string) (int, map[string]interface{}) {
+	req, err := http.NewRequest(http.MethodPost, rp.endpoint("token_endpoint"), strings.NewReader(url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {oidcTestRedirectURI},
+		"code_verifier": {verifier},
+	}.Encode()))
+	require.NoError(rp.t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(rp.clientID), url.QueryEscape(rp.secret))
+
+	resp, err := rp.http.Do(req)
+	require.NoError(rp.t, err)
+	defer resp.Body.Close()
+	var body map[string]interface{}
+	require.NoError(rp.t, json.NewDecoder(resp.Body).Decode(&body))
+	return resp.StatusCode, body
+}
+
+// verifyIDToken : check signature with the published JWKS and the claims a relying party must validate
+func (rp *relyingParty) verifyIDToken(idToken, nonce string) jwt.MapClaims {
+	var jwks struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	rp.getJSON(rp.endpoint("jwks_uri"), "", &jwks)
+
+	token, err := jwt.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodRS256 {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		for _, jwk := range jwks.Keys {
+			if jwk["kid"] != token.Header["kid"] {
+				continue
+			}
+			n, _ := base64.RawURLEncoding.DecodeString(jwk["n"])
+			e, _ := base64.RawURLEncoding.DecodeString(jwk["e"])
+			return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+		}
+		return nil, fmt.Errorf("unknown kid %v", token.Header["kid"])
+	})
+	require.NoError(rp.t, err)
+
+	claims := token.Claims.(jwt.MapClaims)
+	assert.Equal(rp.t, rp.config["issuer"], claims["iss"])
+	assert.Equal(rp.t, rp.clientID, claims["aud"])
+	assert.Equal(rp.t, nonce, claims["nonce"])
+	return claims
+}
+
+func TestOIDCAuthorizationCodeFlow(t *testing.T) {
+	provider := newOIDCProvider(t)
+	rp := newRelyingParty(t, provider.server.URL, provider.client.ID, provider.secret)
+
+	params, verifier := rp.authorizeParams("openid profile email", "state-123", "nonce-456")
+
+	// Login and consent page
+	resp, err := rp.http.Get(rp.endpoint("authorization_endpoint") + "?" + params.Encode())
+	require.NoError(t, err)
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "DENY", resp.Header.Get("X-Frame-Options"))
+	assert.Contains(t, string(page), "Sign in to Dashboard")
+	assert.Contains(t, string(page), "Your email address")
+	assert.NotContains(t, string(page), "Your phone number")
+
+	// Redirect back with code and state
+	resp = rp.submitLogin(params, "0812345678", oidcTestPassword, "allow")
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:3000", location.Host)
+	assert.Equal(t, "state-123", location.Query().Get("state"))
+	code := location.Query().Get("code")
+	require.NotEmpty(t, code)
+
+	// Token exchange with PKCE
+	status, tokens := rp.exchange(code, verifier)
+	require.Equal(t, http.StatusOK, status, tokens)
+	assert.Equal(t, "Bearer", tokens["token_type"])
+	assert.Equal(t, "openid profile email", tokens["scope"])
+
+	claims := rp.verifyIDToken(tokens["id_token"].(string), "nonce-456")
+	assert.Equal(t, provider.user.ID, claims["sub"])
+
+	// Userinfo returns claims of the granted scopes only
+	var userinfo map[string]interface{}
+	status = rp.getJSON(rp.endpoint("userinfo_endpoint"), tokens["access_token"].(string), &userinfo)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, map[string]interface{}{
+		"sub":            provider.user.ID,
+		"name":           "Budi",
+		"email":          "budi@example.com",
+		"email_verified": true,
+	}, userinfo)
+
+	// The code is single use
+	status, body := rp.exchange(code, verifier)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "invalid_grant", body["error"])
+
+	// Access token of the relying party is not a user token
+	req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens["access_token"].(string))
+	_, err = validateToken(echo.New().NewContext(req, httptest.NewRecorder()))
+	assert.Error(t, err)
+}
+
+func TestOIDCAuthorizationErrors(t *testing.T) {
+	provider := newOIDCProvider(t)
+	rp := newRelyingParty(t, provider.server.URL, provider.client.ID, provider.secret)
+
+	t.Run("Unknown client is shown, not redirected", func(t *testing.T) {
+		params, _ := rp.authorizeParams("openid", "s", "n")
+		params.Set("client_id", "unknown")
+		resp, err := rp.http.Get(rp.endpoint("authorization_endpoint") + "?" + params.Encode())
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("Location"))
+	})
+
+	t.Run("Unregistered redirect uri is shown, not redirected", func(t *testing.T) {
+		params, _ := rp.authorizeParams("openid", "s", "n")
+		params.Set("redirect_uri", "https://attacker.example.com/callback")
+		resp, err := rp.http.Get(rp.endpoint("authorization_endpoint") + "?" + params.Encode())
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("Location"))
+	})
+
+	for name, tt := range map[string]struct {
+		change func(params url.Values)
+		error  string
+	}{
+		"Missing openid scope": {func(params url.Values) { params.Set("scope", "profile") }, "invalid_scope"},
+		"Unknown scope":        {func(params url.Values) { params.Set("scope", "openid users:read") }, "invalid_scope"},
+		"Missing PKCE":         {func(params url.Values) { params.Del("code_challenge") }, "invalid_request"},
+		"Plain PKCE":           {func(params url.Values) { params.Set("code_challenge_method", "plain") }, "invalid_request"},
+		"Implicit flow":        {func(params url.Values) { params.Set("response_type", "token") }, "unsupported_response_type"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			params, _ := rp.authorizeParams("openid", "s", "n")
+			tt.change(params)
+			resp, err := rp.http.Get(rp.endpoint("authorization_endpoint") + "?" + params.Encode())
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, http.StatusFound, resp.StatusCode)
+			location, _ := url.Parse(resp.Header.Get("Location"))
+			assert.Equal(t, tt.error, location.Query().Get("error"))
+			assert.Equal(t, "s", location.Query().Get("state"))
+		})
+	}
+
+	t.Run("User denies", func(t *testing.T) {
+		params, _ := rp.authorizeParams("openid", "s", "n")
+		resp := rp.submitLogin(params, "", "", "deny")
+		require.Equal(t, http.StatusFound, resp.StatusCode)
+		location, _ := url.Parse(resp.Header.Get("Location"))
+		assert.Equal(t, "access_denied", location.Query().Get("error"))
+	})
+
+	t.Run("Wrong password shows the page again", func(t *testing.T) {
+		params, _ := rp.authorizeParams("openid", "s", "n")
+		resp := rp.submitLogin(params, "budi@example.com", "Wrong0rd!", "allow")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("Location"))
+	})
+
+	t.Run("Wrong code verifier", func(t *testing.T) {
+		params, _ := rp.authorizeParams("openid", "s", "n")
+		resp := rp.submitLogin(params, "budi@example.com", oidcTestPassword, "allow")
+		require.Equal(t, http.StatusFound, resp.StatusCode)
+		location, _ := url.Parse(resp.Header.Get("Location"))
+
+		_, otherVerifier := rp.authorizeParams("openid", "s", "n")
+		status, body := rp.exchange(location.Query().Get("code"), otherVerifier)
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, "invalid_grant", body["error"])
+	})
+
+	t.Run("User token is not accepted by userinfo", func(t *testing.T) {
+		token, _ := createToken(provider.user.ID, time.Now().Add(time.Hour))
+		var body map[string]interface{}
+		status := rp.getJSON(rp.endpoint("userinfo_endpoint"), token, &body)
+		assert.Equal(t, http.StatusUnauthorized, status)
+	})
+}
+
+func TestUserClaims(t *testing.T) {
+	language := "id"
+	dateOfBirth := time.Date(1990, 2, 3, 0, 0, 0, 0, time.UTC)
+	email := "budi@example.com"
+	user := repository.User{ID: "u1", Name: "Budi", Phone: "+62812345678", PreferredLanguage: &language, DateOfBirth: &dateOfBirth, Email: &email}
+
+	assert.Equal(t, map[string]interface{}{"sub": "u1"}, userClaims(user, []string{oauth.ScopeOpenID}))
+	assert.Equal(t, map[string]interface{}{
+		"sub":            "u1",
+		"name":           "Budi",
+		"locale":         "id",
+		"birthdate":      "1990-02-03",
+		"email":          "budi@example.com",
+		"email_verified": false,
+		"phone_number":   "+62812345678",
+	}, userClaims(user, []string{oauth.ScopeOpenID, oauth.ScopeProfile, oauth.ScopeEmail, oauth.ScopePhone}))
+}
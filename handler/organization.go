@@ -0,0 +1,344 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// organizationRoles : roles a member can be given
+var organizationRoles = map[string]bool{
+	repository.RoleOwner:  true,
+	repository.RoleAdmin:  true,
+	repository.RoleMember: true,
+}
+
+const invalidRoleMessage = "Invalid role. Role must be owner, admin or member"
+
+// canManage : owners manage every member, admins manage admins and members, members manage nobody
+func canManage(actor string, role string) bool {
+	switch actor {
+	case repository.RoleOwner:
+		return true
+	case repository.RoleAdmin:
+		return role != repository.RoleOwner
+	default:
+		return false
+	}
+}
+
+func toOrganization(membership repository.Membership) generated.Organization {
+	return generated.Organization{
+		Id:       membership.OrganizationID,
+		Name:     membership.OrganizationName,
+		Role:     membership.Role,
+		JoinedAt: membership.CreatedAt,
+	}
+}
+
+func toOrganizationMember(membership repository.Membership) generated.OrganizationMember {
+	return generated.OrganizationMember{
+		UserId:   membership.UserID,
+		Name:     membership.Name,
+		Phone:    membership.Phone,
+		Role:     membership.Role,
+		JoinedAt: membership.CreatedAt,
+	}
+}
+
+// findMembership : membership of the user, repository.ErrNotFound for malformed ids so they are reported as not found
+func (s *Server) findMembership(ctx echo.Context, organizationID string, userID string) (repository.Membership, error) {
+	if _, err := uuid.Parse(organizationID); err != nil {
+		return repository.Membership{}, repository.ErrNotFound
+	}
+	if _, err := uuid.Parse(userID); err != nil {
+		return repository.Membership{}, repository.ErrNotFound
+	}
+	return s.Repository.FindMembership(ctx.Request().Context(), organizationID, userID)
+}
+
+// PostOrganizations : this handler is for creating organization, the user becomes its owner
+func (s *Server) PostOrganizations(ctx echo.Context) error {
+	ID, err := s.authenticate(ctx, "")
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
+	}
+
+	req := new(generated.PostOrganizationsJSONRequestBody)
+	if err := ctx.Bind(req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request payload"})
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid name. Name must be between 1 and 100 characters"})
+	}
+
+	organization := repository.Organization{
+		ID:        uuid.NewString(),
+		Name:      name,
+		CreatedAt: time.Now(),
+	}
+	err = s.Repository.CreateOrganization(ctx.Request().Context(), organization, ID)
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	return ctx.JSON(http.StatusCreated, toOrganization(repository.Membership{
+		OrganizationID:   organization.ID,
+		OrganizationName: organization.Name,
+		UserID:           ID,
+		Role:             repository.RoleOwner,
+		CreatedAt:        organization.CreatedAt,
+	}))
+}
+
+// GetOrganizations : this handler is for listing organizations of the user with the role in each of them
+func (s *Server) GetOrganizations(ctx echo.Context) error {
+	ID, err := s.authenticate(ctx, "")
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
+	}
+
+	memberships, err := s.Repository.ListUserMemberships(ctx.Request().Context(), ID)
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	resp := make([]generated.Organization, 0, len(memberships))
+	for _, membership := range memberships {
+		resp = append(resp, toOrganization(membership))
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"organizations": resp})
+}
+
+// PostOrganizationsIdSwitch : this handler is for switching the active organization, a new token with its org_id is returned
+func (s *Server) PostOrganizationsIdSwitch(ctx echo.Context, id string) error {
+	ID, err := s.authenticate(ctx, "")
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
+	}
+
+	_, err = s.findMembership(ctx, id, ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ctx.JSON(http.StatusNotFound, map[string]string{"message": "Organization not found"})
+	}
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	token, err := createOrganizationToken(ID, id, time.Now().Add(time.Hour*1))
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+	return ctx.JSON(http.StatusOK, map[string]string{"message": "Organization switched", "token": token, "org_id": id})
+}
+
+// GetOrganizationsIdMembers : this handler is for listing members, only members of the organization can see them
+func (s *Server) GetOrganizationsIdMembers(ctx echo.Context, id string) error {
+	ID, err := s.authenticate(ctx, "")
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
+	}
+
+	_, err = s.findMembership(ctx, id, ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ctx.JSON(http.StatusNotFound, map[string]string{"message": "Organization not found"})
+	}
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	members, err := s.Repository.ListOrganizationMembers(ctx.Request().Context(), id)
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	resp := make([]generated.OrganizationMember, 0, len(members))
+	for _, member := range members {
+		resp = append(resp, toOrganizationMember(member))
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"members": resp})
+}
+
+// PostOrganizationsIdMembers : this handler is for adding registered user to the organization by phone number
+func (s *Server) PostOrganizationsIdMembers(ctx echo.Context, id string) error {
+	ID, err := s.authenticate(ctx, "")
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
+	}
+
+	req := new(generated.PostOrganizationsIdMembersJSONRequestBody)
+	if err := ctx.Bind(req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request payload"})
+	}
+	if !organizationRoles[req.Role] {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": invalidRoleMessage})
+	}
+	phoneNumber, err := s.Users.NormalizePhone(req.Phone)
+	if err != nil {
+		return respondError(ctx, serviceError(err, "Internal Server Error"))
+	}
+
+	actor, err := s.findMembership(ctx, id, ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ctx.JSON(http.StatusNotFound, map[string]string{"message": "Organization not found"})
+	}
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+	if !canManage(actor.Role, req.Role) {
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Only owners and admins can add members, and only owners can add owners"})
+	}
+
+	user, err := s.Repository.FindUser(ctx.Request().Context(), repository.Param{
+		Logic:    "AND",
+		Field:    "phone",
+		Operator: "=",
+		Value:    phoneNumber,
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return ctx.JSON(http.StatusNotFound, map[string]string{"message": "User not found"})
+	}
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	err = s.Repository.AddMember(ctx.Request().Context(), id, user.ID, req.Role)
+	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			return ctx.JSON(http.StatusConflict, map[string]string{"message": "User is already a member"})
+		}
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	return ctx.JSON(http.StatusCreated, toOrganizationMember(repository.Membership{
+		OrganizationID:   id,
+		OrganizationName: actor.OrganizationName,
+		UserID:           user.ID,
+		Name:             user.Name,
+		Phone:            user.Phone,
+		Role:             req.Role,
+		CreatedAt:        time.Now(),
+	}))
+}
+
+// PatchOrganizationsIdMembersUserId : this handler is for changing role of member, the last owner cannot be demoted
+func (s *Server) PatchOrganizationsIdMembersUserId(ctx echo.Context, id string, userId string) error {
+	ID, err := s.authenticate(ctx, "")
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
+	}
+
+	req := new(generated.PatchOrganizationsIdMembersUserIdJSONRequestBody)
+	if err := ctx.Bind(req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request payload"})
+	}
+	if !organizationRoles[req.Role] {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": invalidRoleMessage})
+	}
+
+	actor, err := s.findMembership(ctx, id, ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ctx.JSON(http.StatusNotFound, map[string]string{"message": "Organization not found"})
+	}
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	member, err := s.findMembership(ctx, id, userId)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ctx.JSON(http.StatusNotFound, map[string]string{"message": "Member not found"})
+	}
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+	if !canManage(actor.Role, member.Role) || !canManage(actor.Role, req.Role) {
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Only owners and admins can change roles, and only owners can manage owners"})
+	}
+
+	err = s.Repository.UpdateMemberRole(ctx.Request().Context(), id, userId, req.Role)
+	if errors.Is(err, repository.ErrLastOwner) {
+		return ctx.JSON(http.StatusConflict, map[string]string{"message": "Organization must keep at least one owner"})
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		return ctx.JSON(http.StatusNotFound, map[string]string{"message": "Member not found"})
+	}
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	member.Role = req.Role
+	return ctx.JSON(http.StatusOK, toOrganizationMember(member))
+}
+
+// DeleteOrganizationsIdMembersUserId : this handler is for removing member, every member can leave the organization
+func (s *Server) DeleteOrganizationsIdMembersUserId(ctx echo.Context, id string, userId string) error {
+	ID, err := s.authenticate(ctx, "")
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
+	}
+
+	actor, err := s.findMembership(ctx, id, ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ctx.JSON(http.StatusNotFound, map[string]string{"message": "Organization not found"})
+	}
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	if userId != ID {
+		member, err := s.findMembership(ctx, id, userId)
+		if errors.Is(err, repository.ErrNotFound) {
+			return ctx.JSON(http.StatusNotFound, map[string]string{"message": "Member not found"})
+		}
+		if err != nil {
+			log.Error(err)
+			return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+		}
+		if !canManage(actor.Role, member.Role) {
+			return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Only owners and admins can remove members, and only owners can remove owners"})
+		}
+	}
+
+	err = s.Repository.RemoveMember(ctx.Request().Context(), id, userId)
+	if errors.Is(err, repository.ErrLastOwner) {
+		return ctx.JSON(http.StatusConflict, map[string]string{"message": "Organization must keep at least one owner"})
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		return ctx.JSON(http.StatusNotFound, map[string]string{"message": "Member not found"})
+	}
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,410 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testOrganizationID = "0b6f1b9e-6f0c-4d61-9a7e-3c2f5d8a1e01"
+	testOwnerID        = "1c7a2d8f-7e1d-4e72-8b8f-4d3a6e9b2f02"
+	testAdminID        = "2d8b3e9a-8f2e-4f83-9c9a-5e4b7f0c3a03"
+	testMemberID       = "3e9c4f0b-9a3f-4a94-8dab-6f5c8a1d4b04"
+)
+
+func testMembership(userID string, role string) repository.Membership {
+	return repository.Membership{
+		OrganizationID:   testOrganizationID,
+		OrganizationName: "Kebun Sawit Riau",
+		UserID:           userID,
+		Name:             "User",
+		Phone:            "+62856712332",
+		Role:             role,
+	}
+}
+
+// organizationRequest : run handler with JSON body and bearer token of the user
+func organizationRequest(t *testing.T, prepare func(repo *repository.MockRepositoryInterface), method string, userID string, body string, handle func(s *Server, c echo.Context) error) *httptest.ResponseRecorder {
+	ctrl := gomock.NewController(t)
+	repo := repository.NewMockRepositoryInterface(ctrl)
+	expectActiveUser(repo, userID)
+	if prepare != nil {
+		prepare(repo)
+	}
+	s := NewServer(NewServerOptions{Repository: repo})
+
+	token, _ := createToken(userID, time.Now().Add(time.Hour))
+	req := httptest.NewRequest(method, "/organizations", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+
+	err := handle(s, echo.New().NewContext(req, rec))
+	assert.NoError(t, err)
+	return rec
+}
+
+func TestCanManage(t *testing.T) {
+	assert.True(t, canManage(repository.RoleOwner, repository.RoleOwner))
+	assert.True(t, canManage(repository.RoleOwner, repository.RoleMember))
+	assert.True(t, canManage(repository.RoleAdmin, repository.RoleAdmin))
+	assert.True(t, canManage(repository.RoleAdmin, repository.RoleMember))
+	assert.False(t, canManage(repository.RoleAdmin, repository.RoleOwner))
+	assert.False(t, canManage(repository.RoleMember, repository.RoleMember))
+}
+
+func TestPostOrganizations(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(repo *repository.MockRepositoryInterface)
+		args    string
+		status  int
+	}{
+		{
+			name: "Success",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().CreateOrganization(gomock.Any(), gomock.Any(), testOwnerID).DoAndReturn(func(_ interface{}, organization repository.Organization, _ string) error {
+					assert.Equal(t, "Kebun Sawit Riau", organization.Name)
+					assert.NotEmpty(t, organization.ID)
+					return nil
+				})
+			},
+			args:   `{"name": " Kebun Sawit Riau "}`,
+			status: http.StatusCreated,
+		}, {
+			name:   "Invalid name",
+			args:   `{"name": "  "}`,
+			status: http.StatusBadRequest,
+		}, {
+			name: "Repository error",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().CreateOrganization(gomock.Any(), gomock.Any(), testOwnerID).Return(sql.ErrConnDone)
+			},
+			args:   `{"name": "Kebun Sawit Riau"}`,
+			status: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := organizationRequest(t, tt.prepare, http.MethodPost, testOwnerID, tt.args, func(s *Server, c echo.Context) error {
+				return s.PostOrganizations(c)
+			})
+			assert.Equal(t, tt.status, rec.Code)
+			if tt.status == http.StatusCreated {
+				var resp map[string]interface{}
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+				assert.Equal(t, "Kebun Sawit Riau", resp["name"])
+				assert.Equal(t, repository.RoleOwner, resp["role"])
+			}
+		})
+	}
+}
+
+func TestPostOrganizationsIdSwitch(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		rec := organizationRequest(t, func(repo *repository.MockRepositoryInterface) {
+			repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testMemberID).Return(testMembership(testMemberID, repository.RoleMember), nil)
+		}, http.MethodPost, testMemberID, "", func(s *Server, c echo.Context) error {
+			return s.PostOrganizationsIdSwitch(c, testOrganizationID)
+		})
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var resp map[string]string
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, testOrganizationID, resp["org_id"])
+		claims, err := parseToken(resp["token"])
+		assert.NoError(t, err)
+		assert.Equal(t, testMemberID, claims["id"])
+		assert.Equal(t, testOrganizationID, claims["org_id"])
+	})
+
+	t.Run("Not a member", func(t *testing.T) {
+		rec := organizationRequest(t, func(repo *repository.MockRepositoryInterface) {
+			repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testMemberID).Return(repository.Membership{}, repository.ErrNotFound)
+		}, http.MethodPost, testMemberID, "", func(s *Server, c echo.Context) error {
+			return s.PostOrganizationsIdSwitch(c, testOrganizationID)
+		})
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("Malformed id", func(t *testing.T) {
+		rec := organizationRequest(t, nil, http.MethodPost, testMemberID, "", func(s *Server, c echo.Context) error {
+			return s.PostOrganizationsIdSwitch(c, "asd")
+		})
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestGetOrganizationsIdMembers(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		rec := organizationRequest(t, func(repo *repository.MockRepositoryInterface) {
+			repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testMemberID).Return(testMembership(testMemberID, repository.RoleMember), nil)
+			repo.EXPECT().ListOrganizationMembers(gomock.Any(), testOrganizationID).Return([]repository.Membership{
+				testMembership(testOwnerID, repository.RoleOwner),
+				testMembership(testMemberID, repository.RoleMember),
+			}, nil)
+		}, http.MethodGet, testMemberID, "", func(s *Server, c echo.Context) error {
+			return s.GetOrganizationsIdMembers(c, testOrganizationID)
+		})
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var resp struct {
+			Members []map[string]interface{} `json:"members"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Len(t, resp.Members, 2)
+		assert.Equal(t, testOwnerID, resp.Members[0]["user_id"])
+	})
+
+	t.Run("Other organization", func(t *testing.T) {
+		rec := organizationRequest(t, func(repo *repository.MockRepositoryInterface) {
+			repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testMemberID).Return(repository.Membership{}, repository.ErrNotFound)
+		}, http.MethodGet, testMemberID, "", func(s *Server, c echo.Context) error {
+			return s.GetOrganizationsIdMembers(c, testOrganizationID)
+		})
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestPostOrganizationsIdMembers(t *testing.T) {
+	user := repository.User{ID: testMemberID, Name: "User", Phone: "+62856712332"}
+	phoneParam := repository.Param{Logic: "AND", Field: "phone", Operator: "=", Value: "+62856712332"}
+
+	tests := []struct {
+		name    string
+		prepare func(repo *repository.MockRepositoryInterface)
+		actor   string
+		args    string
+		status  int
+		content string
+	}{
+		{
+			name: "Success",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testAdminID).Return(testMembership(testAdminID, repository.RoleAdmin), nil)
+				repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(user, nil)
+				repo.EXPECT().AddMember(gomock.Any(), testOrganizationID, testMemberID, repository.RoleMember).Return(nil)
+			},
+			actor:  testAdminID,
+			args:   `{"phone": "0856712332", "role": "member"}`,
+			status: http.StatusCreated,
+		}, {
+			name:    "Invalid role",
+			actor:   testOwnerID,
+			args:    `{"phone": "0856712332", "role": "superuser"}`,
+			status:  http.StatusBadRequest,
+			content: "{\"message\":\"Invalid role. Role must be owner, admin or member\"}\n",
+		}, {
+			name: "Member cannot add members",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testMemberID).Return(testMembership(testMemberID, repository.RoleMember), nil)
+			},
+			actor:  testMemberID,
+			args:   `{"phone": "0856712332", "role": "member"}`,
+			status: http.StatusForbidden,
+		}, {
+			name: "Admin cannot add owners",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testAdminID).Return(testMembership(testAdminID, repository.RoleAdmin), nil)
+			},
+			actor:  testAdminID,
+			args:   `{"phone": "0856712332", "role": "owner"}`,
+			status: http.StatusForbidden,
+		}, {
+			name: "User not found",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testOwnerID).Return(testMembership(testOwnerID, repository.RoleOwner), nil)
+				repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(repository.User{}, repository.ErrNotFound)
+			},
+			actor:   testOwnerID,
+			args:    `{"phone": "0856712332", "role": "member"}`,
+			status:  http.StatusNotFound,
+			content: "{\"message\":\"User not found\"}\n",
+		}, {
+			name: "Already a member",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testOwnerID).Return(testMembership(testOwnerID, repository.RoleOwner), nil)
+				repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(user, nil)
+				repo.EXPECT().AddMember(gomock.Any(), testOrganizationID, testMemberID, repository.RoleAdmin).Return(repository.ErrConflict)
+			},
+			actor:   testOwnerID,
+			args:    `{"phone": "0856712332", "role": "admin"}`,
+			status:  http.StatusConflict,
+			content: "{\"message\":\"User is already a member\"}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := organizationRequest(t, tt.prepare, http.MethodPost, tt.actor, tt.args, func(s *Server, c echo.Context) error {
+				return s.PostOrganizationsIdMembers(c, testOrganizationID)
+			})
+			assert.Equal(t, tt.status, rec.Code)
+			if tt.content != "" {
+				assert.Equal(t, tt.content, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestPatchOrganizationsIdMembersUserId(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(repo *repository.MockRepositoryInterface)
+		actor   string
+		target  string
+		args    string
+		status  int
+	}{
+		{
+			name: "Success",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testOwnerID).Return(testMembership(testOwnerID, repository.RoleOwner), nil)
+				repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testMemberID).Return(testMembership(testMemberID, repository.RoleMember), nil)
+				repo.EXPECT().UpdateMemberRole(gomock.Any(), testOrganizationID, testMemberID, repository.RoleAdmin).Return(nil)
+			},
+			actor:  testOwnerID,
+			target: testMemberID,
+			args:   `{"role": "admin"}`,
+			status: http.StatusOK,
+		}, {
+			name: "Admin cannot demote owner",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testAdminID).Return(testMembership(testAdminID, repository.RoleAdmin), nil)
+				repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testOwnerID).Return(testMembership(testOwnerID, repository.RoleOwner), nil)
+			},
+			actor:  testAdminID,
+			target: testOwnerID,
+			args:   `{"role": "member"}`,
+			status: http.StatusForbidden,
+		}, {
+			name: "Last owner",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testOwnerID).Return(testMembership(testOwnerID, repository.RoleOwner), nil).Times(2)
+				repo.EXPECT().UpdateMemberRole(gomock.Any(), testOrganizationID, testOwnerID, repository.RoleAdmin).Return(repository.ErrLastOwner)
+			},
+			actor:  testOwnerID,
+			target: testOwnerID,
+			args:   `{"role": "admin"}`,
+			status: http.StatusConflict,
+		}, {
+			name: "Member not found",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testOwnerID).Return(testMembership(testOwnerID, repository.RoleOwner), nil)
+			},
+			actor:  testOwnerID,
+			target: "asd",
+			args:   `{"role": "admin"}`,
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := organizationRequest(t, tt.prepare, http.MethodPatch, tt.actor, tt.args, func(s *Server, c echo.Context) error {
+				return s.PatchOrganizationsIdMembersUserId(c, testOrganizationID, tt.target)
+			})
+			assert.Equal(t, tt.status, rec.Code)
+		})
+	}
+}
+
+func TestDeleteOrganizationsIdMembersUserId(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(repo *repository.MockRepositoryInterface)
+		actor   string
+		target  string
+		status  int
+	}{
+		{
+			name: "Member leaves",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testMemberID).Return(testMembership(testMemberID, repository.RoleMember), nil)
+				repo.EXPECT().RemoveMember(gomock.Any(), testOrganizationID, testMemberID).Return(nil)
+			},
+			actor:  testMemberID,
+			target: testMemberID,
+			status: http.StatusNoContent,
+		}, {
+			name: "Admin removes member",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testAdminID).Return(testMembership(testAdminID, repository.RoleAdmin), nil)
+				repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testMemberID).Return(testMembership(testMemberID, repository.RoleMember), nil)
+				repo.EXPECT().RemoveMember(gomock.Any(), testOrganizationID, testMemberID).Return(nil)
+			},
+			actor:  testAdminID,
+			target: testMemberID,
+			status: http.StatusNoContent,
+		}, {
+			name: "Member cannot remove others",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testMemberID).Return(testMembership(testMemberID, repository.RoleMember), nil)
+				repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testAdminID).Return(testMembership(testAdminID, repository.RoleAdmin), nil)
+			},
+			actor:  testMemberID,
+			target: testAdminID,
+			status: http.StatusForbidden,
+		}, {
+			name: "Last owner cannot leave",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testOwnerID).Return(testMembership(testOwnerID, repository.RoleOwner), nil)
+				repo.EXPECT().RemoveMember(gomock.Any(), testOrganizationID, testOwnerID).Return(repository.ErrLastOwner)
+			},
+			actor:  testOwnerID,
+			target: testOwnerID,
+			status: http.StatusConflict,
+		}, {
+			name: "Not a member",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindMembership(gomock.Any(), testOrganizationID, testAdminID).Return(repository.Membership{}, repository.ErrNotFound)
+			},
+			actor:  testAdminID,
+			target: testMemberID,
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := organizationRequest(t, tt.prepare, http.MethodDelete, tt.actor, "", func(s *Server, c echo.Context) error {
+				return s.DeleteOrganizationsIdMembersUserId(c, testOrganizationID, tt.target)
+			})
+			assert.Equal(t, tt.status, rec.Code)
+		})
+	}
+}
+
+func TestLoginActiveOrganization(t *testing.T) {
+	rec := organizationRequest(t, func(repo *repository.MockRepositoryInterface) {
+		repo.EXPECT().FindUser(gomock.Any(), gomock.Any()).Return(repository.User{
+			ID:       testMemberID,
+			Phone:    "+62856712332",
+			Name:     "User",
+			Password: "$2a$10$Ke5Sl0ra2VeYSmmqjnlE9OLl.I1Bmc8Ou5ix7M2lrPhB6FzV8raJC",
+			Salt:     "63RDLuJv8Kmeehqgeg35FA==",
+		}, nil)
+		repo.EXPECT().ListUserMemberships(gomock.Any(), testMemberID).Return([]repository.Membership{testMembership(testMemberID, repository.RoleMember)}, nil)
+		repo.EXPECT().IncreaseLoginAttempt(gomock.Any(), "+62856712332").Return(nil)
+	}, http.MethodPost, "", `{"phone": "+62856712332", "password": "QWErty123!@#"}`, func(s *Server, c echo.Context) error {
+		return s.PostLogin(c)
+	})
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var resp map[string]string
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	claims, err := parseToken(resp["token"])
+	assert.NoError(t, err)
+	assert.Equal(t, testOrganizationID, claims["org_id"])
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+	// maxPatchSize : maximum size of patch document in bytes, a whole profile is far smaller
+	maxPatchSize = 64 << 10
+)
+
+// jsonPatchOperation : single operation of RFC 6902 JSON Patch document
+type jsonPatchOperation struct {
+	Op    string           `json:"op"`
+	Path  string           `json:"path"`
+	From  string           `json:"from"`
+	Value *json.RawMessage `json:"value"`
+}
+
+// applyMergePatch : apply RFC 7396 JSON Merge Patch to the document, null member remove the field
+func applyMergePatch(doc map[string]interface{}, patch []byte) (map[string]interface{}, error) {
+	var patchDoc interface{}
+	if err := json.Unmarshal(patch, &patchDoc); err != nil {
+		return nil, err
+	}
+
+	patchObj, ok := patchDoc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("merge patch must be a JSON object")
+	}
+
+	return mergeObject(copyDocument(doc), patchObj), nil
+}
+
+func mergeObject(target, patch map[string]interface{}) map[string]interface{} {
+	for key, value := range patch {
+		if value == nil {
+			delete(target, key)
+			continue
+		}
+
+		patchChild, ok := value.(map[string]interface{})
+		if !ok {
+			target[key] = value
+			continue
+		}
+
+		targetChild, ok := target[key].(map[string]interface{})
+		if !ok {
+			targetChild = map[string]interface{}{}
+		}
+		target[key] = mergeObject(targetChild, patchChild)
+	}
+	return target
+}
+
+// applyJSONPatch : apply RFC 6902 JSON Patch to the document, only top level members are addressable
+func applyJSONPatch(doc map[string]interface{}, patch []byte) (map[string]interface{}, error) {
+	var operations []jsonPatchOperation
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, err
+	}
+
+	result := copyDocument(doc)
+	for i, op := range operations {
+		key, err := parsePointer(op.Path)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, fmt.Errorf("operation %d: value is required", i)
+			}
+			var value interface{}
+			if err := json.Unmarshal(*op.Value, &value); err != nil {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+
+			current, exist := result[key]
+			if op.Op != "add" && !exist {
+				return nil, fmt.Errorf("operation %d: path %s does not exist", i, op.Path)
+			}
+			if op.Op == "test" {
+				if !reflect.DeepEqual(current, value) {
+					return nil, fmt.Errorf("operation %d: test failed for path %s", i, op.Path)
+				}
+				continue
+			}
+			result[key] = value
+		case "remove":
+			if _, exist := result[key]; !exist {
+				return nil, fmt.Errorf("operation %d: path %s does not exist", i, op.Path)
+			}
+			delete(result, key)
+		case "move", "copy":
+			fromKey, err := parsePointer(op.From)
+			if err != nil {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+			value, exist := result[fromKey]
+			if !exist {
+				return nil, fmt.Errorf("operation %d: path %s does not exist", i, op.From)
+			}
+			if op.Op == "move" {
+				delete(result, fromKey)
+			}
+			result[key] = value
+		default:
+			return nil, fmt.Errorf("operation %d: unsupported op %q", i, op.Op)
+		}
+	}
+	return result, nil
+}
+
+// parsePointer : decode JSON Pointer (RFC 6901) that reference top level member of the document
+func parsePointer(pointer string) (string, error) {
+	if !strings.HasPrefix(pointer, "/") || strings.Count(pointer, "/") != 1 || len(pointer) == 1 {
+		return "", fmt.Errorf("unsupported path %q", pointer)
+	}
+	key := strings.ReplaceAll(pointer[1:], "~1", "/")
+	return strings.ReplaceAll(key, "~0", "~"), nil
+}
+
+// copyDocument : deep copy nested objects so patching never mutate the original document
+func copyDocument(doc map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(doc))
+	for key, value := range doc {
+		if child, ok := value.(map[string]interface{}); ok {
+			value = copyDocument(child)
+		}
+		result[key] = value
+	}
+	return result
+}
@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyMergePatch(t *testing.T) {
+	doc := map[string]interface{}{
+		"name":  "User",
+		"phone": "+62856712332",
+		"attributes": map[string]interface{}{
+			"estate": "North",
+			"block":  "A1",
+		},
+	}
+
+	tests := []struct {
+		name    string
+		patch   string
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name:  "Replace member",
+			patch: `{"name":"New User"}`,
+			want: map[string]interface{}{
+				"name":  "New User",
+				"phone": "+62856712332",
+				"attributes": map[string]interface{}{
+					"estate": "North",
+					"block":  "A1",
+				},
+			},
+		}, {
+			name:  "Remove member with null",
+			patch: `{"phone":null}`,
+			want: map[string]interface{}{
+				"name": "User",
+				"attributes": map[string]interface{}{
+					"estate": "North",
+					"block":  "A1",
+				},
+			},
+		}, {
+			name:  "Merge nested object",
+			patch: `{"attributes":{"block":null,"row":"7"}}`,
+			want: map[string]interface{}{
+				"name":  "User",
+				"phone": "+62856712332",
+				"attributes": map[string]interface{}{
+					"estate": "North",
+					"row":    "7",
+				},
+			},
+		}, {
+			name:    "Not an object",
+			patch:   `["name"]`,
+			wantErr: true,
+		}, {
+			name:    "Invalid JSON",
+			patch:   `{`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyMergePatch(doc, []byte(tt.patch))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	// Assert that the original document is untouched
+	assert.Equal(t, "User", doc["name"])
+	assert.Equal(t, "A1", doc["attributes"].(map[string]interface{})["block"])
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	doc := map[string]interface{}{
+		"name":  "User",
+		"phone": "+62856712332",
+	}
+
+	tests := []struct {
+		name    string
+		patch   string
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name:  "Replace",
+			patch: `[{"op":"replace","path":"/name","value":"New User"}]`,
+			want:  map[string]interface{}{"name": "New User", "phone": "+62856712332"},
+		}, {
+			name:  "Test then replace",
+			patch: `[{"op":"test","path":"/name","value":"User"},{"op":"replace","path":"/name","value":"New User"}]`,
+			want:  map[string]interface{}{"name": "New User", "phone": "+62856712332"},
+		}, {
+			name:  "Remove and add",
+			patch: `[{"op":"remove","path":"/phone"},{"op":"add","path":"/phone","value":"+62812345678"}]`,
+			want:  map[string]interface{}{"name": "User", "phone": "+62812345678"},
+		}, {
+			name:  "Copy",
+			patch: `[{"op":"copy","from":"/name","path":"/nick~1name"}]`,
+			want:  map[string]interface{}{"name": "User", "nick/name": "User", "phone": "+62856712332"},
+		}, {
+			name:  "Move",
+			patch: `[{"op":"move","from":"/name","path":"/nickname"}]`,
+			want:  map[string]interface{}{"nickname": "User", "phone": "+62856712332"},
+		}, {
+			name:    "Failed test",
+			patch:   `[{"op":"test","path":"/name","value":"Other"}]`,
+			wantErr: true,
+		}, {
+			name:    "Replace missing member",
+			patch:   `[{"op":"replace","path":"/email","value":"user@example.com"}]`,
+			wantErr: true,
+		}, {
+			name:    "Nested path",
+			patch:   `[{"op":"add","path":"/address/city","value":"Medan"}]`,
+			wantErr: true,
+		}, {
+			name:    "Missing value",
+			patch:   `[{"op":"add","path":"/name"}]`,
+			wantErr: true,
+		}, {
+			name:    "Unsupported op",
+			patch:   `[{"op":"merge","path":"/name","value":"User"}]`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyJSONPatch(doc, []byte(tt.patch))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
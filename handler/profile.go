@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/service"
+)
+
+// toUserProfile : build API response of the user profile
+func toUserProfile(user repository.User) generated.UserProfile {
+	profile := generated.UserProfile{
+		Phone:             &user.Phone,
+		Name:              &user.Name,
+		Email:             user.Email,
+		PreferredLanguage: user.PreferredLanguage,
+		AvatarUrl:         user.AvatarURL,
+		Address:           user.Address,
+		Estate:            user.Estate,
+		Region:            user.Region,
+	}
+	if user.DateOfBirth != nil {
+		dateOfBirth := user.DateOfBirth.Format(service.DateLayout)
+		profile.DateOfBirth = &dateOfBirth
+	}
+	if len(user.Attributes) > 0 {
+		profile.Attributes = &user.Attributes
+	}
+	return profile
+}
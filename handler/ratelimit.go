@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/ratelimit"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+const (
+	// rateLimitExtension : operation extension in api.yml listing the rate limit rules of the operation
+	rateLimitExtension = "x-rate-limit"
+	// maxRateLimitBody : request body read to find the phone number of phone keyed rules
+	maxRateLimitBody = 1 << 20
+)
+
+// pathParamRegex : path parameter in api.yml path, e.g. {id}
+var pathParamRegex = regexp.MustCompile(`\{([^}]+)\}`)
+
+// rateLimitConfig : rule as written in api.yml, e.g. {key: ip, limit: 10, period: 1m}
+type rateLimitConfig struct {
+	// Key is what the bucket is kept for, one of ip, phone or user
+	Key    string `json:"key"`
+	Limit  int    `json:"limit"`
+	Period string `json:"period"`
+}
+
+type rateLimitRule struct {
+	operation string
+	key       string
+	rule      ratelimit.Rule
+}
+
+// rateLimitRules : parse rate limit rules of every operation, keyed by method and echo route path
+func rateLimitRules(spec *openapi3.T) (map[string][]rateLimitRule, error) {
+	rules := map[string][]rateLimitRule{}
+	for path, item := range spec.Paths {
+		for method, operation := range item.Operations() {
+			raw, exist := operation.Extensions[rateLimitExtension]
+			if !exist {
+				continue
+			}
+
+			// Extension value is decoded as generic JSON, encode it back to read it as configs
+			encoded, err := json.Marshal(raw)
+			if err != nil {
+				return nil, err
+			}
+			var configs []rateLimitConfig
+			if err := json.Unmarshal(encoded, &configs); err != nil {
+				return nil, fmt.Errorf("%s %s: invalid %s: %w", method, path, rateLimitExtension, err)
+			}
+
+			name := operation.OperationID
+			if name == "" {
+				name = method + " " + path
+			}
+			route := method + " " + pathParamRegex.ReplaceAllString(path, ":$1")
+			for _, config := range configs {
+				period, err := time.ParseDuration(config.Period)
+				if err != nil || period <= 0 {
+					return nil, fmt.Errorf("%s: invalid rate limit period %q", name, config.Period)
+				}
+				if config.Limit <= 0 {
+					return nil, fmt.Errorf("%s: invalid rate limit %d", name, config.Limit)
+				}
+				switch config.Key {
+				case "ip", "phone", "user":
+				default:
+					return nil, fmt.Errorf("%s: invalid rate limit key %q", name, config.Key)
+				}
+				rules[route] = append(rules[route], rateLimitRule{
+					operation: name,
+					key:       config.Key,
+					rule:      ratelimit.Rule{Limit: config.Limit, Period: period},
+				})
+			}
+		}
+	}
+	return rules, nil
+}
+
+// LongestRateLimitPeriod : longest period of the rate limit rules in the spec, buckets idle for longer are full again and can be deleted
+func LongestRateLimitPeriod(spec *openapi3.T) (time.Duration, error) {
+	rules, err := rateLimitRules(spec)
+	if err != nil {
+		return 0, err
+	}
+	var longest time.Duration
+	for _, routeRules := range rules {
+		for _, rule := range routeRules {
+			if rule.rule.Period > longest {
+				longest = rule.rule.Period
+			}
+		}
+	}
+	return longest, nil
+}
+
+// RateLimitMiddleware : limit requests of operations that have x-rate-limit rules in the spec, requests over the limit get 429
+func (s *Server) RateLimitMiddleware(store ratelimit.Store, spec *openapi3.T) (echo.MiddlewareFunc, error) {
+	rules, err := rateLimitRules(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			routeRules := rules[ctx.Request().Method+" "+ctx.Path()]
+			if len(routeRules) == 0 {
+				return next(ctx)
+			}
+
+			tightest, denied := takeRateLimit(ctx.Request().Context(), store, routeRules, func(key string) (string, bool) {
+				return s.rateLimitIdentity(ctx, key)
+			})
+			if denied != nil {
+				setRateLimitHeaders(ctx, *denied)
+				ctx.Response().Header().Set("Retry-After", strconv.Itoa(ceilSeconds(denied.RetryAfter)))
+				return ctx.JSON(http.StatusTooManyRequests, map[string]string{"message": "Too many requests, please try again later"})
+			}
+			if tightest != nil {
+				setRateLimitHeaders(ctx, *tightest)
+			}
+			return next(ctx)
+		}
+	}, nil
+}
+
+// takeRateLimit : take from the bucket of every rule the request has an identity for.
+// denied is the rule to wait longest for when any rule is over its limit, tightest the rule with the fewest requests remaining
+func takeRateLimit(ctx context.Context, store ratelimit.Store, rules []rateLimitRule, identity func(key string) (string, bool)) (tightest *ratelimit.Result, denied *ratelimit.Result) {
+	now := time.Now()
+	for _, rule := range rules {
+		value, ok := identity(rule.key)
+		if !ok {
+			continue
+		}
+
+		result, err := store.Take(ctx, rule.operation+":"+rule.key+":"+value, rule.rule, now)
+		if err != nil {
+			// Unavailable store must not take the service down with it
+			log.Error(err)
+			continue
+		}
+		if tightest == nil || result.Remaining < tightest.Remaining {
+			tightest = &result
+		}
+		if !result.Allowed && (denied == nil || result.RetryAfter > denied.RetryAfter) {
+			denied = &result
+		}
+	}
+	return tightest, denied
+}
+
+// rateLimitIdentity : value the bucket is kept for, false when the request does not carry it
+func (s *Server) rateLimitIdentity(ctx echo.Context, key string) (string, bool) {
+	switch key {
+	case "ip":
+		return ctx.RealIP(), true
+	case "user":
+		// Personal access tokens are keyed by their hash, the token is only looked up by the handler
+		if tokenString := bearerToken(ctx); strings.HasPrefix(tokenString, personalAccessTokenPrefix) {
+			return "pat:" + hashPersonalAccessToken(tokenString), true
+		}
+		id, err := validateToken(ctx)
+		return id, err == nil
+	case "phone":
+		return s.requestPhone(ctx)
+	}
+	return "", false
+}
+
+// requestPhone : phone member of JSON request body normalized like the handlers do, body is kept for the handler
+func (s *Server) requestPhone(ctx echo.Context) (string, bool) {
+	req := ctx.Request()
+	if req.Body == nil || !strings.HasPrefix(req.Header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+		return "", false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxRateLimitBody))
+	if err != nil {
+		return "", false
+	}
+	req.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), req.Body))
+
+	var payload struct {
+		Phone *string `json:"phone"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.Phone == nil {
+		return "", false
+	}
+	return s.rateLimitPhone(*payload.Phone), true
+}
+
+// rateLimitPhone : phone number normalized so every way of writing it share a bucket, invalid numbers are kept as sent
+func (s *Server) rateLimitPhone(phone string) string {
+	if phoneNumber, err := s.Phone.Normalize(phone); err == nil {
+		return phoneNumber
+	}
+	return strings.TrimSpace(phone)
+}
+
+// setRateLimitHeaders : RateLimit-* headers of the IETF RateLimit header fields draft
+func setRateLimitHeaders(ctx echo.Context, result ratelimit.Result) {
+	header := ctx.Response().Header()
+	header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+}
+
+func ceilSeconds(duration time.Duration) int {
+	return int(math.Ceil(duration.Seconds()))
+}
@@ -0,0 +1,215 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/ratelimit"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+const rateLimitTestSpec = `
+openapi: "3.0.0"
+info:
+  version: 1.0.0
+  title: Test
+paths:
+  /login:
+    post:
+      x-rate-limit:
+        - key: ip
+          limit: 3
+          period: 1m
+        - key: phone
+          limit: 2
+          period: 1m
+      responses:
+        '200':
+          description: Successful
+  /users/{id}/avatar:
+    put:
+      operationId: PutAvatar
+      x-rate-limit:
+        - key: user
+          limit: 1
+          period: 1h
+      responses:
+        '200':
+          description: Successful
+  /hello:
+    get:
+      responses:
+        '200':
+          description: Successful
+`
+
+func loadRateLimitSpec(t *testing.T, data string) *openapi3.T {
+	spec, err := openapi3.NewLoader().LoadFromData([]byte(data))
+	assert.NoError(t, err)
+	return spec
+}
+
+// newRateLimitEcho : echo with the middleware in front of handlers that echo the request body
+func newRateLimitEcho(t *testing.T, store ratelimit.Store) *echo.Echo {
+	s := NewServer(NewServerOptions{})
+	middleware, err := s.RateLimitMiddleware(store, loadRateLimitSpec(t, rateLimitTestSpec))
+	assert.NoError(t, err)
+
+	e := echo.New()
+	e.IPExtractor = echo.ExtractIPDirect()
+	e.Use(middleware)
+	echoBody := func(ctx echo.Context) error {
+		body, _ := io.ReadAll(ctx.Request().Body)
+		return ctx.String(http.StatusOK, string(body))
+	}
+	e.POST("/login", echoBody)
+	e.PUT("/users/:id/avatar", echoBody)
+	e.GET("/hello", echoBody)
+	return e
+}
+
+func serveRateLimit(e *echo.Echo, method, path, ip, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.RemoteAddr = ip + ":12345"
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRateLimitMiddlewareIP(t *testing.T) {
+	e := newRateLimitEcho(t, ratelimit.NewMemoryStore())
+
+	for remaining := 2; remaining >= 0; remaining-- {
+		rec := serveRateLimit(e, http.MethodPost, "/login", "10.0.0.1", `{"email": "user@example.com"}`, nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "3", rec.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, fmt.Sprint(remaining), rec.Header().Get("RateLimit-Remaining"))
+
+		// Body is still readable by the handler
+		assert.Equal(t, `{"email": "user@example.com"}`, rec.Body.String())
+	}
+
+	rec := serveRateLimit(e, http.MethodPost, "/login", "10.0.0.1", `{"email": "user@example.com"}`, nil)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "{\"message\":\"Too many requests, please try again later\"}\n", rec.Body.String())
+	assert.Equal(t, "20", rec.Header().Get("Retry-After"))
+	assert.Equal(t, "3", rec.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "60", rec.Header().Get("RateLimit-Reset"))
+
+	// Other clients are not affected
+	rec = serveRateLimit(e, http.MethodPost, "/login", "10.0.0.2", `{"email": "user@example.com"}`, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestRateLimitMiddlewarePhone(t *testing.T) {
+	e := newRateLimitEcho(t, ratelimit.NewMemoryStore())
+
+	// Local and international format of the same number share the bucket, even from different ips
+	rec := serveRateLimit(e, http.MethodPost, "/login", "10.0.0.1", `{"phone": "0856712332"}`, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = serveRateLimit(e, http.MethodPost, "/login", "10.0.0.2", `{"phone": "+62856712332"}`, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+
+	rec = serveRateLimit(e, http.MethodPost, "/login", "10.0.0.3", `{"phone": "+62 856 712 332"}`, nil)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "30", rec.Header().Get("Retry-After"))
+	assert.Equal(t, "2", rec.Header().Get("RateLimit-Limit"))
+}
+
+func TestRateLimitMiddlewareUser(t *testing.T) {
+	e := newRateLimitEcho(t, ratelimit.NewMemoryStore())
+	token, _ := createToken("123", time.Now().Add(time.Hour))
+	otherToken, _ := createToken("456", time.Now().Add(time.Hour))
+
+	rec := serveRateLimit(e, http.MethodPut, "/users/123/avatar", "10.0.0.1", "", map[string]string{"Authorization": "Bearer " + token})
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serveRateLimit(e, http.MethodPut, "/users/123/avatar", "10.0.0.1", "", map[string]string{"Authorization": "Bearer " + token})
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "3600", rec.Header().Get("Retry-After"))
+
+	rec = serveRateLimit(e, http.MethodPut, "/users/123/avatar", "10.0.0.1", "", map[string]string{"Authorization": "Bearer " + otherToken})
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// Anonymous requests are left to the handler to reject
+	rec = serveRateLimit(e, http.MethodPut, "/users/123/avatar", "10.0.0.1", "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "", rec.Header().Get("RateLimit-Limit"))
+}
+
+func TestRateLimitMiddlewareUnlimitedRoute(t *testing.T) {
+	e := newRateLimitEcho(t, ratelimit.NewMemoryStore())
+
+	for i := 0; i < 10; i++ {
+		rec := serveRateLimit(e, http.MethodGet, "/hello", "10.0.0.1", "", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "", rec.Header().Get("RateLimit-Limit"))
+	}
+}
+
+func TestRateLimitMiddlewareStoreError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	store := ratelimit.NewMockStore(ctrl)
+	store.EXPECT().Take(gomock.Any(), "POST /login:ip:10.0.0.1", ratelimit.Rule{Limit: 3, Period: time.Minute}, gomock.Any()).Return(ratelimit.Result{}, fmt.Errorf("error"))
+
+	// Store failure let the request through
+	e := newRateLimitEcho(t, store)
+	rec := serveRateLimit(e, http.MethodPost, "/login", "10.0.0.1", "{}", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestRateLimitRules(t *testing.T) {
+	rules, err := rateLimitRules(loadRateLimitSpec(t, rateLimitTestSpec))
+	assert.NoError(t, err)
+	assert.Equal(t, []rateLimitRule{
+		{operation: "PutAvatar", key: "user", rule: ratelimit.Rule{Limit: 1, Period: time.Hour}},
+	}, rules["PUT /users/:id/avatar"])
+	assert.Len(t, rules["POST /login"], 2)
+	assert.NotContains(t, rules, "GET /hello")
+
+	invalid := []string{
+		"[{key: ip, limit: 0, period: 1m}]",
+		"[{key: ip, limit: 1, period: forever}]",
+		"[{key: device, limit: 1, period: 1m}]",
+		"{key: ip}",
+	}
+	for _, rule := range invalid {
+		spec := strings.Replace(rateLimitTestSpec, "/hello:\n    get:\n", "/hello:\n    get:\n      x-rate-limit: "+rule+"\n", 1)
+		_, err := rateLimitRules(loadRateLimitSpec(t, spec))
+		assert.Error(t, err, rule)
+	}
+}
+
+func TestLongestRateLimitPeriod(t *testing.T) {
+	period, err := LongestRateLimitPeriod(loadRateLimitSpec(t, rateLimitTestSpec))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour, period)
+
+	_, err = LongestRateLimitPeriod(loadRateLimitSpec(t, strings.Replace(rateLimitTestSpec, "/hello:\n    get:\n", "/hello:\n    get:\n      x-rate-limit: {key: ip}\n", 1)))
+	assert.Error(t, err)
+}
+
+func TestRateLimitRulesOfAPISpec(t *testing.T) {
+	spec, err := generated.GetSwagger()
+	assert.NoError(t, err)
+
+	rules, err := rateLimitRules(spec)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, rules["POST /registration"])
+	assert.NotEmpty(t, rules["POST /login"])
+}
@@ -0,0 +1,525 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/oauth"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+const (
+	scimContentType                 = "application/scim+json"
+	scimUserSchema                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimGroupSchema                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimListResponseSchema          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimServiceProviderConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+
+	// scimMaxResults : results per page when count is not given and at most
+	scimMaxResults = 100
+)
+
+// scimRequestError : invalid SCIM request, scimType and detail are returned to the client with status 400
+type scimRequestError struct {
+	ScimType string
+	Detail   string
+}
+
+func (e *scimRequestError) Error() string {
+	return e.Detail
+}
+
+func invalidScimValue(format string, args ...interface{}) error {
+	return &scimRequestError{ScimType: "invalidValue", Detail: fmt.Sprintf(format, args...)}
+}
+
+// scimJSON : JSON response with the SCIM media type
+func scimJSON(ctx echo.Context, status int, body interface{}) error {
+	ctx.Response().Header().Set(echo.HeaderContentType, scimContentType)
+	return ctx.JSON(status, body)
+}
+
+// scimError : SCIM error response, scimType is empty for errors RFC 7644 has no type for
+func scimError(ctx echo.Context, status int, scimType string, detail string) error {
+	body := generated.ScimError{
+		Schemas: []string{scimErrorSchema},
+		Status:  strconv.Itoa(status),
+		Detail:  &detail,
+	}
+	if scimType != "" {
+		body.ScimType = &scimType
+	}
+	return scimJSON(ctx, status, body)
+}
+
+// scimRequestFailed : 400 response of scimRequestError, any other error is logged and hidden
+func scimRequestFailed(ctx echo.Context, err error) error {
+	if requestErr, ok := err.(*scimRequestError); ok {
+		return scimError(ctx, http.StatusBadRequest, requestErr.ScimType, requestErr.Detail)
+	}
+	log.Error(err)
+	return scimError(ctx, http.StatusInternalServerError, "", "Internal Server Error")
+}
+
+// authenticateSCIM : tenant of the provisioning client, every SCIM resource is scoped to it
+func (s *Server) authenticateSCIM(ctx echo.Context) (string, error) {
+	client, err := s.authenticateClient(ctx, oauth.ScopeSCIM)
+	if err != nil {
+		return "", err
+	}
+	if client.Tenant == nil || *client.Tenant == "" {
+		return "", fmt.Errorf("client %s has no tenant", client.ID)
+	}
+	return *client.Tenant, nil
+}
+
+// decodeSCIM : decode the request body, SCIM clients send application/scim+json which Bind does not accept
+func decodeSCIM(ctx echo.Context, v interface{}) error {
+	if err := json.NewDecoder(ctx.Request().Body).Decode(v); err != nil {
+		return &scimRequestError{ScimType: "invalidSyntax", Detail: "Invalid request payload"}
+	}
+	return nil
+}
+
+// scimLocation : url of the resource
+func (s *Server) scimLocation(resourceType string, id string) string {
+	return s.issuer() + "/scim/v2/" + resourceType + "s/" + id
+}
+
+// scimMeta : meta attribute of the resource, lastModified is the creation when it was never modified
+func (s *Server) scimMeta(resourceType string, id string, created time.Time, lastModified *time.Time, version *string) *generated.ScimMeta {
+	location := s.scimLocation(resourceType, id)
+	if lastModified == nil {
+		lastModified = &created
+	}
+	return &generated.ScimMeta{
+		ResourceType: &resourceType,
+		Created:      &created,
+		LastModified: lastModified,
+		Version:      version,
+		Location:     &location,
+	}
+}
+
+// scimPage : offset and limit of the 1-based startIndex and count
+func scimPage(startIndex *int, count *int) (offset int, limit int) {
+	if startIndex != nil && *startIndex > 1 {
+		offset = *startIndex - 1
+	}
+	limit = scimMaxResults
+	if count != nil && *count >= 0 && *count < scimMaxResults {
+		limit = *count
+	}
+	return offset, limit
+}
+
+func scimListResponse(resources []interface{}, total int, offset int) generated.ScimListResponse {
+	if resources == nil {
+		resources = []interface{}{}
+	}
+	return generated.ScimListResponse{
+		Schemas:      []string{scimListResponseSchema},
+		TotalResults: total,
+		StartIndex:   offset + 1,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}
+}
+
+// GetScimV2ServiceProviderConfig : this handler is for SCIM clients discovering the supported features
+func (s *Server) GetScimV2ServiceProviderConfig(ctx echo.Context) error {
+	if _, err := s.authenticateSCIM(ctx); err != nil {
+		log.Error(err)
+		return scimError(ctx, http.StatusUnauthorized, "", "Invalid bearer token")
+	}
+
+	return scimJSON(ctx, http.StatusOK, generated.ScimServiceProviderConfig{
+		Schemas:        []string{scimServiceProviderConfigSchema},
+		Patch:          generated.ScimSupported{Supported: true},
+		Bulk:           generated.ScimBulkSupport{Supported: false},
+		Filter:         generated.ScimFilterSupport{Supported: true, MaxResults: scimMaxResults},
+		ChangePassword: generated.ScimSupported{Supported: true},
+		Sort:           generated.ScimSupported{Supported: false},
+		Etag:           generated.ScimSupported{Supported: true},
+		AuthenticationSchemes: []generated.ScimAuthenticationScheme{{
+			Type:        "oauthbearertoken",
+			Name:        "OAuth Bearer Token",
+			Description: "Access token of the client credentials grant with the scim scope",
+		}},
+	})
+}
+
+// scimComparison : comparison of a SCIM filter, attribute and operator are lower case and value is string, bool, float64 or nil
+type scimComparison struct {
+	Attribute string
+	Operator  string
+	Value     interface{}
+}
+
+var scimOperators = map[string]bool{
+	"eq": true, "ne": true, "co": true, "sw": true, "ew": true, "pr": true,
+	"gt": true, "ge": true, "lt": true, "le": true,
+}
+
+// parseScimFilter : comparisons of the filter joined by and, or, not and grouping are not supported
+func parseScimFilter(filter string) ([]scimComparison, error) {
+	tokens, err := scimFilterTokens(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var comparisons []scimComparison
+	for i := 0; i < len(tokens); {
+		if len(comparisons) > 0 {
+			if !strings.EqualFold(tokens[i], "and") {
+				return nil, &scimRequestError{ScimType: "invalidFilter", Detail: fmt.Sprintf("Unsupported filter %s, only and is supported between comparisons", tokens[i])}
+			}
+			i++
+		}
+		if i+1 >= len(tokens) {
+			return nil, &scimRequestError{ScimType: "invalidFilter", Detail: "Incomplete filter comparison"}
+		}
+
+		comparison := scimComparison{Attribute: strings.ToLower(tokens[i]), Operator: strings.ToLower(tokens[i+1])}
+		if !scimOperators[comparison.Operator] {
+			return nil, &scimRequestError{ScimType: "invalidFilter", Detail: fmt.Sprintf("Unsupported filter operator %s", tokens[i+1])}
+		}
+		i += 2
+		if comparison.Operator != "pr" {
+			if i >= len(tokens) {
+				return nil, &scimRequestError{ScimType: "invalidFilter", Detail: "Incomplete filter comparison"}
+			}
+			comparison.Value, err = parseScimFilterValue(tokens[i])
+			if err != nil {
+				return nil, err
+			}
+			i++
+		}
+		comparisons = append(comparisons, comparison)
+	}
+	return comparisons, nil
+}
+
+// scimFilterTokens : split the filter on spaces outside quoted strings
+func scimFilterTokens(filter string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(filter); {
+		switch {
+		case filter[i] == ' ':
+			i++
+		case filter[i] == '"':
+			end := i + 1
+			for end < len(filter) && filter[end] != '"' {
+				if filter[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(filter) {
+				return nil, &scimRequestError{ScimType: "invalidFilter", Detail: "Unterminated string in filter"}
+			}
+			tokens = append(tokens, filter[i:end+1])
+			i = end + 1
+		default:
+			end := i
+			for end < len(filter) && filter[end] != ' ' {
+				end++
+			}
+			token := filter[i:end]
+			if strings.ContainsAny(token, "()[]") {
+				return nil, &scimRequestError{ScimType: "invalidFilter", Detail: "Grouping and value filters are not supported in filter"}
+			}
+			tokens = append(tokens, token)
+			i = end
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, &scimRequestError{ScimType: "invalidFilter", Detail: "Empty filter"}
+	}
+	return tokens, nil
+}
+
+func parseScimFilterValue(token string) (interface{}, error) {
+	if strings.HasPrefix(token, `"`) {
+		var value string
+		if err := json.Unmarshal([]byte(token), &value); err != nil {
+			return nil, &scimRequestError{ScimType: "invalidFilter", Detail: fmt.Sprintf("Invalid string %s in filter", token)}
+		}
+		return value, nil
+	}
+	switch strings.ToLower(token) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	number, err := strconv.ParseFloat(token, 64)
+	if err != nil {
+		return nil, &scimRequestError{ScimType: "invalidFilter", Detail: fmt.Sprintf("Invalid value %s in filter", token)}
+	}
+	return number, nil
+}
+
+// scimAttributeType : how the filter value of an attribute is compared with its column
+type scimAttributeType int
+
+const (
+	scimString scimAttributeType = iota
+	scimPhone
+	scimEmail
+	scimBool
+	scimTime
+	scimID
+)
+
+// scimAttribute : column of a filterable SCIM attribute
+type scimAttribute struct {
+	Column string
+	Type   scimAttributeType
+}
+
+var scimComparisonOperators = map[string]string{"gt": ">", "ge": ">=", "lt": "<", "le": "<="}
+
+// scimFilterParams : repository params of the comparisons, none is true when a value can never match such as an id that is not a uuid
+func (s *Server) scimFilterParams(comparisons []scimComparison, attributes map[string]scimAttribute) (params []repository.Param, none bool, err error) {
+	for _, comparison := range comparisons {
+		attribute, ok := attributes[comparison.Attribute]
+		if !ok {
+			return nil, false, &scimRequestError{ScimType: "invalidFilter", Detail: fmt.Sprintf("Unsupported filter attribute %s", comparison.Attribute)}
+		}
+
+		if comparison.Operator == "pr" {
+			params = append(params, repository.Param{Logic: "AND", Field: "(" + attribute.Column + " IS NOT NULL)", Operator: "=", Value: true})
+			continue
+		}
+		if comparison.Value == nil {
+			if comparison.Operator != "eq" && comparison.Operator != "ne" {
+				return nil, false, &scimRequestError{ScimType: "invalidFilter", Detail: "null can only be compared with eq or ne"}
+			}
+			params = append(params, repository.Param{Logic: "AND", Field: "(" + attribute.Column + " IS NULL)", Operator: "=", Value: comparison.Operator == "eq"})
+			continue
+		}
+
+		param, match, err := s.scimFilterParam(attribute, comparison)
+		if err != nil {
+			return nil, false, err
+		}
+		if !match {
+			return nil, true, nil
+		}
+		if param.Field != "" {
+			params = append(params, param)
+		}
+	}
+	return params, false, nil
+}
+
+// scimFilterParam : param of comparison with a value, match is false when nothing can match and param is empty when everything matches
+func (s *Server) scimFilterParam(attribute scimAttribute, comparison scimComparison) (param repository.Param, match bool, err error) {
+	param = repository.Param{Logic: "AND", Field: attribute.Column}
+	unsupported := &scimRequestError{ScimType: "invalidFilter", Detail: fmt.Sprintf("Unsupported filter %s %s %v", comparison.Attribute, comparison.Operator, comparison.Value)}
+
+	if attribute.Type == scimBool {
+		value, ok := comparison.Value.(bool)
+		if !ok || (comparison.Operator != "eq" && comparison.Operator != "ne") {
+			return param, false, unsupported
+		}
+		param.Operator, param.Value = "=", value == (comparison.Operator == "eq")
+		return param, true, nil
+	}
+
+	value, ok := comparison.Value.(string)
+	if !ok {
+		return param, false, unsupported
+	}
+
+	switch attribute.Type {
+	case scimTime:
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return param, false, &scimRequestError{ScimType: "invalidFilter", Detail: fmt.Sprintf("Invalid date time %s in filter", value)}
+		}
+		param.Value = parsed
+		switch comparison.Operator {
+		case "eq":
+			param.Operator = "="
+		case "ne":
+			param.Operator = "<>"
+		default:
+			if param.Operator, ok = scimComparisonOperators[comparison.Operator]; !ok {
+				return param, false, unsupported
+			}
+		}
+		return param, true, nil
+	case scimID:
+		if comparison.Operator != "eq" {
+			return param, false, unsupported
+		}
+		if _, err := uuid.Parse(value); err != nil {
+			return param, false, nil
+		}
+		param.Operator, param.Value = "=", value
+		return param, true, nil
+	case scimPhone:
+		if comparison.Operator == "eq" || comparison.Operator == "ne" {
+			normalized, err := s.Phone.Normalize(value)
+			if err != nil {
+				// A value that is not a phone number is not the phone of any user
+				return repository.Param{}, comparison.Operator == "ne", nil
+			}
+			value = normalized
+		}
+	case scimEmail:
+		value = strings.ToLower(value)
+	}
+
+	switch comparison.Operator {
+	case "eq":
+		param.Operator, param.Value = "=", value
+	case "ne":
+		param.Operator, param.Value = "IS DISTINCT FROM", value
+	case "co":
+		param.Operator, param.Value = "ILIKE", "%"+escapeLike(value)+"%"
+	case "sw":
+		param.Operator, param.Value = "ILIKE", escapeLike(value)+"%"
+	case "ew":
+		param.Operator, param.Value = "ILIKE", "%"+escapeLike(value)
+	default:
+		param.Operator, param.Value = scimComparisonOperators[comparison.Operator], value
+	}
+	return param, true, nil
+}
+
+// escapeLike : escape the wildcards of LIKE pattern so the value is matched literally
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// scimPath : path of a PATCH operation such as emails[type eq "work"].value, attribute and sub-attribute are lower case
+type scimPath struct {
+	Attribute    string
+	Filter       string
+	SubAttribute string
+}
+
+// parseScimPath : split the path, the URN of the resource schema is optional
+func parseScimPath(path string, schema string) (scimPath, error) {
+	if len(path) > len(schema) && strings.EqualFold(path[:len(schema)+1], schema+":") {
+		path = path[len(schema)+1:]
+	}
+
+	var parsed scimPath
+	if open := strings.IndexByte(path, '['); open >= 0 {
+		end := strings.LastIndexByte(path, ']')
+		if end < open {
+			return parsed, &scimRequestError{ScimType: "invalidPath", Detail: fmt.Sprintf("Invalid path %s", path)}
+		}
+		parsed.Attribute = path[:open]
+		parsed.Filter = path[open+1 : end]
+		rest := path[end+1:]
+		if rest != "" {
+			if !strings.HasPrefix(rest, ".") {
+				return parsed, &scimRequestError{ScimType: "invalidPath", Detail: fmt.Sprintf("Invalid path %s", path)}
+			}
+			parsed.SubAttribute = rest[1:]
+		}
+	} else if dot := strings.IndexByte(path, '.'); dot >= 0 {
+		parsed.Attribute, parsed.SubAttribute = path[:dot], path[dot+1:]
+	} else {
+		parsed.Attribute = path
+	}
+
+	if parsed.Attribute == "" {
+		return parsed, &scimRequestError{ScimType: "invalidPath", Detail: fmt.Sprintf("Invalid path %s", path)}
+	}
+	parsed.Attribute = strings.ToLower(parsed.Attribute)
+	parsed.SubAttribute = strings.ToLower(parsed.SubAttribute)
+	return parsed, nil
+}
+
+// scimOperation : op in lower case and the value of a PATCH operation, unsupported op is invalid
+func scimOperation(operation generated.ScimPatchOperation) (op string, value interface{}, err error) {
+	op = strings.ToLower(operation.Op)
+	if op != "add" && op != "remove" && op != "replace" {
+		return "", nil, &scimRequestError{ScimType: "invalidSyntax", Detail: fmt.Sprintf("Unsupported operation %s", operation.Op)}
+	}
+	if operation.Value != nil {
+		value = *operation.Value
+	}
+	if op != "remove" && value == nil {
+		return "", nil, invalidScimValue("Value is required for %s operation", op)
+	}
+	return op, value, nil
+}
+
+// scimAttributeValue : attribute and value of a PATCH operation without path
+type scimAttributeValue struct {
+	Path  string
+	Value interface{}
+}
+
+// scimPathlessValue : attributes of the object value of an operation without path, sorted so the operation is applied the same way every time
+func scimPathlessValue(op string, value interface{}) ([]scimAttributeValue, error) {
+	if op == "remove" {
+		return nil, &scimRequestError{ScimType: "noTarget", Detail: "Path is required for remove operation"}
+	}
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, invalidScimValue("Value of operation without path must be an object")
+	}
+	attributes := make([]scimAttributeValue, 0, len(object))
+	for path, value := range object {
+		attributes = append(attributes, scimAttributeValue{Path: path, Value: value})
+	}
+	sort.Slice(attributes, func(i, j int) bool { return attributes[i].Path < attributes[j].Path })
+	return attributes, nil
+}
+
+// scimStringValue : string value of a single valued attribute
+func scimStringValue(attribute string, value interface{}) (string, error) {
+	str, ok := value.(string)
+	if !ok {
+		return "", invalidScimValue("Invalid %s. Value must be a string", attribute)
+	}
+	return str, nil
+}
+
+// scimBoolValue : boolean value, some clients send booleans as "True" and "False"
+func scimBoolValue(attribute string, value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		if parsed, err := strconv.ParseBool(v); err == nil {
+			return parsed, nil
+		}
+	}
+	return false, invalidScimValue("Invalid %s. Value must be a boolean", attribute)
+}
+
+// decodeScimValue : decode a PATCH value into the resource type, a single object is accepted where an array is expected
+func decodeScimValue(attribute string, value interface{}, v interface{}) error {
+	if object, ok := value.(map[string]interface{}); ok {
+		value = []interface{}{object}
+	}
+	data, err := json.Marshal(value)
+	if err == nil {
+		err = json.Unmarshal(data, v)
+	}
+	if err != nil {
+		return invalidScimValue("Invalid %s", attribute)
+	}
+	return nil
+}
@@ -0,0 +1,518 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// scimGroupAttributes : filterable attributes of groups in lower case
+var scimGroupAttributes = map[string]scimAttribute{
+	"id":           {Column: "id", Type: scimID},
+	"displayname":  {Column: "name", Type: scimString},
+	"externalid":   {Column: "external_id", Type: scimString},
+	"meta.created": {Column: "created_at", Type: scimTime},
+}
+
+// scimGroupFields : attributes of a group that can be provisioned, Members are the user ids
+type scimGroupFields struct {
+	Name       string
+	ExternalID *string
+	Members    map[string]bool
+}
+
+func scimGroupFieldsFrom(resource generated.ScimGroup) (scimGroupFields, error) {
+	fields := scimGroupFields{
+		Name:       resource.DisplayName,
+		ExternalID: resource.ExternalId,
+		Members:    map[string]bool{},
+	}
+	if resource.Members != nil {
+		for _, member := range *resource.Members {
+			if member.Value == nil || *member.Value == "" {
+				return fields, invalidScimValue("Invalid members. Every member must have a value")
+			}
+			fields.Members[*member.Value] = true
+		}
+	}
+	return fields, nil
+}
+
+// validateScimGroup : normalize the attributes, invalid attribute is returned as scimRequestError
+func validateScimGroup(fields *scimGroupFields) error {
+	fields.Name = strings.TrimSpace(fields.Name)
+	if fields.Name == "" || len(fields.Name) > 100 {
+		return invalidScimValue("Invalid displayName. displayName must be between 1 and 100 characters")
+	}
+	if fields.ExternalID != nil {
+		if *fields.ExternalID == "" {
+			fields.ExternalID = nil
+		} else if len(*fields.ExternalID) > 255 {
+			return invalidScimValue("Invalid externalId. externalId must be at most 255 characters")
+		}
+	}
+	return nil
+}
+
+// scimMemberValues : user ids of the members in a PATCH value
+func scimMemberValues(value interface{}) ([]string, error) {
+	var members []generated.ScimGroupMember
+	if err := decodeScimValue("members", value, &members); err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(members))
+	for i, member := range members {
+		if member.Value == nil || *member.Value == "" {
+			return nil, invalidScimValue("Invalid members. Every member must have a value")
+		}
+		ids[i] = *member.Value
+	}
+	return ids, nil
+}
+
+// scimMemberFilter : user id of the members[value eq "id"] path
+func scimMemberFilter(filter string) (string, error) {
+	comparisons, err := parseScimFilter(filter)
+	if err != nil {
+		return "", &scimRequestError{ScimType: "invalidPath", Detail: err.Error()}
+	}
+	if len(comparisons) == 1 && comparisons[0].Attribute == "value" && comparisons[0].Operator == "eq" {
+		if value, ok := comparisons[0].Value.(string); ok {
+			return value, nil
+		}
+	}
+	return "", &scimRequestError{ScimType: "invalidPath", Detail: "Members can only be selected with value eq"}
+}
+
+// applyScimGroupOperation : apply PATCH operation to the attributes, attributes that are not stored are ignored
+func applyScimGroupOperation(fields *scimGroupFields, op string, path string, value interface{}) error {
+	if path == "" {
+		attributes, err := scimPathlessValue(op, value)
+		if err != nil {
+			return err
+		}
+		for _, attribute := range attributes {
+			if err := applyScimGroupOperation(fields, op, attribute.Path, attribute.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	target, err := parseScimPath(path, scimGroupSchema)
+	if err != nil {
+		return err
+	}
+	switch target.Attribute {
+	case "displayname":
+		if op == "remove" {
+			return &scimRequestError{ScimType: "mutability", Detail: "Attribute displayName cannot be removed"}
+		}
+		fields.Name, err = scimStringValue("displayName", value)
+	case "externalid":
+		if op == "remove" {
+			fields.ExternalID = nil
+			return nil
+		}
+		var str string
+		str, err = scimStringValue("externalId", value)
+		fields.ExternalID = &str
+	case "members":
+		return applyScimMembersOperation(fields, op, target, value)
+	}
+	return err
+}
+
+func applyScimMembersOperation(fields *scimGroupFields, op string, target scimPath, value interface{}) error {
+	if target.Filter != "" {
+		if op != "remove" {
+			return &scimRequestError{ScimType: "invalidPath", Detail: "Members can only be selected to be removed"}
+		}
+		id, err := scimMemberFilter(target.Filter)
+		if err != nil {
+			return err
+		}
+		delete(fields.Members, id)
+		return nil
+	}
+
+	if op == "remove" && value == nil {
+		fields.Members = map[string]bool{}
+		return nil
+	}
+	ids, err := scimMemberValues(value)
+	if err != nil {
+		return err
+	}
+	if op == "replace" {
+		fields.Members = map[string]bool{}
+	}
+	for _, id := range ids {
+		if op == "remove" {
+			delete(fields.Members, id)
+		} else {
+			fields.Members[id] = true
+		}
+	}
+	return nil
+}
+
+// toScimGroup : SCIM resource of the organization, members is nil when they are excluded
+func (s *Server) toScimGroup(organization repository.Organization, members []repository.Membership) generated.ScimGroup {
+	resource := generated.ScimGroup{
+		Schemas:     &[]string{scimGroupSchema},
+		Id:          &organization.ID,
+		ExternalId:  organization.ExternalID,
+		DisplayName: organization.Name,
+		Meta:        s.scimMeta("Group", organization.ID, organization.CreatedAt, nil, nil),
+	}
+	if members != nil {
+		values := make([]generated.ScimGroupMember, len(members))
+		for i, member := range members {
+			member := member
+			ref := s.scimLocation("User", member.UserID)
+			values[i] = generated.ScimGroupMember{Value: &member.UserID, Display: &member.Name, Ref: &ref}
+		}
+		resource.Members = &values
+	}
+	return resource
+}
+
+// scimGroup : SCIM resource of the organization, the members are read unless they are excluded
+func (s *Server) scimGroup(ctx echo.Context, organization repository.Organization, withMembers bool) (generated.ScimGroup, error) {
+	if !withMembers {
+		return s.toScimGroup(organization, nil), nil
+	}
+	members, err := s.Repository.ListOrganizationMembers(ctx.Request().Context(), organization.ID)
+	if err != nil {
+		return generated.ScimGroup{}, err
+	}
+	if members == nil {
+		members = []repository.Membership{}
+	}
+	return s.toScimGroup(organization, members), nil
+}
+
+func (s *Server) scimGroupResponse(ctx echo.Context, status int, organization repository.Organization) error {
+	resource, err := s.scimGroup(ctx, organization, true)
+	if err != nil {
+		return scimRequestFailed(ctx, err)
+	}
+	if status == http.StatusCreated {
+		ctx.Response().Header().Set(echo.HeaderLocation, s.scimLocation("Group", organization.ID))
+	}
+	return scimJSON(ctx, status, resource)
+}
+
+// findScimGroup : organization of the tenant, repository.ErrNotFound when the id is not a group of the tenant
+func (s *Server) findScimGroup(ctx echo.Context, tenant string, id string) (repository.Organization, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return repository.Organization{}, repository.ErrNotFound
+	}
+	return s.Repository.FindOrganization(ctx.Request().Context(),
+		repository.Param{Logic: "AND", Field: "id", Operator: "=", Value: id},
+		repository.Param{Logic: "AND", Field: "tenant", Operator: "=", Value: tenant},
+	)
+}
+
+// scimGroupNotFound : response of findScimGroup error
+func scimGroupNotFound(ctx echo.Context, err error) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return scimError(ctx, http.StatusNotFound, "", "Group not found")
+	}
+	log.Error(err)
+	return scimError(ctx, http.StatusInternalServerError, "", "Internal Server Error")
+}
+
+// scimMemberChanges : user ids to add to and remove from the current members, added users must be users of the tenant
+func (s *Server) scimMemberChanges(ctx echo.Context, tenant string, current []string, members map[string]bool) (add []string, remove []string, err error) {
+	isCurrent := make(map[string]bool, len(current))
+	for _, id := range current {
+		isCurrent[id] = true
+		if !members[id] {
+			remove = append(remove, id)
+		}
+	}
+	for id := range members {
+		if !isCurrent[id] {
+			if _, err := uuid.Parse(id); err != nil {
+				return nil, nil, invalidScimValue("Member %s is not a user of the tenant", id)
+			}
+			add = append(add, id)
+		}
+	}
+	sort.Strings(add)
+	if len(add) == 0 {
+		return add, remove, nil
+	}
+
+	found, err := s.Repository.FindTenantUserIDs(ctx.Request().Context(), tenant, add)
+	if err != nil {
+		return nil, nil, err
+	}
+	isFound := make(map[string]bool, len(found))
+	for _, id := range found {
+		isFound[id] = true
+	}
+	for _, id := range add {
+		if !isFound[id] {
+			return nil, nil, invalidScimValue("Member %s is not a user of the tenant", id)
+		}
+	}
+	return add, remove, nil
+}
+
+// GetScimV2Groups : this handler is for SCIM clients listing the groups of their tenant
+func (s *Server) GetScimV2Groups(ctx echo.Context, params generated.GetScimV2GroupsParams) error {
+	tenant, err := s.authenticateSCIM(ctx)
+	if err != nil {
+		log.Error(err)
+		return scimError(ctx, http.StatusUnauthorized, "", "Invalid bearer token")
+	}
+
+	filters := []repository.Param{{Logic: "AND", Field: "tenant", Operator: "=", Value: tenant}}
+	offset, limit := scimPage(params.StartIndex, params.Count)
+	if params.Filter != nil && strings.TrimSpace(*params.Filter) != "" {
+		comparisons, err := parseScimFilter(*params.Filter)
+		if err != nil {
+			return scimRequestFailed(ctx, err)
+		}
+		params, none, err := s.scimFilterParams(comparisons, scimGroupAttributes)
+		if err != nil {
+			return scimRequestFailed(ctx, err)
+		}
+		if none {
+			return scimJSON(ctx, http.StatusOK, scimListResponse(nil, 0, offset))
+		}
+		filters = append(filters, params...)
+	}
+
+	organizations, total, err := s.Repository.ListOrganizations(ctx.Request().Context(), filters, offset, limit)
+	if err != nil {
+		return scimRequestFailed(ctx, err)
+	}
+
+	withMembers := !excludesMembers(params.ExcludedAttributes)
+	resources := make([]interface{}, len(organizations))
+	for i, organization := range organizations {
+		if resources[i], err = s.scimGroup(ctx, organization, withMembers); err != nil {
+			return scimRequestFailed(ctx, err)
+		}
+	}
+	return scimJSON(ctx, http.StatusOK, scimListResponse(resources, total, offset))
+}
+
+// PostScimV2Groups : this handler is for SCIM clients provisioning a group, the group is an organization of the tenant without owner
+func (s *Server) PostScimV2Groups(ctx echo.Context) error {
+	tenant, err := s.authenticateSCIM(ctx)
+	if err != nil {
+		log.Error(err)
+		return scimError(ctx, http.StatusUnauthorized, "", "Invalid bearer token")
+	}
+
+	var resource generated.ScimGroup
+	if err := decodeSCIM(ctx, &resource); err != nil {
+		return scimRequestFailed(ctx, err)
+	}
+	fields, err := scimGroupFieldsFrom(resource)
+	if err == nil {
+		err = validateScimGroup(&fields)
+	}
+	if err != nil {
+		return scimRequestFailed(ctx, err)
+	}
+	add, _, err := s.scimMemberChanges(ctx, tenant, nil, fields.Members)
+	if err != nil {
+		return scimRequestFailed(ctx, err)
+	}
+
+	organization := repository.Organization{
+		ID:         uuid.NewString(),
+		Name:       fields.Name,
+		Tenant:     &tenant,
+		ExternalID: fields.ExternalID,
+		CreatedAt:  time.Now(),
+	}
+	err = s.Repository.CreateOrganization(ctx.Request().Context(), organization, "")
+	if err != nil {
+		return scimRequestFailed(ctx, err)
+	}
+	if len(add) > 0 {
+		err = s.Repository.ChangeMembers(ctx.Request().Context(), organization.ID, add, nil)
+		if err != nil {
+			return scimRequestFailed(ctx, err)
+		}
+	}
+	return s.scimGroupResponse(ctx, http.StatusCreated, organization)
+}
+
+// GetScimV2GroupsId : this handler is for SCIM clients reading a group of their tenant
+func (s *Server) GetScimV2GroupsId(ctx echo.Context, id string, params generated.GetScimV2GroupsIdParams) error {
+	tenant, err := s.authenticateSCIM(ctx)
+	if err != nil {
+		log.Error(err)
+		return scimError(ctx, http.StatusUnauthorized, "", "Invalid bearer token")
+	}
+
+	organization, err := s.findScimGroup(ctx, tenant, id)
+	if err != nil {
+		return scimGroupNotFound(ctx, err)
+	}
+	resource, err := s.scimGroup(ctx, organization, !excludesMembers(params.ExcludedAttributes))
+	if err != nil {
+		return scimRequestFailed(ctx, err)
+	}
+	return scimJSON(ctx, http.StatusOK, resource)
+}
+
+// PutScimV2GroupsId : this handler is for SCIM clients replacing a group of their tenant, the members become exactly the given members
+func (s *Server) PutScimV2GroupsId(ctx echo.Context, id string) error {
+	tenant, err := s.authenticateSCIM(ctx)
+	if err != nil {
+		log.Error(err)
+		return scimError(ctx, http.StatusUnauthorized, "", "Invalid bearer token")
+	}
+
+	var resource generated.ScimGroup
+	if err := decodeSCIM(ctx, &resource); err != nil {
+		return scimRequestFailed(ctx, err)
+	}
+	fields, err := scimGroupFieldsFrom(resource)
+	if err != nil {
+		return scimRequestFailed(ctx, err)
+	}
+	organization, err := s.findScimGroup(ctx, tenant, id)
+	if err != nil {
+		return scimGroupNotFound(ctx, err)
+	}
+	current, err := s.memberIDs(ctx, organization.ID)
+	if err != nil {
+		return scimRequestFailed(ctx, err)
+	}
+	return s.saveScimGroup(ctx, tenant, organization, current, fields)
+}
+
+// PatchScimV2GroupsId : this handler is for SCIM clients modifying a group of their tenant such as adding and removing members
+func (s *Server) PatchScimV2GroupsId(ctx echo.Context, id string) error {
+	tenant, err := s.authenticateSCIM(ctx)
+	if err != nil {
+		log.Error(err)
+		return scimError(ctx, http.StatusUnauthorized, "", "Invalid bearer token")
+	}
+
+	var req generated.ScimPatchRequest
+	if err := decodeSCIM(ctx, &req); err != nil {
+		return scimRequestFailed(ctx, err)
+	}
+	organization, err := s.findScimGroup(ctx, tenant, id)
+	if err != nil {
+		return scimGroupNotFound(ctx, err)
+	}
+	current, err := s.memberIDs(ctx, organization.ID)
+	if err != nil {
+		return scimRequestFailed(ctx, err)
+	}
+
+	fields := scimGroupFields{Name: organization.Name, ExternalID: organization.ExternalID, Members: map[string]bool{}}
+	for _, id := range current {
+		fields.Members[id] = true
+	}
+	for _, operation := range req.Operations {
+		op, value, err := scimOperation(operation)
+		if err == nil {
+			path := ""
+			if operation.Path != nil {
+				path = *operation.Path
+			}
+			err = applyScimGroupOperation(&fields, op, path, value)
+		}
+		if err != nil {
+			return scimRequestFailed(ctx, err)
+		}
+	}
+	return s.saveScimGroup(ctx, tenant, organization, current, fields)
+}
+
+// memberIDs : user ids of the members of the organization
+func (s *Server) memberIDs(ctx echo.Context, organizationID string) ([]string, error) {
+	members, err := s.Repository.ListOrganizationMembers(ctx.Request().Context(), organizationID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(members))
+	for i, member := range members {
+		ids[i] = member.UserID
+	}
+	return ids, nil
+}
+
+// saveScimGroup : validate and store the changed attributes of the group and the difference with the current members
+func (s *Server) saveScimGroup(ctx echo.Context, tenant string, organization repository.Organization, current []string, fields scimGroupFields) error {
+	if err := validateScimGroup(&fields); err != nil {
+		return scimRequestFailed(ctx, err)
+	}
+	add, remove, err := s.scimMemberChanges(ctx, tenant, current, fields.Members)
+	if err != nil {
+		return scimRequestFailed(ctx, err)
+	}
+
+	externalIDChanged := (organization.ExternalID == nil) != (fields.ExternalID == nil) ||
+		(organization.ExternalID != nil && *organization.ExternalID != *fields.ExternalID)
+	if organization.Name != fields.Name || externalIDChanged {
+		organization.Name, organization.ExternalID = fields.Name, fields.ExternalID
+		err = s.Repository.UpdateOrganization(ctx.Request().Context(), organization)
+		if err != nil {
+			return scimGroupNotFound(ctx, err)
+		}
+	}
+	if len(add) > 0 || len(remove) > 0 {
+		err = s.Repository.ChangeMembers(ctx.Request().Context(), organization.ID, add, remove)
+		if errors.Is(err, repository.ErrLastOwner) {
+			return scimError(ctx, http.StatusConflict, "", "Organization must keep at least one owner")
+		}
+		if err != nil {
+			return scimRequestFailed(ctx, err)
+		}
+	}
+	return s.scimGroupResponse(ctx, http.StatusOK, organization)
+}
+
+// DeleteScimV2GroupsId : this handler is for SCIM clients deleting a group of their tenant, its members are not deleted
+func (s *Server) DeleteScimV2GroupsId(ctx echo.Context, id string) error {
+	tenant, err := s.authenticateSCIM(ctx)
+	if err != nil {
+		log.Error(err)
+		return scimError(ctx, http.StatusUnauthorized, "", "Invalid bearer token")
+	}
+
+	organization, err := s.findScimGroup(ctx, tenant, id)
+	if err != nil {
+		return scimGroupNotFound(ctx, err)
+	}
+	err = s.Repository.DeleteOrganization(ctx.Request().Context(), organization.ID)
+	if err != nil {
+		return scimGroupNotFound(ctx, err)
+	}
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// excludesMembers : excludedAttributes contains members
+func excludesMembers(excludedAttributes *string) bool {
+	if excludedAttributes == nil {
+		return false
+	}
+	for _, attribute := range strings.Split(*excludedAttributes, ",") {
+		if strings.EqualFold(strings.TrimSpace(attribute), "members") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,324 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/oauth"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scimFixture : recorded SCIM exchanges replayed in order, later steps use the values captured by earlier ones
+type scimFixture struct {
+	Description string            `json:"description"`
+	Users       []scimFixtureUser `json:"users"`
+	Steps       []scimFixtureStep `json:"steps"`
+}
+
+// scimFixtureUser : user that exists before the first step
+type scimFixtureUser struct {
+	ID     string `json:"id"`
+	Phone  string `json:"phone"`
+	Name   string `json:"name"`
+	Tenant string `json:"tenant"`
+}
+
+type scimFixtureStep struct {
+	Name    string `json:"name"`
+	Request struct {
+		// Client is acme by default, globex is a client of another tenant and none sends no token
+		Client  string            `json:"client"`
+		Method  string            `json:"method"`
+		Path    string            `json:"path"`
+		Query   map[string]string `json:"query"`
+		Headers map[string]string `json:"headers"`
+		Body    json.RawMessage   `json:"body"`
+	} `json:"request"`
+	Response struct {
+		Status  int               `json:"status"`
+		Headers map[string]string `json:"headers"`
+		Body    json.RawMessage   `json:"body"`
+	} `json:"response"`
+}
+
+// TestSCIMConformance : replay the fixtures of testdata/scim against an in memory repository
+func TestSCIMConformance(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "scim", "*.json"))
+	require.NoError(t, err)
+	require.NotEmpty(t, paths)
+
+	for _, path := range paths {
+		t.Run(strings.TrimSuffix(filepath.Base(path), ".json"), func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			var fixture scimFixture
+			require.NoError(t, json.Unmarshal(data, &fixture))
+			replayScimFixture(t, fixture)
+		})
+	}
+}
+
+func replayScimFixture(t *testing.T, fixture scimFixture) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	tokens := map[string]string{}
+	for _, tenant := range []string{"acme", "globex"} {
+		client, _, err := oauth.NewClient(oauth.NewClientOptions{Name: tenant + " provisioning", Scopes: []string{oauth.ScopeSCIM}, Tenant: tenant})
+		require.NoError(t, err)
+		require.NoError(t, repo.CreateOAuthClient(ctx, client))
+		tokens[tenant], _ = createClientToken(client.ID, client.Scopes, time.Now().Add(time.Hour))
+	}
+	for _, user := range fixture.Users {
+		require.NoError(t, repo.ProvisionUser(ctx, repository.User{ID: user.ID, Phone: user.Phone, Name: user.Name, Tenant: user.Tenant, Version: 1}))
+	}
+
+	e := echo.New()
+	generated.RegisterHandlers(e, NewServer(NewServerOptions{Repository: repo, BaseURL: "https://sawitpro.example.com"}))
+
+	vars := map[string]string{}
+	for i, step := range fixture.Steps {
+		name := fmt.Sprintf("step %d %s", i+1, step.Name)
+
+		target := substituteScimVars(step.Request.Path, vars)
+		if len(step.Request.Query) > 0 {
+			query := url.Values{}
+			for key, value := range step.Request.Query {
+				query.Set(key, substituteScimVars(value, vars))
+			}
+			target += "?" + query.Encode()
+		}
+		req := httptest.NewRequest(step.Request.Method, target, strings.NewReader(substituteScimVars(string(step.Request.Body), vars)))
+		req.Header.Set(echo.HeaderContentType, scimContentType)
+		for key, value := range step.Request.Headers {
+			req.Header.Set(key, substituteScimVars(value, vars))
+		}
+		switch step.Request.Client {
+		case "none":
+		case "":
+			req.Header.Set("Authorization", "Bearer "+tokens["acme"])
+		default:
+			req.Header.Set("Authorization", "Bearer "+tokens[step.Request.Client])
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		require.Equal(t, step.Response.Status, rec.Code, "%s: %s", name, rec.Body.String())
+		if len(step.Response.Body) > 0 {
+			assert.Equal(t, scimContentType, rec.Header().Get(echo.HeaderContentType), name)
+
+			var expected, actual interface{}
+			require.NoError(t, json.Unmarshal(step.Response.Body, &expected), name)
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &actual), "%s: %s", name, rec.Body.String())
+			for _, mismatch := range matchScimJSON("$", expected, actual, vars) {
+				t.Errorf("%s: %s\nresponse: %s", name, mismatch, rec.Body.String())
+			}
+		}
+		// Headers are compared after the body so they can use the values it captured
+		for key, value := range step.Response.Headers {
+			assert.Equal(t, substituteScimVars(value, vars), rec.Header().Get(key), "%s: header %s", name, key)
+		}
+	}
+}
+
+var scimVarRegex = regexp.MustCompile(`{{(\w+)}}`)
+
+func substituteScimVars(value string, vars map[string]string) string {
+	return scimVarRegex.ReplaceAllStringFunc(value, func(match string) string {
+		return vars[scimVarRegex.FindStringSubmatch(match)[1]]
+	})
+}
+
+// matchScimJSON : mismatches of actual with expected, objects only need the expected members,
+// "$any" matches any value that is not null and "$capture:name" also keeps the value as {{name}}
+func matchScimJSON(path string, expected, actual interface{}, vars map[string]string) (mismatches []string) {
+	switch expected := expected.(type) {
+	case map[string]interface{}:
+		object, ok := actual.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected object, got %v", path, actual)}
+		}
+		keys := make([]string, 0, len(expected))
+		for key := range expected {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value, ok := object[key]
+			if !ok {
+				if expected[key] != nil {
+					mismatches = append(mismatches, fmt.Sprintf("%s.%s: missing", path, key))
+				}
+				continue
+			}
+			mismatches = append(mismatches, matchScimJSON(path+"."+key, expected[key], value, vars)...)
+		}
+	case []interface{}:
+		array, ok := actual.([]interface{})
+		if !ok || len(array) != len(expected) {
+			return []string{fmt.Sprintf("%s: expected %d items, got %v", path, len(expected), actual)}
+		}
+		for i := range expected {
+			mismatches = append(mismatches, matchScimJSON(fmt.Sprintf("%s[%d]", path, i), expected[i], array[i], vars)...)
+		}
+	case string:
+		if expected == "$any" {
+			if actual == nil {
+				return []string{fmt.Sprintf("%s: expected a value", path)}
+			}
+			return nil
+		}
+		if strings.HasPrefix(expected, "$capture:") {
+			str, ok := actual.(string)
+			if !ok {
+				return []string{fmt.Sprintf("%s: expected string to capture, got %v", path, actual)}
+			}
+			vars[strings.TrimPrefix(expected, "$capture:")] = str
+			return nil
+		}
+		if substituted := substituteScimVars(expected, vars); substituted != actual {
+			return []string{fmt.Sprintf("%s: expected %q, got %v", path, substituted, actual)}
+		}
+	default:
+		if expected != actual {
+			return []string{fmt.Sprintf("%s: expected %v, got %v", path, expected, actual)}
+		}
+	}
+	return mismatches
+}
+
+func TestParseScimFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   string
+		expected []scimComparison
+		detail   string
+	}{
+		{
+			name:     "Okta user lookup",
+			filter:   `userName eq "+6281234567890"`,
+			expected: []scimComparison{{Attribute: "username", Operator: "eq", Value: "+6281234567890"}},
+		}, {
+			name:   "Comparisons joined by and",
+			filter: `externalId PR AND active eq False and meta.lastModified gt "2024-05-01T00:00:00Z"`,
+			expected: []scimComparison{
+				{Attribute: "externalid", Operator: "pr"},
+				{Attribute: "active", Operator: "eq", Value: false},
+				{Attribute: "meta.lastmodified", Operator: "gt", Value: "2024-05-01T00:00:00Z"},
+			},
+		}, {
+			name:     "Quoted value with spaces and escaped quote",
+			filter:   `displayName co "Kebun \"Riau\" 1"`,
+			expected: []scimComparison{{Attribute: "displayname", Operator: "co", Value: `Kebun "Riau" 1`}},
+		}, {
+			name:   "Or is not supported",
+			filter: `userName eq "a" or userName eq "b"`,
+			detail: "Unsupported filter or, only and is supported between comparisons",
+		}, {
+			name:   "Grouping is not supported",
+			filter: `emails[type eq "work"]`,
+			detail: "Grouping and value filters are not supported in filter",
+		}, {
+			name:   "Unknown operator",
+			filter: `userName like "a"`,
+			detail: "Unsupported filter operator like",
+		}, {
+			name:   "Missing value",
+			filter: `userName eq`,
+			detail: "Incomplete filter comparison",
+		}, {
+			name:   "Unterminated string",
+			filter: `userName eq "+62`,
+			detail: "Unterminated string in filter",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comparisons, err := parseScimFilter(tt.filter)
+			if tt.detail != "" {
+				var requestErr *scimRequestError
+				assert.ErrorAs(t, err, &requestErr)
+				assert.Equal(t, "invalidFilter", requestErr.ScimType)
+				assert.Equal(t, tt.detail, requestErr.Detail)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, comparisons)
+		})
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	assert.Equal(t, `50\% off\_sale\\`, escapeLike(`50% off_sale\`))
+
+	// Only the literal % matches, not any character
+	repo := repository.NewMemoryRepository()
+	require.NoError(t, repo.ProvisionUser(context.Background(), repository.User{ID: "1", Phone: "+62856712331", Name: "50% off", Tenant: "acme", Version: 1}))
+	require.NoError(t, repo.ProvisionUser(context.Background(), repository.User{ID: "2", Phone: "+62856712332", Name: "500 off", Tenant: "acme", Version: 1}))
+	users, total, err := repo.ListUsers(context.Background(), []repository.Param{
+		{Logic: "AND", Field: "name", Operator: "ILIKE", Value: "%" + escapeLike("0% O") + "%"},
+	}, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, "50% off", users[0].Name)
+	}
+}
+
+func TestScimDeactivateRejectsTokens(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	client, _, err := oauth.NewClient(oauth.NewClientOptions{Name: "acme provisioning", Scopes: []string{oauth.ScopeSCIM}, Tenant: "acme"})
+	require.NoError(t, err)
+	require.NoError(t, repo.CreateOAuthClient(context.Background(), client))
+	clientToken, _ := createClientToken(client.ID, client.Scopes, time.Now().Add(time.Hour))
+
+	id := "3f0c8a52-6d1e-4b7a-9c2f-8e5d4a3b2c1d"
+	require.NoError(t, repo.ProvisionUser(context.Background(), repository.User{ID: id, Phone: "+62856712332", Name: "User", Tenant: "acme", Version: 1}))
+	pat, err := generatePersonalAccessToken()
+	require.NoError(t, err)
+	require.NoError(t, repo.CreatePersonalAccessToken(context.Background(), repository.PersonalAccessToken{
+		ID:        "9b2f5c1e-4d7a-4e8b-9c3d-2a1b0c9d8e7f",
+		UserID:    id,
+		Name:      "ci",
+		TokenHash: hashPersonalAccessToken(pat),
+		Prefix:    pat[:len(personalAccessTokenPrefix)+6],
+		Scopes:    []string{scopeProfileRead},
+		ExpiresAt: time.Now().Add(time.Hour),
+	}))
+	jwt, _ := createToken(id, time.Now().Add(time.Hour))
+
+	e := echo.New()
+	generated.RegisterHandlers(e, NewServer(NewServerOptions{Repository: repo}))
+	serve := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, scimContentType)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/profile", pat, "").Code)
+
+	rec := serve(http.MethodPatch, "/scim/v2/Users/"+id, clientToken, `{"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"], "Operations": [{"op": "replace", "path": "active", "value": false}]}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	// Deactivation takes effect immediately, without waiting for the tokens to expire
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/profile", pat, "").Code)
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/profile", jwt, "").Code)
+}
@@ -0,0 +1,588 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// scimUserAttributes : filterable attributes of users in lower case
+var scimUserAttributes = map[string]scimAttribute{
+	"id":                 {Column: "id", Type: scimID},
+	"username":           {Column: "phone", Type: scimPhone},
+	"phonenumbers":       {Column: "phone", Type: scimPhone},
+	"phonenumbers.value": {Column: "phone", Type: scimPhone},
+	"externalid":         {Column: "external_id", Type: scimString},
+	"displayname":        {Column: "name", Type: scimString},
+	"name.formatted":     {Column: "name", Type: scimString},
+	"emails":             {Column: "email", Type: scimEmail},
+	"emails.value":       {Column: "email", Type: scimEmail},
+	"preferredlanguage":  {Column: "preferred_language", Type: scimString},
+	"active":             {Column: "(deactivated_at IS NULL)", Type: scimBool},
+	"meta.created":       {Column: "created_at", Type: scimTime},
+	"meta.lastmodified":  {Column: "COALESCE(updated_at, created_at)", Type: scimTime},
+}
+
+// scimUserFields : attributes of a user that can be provisioned, Password is nil when it does not change
+type scimUserFields struct {
+	Phone             string
+	Name              string
+	Email             *string
+	ExternalID        *string
+	PreferredLanguage *string
+	Active            bool
+	Password          *string
+}
+
+// scimNameParts : givenName and familyName of PATCH operations, the name is only set from them when both are given
+type scimNameParts struct {
+	Given, Family *string
+}
+
+func scimUserFieldsOf(user repository.User) scimUserFields {
+	return scimUserFields{
+		Phone:             user.Phone,
+		Name:              user.Name,
+		Email:             user.Email,
+		ExternalID:        user.ExternalID,
+		PreferredLanguage: user.PreferredLanguage,
+		Active:            user.DeactivatedAt == nil,
+	}
+}
+
+// scimUserFieldsFrom : attributes of the resource, active is the default when the resource has none
+func scimUserFieldsFrom(resource generated.ScimUser, active bool) scimUserFields {
+	fields := scimUserFields{
+		Phone:             resource.UserName,
+		Name:              scimName(resource.DisplayName, resource.Name),
+		ExternalID:        resource.ExternalId,
+		PreferredLanguage: resource.PreferredLanguage,
+		Active:            active,
+		Password:          resource.Password,
+	}
+	if resource.Active != nil {
+		fields.Active = *resource.Active
+	}
+	if fields.Phone == "" && resource.PhoneNumbers != nil {
+		if phone := primaryValue(*resource.PhoneNumbers); phone != nil {
+			fields.Phone = *phone
+		}
+	}
+	if resource.Emails != nil {
+		fields.Email = primaryValue(*resource.Emails)
+	}
+	return fields
+}
+
+// scimName : the single name of the user from displayName, else name.formatted, else givenName and familyName
+func scimName(displayName *string, name *generated.ScimName) string {
+	if displayName != nil && strings.TrimSpace(*displayName) != "" {
+		return *displayName
+	}
+	if name == nil {
+		return ""
+	}
+	if name.Formatted != nil && strings.TrimSpace(*name.Formatted) != "" {
+		return *name.Formatted
+	}
+	var parts []string
+	for _, part := range []*string{name.GivenName, name.FamilyName} {
+		if part != nil && strings.TrimSpace(*part) != "" {
+			parts = append(parts, strings.TrimSpace(*part))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// primaryValue : value of the primary item, else of the first item with a value
+func primaryValue(values []generated.ScimMultiValuedAttribute) *string {
+	var first *string
+	for _, value := range values {
+		if value.Value == nil || *value.Value == "" {
+			continue
+		}
+		if value.Primary != nil && *value.Primary {
+			return value.Value
+		}
+		if first == nil {
+			first = value.Value
+		}
+	}
+	return first
+}
+
+// validateScimUser : normalize the attributes, invalid attribute is returned as scimRequestError
+func (s *Server) validateScimUser(fields *scimUserFields) error {
+	phone, err := s.Phone.Normalize(fields.Phone)
+	if err != nil {
+		return invalidScimValue("Invalid userName. userName must be the phone number of the user, e.g. +62812345678")
+	}
+	fields.Phone = phone
+
+	fields.Name = strings.TrimSpace(fields.Name)
+	if err := service.ValidateName(fields.Name); err != nil {
+		return invalidScimValue("%s", err)
+	}
+
+	if fields.Email != nil {
+		email := strings.ToLower(strings.TrimSpace(*fields.Email))
+		if email == "" {
+			fields.Email = nil
+		} else if !service.IsValidEmail(email) {
+			return invalidScimValue("Invalid email %s", *fields.Email)
+		} else {
+			fields.Email = &email
+		}
+	}
+	if fields.ExternalID != nil {
+		if *fields.ExternalID == "" {
+			fields.ExternalID = nil
+		} else if len(*fields.ExternalID) > 255 {
+			return invalidScimValue("Invalid externalId. externalId must be at most 255 characters")
+		}
+	}
+	if fields.PreferredLanguage != nil {
+		if *fields.PreferredLanguage == "" {
+			fields.PreferredLanguage = nil
+		} else if !service.LanguageTagRegex.MatchString(*fields.PreferredLanguage) {
+			return invalidScimValue("Invalid preferredLanguage. preferredLanguage must be a language tag, e.g. id or en-US")
+		}
+	}
+	if fields.Password != nil {
+		if err := service.ValidatePassword(*fields.Password); err != nil {
+			return invalidScimValue("%s", err)
+		}
+	}
+	return nil
+}
+
+// scimUserChanges : columns and new values of the attributes that differ from the user, a new password is hashed with a new salt
+func (s *Server) scimUserChanges(user repository.User, fields scimUserFields, now time.Time) (map[string]interface{}, error) {
+	changes := service.ProfileChanges(
+		service.Profile{Phone: user.Phone, Name: user.Name, Email: user.Email, PreferredLanguage: user.PreferredLanguage},
+		service.Profile{Phone: fields.Phone, Name: fields.Name, Email: fields.Email, PreferredLanguage: fields.PreferredLanguage},
+	)
+
+	if (user.ExternalID == nil) != (fields.ExternalID == nil) || (user.ExternalID != nil && *user.ExternalID != *fields.ExternalID) {
+		changes["external_id"] = fields.ExternalID
+	}
+	if active := user.DeactivatedAt == nil; active != fields.Active {
+		if fields.Active {
+			changes["deactivated_at"] = nil
+		} else {
+			changes["deactivated_at"] = now
+		}
+	}
+	if fields.Password != nil {
+		hashedPassword, salt, err := s.Users.HashPassword(*fields.Password)
+		if err != nil {
+			return nil, err
+		}
+		changes["password"] = hashedPassword
+		changes["salt"] = salt
+	}
+	return changes, nil
+}
+
+// applyScimUserOperation : apply PATCH operation to the attributes, attributes that are not stored are ignored
+func applyScimUserOperation(fields *scimUserFields, names *scimNameParts, op string, path string, value interface{}) error {
+	if path == "" {
+		// Without path the value is an object of the attributes to add or replace
+		attributes, err := scimPathlessValue(op, value)
+		if err != nil {
+			return err
+		}
+		for _, attribute := range attributes {
+			if err := applyScimUserOperation(fields, names, op, attribute.Path, attribute.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	target, err := parseScimPath(path, scimUserSchema)
+	if err != nil {
+		return err
+	}
+	if op == "remove" {
+		switch target.Attribute {
+		case "emails":
+			fields.Email = nil
+		case "externalid":
+			fields.ExternalID = nil
+		case "preferredlanguage":
+			fields.PreferredLanguage = nil
+		case "active", "username", "displayname", "name", "phonenumbers", "password":
+			return &scimRequestError{ScimType: "mutability", Detail: fmt.Sprintf("Attribute %s cannot be removed", target.Attribute)}
+		}
+		return nil
+	}
+
+	switch target.Attribute {
+	case "active":
+		fields.Active, err = scimBoolValue("active", value)
+	case "username":
+		fields.Phone, err = scimStringValue("userName", value)
+	case "displayname":
+		fields.Name, err = scimStringValue("displayName", value)
+	case "name":
+		err = applyScimName(fields, names, target.SubAttribute, value)
+	case "emails", "phonenumbers":
+		var str string
+		if target.Filter != "" || target.SubAttribute == "value" {
+			str, err = scimStringValue(target.Attribute, value)
+		} else if target.SubAttribute == "" {
+			var values []generated.ScimMultiValuedAttribute
+			if err = decodeScimValue(target.Attribute, value, &values); err == nil {
+				if primary := primaryValue(values); primary != nil {
+					str = *primary
+				}
+			}
+		} else {
+			// Sub-attributes other than value such as type are not stored
+			return nil
+		}
+		if err == nil && target.Attribute == "emails" {
+			fields.Email = &str
+		} else if err == nil && str != "" {
+			fields.Phone = str
+		}
+	case "externalid":
+		var str string
+		str, err = scimStringValue("externalId", value)
+		fields.ExternalID = &str
+	case "preferredlanguage":
+		var str string
+		str, err = scimStringValue("preferredLanguage", value)
+		fields.PreferredLanguage = &str
+	case "password":
+		var str string
+		str, err = scimStringValue("password", value)
+		fields.Password = &str
+	}
+	return err
+}
+
+func applyScimName(fields *scimUserFields, names *scimNameParts, subAttribute string, value interface{}) error {
+	switch subAttribute {
+	case "":
+		var values []generated.ScimName
+		if err := decodeScimValue("name", value, &values); err != nil || len(values) != 1 {
+			return invalidScimValue("Invalid name")
+		}
+		if formatted := scimName(nil, &values[0]); formatted != "" {
+			fields.Name = formatted
+		}
+	case "formatted":
+		str, err := scimStringValue("name.formatted", value)
+		if err != nil {
+			return err
+		}
+		fields.Name = str
+	case "givenname", "familyname":
+		str, err := scimStringValue("name."+subAttribute, value)
+		if err != nil {
+			return err
+		}
+		if subAttribute == "givenname" {
+			names.Given = &str
+		} else {
+			names.Family = &str
+		}
+	}
+	return nil
+}
+
+// toScimUser : SCIM resource of the user, the password is never returned
+func (s *Server) toScimUser(user repository.User) generated.ScimUser {
+	active := user.DeactivatedAt == nil
+	version := formatETag(user.Version)
+	mobile, work, primary := "mobile", "work", true
+	resource := generated.ScimUser{
+		Schemas:           &[]string{scimUserSchema},
+		Id:                &user.ID,
+		ExternalId:        user.ExternalID,
+		UserName:          user.Phone,
+		Name:              &generated.ScimName{Formatted: &user.Name},
+		DisplayName:       &user.Name,
+		Active:            &active,
+		PhoneNumbers:      &[]generated.ScimMultiValuedAttribute{{Value: &user.Phone, Type: &mobile, Primary: &primary}},
+		PreferredLanguage: user.PreferredLanguage,
+		Meta:              s.scimMeta("User", user.ID, user.CreatedAt, user.UpdatedAt, &version),
+	}
+	if user.Email != nil {
+		resource.Emails = &[]generated.ScimMultiValuedAttribute{{Value: user.Email, Type: &work, Primary: &primary}}
+	}
+	return resource
+}
+
+func (s *Server) scimUserResponse(ctx echo.Context, status int, user repository.User) error {
+	ctx.Response().Header().Set("ETag", formatETag(user.Version))
+	if status == http.StatusCreated {
+		ctx.Response().Header().Set(echo.HeaderLocation, s.scimLocation("User", user.ID))
+	}
+	return scimJSON(ctx, status, s.toScimUser(user))
+}
+
+// findScimUser : user of the tenant, repository.ErrNotFound when the id is not a user of the tenant
+func (s *Server) findScimUser(ctx echo.Context, tenant string, id string) (repository.User, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return repository.User{}, repository.ErrNotFound
+	}
+	return s.Repository.FindUser(ctx.Request().Context(),
+		repository.Param{Logic: "AND", Field: "id", Operator: "=", Value: id},
+		repository.Param{Logic: "AND", Field: "tenant", Operator: "=", Value: tenant},
+	)
+}
+
+// scimUserNotFound : response of findScimUser error
+func scimUserNotFound(ctx echo.Context, err error) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return scimError(ctx, http.StatusNotFound, "", "User not found")
+	}
+	log.Error(err)
+	return scimError(ctx, http.StatusInternalServerError, "", "Internal Server Error")
+}
+
+// scimSaveFailed : response of error storing the user, conflict when the phone number or email is already registered
+func scimSaveFailed(ctx echo.Context, err error) error {
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return scimError(ctx, http.StatusConflict, "", "User has been modified")
+	}
+	switch duplicate := service.DuplicateError(err); {
+	case errors.Is(duplicate, service.ErrDuplicateEmail):
+		return scimError(ctx, http.StatusConflict, "uniqueness", "Email already exist")
+	case errors.Is(duplicate, service.ErrDuplicatePhone):
+		return scimError(ctx, http.StatusConflict, "uniqueness", "Phone number already exist")
+	}
+	return scimRequestFailed(ctx, err)
+}
+
+// GetScimV2Users : this handler is for SCIM clients listing the users of their tenant
+func (s *Server) GetScimV2Users(ctx echo.Context, params generated.GetScimV2UsersParams) error {
+	tenant, err := s.authenticateSCIM(ctx)
+	if err != nil {
+		log.Error(err)
+		return scimError(ctx, http.StatusUnauthorized, "", "Invalid bearer token")
+	}
+
+	filters := []repository.Param{{Logic: "AND", Field: "tenant", Operator: "=", Value: tenant}}
+	offset, limit := scimPage(params.StartIndex, params.Count)
+	if params.Filter != nil && strings.TrimSpace(*params.Filter) != "" {
+		comparisons, err := parseScimFilter(*params.Filter)
+		if err != nil {
+			return scimRequestFailed(ctx, err)
+		}
+		params, none, err := s.scimFilterParams(comparisons, scimUserAttributes)
+		if err != nil {
+			return scimRequestFailed(ctx, err)
+		}
+		if none {
+			return scimJSON(ctx, http.StatusOK, scimListResponse(nil, 0, offset))
+		}
+		filters = append(filters, params...)
+	}
+
+	users, total, err := s.Repository.ListUsers(ctx.Request().Context(), filters, offset, limit)
+	if err != nil {
+		log.Error(err)
+		return scimError(ctx, http.StatusInternalServerError, "", "Internal Server Error")
+	}
+
+	resources := make([]interface{}, len(users))
+	for i, user := range users {
+		resources[i] = s.toScimUser(user)
+	}
+	return scimJSON(ctx, http.StatusOK, scimListResponse(resources, total, offset))
+}
+
+// PostScimV2Users : this handler is for SCIM clients provisioning a user, without password the user logs in with SMS one time passcodes
+func (s *Server) PostScimV2Users(ctx echo.Context) error {
+	tenant, err := s.authenticateSCIM(ctx)
+	if err != nil {
+		log.Error(err)
+		return scimError(ctx, http.StatusUnauthorized, "", "Invalid bearer token")
+	}
+
+	var resource generated.ScimUser
+	if err := decodeSCIM(ctx, &resource); err != nil {
+		return scimRequestFailed(ctx, err)
+	}
+	fields := scimUserFieldsFrom(resource, true)
+	if err := s.validateScimUser(&fields); err != nil {
+		return scimRequestFailed(ctx, err)
+	}
+
+	now := time.Now()
+	user := repository.User{
+		ID:                uuid.NewString(),
+		Phone:             fields.Phone,
+		Name:              fields.Name,
+		Email:             fields.Email,
+		PreferredLanguage: fields.PreferredLanguage,
+		Tenant:            tenant,
+		ExternalID:        fields.ExternalID,
+		Version:           1,
+		CreatedAt:         now,
+	}
+	if !fields.Active {
+		user.DeactivatedAt = &now
+	}
+
+	password := fields.Password
+	if password == nil {
+		// Nobody knows the random password, the user logs in with a passcode sent to the phone
+		random, err := s.Users.Salts.Generate()
+		if err != nil {
+			return scimRequestFailed(ctx, err)
+		}
+		password = &random
+		user.OTPLoginEnabled = true
+	}
+	if user.Password, user.Salt, err = s.Users.HashPassword(*password); err != nil {
+		return scimRequestFailed(ctx, err)
+	}
+
+	err = s.Repository.ProvisionUser(ctx.Request().Context(), user)
+	if err != nil {
+		return scimSaveFailed(ctx, err)
+	}
+	return s.scimUserResponse(ctx, http.StatusCreated, user)
+}
+
+// GetScimV2UsersId : this handler is for SCIM clients reading a user of their tenant
+func (s *Server) GetScimV2UsersId(ctx echo.Context, id string) error {
+	tenant, err := s.authenticateSCIM(ctx)
+	if err != nil {
+		log.Error(err)
+		return scimError(ctx, http.StatusUnauthorized, "", "Invalid bearer token")
+	}
+
+	user, err := s.findScimUser(ctx, tenant, id)
+	if err != nil {
+		return scimUserNotFound(ctx, err)
+	}
+	return s.scimUserResponse(ctx, http.StatusOK, user)
+}
+
+// PutScimV2UsersId : this handler is for SCIM clients replacing a user of their tenant
+func (s *Server) PutScimV2UsersId(ctx echo.Context, id string, params generated.PutScimV2UsersIdParams) error {
+	tenant, err := s.authenticateSCIM(ctx)
+	if err != nil {
+		log.Error(err)
+		return scimError(ctx, http.StatusUnauthorized, "", "Invalid bearer token")
+	}
+
+	var resource generated.ScimUser
+	if err := decodeSCIM(ctx, &resource); err != nil {
+		return scimRequestFailed(ctx, err)
+	}
+	user, err := s.findScimUser(ctx, tenant, id)
+	if err != nil {
+		return scimUserNotFound(ctx, err)
+	}
+	if params.IfMatch != nil && !matchETag(*params.IfMatch, user.Version) {
+		return scimError(ctx, http.StatusPreconditionFailed, "", "User has been modified")
+	}
+
+	// A replaced user keeps its state when active is not given, so a client that does not know it cannot reactivate the user
+	return s.saveScimUser(ctx, user, scimUserFieldsFrom(resource, user.DeactivatedAt == nil))
+}
+
+// PatchScimV2UsersId : this handler is for SCIM clients modifying a user of their tenant, setting active to false deactivates the user
+func (s *Server) PatchScimV2UsersId(ctx echo.Context, id string, params generated.PatchScimV2UsersIdParams) error {
+	tenant, err := s.authenticateSCIM(ctx)
+	if err != nil {
+		log.Error(err)
+		return scimError(ctx, http.StatusUnauthorized, "", "Invalid bearer token")
+	}
+
+	var req generated.ScimPatchRequest
+	if err := decodeSCIM(ctx, &req); err != nil {
+		return scimRequestFailed(ctx, err)
+	}
+	user, err := s.findScimUser(ctx, tenant, id)
+	if err != nil {
+		return scimUserNotFound(ctx, err)
+	}
+	if params.IfMatch != nil && !matchETag(*params.IfMatch, user.Version) {
+		return scimError(ctx, http.StatusPreconditionFailed, "", "User has been modified")
+	}
+
+	fields := scimUserFieldsOf(user)
+	var names scimNameParts
+	for _, operation := range req.Operations {
+		op, value, err := scimOperation(operation)
+		if err == nil {
+			path := ""
+			if operation.Path != nil {
+				path = *operation.Path
+			}
+			err = applyScimUserOperation(&fields, &names, op, path, value)
+		}
+		if err != nil {
+			return scimRequestFailed(ctx, err)
+		}
+	}
+	if names.Given != nil && names.Family != nil {
+		fields.Name = strings.TrimSpace(*names.Given + " " + *names.Family)
+	}
+	return s.saveScimUser(ctx, user, fields)
+}
+
+// saveScimUser : validate and store the changed attributes of the user, the user is read again for its version and modification time
+func (s *Server) saveScimUser(ctx echo.Context, user repository.User, fields scimUserFields) error {
+	if err := s.validateScimUser(&fields); err != nil {
+		return scimRequestFailed(ctx, err)
+	}
+	changes, err := s.scimUserChanges(user, fields, time.Now())
+	if err != nil {
+		return scimRequestFailed(ctx, err)
+	}
+	if len(changes) == 0 {
+		return s.scimUserResponse(ctx, http.StatusOK, user)
+	}
+
+	err = s.Repository.PatchUser(ctx.Request().Context(), repository.PatchUser{
+		ID:      user.ID,
+		Version: user.Version,
+		Fields:  changes,
+	})
+	if err != nil {
+		return scimSaveFailed(ctx, err)
+	}
+
+	user, err = s.findScimUser(ctx, user.Tenant, user.ID)
+	if err != nil {
+		return scimUserNotFound(ctx, err)
+	}
+	return s.scimUserResponse(ctx, http.StatusOK, user)
+}
+
+// DeleteScimV2UsersId : this handler is for SCIM clients deleting a user of their tenant
+func (s *Server) DeleteScimV2UsersId(ctx echo.Context, id string) error {
+	tenant, err := s.authenticateSCIM(ctx)
+	if err != nil {
+		log.Error(err)
+		return scimError(ctx, http.StatusUnauthorized, "", "Invalid bearer token")
+	}
+
+	user, err := s.findScimUser(ctx, tenant, id)
+	if err != nil {
+		return scimUserNotFound(ctx, err)
+	}
+	err = s.Repository.DeleteUser(ctx.Request().Context(), user.ID)
+	if err != nil {
+		return scimUserNotFound(ctx, err)
+	}
+	return ctx.NoContent(http.StatusNoContent)
+}
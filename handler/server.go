@@ -1,17 +1,77 @@
 package handler
 
-import "github.com/SawitProRecruitment/UserService/repository"
+import (
+	"crypto/rsa"
+	"sync"
+
+	"github.com/SawitProRecruitment/UserService/notification"
+	"github.com/SawitProRecruitment/UserService/phone"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/service"
+	"github.com/SawitProRecruitment/UserService/storage"
+)
 
 type Server struct {
-	Repository repository.RepositoryInterface
+	Repository    repository.RepositoryInterface
+	BlobStore     storage.BlobStore
+	EmailNotifier notification.Notifier
+	SMSNotifier   notification.Notifier
+	// BaseURL is the public url of the service, used to build links sent to users
+	BaseURL string
+	// Phone normalize phone numbers of allowed countries to E.164 before they are stored or looked up
+	Phone *phone.Normalizer
+	// EnumerationProtection hide whether a phone number or email is registered from login and registration responses
+	EnumerationProtection bool
+	// SigningKey sign OpenID Connect id tokens, relying parties verify them with the published JWKS
+	SigningKey *rsa.PrivateKey
+	// Users hold the registration, login and profile rules shared by the REST and gRPC interfaces
+	Users *service.UserService
+
+	// signingKeyOnce generate ephemeral signing key when SigningKey is not set
+	signingKeyOnce sync.Once
+	signingKeyErr  error
 }
 
 type NewServerOptions struct {
-	Repository repository.RepositoryInterface
+	Repository    repository.RepositoryInterface
+	BlobStore     storage.BlobStore
+	EmailNotifier notification.Notifier
+	SMSNotifier   notification.Notifier
+	BaseURL       string
+	// Phone is optional, only Indonesian numbers are accepted when it is not set
+	Phone                 *phone.Normalizer
+	EnumerationProtection bool
+	// SigningKey is optional, an ephemeral key is generated on first use when it is not set
+	SigningKey *rsa.PrivateKey
+	// Users is optional, a user service of the repository and notifiers above is used when it is not set
+	Users *service.UserService
 }
 
 func NewServer(opts NewServerOptions) *Server {
+	if opts.Phone == nil {
+		opts.Phone = phone.DefaultNormalizer()
+	}
+	if opts.Users == nil {
+		opts.Users = service.NewUserService(service.NewUserServiceOptions{
+			Repository:            opts.Repository,
+			SMSNotifier:           opts.SMSNotifier,
+			EmailNotifier:         opts.EmailNotifier,
+			BlobStore:             opts.BlobStore,
+			BaseURL:               opts.BaseURL,
+			Phone:                 opts.Phone,
+			EnumerationProtection: opts.EnumerationProtection,
+			Tokens:                jwtTokenIssuer{},
+		})
+	}
 	return &Server{
-		Repository: opts.Repository,
+		Repository:            opts.Repository,
+		BlobStore:             opts.BlobStore,
+		EmailNotifier:         opts.EmailNotifier,
+		SMSNotifier:           opts.SMSNotifier,
+		BaseURL:               opts.BaseURL,
+		Phone:                 opts.Phone,
+		EnumerationProtection: opts.EnumerationProtection,
+		SigningKey:            opts.SigningKey,
+		Users:                 opts.Users,
 	}
 }
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/service"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// PostProfileSync : this handler is for merging profile edits made on offline devices and pulling the changes since their cursor
+func (s *Server) PostProfileSync(ctx echo.Context) error {
+	// Validate token
+	ID, err := s.authenticate(ctx, scopeProfileWrite)
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
+	}
+
+	req := new(generated.PostProfileSyncJSONRequestBody)
+	if err := ctx.Bind(req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request payload"})
+	}
+
+	request := service.SyncRequest{UserID: ID}
+	if req.Cursor != nil {
+		if *req.Cursor < 0 {
+			return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid cursor"})
+		}
+		request.Cursor = *req.Cursor
+	}
+	if req.Mutations != nil {
+		for _, mutation := range *req.Mutations {
+			// Absent and null value both clear the field
+			submitted := service.SyncMutation{ID: mutation.Id, Field: string(mutation.Field), ChangedAt: mutation.ChangedAt}
+			if mutation.Value != nil {
+				submitted.Value = *mutation.Value
+			}
+			if mutation.Base != nil {
+				submitted.Base = *mutation.Base
+			}
+			request.Mutations = append(request.Mutations, submitted)
+		}
+	}
+
+	result, err := s.Users.Sync(ctx.Request().Context(), request)
+	if err != nil {
+		return respondError(ctx, serviceError(err, "Error when syncing profile"))
+	}
+
+	response := generated.ProfileSyncResponse{
+		Cursor:    result.User.ChangeSeq,
+		Mutations: make([]generated.ProfileMutationResult, 0, len(result.Mutations)),
+	}
+	for _, mutation := range result.Mutations {
+		outcome := generated.ProfileMutationResult{Id: mutation.ID, Status: generated.ProfileMutationResultStatus(mutation.Status)}
+		if mutation.Message != "" {
+			message := mutation.Message
+			outcome.Message = &message
+		}
+		response.Mutations = append(response.Mutations, outcome)
+	}
+	// Unchanged profile is not sent again, devices sync over slow connections
+	if result.Changed {
+		profile := toUserProfile(result.User)
+		response.Profile = &profile
+	}
+
+	ctx.Response().Header().Set("ETag", formatETag(result.User.Version))
+	return ctx.JSON(http.StatusOK, response)
+}
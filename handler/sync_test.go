@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostProfileSync(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	s := NewServer(NewServerOptions{Repository: repo})
+	e := echo.New()
+
+	id := uuid.NewString()
+	_, err := repo.Registration(context.Background(), repository.RegistrationInput{ID: id, Phone: "+62856712332", Name: "User", Password: "hash", Salt: "salt"})
+	require.NoError(t, err)
+	token, _ := createToken(id, time.Now().Add(time.Hour))
+
+	sync := func(jwt string, body string) (*httptest.ResponseRecorder, generated.ProfileSyncResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/profile/sync", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+jwt)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, s.PostProfileSync(e.NewContext(req, rec)))
+
+		var response generated.ProfileSyncResponse
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		}
+		return rec, response
+	}
+
+	// First sync pulls the profile
+	rec, first := sync(token, `{}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, first.Profile)
+	assert.Equal(t, "User", *first.Profile.Name)
+	assert.Empty(t, first.Mutations)
+	assert.Equal(t, formatETag(1), rec.Header().Get("ETag"))
+
+	// Nothing changed since the cursor
+	rec, response := sync(token, `{"cursor": `+jsonNumber(first.Cursor)+`}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Nil(t, response.Profile)
+	assert.Equal(t, first.Cursor, response.Cursor)
+
+	// Profile edited on the server meanwhile
+	estate := "Estate A"
+	require.NoError(t, repo.PatchUser(context.Background(), repository.PatchUser{ID: id, Version: 1, Fields: map[string]interface{}{"estate": estate}}))
+
+	offline := `{"cursor": ` + jsonNumber(first.Cursor) + `, "mutations": [
+		{"id": "m1", "field": "region", "value": "Riau", "base": null, "changed_at": "` + time.Now().Add(-time.Minute).Format(time.RFC3339) + `"},
+		{"id": "m2", "field": "estate", "value": "Estate B", "base": null, "changed_at": "` + time.Now().Add(-time.Hour).Format(time.RFC3339) + `"},
+		{"id": "m3", "field": "phone", "value": "+62811111111", "base": "+62800000000", "changed_at": "` + time.Now().Add(-time.Minute).Format(time.RFC3339) + `"}
+	]}`
+	rec, merged := sync(token, offline)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	outdated := "Field was changed on the server after the edit"
+	conflict := "Field was changed on the server"
+	assert.Equal(t, []generated.ProfileMutationResult{
+		{Id: "m1", Status: generated.Applied},
+		{Id: "m2", Status: generated.Rejected, Message: &outdated},
+		{Id: "m3", Status: generated.Rejected, Message: &conflict},
+	}, merged.Mutations)
+	require.NotNil(t, merged.Profile)
+	assert.Equal(t, "Riau", *merged.Profile.Region)
+	assert.Equal(t, estate, *merged.Profile.Estate)
+	assert.Equal(t, "+62856712332", *merged.Profile.Phone)
+	assert.Greater(t, merged.Cursor, first.Cursor)
+	assert.Equal(t, formatETag(3), rec.Header().Get("ETag"))
+
+	// Replayed batch, e.g. the response was lost, gets the same outcome without another change
+	rec, replayed := sync(token, offline)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, merged.Mutations, replayed.Mutations)
+	assert.Equal(t, merged.Cursor, replayed.Cursor)
+
+	// Invalid edit is rejected, the device cannot fix it while offline
+	rec, response = sync(token, `{"mutations": [{"id": "m4", "field": "name", "value": "ab", "base": "User", "changed_at": "`+time.Now().Format(time.RFC3339)+`"}]}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	require.Len(t, response.Mutations, 1)
+	assert.Equal(t, generated.Rejected, response.Mutations[0].Status)
+	assert.Equal(t, "Invalid full name. Full names must be 3 to 60 characters", *response.Mutations[0].Message)
+
+	rec, _ = sync(token, `{"mutations": [{"id": "m5", "field": "password", "value": "secret", "changed_at": "`+time.Now().Format(time.RFC3339)+`"}]}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "{\"message\":\"Unknown profile field password\"}\n", rec.Body.String())
+
+	rec, _ = sync(token, `{"cursor": -1}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec, _ = sync(token, `{"mutations": "invalid"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec, _ = sync("invalid", `{}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func jsonNumber(value int64) string {
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/generated"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+const (
+	// personalAccessTokenPrefix : recognizable start of every personal access token, lets secret scanners find leaked tokens
+	personalAccessTokenPrefix = "sawit_pat_"
+	// personalAccessTokenDisplayLength : characters of the token kept as prefix to show in token listings
+	personalAccessTokenDisplayLength = len(personalAccessTokenPrefix) + 6
+	// defaultPersonalAccessTokenDays : lifetime of the token when expires_in_days is not set
+	defaultPersonalAccessTokenDays = 90
+
+	scopeProfileRead  = "profile:read"
+	scopeProfileWrite = "profile:write"
+)
+
+// personalAccessTokenScopes : scopes a personal access token can be granted
+var personalAccessTokenScopes = map[string]bool{
+	scopeProfileRead:  true,
+	scopeProfileWrite: true,
+}
+
+// generatePersonalAccessToken : random token with recognizable prefix, 160 bits of entropy
+func generatePersonalAccessToken() (string, error) {
+	randomBytes := make([]byte, 20)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	return personalAccessTokenPrefix + hex.EncodeToString(randomBytes), nil
+}
+
+// hashPersonalAccessToken : SHA-256 of the token, tokens are random so a fast hash is enough to look them up
+func hashPersonalAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// hasScope : check granted scopes allow the required scope, profile:write also allow profile:read
+func hasScope(granted []string, required string) bool {
+	for _, scope := range granted {
+		if scope == required || (scope == scopeProfileWrite && required == scopeProfileRead) {
+			return true
+		}
+	}
+	return false
+}
+
+// bearerToken : token of the Authorization header
+func bearerToken(ctx echo.Context) string {
+	return strings.TrimPrefix(ctx.Request().Header.Get("Authorization"), "Bearer ")
+}
+
+// authenticate : id of the user from JWT or personal access token, empty scope only accept JWT
+func (s *Server) authenticate(ctx echo.Context, scope string) (string, error) {
+	return s.authenticateToken(ctx.Request().Context(), bearerToken(ctx), scope)
+}
+
+// authenticateToken : id of the user from JWT or personal access token without the Bearer prefix, shared by the REST and gRPC authentication.
+// Tokens of deactivated or deleted users are rejected, deactivation does not wait for them to expire
+func (s *Server) authenticateToken(ctx context.Context, tokenString string, scope string) (string, error) {
+	userID, err := s.tokenUserID(ctx, tokenString, scope)
+	if err != nil {
+		return "", err
+	}
+	active, err := s.userActive(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if !active {
+		return "", fmt.Errorf("user %s is deactivated or deleted", userID)
+	}
+	return userID, nil
+}
+
+// tokenUserID : id of the user the token was issued to
+func (s *Server) tokenUserID(ctx context.Context, tokenString string, scope string) (string, error) {
+	if !strings.HasPrefix(tokenString, personalAccessTokenPrefix) {
+		return userIDOfToken(tokenString)
+	}
+	if scope == "" {
+		return "", fmt.Errorf("personal access token cannot be used for this operation")
+	}
+
+	token, err := s.Repository.FindPersonalAccessToken(ctx, hashPersonalAccessToken(tokenString))
+	if err != nil {
+		return "", err
+	}
+	if !hasScope(token.Scopes, scope) {
+		return "", fmt.Errorf("personal access token does not have scope %s", scope)
+	}
+
+	// Last used time is informational, failing to record it must not fail the request
+	if err := s.Repository.TouchPersonalAccessToken(ctx, token.ID); err != nil {
+		log.Error(err)
+	}
+	return token.UserID, nil
+}
+
+// toPersonalAccessToken : convert repository token to response, the hash is never returned
+func toPersonalAccessToken(token repository.PersonalAccessToken) generated.PersonalAccessToken {
+	return generated.PersonalAccessToken{
+		Id:         token.ID,
+		Name:       token.Name,
+		Prefix:     token.Prefix,
+		Scopes:     token.Scopes,
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+		CreatedAt:  token.CreatedAt,
+	}
+}
+
+// PostProfileTokens : this handler is for creating personal access token, only allowed with JWT
+func (s *Server) PostProfileTokens(ctx echo.Context) error {
+	ID, err := s.authenticate(ctx, "")
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
+	}
+
+	req := new(generated.PostProfileTokensJSONRequestBody)
+	if err := ctx.Bind(req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid request payload"})
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid name. Name must be between 1 and 100 characters"})
+	}
+
+	if len(req.Scopes) == 0 {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "At least one scope is required"})
+	}
+	scopes := make([]string, 0, len(req.Scopes))
+	seen := make(map[string]bool, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		if !personalAccessTokenScopes[scope] {
+			return ctx.JSON(http.StatusBadRequest, map[string]string{"message": fmt.Sprintf("Invalid scope %q. Scope must be profile:read or profile:write", scope)})
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+
+	days := defaultPersonalAccessTokenDays
+	if req.ExpiresInDays != nil {
+		days = *req.ExpiresInDays
+	}
+	if days < 1 || days > 365 {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"message": "Invalid expires_in_days. Token must expire within 1 to 365 days"})
+	}
+
+	tokenString, err := generatePersonalAccessToken()
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	now := time.Now()
+	token := repository.PersonalAccessToken{
+		ID:        uuid.NewString(),
+		UserID:    ID,
+		Name:      name,
+		TokenHash: hashPersonalAccessToken(tokenString),
+		Prefix:    tokenString[:personalAccessTokenDisplayLength],
+		Scopes:    scopes,
+		ExpiresAt: now.Add(time.Duration(days) * 24 * time.Hour),
+		CreatedAt: now,
+	}
+	err = s.Repository.CreatePersonalAccessToken(ctx.Request().Context(), token)
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	created := toPersonalAccessToken(token)
+	return ctx.JSON(http.StatusCreated, generated.CreatedPersonalAccessToken{
+		Id:        created.Id,
+		Name:      created.Name,
+		Prefix:    created.Prefix,
+		Scopes:    created.Scopes,
+		ExpiresAt: created.ExpiresAt,
+		CreatedAt: created.CreatedAt,
+		Token:     tokenString,
+	})
+}
+
+// GetProfileTokens : this handler is for listing active personal access tokens of the user
+func (s *Server) GetProfileTokens(ctx echo.Context) error {
+	ID, err := s.authenticate(ctx, "")
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
+	}
+
+	tokens, err := s.Repository.ListPersonalAccessTokens(ctx.Request().Context(), ID)
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	resp := make([]generated.PersonalAccessToken, 0, len(tokens))
+	for _, token := range tokens {
+		resp = append(resp, toPersonalAccessToken(token))
+	}
+	return ctx.JSON(http.StatusOK, map[string][]generated.PersonalAccessToken{"tokens": resp})
+}
+
+// DeleteProfileTokensId : this handler is for revoking personal access token of the user
+func (s *Server) DeleteProfileTokensId(ctx echo.Context, id string) error {
+	ID, err := s.authenticate(ctx, "")
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusForbidden, map[string]string{"message": "Forbidden code"})
+	}
+
+	// Token ids are uuid, the column type would reject anything else with an error
+	if _, err := uuid.Parse(id); err != nil {
+		return ctx.JSON(http.StatusNotFound, map[string]string{"message": "Token not found"})
+	}
+
+	err = s.Repository.RevokePersonalAccessToken(ctx.Request().Context(), ID, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ctx.JSON(http.StatusNotFound, map[string]string{"message": "Token not found"})
+	}
+	if err != nil {
+		log.Error(err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"message": "Internal Server Error"})
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
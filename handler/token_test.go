@@ -0,0 +1,377 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeneratePersonalAccessToken(t *testing.T) {
+	token, err := generatePersonalAccessToken()
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, personalAccessTokenPrefix))
+	assert.Len(t, token, len(personalAccessTokenPrefix)+40)
+
+	other, err := generatePersonalAccessToken()
+	assert.NoError(t, err)
+	assert.NotEqual(t, token, other)
+	assert.Len(t, hashPersonalAccessToken(token), 64)
+	assert.NotEqual(t, hashPersonalAccessToken(token), hashPersonalAccessToken(other))
+}
+
+func TestHasScope(t *testing.T) {
+	assert.True(t, hasScope([]string{scopeProfileRead}, scopeProfileRead))
+	assert.True(t, hasScope([]string{scopeProfileWrite}, scopeProfileRead))
+	assert.True(t, hasScope([]string{scopeProfileWrite}, scopeProfileWrite))
+	assert.False(t, hasScope([]string{scopeProfileRead}, scopeProfileWrite))
+	assert.False(t, hasScope(nil, scopeProfileRead))
+}
+
+// expectActiveUser : lookup of authenticateToken checking the user is not deactivated, at most once so a later lookup of the same user by the handler is matched by its own expectation
+func expectActiveUser(repo *repository.MockRepositoryInterface, id string) {
+	repo.EXPECT().FindUser(gomock.Any(), repository.Param{Logic: "AND", Field: "id", Operator: "=", Value: id}).Return(repository.User{ID: id}, nil).MaxTimes(1)
+}
+
+func TestAuthenticate(t *testing.T) {
+	jwtToken, _ := createToken("123", time.Now().Add(time.Hour))
+	pat := personalAccessTokenPrefix + strings.Repeat("a", 40)
+	userParam := repository.Param{Logic: "AND", Field: "id", Operator: "=", Value: "123"}
+	deactivatedAt := time.Now()
+
+	tests := []struct {
+		name    string
+		prepare func(repo *repository.MockRepositoryInterface)
+		token   string
+		scope   string
+		id      string
+		wantErr bool
+	}{
+		{
+			name: "JWT",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindUser(gomock.Any(), userParam).Return(repository.User{ID: "123"}, nil)
+			},
+			token: jwtToken,
+			scope: scopeProfileWrite,
+			id:    "123",
+		}, {
+			name: "JWT of deactivated user",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindUser(gomock.Any(), userParam).Return(repository.User{ID: "123", DeactivatedAt: &deactivatedAt}, nil)
+			},
+			token:   jwtToken,
+			scope:   scopeProfileWrite,
+			wantErr: true,
+		}, {
+			name: "JWT of deleted user",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindUser(gomock.Any(), userParam).Return(repository.User{}, repository.ErrNotFound)
+			},
+			token:   jwtToken,
+			scope:   scopeProfileWrite,
+			wantErr: true,
+		}, {
+			name: "Personal access token of deactivated user",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindPersonalAccessToken(gomock.Any(), hashPersonalAccessToken(pat)).Return(repository.PersonalAccessToken{ID: "t1", UserID: "123", Scopes: []string{scopeProfileRead}}, nil)
+				repo.EXPECT().TouchPersonalAccessToken(gomock.Any(), "t1").Return(nil)
+				repo.EXPECT().FindUser(gomock.Any(), userParam).Return(repository.User{ID: "123", DeactivatedAt: &deactivatedAt}, nil)
+			},
+			token:   pat,
+			scope:   scopeProfileRead,
+			wantErr: true,
+		}, {
+			name: "Personal access token",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindPersonalAccessToken(gomock.Any(), hashPersonalAccessToken(pat)).Return(repository.PersonalAccessToken{ID: "t1", UserID: "123", Scopes: []string{scopeProfileRead}}, nil)
+				repo.EXPECT().TouchPersonalAccessToken(gomock.Any(), "t1").Return(nil)
+				repo.EXPECT().FindUser(gomock.Any(), userParam).Return(repository.User{ID: "123"}, nil)
+			},
+			token: pat,
+			scope: scopeProfileRead,
+			id:    "123",
+		}, {
+			name: "Touch error is ignored",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindPersonalAccessToken(gomock.Any(), hashPersonalAccessToken(pat)).Return(repository.PersonalAccessToken{ID: "t1", UserID: "123", Scopes: []string{scopeProfileWrite}}, nil)
+				repo.EXPECT().TouchPersonalAccessToken(gomock.Any(), "t1").Return(sql.ErrConnDone)
+				repo.EXPECT().FindUser(gomock.Any(), userParam).Return(repository.User{ID: "123"}, nil)
+			},
+			token: pat,
+			scope: scopeProfileRead,
+			id:    "123",
+		}, {
+			name: "Missing scope",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindPersonalAccessToken(gomock.Any(), hashPersonalAccessToken(pat)).Return(repository.PersonalAccessToken{ID: "t1", UserID: "123", Scopes: []string{scopeProfileRead}}, nil)
+			},
+			token:   pat,
+			scope:   scopeProfileWrite,
+			wantErr: true,
+		}, {
+			name: "Revoked or expired",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().FindPersonalAccessToken(gomock.Any(), hashPersonalAccessToken(pat)).Return(repository.PersonalAccessToken{}, repository.ErrNotFound)
+			},
+			token:   pat,
+			scope:   scopeProfileRead,
+			wantErr: true,
+		}, {
+			name:    "JWT only operation",
+			token:   pat,
+			scope:   "",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := repository.NewMockRepositoryInterface(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(repo)
+			}
+			s := NewServer(NewServerOptions{Repository: repo})
+
+			req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+
+			id, err := s.authenticate(c, tt.scope)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.id, id)
+		})
+	}
+}
+
+func TestPostProfileTokens(t *testing.T) {
+	token, _ := createToken("123", time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name    string
+		prepare func(repo *repository.MockRepositoryInterface)
+		token   string
+		args    string
+		status  int
+		content string
+	}{
+		{
+			name:    "Forbidden code",
+			token:   "asd",
+			args:    `{"name": "ci", "scopes": ["profile:read"]}`,
+			status:  http.StatusForbidden,
+			content: "{\"message\":\"Forbidden code\"}\n",
+		}, {
+			name:    "Personal access token cannot create token",
+			token:   personalAccessTokenPrefix + strings.Repeat("a", 40),
+			args:    `{"name": "ci", "scopes": ["profile:read"]}`,
+			status:  http.StatusForbidden,
+			content: "{\"message\":\"Forbidden code\"}\n",
+		}, {
+			name:    "Empty name",
+			token:   token,
+			args:    `{"name": " ", "scopes": ["profile:read"]}`,
+			status:  http.StatusBadRequest,
+			content: "{\"message\":\"Invalid name. Name must be between 1 and 100 characters\"}\n",
+		}, {
+			name:    "No scope",
+			token:   token,
+			args:    `{"name": "ci", "scopes": []}`,
+			status:  http.StatusBadRequest,
+			content: "{\"message\":\"At least one scope is required\"}\n",
+		}, {
+			name:    "Unknown scope",
+			token:   token,
+			args:    `{"name": "ci", "scopes": ["admin"]}`,
+			status:  http.StatusBadRequest,
+			content: "{\"message\":\"Invalid scope \\\"admin\\\". Scope must be profile:read or profile:write\"}\n",
+		}, {
+			name:    "Invalid expiry",
+			token:   token,
+			args:    `{"name": "ci", "scopes": ["profile:read"], "expires_in_days": 400}`,
+			status:  http.StatusBadRequest,
+			content: "{\"message\":\"Invalid expires_in_days. Token must expire within 1 to 365 days\"}\n",
+		}, {
+			name: "Internal Server Error",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().CreatePersonalAccessToken(gomock.Any(), gomock.Any()).Return(sql.ErrConnDone)
+			},
+			token:   token,
+			args:    `{"name": "ci", "scopes": ["profile:read"]}`,
+			status:  http.StatusInternalServerError,
+			content: "{\"message\":\"Internal Server Error\"}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := repository.NewMockRepositoryInterface(ctrl)
+			expectActiveUser(repo, "123")
+			if tt.prepare != nil {
+				tt.prepare(repo)
+			}
+			s := NewServer(NewServerOptions{Repository: repo})
+
+			req := httptest.NewRequest(http.MethodPost, "/profile/tokens", strings.NewReader(tt.args))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+
+			err := s.PostProfileTokens(c)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Equal(t, tt.content, rec.Body.String())
+		})
+	}
+}
+
+func TestPostProfileTokensCreated(t *testing.T) {
+	token, _ := createToken("123", time.Now().Add(time.Hour))
+
+	ctrl := gomock.NewController(t)
+	repo := repository.NewMockRepositoryInterface(ctrl)
+	expectActiveUser(repo, "123")
+	var stored repository.PersonalAccessToken
+	repo.EXPECT().CreatePersonalAccessToken(gomock.Any(), gomock.Any()).DoAndReturn(func(_ interface{}, pat repository.PersonalAccessToken) error {
+		stored = pat
+		return nil
+	})
+	s := NewServer(NewServerOptions{Repository: repo})
+
+	req := httptest.NewRequest(http.MethodPost, "/profile/tokens", strings.NewReader(`{"name": "ci", "scopes": ["profile:write", "profile:write"], "expires_in_days": 30}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+
+	err := s.PostProfileTokens(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	var resp map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	plain, _ := resp["token"].(string)
+	assert.True(t, strings.HasPrefix(plain, personalAccessTokenPrefix))
+	assert.Equal(t, stored.ID, resp["id"])
+	assert.Equal(t, stored.Prefix, resp["prefix"])
+	assert.True(t, strings.HasPrefix(plain, stored.Prefix))
+
+	// Only the hash is stored, never the token itself
+	assert.Equal(t, hashPersonalAccessToken(plain), stored.TokenHash)
+	assert.NotContains(t, rec.Body.String(), stored.TokenHash)
+	assert.Equal(t, "123", stored.UserID)
+	assert.Equal(t, []string{scopeProfileWrite}, stored.Scopes)
+	assert.WithinDuration(t, time.Now().Add(30*24*time.Hour), stored.ExpiresAt, time.Minute)
+}
+
+func TestGetProfileTokens(t *testing.T) {
+	token, _ := createToken("123", time.Now().Add(time.Hour))
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	ctrl := gomock.NewController(t)
+	repo := repository.NewMockRepositoryInterface(ctrl)
+	expectActiveUser(repo, "123")
+	repo.EXPECT().ListPersonalAccessTokens(gomock.Any(), "123").Return([]repository.PersonalAccessToken{{
+		ID:        "t1",
+		UserID:    "123",
+		Name:      "ci",
+		TokenHash: "secret-hash",
+		Prefix:    "sawit_pat_abcdef",
+		Scopes:    []string{scopeProfileRead},
+		ExpiresAt: created.Add(24 * time.Hour),
+		CreatedAt: created,
+	}}, nil)
+	s := NewServer(NewServerOptions{Repository: repo})
+
+	req := httptest.NewRequest(http.MethodGet, "/profile/tokens", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+
+	err := s.GetProfileTokens(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "{\"tokens\":[{\"created_at\":\"2024-01-02T03:04:05Z\",\"expires_at\":\"2024-01-03T03:04:05Z\",\"id\":\"t1\",\"name\":\"ci\",\"prefix\":\"sawit_pat_abcdef\",\"scopes\":[\"profile:read\"]}]}\n", rec.Body.String())
+}
+
+func TestDeleteProfileTokensId(t *testing.T) {
+	token, _ := createToken("123", time.Now().Add(time.Hour))
+	tokenID := "9b2f5c1e-4d7a-4e8b-9c3d-2a1b0c9d8e7f"
+
+	tests := []struct {
+		name    string
+		prepare func(repo *repository.MockRepositoryInterface)
+		token   string
+		id      string
+		status  int
+		content string
+	}{
+		{
+			name: "Revoked",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().RevokePersonalAccessToken(gomock.Any(), "123", tokenID).Return(nil)
+			},
+			token:  token,
+			id:     tokenID,
+			status: http.StatusNoContent,
+		}, {
+			name: "Not found",
+			prepare: func(repo *repository.MockRepositoryInterface) {
+				repo.EXPECT().RevokePersonalAccessToken(gomock.Any(), "123", tokenID).Return(repository.ErrNotFound)
+			},
+			token:   token,
+			id:      tokenID,
+			status:  http.StatusNotFound,
+			content: "{\"message\":\"Token not found\"}\n",
+		}, {
+			name:    "Malformed id",
+			token:   token,
+			id:      "t1",
+			status:  http.StatusNotFound,
+			content: "{\"message\":\"Token not found\"}\n",
+		}, {
+			name:    "Forbidden code",
+			token:   "asd",
+			id:      tokenID,
+			status:  http.StatusForbidden,
+			content: "{\"message\":\"Forbidden code\"}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := repository.NewMockRepositoryInterface(ctrl)
+			expectActiveUser(repo, "123")
+			if tt.prepare != nil {
+				tt.prepare(repo)
+			}
+			s := NewServer(NewServerOptions{Repository: repo})
+
+			req := httptest.NewRequest(http.MethodDelete, "/profile/tokens/"+tt.id, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+
+			err := s.DeleteProfileTokensId(c, tt.id)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Equal(t, tt.content, rec.Body.String())
+		})
+	}
+}
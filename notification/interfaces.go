@@ -0,0 +1,11 @@
+// This file contains the interfaces for the notification layer.
+// The notification layer is responsible for delivering messages to users.
+// For testing purpose we will generate mock implementations of these
+// interfaces using mockgen. See the Makefile for more information.
+package notification
+
+import "context"
+
+type Notifier interface {
+	Notify(ctx context.Context, message Message) (err error)
+}
@@ -0,0 +1,18 @@
+// This file contains the notifier that only write messages to the log, used when no delivery is configured.
+package notification
+
+import (
+	"context"
+	"log"
+)
+
+type LogNotifier struct{}
+
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{}
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, message Message) (err error) {
+	log.Printf("notification to %s: %s\n%s", message.To, message.Subject, message.Body)
+	return
+}
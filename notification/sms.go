@@ -0,0 +1,62 @@
+// This file contains the HTTP SMS gateway implementation of Notifier that deliver message body as text message.
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+type SMSGatewayNotifier struct {
+	URL    string
+	Token  string
+	Client *http.Client
+}
+
+type NewSMSGatewayNotifierOptions struct {
+	// URL is the endpoint of the gateway that accept {"to": "...", "message": "..."} JSON
+	URL string
+	// Token is optional, sent as bearer token when set
+	Token string
+}
+
+func NewSMSGatewayNotifier(opts NewSMSGatewayNotifierOptions) *SMSGatewayNotifier {
+	return &SMSGatewayNotifier{
+		URL:    opts.URL,
+		Token:  opts.Token,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Notify : send the message body to the phone number in message.To, subject is not delivered
+func (n *SMSGatewayNotifier) Notify(ctx context.Context, message Message) (err error) {
+	payload, err := json.Marshal(map[string]string{"to": message.To, "message": message.Body})
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(payload))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.Token)
+	}
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("sms gateway responded %d: %s", resp.StatusCode, body)
+	}
+	return
+}
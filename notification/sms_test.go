@@ -0,0 +1,42 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSMSGatewayNotifier(t *testing.T) {
+	var received map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer gateway-token", r.Header.Get("Authorization"))
+		body, _ := io.ReadAll(r.Body)
+		assert.NoError(t, json.Unmarshal(body, &received))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	notifier := NewSMSGatewayNotifier(NewSMSGatewayNotifierOptions{URL: server.URL, Token: "gateway-token"})
+	err := notifier.Notify(context.Background(), Message{To: "+62856712332", Subject: "ignored", Body: "Your login code is 123456"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"to": "+62856712332", "message": "Your login code is 123456"}, received)
+}
+
+func TestSMSGatewayNotifierError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "invalid destination")
+	}))
+	defer server.Close()
+
+	notifier := NewSMSGatewayNotifier(NewSMSGatewayNotifierOptions{URL: server.URL})
+	err := notifier.Notify(context.Background(), Message{To: "+62856712332", Body: "Your login code is 123456"})
+	assert.ErrorContains(t, err, "invalid destination")
+}
@@ -0,0 +1,80 @@
+// This file contains the SMTP implementation of Notifier that deliver messages as plain text email.
+package notification
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+type SMTPNotifier struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+type NewSMTPNotifierOptions struct {
+	// Addr is host:port of the SMTP server
+	Addr string
+	From string
+	// Username and Password are optional, PLAIN auth is only used when Username is set
+	Username string
+	Password string
+}
+
+func NewSMTPNotifier(opts NewSMTPNotifierOptions) *SMTPNotifier {
+	return &SMTPNotifier{
+		Addr:     opts.Addr,
+		From:     opts.From,
+		Username: opts.Username,
+		Password: opts.Password,
+	}
+}
+
+func (n *SMTPNotifier) Notify(ctx context.Context, message Message) (err error) {
+	if strings.ContainsAny(message.To, "\r\n") || strings.ContainsAny(message.Subject, "\r\n") {
+		return fmt.Errorf("invalid message header")
+	}
+
+	var auth smtp.Auth
+	if n.Username != "" {
+		host, _, err := net.SplitHostPort(n.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", n.Username, n.Password, host)
+	}
+
+	// smtp.SendMail does not accept context, run it in background and stop waiting when context is done
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(n.Addr, auth, n.From, []string{message.To}, buildMail(n.From, message))
+	}()
+
+	select {
+	case err = <-done:
+		return
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// buildMail : build RFC 5322 plain text mail
+func buildMail(from string, message Message) []byte {
+	var builder strings.Builder
+	builder.WriteString("From: " + from + "\r\n")
+	builder.WriteString("To: " + message.To + "\r\n")
+	builder.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", message.Subject) + "\r\n")
+	builder.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	builder.WriteString("MIME-Version: 1.0\r\n")
+	builder.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	builder.WriteString("\r\n")
+	builder.WriteString(strings.ReplaceAll(strings.ReplaceAll(message.Body, "\r\n", "\n"), "\n", "\r\n"))
+	builder.WriteString("\r\n")
+	return []byte(builder.String())
+}
@@ -0,0 +1,134 @@
+package notification
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSMTP : minimal in process SMTP server that record the envelope and data of received mails
+type fakeSMTP struct {
+	listener net.Listener
+	received chan fakeMail
+}
+
+type fakeMail struct {
+	from string
+	to   []string
+	data string
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	server := &fakeSMTP{listener: listener, received: make(chan fakeMail, 1)}
+	t.Cleanup(func() { listener.Close() })
+	go server.serve()
+	return server
+}
+
+func (s *fakeSMTP) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeSMTP) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	var mail fakeMail
+	reply("220 fake.smtp ESMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 fake.smtp")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			mail.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			mail.to = append(mail.to, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			mail.data = data.String()
+			s.received <- mail
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	server := newFakeSMTP(t)
+	notifier := NewSMTPNotifier(NewSMTPNotifierOptions{
+		Addr: server.listener.Addr().String(),
+		From: "no-reply@sawitpro.id",
+	})
+
+	err := notifier.Notify(context.Background(), Message{
+		To:      "user@example.com",
+		Subject: "Verify your email",
+		Body:    "Open this link\nhttp://localhost:8080/email/verify?token=abc",
+	})
+	assert.NoError(t, err)
+
+	mail := <-server.received
+	assert.Equal(t, "no-reply@sawitpro.id", mail.from)
+	assert.Equal(t, []string{"user@example.com"}, mail.to)
+	assert.Contains(t, mail.data, "To: user@example.com\r\n")
+	assert.Contains(t, mail.data, "Subject: Verify your email\r\n")
+	assert.Contains(t, mail.data, "\r\n\r\nOpen this link\r\nhttp://localhost:8080/email/verify?token=abc\r\n")
+}
+
+func TestSMTPNotifierHeaderInjection(t *testing.T) {
+	notifier := NewSMTPNotifier(NewSMTPNotifierOptions{Addr: "127.0.0.1:1", From: "no-reply@sawitpro.id"})
+
+	err := notifier.Notify(context.Background(), Message{
+		To:      "user@example.com\r\nBcc: victim@example.com",
+		Subject: "Verify your email",
+	})
+	assert.Error(t, err)
+}
+
+func TestSMTPNotifierConnectionError(t *testing.T) {
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := listener.Addr().String()
+	listener.Close()
+
+	notifier := NewSMTPNotifier(NewSMTPNotifierOptions{Addr: addr, From: "no-reply@sawitpro.id"})
+	err := notifier.Notify(context.Background(), Message{To: "user@example.com", Subject: "Verify your email"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,9 @@
+// This file contains types that are used in the notification layer.
+package notification
+
+type Message struct {
+	// To is the recipient address, email address or phone number depending on the notifier
+	To      string
+	Subject string
+	Body    string
+}
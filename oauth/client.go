@@ -0,0 +1,247 @@
+// Package oauth holds the scopes and client secrets of OAuth clients, shared by the API and the admin CLI.
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/google/uuid"
+)
+
+const (
+	// ScopeUsersRead allows looking up users by id or phone number
+	ScopeUsersRead = "users:read"
+	// ScopeUsersImport allows registering users in bulk from CSV
+	ScopeUsersImport = "users:import"
+	// ScopeUsersExport allows exporting users in bulk, without secrets
+	ScopeUsersExport = "users:export"
+	// ScopeTokensIntrospect allows asking whether a token is active
+	ScopeTokensIntrospect = "tokens:introspect"
+	// ScopeClientsAdmin allows managing OAuth clients
+	ScopeClientsAdmin = "clients:admin"
+	// ScopeSCIM allows provisioning users and groups of the client tenant with SCIM 2.0
+	ScopeSCIM = "scim"
+
+	// ScopeOpenID allows signing users in with OpenID Connect, required by the other user scopes
+	ScopeOpenID = "openid"
+	// ScopeProfile allows reading name, locale, birthdate and picture of the user
+	ScopeProfile = "profile"
+	// ScopeEmail allows reading email of the user
+	ScopeEmail = "email"
+	// ScopePhone allows reading phone number of the user
+	ScopePhone = "phone"
+
+	// clientSecretPrefix : recognizable start of every client secret, lets secret scanners find leaked secrets
+	clientSecretPrefix = "sawit_cs_"
+)
+
+// ServiceScopes are granted to the client itself with the client credentials grant
+var ServiceScopes = map[string]bool{
+	ScopeUsersRead:        true,
+	ScopeUsersImport:      true,
+	ScopeUsersExport:      true,
+	ScopeTokensIntrospect: true,
+	ScopeClientsAdmin:     true,
+	ScopeSCIM:             true,
+}
+
+// TenantServiceScopes are the service scopes a client of a tenant can have, the others reach the users of every tenant
+var TenantServiceScopes = map[string]bool{
+	ScopeSCIM: true,
+}
+
+// UserScopes are granted on behalf of a signed in user with the authorization code grant
+var UserScopes = map[string]bool{
+	ScopeOpenID:  true,
+	ScopeProfile: true,
+	ScopeEmail:   true,
+	ScopePhone:   true,
+}
+
+var (
+	// ErrInvalidScope is returned when a scope is unknown or not allowed for the client
+	ErrInvalidScope = errors.New("invalid scope")
+	// ErrInvalidName is returned when the client name is empty or too long
+	ErrInvalidName = errors.New("invalid client name")
+	// ErrInvalidRedirectURI is returned when a redirect uri is not an absolute https url, or missing for openid clients
+	ErrInvalidRedirectURI = errors.New("invalid redirect uri")
+	// ErrInvalidTenant is returned when the tenant is too long, missing for scim clients, or given with a scope of every tenant
+	ErrInvalidTenant = errors.New("invalid tenant")
+)
+
+type NewClientOptions struct {
+	Name   string
+	Scopes []string
+	// RedirectURIs are where users are sent back after signing in, required with the openid scope
+	RedirectURIs []string
+	// Tenant is the tenant the client provisions, required with the scim scope and not allowed with service scopes of every tenant
+	Tenant string
+}
+
+// NewClient : build client with generated id and secret, the secret is returned once and only its hash is kept
+func NewClient(opts NewClientOptions) (client repository.OAuthClient, secret string, err error) {
+	name := strings.TrimSpace(opts.Name)
+	if name == "" || len(name) > 100 {
+		return client, "", ErrInvalidName
+	}
+
+	scopes, err := ParseScopes(opts.Scopes)
+	if err != nil {
+		return client, "", err
+	}
+	if len(scopes) == 0 {
+		return client, "", fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+
+	redirectURIs := make([]string, 0, len(opts.RedirectURIs))
+	for _, redirectURI := range opts.RedirectURIs {
+		if err := ValidateRedirectURI(redirectURI); err != nil {
+			return client, "", err
+		}
+		redirectURIs = append(redirectURIs, redirectURI)
+	}
+	if len(redirectURIs) == 0 && hasUserScope(scopes) {
+		return client, "", fmt.Errorf("%w: openid clients need at least one redirect uri", ErrInvalidRedirectURI)
+	}
+
+	tenant := strings.TrimSpace(opts.Tenant)
+	if len(tenant) > 64 || (tenant == "" && hasScope(scopes, ScopeSCIM)) {
+		return client, "", ErrInvalidTenant
+	}
+	// A client of one tenant must not read, import or export the users of the others
+	for _, scope := range scopes {
+		if tenant != "" && ServiceScopes[scope] && !TenantServiceScopes[scope] {
+			return client, "", fmt.Errorf("%w: scope %s is of every tenant", ErrInvalidTenant, scope)
+		}
+	}
+
+	randomBytes := make([]byte, 32)
+	_, err = rand.Read(randomBytes)
+	if err != nil {
+		return client, "", err
+	}
+	secret = clientSecretPrefix + hex.EncodeToString(randomBytes)
+
+	client = repository.OAuthClient{
+		ID:           uuid.NewString(),
+		Name:         name,
+		SecretHash:   HashSecret(secret),
+		Scopes:       scopes,
+		RedirectURIs: redirectURIs,
+	}
+	if tenant != "" {
+		client.Tenant = &tenant
+	}
+	return client, secret, nil
+}
+
+// ValidateRedirectURI : redirect uri must be absolute https url without fragment, http is only allowed for loopback during development
+func ValidateRedirectURI(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() || u.Host == "" || u.Fragment != "" {
+		return fmt.Errorf("%w: %q", ErrInvalidRedirectURI, raw)
+	}
+	if u.Scheme == "https" {
+		return nil
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); u.Scheme == "http" && (host == "localhost" || (ip != nil && ip.IsLoopback())) {
+		return nil
+	}
+	return fmt.Errorf("%w: %q", ErrInvalidRedirectURI, raw)
+}
+
+// HasRedirectURI : check redirect uri is registered for the client, compared exactly
+func HasRedirectURI(client repository.OAuthClient, redirectURI string) bool {
+	for _, registered := range client.RedirectURIs {
+		if registered == redirectURI {
+			return true
+		}
+	}
+	return false
+}
+
+// HashSecret : SHA-256 of the client secret, secrets are random so a fast hash is enough
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifySecret : check the secret matches the stored hash in constant time
+func VerifySecret(client repository.OAuthClient, secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashSecret(secret)), []byte(client.SecretHash)) == 1
+}
+
+// ParseScopes : validate scopes and drop duplicates, keeping the order
+func ParseScopes(scopes []string) ([]string, error) {
+	parsed := make([]string, 0, len(scopes))
+	seen := make(map[string]bool, len(scopes))
+	for _, scope := range scopes {
+		if !ServiceScopes[scope] && !UserScopes[scope] {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			parsed = append(parsed, scope)
+		}
+	}
+	return parsed, nil
+}
+
+// GrantScopes : requested scopes that are of the grant and allowed for the client, every such scope of the client when none are requested
+func GrantScopes(client repository.OAuthClient, requested []string, grant map[string]bool) ([]string, error) {
+	allowed := make(map[string]bool, len(client.Scopes))
+	for _, scope := range client.Scopes {
+		allowed[scope] = grant[scope]
+	}
+
+	if len(requested) == 0 {
+		granted := []string{}
+		for _, scope := range client.Scopes {
+			if allowed[scope] {
+				granted = append(granted, scope)
+			}
+		}
+		return granted, nil
+	}
+
+	granted := make([]string, 0, len(requested))
+	seen := make(map[string]bool, len(requested))
+	for _, scope := range requested {
+		if !allowed[scope] {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			granted = append(granted, scope)
+		}
+	}
+	return granted, nil
+}
+
+// hasUserScope : check any of the scopes is granted on behalf of users
+func hasUserScope(scopes []string) bool {
+	for _, scope := range scopes {
+		if UserScopes[scope] {
+			return true
+		}
+	}
+	return false
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, candidate := range scopes {
+		if candidate == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package oauth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewClient(t *testing.T) {
+	client, secret, err := NewClient(NewClientOptions{Name: " billing ", Scopes: []string{ScopeUsersRead, ScopeUsersRead}})
+	assert.NoError(t, err)
+	assert.Equal(t, "billing", client.Name)
+	assert.Equal(t, []string{ScopeUsersRead}, client.Scopes)
+	assert.NotEmpty(t, client.ID)
+	assert.True(t, strings.HasPrefix(secret, clientSecretPrefix))
+	assert.NotContains(t, client.SecretHash, secret)
+	assert.True(t, VerifySecret(client, secret))
+	assert.False(t, VerifySecret(client, secret+"x"))
+
+	_, _, err = NewClient(NewClientOptions{Scopes: []string{ScopeUsersRead}})
+	assert.True(t, errors.Is(err, ErrInvalidName))
+
+	_, _, err = NewClient(NewClientOptions{Name: "billing", Scopes: []string{"admin"}})
+	assert.True(t, errors.Is(err, ErrInvalidScope))
+
+	_, _, err = NewClient(NewClientOptions{Name: "billing"})
+	assert.True(t, errors.Is(err, ErrInvalidScope))
+}
+
+func TestNewClientRedirectURIs(t *testing.T) {
+	client, _, err := NewClient(NewClientOptions{Name: "dashboard", Scopes: []string{ScopeOpenID, ScopeEmail}, RedirectURIs: []string{"https://dashboard.example.com/callback"}})
+	assert.NoError(t, err)
+	assert.True(t, HasRedirectURI(client, "https://dashboard.example.com/callback"))
+	assert.False(t, HasRedirectURI(client, "https://dashboard.example.com/callback/"))
+
+	_, _, err = NewClient(NewClientOptions{Name: "dashboard", Scopes: []string{ScopeOpenID}})
+	assert.True(t, errors.Is(err, ErrInvalidRedirectURI))
+}
+
+func TestNewClientTenant(t *testing.T) {
+	client, _, err := NewClient(NewClientOptions{Name: "okta", Scopes: []string{ScopeSCIM}, Tenant: " plantation "})
+	assert.NoError(t, err)
+	assert.Equal(t, "plantation", *client.Tenant)
+
+	client, _, err = NewClient(NewClientOptions{Name: "billing", Scopes: []string{ScopeUsersRead}})
+	assert.NoError(t, err)
+	assert.Nil(t, client.Tenant)
+
+	_, _, err = NewClient(NewClientOptions{Name: "okta", Scopes: []string{ScopeSCIM}})
+	assert.True(t, errors.Is(err, ErrInvalidTenant))
+
+	_, _, err = NewClient(NewClientOptions{Name: "okta", Scopes: []string{ScopeSCIM}, Tenant: strings.Repeat("a", 65)})
+	assert.True(t, errors.Is(err, ErrInvalidTenant))
+
+	// Scopes of every tenant cannot be given to a client of one tenant
+	for _, scope := range []string{ScopeUsersRead, ScopeUsersImport, ScopeUsersExport, ScopeTokensIntrospect, ScopeClientsAdmin} {
+		_, _, err = NewClient(NewClientOptions{Name: "okta", Scopes: []string{ScopeSCIM, scope}, Tenant: "plantation"})
+		assert.True(t, errors.Is(err, ErrInvalidTenant), scope)
+	}
+}
+
+func TestValidateRedirectURI(t *testing.T) {
+	assert.NoError(t, ValidateRedirectURI("https://dashboard.example.com/callback?tenant=a"))
+	assert.NoError(t, ValidateRedirectURI("http://localhost:3000/callback"))
+	assert.NoError(t, ValidateRedirectURI("http://127.0.0.1:3000/callback"))
+	assert.Error(t, ValidateRedirectURI("http://dashboard.example.com/callback"))
+	assert.Error(t, ValidateRedirectURI("https://dashboard.example.com/callback#token"))
+	assert.Error(t, ValidateRedirectURI("/callback"))
+	assert.Error(t, ValidateRedirectURI("javascript:alert(1)"))
+}
+
+func TestGrantScopes(t *testing.T) {
+	client := repository.OAuthClient{Scopes: []string{ScopeUsersRead, ScopeOpenID, ScopeEmail}}
+
+	granted, err := GrantScopes(client, nil, ServiceScopes)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{ScopeUsersRead}, granted)
+
+	granted, err = GrantScopes(client, []string{ScopeUsersRead}, ServiceScopes)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{ScopeUsersRead}, granted)
+
+	_, err = GrantScopes(client, []string{ScopeClientsAdmin}, ServiceScopes)
+	assert.True(t, errors.Is(err, ErrInvalidScope))
+
+	// User scopes cannot be granted to the client itself
+	_, err = GrantScopes(client, []string{ScopeEmail}, ServiceScopes)
+	assert.True(t, errors.Is(err, ErrInvalidScope))
+
+	granted, err = GrantScopes(client, []string{ScopeOpenID, ScopeEmail}, UserScopes)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{ScopeOpenID, ScopeEmail}, granted)
+
+	_, err = GrantScopes(client, []string{ScopeOpenID, ScopePhone}, UserScopes)
+	assert.True(t, errors.Is(err, ErrInvalidScope))
+}
@@ -0,0 +1,22 @@
+// This file contains the numbering plan metadata of supported countries.
+package phone
+
+type Country struct {
+	// Code is the ISO 3166-1 alpha-2 country code
+	Code string
+	// CallingCode is the international dialing prefix without +
+	CallingCode string
+	// MinLength and MaxLength bound the digits of the national significant number, without trunk prefix
+	MinLength int
+	MaxLength int
+}
+
+// countries : supported countries, every country use 0 as trunk prefix for local format
+var countries = map[string]Country{
+	"ID": {Code: "ID", CallingCode: "62", MinLength: 9, MaxLength: 12},
+	"MY": {Code: "MY", CallingCode: "60", MinLength: 8, MaxLength: 10},
+	"TH": {Code: "TH", CallingCode: "66", MinLength: 8, MaxLength: 9},
+}
+
+// trunkPrefix : prefix dialed before national significant number in local format, e.g. 0812...
+const trunkPrefix = "0"
@@ -0,0 +1,121 @@
+// Package phone parses phone numbers in international or local format and normalizes them to E.164.
+package phone
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrInvalid is returned when the phone number cannot be parsed or has wrong length
+	ErrInvalid = errors.New("invalid phone number")
+	// ErrCountryNotAllowed is returned when the phone number belong to a country that is not allowed
+	ErrCountryNotAllowed = errors.New("phone number country is not allowed")
+)
+
+// separators : characters people use to group digits, ignored when parsing
+var separators = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "")
+
+type Normalizer struct {
+	allowed        []Country
+	defaultCountry Country
+}
+
+type NewNormalizerOptions struct {
+	// AllowedCountries are ISO 3166-1 alpha-2 codes of the countries accepted, default to the default country only
+	AllowedCountries []string
+	// DefaultCountry is the country of numbers written in local format, default to ID
+	DefaultCountry string
+}
+
+func NewNormalizer(opts NewNormalizerOptions) (*Normalizer, error) {
+	if opts.DefaultCountry == "" {
+		opts.DefaultCountry = "ID"
+	}
+	if len(opts.AllowedCountries) == 0 {
+		opts.AllowedCountries = []string{opts.DefaultCountry}
+	}
+
+	normalizer := &Normalizer{}
+	defaultAllowed := false
+	for _, code := range opts.AllowedCountries {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		country, exist := countries[code]
+		if !exist {
+			return nil, fmt.Errorf("unsupported phone country %q", code)
+		}
+		normalizer.allowed = append(normalizer.allowed, country)
+		if code == strings.ToUpper(opts.DefaultCountry) {
+			normalizer.defaultCountry = country
+			defaultAllowed = true
+		}
+	}
+	if !defaultAllowed {
+		return nil, fmt.Errorf("default phone country %q is not allowed", opts.DefaultCountry)
+	}
+	return normalizer, nil
+}
+
+// DefaultNormalizer : normalizer that only accept Indonesian numbers
+func DefaultNormalizer() *Normalizer {
+	country := countries["ID"]
+	return &Normalizer{allowed: []Country{country}, defaultCountry: country}
+}
+
+// Normalize : parse phone number in international (+62812..., 0062812...) or local (0812...) format and return it in E.164
+func (n *Normalizer) Normalize(raw string) (string, error) {
+	number := separators.Replace(strings.TrimSpace(raw))
+
+	var country Country
+	var national string
+	switch {
+	case strings.HasPrefix(number, "+"):
+		var err error
+		country, national, err = n.splitCallingCode(number[1:])
+		if err != nil {
+			return "", err
+		}
+	case strings.HasPrefix(number, "00"):
+		var err error
+		country, national, err = n.splitCallingCode(number[2:])
+		if err != nil {
+			return "", err
+		}
+	case strings.HasPrefix(number, trunkPrefix):
+		country, national = n.defaultCountry, number
+	default:
+		return "", ErrInvalid
+	}
+
+	// Trunk prefix is often kept after the calling code, e.g. +62 0812...
+	national = strings.TrimPrefix(national, trunkPrefix)
+	if len(national) < country.MinLength || len(national) > country.MaxLength || !isDigits(national) || national[0] == '0' {
+		return "", ErrInvalid
+	}
+	return "+" + country.CallingCode + national, nil
+}
+
+// splitCallingCode : split international number without + into its allowed country and national number
+func (n *Normalizer) splitCallingCode(number string) (Country, string, error) {
+	for _, country := range n.allowed {
+		if strings.HasPrefix(number, country.CallingCode) {
+			return country, number[len(country.CallingCode):], nil
+		}
+	}
+	for _, country := range countries {
+		if strings.HasPrefix(number, country.CallingCode) {
+			return Country{}, "", ErrCountryNotAllowed
+		}
+	}
+	return Country{}, "", ErrInvalid
+}
+
+func isDigits(value string) bool {
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return value != ""
+}
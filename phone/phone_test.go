@@ -0,0 +1,73 @@
+package phone
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	normalizer, err := NewNormalizer(NewNormalizerOptions{AllowedCountries: []string{"ID", "MY", "TH"}, DefaultCountry: "ID"})
+	assert.NoError(t, err)
+
+	valid := map[string]string{
+		"+62812345678901":   "+62812345678901",
+		"0812345678901":     "+62812345678901",
+		"0812-3456-7890":    "+6281234567890",
+		"+62 0812 3456 789": "+628123456789",
+		"0062812345678":     "+62812345678",
+		"+60 12-345 6789":   "+60123456789",
+		"+60312345678":      "+60312345678",
+		"+66 81 234 5678":   "+66812345678",
+		"(+66) 2 123 4567":  "+6621234567",
+	}
+	for raw, want := range valid {
+		got, err := normalizer.Normalize(raw)
+		assert.NoError(t, err, raw)
+		assert.Equal(t, want, got, raw)
+	}
+
+	invalid := []string{"", "812345678", "+62", "+6201239", "012345678", "+621234567890525412", "+62812abc5678", "+1 202 555 0100", "+66 81 234 56789"}
+	for _, raw := range invalid {
+		_, err := normalizer.Normalize(raw)
+		assert.ErrorIs(t, err, ErrInvalid, raw)
+	}
+}
+
+func TestNormalizeCountryNotAllowed(t *testing.T) {
+	normalizer := DefaultNormalizer()
+
+	_, err := normalizer.Normalize("+60123456789")
+	assert.ErrorIs(t, err, ErrCountryNotAllowed)
+
+	// Local format always belong to the default country
+	got, err := normalizer.Normalize("0123456789")
+	assert.NoError(t, err)
+	assert.Equal(t, "+62123456789", got)
+}
+
+func TestDefaultNormalizer(t *testing.T) {
+	normalizer := DefaultNormalizer()
+
+	// Numbers accepted before international support stay valid and unchanged
+	for _, number := range []string{"+62123456789", "+621234567890", "+6212345678901", "+629876543210"} {
+		got, err := normalizer.Normalize(number)
+		assert.NoError(t, err, number)
+		assert.Equal(t, number, got)
+	}
+}
+
+func TestNewNormalizer(t *testing.T) {
+	// Local format of Thai numbers when Thailand is the default country
+	normalizer, err := NewNormalizer(NewNormalizerOptions{AllowedCountries: []string{"id", " th "}, DefaultCountry: "TH"})
+	assert.NoError(t, err)
+	got, err := normalizer.Normalize("081 234 5678")
+	assert.NoError(t, err)
+	assert.Equal(t, "+66812345678", got)
+
+	_, err = NewNormalizer(NewNormalizerOptions{AllowedCountries: []string{"US"}})
+	assert.Error(t, err)
+
+	_, err = NewNormalizer(NewNormalizerOptions{AllowedCountries: []string{"MY"}, DefaultCountry: "ID"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,13 @@
+// This file contains the interfaces for the rate limit layer.
+// The rate limit layer is responsible for keeping token buckets of rate limited clients.
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+type Store interface {
+	// Take : refill the bucket of the key up to now then take one token from it when available
+	Take(ctx context.Context, key string, rule Rule, now time.Time) (result Result, err error)
+}
@@ -0,0 +1,53 @@
+// This file contains the in memory implementation of Store, buckets are not shared between instances.
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval : how often idle buckets are removed from memory
+const sweepInterval = time.Minute
+
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+type memoryBucket struct {
+	bucket
+	period time.Duration
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*memoryBucket{}}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, rule Rule, now time.Time) (result Result, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	b, exist := s.buckets[key]
+	if !exist {
+		b = &memoryBucket{bucket: newBucket(rule, now), period: rule.Period}
+		s.buckets[key] = b
+	}
+	return b.take(rule, now), nil
+}
+
+// sweep : remove buckets idle for a whole period, they are full again and equal to a new bucket
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if now.Sub(b.UpdatedAt) >= b.period {
+			delete(s.buckets, key)
+		}
+	}
+}
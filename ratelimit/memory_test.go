@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	rule := Rule{Limit: 3, Period: time.Minute}
+	now := time.Date(2023, 10, 20, 10, 0, 0, 0, time.UTC)
+
+	// Full bucket allow a burst of Limit requests
+	for remaining := 2; remaining >= 0; remaining-- {
+		result, err := store.Take(ctx, "login:ip:10.0.0.1", rule, now)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, remaining, result.Remaining)
+		assert.Equal(t, 3, result.Limit)
+	}
+
+	// Empty bucket deny until one token is refilled, one token every 20 seconds
+	result, err := store.Take(ctx, "login:ip:10.0.0.1", rule, now.Add(5*time.Second))
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, 15*time.Second, result.RetryAfter.Round(time.Millisecond))
+	assert.Equal(t, 55*time.Second, result.Reset.Round(time.Millisecond))
+
+	result, _ = store.Take(ctx, "login:ip:10.0.0.1", rule, now.Add(20*time.Second))
+	assert.True(t, result.Allowed)
+
+	// Other keys have their own bucket
+	result, _ = store.Take(ctx, "login:ip:10.0.0.2", rule, now.Add(20*time.Second))
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 2, result.Remaining)
+}
+
+func TestMemoryStoreRefillCapped(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	rule := Rule{Limit: 2, Period: time.Minute}
+	now := time.Date(2023, 10, 20, 10, 0, 0, 0, time.UTC)
+
+	store.Take(ctx, "key", rule, now)
+
+	// Idle for a long time does not grow the bucket beyond its capacity
+	result, _ := store.Take(ctx, "key", rule, now.Add(time.Hour))
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 1, result.Remaining)
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	rule := Rule{Limit: 2, Period: time.Minute}
+	now := time.Date(2023, 10, 20, 10, 0, 0, 0, time.UTC)
+
+	store.Take(ctx, "idle", rule, now)
+	store.Take(ctx, "active", rule, now.Add(2*time.Minute))
+	assert.Len(t, store.buckets, 1)
+	assert.Contains(t, store.buckets, "active")
+}
@@ -0,0 +1,56 @@
+// This file contains the Postgres implementation of Store, buckets are shared by every instance using the same database.
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type PostgresStore struct {
+	Db *sql.DB
+}
+
+type NewPostgresStoreOptions struct {
+	Db *sql.DB
+}
+
+func NewPostgresStore(opts NewPostgresStoreOptions) *PostgresStore {
+	return &PostgresStore{Db: opts.Db}
+}
+
+// Take : the bucket row is locked for the refill and take so concurrent requests of the same key are serialized
+func (s *PostgresStore) Take(ctx context.Context, key string, rule Rule, now time.Time) (result Result, err error) {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	initial := newBucket(rule, now)
+	_, err = tx.ExecContext(ctx, "INSERT INTO public.rate_limit_bucket (key, tokens, updated_at) VALUES ($1, $2, $3) ON CONFLICT (key) DO NOTHING", key, initial.Tokens, initial.UpdatedAt)
+	if err != nil {
+		return
+	}
+
+	var b bucket
+	err = tx.QueryRowContext(ctx, "SELECT tokens, updated_at FROM public.rate_limit_bucket WHERE key = $1 FOR UPDATE", key).Scan(&b.Tokens, &b.UpdatedAt)
+	if err != nil {
+		return
+	}
+
+	result = b.take(rule, now)
+	_, err = tx.ExecContext(ctx, "UPDATE public.rate_limit_bucket SET tokens=$1, updated_at=$2 WHERE key=$3", b.Tokens, b.UpdatedAt, key)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// DeleteIdle : remove buckets not used since the given time, they are full again
+func (s *PostgresStore) DeleteIdle(ctx context.Context, before time.Time) (err error) {
+	_, err = s.Db.ExecContext(ctx, "DELETE FROM public.rate_limit_bucket WHERE updated_at < $1", before)
+	return
+}
@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestPostgresStore : store of the Postgres database of TEST_DATABASE_URL, its buckets are deleted before the test
+func newTestPostgresStore(t *testing.T) *PostgresStore {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec("TRUNCATE public.rate_limit_bucket")
+	require.NoError(t, err)
+	return NewPostgresStore(NewPostgresStoreOptions{Db: db})
+}
+
+func TestPostgresStore(t *testing.T) {
+	ctx := context.Background()
+	store := newTestPostgresStore(t)
+	rule := Rule{Limit: 3, Period: time.Minute}
+	now := time.Date(2023, 10, 20, 10, 0, 0, 0, time.UTC)
+
+	// Full bucket allow a burst of Limit requests
+	for remaining := 2; remaining >= 0; remaining-- {
+		result, err := store.Take(ctx, "login:ip:10.0.0.1", rule, now)
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, remaining, result.Remaining)
+		assert.Equal(t, 3, result.Limit)
+	}
+
+	// Empty bucket deny until one token is refilled, one token every 20 seconds
+	result, err := store.Take(ctx, "login:ip:10.0.0.1", rule, now.Add(5*time.Second))
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, 15*time.Second, result.RetryAfter.Round(time.Millisecond))
+
+	result, err = store.Take(ctx, "login:ip:10.0.0.1", rule, now.Add(20*time.Second))
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	// Other keys have their own bucket
+	result, err = store.Take(ctx, "login:ip:10.0.0.2", rule, now.Add(20*time.Second))
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 2, result.Remaining)
+}
+
+func TestPostgresStoreConcurrentTake(t *testing.T) {
+	ctx := context.Background()
+	store := newTestPostgresStore(t)
+	rule := Rule{Limit: 5, Period: time.Minute}
+	now := time.Date(2023, 10, 20, 10, 0, 0, 0, time.UTC)
+
+	// Requests of every instance take from the same row, only Limit of them are allowed
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := store.Take(ctx, "login:phone:+628111111111", rule, now)
+			if !assert.NoError(t, err) {
+				return
+			}
+			if result.Allowed {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 5, allowed)
+}
+
+func TestPostgresStoreDeleteIdle(t *testing.T) {
+	ctx := context.Background()
+	store := newTestPostgresStore(t)
+	rule := Rule{Limit: 2, Period: time.Minute}
+	now := time.Date(2023, 10, 20, 10, 0, 0, 0, time.UTC)
+
+	_, err := store.Take(ctx, "idle", rule, now.Add(-2*time.Hour))
+	require.NoError(t, err)
+	_, err = store.Take(ctx, "active", rule, now)
+	require.NoError(t, err)
+
+	require.NoError(t, store.DeleteIdle(ctx, now.Add(-time.Hour)))
+
+	var keys []string
+	rows, err := store.Db.QueryContext(ctx, "SELECT key FROM public.rate_limit_bucket ORDER BY key")
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		require.NoError(t, rows.Scan(&key))
+		keys = append(keys, key)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []string{"active"}, keys)
+
+	// Deleted bucket is full again
+	result, err := store.Take(ctx, "idle", rule, now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Remaining)
+}
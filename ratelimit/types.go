@@ -0,0 +1,59 @@
+// This file contains types that are used in the rate limit layer.
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+type Rule struct {
+	// Limit is the bucket capacity, the number of requests allowed in a burst
+	Limit int
+	// Period is the time to refill an empty bucket completely
+	Period time.Duration
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is the time until the next token is available, zero when a token is left
+	RetryAfter time.Duration
+	// Reset is the time until the bucket is full again
+	Reset time.Duration
+}
+
+// bucket : token bucket state, tokens are refilled continuously at Limit per Period
+type bucket struct {
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+// newBucket : bucket of a key that has not been seen yet is full
+func newBucket(rule Rule, now time.Time) bucket {
+	return bucket{Tokens: float64(rule.Limit), UpdatedAt: now}
+}
+
+// take : refill the bucket up to now and take one token when available
+func (b *bucket) take(rule Rule, now time.Time) Result {
+	rate := float64(rule.Limit) / rule.Period.Seconds()
+	if elapsed := now.Sub(b.UpdatedAt).Seconds(); elapsed > 0 {
+		b.Tokens = math.Min(float64(rule.Limit), b.Tokens+elapsed*rate)
+		b.UpdatedAt = now
+	}
+
+	result := Result{Limit: rule.Limit}
+	if b.Tokens >= 1 {
+		b.Tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.Tokens) / rate)
+	}
+	result.Remaining = int(b.Tokens)
+	result.Reset = seconds((float64(rule.Limit) - b.Tokens) / rate)
+	return result
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second))
+}
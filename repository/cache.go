@@ -0,0 +1,209 @@
+// This file contains the read-through cache of user lookups by id, it decorates another repository so every
+// authenticated request does not read the user from the database. Other methods go to the decorated repository.
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/cache"
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultUserCacheTTL : how long a cached user is used when no ttl is given, it bounds how stale a user changed by another instance can be
+const DefaultUserCacheTTL = time.Minute
+
+// userCacheKeyPrefix : cached users are stored under user:id:<id>
+const userCacheKeyPrefix = "user:id:"
+
+// userCacheLoadTimeout : bound of a load shared by concurrent misses, it does not end with the context of the caller that started it
+const userCacheLoadTimeout = 5 * time.Second
+
+type CachedRepository struct {
+	RepositoryInterface
+	Store cache.Store
+	TTL   time.Duration
+
+	loads singleflight.Group
+	// invalidations is increased by every write, a user loaded while one happened may be stale and is not stored
+	invalidations uint64
+	hits          uint64
+	misses        uint64
+	failures      uint64
+}
+
+type NewCachedRepositoryOptions struct {
+	Repository RepositoryInterface
+	Store      cache.Store
+	// TTL default to DefaultUserCacheTTL
+	TTL time.Duration
+}
+
+// CacheStats : lookups answered by the cache, lookups read from the repository and store failures since the start
+type CacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	Errors uint64 `json:"errors"`
+}
+
+func NewCachedRepository(opts NewCachedRepositoryOptions) *CachedRepository {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultUserCacheTTL
+	}
+	return &CachedRepository{
+		RepositoryInterface: opts.Repository,
+		Store:               opts.Store,
+		TTL:                 opts.TTL,
+	}
+}
+
+// Stats : counters of the cache, they are not reset
+func (c *CachedRepository) Stats() CacheStats {
+	return CacheStats{
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+		Errors: atomic.LoadUint64(&c.failures),
+	}
+}
+
+// FindUser : lookups of a single id are cached, concurrent misses of the same id read the repository once.
+// Users found by id have no Password and Salt, passwords are checked on users found by phone or email which are not cached.
+// A failing store is counted and skipped, the user is read from the repository then.
+func (c *CachedRepository) FindUser(ctx context.Context, params ...Param) (user User, err error) {
+	id, ok := cachedUserID(params)
+	if !ok {
+		return c.RepositoryInterface.FindUser(ctx, params...)
+	}
+	key := userCacheKeyPrefix + id
+
+	encoded, found, err := c.Store.Get(ctx, key)
+	if err != nil {
+		c.storeFailed("get", err)
+	}
+	if found {
+		if err = json.Unmarshal(encoded, &user); err == nil {
+			atomic.AddUint64(&c.hits, 1)
+			return user, nil
+		}
+		c.storeFailed("decode", err)
+	}
+	atomic.AddUint64(&c.misses, 1)
+
+	// Every caller decodes its own copy, a shared user would share its attributes and pointers
+	loads := c.loads.DoChan(key, func() (interface{}, error) {
+		// Callers waiting on the key must not fail because the one that started the load was cancelled
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), userCacheLoadTimeout)
+		defer cancel()
+
+		invalidations := atomic.LoadUint64(&c.invalidations)
+		user, err := c.RepositoryInterface.FindUser(ctx, params...)
+		if err != nil {
+			return nil, err
+		}
+		// Credentials are never cached, so a shared store such as Redis does not hold password hashes
+		user.Password, user.Salt = "", ""
+		encoded, err := json.Marshal(user)
+		if err != nil {
+			return nil, err
+		}
+		if atomic.LoadUint64(&c.invalidations) == invalidations {
+			if err := c.Store.Set(ctx, key, encoded, c.TTL); err != nil {
+				c.storeFailed("set", err)
+			}
+		}
+		return encoded, nil
+	})
+	var loaded singleflight.Result
+	select {
+	case loaded = <-loads:
+	case <-ctx.Done():
+		return User{}, ctx.Err()
+	}
+	if loaded.Err != nil {
+		return User{}, loaded.Err
+	}
+	err = json.Unmarshal(loaded.Val.([]byte), &user)
+	return
+}
+
+// cachedUserID : id of a lookup by id only, other lookups are not cached
+func cachedUserID(params []Param) (string, bool) {
+	if len(params) != 1 || params[0].Field != "id" || params[0].Operator != "=" {
+		return "", false
+	}
+	id, ok := params[0].Value.(string)
+	return id, ok
+}
+
+// invalidate : remove the users from the cache after they were written, also when the write failed since
+// a version conflict means the cached user is stale. Users added later, e.g. by Registration, are not cached as missing.
+func (c *CachedRepository) invalidate(ctx context.Context, ids ...string) {
+	atomic.AddUint64(&c.invalidations, 1)
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, userCacheKeyPrefix+id)
+	}
+	if err := c.Store.Delete(ctx, keys...); err != nil {
+		c.storeFailed("delete", err)
+	}
+}
+
+func (c *CachedRepository) storeFailed(operation string, err error) {
+	atomic.AddUint64(&c.failures, 1)
+	log.Printf("user cache %s: %v", operation, err)
+}
+
+func (c *CachedRepository) DeleteUser(ctx context.Context, id string) (err error) {
+	err = c.RepositoryInterface.DeleteUser(ctx, id)
+	c.invalidate(ctx, id)
+	return
+}
+
+// IncreaseLoginAttempt : the user is found by phone to invalidate it, the attempt changes its updated_at
+func (c *CachedRepository) IncreaseLoginAttempt(ctx context.Context, phone string) (err error) {
+	err = c.RepositoryInterface.IncreaseLoginAttempt(ctx, phone)
+	user, findErr := c.RepositoryInterface.FindUser(ctx, Param{Logic: "AND", Field: "phone", Operator: "=", Value: phone})
+	if findErr == nil {
+		c.invalidate(ctx, user.ID)
+	}
+	return
+}
+
+func (c *CachedRepository) UpdateUser(ctx context.Context, user UpdateUser) (err error) {
+	err = c.RepositoryInterface.UpdateUser(ctx, user)
+	c.invalidate(ctx, user.ID)
+	return
+}
+
+func (c *CachedRepository) PatchUser(ctx context.Context, input PatchUser) (err error) {
+	err = c.RepositoryInterface.PatchUser(ctx, input)
+	c.invalidate(ctx, input.ID)
+	return
+}
+
+func (c *CachedRepository) SyncUser(ctx context.Context, input SyncUser) (err error) {
+	err = c.RepositoryInterface.SyncUser(ctx, input)
+	c.invalidate(ctx, input.ID)
+	return
+}
+
+func (c *CachedRepository) UpdateAvatarKey(ctx context.Context, id string, avatarKey string) (err error) {
+	err = c.RepositoryInterface.UpdateAvatarKey(ctx, id, avatarKey)
+	c.invalidate(ctx, id)
+	return
+}
+
+func (c *CachedRepository) VerifyEmail(ctx context.Context, id string, email string) (err error) {
+	err = c.RepositoryInterface.VerifyEmail(ctx, id, email)
+	c.invalidate(ctx, id)
+	return
+}
+
+func (c *CachedRepository) UpdateOTPLogin(ctx context.Context, id string, enabled bool) (err error) {
+	err = c.RepositoryInterface.UpdateOTPLogin(ctx, id, enabled)
+	c.invalidate(ctx, id)
+	return
+}
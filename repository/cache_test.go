@@ -0,0 +1,327 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/cache"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachedRepositoryContract(t *testing.T) {
+	runContract(t, func(t *testing.T) RepositoryInterface {
+		return NewCachedRepository(NewCachedRepositoryOptions{
+			Repository: NewMemoryRepository(),
+			Store:      cache.NewMemoryStore(cache.NewMemoryStoreOptions{}),
+		})
+	})
+}
+
+func TestCachedRepositoryFindUser(t *testing.T) {
+	ctx := context.Background()
+	byID := Param{Logic: "AND", Field: "id", Operator: "=", Value: "user-1"}
+	byPhone := Param{Logic: "AND", Field: "phone", Operator: "=", Value: "+62856712332"}
+	stored := User{ID: "user-1", Phone: "+62856712332", Name: "User", Version: 1, Attributes: map[string]interface{}{"division": "north"}}
+
+	tests := []struct {
+		name      string
+		mock      func(repo *MockRepositoryInterface)
+		run       func(t *testing.T, cached *CachedRepository)
+		wantStats CacheStats
+	}{
+		{
+			name: "Second lookup by id is a hit",
+			mock: func(repo *MockRepositoryInterface) {
+				repo.EXPECT().FindUser(gomock.Any(), byID).Return(stored, nil).Times(1)
+			},
+			run: func(t *testing.T, cached *CachedRepository) {
+				for i := 0; i < 2; i++ {
+					user, err := cached.FindUser(ctx, byID)
+					require.NoError(t, err)
+					assert.Equal(t, stored, user)
+				}
+			},
+			wantStats: CacheStats{Hits: 1, Misses: 1},
+		},
+		{
+			name: "Credentials are not cached",
+			mock: func(repo *MockRepositoryInterface) {
+				withPassword := stored
+				withPassword.Password, withPassword.Salt = "hash", "salt"
+				repo.EXPECT().FindUser(gomock.Any(), byID).Return(withPassword, nil).Times(1)
+			},
+			run: func(t *testing.T, cached *CachedRepository) {
+				for i := 0; i < 2; i++ {
+					user, err := cached.FindUser(ctx, byID)
+					require.NoError(t, err)
+					assert.Equal(t, stored, user)
+				}
+				encoded, found, err := cached.Store.Get(ctx, "user:id:user-1")
+				require.NoError(t, err)
+				require.True(t, found)
+				assert.NotContains(t, string(encoded), "hash")
+				assert.NotContains(t, string(encoded), "salt")
+			},
+			wantStats: CacheStats{Hits: 1, Misses: 1},
+		},
+		{
+			name: "Cached user is a copy",
+			mock: func(repo *MockRepositoryInterface) {
+				repo.EXPECT().FindUser(gomock.Any(), byID).Return(stored, nil).Times(1)
+			},
+			run: func(t *testing.T, cached *CachedRepository) {
+				user, _ := cached.FindUser(ctx, byID)
+				user.Attributes["division"] = "south"
+				user, _ = cached.FindUser(ctx, byID)
+				assert.Equal(t, "north", user.Attributes["division"])
+			},
+			wantStats: CacheStats{Hits: 1, Misses: 1},
+		},
+		{
+			name: "Other lookups are not cached",
+			mock: func(repo *MockRepositoryInterface) {
+				repo.EXPECT().FindUser(gomock.Any(), byPhone).Return(stored, nil).Times(2)
+				repo.EXPECT().FindUser(gomock.Any(), byID, byPhone).Return(stored, nil).Times(2)
+			},
+			run: func(t *testing.T, cached *CachedRepository) {
+				for i := 0; i < 2; i++ {
+					cached.FindUser(ctx, byPhone)
+					cached.FindUser(ctx, byID, byPhone)
+				}
+			},
+		},
+		{
+			name: "Missing user is not cached",
+			mock: func(repo *MockRepositoryInterface) {
+				repo.EXPECT().FindUser(gomock.Any(), byID).Return(User{}, ErrNotFound).Times(2)
+			},
+			run: func(t *testing.T, cached *CachedRepository) {
+				for i := 0; i < 2; i++ {
+					_, err := cached.FindUser(ctx, byID)
+					assert.ErrorIs(t, err, ErrNotFound)
+				}
+			},
+			wantStats: CacheStats{Misses: 2},
+		},
+		{
+			name: "Write invalidate the user, also when it failed",
+			mock: func(repo *MockRepositoryInterface) {
+				repo.EXPECT().FindUser(gomock.Any(), byID).Return(stored, nil).Times(3)
+				repo.EXPECT().UpdateUser(gomock.Any(), UpdateUser{ID: "user-1", Name: "Renamed"}).Return(nil)
+				repo.EXPECT().PatchUser(gomock.Any(), PatchUser{ID: "user-1", Version: 1}).Return(ErrVersionConflict)
+			},
+			run: func(t *testing.T, cached *CachedRepository) {
+				cached.FindUser(ctx, byID)
+				require.NoError(t, cached.UpdateUser(ctx, UpdateUser{ID: "user-1", Name: "Renamed"}))
+				cached.FindUser(ctx, byID)
+				assert.ErrorIs(t, cached.PatchUser(ctx, PatchUser{ID: "user-1", Version: 1}), ErrVersionConflict)
+				cached.FindUser(ctx, byID)
+			},
+			wantStats: CacheStats{Misses: 3},
+		},
+		{
+			name: "Login attempt invalidate the user of the phone",
+			mock: func(repo *MockRepositoryInterface) {
+				repo.EXPECT().FindUser(gomock.Any(), byID).Return(stored, nil).Times(2)
+				repo.EXPECT().IncreaseLoginAttempt(gomock.Any(), "+62856712332").Return(nil)
+				repo.EXPECT().FindUser(gomock.Any(), byPhone).Return(stored, nil)
+			},
+			run: func(t *testing.T, cached *CachedRepository) {
+				cached.FindUser(ctx, byID)
+				require.NoError(t, cached.IncreaseLoginAttempt(ctx, "+62856712332"))
+				cached.FindUser(ctx, byID)
+			},
+			wantStats: CacheStats{Misses: 2},
+		},
+		{
+			name: "User written while it was loaded is not cached",
+			mock: func(repo *MockRepositoryInterface) {
+				repo.EXPECT().UpdateAvatarKey(gomock.Any(), "user-1", "avatars/user-1").Return(nil)
+				repo.EXPECT().FindUser(gomock.Any(), byID).Return(stored, nil).Times(2)
+			},
+			run: func(t *testing.T, cached *CachedRepository) {
+				// The write commits after the row was read
+				cached.RepositoryInterface = &writeDuringFindUser{RepositoryInterface: cached.RepositoryInterface, write: func() {
+					cached.UpdateAvatarKey(ctx, "user-1", "avatars/user-1")
+				}}
+				cached.FindUser(ctx, byID)
+				cached.FindUser(ctx, byID)
+			},
+			wantStats: CacheStats{Misses: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repo := NewMockRepositoryInterface(ctrl)
+			tt.mock(repo)
+			cached := NewCachedRepository(NewCachedRepositoryOptions{
+				Repository: repo,
+				Store:      cache.NewMemoryStore(cache.NewMemoryStoreOptions{}),
+			})
+			tt.run(t, cached)
+			assert.Equal(t, tt.wantStats, cached.Stats())
+		})
+	}
+}
+
+// writeDuringFindUser : repository running a write after the first user it reads
+type writeDuringFindUser struct {
+	RepositoryInterface
+	write func()
+	once  sync.Once
+}
+
+func (r *writeDuringFindUser) FindUser(ctx context.Context, params ...Param) (User, error) {
+	user, err := r.RepositoryInterface.FindUser(ctx, params...)
+	r.once.Do(r.write)
+	return user, err
+}
+
+func TestCachedRepositorySingleflight(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	byID := Param{Logic: "AND", Field: "id", Operator: "=", Value: "user-1"}
+	release := make(chan struct{})
+	repo := NewMockRepositoryInterface(ctrl)
+	repo.EXPECT().FindUser(gomock.Any(), byID).DoAndReturn(func(ctx context.Context, params ...Param) (User, error) {
+		<-release
+		return User{ID: "user-1", Name: "User"}, nil
+	}).Times(1)
+	cached := NewCachedRepository(NewCachedRepositoryOptions{Repository: repo, Store: cache.NewMemoryStore(cache.NewMemoryStoreOptions{})})
+
+	// Concurrent misses of the same user read it once
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user, err := cached.FindUser(context.Background(), byID)
+			assert.NoError(t, err)
+			assert.Equal(t, "User", user.Name)
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	stats := cached.Stats()
+	assert.Equal(t, uint64(10), stats.Hits+stats.Misses)
+}
+
+func TestCachedRepositorySingleflightCancelledLeader(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	byID := Param{Logic: "AND", Field: "id", Operator: "=", Value: "user-1"}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	repo := NewMockRepositoryInterface(ctrl)
+	repo.EXPECT().FindUser(gomock.Any(), byID).DoAndReturn(func(ctx context.Context, params ...Param) (User, error) {
+		close(started)
+		<-release
+		// The load outlives the caller that started it
+		assert.NoError(t, ctx.Err())
+		return User{ID: "user-1", Name: "User"}, nil
+	}).Times(1)
+	cached := NewCachedRepository(NewCachedRepositoryOptions{Repository: repo, Store: cache.NewMemoryStore(cache.NewMemoryStoreOptions{})})
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+	go func() {
+		_, err := cached.FindUser(leaderCtx, byID)
+		leader <- err
+	}()
+	<-started
+
+	follower := make(chan User, 1)
+	go func() {
+		user, err := cached.FindUser(context.Background(), byID)
+		assert.NoError(t, err)
+		follower <- user
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// The cancelled leader stops waiting, the follower still gets the user it loads
+	cancel()
+	assert.ErrorIs(t, <-leader, context.Canceled)
+	close(release)
+	assert.Equal(t, "User", (<-follower).Name)
+
+	// The loaded user is cached as usual
+	user, err := cached.FindUser(context.Background(), byID)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", user.ID)
+}
+
+func TestCachedRepositoryStoreFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	byID := Param{Logic: "AND", Field: "id", Operator: "=", Value: "user-1"}
+	repo := NewMockRepositoryInterface(ctrl)
+	repo.EXPECT().FindUser(gomock.Any(), byID).Return(User{ID: "user-1"}, nil).Times(2)
+	repo.EXPECT().DeleteUser(gomock.Any(), "user-1").Return(nil)
+	store := cache.NewMockStore(ctrl)
+	store.EXPECT().Get(gomock.Any(), "user:id:user-1").Return(nil, false, errors.New("connection refused")).Times(2)
+	store.EXPECT().Set(gomock.Any(), "user:id:user-1", gomock.Any(), DefaultUserCacheTTL).Return(errors.New("connection refused")).Times(2)
+	store.EXPECT().Delete(gomock.Any(), "user:id:user-1").Return(errors.New("connection refused"))
+	cached := NewCachedRepository(NewCachedRepositoryOptions{Repository: repo, Store: store})
+
+	// Users are read from the repository while the store is down
+	for i := 0; i < 2; i++ {
+		user, err := cached.FindUser(context.Background(), byID)
+		require.NoError(t, err)
+		assert.Equal(t, "user-1", user.ID)
+	}
+	assert.NoError(t, cached.DeleteUser(context.Background(), "user-1"))
+	assert.Equal(t, CacheStats{Misses: 2, Errors: 5}, cached.Stats())
+}
+
+func TestCachedRepositoryRedis(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	// Two instances sharing the database and Redis
+	repo := NewMemoryRepository()
+	newInstance := func() *CachedRepository {
+		return NewCachedRepository(NewCachedRepositoryOptions{
+			Repository: repo,
+			Store:      cache.NewRedisStore(cache.NewRedisStoreOptions{Client: client, Prefix: "user-service:"}),
+			TTL:        time.Minute,
+		})
+	}
+	first, second := newInstance(), newInstance()
+
+	id := contractUser(t, repo, "+62856712332")
+	byID := Param{Logic: "AND", Field: "id", Operator: "=", Value: id}
+	user, err := first.FindUser(ctx, byID)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, server.TTL("user-service:user:id:"+id))
+
+	cachedUser, err := second.FindUser(ctx, byID)
+	require.NoError(t, err)
+	assert.Equal(t, user.Name, cachedUser.Name)
+	assert.True(t, user.CreatedAt.Equal(cachedUser.CreatedAt))
+	assert.Equal(t, CacheStats{Hits: 1}, second.Stats())
+
+	// Write on one instance invalidate the user for the other
+	require.NoError(t, first.PatchUser(ctx, PatchUser{ID: id, Version: user.Version, Fields: map[string]interface{}{"name": "Renamed"}}))
+	assert.False(t, server.Exists("user-service:user:id:"+id))
+	cachedUser, err = second.FindUser(ctx, byID)
+	require.NoError(t, err)
+	assert.Equal(t, "Renamed", cachedUser.Name)
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 1}, second.Stats())
+}
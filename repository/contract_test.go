@@ -0,0 +1,987 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runContract : behavior every RepositoryInterface implementation must have, newRepository return an empty repository for each test
+func runContract(t *testing.T, newRepository func(t *testing.T) RepositoryInterface) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repo RepositoryInterface)
+	}{
+		{"GetTestById", contractGetTestById},
+		{"Registration", contractRegistration},
+		{"ConcurrentRegistration", contractConcurrentRegistration},
+		{"CreateUsers", contractCreateUsers},
+		{"FindUser", contractFindUser},
+		{"ListUsers", contractListUsers},
+		{"UpdateUser", contractUpdateUser},
+		{"PatchUser", contractPatchUser},
+		{"ChangeSeq", contractChangeSeq},
+		{"SyncUser", contractSyncUser},
+		{"UserFlags", contractUserFlags},
+		{"ProvisionUser", contractProvisionUser},
+		{"ExportUsers", contractExportUsers},
+		{"DeleteUser", contractDeleteUser},
+		{"LoginOTP", contractLoginOTP},
+		{"PersonalAccessToken", contractPersonalAccessToken},
+		{"OAuthClient", contractOAuthClient},
+		{"AuthorizationCode", contractAuthorizationCode},
+		{"Organization", contractOrganization},
+		{"Members", contractMembers},
+		{"ChangeMembers", contractChangeMembers},
+		{"Invitation", contractInvitation},
+		{"RegisterInvitedUser", contractRegisterInvitedUser},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newRepository(t))
+		})
+	}
+}
+
+// contractUser : register user with the phone and return its id
+func contractUser(t *testing.T, repo RepositoryInterface, phone string) string {
+	id := uuid.NewString()
+	_, err := repo.Registration(context.Background(), RegistrationInput{ID: id, Phone: phone, Name: "User " + phone, Password: "hash", Salt: "salt"})
+	require.NoError(t, err)
+	return id
+}
+
+func findUserByID(t *testing.T, repo RepositoryInterface, id string) User {
+	user, err := repo.FindUser(context.Background(), Param{Field: "id", Operator: "=", Value: id})
+	require.NoError(t, err)
+	return user
+}
+
+func contractGetTestById(t *testing.T, repo RepositoryInterface) {
+	output, err := repo.GetTestById(context.Background(), GetTestByIdInput{Id: "1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "test1", output.Name)
+}
+
+func contractRegistration(t *testing.T, repo RepositoryInterface) {
+	ctx := context.Background()
+	verifiedAt := time.Now().Add(-time.Hour)
+	id := uuid.NewString()
+
+	output, err := repo.Registration(ctx, RegistrationInput{ID: id, Phone: "+628111111111", Name: "Budi", Password: "hash", Salt: "salt", PhoneVerifiedAt: &verifiedAt, OTPLoginEnabled: true})
+	require.NoError(t, err)
+	assert.Equal(t, id, output.ID)
+
+	// Credentials are read by phone, the user cache leaves them out of users found by id
+	user, err := repo.FindUser(ctx, Param{Field: "phone", Operator: "=", Value: "+628111111111"})
+	require.NoError(t, err)
+	assert.Equal(t, "hash", user.Password)
+	assert.Equal(t, "salt", user.Salt)
+
+	user = findUserByID(t, repo, id)
+	assert.Equal(t, "+628111111111", user.Phone)
+	assert.Equal(t, "Budi", user.Name)
+	assert.Equal(t, 1, user.Version)
+	assert.Equal(t, "default", user.Tenant)
+	assert.Empty(t, user.Attributes)
+	assert.True(t, user.OTPLoginEnabled)
+	require.NotNil(t, user.PhoneVerifiedAt)
+	assert.WithinDuration(t, verifiedAt, *user.PhoneVerifiedAt, time.Millisecond)
+	assert.Nil(t, user.Email)
+	assert.Nil(t, user.UpdatedAt)
+	assert.Nil(t, user.ProfileUpdatedAt)
+	assert.WithinDuration(t, time.Now(), user.CreatedAt, time.Minute)
+
+	// Phone number is unique, the typed error hides the driver error
+	_, err = repo.Registration(ctx, RegistrationInput{ID: uuid.NewString(), Phone: "+628111111111", Name: "Other", Password: "hash", Salt: "salt"})
+	assert.ErrorIs(t, err, ErrDuplicatePhone)
+
+	registered, err := repo.FindRegisteredPhones(ctx, []string{"+628111111111", "+628222222222"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"+628111111111"}, registered)
+
+	_, err = repo.FindUser(ctx, Param{Field: "id", Operator: "=", Value: uuid.NewString()})
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func contractConcurrentRegistration(t *testing.T, repo RepositoryInterface) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var succeeded, duplicated int
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repo.Registration(context.Background(), RegistrationInput{ID: uuid.NewString(), Phone: "+628111111111", Name: "Budi", Password: "hash", Salt: "salt"})
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				succeeded++
+			} else if assert.ErrorIs(t, err, ErrDuplicatePhone) {
+				duplicated++
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, succeeded)
+	assert.Equal(t, 9, duplicated)
+}
+
+func contractCreateUsers(t *testing.T, repo RepositoryInterface) {
+	ctx := context.Background()
+	contractUser(t, repo, "+628111111111")
+
+	// One duplicate phone fail the whole batch
+	err := repo.CreateUsers(ctx, []RegistrationInput{
+		{ID: uuid.NewString(), Phone: "+628222222222", Name: "Two", Password: "hash", Salt: "salt"},
+		{ID: uuid.NewString(), Phone: "+628111111111", Name: "One", Password: "hash", Salt: "salt"},
+	})
+	assert.ErrorIs(t, err, ErrDuplicatePhone)
+	registered, err := repo.FindRegisteredPhones(ctx, []string{"+628222222222"})
+	assert.NoError(t, err)
+	assert.Empty(t, registered)
+
+	err = repo.CreateUsers(ctx, []RegistrationInput{
+		{ID: uuid.NewString(), Phone: "+628222222222", Name: "Two", Password: "", Salt: "", OTPLoginEnabled: true},
+		{ID: uuid.NewString(), Phone: "+628333333333", Name: "Three", Password: "hash", Salt: "salt"},
+	})
+	assert.NoError(t, err)
+	registered, err = repo.FindRegisteredPhones(ctx, []string{"+628222222222", "+628333333333"})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"+628222222222", "+628333333333"}, registered)
+}
+
+func contractFindUser(t *testing.T, repo RepositoryInterface) {
+	ctx := context.Background()
+	budi := contractUser(t, repo, "+628111111111")
+	siti := contractUser(t, repo, "+628222222222")
+	email := "siti@example.com"
+	require.NoError(t, repo.UpdateUser(ctx, UpdateUser{ID: siti, Phone: "+628222222222", Name: "Siti_100%", Email: &email, Version: 1}))
+
+	tests := []struct {
+		name   string
+		params []Param
+		want   string
+	}{
+		{"Equal", []Param{{Field: "phone", Operator: "=", Value: "+628111111111"}}, budi},
+		{"And", []Param{{Field: "phone", Operator: "=", Value: "+628222222222"}, {Logic: "AND", Field: "version", Operator: "=", Value: 2}}, siti},
+		{"And does not match", []Param{{Field: "phone", Operator: "=", Value: "+628111111111"}, {Logic: "AND", Field: "version", Operator: "=", Value: 2}}, ""},
+		{"Or", []Param{{Field: "phone", Operator: "=", Value: "+620000000000"}, {Logic: "OR", Field: "email", Operator: "=", Value: email}}, siti},
+		{"Null is not equal", []Param{{Field: "email", Operator: "<>", Value: email}}, ""},
+		{"Is distinct from", []Param{{Field: "email", Operator: "IS DISTINCT FROM", Value: email}}, budi},
+		{"Is null", []Param{{Field: "(email IS NULL)", Operator: "=", Value: true}}, budi},
+		{"Is not null", []Param{{Field: "(email IS NOT NULL)", Operator: "=", Value: true}}, siti},
+		{"Is active", []Param{{Field: "(deactivated_at IS NULL)", Operator: "=", Value: false}}, ""},
+		{"ILIKE is case insensitive", []Param{{Field: "name", Operator: "ILIKE", Value: "siti%"}}, siti},
+		{"ILIKE escaped wildcard", []Param{{Field: "name", Operator: "ILIKE", Value: `%\_100\%`}}, siti},
+		{"ILIKE escaped wildcard is literal", []Param{{Field: "name", Operator: "ILIKE", Value: `user\%`}}, ""},
+		{"Coalesce", []Param{{Field: "COALESCE(updated_at, created_at)", Operator: ">", Value: time.Now().Add(-time.Hour)}, {Logic: "AND", Field: "id", Operator: "=", Value: budi}}, budi},
+		{"Greater than", []Param{{Field: "created_at", Operator: ">", Value: time.Now().Add(time.Hour)}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := repo.FindUser(ctx, tt.params...)
+			if tt.want == "" {
+				assert.ErrorIs(t, err, ErrNotFound)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, user.ID)
+		})
+	}
+}
+
+func contractListUsers(t *testing.T, repo RepositoryInterface) {
+	ctx := context.Background()
+	var ids []string
+	for _, phone := range []string{"+628111111111", "+628222222222", "+628333333333"} {
+		ids = append(ids, contractUser(t, repo, phone))
+	}
+
+	users, total, err := repo.ListUsers(ctx, nil, 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+	require.Len(t, users, 3)
+	var all []string
+	for _, user := range users {
+		all = append(all, user.ID)
+	}
+	assert.ElementsMatch(t, ids, all)
+	assert.True(t, sort.SliceIsSorted(users, func(i, j int) bool {
+		return users[i].CreatedAt.Before(users[j].CreatedAt) || (users[i].CreatedAt.Equal(users[j].CreatedAt) && users[i].ID < users[j].ID)
+	}))
+
+	// Pages follow the same order, total still counts every matching user
+	page, total, err := repo.ListUsers(ctx, nil, 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+	require.Len(t, page, 1)
+	assert.Equal(t, all[1], page[0].ID)
+
+	page, total, err = repo.ListUsers(ctx, []Param{{Field: "phone", Operator: "<>", Value: "+628111111111"}}, 5, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total)
+	assert.Empty(t, page)
+}
+
+func contractUpdateUser(t *testing.T, repo RepositoryInterface) {
+	ctx := context.Background()
+	id := contractUser(t, repo, "+628111111111")
+	contractUser(t, repo, "+628222222222")
+	email := "budi@example.com"
+	dateOfBirth := time.Date(1990, 5, 17, 0, 0, 0, 0, time.UTC)
+	region := "Riau"
+
+	err := repo.UpdateUser(ctx, UpdateUser{ID: id, Phone: "+628111111111", Name: "Budi", Email: &email, DateOfBirth: &dateOfBirth, Region: &region,
+		Attributes: map[string]interface{}{"employee_id": "E-1", "grade": float64(3)}, Version: 1})
+	require.NoError(t, err)
+	require.NoError(t, repo.VerifyEmail(ctx, id, email))
+
+	user := findUserByID(t, repo, id)
+	assert.Equal(t, 2, user.Version)
+	assert.Equal(t, "Budi", user.Name)
+	assert.Equal(t, &email, user.Email)
+	assert.NotNil(t, user.EmailVerifiedAt)
+	require.NotNil(t, user.DateOfBirth)
+	assert.Equal(t, "1990-05-17", user.DateOfBirth.Format("2006-01-02"))
+	assert.Equal(t, &region, user.Region)
+	assert.Equal(t, map[string]interface{}{"employee_id": "E-1", "grade": float64(3)}, user.Attributes)
+	assert.NotNil(t, user.UpdatedAt)
+	assert.NotNil(t, user.ProfileUpdatedAt)
+
+	// Stale version is refused, so concurrent updates cannot overwrite each other
+	err = repo.UpdateUser(ctx, UpdateUser{ID: id, Phone: "+628111111111", Name: "Stale", Version: 1})
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	err = repo.UpdateUser(ctx, UpdateUser{ID: uuid.NewString(), Phone: "+628999999999", Name: "Missing", Version: 1})
+	assert.ErrorIs(t, err, ErrVersionConflict)
+
+	err = repo.UpdateUser(ctx, UpdateUser{ID: id, Phone: "+628222222222", Name: "Budi", Email: &email, Version: 2})
+	assert.ErrorIs(t, err, ErrDuplicatePhone)
+
+	// Same email keep the verification, a new one must be verified again
+	err = repo.UpdateUser(ctx, UpdateUser{ID: id, Phone: "+628111111111", Name: "Budi", Email: &email, Version: 2})
+	require.NoError(t, err)
+	assert.NotNil(t, findUserByID(t, repo, id).EmailVerifiedAt)
+
+	other := "other@example.com"
+	err = repo.UpdateUser(ctx, UpdateUser{ID: id, Phone: "+628111111111", Name: "Budi", Email: &other, Version: 3})
+	require.NoError(t, err)
+	user = findUserByID(t, repo, id)
+	assert.Nil(t, user.EmailVerifiedAt)
+	assert.Nil(t, user.DateOfBirth)
+	assert.Empty(t, user.Attributes)
+
+	// The old address is no longer the email of the user
+	assert.ErrorIs(t, repo.VerifyEmail(ctx, id, email), ErrNotFound)
+}
+
+func contractPatchUser(t *testing.T, repo RepositoryInterface) {
+	ctx := context.Background()
+	id := contractUser(t, repo, "+628111111111")
+	otherID := contractUser(t, repo, "+628222222222")
+	email := "budi@example.com"
+	region := "Riau"
+	require.NoError(t, repo.UpdateUser(ctx, UpdateUser{ID: id, Phone: "+628111111111", Name: "Budi", Email: &email, Region: &region, Version: 1}))
+	require.NoError(t, repo.VerifyEmail(ctx, id, email))
+
+	err := repo.PatchUser(ctx, PatchUser{ID: id, Version: 2, Fields: map[string]interface{}{"version": 10}})
+	assert.Error(t, err)
+	err = repo.PatchUser(ctx, PatchUser{ID: id, Version: 2, Fields: map[string]interface{}{"attributes": "not an object"}})
+	assert.Error(t, err)
+	err = repo.PatchUser(ctx, PatchUser{ID: id, Version: 1, Fields: map[string]interface{}{"name": "Stale"}})
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	err = repo.PatchUser(ctx, PatchUser{ID: id, Version: 2, Fields: map[string]interface{}{"phone": "+628222222222"}})
+	assert.ErrorIs(t, err, ErrDuplicatePhone)
+
+	// Only the given columns change
+	err = repo.PatchUser(ctx, PatchUser{ID: id, Version: 2, Fields: map[string]interface{}{"name": "Budi Santoso", "region": nil, "attributes": map[string]interface{}{"team": "A"}}})
+	require.NoError(t, err)
+	user := findUserByID(t, repo, id)
+	assert.Equal(t, 3, user.Version)
+	assert.Equal(t, "Budi Santoso", user.Name)
+	assert.Nil(t, user.Region)
+	assert.Equal(t, &email, user.Email)
+	assert.NotNil(t, user.EmailVerifiedAt)
+	assert.Equal(t, map[string]interface{}{"team": "A"}, user.Attributes)
+
+	// Only verified emails are unique, an address claimed by a user that does not own it does not block its owner
+	otherEmail := "siti@example.com"
+	claimantID := contractUser(t, repo, "+628333333333")
+	require.NoError(t, repo.PatchUser(ctx, PatchUser{ID: claimantID, Version: 1, Fields: map[string]interface{}{"email": otherEmail}}))
+	require.NoError(t, repo.PatchUser(ctx, PatchUser{ID: otherID, Version: 1, Fields: map[string]interface{}{"email": otherEmail}}))
+	require.NoError(t, repo.VerifyEmail(ctx, otherID, otherEmail))
+	assert.ErrorIs(t, repo.VerifyEmail(ctx, claimantID, otherEmail), ErrDuplicateEmail)
+	assert.Nil(t, findUserByID(t, repo, claimantID).EmailVerifiedAt)
+
+	// Login by email prefers the user that verified it
+	verified, err := repo.FindVerifiedEmailUser(ctx, otherEmail)
+	require.NoError(t, err)
+	assert.Equal(t, otherID, verified.ID)
+	_, err = repo.FindVerifiedEmailUser(ctx, "nobody@example.com")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Any change of email require the new address to be verified again
+	deactivatedAt := time.Now()
+	err = repo.PatchUser(ctx, PatchUser{ID: id, Version: 3, Fields: map[string]interface{}{"email": "budi.santoso@example.com", "deactivated_at": deactivatedAt}})
+	require.NoError(t, err)
+	user = findUserByID(t, repo, id)
+	assert.Equal(t, 4, user.Version)
+	assert.Equal(t, "budi.santoso@example.com", *user.Email)
+	assert.Nil(t, user.EmailVerifiedAt)
+	require.NotNil(t, user.DeactivatedAt)
+	assert.WithinDuration(t, deactivatedAt, *user.DeactivatedAt, time.Millisecond)
+}
+
+func contractChangeSeq(t *testing.T, repo RepositoryInterface) {
+	ctx := context.Background()
+	id := contractUser(t, repo, "+628111111111")
+	otherID := contractUser(t, repo, "+628222222222")
+
+	// Every user has its own change sequence, later changes have higher ones
+	user := findUserByID(t, repo, id)
+	other := findUserByID(t, repo, otherID)
+	assert.Greater(t, user.ChangeSeq, int64(0))
+	assert.Greater(t, other.ChangeSeq, user.ChangeSeq)
+
+	changes := []func(version int) error{
+		func(version int) error {
+			return repo.UpdateUser(ctx, UpdateUser{ID: id, Phone: "+628111111111", Name: "Budi", Version: version})
+		},
+		func(version int) error {
+			return repo.PatchUser(ctx, PatchUser{ID: id, Version: version, Fields: map[string]interface{}{"region": "Riau"}})
+		},
+		func(version int) error { return repo.UpdateAvatarKey(ctx, id, "avatars/"+id) },
+		func(version int) error { return repo.UpdateOTPLogin(ctx, id, true) },
+	}
+	for i, change := range changes {
+		previous := findUserByID(t, repo, id)
+		require.NoError(t, change(previous.Version), "change %d", i)
+		user = findUserByID(t, repo, id)
+		assert.Greater(t, user.ChangeSeq, previous.ChangeSeq, "change %d", i)
+		assert.Greater(t, user.ChangeSeq, other.ChangeSeq, "change %d", i)
+	}
+
+	// Writes that keep the version keep the change sequence
+	require.NoError(t, repo.IncreaseLoginAttempt(ctx, "+628111111111"))
+	assert.Equal(t, user.ChangeSeq, findUserByID(t, repo, id).ChangeSeq)
+}
+
+func contractSyncUser(t *testing.T, repo RepositoryInterface) {
+	ctx := context.Background()
+	id := contractUser(t, repo, "+628111111111")
+	otherID := contractUser(t, repo, "+628222222222")
+	before := findUserByID(t, repo, id)
+
+	err := repo.SyncUser(ctx, SyncUser{
+		PatchUser: PatchUser{ID: id, Version: 1, Fields: map[string]interface{}{"name": "Budi"}},
+		Mutations: []SyncMutation{
+			{ID: "m1", Field: "name", Status: SyncApplied},
+			{ID: "m2", Field: "phone", Status: SyncRejected, Message: "Phone number was changed on the server"},
+		},
+	})
+	require.NoError(t, err)
+	user := findUserByID(t, repo, id)
+	assert.Equal(t, 2, user.Version)
+	assert.Equal(t, "Budi", user.Name)
+	assert.Greater(t, user.ChangeSeq, before.ChangeSeq)
+
+	mutations, err := repo.FindSyncMutations(ctx, id, []string{"m1", "m2", "unknown"})
+	require.NoError(t, err)
+	require.Len(t, mutations, 2)
+	sort.Slice(mutations, func(i, j int) bool { return mutations[i].ID < mutations[j].ID })
+	assert.Equal(t, "m1", mutations[0].ID)
+	assert.Equal(t, id, mutations[0].UserID)
+	assert.Equal(t, "name", mutations[0].Field)
+	assert.Equal(t, SyncApplied, mutations[0].Status)
+	assert.Empty(t, mutations[0].Message)
+	assert.False(t, mutations[0].CreatedAt.IsZero())
+	assert.Equal(t, SyncRejected, mutations[1].Status)
+	assert.Equal(t, "Phone number was changed on the server", mutations[1].Message)
+
+	// Mutation ids belong to the user
+	mutations, err = repo.FindSyncMutations(ctx, otherID, []string{"m1"})
+	require.NoError(t, err)
+	assert.Empty(t, mutations)
+
+	// Replayed mutations keep their outcome, without fields the user is unchanged
+	err = repo.SyncUser(ctx, SyncUser{
+		PatchUser: PatchUser{ID: id, Version: 2},
+		Mutations: []SyncMutation{{ID: "m1", Field: "name", Status: SyncRejected}, {ID: "m3", Field: "region", Status: SyncRejected}},
+	})
+	require.NoError(t, err)
+	mutations, err = repo.FindSyncMutations(ctx, id, []string{"m1", "m3"})
+	require.NoError(t, err)
+	assert.Len(t, mutations, 2)
+	for _, mutation := range mutations {
+		if mutation.ID == "m1" {
+			assert.Equal(t, SyncApplied, mutation.Status)
+		}
+	}
+	assert.Equal(t, user.ChangeSeq, findUserByID(t, repo, id).ChangeSeq)
+
+	// Nothing is stored when the patch fails
+	failed := []struct {
+		input SyncUser
+		err   error
+	}{
+		{SyncUser{PatchUser: PatchUser{ID: id, Version: 1, Fields: map[string]interface{}{"name": "Stale"}}, Mutations: []SyncMutation{{ID: "m4", Field: "name", Status: SyncApplied}}}, ErrVersionConflict},
+		{SyncUser{PatchUser: PatchUser{ID: id, Version: 2, Fields: map[string]interface{}{"phone": "+628222222222"}}, Mutations: []SyncMutation{{ID: "m4", Field: "phone", Status: SyncApplied}}}, ErrDuplicatePhone},
+	}
+	for _, tt := range failed {
+		err = repo.SyncUser(ctx, tt.input)
+		assert.ErrorIs(t, err, tt.err)
+	}
+	mutations, err = repo.FindSyncMutations(ctx, id, []string{"m4"})
+	require.NoError(t, err)
+	assert.Empty(t, mutations)
+	assert.Equal(t, "+628111111111", findUserByID(t, repo, id).Phone)
+
+	// Mutations are deleted with the user
+	require.NoError(t, repo.DeleteUser(ctx, id))
+	mutations, err = repo.FindSyncMutations(ctx, id, []string{"m1", "m2", "m3"})
+	require.NoError(t, err)
+	assert.Empty(t, mutations)
+}
+
+func contractUserFlags(t *testing.T, repo RepositoryInterface) {
+	ctx := context.Background()
+	id := contractUser(t, repo, "+628111111111")
+
+	require.NoError(t, repo.UpdateAvatarKey(ctx, id, "avatars/"+id))
+	require.NoError(t, repo.UpdateOTPLogin(ctx, id, true))
+	profileUpdatedAt := findUserByID(t, repo, id).ProfileUpdatedAt
+	require.NotNil(t, profileUpdatedAt)
+	require.NoError(t, repo.IncreaseLoginAttempt(ctx, "+628111111111"))
+
+	user := findUserByID(t, repo, id)
+	assert.Equal(t, 3, user.Version)
+	require.NotNil(t, user.AvatarKey)
+	assert.Equal(t, "avatars/"+id, *user.AvatarKey)
+	assert.True(t, user.OTPLoginEnabled)
+	assert.NotNil(t, user.UpdatedAt)
+	// Logins are not profile changes, offline edits made since the last profile change still win conflicts
+	require.NotNil(t, user.ProfileUpdatedAt)
+	assert.True(t, profileUpdatedAt.Equal(*user.ProfileUpdatedAt))
+
+	// Missing users are not an error, like an UPDATE matching no row
+	assert.NoError(t, repo.UpdateAvatarKey(ctx, uuid.NewString(), "avatars/missing"))
+	assert.NoError(t, repo.UpdateOTPLogin(ctx, uuid.NewString(), true))
+	assert.NoError(t, repo.IncreaseLoginAttempt(ctx, "+628999999999"))
+	assert.ErrorIs(t, repo.VerifyEmail(ctx, id, "budi@example.com"), ErrNotFound)
+
+	_, err := repo.FindAttributeSchema(ctx, "default")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func contractProvisionUser(t *testing.T, repo RepositoryInterface) {
+	ctx := context.Background()
+	email := "budi@example.com"
+	externalID := "okta-1"
+	id := uuid.NewString()
+
+	err := repo.ProvisionUser(ctx, User{ID: id, Phone: "+628111111111", Name: "Budi", Email: &email, Tenant: "acme", ExternalID: &externalID, OTPLoginEnabled: true})
+	require.NoError(t, err)
+	// Provisioned emails are not verified, so they are not unique
+	err = repo.ProvisionUser(ctx, User{ID: uuid.NewString(), Phone: "+628222222222", Name: "Other", Email: &email, Tenant: "acme"})
+	assert.NoError(t, err)
+	err = repo.ProvisionUser(ctx, User{ID: uuid.NewString(), Phone: "+628111111111", Name: "Other", Tenant: "acme"})
+	assert.ErrorIs(t, err, ErrDuplicatePhone)
+
+	user, err := repo.FindUser(ctx, Param{Field: "tenant", Operator: "=", Value: "acme"}, Param{Logic: "AND", Field: "external_id", Operator: "=", Value: externalID})
+	require.NoError(t, err)
+	assert.Equal(t, id, user.ID)
+	assert.Equal(t, 1, user.Version)
+	assert.Nil(t, user.DeactivatedAt)
+
+	other := contractUser(t, repo, "+628333333333")
+	found, err := repo.FindTenantUserIDs(ctx, "acme", []string{id, other, uuid.NewString()})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{id}, found)
+}
+
+func contractExportUsers(t *testing.T, repo RepositoryInterface) {
+	ctx := context.Background()
+	var ids []string
+	for _, phone := range []string{"+628111111111", "+628222222222", "+628333333333"} {
+		ids = append(ids, contractUser(t, repo, phone))
+	}
+	sort.Strings(ids)
+	estate := "Estate A"
+	require.NoError(t, repo.PatchUser(ctx, PatchUser{ID: ids[2], Version: 1, Fields: map[string]interface{}{"estate": estate, "attributes": map[string]interface{}{"team": "A"}}}))
+
+	// Pages are ordered by id and continue after the last id
+	users, err := repo.ExportUsers(ctx, ExportFilter{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	assert.Equal(t, ids[0], users[0].ID)
+	assert.Equal(t, ids[1], users[1].ID)
+	assert.JSONEq(t, `{}`, string(users[0].Attributes))
+
+	users, err = repo.ExportUsers(ctx, ExportFilter{After: ids[1], Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, ids[2], users[0].ID)
+	assert.Equal(t, 2, users[0].Version)
+	assert.JSONEq(t, `{"team": "A"}`, string(users[0].Attributes))
+
+	users, err = repo.ExportUsers(ctx, ExportFilter{Tenant: "default", Estate: estate, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, ids[2], users[0].ID)
+
+	future := time.Now().Add(time.Hour)
+	users, err = repo.ExportUsers(ctx, ExportFilter{CreatedAfter: &future, Limit: 10})
+	assert.NoError(t, err)
+	assert.Empty(t, users)
+	users, err = repo.ExportUsers(ctx, ExportFilter{CreatedBefore: &future, Region: "Riau", Limit: 10})
+	assert.NoError(t, err)
+	assert.Empty(t, users)
+}
+
+func contractDeleteUser(t *testing.T, repo RepositoryInterface) {
+	ctx := context.Background()
+	owner := contractUser(t, repo, "+628111111111")
+	id := contractUser(t, repo, "+628222222222")
+	organizationID := uuid.NewString()
+	require.NoError(t, repo.CreateOrganization(ctx, Organization{ID: organizationID, Name: "Estate"}, owner))
+	require.NoError(t, repo.AddMember(ctx, organizationID, id, RoleMember))
+	require.NoError(t, repo.CreatePersonalAccessToken(ctx, PersonalAccessToken{ID: uuid.NewString(), UserID: id, Name: "ci", TokenHash: tokenHash("a"), Prefix: "pat_a", Scopes: []string{"profile:read"}, ExpiresAt: time.Now().Add(time.Hour)}))
+	invitationID := uuid.NewString()
+	require.NoError(t, repo.CreateInvitation(ctx, Invitation{ID: invitationID, OrganizationID: organizationID, Phone: "+628333333333", Role: RoleMember, TokenHash: tokenHash("i"), InvitedBy: id, ExpiresAt: time.Now().Add(time.Hour)}))
+
+	require.NoError(t, repo.DeleteUser(ctx, id))
+	assert.ErrorIs(t, repo.DeleteUser(ctx, id), ErrNotFound)
+
+	// Tokens and memberships are deleted with the user, invitations it sent are kept
+	_, err := repo.FindUser(ctx, Param{Field: "id", Operator: "=", Value: id})
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = repo.FindPersonalAccessToken(ctx, tokenHash("a"))
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = repo.FindMembership(ctx, organizationID, id)
+	assert.ErrorIs(t, err, ErrNotFound)
+	invitation, err := repo.FindInvitation(ctx, tokenHash("i"))
+	require.NoError(t, err)
+	assert.Equal(t, "", invitation.InvitedBy)
+
+	// The phone can be registered again
+	contractUser(t, repo, "+628222222222")
+}
+
+func contractLoginOTP(t *testing.T, repo RepositoryInterface) {
+	ctx := context.Background()
+	since := time.Now().Add(-time.Minute)
+
+	_, err := repo.FindLoginOTP(ctx, "+628111111111")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, repo.CreateLoginOTP(ctx, LoginOTP{Phone: "+628111111111", CodeHash: "first", Salt: "salt", ExpiresAt: time.Now().Add(5 * time.Minute)}))
+	require.NoError(t, repo.CreateLoginOTP(ctx, LoginOTP{Phone: "+628111111111", CodeHash: "second", Salt: "salt", ExpiresAt: time.Now().Add(5 * time.Minute)}))
+	require.NoError(t, repo.CreateLoginOTP(ctx, LoginOTP{Phone: "+628111111111", CodeHash: "expired", Salt: "salt", ExpiresAt: time.Now().Add(-time.Minute)}))
+	require.NoError(t, repo.CreateLoginOTP(ctx, LoginOTP{Phone: "+628222222222", CodeHash: "other", Salt: "salt", ExpiresAt: time.Now().Add(5 * time.Minute)}))
+
+	count, err := repo.CountLoginOTP(ctx, "+628111111111", since)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+	count, err = repo.CountLoginOTP(ctx, "+628111111111", time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	// Latest unexpired passcode is the one to verify
+	otp, err := repo.FindLoginOTP(ctx, "+628111111111")
+	require.NoError(t, err)
+	assert.Equal(t, "second", otp.CodeHash)
+	assert.Equal(t, "salt", otp.Salt)
+	assert.Equal(t, 0, otp.Attempts)
+
+	require.NoError(t, repo.IncreaseLoginOTPAttempt(ctx, otp.ID, 5))
+	otp, err = repo.FindLoginOTP(ctx, "+628111111111")
+	require.NoError(t, err)
+	assert.Equal(t, 1, otp.Attempts)
+
+	// Concurrent guesses share the limit, only the attempts left are taken
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	taken := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := repo.IncreaseLoginOTPAttempt(ctx, otp.ID, 5)
+			if err != nil {
+				assert.ErrorIs(t, err, ErrNotFound)
+				return
+			}
+			mu.Lock()
+			taken++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 4, taken)
+	otp, err = repo.FindLoginOTP(ctx, "+628111111111")
+	require.NoError(t, err)
+	assert.Equal(t, 5, otp.Attempts)
+
+	// A passcode login once, a used passcode has no attempts left
+	require.NoError(t, repo.UseLoginOTP(ctx, otp.ID))
+	assert.ErrorIs(t, repo.UseLoginOTP(ctx, otp.ID), ErrNotFound)
+	assert.ErrorIs(t, repo.IncreaseLoginOTPAttempt(ctx, otp.ID, 10), ErrNotFound)
+	otp, err = repo.FindLoginOTP(ctx, "+628111111111")
+	require.NoError(t, err)
+	assert.Equal(t, "first", otp.CodeHash)
+}
+
+// tokenHash : 64 characters hash stored in CHAR(64) columns
+func tokenHash(seed string) string {
+	hash := ""
+	for len(hash) < 64 {
+		hash += seed
+	}
+	return hash[:64]
+}
+
+func contractPersonalAccessToken(t *testing.T, repo RepositoryInterface) {
+	ctx := context.Background()
+	userID := contractUser(t, repo, "+628111111111")
+	otherID := contractUser(t, repo, "+628222222222")
+	first := PersonalAccessToken{ID: uuid.NewString(), UserID: userID, Name: "ci", TokenHash: tokenHash("a"), Prefix: "pat_a", Scopes: []string{"profile:read"}, ExpiresAt: time.Now().Add(time.Hour)}
+	second := PersonalAccessToken{ID: uuid.NewString(), UserID: userID, Name: "cd", TokenHash: tokenHash("b"), Prefix: "pat_b", Scopes: []string{"profile:read", "profile:write"}, ExpiresAt: time.Now().Add(time.Hour)}
+	expired := PersonalAccessToken{ID: uuid.NewString(), UserID: userID, Name: "old", TokenHash: tokenHash("c"), Prefix: "pat_c", Scopes: []string{"profile:read"}, ExpiresAt: time.Now().Add(-time.Hour)}
+	require.NoError(t, repo.CreatePersonalAccessToken(ctx, first))
+	require.NoError(t, repo.CreatePersonalAccessToken(ctx, second))
+	require.NoError(t, repo.CreatePersonalAccessToken(ctx, expired))
+
+	// Token hash is unique and the user must exist
+	assert.ErrorIs(t, repo.CreatePersonalAccessToken(ctx, PersonalAccessToken{ID: uuid.NewString(), UserID: userID, Name: "copy", TokenHash: tokenHash("a"), Prefix: "pat_a", Scopes: []string{}, ExpiresAt: time.Now().Add(time.Hour)}), ErrConflict)
+	assert.Error(t, repo.CreatePersonalAccessToken(ctx, PersonalAccessToken{ID: uuid.NewString(), UserID: uuid.NewString(), Name: "orphan", TokenHash: tokenHash("d"), Prefix: "pat_d", Scopes: []string{}, ExpiresAt: time.Now().Add(time.Hour)}))
+
+	tokens, err := repo.ListPersonalAccessTokens(ctx, userID)
+	assert.NoError(t, err)
+	require.Len(t, tokens, 3)
+	assert.Equal(t, []string{expired.ID, second.ID, first.ID}, []string{tokens[0].ID, tokens[1].ID, tokens[2].ID})
+	assert.Equal(t, []string{"profile:read", "profile:write"}, tokens[1].Scopes)
+
+	token, err := repo.FindPersonalAccessToken(ctx, tokenHash("b"))
+	require.NoError(t, err)
+	assert.Equal(t, second.ID, token.ID)
+	assert.Equal(t, "pat_b", token.Prefix)
+	assert.Nil(t, token.LastUsedAt)
+	assert.WithinDuration(t, second.ExpiresAt, token.ExpiresAt, time.Millisecond)
+	_, err = repo.FindPersonalAccessToken(ctx, tokenHash("c"))
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Last use is recorded at most once a minute
+	require.NoError(t, repo.TouchPersonalAccessToken(ctx, second.ID))
+	token, err = repo.FindPersonalAccessToken(ctx, tokenHash("b"))
+	require.NoError(t, err)
+	require.NotNil(t, token.LastUsedAt)
+	lastUsedAt := *token.LastUsedAt
+	require.NoError(t, repo.TouchPersonalAccessToken(ctx, second.ID))
+	token, err = repo.FindPersonalAccessToken(ctx, tokenHash("b"))
+	require.NoError(t, err)
+	assert.True(t, lastUsedAt.Equal(*token.LastUsedAt))
+
+	assert.ErrorIs(t, repo.RevokePersonalAccessToken(ctx, otherID, second.ID), ErrNotFound)
+	require.NoError(t, repo.RevokePersonalAccessToken(ctx, userID, second.ID))
+	assert.ErrorIs(t, repo.RevokePersonalAccessToken(ctx, userID, second.ID), ErrNotFound)
+	_, err = repo.FindPersonalAccessToken(ctx, tokenHash("b"))
+	assert.ErrorIs(t, err, ErrNotFound)
+	tokens, err = repo.ListPersonalAccessTokens(ctx, userID)
+	assert.NoError(t, err)
+	assert.Len(t, tokens, 2)
+}
+
+func contractOAuthClient(t *testing.T, repo RepositoryInterface) {
+	ctx := context.Background()
+	tenant := "acme"
+	require.NoError(t, repo.CreateOAuthClient(ctx, OAuthClient{ID: "billing", Name: "Billing", SecretHash: tokenHash("s"), Scopes: []string{"users:read"}, RedirectURIs: []string{}}))
+	require.NoError(t, repo.CreateOAuthClient(ctx, OAuthClient{ID: "okta", Name: "Okta", SecretHash: tokenHash("o"), Scopes: []string{"scim"}, RedirectURIs: []string{"https://example.com/callback"}, Tenant: &tenant}))
+	assert.ErrorIs(t, repo.CreateOAuthClient(ctx, OAuthClient{ID: "billing", Name: "Copy", SecretHash: tokenHash("s"), Scopes: []string{}, RedirectURIs: []string{}}), ErrConflict)
+
+	client, err := repo.FindOAuthClient(ctx, "okta")
+	require.NoError(t, err)
+	assert.Equal(t, "Okta", client.Name)
+	assert.Equal(t, tokenHash("o"), client.SecretHash)
+	assert.Equal(t, []string{"scim"}, client.Scopes)
+	assert.Equal(t, []string{"https://example.com/callback"}, client.RedirectURIs)
+	assert.Equal(t, &tenant, client.Tenant)
+
+	clients, err := repo.ListOAuthClients(ctx)
+	assert.NoError(t, err)
+	require.Len(t, clients, 2)
+	assert.Equal(t, "billing", clients[0].ID)
+	assert.Empty(t, clients[0].RedirectURIs)
+	assert.Nil(t, clients[0].Tenant)
+
+	require.NoError(t, repo.RevokeOAuthClient(ctx, "billing"))
+	assert.ErrorIs(t, repo.RevokeOAuthClient(ctx, "billing"), ErrNotFound)
+	_, err = repo.FindOAuthClient(ctx, "billing")
+	assert.ErrorIs(t, err, ErrNotFound)
+	clients, err = repo.ListOAuthClients(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, clients, 1)
+}
+
+func contractAuthorizationCode(t *testing.T, repo RepositoryInterface) {
+	ctx := context.Background()
+	userID := contractUser(t, repo, "+628111111111")
+	require.NoError(t, repo.CreateOAuthClient(ctx, OAuthClient{ID: "portal", Name: "Portal", SecretHash: tokenHash("s"), Scopes: []string{"openid"}, RedirectURIs: []string{"https://example.com/callback"}}))
+	authTime := time.Now().Add(-time.Minute)
+	code := AuthorizationCode{CodeHash: tokenHash("c"), ClientID: "portal", UserID: userID, RedirectURI: "https://example.com/callback", Scopes: []string{"openid", "profile"},
+		Nonce: "n-0S6_WzA2Mj", CodeChallenge: "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", AuthTime: authTime, ExpiresAt: time.Now().Add(time.Minute)}
+	require.NoError(t, repo.CreateAuthorizationCode(ctx, code))
+	require.NoError(t, repo.CreateAuthorizationCode(ctx, AuthorizationCode{CodeHash: tokenHash("e"), ClientID: "portal", UserID: userID, RedirectURI: "https://example.com/callback", Scopes: []string{"openid"},
+		CodeChallenge: "challenge", AuthTime: authTime, ExpiresAt: time.Now().Add(-time.Minute)}))
+	assert.Error(t, repo.CreateAuthorizationCode(ctx, AuthorizationCode{CodeHash: tokenHash("u"), ClientID: "unknown", UserID: userID, RedirectURI: "https://example.com/callback", Scopes: []string{"openid"},
+		CodeChallenge: "challenge", AuthTime: authTime, ExpiresAt: time.Now().Add(time.Minute)}))
+
+	used, err := repo.UseAuthorizationCode(ctx, tokenHash("c"))
+	require.NoError(t, err)
+	assert.Equal(t, code.ClientID, used.ClientID)
+	assert.Equal(t, code.UserID, used.UserID)
+	assert.Equal(t, code.RedirectURI, used.RedirectURI)
+	assert.Equal(t, code.Scopes, used.Scopes)
+	assert.Equal(t, code.Nonce, used.Nonce)
+	assert.Equal(t, code.CodeChallenge, used.CodeChallenge)
+	assert.WithinDuration(t, authTime, used.AuthTime, time.Millisecond)
+
+	// Codes are single use and short lived
+	_, err = repo.UseAuthorizationCode(ctx, tokenHash("c"))
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = repo.UseAuthorizationCode(ctx, tokenHash("e"))
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func contractOrganization(t *testing.T, repo RepositoryInterface) {
+	ctx := context.Background()
+	owner := contractUser(t, repo, "+628111111111")
+	tenant := "acme"
+	externalID := "group-1"
+	estate := Organization{ID: uuid.NewString(), Name: "Estate Riau"}
+	group := Organization{ID: uuid.NewString(), Name: "Harvesters", Tenant: &tenant, ExternalID: &externalID}
+	require.NoError(t, repo.CreateOrganization(ctx, estate, owner))
+	require.NoError(t, repo.CreateOrganization(ctx, group, ""))
+	// The owner must be a user, nothing is created when it is not
+	missing := uuid.NewString()
+	assert.Error(t, repo.CreateOrganization(ctx, Organization{ID: missing, Name: "Orphan"}, uuid.NewString()))
+	_, err := repo.FindOrganization(ctx, Param{Field: "id", Operator: "=", Value: missing})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	found, err := repo.FindOrganization(ctx, Param{Field: "tenant", Operator: "=", Value: tenant}, Param{Logic: "AND", Field: "name", Operator: "ILIKE", Value: "harvest%"})
+	require.NoError(t, err)
+	assert.Equal(t, group.ID, found.ID)
+	assert.Equal(t, &externalID, found.ExternalID)
+	assert.WithinDuration(t, time.Now(), found.CreatedAt, time.Minute)
+
+	organizations, total, err := repo.ListOrganizations(ctx, []Param{{Field: "(tenant IS NULL)", Operator: "=", Value: true}}, 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+	require.Len(t, organizations, 1)
+	assert.Equal(t, estate.ID, organizations[0].ID)
+	_, total, err = repo.ListOrganizations(ctx, nil, 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total)
+
+	renamed := "Harvesters Riau"
+	require.NoError(t, repo.UpdateOrganization(ctx, Organization{ID: group.ID, Name: renamed}))
+	found, err = repo.FindOrganization(ctx, Param{Field: "id", Operator: "=", Value: group.ID})
+	require.NoError(t, err)
+	assert.Equal(t, renamed, found.Name)
+	assert.Nil(t, found.ExternalID)
+	assert.Equal(t, &tenant, found.Tenant)
+	assert.ErrorIs(t, repo.UpdateOrganization(ctx, Organization{ID: uuid.NewString(), Name: "Missing"}), ErrNotFound)
+
+	require.NoError(t, repo.CreateInvitation(ctx, Invitation{ID: uuid.NewString(), OrganizationID: estate.ID, Phone: "+628222222222", Role: RoleMember, TokenHash: tokenHash("i"), InvitedBy: owner, ExpiresAt: time.Now().Add(time.Hour)}))
+	require.NoError(t, repo.DeleteOrganization(ctx, estate.ID))
+	assert.ErrorIs(t, repo.DeleteOrganization(ctx, estate.ID), ErrNotFound)
+
+	// Members and invitations are deleted with the organization
+	memberships, err := repo.ListUserMemberships(ctx, owner)
+	assert.NoError(t, err)
+	assert.Empty(t, memberships)
+	_, err = repo.FindInvitation(ctx, tokenHash("i"))
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func contractMembers(t *testing.T, repo RepositoryInterface) {
+	ctx := context.Background()
+	owner := contractUser(t, repo, "+628111111111")
+	member := contractUser(t, repo, "+628222222222")
+	organizationID := uuid.NewString()
+	require.NoError(t, repo.CreateOrganization(ctx, Organization{ID: organizationID, Name: "Estate Riau"}, owner))
+
+	require.NoError(t, repo.AddMember(ctx, organizationID, member, RoleMember))
+	assert.ErrorIs(t, repo.AddMember(ctx, organizationID, member, RoleAdmin), ErrConflict)
+	assert.Error(t, repo.AddMember(ctx, organizationID, uuid.NewString(), RoleMember))
+	assert.Error(t, repo.AddMember(ctx, uuid.NewString(), member, RoleMember))
+
+	membership, err := repo.FindMembership(ctx, organizationID, member)
+	require.NoError(t, err)
+	assert.Equal(t, Membership{OrganizationID: organizationID, OrganizationName: "Estate Riau", UserID: member, Name: "User +628222222222", Phone: "+628222222222", Role: RoleMember, CreatedAt: membership.CreatedAt}, membership)
+	_, err = repo.FindMembership(ctx, organizationID, uuid.NewString())
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	members, err := repo.ListOrganizationMembers(ctx, organizationID)
+	assert.NoError(t, err)
+	require.Len(t, members, 2)
+	assert.ElementsMatch(t, []string{owner, member}, []string{members[0].UserID, members[1].UserID})
+	memberships, err := repo.ListUserMemberships(ctx, member)
+	assert.NoError(t, err)
+	require.Len(t, memberships, 1)
+	assert.Equal(t, "Estate Riau", memberships[0].OrganizationName)
+
+	// Organization keeps at least one owner
+	assert.ErrorIs(t, repo.UpdateMemberRole(ctx, organizationID, owner, RoleAdmin), ErrLastOwner)
+	assert.ErrorIs(t, repo.RemoveMember(ctx, organizationID, owner), ErrLastOwner)
+	assert.ErrorIs(t, repo.UpdateMemberRole(ctx, organizationID, uuid.NewString(), RoleAdmin), ErrNotFound)
+	require.NoError(t, repo.UpdateMemberRole(ctx, organizationID, member, RoleOwner))
+	require.NoError(t, repo.UpdateMemberRole(ctx, organizationID, owner, RoleMember))
+	require.NoError(t, repo.RemoveMember(ctx, organizationID, owner))
+	assert.ErrorIs(t, repo.RemoveMember(ctx, organizationID, owner), ErrNotFound)
+
+	membership, err = repo.FindMembership(ctx, organizationID, member)
+	require.NoError(t, err)
+	assert.Equal(t, RoleOwner, membership.Role)
+}
+
+func contractChangeMembers(t *testing.T, repo RepositoryInterface) {
+	ctx := context.Background()
+	owner := contractUser(t, repo, "+628111111111")
+	first := contractUser(t, repo, "+628222222222")
+	second := contractUser(t, repo, "+628333333333")
+	organizationID := uuid.NewString()
+	groupID := uuid.NewString()
+	require.NoError(t, repo.CreateOrganization(ctx, Organization{ID: organizationID, Name: "Estate Riau"}, owner))
+	require.NoError(t, repo.CreateOrganization(ctx, Organization{ID: groupID, Name: "Harvesters"}, ""))
+
+	// Existing members keep their role
+	require.NoError(t, repo.ChangeMembers(ctx, organizationID, []string{owner, first}, nil))
+	membership, err := repo.FindMembership(ctx, organizationID, owner)
+	require.NoError(t, err)
+	assert.Equal(t, RoleOwner, membership.Role)
+	membership, err = repo.FindMembership(ctx, organizationID, first)
+	require.NoError(t, err)
+	assert.Equal(t, RoleMember, membership.Role)
+
+	assert.ErrorIs(t, repo.ChangeMembers(ctx, organizationID, []string{second}, []string{owner}), ErrLastOwner)
+	_, err = repo.FindMembership(ctx, organizationID, second)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Unknown users fail the change, nothing is removed
+	assert.Error(t, repo.ChangeMembers(ctx, organizationID, []string{uuid.NewString()}, []string{first}))
+	_, err = repo.FindMembership(ctx, organizationID, first)
+	assert.NoError(t, err)
+
+	require.NoError(t, repo.ChangeMembers(ctx, organizationID, []string{second}, []string{first}))
+	members, err := repo.ListOrganizationMembers(ctx, organizationID)
+	assert.NoError(t, err)
+	assert.Len(t, members, 2)
+
+	// Groups without owner can lose every member
+	require.NoError(t, repo.ChangeMembers(ctx, groupID, []string{first, second}, nil))
+	require.NoError(t, repo.ChangeMembers(ctx, groupID, nil, []string{first, second}))
+	members, err = repo.ListOrganizationMembers(ctx, groupID)
+	assert.NoError(t, err)
+	assert.Empty(t, members)
+}
+
+func contractInvitation(t *testing.T, repo RepositoryInterface) {
+	ctx := context.Background()
+	owner := contractUser(t, repo, "+628111111111")
+	invited := contractUser(t, repo, "+628222222222")
+	organizationID := uuid.NewString()
+	require.NoError(t, repo.CreateOrganization(ctx, Organization{ID: organizationID, Name: "Estate Riau"}, owner))
+
+	first := Invitation{ID: uuid.NewString(), OrganizationID: organizationID, Phone: "+628222222222", Role: RoleMember, TokenHash: tokenHash("a"), InvitedBy: owner, ExpiresAt: time.Now().Add(time.Hour)}
+	second := Invitation{ID: uuid.NewString(), OrganizationID: organizationID, Phone: "+628222222222", Role: RoleAdmin, TokenHash: tokenHash("b"), InvitedBy: owner, ExpiresAt: time.Now().Add(time.Hour)}
+	expired := Invitation{ID: uuid.NewString(), OrganizationID: organizationID, Phone: "+628333333333", Role: RoleMember, TokenHash: tokenHash("c"), InvitedBy: owner, ExpiresAt: time.Now().Add(-time.Hour)}
+	require.NoError(t, repo.CreateInvitation(ctx, first))
+	require.NoError(t, repo.CreateInvitation(ctx, second))
+	require.NoError(t, repo.CreateInvitation(ctx, expired))
+	assert.Error(t, repo.CreateInvitation(ctx, Invitation{ID: uuid.NewString(), OrganizationID: uuid.NewString(), Phone: "+628444444444", Role: RoleMember, TokenHash: tokenHash("d"), InvitedBy: owner, ExpiresAt: time.Now().Add(time.Hour)}))
+
+	// Only the latest invitation of a phone works
+	_, err := repo.FindInvitation(ctx, tokenHash("a"))
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = repo.FindInvitation(ctx, tokenHash("c"))
+	assert.ErrorIs(t, err, ErrNotFound)
+	invitation, err := repo.FindInvitation(ctx, tokenHash("b"))
+	require.NoError(t, err)
+	assert.Equal(t, second.ID, invitation.ID)
+	assert.Equal(t, "Estate Riau", invitation.OrganizationName)
+	assert.Equal(t, RoleAdmin, invitation.Role)
+	assert.Equal(t, owner, invitation.InvitedBy)
+
+	invitations, err := repo.ListInvitations(ctx, organizationID)
+	assert.NoError(t, err)
+	require.Len(t, invitations, 3)
+	assert.Equal(t, []string{expired.ID, second.ID, first.ID}, []string{invitations[0].ID, invitations[1].ID, invitations[2].ID})
+	assert.NotNil(t, invitations[2].RevokedAt)
+
+	require.NoError(t, repo.AcceptInvitation(ctx, second.ID, invited))
+	assert.ErrorIs(t, repo.AcceptInvitation(ctx, second.ID, invited), ErrNotFound)
+	assert.ErrorIs(t, repo.AcceptInvitation(ctx, expired.ID, invited), ErrNotFound)
+	membership, err := repo.FindMembership(ctx, organizationID, invited)
+	require.NoError(t, err)
+	assert.Equal(t, RoleAdmin, membership.Role)
+	invitations, err = repo.ListInvitations(ctx, organizationID)
+	assert.NoError(t, err)
+	require.NotNil(t, invitations[1].AcceptedAt)
+	assert.Equal(t, &invited, invitations[1].AcceptedBy)
+
+	// Accepting again as an existing member keep the role
+	third := Invitation{ID: uuid.NewString(), OrganizationID: organizationID, Phone: "+628222222222", Role: RoleMember, TokenHash: tokenHash("e"), InvitedBy: owner, ExpiresAt: time.Now().Add(time.Hour)}
+	require.NoError(t, repo.CreateInvitation(ctx, third))
+	require.NoError(t, repo.AcceptInvitation(ctx, third.ID, invited))
+	membership, err = repo.FindMembership(ctx, organizationID, invited)
+	require.NoError(t, err)
+	assert.Equal(t, RoleAdmin, membership.Role)
+
+	fourth := Invitation{ID: uuid.NewString(), OrganizationID: organizationID, Phone: "+628555555555", Role: RoleMember, TokenHash: tokenHash("f"), InvitedBy: owner, ExpiresAt: time.Now().Add(time.Hour)}
+	require.NoError(t, repo.CreateInvitation(ctx, fourth))
+	assert.ErrorIs(t, repo.RevokeInvitation(ctx, uuid.NewString(), fourth.ID), ErrNotFound)
+	require.NoError(t, repo.RevokeInvitation(ctx, organizationID, fourth.ID))
+	assert.ErrorIs(t, repo.RevokeInvitation(ctx, organizationID, fourth.ID), ErrNotFound)
+	assert.ErrorIs(t, repo.RevokeInvitation(ctx, organizationID, second.ID), ErrNotFound)
+}
+
+func contractRegisterInvitedUser(t *testing.T, repo RepositoryInterface) {
+	ctx := context.Background()
+	owner := contractUser(t, repo, "+628111111111")
+	organizationID := uuid.NewString()
+	require.NoError(t, repo.CreateOrganization(ctx, Organization{ID: organizationID, Name: "Estate Riau"}, owner))
+	invitation := Invitation{ID: uuid.NewString(), OrganizationID: organizationID, Phone: "+628222222222", Role: RoleMember, TokenHash: tokenHash("a"), InvitedBy: owner, ExpiresAt: time.Now().Add(time.Hour)}
+	require.NoError(t, repo.CreateInvitation(ctx, invitation))
+	verifiedAt := time.Now()
+
+	// Registered phone fail before the invitation is accepted
+	err := repo.RegisterInvitedUser(ctx, invitation.ID, RegistrationInput{ID: uuid.NewString(), Phone: "+628111111111", Name: "Budi", Password: "hash", Salt: "salt"})
+	assert.ErrorIs(t, err, ErrDuplicatePhone)
+	_, err = repo.FindInvitation(ctx, tokenHash("a"))
+	assert.NoError(t, err)
+
+	// Invitation no longer pending fail without registering the user
+	err = repo.RegisterInvitedUser(ctx, uuid.NewString(), RegistrationInput{ID: uuid.NewString(), Phone: "+628222222222", Name: "Siti", Password: "hash", Salt: "salt"})
+	assert.ErrorIs(t, err, ErrNotFound)
+	registered, err := repo.FindRegisteredPhones(ctx, []string{"+628222222222"})
+	assert.NoError(t, err)
+	assert.Empty(t, registered)
+
+	id := uuid.NewString()
+	err = repo.RegisterInvitedUser(ctx, invitation.ID, RegistrationInput{ID: id, Phone: "+628222222222", Name: "Siti", Password: "hash", Salt: "salt", PhoneVerifiedAt: &verifiedAt})
+	require.NoError(t, err)
+	user := findUserByID(t, repo, id)
+	assert.NotNil(t, user.PhoneVerifiedAt)
+	membership, err := repo.FindMembership(ctx, organizationID, id)
+	require.NoError(t, err)
+	assert.Equal(t, RoleMember, membership.Role)
+	_, err = repo.FindInvitation(ctx, tokenHash("a"))
+	assert.ErrorIs(t, err, ErrNotFound)
+}
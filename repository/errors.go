@@ -0,0 +1,22 @@
+// This file contains errors that are returned by the repository layer.
+package repository
+
+import "errors"
+
+// ErrVersionConflict is returned by UpdateUser when the stored version no longer matches the expected one
+var ErrVersionConflict = errors.New("user version conflict")
+
+// ErrLastOwner is returned by UpdateMemberRole, RemoveMember and ChangeMembers when the organization would be left without an owner
+var ErrLastOwner = errors.New("organization must keep at least one owner")
+
+// ErrDuplicatePhone is returned when the phone number of a new or updated user is already registered to another user
+var ErrDuplicatePhone = errors.New("phone number already registered")
+
+// ErrDuplicateEmail is returned when the email of an updated user is already used by another user
+var ErrDuplicateEmail = errors.New("email already used")
+
+// ErrNotFound is returned when no record match, including tokens, codes and invitations that are expired, used or revoked
+var ErrNotFound = errors.New("record not found")
+
+// ErrConflict is returned when a new record conflicts with an existing one, such as adding a member twice
+var ErrConflict = errors.New("record already exists")
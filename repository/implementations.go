@@ -2,31 +2,154 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
 )
 
+// uniqueViolationCode : SQLSTATE of unique_violation
+const uniqueViolationCode = "23505"
+
+// userColumns : columns of public.user selected into User, the order must follow the Scan in FindUser
+const userColumns = "id, phone, name, password, salt, version, email, email_verified_at, preferred_language, avatar_url, date_of_birth, address, estate, region, tenant, attributes, avatar_key, otp_login_enabled, phone_verified_at, external_id, deactivated_at, created_at, updated_at, change_seq, profile_updated_at"
+
+// patchableColumns : columns of public.user that can be changed by PatchUser, the handlers decide which of them a request may change
+var patchableColumns = map[string]bool{
+	"phone":              true,
+	"name":               true,
+	"email":              true,
+	"preferred_language": true,
+	"avatar_url":         true,
+	"date_of_birth":      true,
+	"address":            true,
+	"estate":             true,
+	"region":             true,
+	"attributes":         true,
+	"password":           true,
+	"salt":               true,
+	"otp_login_enabled":  true,
+	"external_id":        true,
+	"deactivated_at":     true,
+}
+
 func (r *Repository) GetTestById(ctx context.Context, input GetTestByIdInput) (output GetTestByIdOutput, err error) {
 	err = r.Db.QueryRowContext(ctx, "SELECT name FROM test WHERE id = $1", input.Id).Scan(&output.Name)
 	if err != nil {
+		err = driverError(err)
 		return
 	}
 	return
 }
 
+// Registration : Register new user, ErrDuplicatePhone when the phone number is already registered
 func (r *Repository) Registration(ctx context.Context, input RegistrationInput) (output RegistrationOutput, err error) {
-	_, err = r.Db.ExecContext(ctx, "INSERT INTO public.user (id, phone, name, password, salt) VALUES ($1, $2, $3, $4, $5)", input.ID, input.Phone, input.Name, input.Password, input.Salt)
+	_, err = r.Db.ExecContext(ctx, registrationQuery, input.ID, input.Phone, input.Name, input.Password, input.Salt, input.PhoneVerifiedAt, input.OTPLoginEnabled)
 	if err != nil {
+		err = driverError(err)
 		return
 	}
 	return RegistrationOutput{ID: input.ID}, nil
 }
 
+// registrationQuery : insert new user, shared by Registration, CreateUsers and RegisterInvitedUser
+const registrationQuery = "INSERT INTO public.user (id, phone, name, password, salt, phone_verified_at, otp_login_enabled) VALUES ($1, $2, $3, $4, $5, $6, $7)"
+
+// CreateUsers : Register users in one transaction, none of them are registered when one fails, e.g. with ErrDuplicatePhone
+func (r *Repository) CreateUsers(ctx context.Context, inputs []RegistrationInput) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, registrationQuery)
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+
+	for _, input := range inputs {
+		_, err = stmt.ExecContext(ctx, input.ID, input.Phone, input.Name, input.Password, input.Salt, input.PhoneVerifiedAt, input.OTPLoginEnabled)
+		if err != nil {
+			err = driverError(err)
+			return
+		}
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// FindRegisteredPhones : Find which of the phone numbers are already registered
+func (r *Repository) FindRegisteredPhones(ctx context.Context, phones []string) (registered []string, err error) {
+	rows, err := r.Db.QueryContext(ctx, "SELECT phone FROM public.user WHERE phone = ANY($1)", pq.Array(phones))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var phone string
+		err = rows.Scan(&phone)
+		if err != nil {
+			return
+		}
+		registered = append(registered, phone)
+	}
+	err = rows.Err()
+	return
+}
+
 // FindUser : Find user by params
 func (r *Repository) FindUser(ctx context.Context, params ...Param) (user User, err error) {
-	where := ""
-	var values []any
+	where, values := whereParams(params)
+	log.Println(fmt.Sprintf("SELECT %s FROM public.user %s %v", userColumns, where, values))
+	return scanUser(r.Db.QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM public.user %s", userColumns, where), values...))
+}
+
+// FindVerifiedEmailUser : Find the user that verified the email, verified emails are unique
+func (r *Repository) FindVerifiedEmailUser(ctx context.Context, email string) (user User, err error) {
+	return scanUser(r.Db.QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM public.user WHERE email=$1 AND email_verified_at IS NOT NULL", userColumns), email))
+}
+
+// ListUsers : Find a page of users matching the params ordered by registration, total is the number of every matching user
+func (r *Repository) ListUsers(ctx context.Context, params []Param, offset int, limit int) (users []User, total int, err error) {
+	where, values := whereParams(params)
+	err = r.Db.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM public.user %s", where), values...).Scan(&total)
+	if err != nil {
+		return
+	}
+
+	values = append(values, offset, limit)
+	rows, err := r.Db.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM public.user %s ORDER BY created_at, id OFFSET $%d LIMIT $%d", userColumns, where, len(values)-1, len(values)), values...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user User
+		user, err = scanUser(rows)
+		if err != nil {
+			return
+		}
+		users = append(users, user)
+	}
+	err = rows.Err()
+	return
+}
+
+// whereParams : WHERE clause of the params and their values, empty when there is no param
+func whereParams(params []Param) (where string, values []any) {
 	for i, param := range params {
 		if where != "" {
 			logic := "AND "
@@ -42,11 +165,131 @@ func (r *Repository) FindUser(ctx context.Context, params ...Param) (user User,
 	if where != "" {
 		where = "WHERE " + where
 	}
-	log.Println(fmt.Sprintf("SELECT id, phone, name, password, salt FROM public.user %s %v", where, values))
-	err = r.Db.QueryRowContext(ctx, fmt.Sprintf("SELECT id, phone, name, password, salt FROM public.user %s", where), values...).Scan(&user.ID, &user.Phone, &user.Name, &user.Password, &user.Salt)
+	return
+}
+
+// scanUser : scan row of userColumns
+func scanUser(row interface{ Scan(dest ...any) error }) (user User, err error) {
+	var attributes []byte
+	err = row.Scan(
+		&user.ID, &user.Phone, &user.Name, &user.Password, &user.Salt, &user.Version,
+		&user.Email, &user.EmailVerifiedAt, &user.PreferredLanguage, &user.AvatarURL, &user.DateOfBirth, &user.Address, &user.Estate, &user.Region,
+		&user.Tenant, &attributes, &user.AvatarKey, &user.OTPLoginEnabled, &user.PhoneVerifiedAt,
+		&user.ExternalID, &user.DeactivatedAt, &user.CreatedAt, &user.UpdatedAt, &user.ChangeSeq, &user.ProfileUpdatedAt,
+	)
+	if err != nil {
+		err = driverError(err)
+		return
+	}
+
+	err = json.Unmarshal(attributes, &user.Attributes)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// ProvisionUser : Register user provisioned by the identity provider of its tenant, ErrDuplicatePhone or ErrDuplicateEmail when they are used by another user
+func (r *Repository) ProvisionUser(ctx context.Context, user User) (err error) {
+	_, err = r.Db.ExecContext(ctx, "INSERT INTO public.user (id, phone, name, password, salt, email, preferred_language, tenant, external_id, otp_login_enabled, deactivated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
+		user.ID, user.Phone, user.Name, user.Password, user.Salt, user.Email, user.PreferredLanguage, user.Tenant, user.ExternalID, user.OTPLoginEnabled, user.DeactivatedAt)
+	if err != nil {
+		err = driverError(err)
+		return
+	}
+	return
+}
+
+// DeleteUser : Delete user with everything that belongs to it, ErrNotFound when there is no such user
+func (r *Repository) DeleteUser(ctx context.Context, id string) (err error) {
+	result, err := r.Db.ExecContext(ctx, "DELETE FROM public.user WHERE id = $1", id)
+	if err != nil {
+		return
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return
+}
+
+// FindTenantUserIDs : Find which of the user ids belong to users of the tenant
+func (r *Repository) FindTenantUserIDs(ctx context.Context, tenant string, ids []string) (found []string, err error) {
+	rows, err := r.Db.QueryContext(ctx, "SELECT id FROM public.user WHERE tenant = $1 AND id = ANY($2)", tenant, pq.Array(ids))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		err = rows.Scan(&id)
+		if err != nil {
+			return
+		}
+		found = append(found, id)
+	}
+	err = rows.Err()
+	return
+}
+
+// exportColumns : columns of public.user selected into ExportUser, password and salt must never be added
+const exportColumns = "id, phone, name, version, email, email_verified_at, preferred_language, avatar_url, date_of_birth, address, estate, region, tenant, attributes, otp_login_enabled, phone_verified_at, created_at, updated_at"
+
+// ExportUsers : Find a page of users ordered by id, the next page starts after the id of the last user
+func (r *Repository) ExportUsers(ctx context.Context, filter ExportFilter) (users []ExportUser, err error) {
+	var conditions []string
+	var args []interface{}
+	condition := func(format string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(format, len(args)))
+	}
+	if filter.Tenant != "" {
+		condition("tenant = $%d", filter.Tenant)
+	}
+	if filter.Estate != "" {
+		condition("estate = $%d", filter.Estate)
+	}
+	if filter.Region != "" {
+		condition("region = $%d", filter.Region)
+	}
+	if filter.CreatedAfter != nil {
+		condition("created_at >= $%d", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		condition("created_at < $%d", *filter.CreatedBefore)
+	}
+	if filter.After != "" {
+		condition("id > $%d", filter.After)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	rows, err := r.Db.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM public.user %s ORDER BY id LIMIT $%d", exportColumns, where, len(args)), args...)
 	if err != nil {
 		return
 	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user ExportUser
+		err = rows.Scan(
+			&user.ID, &user.Phone, &user.Name, &user.Version,
+			&user.Email, &user.EmailVerifiedAt, &user.PreferredLanguage, &user.AvatarURL, &user.DateOfBirth, &user.Address, &user.Estate, &user.Region,
+			&user.Tenant, &user.Attributes, &user.OTPLoginEnabled, &user.PhoneVerifiedAt, &user.CreatedAt, &user.UpdatedAt,
+		)
+		if err != nil {
+			return
+		}
+		users = append(users, user)
+	}
+	err = rows.Err()
 	return
 }
 
@@ -58,10 +301,819 @@ func (r *Repository) IncreaseLoginAttempt(ctx context.Context, phone string) (er
 	return
 }
 
+// UpdateUser : Update user only when the stored version still equal to user.Version, then increment the version, ErrDuplicatePhone or ErrDuplicateEmail when they are used by another user
 func (r *Repository) UpdateUser(ctx context.Context, user UpdateUser) (err error) {
-	_, err = r.Db.ExecContext(ctx, "UPDATE public.user SET phone=$1, name=$2, updated_at=NOW() WHERE id=$3", user.Phone, user.Name, user.ID)
+	attributes, err := marshalAttributes(user.Attributes)
+	if err != nil {
+		return
+	}
+
+	// Changing email require the new address to be verified again
+	result, err := r.Db.ExecContext(ctx, `UPDATE public.user SET phone=$1, name=$2, email=$3, preferred_language=$4, avatar_url=$5, date_of_birth=$6,
+		address=$7, estate=$8, region=$9, attributes=$10, email_verified_at=CASE WHEN email IS DISTINCT FROM $3 THEN NULL ELSE email_verified_at END,
+		version=version+1, change_seq=nextval('public.user_change_seq'), updated_at=NOW(), profile_updated_at=NOW() WHERE id=$11 AND version=$12`,
+		user.Phone, user.Name, user.Email, user.PreferredLanguage, user.AvatarURL, user.DateOfBirth,
+		user.Address, user.Estate, user.Region, attributes, user.ID, user.Version)
+	if err != nil {
+		err = driverError(err)
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+	if affected == 0 {
+		return ErrVersionConflict
+	}
+	return
+}
+
+// PatchUser : Update only the given columns when the stored version still equal to input.Version, then increment the version, ErrDuplicatePhone or ErrDuplicateEmail when they are used by another user
+func (r *Repository) PatchUser(ctx context.Context, input PatchUser) (err error) {
+	return patchUser(ctx, r.Db, input)
+}
+
+// patchUser : PatchUser with the database or within a transaction
+func patchUser(ctx context.Context, db interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}, input PatchUser) (err error) {
+	columns := make([]string, 0, len(input.Fields))
+	for column := range input.Fields {
+		if !patchableColumns[column] {
+			return fmt.Errorf("column %s cannot be patched", column)
+		}
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	set := ""
+	var values []any
+	for i, column := range columns {
+		value := input.Fields[column]
+		if column == "attributes" {
+			attributes, ok := value.(map[string]interface{})
+			if !ok && value != nil {
+				return fmt.Errorf("attributes must be an object")
+			}
+			value, err = marshalAttributes(attributes)
+			if err != nil {
+				return
+			}
+		}
+
+		set += column + "=$" + strconv.Itoa(i+1) + ", "
+		values = append(values, value)
+	}
+	// Changing email require the new address to be verified again
+	if _, changed := input.Fields["email"]; changed {
+		set += "email_verified_at=NULL, "
+	}
+	values = append(values, input.ID, input.Version)
+
+	query := fmt.Sprintf("UPDATE public.user SET %sversion=version+1, change_seq=nextval('public.user_change_seq'), updated_at=NOW(), profile_updated_at=NOW() WHERE id=$%d AND version=$%d", set, len(values)-1, len(values))
+	result, err := db.ExecContext(ctx, query, values...)
 	if err != nil {
+		err = driverError(err)
 		return
 	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+	if affected == 0 {
+		return ErrVersionConflict
+	}
+	return
+}
+
+// SyncUser : Patch the user like PatchUser and store the outcome of the mutations in one transaction, mutations already stored are kept as they are
+func (r *Repository) SyncUser(ctx context.Context, input SyncUser) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	if len(input.Fields) > 0 {
+		err = patchUser(ctx, tx, input.PatchUser)
+		if err != nil {
+			return
+		}
+	}
+
+	for _, mutation := range input.Mutations {
+		_, err = tx.ExecContext(ctx, "INSERT INTO public.user_sync_mutation (user_id, id, field, status, message) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (user_id, id) DO NOTHING",
+			input.ID, mutation.ID, mutation.Field, mutation.Status, mutation.Message)
+		if err != nil {
+			err = driverError(err)
+			return
+		}
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// FindSyncMutations : Find the stored outcome of the mutations of the user among the ids
+func (r *Repository) FindSyncMutations(ctx context.Context, userID string, ids []string) (mutations []SyncMutation, err error) {
+	rows, err := r.Db.QueryContext(ctx, "SELECT id, user_id, field, status, message, created_at FROM public.user_sync_mutation WHERE user_id = $1 AND id = ANY($2) ORDER BY created_at, id", userID, pq.Array(ids))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mutation SyncMutation
+		err = rows.Scan(&mutation.ID, &mutation.UserID, &mutation.Field, &mutation.Status, &mutation.Message, &mutation.CreatedAt)
+		if err != nil {
+			return
+		}
+		mutations = append(mutations, mutation)
+	}
+	err = rows.Err()
+	return
+}
+
+// VerifyEmail : Mark email of the user as verified, ErrNotFound when the user email is no longer the given email and ErrDuplicateEmail when another user verified it first
+func (r *Repository) VerifyEmail(ctx context.Context, id string, email string) (err error) {
+	result, err := r.Db.ExecContext(ctx, "UPDATE public.user SET email_verified_at=NOW(), updated_at=NOW() WHERE id=$1 AND email=$2", id, email)
+	if err != nil {
+		err = driverError(err)
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return
+}
+
+// UpdateAvatarKey : Set blob storage key of the uploaded avatar
+func (r *Repository) UpdateAvatarKey(ctx context.Context, id string, avatarKey string) (err error) {
+	_, err = r.Db.ExecContext(ctx, "UPDATE public.user SET avatar_key=$1, version=version+1, change_seq=nextval('public.user_change_seq'), updated_at=NOW(), profile_updated_at=NOW() WHERE id=$2", avatarKey, id)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// FindAttributeSchema : Find JSON Schema of custom attributes for the tenant, ErrNotFound when tenant has no schema
+func (r *Repository) FindAttributeSchema(ctx context.Context, tenant string) (schema []byte, err error) {
+	err = r.Db.QueryRowContext(ctx, "SELECT schema FROM public.tenant_attribute_schema WHERE tenant = $1", tenant).Scan(&schema)
+	if err != nil {
+		err = driverError(err)
+		return
+	}
+	return
+}
+
+// UpdateOTPLogin : Allow or disallow login with SMS one time passcode
+func (r *Repository) UpdateOTPLogin(ctx context.Context, id string, enabled bool) (err error) {
+	_, err = r.Db.ExecContext(ctx, "UPDATE public.user SET otp_login_enabled=$1, version=version+1, change_seq=nextval('public.user_change_seq'), updated_at=NOW(), profile_updated_at=NOW() WHERE id=$2", enabled, id)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// CountLoginOTP : Count passcodes sent to the phone since the given time
+func (r *Repository) CountLoginOTP(ctx context.Context, phone string, since time.Time) (count int, err error) {
+	err = r.Db.QueryRowContext(ctx, "SELECT COUNT(*) FROM public.login_otp WHERE phone = $1 AND created_at >= $2", phone, since).Scan(&count)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// CreateLoginOTP : Store hash of new passcode sent to the phone
+func (r *Repository) CreateLoginOTP(ctx context.Context, otp LoginOTP) (err error) {
+	_, err = r.Db.ExecContext(ctx, "INSERT INTO public.login_otp (phone, code_hash, salt, expires_at) VALUES ($1, $2, $3, $4)", otp.Phone, otp.CodeHash, otp.Salt, otp.ExpiresAt)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// FindLoginOTP : Find the latest unused and unexpired passcode of the phone, ErrNotFound when there is none
+func (r *Repository) FindLoginOTP(ctx context.Context, phone string) (otp LoginOTP, err error) {
+	err = r.Db.QueryRowContext(ctx, `SELECT id, phone, code_hash, salt, attempts, expires_at FROM public.login_otp
+		WHERE phone = $1 AND used_at IS NULL AND expires_at > NOW() ORDER BY created_at DESC LIMIT 1`, phone).Scan(
+		&otp.ID, &otp.Phone, &otp.CodeHash, &otp.Salt, &otp.Attempts, &otp.ExpiresAt,
+	)
+	if err != nil {
+		err = driverError(err)
+		return
+	}
+	return
+}
+
+// IncreaseLoginOTPAttempt : Count a verification of the passcode before the code is compared, ErrNotFound when it was used or
+// already had max attempts, so concurrent guesses cannot get more than max comparisons
+func (r *Repository) IncreaseLoginOTPAttempt(ctx context.Context, id int64, max int) (err error) {
+	result, err := r.Db.ExecContext(ctx, "UPDATE public.login_otp SET attempts=attempts+1 WHERE id=$1 AND used_at IS NULL AND attempts < $2", id, max)
+	if err != nil {
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return
+}
+
+// UseLoginOTP : Mark the passcode as used, ErrNotFound when it was already used so a passcode only login once
+func (r *Repository) UseLoginOTP(ctx context.Context, id int64) (err error) {
+	result, err := r.Db.ExecContext(ctx, "UPDATE public.login_otp SET used_at=NOW() WHERE id=$1 AND used_at IS NULL", id)
+	if err != nil {
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
 	return
 }
+
+// personalAccessTokenColumns : columns of public.personal_access_token selected into PersonalAccessToken
+const personalAccessTokenColumns = "id, user_id, name, token_hash, prefix, scopes, expires_at, last_used_at, created_at"
+
+// CreatePersonalAccessToken : Store new personal access token of the user
+func (r *Repository) CreatePersonalAccessToken(ctx context.Context, token PersonalAccessToken) (err error) {
+	_, err = r.Db.ExecContext(ctx, "INSERT INTO public.personal_access_token (id, user_id, name, token_hash, prefix, scopes, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		token.ID, token.UserID, token.Name, token.TokenHash, token.Prefix, pq.Array(token.Scopes), token.ExpiresAt)
+	if err != nil {
+		err = driverError(err)
+		return
+	}
+	return
+}
+
+// ListPersonalAccessTokens : Find tokens of the user that are not revoked, newest first
+func (r *Repository) ListPersonalAccessTokens(ctx context.Context, userID string) (tokens []PersonalAccessToken, err error) {
+	rows, err := r.Db.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM public.personal_access_token WHERE user_id = $1 AND revoked_at IS NULL ORDER BY created_at DESC", personalAccessTokenColumns), userID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var token PersonalAccessToken
+		err = rows.Scan(&token.ID, &token.UserID, &token.Name, &token.TokenHash, &token.Prefix, pq.Array(&token.Scopes), &token.ExpiresAt, &token.LastUsedAt, &token.CreatedAt)
+		if err != nil {
+			return
+		}
+		tokens = append(tokens, token)
+	}
+	err = rows.Err()
+	return
+}
+
+// FindPersonalAccessToken : Find token by its hash, ErrNotFound when it does not exist, is revoked or expired
+func (r *Repository) FindPersonalAccessToken(ctx context.Context, tokenHash string) (token PersonalAccessToken, err error) {
+	err = r.Db.QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM public.personal_access_token WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > NOW()", personalAccessTokenColumns), tokenHash).Scan(
+		&token.ID, &token.UserID, &token.Name, &token.TokenHash, &token.Prefix, pq.Array(&token.Scopes), &token.ExpiresAt, &token.LastUsedAt, &token.CreatedAt,
+	)
+	if err != nil {
+		err = driverError(err)
+		return
+	}
+	return
+}
+
+// RevokePersonalAccessToken : Revoke token of the user, ErrNotFound when the user has no such active token
+func (r *Repository) RevokePersonalAccessToken(ctx context.Context, userID string, id string) (err error) {
+	result, err := r.Db.ExecContext(ctx, "UPDATE public.personal_access_token SET revoked_at=NOW() WHERE id=$1 AND user_id=$2 AND revoked_at IS NULL", id, userID)
+	if err != nil {
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return
+}
+
+// TouchPersonalAccessToken : Record the token was used, at most once a minute to keep writes low on busy integrations
+func (r *Repository) TouchPersonalAccessToken(ctx context.Context, id string) (err error) {
+	_, err = r.Db.ExecContext(ctx, "UPDATE public.personal_access_token SET last_used_at=NOW() WHERE id=$1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')", id)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// CreateOAuthClient : Store new OAuth client
+func (r *Repository) CreateOAuthClient(ctx context.Context, client OAuthClient) (err error) {
+	_, err = r.Db.ExecContext(ctx, "INSERT INTO public.oauth_client (id, name, secret_hash, scopes, redirect_uris, tenant) VALUES ($1, $2, $3, $4, $5, $6)",
+		client.ID, client.Name, client.SecretHash, pq.Array(client.Scopes), pq.Array(client.RedirectURIs), client.Tenant)
+	if err != nil {
+		err = driverError(err)
+		return
+	}
+	return
+}
+
+// ListOAuthClients : Find clients that are not revoked, oldest first
+func (r *Repository) ListOAuthClients(ctx context.Context) (clients []OAuthClient, err error) {
+	rows, err := r.Db.QueryContext(ctx, "SELECT id, name, secret_hash, scopes, redirect_uris, tenant, created_at FROM public.oauth_client WHERE revoked_at IS NULL ORDER BY created_at")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var client OAuthClient
+		err = rows.Scan(&client.ID, &client.Name, &client.SecretHash, pq.Array(&client.Scopes), pq.Array(&client.RedirectURIs), &client.Tenant, &client.CreatedAt)
+		if err != nil {
+			return
+		}
+		clients = append(clients, client)
+	}
+	err = rows.Err()
+	return
+}
+
+// FindOAuthClient : Find client by id, ErrNotFound when it does not exist or is revoked
+func (r *Repository) FindOAuthClient(ctx context.Context, id string) (client OAuthClient, err error) {
+	err = r.Db.QueryRowContext(ctx, "SELECT id, name, secret_hash, scopes, redirect_uris, tenant, created_at FROM public.oauth_client WHERE id = $1 AND revoked_at IS NULL", id).Scan(
+		&client.ID, &client.Name, &client.SecretHash, pq.Array(&client.Scopes), pq.Array(&client.RedirectURIs), &client.Tenant, &client.CreatedAt,
+	)
+	if err != nil {
+		err = driverError(err)
+		return
+	}
+	return
+}
+
+// RevokeOAuthClient : Revoke client, ErrNotFound when there is no such active client
+func (r *Repository) RevokeOAuthClient(ctx context.Context, id string) (err error) {
+	result, err := r.Db.ExecContext(ctx, "UPDATE public.oauth_client SET revoked_at=NOW() WHERE id=$1 AND revoked_at IS NULL", id)
+	if err != nil {
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return
+}
+
+// CreateAuthorizationCode : Store authorization code issued to the client for the user
+func (r *Repository) CreateAuthorizationCode(ctx context.Context, code AuthorizationCode) (err error) {
+	_, err = r.Db.ExecContext(ctx, "INSERT INTO public.oauth_authorization_code (code_hash, client_id, user_id, redirect_uri, scopes, nonce, code_challenge, auth_time, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+		code.CodeHash, code.ClientID, code.UserID, code.RedirectURI, pq.Array(code.Scopes), code.Nonce, code.CodeChallenge, code.AuthTime, code.ExpiresAt)
+	if err != nil {
+		err = driverError(err)
+		return
+	}
+	return
+}
+
+// UseAuthorizationCode : Mark the code used and return it, ErrNotFound when it does not exist, is expired or already used
+func (r *Repository) UseAuthorizationCode(ctx context.Context, codeHash string) (code AuthorizationCode, err error) {
+	err = r.Db.QueryRowContext(ctx, "UPDATE public.oauth_authorization_code SET used_at=NOW() WHERE code_hash=$1 AND used_at IS NULL AND expires_at > NOW() RETURNING code_hash, client_id, user_id, redirect_uri, scopes, nonce, code_challenge, auth_time, expires_at", codeHash).Scan(
+		&code.CodeHash, &code.ClientID, &code.UserID, &code.RedirectURI, pq.Array(&code.Scopes), &code.Nonce, &code.CodeChallenge, &code.AuthTime, &code.ExpiresAt,
+	)
+	if err != nil {
+		err = driverError(err)
+		return
+	}
+	return
+}
+
+// CreateOrganization : Store organization with the user creating it as its first owner, SCIM groups are created without owner
+func (r *Repository) CreateOrganization(ctx context.Context, organization Organization, ownerID string) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO public.organization (id, name, tenant, external_id) VALUES ($1, $2, $3, $4)", organization.ID, organization.Name, organization.Tenant, organization.ExternalID)
+	if err != nil {
+		err = driverError(err)
+		return
+	}
+	if ownerID != "" {
+		_, err = tx.ExecContext(ctx, "INSERT INTO public.organization_member (organization_id, user_id, role) VALUES ($1, $2, $3)", organization.ID, ownerID, RoleOwner)
+		if err != nil {
+			err = driverError(err)
+			return
+		}
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// organizationColumns : columns of public.organization selected into Organization, the order must follow the Scan in scanOrganization
+const organizationColumns = "id, name, tenant, external_id, created_at"
+
+func scanOrganization(row interface{ Scan(dest ...any) error }) (organization Organization, err error) {
+	err = row.Scan(&organization.ID, &organization.Name, &organization.Tenant, &organization.ExternalID, &organization.CreatedAt)
+	err = driverError(err)
+	return
+}
+
+// FindOrganization : Find organization by params
+func (r *Repository) FindOrganization(ctx context.Context, params ...Param) (organization Organization, err error) {
+	where, values := whereParams(params)
+	return scanOrganization(r.Db.QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM public.organization %s", organizationColumns, where), values...))
+}
+
+// ListOrganizations : Find a page of organizations matching the params ordered by creation, total is the number of every matching organization
+func (r *Repository) ListOrganizations(ctx context.Context, params []Param, offset int, limit int) (organizations []Organization, total int, err error) {
+	where, values := whereParams(params)
+	err = r.Db.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM public.organization %s", where), values...).Scan(&total)
+	if err != nil {
+		return
+	}
+
+	values = append(values, offset, limit)
+	rows, err := r.Db.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM public.organization %s ORDER BY created_at, id OFFSET $%d LIMIT $%d", organizationColumns, where, len(values)-1, len(values)), values...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var organization Organization
+		organization, err = scanOrganization(rows)
+		if err != nil {
+			return
+		}
+		organizations = append(organizations, organization)
+	}
+	err = rows.Err()
+	return
+}
+
+// UpdateOrganization : Change name and external id of the organization, ErrNotFound when there is no such organization
+func (r *Repository) UpdateOrganization(ctx context.Context, organization Organization) (err error) {
+	result, err := r.Db.ExecContext(ctx, "UPDATE public.organization SET name = $1, external_id = $2 WHERE id = $3", organization.Name, organization.ExternalID, organization.ID)
+	if err != nil {
+		return
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return
+}
+
+// DeleteOrganization : Delete organization with its members and invitations, ErrNotFound when there is no such organization
+func (r *Repository) DeleteOrganization(ctx context.Context, id string) (err error) {
+	result, err := r.Db.ExecContext(ctx, "DELETE FROM public.organization WHERE id = $1", id)
+	if err != nil {
+		return
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return
+}
+
+// ListUserMemberships : Find organizations of the user, earliest joined first
+func (r *Repository) ListUserMemberships(ctx context.Context, userID string) (memberships []Membership, err error) {
+	return r.listMemberships(ctx, "m.user_id = $1 ORDER BY m.created_at, m.organization_id", userID)
+}
+
+// FindMembership : Find membership of the user in the organization, ErrNotFound when the user is not a member
+func (r *Repository) FindMembership(ctx context.Context, organizationID string, userID string) (membership Membership, err error) {
+	memberships, err := r.listMemberships(ctx, "m.organization_id = $1 AND m.user_id = $2", organizationID, userID)
+	if err != nil {
+		return
+	}
+	if len(memberships) == 0 {
+		err = ErrNotFound
+		return
+	}
+	return memberships[0], nil
+}
+
+// ListOrganizationMembers : Find members of the organization, earliest joined first
+func (r *Repository) ListOrganizationMembers(ctx context.Context, organizationID string) (members []Membership, err error) {
+	return r.listMemberships(ctx, "m.organization_id = $1 ORDER BY m.created_at, m.user_id", organizationID)
+}
+
+// listMemberships : every membership query is scoped by organization or user through the given condition
+func (r *Repository) listMemberships(ctx context.Context, condition string, args ...interface{}) (memberships []Membership, err error) {
+	rows, err := r.Db.QueryContext(ctx, "SELECT m.organization_id, o.name, m.user_id, u.name, u.phone, m.role, m.created_at FROM public.organization_member m JOIN public.organization o ON o.id = m.organization_id JOIN public.user u ON u.id = m.user_id WHERE "+condition, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var membership Membership
+		err = rows.Scan(&membership.OrganizationID, &membership.OrganizationName, &membership.UserID, &membership.Name, &membership.Phone, &membership.Role, &membership.CreatedAt)
+		if err != nil {
+			return
+		}
+		memberships = append(memberships, membership)
+	}
+	err = rows.Err()
+	return
+}
+
+// AddMember : Add user to the organization, ErrConflict when the user is already a member
+func (r *Repository) AddMember(ctx context.Context, organizationID string, userID string, role string) (err error) {
+	_, err = r.Db.ExecContext(ctx, "INSERT INTO public.organization_member (organization_id, user_id, role) VALUES ($1, $2, $3)", organizationID, userID, role)
+	if err != nil {
+		err = driverError(err)
+		return
+	}
+	return
+}
+
+// UpdateMemberRole : Change role of the member, ErrNotFound when the user is not a member and ErrLastOwner when the last owner is demoted
+func (r *Repository) UpdateMemberRole(ctx context.Context, organizationID string, userID string, role string) (err error) {
+	return r.changeMember(ctx, organizationID, userID, role != RoleOwner, func(tx *sql.Tx) (sql.Result, error) {
+		return tx.ExecContext(ctx, "UPDATE public.organization_member SET role=$1 WHERE organization_id=$2 AND user_id=$3", role, organizationID, userID)
+	})
+}
+
+// RemoveMember : Remove user from the organization, ErrNotFound when the user is not a member and ErrLastOwner for the last owner
+func (r *Repository) RemoveMember(ctx context.Context, organizationID string, userID string) (err error) {
+	return r.changeMember(ctx, organizationID, userID, true, func(tx *sql.Tx) (sql.Result, error) {
+		return tx.ExecContext(ctx, "DELETE FROM public.organization_member WHERE organization_id=$1 AND user_id=$2", organizationID, userID)
+	})
+}
+
+// ChangeMembers : Add users as members and remove members in one transaction, existing members keep their role
+func (r *Repository) ChangeMembers(ctx context.Context, organizationID string, add []string, remove []string) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "SELECT id FROM public.organization WHERE id = $1 FOR UPDATE", organizationID)
+	if err != nil {
+		return
+	}
+
+	var owners, removedOwners int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*), COUNT(*) FILTER (WHERE user_id = ANY($3)) FROM public.organization_member WHERE organization_id = $1 AND role = $2",
+		organizationID, RoleOwner, pq.Array(remove)).Scan(&owners, &removedOwners)
+	if err != nil {
+		return
+	}
+	// Organizations without owner such as SCIM groups can stay so, the others must keep one
+	if owners > 0 && removedOwners == owners {
+		return ErrLastOwner
+	}
+
+	if len(remove) > 0 {
+		_, err = tx.ExecContext(ctx, "DELETE FROM public.organization_member WHERE organization_id = $1 AND user_id = ANY($2)", organizationID, pq.Array(remove))
+		if err != nil {
+			return
+		}
+	}
+	if len(add) > 0 {
+		_, err = tx.ExecContext(ctx, "INSERT INTO public.organization_member (organization_id, user_id, role) SELECT $1, unnest($2::uuid[]), $3 ON CONFLICT DO NOTHING",
+			organizationID, pq.Array(add), RoleMember)
+		if err != nil {
+			return
+		}
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// changeMember : the organization row is locked so concurrent changes cannot remove every owner
+func (r *Repository) changeMember(ctx context.Context, organizationID string, userID string, losesOwner bool, change func(tx *sql.Tx) (sql.Result, error)) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "SELECT id FROM public.organization WHERE id = $1 FOR UPDATE", organizationID)
+	if err != nil {
+		return
+	}
+
+	var role string
+	err = tx.QueryRowContext(ctx, "SELECT role FROM public.organization_member WHERE organization_id = $1 AND user_id = $2", organizationID, userID).Scan(&role)
+	if err != nil {
+		err = driverError(err)
+		return
+	}
+	if losesOwner && role == RoleOwner {
+		var owners int
+		err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM public.organization_member WHERE organization_id = $1 AND role = $2", organizationID, RoleOwner).Scan(&owners)
+		if err != nil {
+			return
+		}
+		if owners <= 1 {
+			return ErrLastOwner
+		}
+	}
+
+	_, err = change(tx)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// CreateInvitation : Store invitation, pending invitations of the same phone to the organization are revoked so only the latest works
+func (r *Repository) CreateInvitation(ctx context.Context, invitation Invitation) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "UPDATE public.organization_invitation SET revoked_at=NOW() WHERE organization_id=$1 AND phone=$2 AND accepted_at IS NULL AND revoked_at IS NULL", invitation.OrganizationID, invitation.Phone)
+	if err != nil {
+		return
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO public.organization_invitation (id, organization_id, phone, role, token_hash, invited_by, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		invitation.ID, invitation.OrganizationID, invitation.Phone, invitation.Role, invitation.TokenHash, invitation.InvitedBy, invitation.ExpiresAt)
+	if err != nil {
+		err = driverError(err)
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// invitationColumns : columns of invitation joined with its organization, the order must follow the Scan in scanInvitation
+const invitationColumns = "i.id, i.organization_id, o.name, i.phone, i.role, i.token_hash, COALESCE(i.invited_by::text, ''), i.expires_at, i.accepted_at, i.accepted_by, i.revoked_at, i.created_at"
+
+func scanInvitation(row interface{ Scan(dest ...any) error }) (invitation Invitation, err error) {
+	err = row.Scan(&invitation.ID, &invitation.OrganizationID, &invitation.OrganizationName, &invitation.Phone, &invitation.Role, &invitation.TokenHash, &invitation.InvitedBy,
+		&invitation.ExpiresAt, &invitation.AcceptedAt, &invitation.AcceptedBy, &invitation.RevokedAt, &invitation.CreatedAt)
+	err = driverError(err)
+	return
+}
+
+// ListInvitations : Find every invitation of the organization, newest first
+func (r *Repository) ListInvitations(ctx context.Context, organizationID string) (invitations []Invitation, err error) {
+	rows, err := r.Db.QueryContext(ctx, "SELECT "+invitationColumns+" FROM public.organization_invitation i JOIN public.organization o ON o.id = i.organization_id WHERE i.organization_id = $1 ORDER BY i.created_at DESC", organizationID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var invitation Invitation
+		invitation, err = scanInvitation(rows)
+		if err != nil {
+			return
+		}
+		invitations = append(invitations, invitation)
+	}
+	err = rows.Err()
+	return
+}
+
+// FindInvitation : Find pending invitation by token hash, ErrNotFound when it does not exist, is expired, accepted or revoked
+func (r *Repository) FindInvitation(ctx context.Context, tokenHash string) (invitation Invitation, err error) {
+	return scanInvitation(r.Db.QueryRowContext(ctx, "SELECT "+invitationColumns+" FROM public.organization_invitation i JOIN public.organization o ON o.id = i.organization_id WHERE i.token_hash = $1 AND i.accepted_at IS NULL AND i.revoked_at IS NULL AND i.expires_at > NOW()", tokenHash))
+}
+
+// RevokeInvitation : Revoke pending invitation of the organization, ErrNotFound when there is no such pending invitation
+func (r *Repository) RevokeInvitation(ctx context.Context, organizationID string, id string) (err error) {
+	result, err := r.Db.ExecContext(ctx, "UPDATE public.organization_invitation SET revoked_at=NOW() WHERE id=$1 AND organization_id=$2 AND accepted_at IS NULL AND revoked_at IS NULL", id, organizationID)
+	if err != nil {
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return
+}
+
+// AcceptInvitation : Add the user to the organization of the invitation, ErrNotFound when the invitation is no longer pending
+func (r *Repository) AcceptInvitation(ctx context.Context, id string, userID string) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	err = acceptInvitation(ctx, tx, id, userID)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// RegisterInvitedUser : Register new user and accept the invitation sent to its phone, ErrNotFound when the invitation is no longer pending and ErrDuplicatePhone when the phone is registered
+func (r *Repository) RegisterInvitedUser(ctx context.Context, id string, input RegistrationInput) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, registrationQuery, input.ID, input.Phone, input.Name, input.Password, input.Salt, input.PhoneVerifiedAt, input.OTPLoginEnabled)
+	if err != nil {
+		err = driverError(err)
+		return
+	}
+	err = acceptInvitation(ctx, tx, id, input.ID)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// acceptInvitation : mark invitation accepted and add the membership, the role of existing members is kept
+func acceptInvitation(ctx context.Context, tx *sql.Tx, id string, userID string) (err error) {
+	var organizationID, role string
+	err = tx.QueryRowContext(ctx, "UPDATE public.organization_invitation SET accepted_at=NOW(), accepted_by=$1 WHERE id=$2 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > NOW() RETURNING organization_id, role", userID, id).Scan(&organizationID, &role)
+	if err != nil {
+		err = driverError(err)
+		return
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO public.organization_member (organization_id, user_id, role) VALUES ($1, $2, $3) ON CONFLICT (organization_id, user_id) DO NOTHING", organizationID, userID, role)
+	return
+}
+
+// driverError : typed error of the error returned by lib/pq or pgx, so callers do not depend on the driver, other errors are returned as is
+func driverError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	var code, constraint string
+	var pqErr *pq.Error
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.As(err, &pqErr):
+		code, constraint = string(pqErr.Code), pqErr.Constraint
+	case errors.As(err, &pgErr):
+		code, constraint = pgErr.Code, pgErr.ConstraintName
+	default:
+		return err
+	}
+	if code != uniqueViolationCode {
+		return err
+	}
+
+	switch constraint {
+	case "user_phone_key":
+		return ErrDuplicatePhone
+	case "user_email_key":
+		return ErrDuplicateEmail
+	}
+	return ErrConflict
+}
+
+// marshalAttributes : encode custom attributes as JSONB value, empty attributes stored as empty object
+func marshalAttributes(attributes map[string]interface{}) (string, error) {
+	if attributes == nil {
+		return "{}", nil
+	}
+	encoded, err := json.Marshal(attributes)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
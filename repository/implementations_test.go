@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRepositoryContract : run the contract with both drivers against the Postgres database of TEST_DATABASE_URL, its data is deleted before every test
+func TestRepositoryContract(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	for _, driver := range []string{DriverPQ, DriverPgx} {
+		t.Run(driver, func(t *testing.T) {
+			repo := NewRepository(NewRepositoryOptions{Dsn: dsn, Driver: driver}).(*Repository)
+			defer repo.Db.Close()
+
+			runContract(t, func(t *testing.T) RepositoryInterface {
+				_, err := repo.Db.Exec("TRUNCATE public.user, public.organization, public.oauth_client, public.login_otp, public.tenant_attribute_schema CASCADE")
+				require.NoError(t, err)
+				return repo
+			})
+		})
+	}
+}
+
+func TestDriverError(t *testing.T) {
+	other := errors.New("connection refused")
+	testCases := []struct {
+		name     string
+		err      error
+		expected error
+	}{
+		{"No rows", sql.ErrNoRows, ErrNotFound},
+		{"Wrapped no rows", fmt.Errorf("scan: %w", sql.ErrNoRows), ErrNotFound},
+		{"pq duplicate phone", &pq.Error{Code: uniqueViolationCode, Constraint: "user_phone_key"}, ErrDuplicatePhone},
+		{"pq duplicate email", &pq.Error{Code: uniqueViolationCode, Constraint: "user_email_key"}, ErrDuplicateEmail},
+		{"pq other unique", &pq.Error{Code: uniqueViolationCode, Constraint: "organization_member_pkey"}, ErrConflict},
+		{"pgx duplicate phone", &pgconn.PgError{Code: uniqueViolationCode, ConstraintName: "user_phone_key"}, ErrDuplicatePhone},
+		{"pgx duplicate email", &pgconn.PgError{Code: uniqueViolationCode, ConstraintName: "user_email_key"}, ErrDuplicateEmail},
+		{"pgx other unique", &pgconn.PgError{Code: uniqueViolationCode, ConstraintName: "oauth_client_pkey"}, ErrConflict},
+		{"Other error", other, other},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.ErrorIs(t, driverError(testCase.err), testCase.expected)
+		})
+	}
+
+	// Other constraint violations are returned as is
+	checkErr := &pq.Error{Code: "23514", Constraint: "user_phone_check"}
+	assert.Equal(t, error(checkErr), driverError(checkErr))
+}
@@ -4,12 +4,64 @@
 // interfaces using mockgen. See the Makefile for more information.
 package repository
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type RepositoryInterface interface {
 	GetTestById(ctx context.Context, input GetTestByIdInput) (output GetTestByIdOutput, err error)
 	Registration(ctx context.Context, input RegistrationInput) (output RegistrationOutput, err error)
+	CreateUsers(ctx context.Context, inputs []RegistrationInput) (err error)
+	FindRegisteredPhones(ctx context.Context, phones []string) (registered []string, err error)
 	FindUser(ctx context.Context, params ...Param) (user User, err error)
+	FindVerifiedEmailUser(ctx context.Context, email string) (user User, err error)
+	ListUsers(ctx context.Context, params []Param, offset int, limit int) (users []User, total int, err error)
+	ProvisionUser(ctx context.Context, user User) (err error)
+	DeleteUser(ctx context.Context, id string) (err error)
+	FindTenantUserIDs(ctx context.Context, tenant string, ids []string) (found []string, err error)
+	ExportUsers(ctx context.Context, filter ExportFilter) (users []ExportUser, err error)
 	IncreaseLoginAttempt(ctx context.Context, phone string) (err error)
 	UpdateUser(ctx context.Context, user UpdateUser) (err error)
+	PatchUser(ctx context.Context, input PatchUser) (err error)
+	SyncUser(ctx context.Context, input SyncUser) (err error)
+	FindSyncMutations(ctx context.Context, userID string, ids []string) (mutations []SyncMutation, err error)
+	FindAttributeSchema(ctx context.Context, tenant string) (schema []byte, err error)
+	UpdateAvatarKey(ctx context.Context, id string, avatarKey string) (err error)
+	VerifyEmail(ctx context.Context, id string, email string) (err error)
+	UpdateOTPLogin(ctx context.Context, id string, enabled bool) (err error)
+	CountLoginOTP(ctx context.Context, phone string, since time.Time) (count int, err error)
+	CreateLoginOTP(ctx context.Context, otp LoginOTP) (err error)
+	FindLoginOTP(ctx context.Context, phone string) (otp LoginOTP, err error)
+	IncreaseLoginOTPAttempt(ctx context.Context, id int64, max int) (err error)
+	UseLoginOTP(ctx context.Context, id int64) (err error)
+	CreatePersonalAccessToken(ctx context.Context, token PersonalAccessToken) (err error)
+	ListPersonalAccessTokens(ctx context.Context, userID string) (tokens []PersonalAccessToken, err error)
+	FindPersonalAccessToken(ctx context.Context, tokenHash string) (token PersonalAccessToken, err error)
+	RevokePersonalAccessToken(ctx context.Context, userID string, id string) (err error)
+	TouchPersonalAccessToken(ctx context.Context, id string) (err error)
+	CreateOAuthClient(ctx context.Context, client OAuthClient) (err error)
+	ListOAuthClients(ctx context.Context) (clients []OAuthClient, err error)
+	FindOAuthClient(ctx context.Context, id string) (client OAuthClient, err error)
+	RevokeOAuthClient(ctx context.Context, id string) (err error)
+	CreateAuthorizationCode(ctx context.Context, code AuthorizationCode) (err error)
+	UseAuthorizationCode(ctx context.Context, codeHash string) (code AuthorizationCode, err error)
+	CreateOrganization(ctx context.Context, organization Organization, ownerID string) (err error)
+	FindOrganization(ctx context.Context, params ...Param) (organization Organization, err error)
+	ListOrganizations(ctx context.Context, params []Param, offset int, limit int) (organizations []Organization, total int, err error)
+	UpdateOrganization(ctx context.Context, organization Organization) (err error)
+	DeleteOrganization(ctx context.Context, id string) (err error)
+	ListUserMemberships(ctx context.Context, userID string) (memberships []Membership, err error)
+	FindMembership(ctx context.Context, organizationID string, userID string) (membership Membership, err error)
+	ListOrganizationMembers(ctx context.Context, organizationID string) (members []Membership, err error)
+	AddMember(ctx context.Context, organizationID string, userID string, role string) (err error)
+	UpdateMemberRole(ctx context.Context, organizationID string, userID string, role string) (err error)
+	RemoveMember(ctx context.Context, organizationID string, userID string) (err error)
+	ChangeMembers(ctx context.Context, organizationID string, add []string, remove []string) (err error)
+	CreateInvitation(ctx context.Context, invitation Invitation) (err error)
+	ListInvitations(ctx context.Context, organizationID string) (invitations []Invitation, err error)
+	FindInvitation(ctx context.Context, tokenHash string) (invitation Invitation, err error)
+	RevokeInvitation(ctx context.Context, organizationID string, id string) (err error)
+	AcceptInvitation(ctx context.Context, id string, userID string) (err error)
+	RegisterInvitedUser(ctx context.Context, id string, input RegistrationInput) (err error)
 }
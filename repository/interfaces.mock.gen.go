@@ -7,6 +7,7 @@ package repository
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -34,6 +35,359 @@ func (m *MockRepositoryInterface) EXPECT() *MockRepositoryInterfaceMockRecorder
 	return m.recorder
 }
 
+// AcceptInvitation mocks base method.
+func (m *MockRepositoryInterface) AcceptInvitation(ctx context.Context, id, userID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AcceptInvitation", ctx, id, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AcceptInvitation indicates an expected call of AcceptInvitation.
+func (mr *MockRepositoryInterfaceMockRecorder) AcceptInvitation(ctx, id, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcceptInvitation", reflect.TypeOf((*MockRepositoryInterface)(nil).AcceptInvitation), ctx, id, userID)
+}
+
+// AddMember mocks base method.
+func (m *MockRepositoryInterface) AddMember(ctx context.Context, organizationID, userID, role string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddMember", ctx, organizationID, userID, role)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddMember indicates an expected call of AddMember.
+func (mr *MockRepositoryInterfaceMockRecorder) AddMember(ctx, organizationID, userID, role interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddMember", reflect.TypeOf((*MockRepositoryInterface)(nil).AddMember), ctx, organizationID, userID, role)
+}
+
+// ChangeMembers mocks base method.
+func (m *MockRepositoryInterface) ChangeMembers(ctx context.Context, organizationID string, add, remove []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChangeMembers", ctx, organizationID, add, remove)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ChangeMembers indicates an expected call of ChangeMembers.
+func (mr *MockRepositoryInterfaceMockRecorder) ChangeMembers(ctx, organizationID, add, remove interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangeMembers", reflect.TypeOf((*MockRepositoryInterface)(nil).ChangeMembers), ctx, organizationID, add, remove)
+}
+
+// CountLoginOTP mocks base method.
+func (m *MockRepositoryInterface) CountLoginOTP(ctx context.Context, phone string, since time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountLoginOTP", ctx, phone, since)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountLoginOTP indicates an expected call of CountLoginOTP.
+func (mr *MockRepositoryInterfaceMockRecorder) CountLoginOTP(ctx, phone, since interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountLoginOTP", reflect.TypeOf((*MockRepositoryInterface)(nil).CountLoginOTP), ctx, phone, since)
+}
+
+// CreateAuthorizationCode mocks base method.
+func (m *MockRepositoryInterface) CreateAuthorizationCode(ctx context.Context, code AuthorizationCode) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAuthorizationCode", ctx, code)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateAuthorizationCode indicates an expected call of CreateAuthorizationCode.
+func (mr *MockRepositoryInterfaceMockRecorder) CreateAuthorizationCode(ctx, code interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAuthorizationCode", reflect.TypeOf((*MockRepositoryInterface)(nil).CreateAuthorizationCode), ctx, code)
+}
+
+// CreateInvitation mocks base method.
+func (m *MockRepositoryInterface) CreateInvitation(ctx context.Context, invitation Invitation) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateInvitation", ctx, invitation)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateInvitation indicates an expected call of CreateInvitation.
+func (mr *MockRepositoryInterfaceMockRecorder) CreateInvitation(ctx, invitation interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateInvitation", reflect.TypeOf((*MockRepositoryInterface)(nil).CreateInvitation), ctx, invitation)
+}
+
+// CreateLoginOTP mocks base method.
+func (m *MockRepositoryInterface) CreateLoginOTP(ctx context.Context, otp LoginOTP) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateLoginOTP", ctx, otp)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateLoginOTP indicates an expected call of CreateLoginOTP.
+func (mr *MockRepositoryInterfaceMockRecorder) CreateLoginOTP(ctx, otp interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateLoginOTP", reflect.TypeOf((*MockRepositoryInterface)(nil).CreateLoginOTP), ctx, otp)
+}
+
+// CreateOAuthClient mocks base method.
+func (m *MockRepositoryInterface) CreateOAuthClient(ctx context.Context, client OAuthClient) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateOAuthClient", ctx, client)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateOAuthClient indicates an expected call of CreateOAuthClient.
+func (mr *MockRepositoryInterfaceMockRecorder) CreateOAuthClient(ctx, client interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOAuthClient", reflect.TypeOf((*MockRepositoryInterface)(nil).CreateOAuthClient), ctx, client)
+}
+
+// CreateOrganization mocks base method.
+func (m *MockRepositoryInterface) CreateOrganization(ctx context.Context, organization Organization, ownerID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateOrganization", ctx, organization, ownerID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateOrganization indicates an expected call of CreateOrganization.
+func (mr *MockRepositoryInterfaceMockRecorder) CreateOrganization(ctx, organization, ownerID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOrganization", reflect.TypeOf((*MockRepositoryInterface)(nil).CreateOrganization), ctx, organization, ownerID)
+}
+
+// CreatePersonalAccessToken mocks base method.
+func (m *MockRepositoryInterface) CreatePersonalAccessToken(ctx context.Context, token PersonalAccessToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePersonalAccessToken", ctx, token)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreatePersonalAccessToken indicates an expected call of CreatePersonalAccessToken.
+func (mr *MockRepositoryInterfaceMockRecorder) CreatePersonalAccessToken(ctx, token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePersonalAccessToken", reflect.TypeOf((*MockRepositoryInterface)(nil).CreatePersonalAccessToken), ctx, token)
+}
+
+// CreateUsers mocks base method.
+func (m *MockRepositoryInterface) CreateUsers(ctx context.Context, inputs []RegistrationInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateUsers", ctx, inputs)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateUsers indicates an expected call of CreateUsers.
+func (mr *MockRepositoryInterfaceMockRecorder) CreateUsers(ctx, inputs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUsers", reflect.TypeOf((*MockRepositoryInterface)(nil).CreateUsers), ctx, inputs)
+}
+
+// DeleteOrganization mocks base method.
+func (m *MockRepositoryInterface) DeleteOrganization(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteOrganization", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteOrganization indicates an expected call of DeleteOrganization.
+func (mr *MockRepositoryInterfaceMockRecorder) DeleteOrganization(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteOrganization", reflect.TypeOf((*MockRepositoryInterface)(nil).DeleteOrganization), ctx, id)
+}
+
+// DeleteUser mocks base method.
+func (m *MockRepositoryInterface) DeleteUser(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUser", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUser indicates an expected call of DeleteUser.
+func (mr *MockRepositoryInterfaceMockRecorder) DeleteUser(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockRepositoryInterface)(nil).DeleteUser), ctx, id)
+}
+
+// ExportUsers mocks base method.
+func (m *MockRepositoryInterface) ExportUsers(ctx context.Context, filter ExportFilter) ([]ExportUser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportUsers", ctx, filter)
+	ret0, _ := ret[0].([]ExportUser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExportUsers indicates an expected call of ExportUsers.
+func (mr *MockRepositoryInterfaceMockRecorder) ExportUsers(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportUsers", reflect.TypeOf((*MockRepositoryInterface)(nil).ExportUsers), ctx, filter)
+}
+
+// FindAttributeSchema mocks base method.
+func (m *MockRepositoryInterface) FindAttributeSchema(ctx context.Context, tenant string) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindAttributeSchema", ctx, tenant)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindAttributeSchema indicates an expected call of FindAttributeSchema.
+func (mr *MockRepositoryInterfaceMockRecorder) FindAttributeSchema(ctx, tenant interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindAttributeSchema", reflect.TypeOf((*MockRepositoryInterface)(nil).FindAttributeSchema), ctx, tenant)
+}
+
+// FindInvitation mocks base method.
+func (m *MockRepositoryInterface) FindInvitation(ctx context.Context, tokenHash string) (Invitation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindInvitation", ctx, tokenHash)
+	ret0, _ := ret[0].(Invitation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindInvitation indicates an expected call of FindInvitation.
+func (mr *MockRepositoryInterfaceMockRecorder) FindInvitation(ctx, tokenHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindInvitation", reflect.TypeOf((*MockRepositoryInterface)(nil).FindInvitation), ctx, tokenHash)
+}
+
+// FindLoginOTP mocks base method.
+func (m *MockRepositoryInterface) FindLoginOTP(ctx context.Context, phone string) (LoginOTP, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindLoginOTP", ctx, phone)
+	ret0, _ := ret[0].(LoginOTP)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindLoginOTP indicates an expected call of FindLoginOTP.
+func (mr *MockRepositoryInterfaceMockRecorder) FindLoginOTP(ctx, phone interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindLoginOTP", reflect.TypeOf((*MockRepositoryInterface)(nil).FindLoginOTP), ctx, phone)
+}
+
+// FindMembership mocks base method.
+func (m *MockRepositoryInterface) FindMembership(ctx context.Context, organizationID, userID string) (Membership, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindMembership", ctx, organizationID, userID)
+	ret0, _ := ret[0].(Membership)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindMembership indicates an expected call of FindMembership.
+func (mr *MockRepositoryInterfaceMockRecorder) FindMembership(ctx, organizationID, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindMembership", reflect.TypeOf((*MockRepositoryInterface)(nil).FindMembership), ctx, organizationID, userID)
+}
+
+// FindOAuthClient mocks base method.
+func (m *MockRepositoryInterface) FindOAuthClient(ctx context.Context, id string) (OAuthClient, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindOAuthClient", ctx, id)
+	ret0, _ := ret[0].(OAuthClient)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindOAuthClient indicates an expected call of FindOAuthClient.
+func (mr *MockRepositoryInterfaceMockRecorder) FindOAuthClient(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindOAuthClient", reflect.TypeOf((*MockRepositoryInterface)(nil).FindOAuthClient), ctx, id)
+}
+
+// FindOrganization mocks base method.
+func (m *MockRepositoryInterface) FindOrganization(ctx context.Context, params ...Param) (Organization, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx}
+	for _, a := range params {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "FindOrganization", varargs...)
+	ret0, _ := ret[0].(Organization)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindOrganization indicates an expected call of FindOrganization.
+func (mr *MockRepositoryInterfaceMockRecorder) FindOrganization(ctx interface{}, params ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx}, params...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindOrganization", reflect.TypeOf((*MockRepositoryInterface)(nil).FindOrganization), varargs...)
+}
+
+// FindPersonalAccessToken mocks base method.
+func (m *MockRepositoryInterface) FindPersonalAccessToken(ctx context.Context, tokenHash string) (PersonalAccessToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindPersonalAccessToken", ctx, tokenHash)
+	ret0, _ := ret[0].(PersonalAccessToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindPersonalAccessToken indicates an expected call of FindPersonalAccessToken.
+func (mr *MockRepositoryInterfaceMockRecorder) FindPersonalAccessToken(ctx, tokenHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindPersonalAccessToken", reflect.TypeOf((*MockRepositoryInterface)(nil).FindPersonalAccessToken), ctx, tokenHash)
+}
+
+// FindRegisteredPhones mocks base method.
+func (m *MockRepositoryInterface) FindRegisteredPhones(ctx context.Context, phones []string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindRegisteredPhones", ctx, phones)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindRegisteredPhones indicates an expected call of FindRegisteredPhones.
+func (mr *MockRepositoryInterfaceMockRecorder) FindRegisteredPhones(ctx, phones interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindRegisteredPhones", reflect.TypeOf((*MockRepositoryInterface)(nil).FindRegisteredPhones), ctx, phones)
+}
+
+// FindSyncMutations mocks base method.
+func (m *MockRepositoryInterface) FindSyncMutations(ctx context.Context, userID string, ids []string) ([]SyncMutation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindSyncMutations", ctx, userID, ids)
+	ret0, _ := ret[0].([]SyncMutation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindSyncMutations indicates an expected call of FindSyncMutations.
+func (mr *MockRepositoryInterfaceMockRecorder) FindSyncMutations(ctx, userID, ids interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindSyncMutations", reflect.TypeOf((*MockRepositoryInterface)(nil).FindSyncMutations), ctx, userID, ids)
+}
+
+// FindTenantUserIDs mocks base method.
+func (m *MockRepositoryInterface) FindTenantUserIDs(ctx context.Context, tenant string, ids []string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindTenantUserIDs", ctx, tenant, ids)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindTenantUserIDs indicates an expected call of FindTenantUserIDs.
+func (mr *MockRepositoryInterfaceMockRecorder) FindTenantUserIDs(ctx, tenant, ids interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindTenantUserIDs", reflect.TypeOf((*MockRepositoryInterface)(nil).FindTenantUserIDs), ctx, tenant, ids)
+}
+
 // FindUser mocks base method.
 func (m *MockRepositoryInterface) FindUser(ctx context.Context, params ...Param) (User, error) {
 	m.ctrl.T.Helper()
@@ -54,6 +408,21 @@ func (mr *MockRepositoryInterfaceMockRecorder) FindUser(ctx interface{}, params
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindUser", reflect.TypeOf((*MockRepositoryInterface)(nil).FindUser), varargs...)
 }
 
+// FindVerifiedEmailUser mocks base method.
+func (m *MockRepositoryInterface) FindVerifiedEmailUser(ctx context.Context, email string) (User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindVerifiedEmailUser", ctx, email)
+	ret0, _ := ret[0].(User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindVerifiedEmailUser indicates an expected call of FindVerifiedEmailUser.
+func (mr *MockRepositoryInterfaceMockRecorder) FindVerifiedEmailUser(ctx, email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindVerifiedEmailUser", reflect.TypeOf((*MockRepositoryInterface)(nil).FindVerifiedEmailUser), ctx, email)
+}
+
 // GetTestById mocks base method.
 func (m *MockRepositoryInterface) GetTestById(ctx context.Context, input GetTestByIdInput) (GetTestByIdOutput, error) {
 	m.ctrl.T.Helper()
@@ -83,6 +452,169 @@ func (mr *MockRepositoryInterfaceMockRecorder) IncreaseLoginAttempt(ctx, phone i
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncreaseLoginAttempt", reflect.TypeOf((*MockRepositoryInterface)(nil).IncreaseLoginAttempt), ctx, phone)
 }
 
+// IncreaseLoginOTPAttempt mocks base method.
+func (m *MockRepositoryInterface) IncreaseLoginOTPAttempt(ctx context.Context, id int64, max int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncreaseLoginOTPAttempt", ctx, id, max)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// IncreaseLoginOTPAttempt indicates an expected call of IncreaseLoginOTPAttempt.
+func (mr *MockRepositoryInterfaceMockRecorder) IncreaseLoginOTPAttempt(ctx, id, max interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncreaseLoginOTPAttempt", reflect.TypeOf((*MockRepositoryInterface)(nil).IncreaseLoginOTPAttempt), ctx, id, max)
+}
+
+// ListInvitations mocks base method.
+func (m *MockRepositoryInterface) ListInvitations(ctx context.Context, organizationID string) ([]Invitation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListInvitations", ctx, organizationID)
+	ret0, _ := ret[0].([]Invitation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListInvitations indicates an expected call of ListInvitations.
+func (mr *MockRepositoryInterfaceMockRecorder) ListInvitations(ctx, organizationID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListInvitations", reflect.TypeOf((*MockRepositoryInterface)(nil).ListInvitations), ctx, organizationID)
+}
+
+// ListOAuthClients mocks base method.
+func (m *MockRepositoryInterface) ListOAuthClients(ctx context.Context) ([]OAuthClient, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListOAuthClients", ctx)
+	ret0, _ := ret[0].([]OAuthClient)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListOAuthClients indicates an expected call of ListOAuthClients.
+func (mr *MockRepositoryInterfaceMockRecorder) ListOAuthClients(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListOAuthClients", reflect.TypeOf((*MockRepositoryInterface)(nil).ListOAuthClients), ctx)
+}
+
+// ListOrganizationMembers mocks base method.
+func (m *MockRepositoryInterface) ListOrganizationMembers(ctx context.Context, organizationID string) ([]Membership, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListOrganizationMembers", ctx, organizationID)
+	ret0, _ := ret[0].([]Membership)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListOrganizationMembers indicates an expected call of ListOrganizationMembers.
+func (mr *MockRepositoryInterfaceMockRecorder) ListOrganizationMembers(ctx, organizationID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListOrganizationMembers", reflect.TypeOf((*MockRepositoryInterface)(nil).ListOrganizationMembers), ctx, organizationID)
+}
+
+// ListOrganizations mocks base method.
+func (m *MockRepositoryInterface) ListOrganizations(ctx context.Context, params []Param, offset, limit int) ([]Organization, int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListOrganizations", ctx, params, offset, limit)
+	ret0, _ := ret[0].([]Organization)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ListOrganizations indicates an expected call of ListOrganizations.
+func (mr *MockRepositoryInterfaceMockRecorder) ListOrganizations(ctx, params, offset, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListOrganizations", reflect.TypeOf((*MockRepositoryInterface)(nil).ListOrganizations), ctx, params, offset, limit)
+}
+
+// ListPersonalAccessTokens mocks base method.
+func (m *MockRepositoryInterface) ListPersonalAccessTokens(ctx context.Context, userID string) ([]PersonalAccessToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListPersonalAccessTokens", ctx, userID)
+	ret0, _ := ret[0].([]PersonalAccessToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListPersonalAccessTokens indicates an expected call of ListPersonalAccessTokens.
+func (mr *MockRepositoryInterfaceMockRecorder) ListPersonalAccessTokens(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListPersonalAccessTokens", reflect.TypeOf((*MockRepositoryInterface)(nil).ListPersonalAccessTokens), ctx, userID)
+}
+
+// ListUserMemberships mocks base method.
+func (m *MockRepositoryInterface) ListUserMemberships(ctx context.Context, userID string) ([]Membership, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUserMemberships", ctx, userID)
+	ret0, _ := ret[0].([]Membership)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUserMemberships indicates an expected call of ListUserMemberships.
+func (mr *MockRepositoryInterfaceMockRecorder) ListUserMemberships(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUserMemberships", reflect.TypeOf((*MockRepositoryInterface)(nil).ListUserMemberships), ctx, userID)
+}
+
+// ListUsers mocks base method.
+func (m *MockRepositoryInterface) ListUsers(ctx context.Context, params []Param, offset, limit int) ([]User, int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUsers", ctx, params, offset, limit)
+	ret0, _ := ret[0].([]User)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ListUsers indicates an expected call of ListUsers.
+func (mr *MockRepositoryInterfaceMockRecorder) ListUsers(ctx, params, offset, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUsers", reflect.TypeOf((*MockRepositoryInterface)(nil).ListUsers), ctx, params, offset, limit)
+}
+
+// PatchUser mocks base method.
+func (m *MockRepositoryInterface) PatchUser(ctx context.Context, input PatchUser) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PatchUser", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PatchUser indicates an expected call of PatchUser.
+func (mr *MockRepositoryInterfaceMockRecorder) PatchUser(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PatchUser", reflect.TypeOf((*MockRepositoryInterface)(nil).PatchUser), ctx, input)
+}
+
+// ProvisionUser mocks base method.
+func (m *MockRepositoryInterface) ProvisionUser(ctx context.Context, user User) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ProvisionUser", ctx, user)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ProvisionUser indicates an expected call of ProvisionUser.
+func (mr *MockRepositoryInterfaceMockRecorder) ProvisionUser(ctx, user interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProvisionUser", reflect.TypeOf((*MockRepositoryInterface)(nil).ProvisionUser), ctx, user)
+}
+
+// RegisterInvitedUser mocks base method.
+func (m *MockRepositoryInterface) RegisterInvitedUser(ctx context.Context, id string, input RegistrationInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RegisterInvitedUser", ctx, id, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RegisterInvitedUser indicates an expected call of RegisterInvitedUser.
+func (mr *MockRepositoryInterfaceMockRecorder) RegisterInvitedUser(ctx, id, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterInvitedUser", reflect.TypeOf((*MockRepositoryInterface)(nil).RegisterInvitedUser), ctx, id, input)
+}
+
 // Registration mocks base method.
 func (m *MockRepositoryInterface) Registration(ctx context.Context, input RegistrationInput) (RegistrationOutput, error) {
 	m.ctrl.T.Helper()
@@ -98,6 +630,146 @@ func (mr *MockRepositoryInterfaceMockRecorder) Registration(ctx, input interface
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Registration", reflect.TypeOf((*MockRepositoryInterface)(nil).Registration), ctx, input)
 }
 
+// RemoveMember mocks base method.
+func (m *MockRepositoryInterface) RemoveMember(ctx context.Context, organizationID, userID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveMember", ctx, organizationID, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveMember indicates an expected call of RemoveMember.
+func (mr *MockRepositoryInterfaceMockRecorder) RemoveMember(ctx, organizationID, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveMember", reflect.TypeOf((*MockRepositoryInterface)(nil).RemoveMember), ctx, organizationID, userID)
+}
+
+// RevokeInvitation mocks base method.
+func (m *MockRepositoryInterface) RevokeInvitation(ctx context.Context, organizationID, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeInvitation", ctx, organizationID, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeInvitation indicates an expected call of RevokeInvitation.
+func (mr *MockRepositoryInterfaceMockRecorder) RevokeInvitation(ctx, organizationID, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeInvitation", reflect.TypeOf((*MockRepositoryInterface)(nil).RevokeInvitation), ctx, organizationID, id)
+}
+
+// RevokeOAuthClient mocks base method.
+func (m *MockRepositoryInterface) RevokeOAuthClient(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeOAuthClient", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeOAuthClient indicates an expected call of RevokeOAuthClient.
+func (mr *MockRepositoryInterfaceMockRecorder) RevokeOAuthClient(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeOAuthClient", reflect.TypeOf((*MockRepositoryInterface)(nil).RevokeOAuthClient), ctx, id)
+}
+
+// RevokePersonalAccessToken mocks base method.
+func (m *MockRepositoryInterface) RevokePersonalAccessToken(ctx context.Context, userID, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokePersonalAccessToken", ctx, userID, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokePersonalAccessToken indicates an expected call of RevokePersonalAccessToken.
+func (mr *MockRepositoryInterfaceMockRecorder) RevokePersonalAccessToken(ctx, userID, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokePersonalAccessToken", reflect.TypeOf((*MockRepositoryInterface)(nil).RevokePersonalAccessToken), ctx, userID, id)
+}
+
+// SyncUser mocks base method.
+func (m *MockRepositoryInterface) SyncUser(ctx context.Context, input SyncUser) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SyncUser", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SyncUser indicates an expected call of SyncUser.
+func (mr *MockRepositoryInterfaceMockRecorder) SyncUser(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SyncUser", reflect.TypeOf((*MockRepositoryInterface)(nil).SyncUser), ctx, input)
+}
+
+// TouchPersonalAccessToken mocks base method.
+func (m *MockRepositoryInterface) TouchPersonalAccessToken(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TouchPersonalAccessToken", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TouchPersonalAccessToken indicates an expected call of TouchPersonalAccessToken.
+func (mr *MockRepositoryInterfaceMockRecorder) TouchPersonalAccessToken(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TouchPersonalAccessToken", reflect.TypeOf((*MockRepositoryInterface)(nil).TouchPersonalAccessToken), ctx, id)
+}
+
+// UpdateAvatarKey mocks base method.
+func (m *MockRepositoryInterface) UpdateAvatarKey(ctx context.Context, id, avatarKey string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateAvatarKey", ctx, id, avatarKey)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateAvatarKey indicates an expected call of UpdateAvatarKey.
+func (mr *MockRepositoryInterfaceMockRecorder) UpdateAvatarKey(ctx, id, avatarKey interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateAvatarKey", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdateAvatarKey), ctx, id, avatarKey)
+}
+
+// UpdateMemberRole mocks base method.
+func (m *MockRepositoryInterface) UpdateMemberRole(ctx context.Context, organizationID, userID, role string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateMemberRole", ctx, organizationID, userID, role)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateMemberRole indicates an expected call of UpdateMemberRole.
+func (mr *MockRepositoryInterfaceMockRecorder) UpdateMemberRole(ctx, organizationID, userID, role interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateMemberRole", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdateMemberRole), ctx, organizationID, userID, role)
+}
+
+// UpdateOTPLogin mocks base method.
+func (m *MockRepositoryInterface) UpdateOTPLogin(ctx context.Context, id string, enabled bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateOTPLogin", ctx, id, enabled)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateOTPLogin indicates an expected call of UpdateOTPLogin.
+func (mr *MockRepositoryInterfaceMockRecorder) UpdateOTPLogin(ctx, id, enabled interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOTPLogin", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdateOTPLogin), ctx, id, enabled)
+}
+
+// UpdateOrganization mocks base method.
+func (m *MockRepositoryInterface) UpdateOrganization(ctx context.Context, organization Organization) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateOrganization", ctx, organization)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateOrganization indicates an expected call of UpdateOrganization.
+func (mr *MockRepositoryInterfaceMockRecorder) UpdateOrganization(ctx, organization interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOrganization", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdateOrganization), ctx, organization)
+}
+
 // UpdateUser mocks base method.
 func (m *MockRepositoryInterface) UpdateUser(ctx context.Context, user UpdateUser) error {
 	m.ctrl.T.Helper()
@@ -111,3 +783,46 @@ func (mr *MockRepositoryInterfaceMockRecorder) UpdateUser(ctx, user interface{})
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUser", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdateUser), ctx, user)
 }
+
+// UseAuthorizationCode mocks base method.
+func (m *MockRepositoryInterface) UseAuthorizationCode(ctx context.Context, codeHash string) (AuthorizationCode, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseAuthorizationCode", ctx, codeHash)
+	ret0, _ := ret[0].(AuthorizationCode)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseAuthorizationCode indicates an expected call of UseAuthorizationCode.
+func (mr *MockRepositoryInterfaceMockRecorder) UseAuthorizationCode(ctx, codeHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseAuthorizationCode", reflect.TypeOf((*MockRepositoryInterface)(nil).UseAuthorizationCode), ctx, codeHash)
+}
+
+// UseLoginOTP mocks base method.
+func (m *MockRepositoryInterface) UseLoginOTP(ctx context.Context, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseLoginOTP", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseLoginOTP indicates an expected call of UseLoginOTP.
+func (mr *MockRepositoryInterfaceMockRecorder) UseLoginOTP(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseLoginOTP", reflect.TypeOf((*MockRepositoryInterface)(nil).UseLoginOTP), ctx, id)
+}
+
+// VerifyEmail mocks base method.
+func (m *MockRepositoryInterface) VerifyEmail(ctx context.Context, id, email string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyEmail", ctx, id, email)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// VerifyEmail indicates an expected call of VerifyEmail.
+func (mr *MockRepositoryInterfaceMockRecorder) VerifyEmail(ctx, id, email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyEmail", reflect.TypeOf((*MockRepositoryInterface)(nil).VerifyEmail), ctx, id, email)
+}
@@ -0,0 +1,1863 @@
+// This file contains the in memory implementation of the repository layer, data is not shared between instances
+// and is lost on restart. It reproduces the constraints of database.sql so tests exercise the same behavior as Postgres.
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type MemoryRepository struct {
+	mu sync.RWMutex
+	// seq order rows created within the same microsecond, Postgres orders them by their timestamp only
+	seq int64
+	// changeSeq is the last change sequence of users, see User.ChangeSeq
+	changeSeq int64
+
+	tests                map[string]string
+	users                map[string]*memoryUser
+	attributeSchemas     map[string][]byte
+	loginOTPs            []*memoryLoginOTP
+	personalAccessTokens map[string]*memoryPersonalAccessToken
+	oauthClients         map[string]*memoryOAuthClient
+	authorizationCodes   map[string]*memoryAuthorizationCode
+	organizations        map[string]*memoryOrganization
+	members              map[memberKey]*memoryMember
+	invitations          map[string]*memoryInvitation
+	syncMutations        map[syncMutationKey]*memorySyncMutation
+}
+
+type memoryUser struct {
+	User
+	// attributes is the JSON object as stored, so readers get their own copy
+	attributes   []byte
+	successLogin int
+}
+
+type memoryLoginOTP struct {
+	LoginOTP
+	usedAt    *time.Time
+	createdAt time.Time
+	seq       int64
+}
+
+type memoryPersonalAccessToken struct {
+	PersonalAccessToken
+	revokedAt *time.Time
+	seq       int64
+}
+
+type memoryOAuthClient struct {
+	OAuthClient
+	revokedAt *time.Time
+	seq       int64
+}
+
+type memoryAuthorizationCode struct {
+	AuthorizationCode
+	usedAt *time.Time
+}
+
+type memoryOrganization struct {
+	Organization
+}
+
+type memberKey struct {
+	organizationID string
+	userID         string
+}
+
+type memoryMember struct {
+	role      string
+	createdAt time.Time
+}
+
+type memoryInvitation struct {
+	Invitation
+	seq int64
+}
+
+type syncMutationKey struct {
+	userID string
+	id     string
+}
+
+type memorySyncMutation struct {
+	SyncMutation
+	seq int64
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		// Same rows as the test table seeded by database.sql
+		tests:                map[string]string{"1": "test1", "2": "test2"},
+		users:                map[string]*memoryUser{},
+		attributeSchemas:     map[string][]byte{},
+		personalAccessTokens: map[string]*memoryPersonalAccessToken{},
+		oauthClients:         map[string]*memoryOAuthClient{},
+		authorizationCodes:   map[string]*memoryAuthorizationCode{},
+		organizations:        map[string]*memoryOrganization{},
+		members:              map[memberKey]*memoryMember{},
+		invitations:          map[string]*memoryInvitation{},
+		syncMutations:        map[syncMutationKey]*memorySyncMutation{},
+	}
+}
+
+// SetAttributeSchema : Store JSON Schema of custom attributes for the tenant, Postgres schemas are managed with SQL
+func (r *MemoryRepository) SetAttributeSchema(tenant string, schema []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.attributeSchemas[tenant] = append([]byte(nil), schema...)
+}
+
+// nextSeq : insertion order of a new row, must be called with the write lock held
+func (r *MemoryRepository) nextSeq() int64 {
+	r.seq++
+	return r.seq
+}
+
+// nextChangeSeq : next value of public.user_change_seq, must be called with the write lock held
+func (r *MemoryRepository) nextChangeSeq() int64 {
+	r.changeSeq++
+	return r.changeSeq
+}
+
+func (r *MemoryRepository) GetTestById(ctx context.Context, input GetTestByIdInput) (output GetTestByIdOutput, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	name, exist := r.tests[input.Id]
+	if !exist {
+		return output, ErrNotFound
+	}
+	return GetTestByIdOutput{Name: name}, nil
+}
+
+// Registration : Register new user, ErrDuplicatePhone when the phone number is already registered
+func (r *MemoryRepository) Registration(ctx context.Context, input RegistrationInput) (output RegistrationOutput, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err = r.insertUser(registrationUser(input))
+	if err != nil {
+		return
+	}
+	return RegistrationOutput{ID: input.ID}, nil
+}
+
+// registrationUser : new user of the registration, the other columns have their default
+func registrationUser(input RegistrationInput) User {
+	return User{
+		ID:              input.ID,
+		Phone:           input.Phone,
+		Name:            input.Name,
+		Password:        input.Password,
+		Salt:            input.Salt,
+		PhoneVerifiedAt: input.PhoneVerifiedAt,
+		OTPLoginEnabled: input.OTPLoginEnabled,
+	}
+}
+
+// CreateUsers : Register users at once, none of them are registered when one fails, e.g. with ErrDuplicatePhone
+func (r *MemoryRepository) CreateUsers(ctx context.Context, inputs []RegistrationInput) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var created []string
+	for _, input := range inputs {
+		err = r.insertUser(registrationUser(input))
+		if err != nil {
+			for _, id := range created {
+				delete(r.users, id)
+			}
+			return
+		}
+		created = append(created, input.ID)
+	}
+	return
+}
+
+// insertUser : store new user with the column defaults and unique constraints of public.user, must be called with the write lock held
+func (r *MemoryRepository) insertUser(user User) error {
+	if _, exist := r.users[user.ID]; exist {
+		return ErrConflict
+	}
+	if err := r.checkUniqueUser(user.ID, user.Phone, verifiedEmail(user.Email, user.EmailVerifiedAt)); err != nil {
+		return err
+	}
+
+	if user.Tenant == "" {
+		user.Tenant = "default"
+	}
+	now := memoryNow()
+	stored := &memoryUser{
+		User: User{
+			ID:                user.ID,
+			Phone:             user.Phone,
+			Name:              user.Name,
+			Password:          user.Password,
+			Salt:              user.Salt,
+			Version:           1,
+			Email:             clone(user.Email),
+			PreferredLanguage: clone(user.PreferredLanguage),
+			Tenant:            user.Tenant,
+			OTPLoginEnabled:   user.OTPLoginEnabled,
+			PhoneVerifiedAt:   storedTime(user.PhoneVerifiedAt),
+			ExternalID:        clone(user.ExternalID),
+			DeactivatedAt:     storedTime(user.DeactivatedAt),
+			CreatedAt:         now,
+			ChangeSeq:         r.nextChangeSeq(),
+		},
+		attributes: []byte("{}"),
+	}
+	r.users[user.ID] = stored
+	return nil
+}
+
+// checkUniqueUser : ErrDuplicatePhone or ErrDuplicateEmail when another user has the phone or verified the email,
+// verifiedEmail is nil unless the email of the user is verified since unverified emails are not unique
+func (r *MemoryRepository) checkUniqueUser(id string, phone string, verifiedEmail *string) error {
+	for _, other := range r.users {
+		if other.ID == id {
+			continue
+		}
+		if other.Phone == phone {
+			return ErrDuplicatePhone
+		}
+		if verifiedEmail != nil && other.EmailVerifiedAt != nil && equalStrings(other.Email, verifiedEmail) {
+			return ErrDuplicateEmail
+		}
+	}
+	return nil
+}
+
+// verifiedEmail : the email when it is verified, see checkUniqueUser
+func verifiedEmail(email *string, verifiedAt *time.Time) *string {
+	if verifiedAt == nil {
+		return nil
+	}
+	return email
+}
+
+// FindRegisteredPhones : Find which of the phone numbers are already registered
+func (r *MemoryRepository) FindRegisteredPhones(ctx context.Context, phones []string) (registered []string, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	wanted := stringSet(phones)
+	for _, user := range r.sortedUsers() {
+		if wanted[user.Phone] {
+			registered = append(registered, user.Phone)
+		}
+	}
+	return
+}
+
+// FindUser : Find user by params, ErrNotFound when no user match
+func (r *MemoryRepository) FindUser(ctx context.Context, params ...Param) (user User, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users, err := r.matchingUsers(params)
+	if err != nil {
+		return
+	}
+	if len(users) == 0 {
+		return user, ErrNotFound
+	}
+	return users[0].user()
+}
+
+// FindVerifiedEmailUser : Find the user that verified the email, verified emails are unique
+func (r *MemoryRepository) FindVerifiedEmailUser(ctx context.Context, email string) (user User, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, stored := range r.users {
+		if stored.Email != nil && *stored.Email == email && stored.EmailVerifiedAt != nil {
+			return stored.user()
+		}
+	}
+	return user, ErrNotFound
+}
+
+// ListUsers : Find a page of users matching the params ordered by registration, total is the number of every matching user
+func (r *MemoryRepository) ListUsers(ctx context.Context, params []Param, offset int, limit int) (users []User, total int, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	matching, err := r.matchingUsers(params)
+	if err != nil {
+		return
+	}
+	total = len(matching)
+
+	for _, stored := range page(matching, offset, limit) {
+		var user User
+		user, err = stored.user()
+		if err != nil {
+			return
+		}
+		users = append(users, user)
+	}
+	return
+}
+
+// matchingUsers : users matching the params ordered by created_at and id
+func (r *MemoryRepository) matchingUsers(params []Param) (users []*memoryUser, err error) {
+	for _, user := range r.sortedUsers() {
+		var match bool
+		match, err = matchParams(params, user.column)
+		if err != nil {
+			return
+		}
+		if match {
+			users = append(users, user)
+		}
+	}
+	return
+}
+
+// sortedUsers : every user ordered by created_at and id
+func (r *MemoryRepository) sortedUsers() []*memoryUser {
+	users := make([]*memoryUser, 0, len(r.users))
+	for _, user := range r.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if !users[i].CreatedAt.Equal(users[j].CreatedAt) {
+			return users[i].CreatedAt.Before(users[j].CreatedAt)
+		}
+		return users[i].ID < users[j].ID
+	})
+	return users
+}
+
+// page : rows of the page like OFFSET and LIMIT do
+func page[T any](rows []T, offset int, limit int) []T {
+	if offset > len(rows) {
+		offset = len(rows)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	end := len(rows)
+	if limit >= 0 && offset+limit < end {
+		end = offset + limit
+	}
+	return rows[offset:end]
+}
+
+// user : copy of the stored user, so callers cannot change the stored one
+func (u *memoryUser) user() (user User, err error) {
+	user = u.User
+	user.Email = clone(u.Email)
+	user.EmailVerifiedAt = clone(u.EmailVerifiedAt)
+	user.PreferredLanguage = clone(u.PreferredLanguage)
+	user.AvatarURL = clone(u.AvatarURL)
+	user.DateOfBirth = clone(u.DateOfBirth)
+	user.Address = clone(u.Address)
+	user.Estate = clone(u.Estate)
+	user.Region = clone(u.Region)
+	user.AvatarKey = clone(u.AvatarKey)
+	user.PhoneVerifiedAt = clone(u.PhoneVerifiedAt)
+	user.ExternalID = clone(u.ExternalID)
+	user.DeactivatedAt = clone(u.DeactivatedAt)
+	user.UpdatedAt = clone(u.UpdatedAt)
+	user.ProfileUpdatedAt = clone(u.ProfileUpdatedAt)
+	user.Attributes = nil
+	err = json.Unmarshal(u.attributes, &user.Attributes)
+	return
+}
+
+// column : value of the column of public.user compared by params, nil for NULL
+func (u *memoryUser) column(name string) (interface{}, error) {
+	switch name {
+	case "id":
+		return u.ID, nil
+	case "phone":
+		return u.Phone, nil
+	case "name":
+		return u.Name, nil
+	case "password":
+		return u.Password, nil
+	case "salt":
+		return u.Salt, nil
+	case "version":
+		return u.Version, nil
+	case "success_login":
+		return u.successLogin, nil
+	case "email":
+		return nullable(u.Email), nil
+	case "email_verified_at":
+		return nullable(u.EmailVerifiedAt), nil
+	case "preferred_language":
+		return nullable(u.PreferredLanguage), nil
+	case "avatar_url":
+		return nullable(u.AvatarURL), nil
+	case "date_of_birth":
+		return nullable(u.DateOfBirth), nil
+	case "address":
+		return nullable(u.Address), nil
+	case "estate":
+		return nullable(u.Estate), nil
+	case "region":
+		return nullable(u.Region), nil
+	case "tenant":
+		return u.Tenant, nil
+	case "avatar_key":
+		return nullable(u.AvatarKey), nil
+	case "otp_login_enabled":
+		return u.OTPLoginEnabled, nil
+	case "phone_verified_at":
+		return nullable(u.PhoneVerifiedAt), nil
+	case "external_id":
+		return nullable(u.ExternalID), nil
+	case "deactivated_at":
+		return nullable(u.DeactivatedAt), nil
+	case "created_at":
+		return u.CreatedAt, nil
+	case "updated_at":
+		return nullable(u.UpdatedAt), nil
+	}
+	return nil, fmt.Errorf("column %s does not exist", name)
+}
+
+// ProvisionUser : Register user provisioned by the identity provider of its tenant, ErrDuplicatePhone or ErrDuplicateEmail when they are used by another user
+func (r *MemoryRepository) ProvisionUser(ctx context.Context, user User) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.insertUser(User{
+		ID:                user.ID,
+		Phone:             user.Phone,
+		Name:              user.Name,
+		Password:          user.Password,
+		Salt:              user.Salt,
+		Email:             user.Email,
+		PreferredLanguage: user.PreferredLanguage,
+		Tenant:            user.Tenant,
+		ExternalID:        user.ExternalID,
+		OTPLoginEnabled:   user.OTPLoginEnabled,
+		DeactivatedAt:     user.DeactivatedAt,
+	})
+}
+
+// DeleteUser : Delete user with everything that belongs to it, ErrNotFound when there is no such user
+func (r *MemoryRepository) DeleteUser(ctx context.Context, id string) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exist := r.users[id]; !exist {
+		return ErrNotFound
+	}
+	delete(r.users, id)
+
+	// Same as the ON DELETE rules of the foreign keys referencing public.user
+	for tokenID, token := range r.personalAccessTokens {
+		if token.UserID == id {
+			delete(r.personalAccessTokens, tokenID)
+		}
+	}
+	for codeHash, code := range r.authorizationCodes {
+		if code.UserID == id {
+			delete(r.authorizationCodes, codeHash)
+		}
+	}
+	for key := range r.members {
+		if key.userID == id {
+			delete(r.members, key)
+		}
+	}
+	for key := range r.syncMutations {
+		if key.userID == id {
+			delete(r.syncMutations, key)
+		}
+	}
+	for _, invitation := range r.invitations {
+		if invitation.InvitedBy == id {
+			invitation.InvitedBy = ""
+		}
+		if invitation.AcceptedBy != nil && *invitation.AcceptedBy == id {
+			invitation.AcceptedBy = nil
+		}
+	}
+	return
+}
+
+// FindTenantUserIDs : Find which of the user ids belong to users of the tenant
+func (r *MemoryRepository) FindTenantUserIDs(ctx context.Context, tenant string, ids []string) (found []string, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	wanted := stringSet(ids)
+	for _, user := range r.sortedUsers() {
+		if user.Tenant == tenant && wanted[user.ID] {
+			found = append(found, user.ID)
+		}
+	}
+	return
+}
+
+// ExportUsers : Find a page of users ordered by id, the next page starts after the id of the last user
+func (r *MemoryRepository) ExportUsers(ctx context.Context, filter ExportFilter) (users []ExportUser, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var matching []*memoryUser
+	for _, user := range r.users {
+		switch {
+		case filter.Tenant != "" && user.Tenant != filter.Tenant,
+			filter.Estate != "" && (user.Estate == nil || *user.Estate != filter.Estate),
+			filter.Region != "" && (user.Region == nil || *user.Region != filter.Region),
+			filter.CreatedAfter != nil && user.CreatedAt.Before(*filter.CreatedAfter),
+			filter.CreatedBefore != nil && !user.CreatedAt.Before(*filter.CreatedBefore),
+			filter.After != "" && user.ID <= filter.After:
+			continue
+		}
+		matching = append(matching, user)
+	}
+	sort.Slice(matching, func(i, j int) bool { return matching[i].ID < matching[j].ID })
+
+	for _, user := range page(matching, 0, filter.Limit) {
+		users = append(users, ExportUser{
+			ID:                user.ID,
+			Phone:             user.Phone,
+			Name:              user.Name,
+			Version:           user.Version,
+			Email:             clone(user.Email),
+			EmailVerifiedAt:   clone(user.EmailVerifiedAt),
+			PreferredLanguage: clone(user.PreferredLanguage),
+			AvatarURL:         clone(user.AvatarURL),
+			DateOfBirth:       clone(user.DateOfBirth),
+			Address:           clone(user.Address),
+			Estate:            clone(user.Estate),
+			Region:            clone(user.Region),
+			Tenant:            user.Tenant,
+			Attributes:        append([]byte(nil), user.attributes...),
+			OTPLoginEnabled:   user.OTPLoginEnabled,
+			PhoneVerifiedAt:   clone(user.PhoneVerifiedAt),
+			CreatedAt:         user.CreatedAt,
+			UpdatedAt:         clone(user.UpdatedAt),
+		})
+	}
+	return
+}
+
+func (r *MemoryRepository) IncreaseLoginAttempt(ctx context.Context, phone string) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.users {
+		if user.Phone == phone {
+			user.successLogin++
+			user.UpdatedAt = nowPointer()
+		}
+	}
+	return
+}
+
+// UpdateUser : Update user only when the stored version still equal to user.Version, then increment the version, ErrDuplicatePhone or ErrDuplicateEmail when they are used by another user
+func (r *MemoryRepository) UpdateUser(ctx context.Context, user UpdateUser) (err error) {
+	attributes, err := marshalAttributes(user.Attributes)
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, exist := r.users[user.ID]
+	if !exist || stored.Version != user.Version {
+		return ErrVersionConflict
+	}
+	// Changing email require the new address to be verified again
+	emailVerifiedAt := stored.EmailVerifiedAt
+	if !equalStrings(stored.Email, user.Email) {
+		emailVerifiedAt = nil
+	}
+	err = r.checkUniqueUser(user.ID, user.Phone, verifiedEmail(user.Email, emailVerifiedAt))
+	if err != nil {
+		return
+	}
+
+	stored.EmailVerifiedAt = emailVerifiedAt
+	stored.Phone = user.Phone
+	stored.Name = user.Name
+	stored.Email = clone(user.Email)
+	stored.PreferredLanguage = clone(user.PreferredLanguage)
+	stored.AvatarURL = clone(user.AvatarURL)
+	stored.DateOfBirth = storedDate(user.DateOfBirth)
+	stored.Address = clone(user.Address)
+	stored.Estate = clone(user.Estate)
+	stored.Region = clone(user.Region)
+	stored.attributes = []byte(attributes)
+	stored.Version++
+	stored.ChangeSeq = r.nextChangeSeq()
+	stored.UpdatedAt = nowPointer()
+	stored.ProfileUpdatedAt = clone(stored.UpdatedAt)
+	return
+}
+
+// PatchUser : Update only the given columns when the stored version still equal to input.Version, then increment the version, ErrDuplicatePhone or ErrDuplicateEmail when they are used by another user
+func (r *MemoryRepository) PatchUser(ctx context.Context, input PatchUser) (err error) {
+	for column := range input.Fields {
+		if !patchableColumns[column] {
+			return fmt.Errorf("column %s cannot be patched", column)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	patched, err := r.patchUser(input)
+	if err != nil {
+		return
+	}
+	*r.users[input.ID] = patched
+	return
+}
+
+// patchUser : patched copy of the stored user, so the stored user is unchanged when a value is invalid or violates a constraint, must be called with the write lock held
+func (r *MemoryRepository) patchUser(input PatchUser) (patched memoryUser, err error) {
+	stored, exist := r.users[input.ID]
+	if !exist || stored.Version != input.Version {
+		return patched, ErrVersionConflict
+	}
+
+	patched = *stored
+	for column, value := range input.Fields {
+		err = patched.set(column, value)
+		if err != nil {
+			return
+		}
+	}
+	// Changing email require the new address to be verified again
+	if _, changed := input.Fields["email"]; changed {
+		patched.EmailVerifiedAt = nil
+	}
+	err = r.checkUniqueUser(patched.ID, patched.Phone, verifiedEmail(patched.Email, patched.EmailVerifiedAt))
+	if err != nil {
+		return
+	}
+	patched.Version++
+	patched.ChangeSeq = r.nextChangeSeq()
+	patched.UpdatedAt = nowPointer()
+	patched.ProfileUpdatedAt = clone(patched.UpdatedAt)
+	return patched, nil
+}
+
+// SyncUser : Patch the user like PatchUser and store the outcome of the mutations at once, mutations already stored are kept as they are
+func (r *MemoryRepository) SyncUser(ctx context.Context, input SyncUser) (err error) {
+	for column := range input.Fields {
+		if !patchableColumns[column] {
+			return fmt.Errorf("column %s cannot be patched", column)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var patched memoryUser
+	if len(input.Fields) > 0 {
+		patched, err = r.patchUser(input.PatchUser)
+		if err != nil {
+			return
+		}
+	}
+	if _, exist := r.users[input.ID]; !exist && len(input.Mutations) > 0 {
+		return foreignKeyViolation("user_sync_mutation_user_id_fkey")
+	}
+	if len(input.Fields) > 0 {
+		*r.users[input.ID] = patched
+	}
+
+	now := memoryNow()
+	for _, mutation := range input.Mutations {
+		key := syncMutationKey{userID: input.ID, id: mutation.ID}
+		if _, exist := r.syncMutations[key]; exist {
+			continue
+		}
+		mutation.UserID = input.ID
+		mutation.CreatedAt = now
+		r.syncMutations[key] = &memorySyncMutation{SyncMutation: mutation, seq: r.nextSeq()}
+	}
+	return
+}
+
+// FindSyncMutations : Find the stored outcome of the mutations of the user among the ids
+func (r *MemoryRepository) FindSyncMutations(ctx context.Context, userID string, ids []string) (mutations []SyncMutation, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var found []*memorySyncMutation
+	for id := range stringSet(ids) {
+		if mutation, exist := r.syncMutations[syncMutationKey{userID: userID, id: id}]; exist {
+			found = append(found, mutation)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].seq < found[j].seq
+	})
+	for _, mutation := range found {
+		mutations = append(mutations, mutation.SyncMutation)
+	}
+	return
+}
+
+// set : store value of the patchable column, error when the value cannot be stored in the column like Postgres would refuse it
+func (u *memoryUser) set(column string, value interface{}) (err error) {
+	switch column {
+	case "phone":
+		return setNotNull(column, &u.Phone, value)
+	case "name":
+		return setNotNull(column, &u.Name, value)
+	case "password":
+		return setNotNull(column, &u.Password, value)
+	case "salt":
+		return setNotNull(column, &u.Salt, value)
+	case "otp_login_enabled":
+		return setNotNull(column, &u.OTPLoginEnabled, value)
+	case "email":
+		u.Email, err = nullableValue[string](column, value)
+	case "preferred_language":
+		u.PreferredLanguage, err = nullableValue[string](column, value)
+	case "avatar_url":
+		u.AvatarURL, err = nullableValue[string](column, value)
+	case "address":
+		u.Address, err = nullableValue[string](column, value)
+	case "estate":
+		u.Estate, err = nullableValue[string](column, value)
+	case "region":
+		u.Region, err = nullableValue[string](column, value)
+	case "external_id":
+		u.ExternalID, err = nullableValue[string](column, value)
+	case "date_of_birth":
+		var date *time.Time
+		date, err = nullableValue[time.Time](column, value)
+		u.DateOfBirth = storedDate(date)
+	case "deactivated_at":
+		var deactivatedAt *time.Time
+		deactivatedAt, err = nullableValue[time.Time](column, value)
+		u.DeactivatedAt = storedTime(deactivatedAt)
+	case "attributes":
+		attributes, ok := value.(map[string]interface{})
+		if !ok && value != nil {
+			return fmt.Errorf("attributes must be an object")
+		}
+		var encoded string
+		encoded, err = marshalAttributes(attributes)
+		u.attributes = []byte(encoded)
+	default:
+		return fmt.Errorf("column %s cannot be patched", column)
+	}
+	return
+}
+
+// setNotNull : set value of NOT NULL column
+func setNotNull[T any](column string, field *T, value interface{}) error {
+	pointer, err := nullableValue[T](column, value)
+	if err != nil {
+		return err
+	}
+	if pointer == nil {
+		return fmt.Errorf("null value in column %s violates not-null constraint", column)
+	}
+	*field = *pointer
+	return nil
+}
+
+// nullableValue : value of nullable column, value may be nil, the value itself or a pointer to it
+func nullableValue[T any](column string, value interface{}) (*T, error) {
+	switch typed := value.(type) {
+	case nil:
+		return nil, nil
+	case T:
+		return &typed, nil
+	case *T:
+		return clone(typed), nil
+	}
+	return nil, fmt.Errorf("invalid value %v for column %s", value, column)
+}
+
+// VerifyEmail : Mark email of the user as verified, ErrNotFound when the user email is no longer the given email and ErrDuplicateEmail when another user verified it first
+func (r *MemoryRepository) VerifyEmail(ctx context.Context, id string, email string) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, exist := r.users[id]
+	if !exist || user.Email == nil || *user.Email != email {
+		return ErrNotFound
+	}
+	err = r.checkUniqueUser(id, user.Phone, &email)
+	if err != nil {
+		return
+	}
+	user.EmailVerifiedAt = nowPointer()
+	user.UpdatedAt = nowPointer()
+	return
+}
+
+// UpdateAvatarKey : Set blob storage key of the uploaded avatar
+func (r *MemoryRepository) UpdateAvatarKey(ctx context.Context, id string, avatarKey string) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user, exist := r.users[id]; exist {
+		user.AvatarKey = &avatarKey
+		user.Version++
+		user.ChangeSeq = r.nextChangeSeq()
+		user.UpdatedAt = nowPointer()
+		user.ProfileUpdatedAt = clone(user.UpdatedAt)
+	}
+	return
+}
+
+// FindAttributeSchema : Find JSON Schema of custom attributes for the tenant, ErrNotFound when tenant has no schema
+func (r *MemoryRepository) FindAttributeSchema(ctx context.Context, tenant string) (schema []byte, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stored, exist := r.attributeSchemas[tenant]
+	if !exist {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), stored...), nil
+}
+
+// UpdateOTPLogin : Allow or disallow login with SMS one time passcode
+func (r *MemoryRepository) UpdateOTPLogin(ctx context.Context, id string, enabled bool) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user, exist := r.users[id]; exist {
+		user.OTPLoginEnabled = enabled
+		user.Version++
+		user.ChangeSeq = r.nextChangeSeq()
+		user.UpdatedAt = nowPointer()
+		user.ProfileUpdatedAt = clone(user.UpdatedAt)
+	}
+	return
+}
+
+// CountLoginOTP : Count passcodes sent to the phone since the given time
+func (r *MemoryRepository) CountLoginOTP(ctx context.Context, phone string, since time.Time) (count int, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, otp := range r.loginOTPs {
+		if otp.Phone == phone && !otp.createdAt.Before(since) {
+			count++
+		}
+	}
+	return
+}
+
+// CreateLoginOTP : Store hash of new passcode sent to the phone
+func (r *MemoryRepository) CreateLoginOTP(ctx context.Context, otp LoginOTP) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seq := r.nextSeq()
+	r.loginOTPs = append(r.loginOTPs, &memoryLoginOTP{
+		LoginOTP: LoginOTP{
+			// Ids of login_otp are BIGSERIAL, the order of creation is unique and increasing as well
+			ID:        seq,
+			Phone:     otp.Phone,
+			CodeHash:  otp.CodeHash,
+			Salt:      otp.Salt,
+			ExpiresAt: otp.ExpiresAt.Truncate(time.Microsecond),
+		},
+		createdAt: memoryNow(),
+		seq:       seq,
+	})
+	return
+}
+
+// FindLoginOTP : Find the latest unused and unexpired passcode of the phone, ErrNotFound when there is none
+func (r *MemoryRepository) FindLoginOTP(ctx context.Context, phone string) (otp LoginOTP, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := memoryNow()
+	var latest *memoryLoginOTP
+	for _, stored := range r.loginOTPs {
+		if stored.Phone != phone || stored.usedAt != nil || !stored.ExpiresAt.After(now) {
+			continue
+		}
+		if latest == nil || stored.seq > latest.seq {
+			latest = stored
+		}
+	}
+	if latest == nil {
+		return otp, ErrNotFound
+	}
+	return latest.LoginOTP, nil
+}
+
+// IncreaseLoginOTPAttempt : Count a verification of the passcode before the code is compared, ErrNotFound when it was used or
+// already had max attempts, so concurrent guesses cannot get more than max comparisons
+func (r *MemoryRepository) IncreaseLoginOTPAttempt(ctx context.Context, id int64, max int) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	otp := r.findLoginOTP(id)
+	if otp == nil || otp.usedAt != nil || otp.Attempts >= max {
+		return ErrNotFound
+	}
+	otp.Attempts++
+	return
+}
+
+// UseLoginOTP : Mark the passcode as used, ErrNotFound when it was already used so a passcode only login once
+func (r *MemoryRepository) UseLoginOTP(ctx context.Context, id int64) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	otp := r.findLoginOTP(id)
+	if otp == nil || otp.usedAt != nil {
+		return ErrNotFound
+	}
+	otp.usedAt = nowPointer()
+	return
+}
+
+func (r *MemoryRepository) findLoginOTP(id int64) *memoryLoginOTP {
+	for _, otp := range r.loginOTPs {
+		if otp.ID == id {
+			return otp
+		}
+	}
+	return nil
+}
+
+// CreatePersonalAccessToken : Store new personal access token of the user
+func (r *MemoryRepository) CreatePersonalAccessToken(ctx context.Context, token PersonalAccessToken) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exist := r.personalAccessTokens[token.ID]; exist {
+		return ErrConflict
+	}
+	for _, other := range r.personalAccessTokens {
+		if other.TokenHash == token.TokenHash {
+			return ErrConflict
+		}
+	}
+	if _, exist := r.users[token.UserID]; !exist {
+		return foreignKeyViolation("personal_access_token_user_id_fkey")
+	}
+
+	r.personalAccessTokens[token.ID] = &memoryPersonalAccessToken{
+		PersonalAccessToken: PersonalAccessToken{
+			ID:        token.ID,
+			UserID:    token.UserID,
+			Name:      token.Name,
+			TokenHash: token.TokenHash,
+			Prefix:    token.Prefix,
+			Scopes:    copyStrings(token.Scopes),
+			ExpiresAt: token.ExpiresAt.Truncate(time.Microsecond),
+			CreatedAt: memoryNow(),
+		},
+		seq: r.nextSeq(),
+	}
+	return
+}
+
+// ListPersonalAccessTokens : Find tokens of the user that are not revoked, newest first
+func (r *MemoryRepository) ListPersonalAccessTokens(ctx context.Context, userID string) (tokens []PersonalAccessToken, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var matching []*memoryPersonalAccessToken
+	for _, token := range r.personalAccessTokens {
+		if token.UserID == userID && token.revokedAt == nil {
+			matching = append(matching, token)
+		}
+	}
+	sort.Slice(matching, func(i, j int) bool { return matching[i].seq > matching[j].seq })
+
+	for _, token := range matching {
+		tokens = append(tokens, token.token())
+	}
+	return
+}
+
+// FindPersonalAccessToken : Find token by its hash, ErrNotFound when it does not exist, is revoked or expired
+func (r *MemoryRepository) FindPersonalAccessToken(ctx context.Context, tokenHash string) (token PersonalAccessToken, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := memoryNow()
+	for _, stored := range r.personalAccessTokens {
+		if stored.TokenHash == tokenHash && stored.revokedAt == nil && stored.ExpiresAt.After(now) {
+			return stored.token(), nil
+		}
+	}
+	return token, ErrNotFound
+}
+
+// token : copy of the stored token
+func (t *memoryPersonalAccessToken) token() PersonalAccessToken {
+	token := t.PersonalAccessToken
+	token.Scopes = copyStrings(t.Scopes)
+	token.LastUsedAt = clone(t.LastUsedAt)
+	return token
+}
+
+// RevokePersonalAccessToken : Revoke token of the user, ErrNotFound when the user has no such active token
+func (r *MemoryRepository) RevokePersonalAccessToken(ctx context.Context, userID string, id string) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, exist := r.personalAccessTokens[id]
+	if !exist || token.UserID != userID || token.revokedAt != nil {
+		return ErrNotFound
+	}
+	token.revokedAt = nowPointer()
+	return
+}
+
+// TouchPersonalAccessToken : Record the token was used, at most once a minute to keep writes low on busy integrations
+func (r *MemoryRepository) TouchPersonalAccessToken(ctx context.Context, id string) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := memoryNow()
+	if token, exist := r.personalAccessTokens[id]; exist && (token.LastUsedAt == nil || token.LastUsedAt.Before(now.Add(-time.Minute))) {
+		token.LastUsedAt = &now
+	}
+	return
+}
+
+// CreateOAuthClient : Store new OAuth client
+func (r *MemoryRepository) CreateOAuthClient(ctx context.Context, client OAuthClient) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exist := r.oauthClients[client.ID]; exist {
+		return ErrConflict
+	}
+	r.oauthClients[client.ID] = &memoryOAuthClient{
+		OAuthClient: OAuthClient{
+			ID:           client.ID,
+			Name:         client.Name,
+			SecretHash:   client.SecretHash,
+			Scopes:       copyStrings(client.Scopes),
+			RedirectURIs: copyStrings(client.RedirectURIs),
+			Tenant:       clone(client.Tenant),
+			CreatedAt:    memoryNow(),
+		},
+		seq: r.nextSeq(),
+	}
+	return
+}
+
+// ListOAuthClients : Find clients that are not revoked, oldest first
+func (r *MemoryRepository) ListOAuthClients(ctx context.Context) (clients []OAuthClient, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var matching []*memoryOAuthClient
+	for _, client := range r.oauthClients {
+		if client.revokedAt == nil {
+			matching = append(matching, client)
+		}
+	}
+	sort.Slice(matching, func(i, j int) bool { return matching[i].seq < matching[j].seq })
+
+	for _, client := range matching {
+		clients = append(clients, client.client())
+	}
+	return
+}
+
+// FindOAuthClient : Find client by id, ErrNotFound when it does not exist or is revoked
+func (r *MemoryRepository) FindOAuthClient(ctx context.Context, id string) (client OAuthClient, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stored, exist := r.oauthClients[id]
+	if !exist || stored.revokedAt != nil {
+		return client, ErrNotFound
+	}
+	return stored.client(), nil
+}
+
+// client : copy of the stored client
+func (c *memoryOAuthClient) client() OAuthClient {
+	client := c.OAuthClient
+	client.Scopes = copyStrings(c.Scopes)
+	client.RedirectURIs = copyStrings(c.RedirectURIs)
+	client.Tenant = clone(c.Tenant)
+	return client
+}
+
+// RevokeOAuthClient : Revoke client, ErrNotFound when there is no such active client
+func (r *MemoryRepository) RevokeOAuthClient(ctx context.Context, id string) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	client, exist := r.oauthClients[id]
+	if !exist || client.revokedAt != nil {
+		return ErrNotFound
+	}
+	client.revokedAt = nowPointer()
+	return
+}
+
+// CreateAuthorizationCode : Store authorization code issued to the client for the user
+func (r *MemoryRepository) CreateAuthorizationCode(ctx context.Context, code AuthorizationCode) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exist := r.authorizationCodes[code.CodeHash]; exist {
+		return ErrConflict
+	}
+	if _, exist := r.oauthClients[code.ClientID]; !exist {
+		return foreignKeyViolation("oauth_authorization_code_client_id_fkey")
+	}
+	if _, exist := r.users[code.UserID]; !exist {
+		return foreignKeyViolation("oauth_authorization_code_user_id_fkey")
+	}
+
+	stored := code
+	stored.Scopes = copyStrings(code.Scopes)
+	stored.AuthTime = code.AuthTime.Truncate(time.Microsecond)
+	stored.ExpiresAt = code.ExpiresAt.Truncate(time.Microsecond)
+	r.authorizationCodes[code.CodeHash] = &memoryAuthorizationCode{AuthorizationCode: stored}
+	return
+}
+
+// UseAuthorizationCode : Mark the code used and return it, ErrNotFound when it does not exist, is expired or already used
+func (r *MemoryRepository) UseAuthorizationCode(ctx context.Context, codeHash string) (code AuthorizationCode, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, exist := r.authorizationCodes[codeHash]
+	if !exist || stored.usedAt != nil || !stored.ExpiresAt.After(memoryNow()) {
+		return code, ErrNotFound
+	}
+	stored.usedAt = nowPointer()
+
+	code = stored.AuthorizationCode
+	code.Scopes = copyStrings(stored.Scopes)
+	return code, nil
+}
+
+// CreateOrganization : Store organization with the user creating it as its first owner, SCIM groups are created without owner
+func (r *MemoryRepository) CreateOrganization(ctx context.Context, organization Organization, ownerID string) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exist := r.organizations[organization.ID]; exist {
+		return ErrConflict
+	}
+	if ownerID != "" {
+		if _, exist := r.users[ownerID]; !exist {
+			return foreignKeyViolation("organization_member_user_id_fkey")
+		}
+	}
+
+	r.organizations[organization.ID] = &memoryOrganization{
+		Organization: Organization{
+			ID:         organization.ID,
+			Name:       organization.Name,
+			Tenant:     clone(organization.Tenant),
+			ExternalID: clone(organization.ExternalID),
+			CreatedAt:  memoryNow(),
+		},
+	}
+	if ownerID != "" {
+		r.members[memberKey{organization.ID, ownerID}] = &memoryMember{role: RoleOwner, createdAt: memoryNow()}
+	}
+	return
+}
+
+// FindOrganization : Find organization by params, ErrNotFound when no organization match
+func (r *MemoryRepository) FindOrganization(ctx context.Context, params ...Param) (organization Organization, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	organizations, err := r.matchingOrganizations(params)
+	if err != nil {
+		return
+	}
+	if len(organizations) == 0 {
+		return organization, ErrNotFound
+	}
+	return organizations[0].organization(), nil
+}
+
+// ListOrganizations : Find a page of organizations matching the params ordered by creation, total is the number of every matching organization
+func (r *MemoryRepository) ListOrganizations(ctx context.Context, params []Param, offset int, limit int) (organizations []Organization, total int, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	matching, err := r.matchingOrganizations(params)
+	if err != nil {
+		return
+	}
+	total = len(matching)
+
+	for _, organization := range page(matching, offset, limit) {
+		organizations = append(organizations, organization.organization())
+	}
+	return
+}
+
+// matchingOrganizations : organizations matching the params ordered by created_at and id
+func (r *MemoryRepository) matchingOrganizations(params []Param) (organizations []*memoryOrganization, err error) {
+	for _, organization := range r.organizations {
+		var match bool
+		match, err = matchParams(params, organization.column)
+		if err != nil {
+			return
+		}
+		if match {
+			organizations = append(organizations, organization)
+		}
+	}
+	sort.Slice(organizations, func(i, j int) bool {
+		if !organizations[i].CreatedAt.Equal(organizations[j].CreatedAt) {
+			return organizations[i].CreatedAt.Before(organizations[j].CreatedAt)
+		}
+		return organizations[i].ID < organizations[j].ID
+	})
+	return
+}
+
+// organization : copy of the stored organization
+func (o *memoryOrganization) organization() Organization {
+	organization := o.Organization
+	organization.Tenant = clone(o.Tenant)
+	organization.ExternalID = clone(o.ExternalID)
+	return organization
+}
+
+// column : value of the column of public.organization compared by params, nil for NULL
+func (o *memoryOrganization) column(name string) (interface{}, error) {
+	switch name {
+	case "id":
+		return o.ID, nil
+	case "name":
+		return o.Name, nil
+	case "tenant":
+		return nullable(o.Tenant), nil
+	case "external_id":
+		return nullable(o.ExternalID), nil
+	case "created_at":
+		return o.CreatedAt, nil
+	}
+	return nil, fmt.Errorf("column %s does not exist", name)
+}
+
+// UpdateOrganization : Change name and external id of the organization, ErrNotFound when there is no such organization
+func (r *MemoryRepository) UpdateOrganization(ctx context.Context, organization Organization) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, exist := r.organizations[organization.ID]
+	if !exist {
+		return ErrNotFound
+	}
+	stored.Name = organization.Name
+	stored.ExternalID = clone(organization.ExternalID)
+	return
+}
+
+// DeleteOrganization : Delete organization with its members and invitations, ErrNotFound when there is no such organization
+func (r *MemoryRepository) DeleteOrganization(ctx context.Context, id string) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exist := r.organizations[id]; !exist {
+		return ErrNotFound
+	}
+	delete(r.organizations, id)
+
+	for key := range r.members {
+		if key.organizationID == id {
+			delete(r.members, key)
+		}
+	}
+	for invitationID, invitation := range r.invitations {
+		if invitation.OrganizationID == id {
+			delete(r.invitations, invitationID)
+		}
+	}
+	return
+}
+
+// ListUserMemberships : Find organizations of the user, earliest joined first
+func (r *MemoryRepository) ListUserMemberships(ctx context.Context, userID string) (memberships []Membership, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.listMemberships(func(key memberKey) bool { return key.userID == userID }, func(a, b Membership) bool { return a.OrganizationID < b.OrganizationID }), nil
+}
+
+// FindMembership : Find membership of the user in the organization, ErrNotFound when the user is not a member
+func (r *MemoryRepository) FindMembership(ctx context.Context, organizationID string, userID string) (membership Membership, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	memberships := r.listMemberships(func(key memberKey) bool { return key == memberKey{organizationID, userID} }, nil)
+	if len(memberships) == 0 {
+		return membership, ErrNotFound
+	}
+	return memberships[0], nil
+}
+
+// ListOrganizationMembers : Find members of the organization, earliest joined first
+func (r *MemoryRepository) ListOrganizationMembers(ctx context.Context, organizationID string) (members []Membership, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.listMemberships(func(key memberKey) bool { return key.organizationID == organizationID }, func(a, b Membership) bool { return a.UserID < b.UserID }), nil
+}
+
+// listMemberships : memberships of the matching keys joined with their organization and user, ordered by created_at then by less
+func (r *MemoryRepository) listMemberships(match func(key memberKey) bool, less func(a, b Membership) bool) (memberships []Membership) {
+	for key, member := range r.members {
+		if !match(key) {
+			continue
+		}
+		organization := r.organizations[key.organizationID]
+		user := r.users[key.userID]
+		memberships = append(memberships, Membership{
+			OrganizationID:   key.organizationID,
+			OrganizationName: organization.Name,
+			UserID:           key.userID,
+			Name:             user.Name,
+			Phone:            user.Phone,
+			Role:             member.role,
+			CreatedAt:        member.createdAt,
+		})
+	}
+	sort.Slice(memberships, func(i, j int) bool {
+		if !memberships[i].CreatedAt.Equal(memberships[j].CreatedAt) {
+			return memberships[i].CreatedAt.Before(memberships[j].CreatedAt)
+		}
+		return less != nil && less(memberships[i], memberships[j])
+	})
+	return
+}
+
+// AddMember : Add user to the organization, ErrConflict when the user is already a member
+func (r *MemoryRepository) AddMember(ctx context.Context, organizationID string, userID string, role string) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.insertMember(organizationID, userID, role, false)
+}
+
+// insertMember : store membership with the constraints of public.organization_member, existing members are kept when ignoreConflict is set
+func (r *MemoryRepository) insertMember(organizationID string, userID string, role string, ignoreConflict bool) error {
+	if role != RoleOwner && role != RoleAdmin && role != RoleMember {
+		return checkViolation("organization_member_role_check")
+	}
+	if _, exist := r.organizations[organizationID]; !exist {
+		return foreignKeyViolation("organization_member_organization_id_fkey")
+	}
+	if _, exist := r.users[userID]; !exist {
+		return foreignKeyViolation("organization_member_user_id_fkey")
+	}
+
+	key := memberKey{organizationID, userID}
+	if _, exist := r.members[key]; exist {
+		if ignoreConflict {
+			return nil
+		}
+		return ErrConflict
+	}
+	r.members[key] = &memoryMember{role: role, createdAt: memoryNow()}
+	return nil
+}
+
+// UpdateMemberRole : Change role of the member, ErrNotFound when the user is not a member and ErrLastOwner when the last owner is demoted
+func (r *MemoryRepository) UpdateMemberRole(ctx context.Context, organizationID string, userID string, role string) (err error) {
+	if role != RoleOwner && role != RoleAdmin && role != RoleMember {
+		return checkViolation("organization_member_role_check")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	member, err := r.changeMember(organizationID, userID, role != RoleOwner)
+	if err != nil {
+		return
+	}
+	member.role = role
+	return
+}
+
+// RemoveMember : Remove user from the organization, ErrNotFound when the user is not a member and ErrLastOwner for the last owner
+func (r *MemoryRepository) RemoveMember(ctx context.Context, organizationID string, userID string) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, err = r.changeMember(organizationID, userID, true)
+	if err != nil {
+		return
+	}
+	delete(r.members, memberKey{organizationID, userID})
+	return
+}
+
+// changeMember : member that may be changed, ErrLastOwner when the change takes the role of the last owner
+func (r *MemoryRepository) changeMember(organizationID string, userID string, losesOwner bool) (*memoryMember, error) {
+	member, exist := r.members[memberKey{organizationID, userID}]
+	if !exist {
+		return nil, ErrNotFound
+	}
+	if losesOwner && member.role == RoleOwner && r.countOwners(organizationID, nil) <= 1 {
+		return nil, ErrLastOwner
+	}
+	return member, nil
+}
+
+// countOwners : number of owners of the organization, and how many of them are in users
+func (r *MemoryRepository) countOwners(organizationID string, users map[string]bool) (owners int) {
+	for key, member := range r.members {
+		if key.organizationID == organizationID && member.role == RoleOwner && (users == nil || users[key.userID]) {
+			owners++
+		}
+	}
+	return
+}
+
+// ChangeMembers : Add users as members and remove members at once, existing members keep their role
+func (r *MemoryRepository) ChangeMembers(ctx context.Context, organizationID string, add []string, remove []string) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	removed := stringSet(remove)
+	// Organizations without owner such as SCIM groups can stay so, the others must keep one
+	owners := r.countOwners(organizationID, nil)
+	if owners > 0 && r.countOwners(organizationID, removed) == owners {
+		return ErrLastOwner
+	}
+
+	// Check every added user first, so nothing is changed when one of them fails
+	if len(add) > 0 {
+		if _, exist := r.organizations[organizationID]; !exist {
+			return foreignKeyViolation("organization_member_organization_id_fkey")
+		}
+	}
+	for _, userID := range add {
+		if _, exist := r.users[userID]; !exist {
+			return foreignKeyViolation("organization_member_user_id_fkey")
+		}
+	}
+
+	for userID := range removed {
+		delete(r.members, memberKey{organizationID, userID})
+	}
+	for _, userID := range add {
+		err = r.insertMember(organizationID, userID, RoleMember, true)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// CreateInvitation : Store invitation, pending invitations of the same phone to the organization are revoked so only the latest works
+func (r *MemoryRepository) CreateInvitation(ctx context.Context, invitation Invitation) (err error) {
+	if invitation.Role != RoleOwner && invitation.Role != RoleAdmin && invitation.Role != RoleMember {
+		return checkViolation("organization_invitation_role_check")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exist := r.invitations[invitation.ID]; exist {
+		return ErrConflict
+	}
+	for _, other := range r.invitations {
+		if other.TokenHash == invitation.TokenHash {
+			return ErrConflict
+		}
+	}
+	if _, exist := r.organizations[invitation.OrganizationID]; !exist {
+		return foreignKeyViolation("organization_invitation_organization_id_fkey")
+	}
+	if _, exist := r.users[invitation.InvitedBy]; invitation.InvitedBy != "" && !exist {
+		return foreignKeyViolation("organization_invitation_invited_by_fkey")
+	}
+
+	now := memoryNow()
+	for _, other := range r.invitations {
+		if other.OrganizationID == invitation.OrganizationID && other.Phone == invitation.Phone && other.AcceptedAt == nil && other.RevokedAt == nil {
+			other.RevokedAt = &now
+		}
+	}
+	r.invitations[invitation.ID] = &memoryInvitation{
+		Invitation: Invitation{
+			ID:             invitation.ID,
+			OrganizationID: invitation.OrganizationID,
+			Phone:          invitation.Phone,
+			Role:           invitation.Role,
+			TokenHash:      invitation.TokenHash,
+			InvitedBy:      invitation.InvitedBy,
+			ExpiresAt:      invitation.ExpiresAt.Truncate(time.Microsecond),
+			CreatedAt:      now,
+		},
+		seq: r.nextSeq(),
+	}
+	return
+}
+
+// ListInvitations : Find every invitation of the organization, newest first
+func (r *MemoryRepository) ListInvitations(ctx context.Context, organizationID string) (invitations []Invitation, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var matching []*memoryInvitation
+	for _, invitation := range r.invitations {
+		if invitation.OrganizationID == organizationID {
+			matching = append(matching, invitation)
+		}
+	}
+	sort.Slice(matching, func(i, j int) bool { return matching[i].seq > matching[j].seq })
+
+	for _, invitation := range matching {
+		invitations = append(invitations, r.invitation(invitation))
+	}
+	return
+}
+
+// FindInvitation : Find pending invitation by token hash, ErrNotFound when it does not exist, is expired, accepted or revoked
+func (r *MemoryRepository) FindInvitation(ctx context.Context, tokenHash string) (invitation Invitation, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, stored := range r.invitations {
+		if stored.TokenHash == tokenHash && stored.pending(memoryNow()) {
+			return r.invitation(stored), nil
+		}
+	}
+	return invitation, ErrNotFound
+}
+
+// invitation : copy of the stored invitation joined with its organization
+func (r *MemoryRepository) invitation(stored *memoryInvitation) Invitation {
+	invitation := stored.Invitation
+	invitation.OrganizationName = r.organizations[stored.OrganizationID].Name
+	invitation.AcceptedAt = clone(stored.AcceptedAt)
+	invitation.AcceptedBy = clone(stored.AcceptedBy)
+	invitation.RevokedAt = clone(stored.RevokedAt)
+	return invitation
+}
+
+// pending : invitation that can still be accepted
+func (i *memoryInvitation) pending(now time.Time) bool {
+	return i.AcceptedAt == nil && i.RevokedAt == nil && i.ExpiresAt.After(now)
+}
+
+// RevokeInvitation : Revoke pending invitation of the organization, ErrNotFound when there is no such pending invitation
+func (r *MemoryRepository) RevokeInvitation(ctx context.Context, organizationID string, id string) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	invitation, exist := r.invitations[id]
+	if !exist || invitation.OrganizationID != organizationID || invitation.AcceptedAt != nil || invitation.RevokedAt != nil {
+		return ErrNotFound
+	}
+	invitation.RevokedAt = nowPointer()
+	return
+}
+
+// AcceptInvitation : Add the user to the organization of the invitation, ErrNotFound when the invitation is no longer pending
+func (r *MemoryRepository) AcceptInvitation(ctx context.Context, id string, userID string) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.acceptInvitation(id, userID)
+}
+
+// RegisterInvitedUser : Register new user and accept the invitation sent to its phone, ErrNotFound when the invitation is no longer pending and ErrDuplicatePhone when the phone is registered
+func (r *MemoryRepository) RegisterInvitedUser(ctx context.Context, id string, input RegistrationInput) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err = r.insertUser(registrationUser(input))
+	if err != nil {
+		return
+	}
+	err = r.acceptInvitation(id, input.ID)
+	if err != nil {
+		delete(r.users, input.ID)
+		return
+	}
+	return
+}
+
+// acceptInvitation : mark invitation accepted and add the membership, the role of existing members is kept
+func (r *MemoryRepository) acceptInvitation(id string, userID string) error {
+	invitation, exist := r.invitations[id]
+	if !exist || !invitation.pending(memoryNow()) {
+		return ErrNotFound
+	}
+	err := r.insertMember(invitation.OrganizationID, userID, invitation.Role, true)
+	if err != nil {
+		return err
+	}
+	invitation.AcceptedAt = nowPointer()
+	invitation.AcceptedBy = &userID
+	return nil
+}
+
+// foreignKeyViolation : error of the write referencing a row that does not exist
+func foreignKeyViolation(constraint string) error {
+	return fmt.Errorf("insert or update violates foreign key constraint %s", constraint)
+}
+
+// checkViolation : error of the write of a value that is not allowed in the column
+func checkViolation(constraint string) error {
+	return fmt.Errorf("new row violates check constraint %s", constraint)
+}
+
+// memoryNow : current time with the microsecond precision of Postgres timestamps
+func memoryNow() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
+
+func nowPointer() *time.Time {
+	now := memoryNow()
+	return &now
+}
+
+// storedTime : timestamp with the precision Postgres stores
+func storedTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	stored := t.Truncate(time.Microsecond)
+	return &stored
+}
+
+// storedDate : date without time like a DATE column
+func storedDate(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	date := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return &date
+}
+
+func clone[T any](value *T) *T {
+	if value == nil {
+		return nil
+	}
+	copied := *value
+	return &copied
+}
+
+// copyStrings : copy of TEXT[] value, Postgres returns an empty array rather than NULL
+func copyStrings(values []string) []string {
+	return append([]string{}, values...)
+}
+
+// nullable : value of nullable column for params, nil for NULL
+func nullable[T any](value *T) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+func equalStrings(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
+
+// matchParams : evaluate params like the WHERE clause built by whereParams, AND binds tighter than OR as in SQL
+func matchParams(params []Param, column func(name string) (interface{}, error)) (bool, error) {
+	if len(params) == 0 {
+		return true, nil
+	}
+
+	// A row match when every param of one of the groups separated by OR match
+	result, group := false, true
+	for i, param := range params {
+		if i > 0 && strings.EqualFold(param.Logic, "OR") {
+			result = result || group
+			group = true
+		}
+		match, err := matchParam(param, column)
+		if err != nil {
+			return false, err
+		}
+		group = group && match
+	}
+	return result || group, nil
+}
+
+var (
+	nullTestField = regexp.MustCompile(`^\((\w+) IS (NOT )?NULL\)$`)
+	coalesceField = regexp.MustCompile(`^COALESCE\((\w+), (\w+)\)$`)
+	columnField   = regexp.MustCompile(`^\w+$`)
+)
+
+// matchParam : compare the field of the row with the value of the param, comparisons with NULL never match
+func matchParam(param Param, column func(name string) (interface{}, error)) (bool, error) {
+	field, err := fieldValue(param.Field, column)
+	if err != nil {
+		return false, err
+	}
+	value := param.Value
+
+	if param.Operator == "IS DISTINCT FROM" {
+		if field == nil || value == nil {
+			return field != value, nil
+		}
+		cmp, err := compareValues(field, value)
+		return cmp != 0, err
+	}
+	if field == nil || value == nil {
+		return false, nil
+	}
+
+	switch param.Operator {
+	case "ILIKE", "LIKE":
+		text, ok := field.(string)
+		pattern, isString := value.(string)
+		if !ok || !isString {
+			return false, fmt.Errorf("operator %s needs text, got %T and %T", param.Operator, field, value)
+		}
+		return likePattern(pattern, param.Operator == "ILIKE").MatchString(text), nil
+	}
+
+	cmp, err := compareValues(field, value)
+	if err != nil {
+		return false, err
+	}
+	switch param.Operator {
+	case "=":
+		return cmp == 0, nil
+	case "<>", "!=":
+		return cmp != 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	}
+	return false, fmt.Errorf("operator %s is not supported", param.Operator)
+}
+
+// fieldValue : value of the field of params, a column or one of the expressions built by the handlers
+func fieldValue(field string, column func(name string) (interface{}, error)) (interface{}, error) {
+	if match := nullTestField.FindStringSubmatch(field); match != nil {
+		value, err := column(match[1])
+		if err != nil {
+			return nil, err
+		}
+		return (value == nil) == (match[2] == ""), nil
+	}
+	if match := coalesceField.FindStringSubmatch(field); match != nil {
+		for _, name := range match[1:] {
+			value, err := column(name)
+			if err != nil || value != nil {
+				return value, err
+			}
+		}
+		return nil, nil
+	}
+	if columnField.MatchString(field) {
+		return column(field)
+	}
+	return nil, fmt.Errorf("field %s is not supported", field)
+}
+
+// compareValues : -1, 0 or 1 when a is less, equal or greater than b, error when they cannot be compared
+func compareValues(a, b interface{}) (int, error) {
+	switch left := a.(type) {
+	case string:
+		if right, ok := b.(string); ok {
+			return strings.Compare(left, right), nil
+		}
+	case int:
+		if right, ok := b.(int); ok {
+			return compareOrdered(left, right), nil
+		}
+	case bool:
+		if right, ok := b.(bool); ok {
+			if left == right {
+				return 0, nil
+			}
+			if !left {
+				return -1, nil
+			}
+			return 1, nil
+		}
+	case time.Time:
+		if right, ok := b.(time.Time); ok {
+			switch {
+			case left.Before(right):
+				return -1, nil
+			case left.After(right):
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %T with %T", a, b)
+}
+
+func compareOrdered(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// likePattern : regular expression of LIKE pattern, % and _ are wildcards unless escaped with a backslash
+func likePattern(pattern string, caseInsensitive bool) *regexp.Regexp {
+	expression := "(?s)^"
+	if caseInsensitive {
+		expression = "(?is)^"
+	}
+	escaped := false
+	for _, char := range pattern {
+		switch {
+		case escaped:
+			expression += regexp.QuoteMeta(string(char))
+			escaped = false
+		case char == '\\':
+			escaped = true
+		case char == '%':
+			expression += ".*"
+		case char == '_':
+			expression += "."
+		default:
+			expression += regexp.QuoteMeta(string(char))
+		}
+	}
+	return regexp.MustCompile(expression + "$")
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryRepositoryContract(t *testing.T) {
+	runContract(t, func(t *testing.T) RepositoryInterface {
+		return NewMemoryRepository()
+	})
+}
+
+func TestMemoryRepositoryCopies(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepository()
+	id := uuid.NewString()
+	_, err := repo.Registration(ctx, RegistrationInput{ID: id, Phone: "+628111111111", Name: "Budi", Password: "hash", Salt: "salt"})
+	require.NoError(t, err)
+	require.NoError(t, repo.PatchUser(ctx, PatchUser{ID: id, Version: 1, Fields: map[string]interface{}{"region": "Riau", "attributes": map[string]interface{}{"team": "A"}}}))
+
+	// Changing a returned user does not change the stored one, like a row read from Postgres
+	user, err := repo.FindUser(ctx, Param{Field: "id", Operator: "=", Value: id})
+	require.NoError(t, err)
+	*user.Region = "Jambi"
+	user.Attributes["team"] = "B"
+
+	user, err = repo.FindUser(ctx, Param{Field: "id", Operator: "=", Value: id})
+	require.NoError(t, err)
+	assert.Equal(t, "Riau", *user.Region)
+	assert.Equal(t, map[string]interface{}{"team": "A"}, user.Attributes)
+}
+
+func TestMemoryRepositoryAttributeSchema(t *testing.T) {
+	repo := NewMemoryRepository()
+	repo.SetAttributeSchema("acme", []byte(`{"type": "object"}`))
+
+	schema, err := repo.FindAttributeSchema(context.Background(), "acme")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type": "object"}`, string(schema))
+}
+
+func TestMatchParamsUnsupported(t *testing.T) {
+	repo := NewMemoryRepository()
+
+	_, err := repo.FindUser(context.Background(), Param{Field: "LOWER(name)", Operator: "=", Value: "budi"})
+	assert.Error(t, err)
+	_, err = repo.FindUser(context.Background(), Param{Field: "nickname", Operator: "=", Value: "budi"})
+	assert.Error(t, err)
+}
@@ -3,20 +3,48 @@ package repository
 
 import (
 	"database/sql"
+	"fmt"
+	"strings"
 
+	_ "github.com/jackc/pgx/v5/stdlib"
 	_ "github.com/lib/pq"
 )
 
+// Drivers of Postgres, the repository translates the errors of both into the errors of errors.go
+const (
+	DriverPQ  = "postgres"
+	DriverPgx = "pgx"
+)
+
 type Repository struct {
 	Db *sql.DB
 }
 
 type NewRepositoryOptions struct {
+	// Dsn is the URL of a Postgres database, or of a SQLite database when it starts with sqlite:, e.g. sqlite:///var/lib/user-service/user.db
 	Dsn string
+	// Driver is DriverPQ or DriverPgx, DriverPQ is used when it is not set, it is ignored for SQLite
+	Driver string
 }
 
-func NewRepository(opts NewRepositoryOptions) *Repository {
-	db, err := sql.Open("postgres", opts.Dsn)
+// NewRepository : *SQLiteRepository for a sqlite: DSN with its schema migrated, *Repository for Postgres otherwise
+func NewRepository(opts NewRepositoryOptions) RepositoryInterface {
+	if strings.HasPrefix(opts.Dsn, sqliteScheme) {
+		repo, err := newSQLiteRepository(opts.Dsn)
+		if err != nil {
+			panic(err)
+		}
+		return repo
+	}
+
+	if opts.Driver == "" {
+		opts.Driver = DriverPQ
+	}
+	if opts.Driver != DriverPQ && opts.Driver != DriverPgx {
+		panic(fmt.Sprintf("unsupported database driver %s", opts.Driver))
+	}
+
+	db, err := sql.Open(opts.Driver, opts.Dsn)
 	if err != nil {
 		panic(err)
 	}
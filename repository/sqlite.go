@@ -0,0 +1,1113 @@
+// This file contains the SQLite implementation of the repository layer for on-site servers where a Postgres cluster is overkill.
+// Its queries follow implementations.go, the schema is created and upgraded by the migrations of the sqlite directory.
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteScheme : DSN prefix selecting SQLite, e.g. sqlite:///var/lib/user-service/user.db or sqlite::memory:
+const sqliteScheme = "sqlite:"
+
+// sqliteNow : current time as timestamps are stored, UTC text of fixed width so they compare in order
+const sqliteNow = "strftime('%Y-%m-%d %H:%M:%f000+00:00', 'now')"
+
+// sqliteNextChangeSeq : next change sequence of a user, SQLite has no sequences and writes are serialized so it is the highest one plus one
+const sqliteNextChangeSeq = "(SELECT MAX(change_seq) FROM user) + 1"
+
+// sqliteTimeFormat : format of the timestamps bound by the repository, the same as sqliteNow with microseconds like Postgres
+const sqliteTimeFormat = "2006-01-02 15:04:05.000000-07:00"
+
+// sqliteMigrations : schema changes applied in the order of their file name, the user_version of the database is the number applied
+//
+//go:embed sqlite/*.sql
+var sqliteMigrations embed.FS
+
+type SQLiteRepository struct {
+	Db *sql.DB
+}
+
+// newSQLiteRepository : open the database of the DSN and apply the migrations it does not have yet
+func newSQLiteRepository(dsn string) (*SQLiteRepository, error) {
+	path := strings.TrimPrefix(strings.TrimPrefix(dsn, sqliteScheme), "//")
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	// Foreign keys are off unless enabled, transactions take the write lock when they begin instead of failing to upgrade a read lock
+	db, err := sql.Open("sqlite3", path+separator+"_foreign_keys=1&_busy_timeout=5000&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite has a single writer, and an in memory database only exists on the connection that created it
+	db.SetMaxOpenConns(1)
+
+	err = migrateSQLite(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteRepository{Db: db}, nil
+}
+
+// migrateSQLite : each migration and the user_version it brings the database to are committed together
+func migrateSQLite(db *sql.DB) (err error) {
+	names, err := fs.Glob(sqliteMigrations, "sqlite/*.sql")
+	if err != nil {
+		return
+	}
+	sort.Strings(names)
+
+	var version int
+	err = db.QueryRow("PRAGMA user_version").Scan(&version)
+	if err != nil {
+		return
+	}
+	if version > len(names) {
+		return fmt.Errorf("database schema version %d is newer than the %d migrations of this build", version, len(names))
+	}
+
+	for i := version; i < len(names); i++ {
+		err = applySQLiteMigration(db, names[i], i+1)
+		if err != nil {
+			return fmt.Errorf("migration %s: %w", names[i], err)
+		}
+	}
+	return
+}
+
+func applySQLiteMigration(db *sql.DB, name string, version int) (err error) {
+	script, err := sqliteMigrations.ReadFile(name)
+	if err != nil {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(string(script))
+	if err != nil {
+		return
+	}
+	_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version))
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+func (r *SQLiteRepository) GetTestById(ctx context.Context, input GetTestByIdInput) (output GetTestByIdOutput, err error) {
+	err = r.Db.QueryRowContext(ctx, "SELECT name FROM test WHERE id = ?1", input.Id).Scan(&output.Name)
+	if err != nil {
+		err = sqliteError(err)
+		return
+	}
+	return
+}
+
+// Registration : Register new user, ErrDuplicatePhone when the phone number is already registered
+func (r *SQLiteRepository) Registration(ctx context.Context, input RegistrationInput) (output RegistrationOutput, err error) {
+	_, err = r.Db.ExecContext(ctx, sqliteRegistrationQuery, input.ID, input.Phone, input.Name, input.Password, input.Salt, sqliteNullTime(input.PhoneVerifiedAt), input.OTPLoginEnabled)
+	if err != nil {
+		err = sqliteError(err)
+		return
+	}
+	return RegistrationOutput{ID: input.ID}, nil
+}
+
+// sqliteRegistrationQuery : insert new user, shared by Registration, CreateUsers and RegisterInvitedUser
+const sqliteRegistrationQuery = "INSERT INTO user (id, phone, name, password, salt, phone_verified_at, otp_login_enabled) VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7)"
+
+// CreateUsers : Register users in one transaction, none of them are registered when one fails, e.g. with ErrDuplicatePhone
+func (r *SQLiteRepository) CreateUsers(ctx context.Context, inputs []RegistrationInput) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, sqliteRegistrationQuery)
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+
+	for _, input := range inputs {
+		_, err = stmt.ExecContext(ctx, input.ID, input.Phone, input.Name, input.Password, input.Salt, sqliteNullTime(input.PhoneVerifiedAt), input.OTPLoginEnabled)
+		if err != nil {
+			err = sqliteError(err)
+			return
+		}
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// FindRegisteredPhones : Find which of the phone numbers are already registered
+func (r *SQLiteRepository) FindRegisteredPhones(ctx context.Context, phones []string) (registered []string, err error) {
+	rows, err := r.Db.QueryContext(ctx, "SELECT phone FROM user WHERE phone IN (SELECT value FROM json_each(?1))", stringArray(phones))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var phone string
+		err = rows.Scan(&phone)
+		if err != nil {
+			return
+		}
+		registered = append(registered, phone)
+	}
+	err = rows.Err()
+	return
+}
+
+// FindUser : Find user by params
+func (r *SQLiteRepository) FindUser(ctx context.Context, params ...Param) (user User, err error) {
+	where, values := sqliteWhereParams(params)
+	user, err = scanUser(r.Db.QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM user %s", userColumns, where), values...))
+	err = sqliteError(err)
+	return
+}
+
+// FindVerifiedEmailUser : Find the user that verified the email, verified emails are unique
+func (r *SQLiteRepository) FindVerifiedEmailUser(ctx context.Context, email string) (user User, err error) {
+	user, err = scanUser(r.Db.QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM user WHERE email=?1 AND email_verified_at IS NOT NULL", userColumns), email))
+	err = sqliteError(err)
+	return
+}
+
+// ListUsers : Find a page of users matching the params ordered by registration, total is the number of every matching user
+func (r *SQLiteRepository) ListUsers(ctx context.Context, params []Param, offset int, limit int) (users []User, total int, err error) {
+	where, values := sqliteWhereParams(params)
+	err = r.Db.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM user %s", where), values...).Scan(&total)
+	if err != nil {
+		return
+	}
+
+	values = append(values, offset, limit)
+	rows, err := r.Db.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM user %s ORDER BY created_at, id LIMIT ?%d OFFSET ?%d", userColumns, where, len(values), len(values)-1), values...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user User
+		user, err = scanUser(rows)
+		if err != nil {
+			return
+		}
+		users = append(users, user)
+	}
+	err = rows.Err()
+	return
+}
+
+// sqliteWhereParams : WHERE clause of the params like whereParams, with the operators and values Postgres accepts rewritten for SQLite
+func sqliteWhereParams(params []Param) (where string, values []any) {
+	for i, param := range params {
+		if where != "" {
+			logic := "AND "
+			if param.Logic != "" {
+				logic = param.Logic + " "
+			}
+			where += logic
+		}
+		placeholder := "?" + strconv.Itoa(i+1)
+		// LIKE of SQLite ignores the case of ASCII letters only and has no escape character unless one is given
+		if param.Operator == "ILIKE" {
+			where += param.Field + " LIKE " + placeholder + ` ESCAPE '\' `
+		} else {
+			where += param.Field + " " + param.Operator + " " + placeholder + " "
+		}
+		values = append(values, sqliteArg(param.Value))
+	}
+
+	if where != "" {
+		where = "WHERE " + where
+	}
+	return
+}
+
+// ProvisionUser : Register user provisioned by the identity provider of its tenant, ErrDuplicatePhone or ErrDuplicateEmail when they are used by another user
+func (r *SQLiteRepository) ProvisionUser(ctx context.Context, user User) (err error) {
+	_, err = r.Db.ExecContext(ctx, "INSERT INTO user (id, phone, name, password, salt, email, preferred_language, tenant, external_id, otp_login_enabled, deactivated_at) VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10, ?11)",
+		user.ID, user.Phone, user.Name, user.Password, user.Salt, user.Email, user.PreferredLanguage, user.Tenant, user.ExternalID, user.OTPLoginEnabled, sqliteNullTime(user.DeactivatedAt))
+	if err != nil {
+		err = sqliteError(err)
+		return
+	}
+	return
+}
+
+// DeleteUser : Delete user with everything that belongs to it, ErrNotFound when there is no such user
+func (r *SQLiteRepository) DeleteUser(ctx context.Context, id string) (err error) {
+	result, err := r.Db.ExecContext(ctx, "DELETE FROM user WHERE id = ?1", id)
+	if err != nil {
+		return
+	}
+	return sqliteAffected(result)
+}
+
+// FindTenantUserIDs : Find which of the user ids belong to users of the tenant
+func (r *SQLiteRepository) FindTenantUserIDs(ctx context.Context, tenant string, ids []string) (found []string, err error) {
+	rows, err := r.Db.QueryContext(ctx, "SELECT id FROM user WHERE tenant = ?1 AND id IN (SELECT value FROM json_each(?2))", tenant, stringArray(ids))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		err = rows.Scan(&id)
+		if err != nil {
+			return
+		}
+		found = append(found, id)
+	}
+	err = rows.Err()
+	return
+}
+
+// ExportUsers : Find a page of users ordered by id, the next page starts after the id of the last user
+func (r *SQLiteRepository) ExportUsers(ctx context.Context, filter ExportFilter) (users []ExportUser, err error) {
+	var conditions []string
+	var args []interface{}
+	condition := func(format string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(format, len(args)))
+	}
+	if filter.Tenant != "" {
+		condition("tenant = ?%d", filter.Tenant)
+	}
+	if filter.Estate != "" {
+		condition("estate = ?%d", filter.Estate)
+	}
+	if filter.Region != "" {
+		condition("region = ?%d", filter.Region)
+	}
+	if filter.CreatedAfter != nil {
+		condition("created_at >= ?%d", sqliteTime(*filter.CreatedAfter))
+	}
+	if filter.CreatedBefore != nil {
+		condition("created_at < ?%d", sqliteTime(*filter.CreatedBefore))
+	}
+	if filter.After != "" {
+		condition("id > ?%d", filter.After)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	rows, err := r.Db.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM user %s ORDER BY id LIMIT ?%d", exportColumns, where, len(args)), args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user ExportUser
+		err = rows.Scan(
+			&user.ID, &user.Phone, &user.Name, &user.Version,
+			&user.Email, &user.EmailVerifiedAt, &user.PreferredLanguage, &user.AvatarURL, &user.DateOfBirth, &user.Address, &user.Estate, &user.Region,
+			&user.Tenant, &user.Attributes, &user.OTPLoginEnabled, &user.PhoneVerifiedAt, &user.CreatedAt, &user.UpdatedAt,
+		)
+		if err != nil {
+			return
+		}
+		users = append(users, user)
+	}
+	err = rows.Err()
+	return
+}
+
+func (r *SQLiteRepository) IncreaseLoginAttempt(ctx context.Context, phone string) (err error) {
+	_, err = r.Db.ExecContext(ctx, "UPDATE user SET success_login = success_login + 1, updated_at = "+sqliteNow+" WHERE phone = ?1", phone)
+	return
+}
+
+// UpdateUser : Update user only when the stored version still equal to user.Version, then increment the version, ErrDuplicatePhone or ErrDuplicateEmail when they are used by another user
+func (r *SQLiteRepository) UpdateUser(ctx context.Context, user UpdateUser) (err error) {
+	attributes, err := marshalAttributes(user.Attributes)
+	if err != nil {
+		return
+	}
+
+	// Changing email require the new address to be verified again
+	result, err := r.Db.ExecContext(ctx, `UPDATE user SET phone=?1, name=?2, email=?3, preferred_language=?4, avatar_url=?5, date_of_birth=?6,
+		address=?7, estate=?8, region=?9, attributes=?10, email_verified_at=CASE WHEN email IS DISTINCT FROM ?3 THEN NULL ELSE email_verified_at END,
+		version=version+1, change_seq=`+sqliteNextChangeSeq+`, updated_at=`+sqliteNow+`, profile_updated_at=`+sqliteNow+` WHERE id=?11 AND version=?12`,
+		user.Phone, user.Name, user.Email, user.PreferredLanguage, user.AvatarURL, sqliteDate(user.DateOfBirth),
+		user.Address, user.Estate, user.Region, attributes, user.ID, user.Version)
+	if err != nil {
+		err = sqliteError(err)
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+	if affected == 0 {
+		return ErrVersionConflict
+	}
+	return
+}
+
+// PatchUser : Update only the given columns when the stored version still equal to input.Version, then increment the version, ErrDuplicatePhone or ErrDuplicateEmail when they are used by another user
+func (r *SQLiteRepository) PatchUser(ctx context.Context, input PatchUser) (err error) {
+	return sqlitePatchUser(ctx, r.Db, input)
+}
+
+// sqlitePatchUser : PatchUser with the database or within a transaction
+func sqlitePatchUser(ctx context.Context, db interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}, input PatchUser) (err error) {
+	columns := make([]string, 0, len(input.Fields))
+	for column := range input.Fields {
+		if !patchableColumns[column] {
+			return fmt.Errorf("column %s cannot be patched", column)
+		}
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	set := ""
+	var values []any
+	for i, column := range columns {
+		value := input.Fields[column]
+		switch column {
+		case "attributes":
+			attributes, ok := value.(map[string]interface{})
+			if !ok && value != nil {
+				return fmt.Errorf("attributes must be an object")
+			}
+			value, err = marshalAttributes(attributes)
+			if err != nil {
+				return
+			}
+		case "date_of_birth":
+			value = sqliteDate(value)
+		default:
+			value = sqliteArg(value)
+		}
+
+		set += column + "=?" + strconv.Itoa(i+1) + ", "
+		values = append(values, value)
+	}
+	// Changing email require the new address to be verified again
+	if _, changed := input.Fields["email"]; changed {
+		set += "email_verified_at=NULL, "
+	}
+	values = append(values, input.ID, input.Version)
+
+	query := fmt.Sprintf("UPDATE user SET %sversion=version+1, change_seq=%s, updated_at=%s, profile_updated_at=%s WHERE id=?%d AND version=?%d", set, sqliteNextChangeSeq, sqliteNow, sqliteNow, len(values)-1, len(values))
+	result, err := db.ExecContext(ctx, query, values...)
+	if err != nil {
+		err = sqliteError(err)
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+	if affected == 0 {
+		return ErrVersionConflict
+	}
+	return
+}
+
+// SyncUser : Patch the user like PatchUser and store the outcome of the mutations in one transaction, mutations already stored are kept as they are
+func (r *SQLiteRepository) SyncUser(ctx context.Context, input SyncUser) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	if len(input.Fields) > 0 {
+		err = sqlitePatchUser(ctx, tx, input.PatchUser)
+		if err != nil {
+			return
+		}
+	}
+
+	for _, mutation := range input.Mutations {
+		_, err = tx.ExecContext(ctx, "INSERT INTO user_sync_mutation (user_id, id, field, status, message) VALUES (?1, ?2, ?3, ?4, ?5) ON CONFLICT (user_id, id) DO NOTHING",
+			input.ID, mutation.ID, mutation.Field, mutation.Status, mutation.Message)
+		if err != nil {
+			err = sqliteError(err)
+			return
+		}
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// FindSyncMutations : Find the stored outcome of the mutations of the user among the ids
+func (r *SQLiteRepository) FindSyncMutations(ctx context.Context, userID string, ids []string) (mutations []SyncMutation, err error) {
+	rows, err := r.Db.QueryContext(ctx, "SELECT id, user_id, field, status, message, created_at FROM user_sync_mutation WHERE user_id = ?1 AND id IN (SELECT value FROM json_each(?2)) ORDER BY created_at, id", userID, stringArray(ids))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mutation SyncMutation
+		err = rows.Scan(&mutation.ID, &mutation.UserID, &mutation.Field, &mutation.Status, &mutation.Message, &mutation.CreatedAt)
+		if err != nil {
+			return
+		}
+		mutations = append(mutations, mutation)
+	}
+	err = rows.Err()
+	return
+}
+
+// VerifyEmail : Mark email of the user as verified, ErrNotFound when the user email is no longer the given email and ErrDuplicateEmail when another user verified it first
+func (r *SQLiteRepository) VerifyEmail(ctx context.Context, id string, email string) (err error) {
+	result, err := r.Db.ExecContext(ctx, "UPDATE user SET email_verified_at="+sqliteNow+", updated_at="+sqliteNow+" WHERE id=?1 AND email=?2", id, email)
+	if err != nil {
+		return sqliteError(err)
+	}
+	return sqliteAffected(result)
+}
+
+// UpdateAvatarKey : Set blob storage key of the uploaded avatar
+func (r *SQLiteRepository) UpdateAvatarKey(ctx context.Context, id string, avatarKey string) (err error) {
+	_, err = r.Db.ExecContext(ctx, "UPDATE user SET avatar_key=?1, version=version+1, change_seq="+sqliteNextChangeSeq+", updated_at="+sqliteNow+", profile_updated_at="+sqliteNow+" WHERE id=?2", avatarKey, id)
+	return sqliteError(err)
+}
+
+// FindAttributeSchema : Find JSON Schema of custom attributes for the tenant, ErrNotFound when tenant has no schema
+func (r *SQLiteRepository) FindAttributeSchema(ctx context.Context, tenant string) (schema []byte, err error) {
+	err = r.Db.QueryRowContext(ctx, "SELECT schema FROM tenant_attribute_schema WHERE tenant = ?1", tenant).Scan(&schema)
+	if err != nil {
+		err = sqliteError(err)
+		return
+	}
+	return
+}
+
+// UpdateOTPLogin : Allow or disallow login with SMS one time passcode
+func (r *SQLiteRepository) UpdateOTPLogin(ctx context.Context, id string, enabled bool) (err error) {
+	_, err = r.Db.ExecContext(ctx, "UPDATE user SET otp_login_enabled=?1, version=version+1, change_seq="+sqliteNextChangeSeq+", updated_at="+sqliteNow+", profile_updated_at="+sqliteNow+" WHERE id=?2", enabled, id)
+	return
+}
+
+// CountLoginOTP : Count passcodes sent to the phone since the given time
+func (r *SQLiteRepository) CountLoginOTP(ctx context.Context, phone string, since time.Time) (count int, err error) {
+	err = r.Db.QueryRowContext(ctx, "SELECT COUNT(*) FROM login_otp WHERE phone = ?1 AND created_at >= ?2", phone, sqliteTime(since)).Scan(&count)
+	return
+}
+
+// CreateLoginOTP : Store hash of new passcode sent to the phone
+func (r *SQLiteRepository) CreateLoginOTP(ctx context.Context, otp LoginOTP) (err error) {
+	_, err = r.Db.ExecContext(ctx, "INSERT INTO login_otp (phone, code_hash, salt, expires_at) VALUES (?1, ?2, ?3, ?4)", otp.Phone, otp.CodeHash, otp.Salt, sqliteTime(otp.ExpiresAt))
+	return sqliteError(err)
+}
+
+// FindLoginOTP : Find the latest unused and unexpired passcode of the phone, ErrNotFound when there is none
+func (r *SQLiteRepository) FindLoginOTP(ctx context.Context, phone string) (otp LoginOTP, err error) {
+	// Passcodes sent within the same millisecond are ordered by id
+	err = r.Db.QueryRowContext(ctx, `SELECT id, phone, code_hash, salt, attempts, expires_at FROM login_otp
+		WHERE phone = ?1 AND used_at IS NULL AND expires_at > `+sqliteNow+` ORDER BY created_at DESC, id DESC LIMIT 1`, phone).Scan(
+		&otp.ID, &otp.Phone, &otp.CodeHash, &otp.Salt, &otp.Attempts, &otp.ExpiresAt,
+	)
+	if err != nil {
+		err = sqliteError(err)
+		return
+	}
+	return
+}
+
+// IncreaseLoginOTPAttempt : Count a verification of the passcode before the code is compared, ErrNotFound when it was used or
+// already had max attempts, so concurrent guesses cannot get more than max comparisons
+func (r *SQLiteRepository) IncreaseLoginOTPAttempt(ctx context.Context, id int64, max int) (err error) {
+	result, err := r.Db.ExecContext(ctx, "UPDATE login_otp SET attempts=attempts+1 WHERE id=?1 AND used_at IS NULL AND attempts < ?2", id, max)
+	if err != nil {
+		return
+	}
+	return sqliteAffected(result)
+}
+
+// UseLoginOTP : Mark the passcode as used, ErrNotFound when it was already used so a passcode only login once
+func (r *SQLiteRepository) UseLoginOTP(ctx context.Context, id int64) (err error) {
+	result, err := r.Db.ExecContext(ctx, "UPDATE login_otp SET used_at="+sqliteNow+" WHERE id=?1 AND used_at IS NULL", id)
+	if err != nil {
+		return
+	}
+	return sqliteAffected(result)
+}
+
+// CreatePersonalAccessToken : Store new personal access token of the user
+func (r *SQLiteRepository) CreatePersonalAccessToken(ctx context.Context, token PersonalAccessToken) (err error) {
+	_, err = r.Db.ExecContext(ctx, "INSERT INTO personal_access_token (id, user_id, name, token_hash, prefix, scopes, expires_at) VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7)",
+		token.ID, token.UserID, token.Name, token.TokenHash, token.Prefix, stringArray(token.Scopes), sqliteTime(token.ExpiresAt))
+	return sqliteError(err)
+}
+
+// ListPersonalAccessTokens : Find tokens of the user that are not revoked, newest first
+func (r *SQLiteRepository) ListPersonalAccessTokens(ctx context.Context, userID string) (tokens []PersonalAccessToken, err error) {
+	rows, err := r.Db.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM personal_access_token WHERE user_id = ?1 AND revoked_at IS NULL ORDER BY created_at DESC, rowid DESC", personalAccessTokenColumns), userID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var token PersonalAccessToken
+		err = rows.Scan(&token.ID, &token.UserID, &token.Name, &token.TokenHash, &token.Prefix, (*stringArray)(&token.Scopes), &token.ExpiresAt, &token.LastUsedAt, &token.CreatedAt)
+		if err != nil {
+			return
+		}
+		tokens = append(tokens, token)
+	}
+	err = rows.Err()
+	return
+}
+
+// FindPersonalAccessToken : Find token by its hash, ErrNotFound when it does not exist, is revoked or expired
+func (r *SQLiteRepository) FindPersonalAccessToken(ctx context.Context, tokenHash string) (token PersonalAccessToken, err error) {
+	err = r.Db.QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM personal_access_token WHERE token_hash = ?1 AND revoked_at IS NULL AND expires_at > %s", personalAccessTokenColumns, sqliteNow), tokenHash).Scan(
+		&token.ID, &token.UserID, &token.Name, &token.TokenHash, &token.Prefix, (*stringArray)(&token.Scopes), &token.ExpiresAt, &token.LastUsedAt, &token.CreatedAt,
+	)
+	if err != nil {
+		err = sqliteError(err)
+		return
+	}
+	return
+}
+
+// RevokePersonalAccessToken : Revoke token of the user, ErrNotFound when the user has no such active token
+func (r *SQLiteRepository) RevokePersonalAccessToken(ctx context.Context, userID string, id string) (err error) {
+	result, err := r.Db.ExecContext(ctx, "UPDATE personal_access_token SET revoked_at="+sqliteNow+" WHERE id=?1 AND user_id=?2 AND revoked_at IS NULL", id, userID)
+	if err != nil {
+		return
+	}
+	return sqliteAffected(result)
+}
+
+// TouchPersonalAccessToken : Record the token was used, at most once a minute to keep writes low on busy integrations
+func (r *SQLiteRepository) TouchPersonalAccessToken(ctx context.Context, id string) (err error) {
+	_, err = r.Db.ExecContext(ctx, "UPDATE personal_access_token SET last_used_at="+sqliteNow+" WHERE id=?1 AND (last_used_at IS NULL OR last_used_at < strftime('%Y-%m-%d %H:%M:%f000+00:00', 'now', '-1 minute'))", id)
+	return
+}
+
+// CreateOAuthClient : Store new OAuth client
+func (r *SQLiteRepository) CreateOAuthClient(ctx context.Context, client OAuthClient) (err error) {
+	_, err = r.Db.ExecContext(ctx, "INSERT INTO oauth_client (id, name, secret_hash, scopes, redirect_uris, tenant) VALUES (?1, ?2, ?3, ?4, ?5, ?6)",
+		client.ID, client.Name, client.SecretHash, stringArray(client.Scopes), stringArray(client.RedirectURIs), client.Tenant)
+	return sqliteError(err)
+}
+
+// ListOAuthClients : Find clients that are not revoked, oldest first
+func (r *SQLiteRepository) ListOAuthClients(ctx context.Context) (clients []OAuthClient, err error) {
+	rows, err := r.Db.QueryContext(ctx, "SELECT id, name, secret_hash, scopes, redirect_uris, tenant, created_at FROM oauth_client WHERE revoked_at IS NULL ORDER BY created_at, rowid")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var client OAuthClient
+		err = rows.Scan(&client.ID, &client.Name, &client.SecretHash, (*stringArray)(&client.Scopes), (*stringArray)(&client.RedirectURIs), &client.Tenant, &client.CreatedAt)
+		if err != nil {
+			return
+		}
+		clients = append(clients, client)
+	}
+	err = rows.Err()
+	return
+}
+
+// FindOAuthClient : Find client by id, ErrNotFound when it does not exist or is revoked
+func (r *SQLiteRepository) FindOAuthClient(ctx context.Context, id string) (client OAuthClient, err error) {
+	err = r.Db.QueryRowContext(ctx, "SELECT id, name, secret_hash, scopes, redirect_uris, tenant, created_at FROM oauth_client WHERE id = ?1 AND revoked_at IS NULL", id).Scan(
+		&client.ID, &client.Name, &client.SecretHash, (*stringArray)(&client.Scopes), (*stringArray)(&client.RedirectURIs), &client.Tenant, &client.CreatedAt,
+	)
+	if err != nil {
+		err = sqliteError(err)
+		return
+	}
+	return
+}
+
+// RevokeOAuthClient : Revoke client, ErrNotFound when there is no such active client
+func (r *SQLiteRepository) RevokeOAuthClient(ctx context.Context, id string) (err error) {
+	result, err := r.Db.ExecContext(ctx, "UPDATE oauth_client SET revoked_at="+sqliteNow+" WHERE id=?1 AND revoked_at IS NULL", id)
+	if err != nil {
+		return
+	}
+	return sqliteAffected(result)
+}
+
+// CreateAuthorizationCode : Store authorization code issued to the client for the user
+func (r *SQLiteRepository) CreateAuthorizationCode(ctx context.Context, code AuthorizationCode) (err error) {
+	_, err = r.Db.ExecContext(ctx, "INSERT INTO oauth_authorization_code (code_hash, client_id, user_id, redirect_uri, scopes, nonce, code_challenge, auth_time, expires_at) VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9)",
+		code.CodeHash, code.ClientID, code.UserID, code.RedirectURI, stringArray(code.Scopes), code.Nonce, code.CodeChallenge, sqliteTime(code.AuthTime), sqliteTime(code.ExpiresAt))
+	return sqliteError(err)
+}
+
+// UseAuthorizationCode : Mark the code used and return it, ErrNotFound when it does not exist, is expired or already used
+func (r *SQLiteRepository) UseAuthorizationCode(ctx context.Context, codeHash string) (code AuthorizationCode, err error) {
+	err = r.Db.QueryRowContext(ctx, "UPDATE oauth_authorization_code SET used_at="+sqliteNow+" WHERE code_hash=?1 AND used_at IS NULL AND expires_at > "+sqliteNow+" RETURNING code_hash, client_id, user_id, redirect_uri, scopes, nonce, code_challenge, auth_time, expires_at", codeHash).Scan(
+		&code.CodeHash, &code.ClientID, &code.UserID, &code.RedirectURI, (*stringArray)(&code.Scopes), &code.Nonce, &code.CodeChallenge, &code.AuthTime, &code.ExpiresAt,
+	)
+	if err != nil {
+		err = sqliteError(err)
+		return
+	}
+	return
+}
+
+// CreateOrganization : Store organization with the user creating it as its first owner, SCIM groups are created without owner
+func (r *SQLiteRepository) CreateOrganization(ctx context.Context, organization Organization, ownerID string) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO organization (id, name, tenant, external_id) VALUES (?1, ?2, ?3, ?4)", organization.ID, organization.Name, organization.Tenant, organization.ExternalID)
+	if err != nil {
+		err = sqliteError(err)
+		return
+	}
+	if ownerID != "" {
+		_, err = tx.ExecContext(ctx, "INSERT INTO organization_member (organization_id, user_id, role) VALUES (?1, ?2, ?3)", organization.ID, ownerID, RoleOwner)
+		if err != nil {
+			err = sqliteError(err)
+			return
+		}
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// FindOrganization : Find organization by params
+func (r *SQLiteRepository) FindOrganization(ctx context.Context, params ...Param) (organization Organization, err error) {
+	where, values := sqliteWhereParams(params)
+	organization, err = scanOrganization(r.Db.QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM organization %s", organizationColumns, where), values...))
+	err = sqliteError(err)
+	return
+}
+
+// ListOrganizations : Find a page of organizations matching the params ordered by creation, total is the number of every matching organization
+func (r *SQLiteRepository) ListOrganizations(ctx context.Context, params []Param, offset int, limit int) (organizations []Organization, total int, err error) {
+	where, values := sqliteWhereParams(params)
+	err = r.Db.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM organization %s", where), values...).Scan(&total)
+	if err != nil {
+		return
+	}
+
+	values = append(values, offset, limit)
+	rows, err := r.Db.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM organization %s ORDER BY created_at, id LIMIT ?%d OFFSET ?%d", organizationColumns, where, len(values), len(values)-1), values...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var organization Organization
+		organization, err = scanOrganization(rows)
+		if err != nil {
+			return
+		}
+		organizations = append(organizations, organization)
+	}
+	err = rows.Err()
+	return
+}
+
+// UpdateOrganization : Change name and external id of the organization, ErrNotFound when there is no such organization
+func (r *SQLiteRepository) UpdateOrganization(ctx context.Context, organization Organization) (err error) {
+	result, err := r.Db.ExecContext(ctx, "UPDATE organization SET name = ?1, external_id = ?2 WHERE id = ?3", organization.Name, organization.ExternalID, organization.ID)
+	if err != nil {
+		return
+	}
+	return sqliteAffected(result)
+}
+
+// DeleteOrganization : Delete organization with its members and invitations, ErrNotFound when there is no such organization
+func (r *SQLiteRepository) DeleteOrganization(ctx context.Context, id string) (err error) {
+	result, err := r.Db.ExecContext(ctx, "DELETE FROM organization WHERE id = ?1", id)
+	if err != nil {
+		return
+	}
+	return sqliteAffected(result)
+}
+
+// ListUserMemberships : Find organizations of the user, earliest joined first
+func (r *SQLiteRepository) ListUserMemberships(ctx context.Context, userID string) (memberships []Membership, err error) {
+	return r.listMemberships(ctx, "m.user_id = ?1 ORDER BY m.created_at, m.organization_id", userID)
+}
+
+// FindMembership : Find membership of the user in the organization, ErrNotFound when the user is not a member
+func (r *SQLiteRepository) FindMembership(ctx context.Context, organizationID string, userID string) (membership Membership, err error) {
+	memberships, err := r.listMemberships(ctx, "m.organization_id = ?1 AND m.user_id = ?2", organizationID, userID)
+	if err != nil {
+		return
+	}
+	if len(memberships) == 0 {
+		err = ErrNotFound
+		return
+	}
+	return memberships[0], nil
+}
+
+// ListOrganizationMembers : Find members of the organization, earliest joined first
+func (r *SQLiteRepository) ListOrganizationMembers(ctx context.Context, organizationID string) (members []Membership, err error) {
+	return r.listMemberships(ctx, "m.organization_id = ?1 ORDER BY m.created_at, m.user_id", organizationID)
+}
+
+// listMemberships : every membership query is scoped by organization or user through the given condition
+func (r *SQLiteRepository) listMemberships(ctx context.Context, condition string, args ...interface{}) (memberships []Membership, err error) {
+	rows, err := r.Db.QueryContext(ctx, "SELECT m.organization_id, o.name, m.user_id, u.name, u.phone, m.role, m.created_at FROM organization_member m JOIN organization o ON o.id = m.organization_id JOIN user u ON u.id = m.user_id WHERE "+condition, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var membership Membership
+		err = rows.Scan(&membership.OrganizationID, &membership.OrganizationName, &membership.UserID, &membership.Name, &membership.Phone, &membership.Role, &membership.CreatedAt)
+		if err != nil {
+			return
+		}
+		memberships = append(memberships, membership)
+	}
+	err = rows.Err()
+	return
+}
+
+// AddMember : Add user to the organization, ErrConflict when the user is already a member
+func (r *SQLiteRepository) AddMember(ctx context.Context, organizationID string, userID string, role string) (err error) {
+	_, err = r.Db.ExecContext(ctx, "INSERT INTO organization_member (organization_id, user_id, role) VALUES (?1, ?2, ?3)", organizationID, userID, role)
+	return sqliteError(err)
+}
+
+// UpdateMemberRole : Change role of the member, ErrNotFound when the user is not a member and ErrLastOwner when the last owner is demoted
+func (r *SQLiteRepository) UpdateMemberRole(ctx context.Context, organizationID string, userID string, role string) (err error) {
+	return r.changeMember(ctx, organizationID, userID, role != RoleOwner, func(tx *sql.Tx) (sql.Result, error) {
+		return tx.ExecContext(ctx, "UPDATE organization_member SET role=?1 WHERE organization_id=?2 AND user_id=?3", role, organizationID, userID)
+	})
+}
+
+// RemoveMember : Remove user from the organization, ErrNotFound when the user is not a member and ErrLastOwner for the last owner
+func (r *SQLiteRepository) RemoveMember(ctx context.Context, organizationID string, userID string) (err error) {
+	return r.changeMember(ctx, organizationID, userID, true, func(tx *sql.Tx) (sql.Result, error) {
+		return tx.ExecContext(ctx, "DELETE FROM organization_member WHERE organization_id=?1 AND user_id=?2", organizationID, userID)
+	})
+}
+
+// ChangeMembers : Add users as members and remove members in one transaction, existing members keep their role
+func (r *SQLiteRepository) ChangeMembers(ctx context.Context, organizationID string, add []string, remove []string) (err error) {
+	// The transaction holds the write lock of the database from its start, so it needs no row lock
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	var owners, removedOwners int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*), COUNT(*) FILTER (WHERE user_id IN (SELECT value FROM json_each(?3))) FROM organization_member WHERE organization_id = ?1 AND role = ?2",
+		organizationID, RoleOwner, stringArray(remove)).Scan(&owners, &removedOwners)
+	if err != nil {
+		return
+	}
+	// Organizations without owner such as SCIM groups can stay so, the others must keep one
+	if owners > 0 && removedOwners == owners {
+		return ErrLastOwner
+	}
+
+	if len(remove) > 0 {
+		_, err = tx.ExecContext(ctx, "DELETE FROM organization_member WHERE organization_id = ?1 AND user_id IN (SELECT value FROM json_each(?2))", organizationID, stringArray(remove))
+		if err != nil {
+			return
+		}
+	}
+	if len(add) > 0 {
+		// WHERE true tells the parser the ON CONFLICT is not the ON of a join
+		_, err = tx.ExecContext(ctx, "INSERT INTO organization_member (organization_id, user_id, role) SELECT ?1, value, ?3 FROM json_each(?2) WHERE true ON CONFLICT DO NOTHING",
+			organizationID, stringArray(add), RoleMember)
+		if err != nil {
+			return
+		}
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// changeMember : the transaction holds the write lock of the database so concurrent changes cannot remove every owner
+func (r *SQLiteRepository) changeMember(ctx context.Context, organizationID string, userID string, losesOwner bool, change func(tx *sql.Tx) (sql.Result, error)) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	var role string
+	err = tx.QueryRowContext(ctx, "SELECT role FROM organization_member WHERE organization_id = ?1 AND user_id = ?2", organizationID, userID).Scan(&role)
+	if err != nil {
+		err = sqliteError(err)
+		return
+	}
+	if losesOwner && role == RoleOwner {
+		var owners int
+		err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM organization_member WHERE organization_id = ?1 AND role = ?2", organizationID, RoleOwner).Scan(&owners)
+		if err != nil {
+			return
+		}
+		if owners <= 1 {
+			return ErrLastOwner
+		}
+	}
+
+	_, err = change(tx)
+	if err != nil {
+		err = sqliteError(err)
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// CreateInvitation : Store invitation, pending invitations of the same phone to the organization are revoked so only the latest works
+func (r *SQLiteRepository) CreateInvitation(ctx context.Context, invitation Invitation) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "UPDATE organization_invitation SET revoked_at="+sqliteNow+" WHERE organization_id=?1 AND phone=?2 AND accepted_at IS NULL AND revoked_at IS NULL", invitation.OrganizationID, invitation.Phone)
+	if err != nil {
+		return
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO organization_invitation (id, organization_id, phone, role, token_hash, invited_by, expires_at) VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7)",
+		invitation.ID, invitation.OrganizationID, invitation.Phone, invitation.Role, invitation.TokenHash, invitation.InvitedBy, sqliteTime(invitation.ExpiresAt))
+	if err != nil {
+		err = sqliteError(err)
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// sqliteInvitationColumns : columns of invitation joined with its organization, the order must follow the Scan in scanInvitation
+const sqliteInvitationColumns = "i.id, i.organization_id, o.name, i.phone, i.role, i.token_hash, COALESCE(i.invited_by, ''), i.expires_at, i.accepted_at, i.accepted_by, i.revoked_at, i.created_at"
+
+// ListInvitations : Find every invitation of the organization, newest first
+func (r *SQLiteRepository) ListInvitations(ctx context.Context, organizationID string) (invitations []Invitation, err error) {
+	rows, err := r.Db.QueryContext(ctx, "SELECT "+sqliteInvitationColumns+" FROM organization_invitation i JOIN organization o ON o.id = i.organization_id WHERE i.organization_id = ?1 ORDER BY i.created_at DESC, i.rowid DESC", organizationID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var invitation Invitation
+		invitation, err = scanInvitation(rows)
+		if err != nil {
+			return
+		}
+		invitations = append(invitations, invitation)
+	}
+	err = rows.Err()
+	return
+}
+
+// FindInvitation : Find pending invitation by token hash, ErrNotFound when it does not exist, is expired, accepted or revoked
+func (r *SQLiteRepository) FindInvitation(ctx context.Context, tokenHash string) (invitation Invitation, err error) {
+	invitation, err = scanInvitation(r.Db.QueryRowContext(ctx, "SELECT "+sqliteInvitationColumns+" FROM organization_invitation i JOIN organization o ON o.id = i.organization_id WHERE i.token_hash = ?1 AND i.accepted_at IS NULL AND i.revoked_at IS NULL AND i.expires_at > "+sqliteNow, tokenHash))
+	err = sqliteError(err)
+	return
+}
+
+// RevokeInvitation : Revoke pending invitation of the organization, ErrNotFound when there is no such pending invitation
+func (r *SQLiteRepository) RevokeInvitation(ctx context.Context, organizationID string, id string) (err error) {
+	result, err := r.Db.ExecContext(ctx, "UPDATE organization_invitation SET revoked_at="+sqliteNow+" WHERE id=?1 AND organization_id=?2 AND accepted_at IS NULL AND revoked_at IS NULL", id, organizationID)
+	if err != nil {
+		return
+	}
+	return sqliteAffected(result)
+}
+
+// AcceptInvitation : Add the user to the organization of the invitation, ErrNotFound when the invitation is no longer pending
+func (r *SQLiteRepository) AcceptInvitation(ctx context.Context, id string, userID string) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	err = sqliteAcceptInvitation(ctx, tx, id, userID)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// RegisterInvitedUser : Register new user and accept the invitation sent to its phone, ErrNotFound when the invitation is no longer pending and ErrDuplicatePhone when the phone is registered
+func (r *SQLiteRepository) RegisterInvitedUser(ctx context.Context, id string, input RegistrationInput) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, sqliteRegistrationQuery, input.ID, input.Phone, input.Name, input.Password, input.Salt, sqliteNullTime(input.PhoneVerifiedAt), input.OTPLoginEnabled)
+	if err != nil {
+		err = sqliteError(err)
+		return
+	}
+	err = sqliteAcceptInvitation(ctx, tx, id, input.ID)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// sqliteAcceptInvitation : mark invitation accepted and add the membership, the role of existing members is kept
+func sqliteAcceptInvitation(ctx context.Context, tx *sql.Tx, id string, userID string) (err error) {
+	var organizationID, role string
+	err = tx.QueryRowContext(ctx, "UPDATE organization_invitation SET accepted_at="+sqliteNow+", accepted_by=?1 WHERE id=?2 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > "+sqliteNow+" RETURNING organization_id, role", userID, id).Scan(&organizationID, &role)
+	if err != nil {
+		err = sqliteError(err)
+		return
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO organization_member (organization_id, user_id, role) VALUES (?1, ?2, ?3) ON CONFLICT (organization_id, user_id) DO NOTHING", organizationID, userID, role)
+	return sqliteError(err)
+}
+
+// sqliteAffected : ErrNotFound when the statement changed no row
+func sqliteAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// sqliteError : typed error of the error returned by SQLite like driverError does for Postgres, other errors are returned as is
+func sqliteError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+	if sqliteErr.ExtendedCode != sqlite3.ErrConstraintUnique && sqliteErr.ExtendedCode != sqlite3.ErrConstraintPrimaryKey {
+		return err
+	}
+
+	// SQLite names the columns instead of the constraint, e.g. UNIQUE constraint failed: user.phone
+	switch {
+	case strings.HasSuffix(sqliteErr.Error(), " user.phone"):
+		return ErrDuplicatePhone
+	case strings.HasSuffix(sqliteErr.Error(), " user.email"):
+		return ErrDuplicateEmail
+	}
+	return ErrConflict
+}
+
+// sqliteTime : time bound as timestamps are stored, see sqliteNow
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeFormat)
+}
+
+// sqliteNullTime : sqliteTime of the time, nil stays NULL
+func sqliteNullTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return sqliteTime(*t)
+}
+
+// sqliteDate : date of a time or a time pointer as DATE columns are stored, other values are bound as is
+func sqliteDate(value interface{}) interface{} {
+	switch value := value.(type) {
+	case time.Time:
+		return value.UTC().Format("2006-01-02")
+	case *time.Time:
+		if value == nil {
+			return nil
+		}
+		return value.UTC().Format("2006-01-02")
+	}
+	return value
+}
+
+// sqliteArg : value of a param or patch bound as it is stored, times become text of fixed width and other values are bound as is
+func sqliteArg(value interface{}) interface{} {
+	switch value := value.(type) {
+	case time.Time:
+		return sqliteTime(value)
+	case *time.Time:
+		return sqliteNullTime(value)
+	}
+	return value
+}
+
+// stringArray : []string stored as JSON array, what pq.Array is for Postgres arrays
+type stringArray []string
+
+func (a stringArray) Value() (driver.Value, error) {
+	if a == nil {
+		return "[]", nil
+	}
+	encoded, err := json.Marshal([]string(a))
+	if err != nil {
+		return nil, err
+	}
+	return string(encoded), nil
+}
+
+func (a *stringArray) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(src), (*[]string)(a))
+	case []byte:
+		return json.Unmarshal(src, (*[]string)(a))
+	}
+	return fmt.Errorf("cannot scan %T into a string array", src)
+}
@@ -0,0 +1,161 @@
+/**
+  SQLite schema equivalent to database.sql for on-site servers without Postgres.
+  Timestamps are UTC text of fixed width so they compare in order, arrays and JSONB are JSON text,
+  the lengths of VARCHAR columns are checks since SQLite does not enforce them.
+  */
+
+CREATE TABLE IF NOT EXISTS test (
+    id INTEGER PRIMARY KEY,
+    name TEXT UNIQUE NOT NULL CHECK (length(name) <= 50)
+);
+
+INSERT INTO test (name) VALUES ('test1');
+INSERT INTO test (name) VALUES ('test2');
+
+CREATE TABLE IF NOT EXISTS user (
+    id TEXT PRIMARY KEY,
+    phone TEXT UNIQUE NOT NULL CHECK (length(phone) <= 16),
+    name TEXT NOT NULL CHECK (length(name) <= 60),
+    password TEXT NOT NULL CHECK (length(password) <= 64),
+    salt TEXT NOT NULL CHECK (length(salt) <= 64),
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000+00:00', 'now')),
+    success_login INTEGER NOT NULL DEFAULT 0,
+    version INTEGER NOT NULL DEFAULT 1,
+    email TEXT CHECK (length(email) <= 254),
+    email_verified_at TIMESTAMP,
+    preferred_language TEXT CHECK (length(preferred_language) <= 35),
+    avatar_url TEXT CHECK (length(avatar_url) <= 255),
+    date_of_birth DATE,
+    address TEXT CHECK (length(address) <= 255),
+    estate TEXT CHECK (length(estate) <= 100),
+    region TEXT CHECK (length(region) <= 100),
+    tenant TEXT NOT NULL DEFAULT 'default' CHECK (length(tenant) <= 64),
+    attributes TEXT NOT NULL DEFAULT '{}' CHECK (json_valid(attributes)),
+    avatar_key TEXT CHECK (length(avatar_key) <= 255),
+    otp_login_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    phone_verified_at TIMESTAMP,
+    /** Id of the user in the identity provider of the tenant that provisioned it with SCIM */
+    external_id TEXT CHECK (length(external_id) <= 255),
+    /** Deactivated users cannot login, set when the identity provider deprovisions the user */
+    deactivated_at TIMESTAMP,
+    updated_at TIMESTAMP
+);
+
+/** Email is an optional login identifier, stored in lower case */
+CREATE UNIQUE INDEX IF NOT EXISTS user_email_key ON user (email);
+
+/** SCIM lists the users of a tenant by external id or page by page */
+CREATE INDEX IF NOT EXISTS user_tenant_external_id_idx ON user (tenant, external_id);
+
+/** JSON Schema used to validate the custom attributes of users that belong to a tenant */
+CREATE TABLE IF NOT EXISTS tenant_attribute_schema (
+    tenant TEXT PRIMARY KEY CHECK (length(tenant) <= 64),
+    schema TEXT NOT NULL CHECK (json_valid(schema)),
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000+00:00', 'now')),
+    updated_at TIMESTAMP
+);
+
+/** One time passcodes sent by SMS for passwordless login, only the hash of the code is stored */
+CREATE TABLE IF NOT EXISTS login_otp (
+    id INTEGER PRIMARY KEY,
+    phone TEXT NOT NULL CHECK (length(phone) <= 16),
+    code_hash TEXT NOT NULL CHECK (length(code_hash) <= 64),
+    salt TEXT NOT NULL CHECK (length(salt) <= 64),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000+00:00', 'now'))
+);
+
+/** Latest passcode lookup and per phone rate limiting */
+CREATE INDEX IF NOT EXISTS login_otp_phone_created_at_idx ON login_otp (phone, created_at);
+
+/** Token buckets of the rate limiter, shared by every instance of the service */
+CREATE TABLE IF NOT EXISTS rate_limit_bucket (
+    key TEXT PRIMARY KEY CHECK (length(key) <= 255),
+    tokens REAL NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+/** Personal access tokens used by integrations instead of the password, only the SHA-256 of the token is stored */
+CREATE TABLE IF NOT EXISTS personal_access_token (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES user (id) ON DELETE CASCADE,
+    name TEXT NOT NULL CHECK (length(name) <= 100),
+    token_hash TEXT UNIQUE NOT NULL CHECK (length(token_hash) <= 64),
+    prefix TEXT NOT NULL CHECK (length(prefix) <= 20),
+    scopes TEXT NOT NULL CHECK (json_type(scopes) = 'array'),
+    expires_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000+00:00', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS personal_access_token_user_id_idx ON personal_access_token (user_id);
+
+/** OAuth clients of internal services using the client credentials grant, only the SHA-256 of the secret is stored */
+CREATE TABLE IF NOT EXISTS oauth_client (
+    id TEXT PRIMARY KEY CHECK (length(id) <= 64),
+    name TEXT NOT NULL CHECK (length(name) <= 100),
+    secret_hash TEXT NOT NULL CHECK (length(secret_hash) <= 64),
+    scopes TEXT NOT NULL CHECK (json_type(scopes) = 'array'),
+    redirect_uris TEXT NOT NULL DEFAULT '[]' CHECK (json_type(redirect_uris) = 'array'),
+    /** Tenant whose users and groups the client provisions with SCIM */
+    tenant TEXT CHECK (length(tenant) <= 64),
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000+00:00', 'now'))
+);
+
+/** OpenID Connect authorization codes, single use and short lived, only the SHA-256 of the code is stored */
+CREATE TABLE IF NOT EXISTS oauth_authorization_code (
+    code_hash TEXT PRIMARY KEY CHECK (length(code_hash) <= 64),
+    client_id TEXT NOT NULL REFERENCES oauth_client (id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES user (id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT NOT NULL CHECK (json_type(scopes) = 'array'),
+    nonce TEXT NOT NULL DEFAULT '' CHECK (length(nonce) <= 255),
+    code_challenge TEXT NOT NULL CHECK (length(code_challenge) <= 128),
+    auth_time TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+
+/** Organizations such as estates and cooperatives, users belong to one or more of them */
+CREATE TABLE IF NOT EXISTS organization (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL CHECK (length(name) <= 100),
+    /** Tenant of organizations provisioned as SCIM groups, NULL for organizations created by users */
+    tenant TEXT CHECK (length(tenant) <= 64),
+    external_id TEXT CHECK (length(external_id) <= 255),
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000+00:00', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS organization_tenant_idx ON organization (tenant) WHERE tenant IS NOT NULL;
+
+/** Members of organizations with their per organization role */
+CREATE TABLE IF NOT EXISTS organization_member (
+    organization_id TEXT NOT NULL REFERENCES organization (id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES user (id) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('owner', 'admin', 'member')),
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000+00:00', 'now')),
+    PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS organization_member_user_id_idx ON organization_member (user_id);
+
+/** Invitations to join an organization sent by SMS, only the SHA-256 of the token is stored */
+CREATE TABLE IF NOT EXISTS organization_invitation (
+    id TEXT PRIMARY KEY,
+    organization_id TEXT NOT NULL REFERENCES organization (id) ON DELETE CASCADE,
+    phone TEXT NOT NULL CHECK (length(phone) <= 16),
+    role TEXT NOT NULL CHECK (role IN ('owner', 'admin', 'member')),
+    token_hash TEXT UNIQUE NOT NULL CHECK (length(token_hash) <= 64),
+    invited_by TEXT REFERENCES user (id) ON DELETE SET NULL,
+    expires_at TIMESTAMP NOT NULL,
+    accepted_at TIMESTAMP,
+    accepted_by TEXT REFERENCES user (id) ON DELETE SET NULL,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000+00:00', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS organization_invitation_organization_id_idx ON organization_invitation (organization_id, created_at);
@@ -0,0 +1,26 @@
+/**
+  Offline sync of profiles, see database.sql. SQLite has no sequences, the change sequence of a user is
+  the highest one in the table plus one, existing users get the order they were inserted in.
+  */
+
+ALTER TABLE user ADD COLUMN change_seq INTEGER NOT NULL DEFAULT 0;
+
+UPDATE user SET change_seq = rowid;
+
+CREATE INDEX IF NOT EXISTS user_change_seq_idx ON user (change_seq);
+
+CREATE TRIGGER IF NOT EXISTS user_change_seq_insert AFTER INSERT ON user
+BEGIN
+    UPDATE user SET change_seq = (SELECT MAX(change_seq) FROM user) + 1 WHERE id = NEW.id;
+END;
+
+/** Outcome of profile mutations submitted by offline devices, a replayed mutation returns the stored outcome instead of being applied again */
+CREATE TABLE IF NOT EXISTS user_sync_mutation (
+    user_id TEXT NOT NULL REFERENCES user (id) ON DELETE CASCADE,
+    id TEXT NOT NULL CHECK (length(id) <= 64),
+    field TEXT NOT NULL CHECK (length(field) <= 32),
+    status TEXT NOT NULL CHECK (status IN ('applied', 'rejected')),
+    message TEXT NOT NULL DEFAULT '' CHECK (length(message) <= 255),
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000+00:00', 'now')),
+    PRIMARY KEY (user_id, id)
+);
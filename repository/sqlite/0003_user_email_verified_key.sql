@@ -0,0 +1,5 @@
+/** Only verified emails are unique, see database.sql */
+
+DROP INDEX IF EXISTS user_email_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS user_email_key ON user (email) WHERE email_verified_at IS NOT NULL;
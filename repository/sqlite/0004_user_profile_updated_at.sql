@@ -0,0 +1,8 @@
+/**
+  When the profile was last changed, set together with change_seq, see database.sql.
+  Existing users only have updated_at, which logins change too, so their offline edits may lose a conflict once more.
+  */
+
+ALTER TABLE user ADD COLUMN profile_updated_at TIMESTAMP;
+
+UPDATE user SET profile_updated_at = updated_at;
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteRepositoryContract(t *testing.T) {
+	runContract(t, func(t *testing.T) RepositoryInterface {
+		repo := NewRepository(NewRepositoryOptions{Dsn: "sqlite::memory:"}).(*SQLiteRepository)
+		t.Cleanup(func() { repo.Db.Close() })
+		return repo
+	})
+}
+
+func TestSQLiteRepositoryMigrations(t *testing.T) {
+	ctx := context.Background()
+	dsn := "sqlite://" + filepath.Join(t.TempDir(), "user.db")
+	repo := NewRepository(NewRepositoryOptions{Dsn: dsn}).(*SQLiteRepository)
+	id := contractUser(t, repo, "+628111111111")
+	require.NoError(t, repo.Db.Close())
+
+	// Reopening the database keep its data and apply no migration twice
+	repo = NewRepository(NewRepositoryOptions{Dsn: dsn}).(*SQLiteRepository)
+	defer repo.Db.Close()
+	var version int
+	require.NoError(t, repo.Db.QueryRow("PRAGMA user_version").Scan(&version))
+	names, err := sqliteMigrations.ReadDir("sqlite")
+	require.NoError(t, err)
+	assert.Equal(t, len(names), version)
+	assert.Equal(t, "+628111111111", findUserByID(t, repo, id).Phone)
+	output, err := repo.GetTestById(ctx, GetTestByIdInput{Id: "2"})
+	assert.NoError(t, err)
+	assert.Equal(t, "test2", output.Name)
+
+	// A database migrated by a newer build is refused
+	_, err = repo.Db.Exec("PRAGMA user_version = 1000")
+	require.NoError(t, err)
+	_, err = newSQLiteRepository(dsn)
+	assert.ErrorContains(t, err, "newer than")
+}
+
+func TestSQLiteRepositoryConstraints(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepository(NewRepositoryOptions{Dsn: "sqlite::memory:"}).(*SQLiteRepository)
+	defer repo.Db.Close()
+
+	// Lengths of VARCHAR columns are enforced like Postgres
+	_, err := repo.Registration(ctx, RegistrationInput{ID: "1", Phone: "+6281111111111111", Name: "Budi", Password: "hash", Salt: "salt"})
+	var sqliteErr sqlite3.Error
+	require.ErrorAs(t, err, &sqliteErr)
+	assert.Equal(t, sqlite3.ErrConstraintCheck, sqliteErr.ExtendedCode)
+
+	id := contractUser(t, repo, "+628111111111")
+	assert.Error(t, repo.PatchUser(ctx, PatchUser{ID: id, Version: 1, Fields: map[string]interface{}{"estate": strings.Repeat("a", 101)}}))
+	assert.Error(t, repo.AddMember(ctx, "missing", id, "guest"))
+}
+
+func TestSQLiteTimeOrder(t *testing.T) {
+	// Stored timestamps compare as text in the order of time, whatever the zone of the bound time
+	jakarta := time.FixedZone("WIB", 7*60*60)
+	earlier := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	later := time.Date(2024, 1, 1, 17, 0, 0, 1000, jakarta)
+	assert.Less(t, sqliteTime(earlier), sqliteTime(later))
+	assert.Equal(t, "2024-01-01 10:00:00.000001+00:00", sqliteTime(later))
+	assert.Equal(t, "1990-05-17", sqliteDate(time.Date(1990, 5, 17, 0, 0, 0, 0, time.UTC)))
+	assert.Nil(t, sqliteDate((*time.Time)(nil)))
+}
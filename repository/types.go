@@ -1,6 +1,8 @@
 // This file contains types that are used in the repository layer.
 package repository
 
+import "time"
+
 type GetTestByIdInput struct {
 	Id string
 }
@@ -15,6 +17,10 @@ type RegistrationInput struct {
 	Name     string
 	Password string
 	Salt     string
+	// PhoneVerifiedAt is set when the user proved owning the phone, e.g. by accepting an invitation sent to it
+	PhoneVerifiedAt *time.Time
+	// OTPLoginEnabled is set for imported users without password, they login with SMS one time passcode
+	OTPLoginEnabled bool
 }
 
 type RegistrationOutput struct {
@@ -22,17 +28,219 @@ type RegistrationOutput struct {
 }
 
 type User struct {
-	ID       string
-	Phone    string
-	Name     string
-	Password string
-	Salt     string
+	ID                string
+	Phone             string
+	Name              string
+	Password          string
+	Salt              string
+	Version           int
+	Email             *string
+	EmailVerifiedAt   *time.Time
+	PreferredLanguage *string
+	AvatarURL         *string
+	DateOfBirth       *time.Time
+	Address           *string
+	Estate            *string
+	Region            *string
+	Tenant            string
+	Attributes        map[string]interface{}
+	// AvatarKey is the blob storage key prefix of uploaded avatar thumbnails
+	AvatarKey *string
+	// OTPLoginEnabled allow the user to login with SMS one time passcode instead of password
+	OTPLoginEnabled bool
+	PhoneVerifiedAt *time.Time
+	// ExternalID is the id of the user in the identity provider that provisioned it with SCIM
+	ExternalID *string
+	// DeactivatedAt is set when the user is deprovisioned, deactivated users cannot login
+	DeactivatedAt *time.Time
+	CreatedAt     time.Time
+	UpdatedAt     *time.Time
+	// ChangeSeq is taken from a sequence shared by every user whenever the version is incremented, offline devices sync the changes after the last one they saw
+	ChangeSeq int64
+	// ProfileUpdatedAt is set together with ChangeSeq, logins and email verification change UpdatedAt but not the profile. Nil until the user is changed after it was created
+	ProfileUpdatedAt *time.Time
+}
+
+// ExportUser : user as exported in bulk, it has no password or salt so secrets cannot be exported by mistake
+type ExportUser struct {
+	ID                string
+	Phone             string
+	Name              string
+	Version           int
+	Email             *string
+	EmailVerifiedAt   *time.Time
+	PreferredLanguage *string
+	AvatarURL         *string
+	DateOfBirth       *time.Time
+	Address           *string
+	Estate            *string
+	Region            *string
+	Tenant            string
+	// Attributes is the JSON object as stored
+	Attributes      []byte
+	OTPLoginEnabled bool
+	PhoneVerifiedAt *time.Time
+	CreatedAt       time.Time
+	UpdatedAt       *time.Time
+}
+
+// ExportFilter : users returned by ExportUsers, empty fields do not filter
+type ExportFilter struct {
+	Tenant        string
+	Estate        string
+	Region        string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// After is the id of the last user of the previous page, pages are ordered by id
+	After string
+	Limit int
 }
 
 type UpdateUser struct {
-	ID    string
+	ID                string
+	Phone             string
+	Name              string
+	Email             *string
+	PreferredLanguage *string
+	AvatarURL         *string
+	DateOfBirth       *time.Time
+	Address           *string
+	Estate            *string
+	Region            *string
+	Attributes        map[string]interface{}
+	// Version is the version the caller read, the update only applies when it still matches
+	Version int
+}
+
+type PatchUser struct {
+	ID string
+	// Version is the version the caller read, the patch only applies when it still matches
+	Version int
+	// Fields contains column name and its new value, nil value set the column to NULL
+	Fields map[string]interface{}
+}
+
+// Outcomes of the profile mutations of offline devices
+const (
+	SyncApplied  = "applied"
+	SyncRejected = "rejected"
+)
+
+// SyncMutation : outcome of a profile mutation submitted by an offline device, kept so a replayed mutation gets the same outcome
+type SyncMutation struct {
+	// ID is generated by the device, unique among the mutations of the user
+	ID     string
+	UserID string
+	Field  string
+	Status string
+	// Message tells why the mutation was rejected
+	Message   string
+	CreatedAt time.Time
+}
+
+// SyncUser : profile changes merged from the mutations of an offline device, stored together with the outcome of every mutation
+type SyncUser struct {
+	// PatchUser is skipped when Fields is empty, e.g. every mutation was rejected
+	PatchUser
+	// Mutations already stored for the user are kept as they are
+	Mutations []SyncMutation
+}
+
+type LoginOTP struct {
+	ID    int64
 	Phone string
-	Name  string
+	// CodeHash is the bcrypt hash of the passcode and Salt, the passcode itself is never stored
+	CodeHash  string
+	Salt      string
+	Attempts  int
+	ExpiresAt time.Time
+}
+
+type PersonalAccessToken struct {
+	ID     string
+	UserID string
+	Name   string
+	// TokenHash is the SHA-256 of the token, the token itself is only shown once when it is created
+	TokenHash string
+	// Prefix is the start of the token, shown in listings so the user can recognize the token
+	Prefix     string
+	Scopes     []string
+	ExpiresAt  time.Time
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+type OAuthClient struct {
+	ID   string
+	Name string
+	// SecretHash is the SHA-256 of the client secret, the secret itself is only shown once when the client is created
+	SecretHash string
+	// Scopes are the scopes the client may request
+	Scopes []string
+	// RedirectURIs are where users are sent back after signing in with OpenID Connect
+	RedirectURIs []string
+	// Tenant is the tenant whose users and groups the client provisions with SCIM
+	Tenant    *string
+	CreatedAt time.Time
+}
+
+type AuthorizationCode struct {
+	// CodeHash is the SHA-256 of the code, the code itself is only sent to the redirect uri
+	CodeHash    string
+	ClientID    string
+	UserID      string
+	RedirectURI string
+	Scopes      []string
+	Nonce       string
+	// CodeChallenge is the PKCE S256 challenge the code verifier must match
+	CodeChallenge string
+	// AuthTime is when the user entered the password
+	AuthTime  time.Time
+	ExpiresAt time.Time
+}
+
+// Roles of organization members, owners and admins manage members and only owners manage owners
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+type Organization struct {
+	ID   string
+	Name string
+	// Tenant is set for organizations provisioned as SCIM groups of the tenant
+	Tenant     *string
+	ExternalID *string
+	CreatedAt  time.Time
+}
+
+type Membership struct {
+	OrganizationID   string
+	OrganizationName string
+	UserID           string
+	Name             string
+	Phone            string
+	Role             string
+	// CreatedAt is when the user joined the organization
+	CreatedAt time.Time
+}
+
+type Invitation struct {
+	ID               string
+	OrganizationID   string
+	OrganizationName string
+	Phone            string
+	// Role is given to the user when the invitation is accepted
+	Role string
+	// TokenHash is the SHA-256 of the token, the token itself is only sent by SMS
+	TokenHash  string
+	InvitedBy  string
+	ExpiresAt  time.Time
+	AcceptedAt *time.Time
+	AcceptedBy *string
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
 }
 
 type Param struct {
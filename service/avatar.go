@@ -0,0 +1,55 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+
+	"github.com/labstack/gommon/log"
+)
+
+// AvatarSizes : square thumbnail sizes generated for every avatar, largest first
+var AvatarSizes = []int{512, 256, 128, 64}
+
+// AvatarObjectKey : key of the thumbnail object of given size
+func AvatarObjectKey(avatarKey string, size int) string {
+	return avatarKey + "/" + strconv.Itoa(size) + ".jpg"
+}
+
+// UpdateAvatar : store the JPEG thumbnails of AvatarSizes as the new avatar of the user and remove the old one
+func (u *UserService) UpdateAvatar(ctx context.Context, id string, thumbnails map[int][]byte) error {
+	user, err := u.GetUser(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// Every upload get new key so cached thumbnails of the old avatar are never served as the new one
+	avatarKey := "avatars/" + user.ID + "/" + u.IDs.NewID()
+	for size, thumbnail := range thumbnails {
+		err = u.BlobStore.Put(ctx, AvatarObjectKey(avatarKey, size), bytes.NewReader(thumbnail), "image/jpeg")
+		if err != nil {
+			u.deleteAvatar(ctx, avatarKey)
+			return err
+		}
+	}
+
+	err = u.Repository.UpdateAvatarKey(ctx, user.ID, avatarKey)
+	if err != nil {
+		u.deleteAvatar(ctx, avatarKey)
+		return err
+	}
+
+	if user.AvatarKey != nil {
+		u.deleteAvatar(ctx, *user.AvatarKey)
+	}
+	return nil
+}
+
+// deleteAvatar : remove all thumbnails of the avatar, failure is only logged because the key is no longer referenced
+func (u *UserService) deleteAvatar(ctx context.Context, avatarKey string) {
+	for _, size := range AvatarSizes {
+		if err := u.BlobStore.Delete(ctx, AvatarObjectKey(avatarKey, size)); err != nil {
+			log.Error(err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserService_UpdateAvatar(t *testing.T) {
+	oldKey := "avatars/id-1/old"
+	newKey := "avatars/id-1/new"
+	userParam := repository.Param{Logic: "AND", Field: "id", Operator: "=", Value: "id-1"}
+	thumbnails := map[int][]byte{512: []byte("avatar-512"), 256: []byte("avatar-256"), 128: []byte("avatar-128"), 64: []byte("avatar-64")}
+
+	tests := []struct {
+		name    string
+		prepare func(f fields)
+		err     error
+		// avatar : key whose thumbnails remain stored
+		avatar string
+	}{
+		{
+			name: "Success",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(repository.User{ID: "id-1", AvatarKey: &oldKey}, nil)
+				f.ids.EXPECT().NewID().Return("new")
+				f.repo.EXPECT().UpdateAvatarKey(gomock.Any(), "id-1", newKey).Return(nil)
+			},
+			avatar: newKey,
+		}, {
+			name: "Unknown user",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(repository.User{}, repository.ErrNotFound)
+			},
+			err:    ErrUserNotFound,
+			avatar: oldKey,
+		}, {
+			name: "Failed update avatar key",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(repository.User{ID: "id-1", AvatarKey: &oldKey}, nil)
+				f.ids.EXPECT().NewID().Return("new")
+				f.repo.EXPECT().UpdateAvatarKey(gomock.Any(), "id-1", newKey).Return(fmt.Errorf("error"))
+			},
+			err:    fmt.Errorf("error"),
+			avatar: oldKey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			u, f := newTestService(t, false)
+			u.BlobStore = storage.NewLocalStore(storage.NewLocalStoreOptions{Root: t.TempDir()})
+			for _, size := range AvatarSizes {
+				assert.NoError(t, u.BlobStore.Put(ctx, AvatarObjectKey(oldKey, size), strings.NewReader("old"), "image/jpeg"))
+			}
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			err := u.UpdateAvatar(ctx, "id-1", thumbnails)
+			assert.Equal(t, tt.err, err)
+
+			// Only the thumbnails of the current avatar remain
+			for _, key := range []string{oldKey, newKey} {
+				for _, size := range AvatarSizes {
+					body, _, err := u.BlobStore.Get(ctx, AvatarObjectKey(key, size))
+					if key != tt.avatar {
+						assert.ErrorIs(t, err, storage.ErrNotFound, key)
+						continue
+					}
+					if assert.NoError(t, err, key) {
+						data, _ := io.ReadAll(body)
+						body.Close()
+						if key == newKey {
+							assert.Equal(t, thumbnails[size], data)
+						}
+					}
+				}
+			}
+		})
+	}
+}
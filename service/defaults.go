@@ -0,0 +1,51 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BcryptHasher : hash passwords with bcrypt default cost, the salt is appended to the password
+type BcryptHasher struct{}
+
+func (BcryptHasher) Hash(password string, salt string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password+salt), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (BcryptHasher) Compare(hash string, password string, salt string) error {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password+salt))
+}
+
+// RandomSaltGenerator : base64 of 16 random bytes
+type RandomSaltGenerator struct{}
+
+func (RandomSaltGenerator) Generate() (string, error) {
+	randomBytes := make([]byte, 16)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(randomBytes), nil
+}
+
+// SystemClock : time of the system
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// UUIDGenerator : random UUID v4
+type UUIDGenerator struct{}
+
+func (UUIDGenerator) NewID() string {
+	return uuid.NewString()
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRandomSaltGenerator(t *testing.T) {
+	salt, err := RandomSaltGenerator{}.Generate()
+	assert.NoError(t, err)
+
+	// Assert that the length of the generated salt is 24 characters (encoded base64 representation of 16 random bytes)
+	assert.Equal(t, 24, len(salt))
+
+	// Decode the salt and assert that it is a valid base64 string of 16 bytes
+	decodedSalt, decodeErr := base64.StdEncoding.DecodeString(salt)
+	assert.NoError(t, decodeErr)
+	assert.Equal(t, 16, len(decodedSalt))
+}
+
+func TestBcryptHasher(t *testing.T) {
+	// Set a known password and salt
+	password := "MySecurePassword"
+	salt := "RandomSalt123"
+
+	hashedPassword, err := BcryptHasher{}.Hash(password, salt)
+	assert.NoError(t, err)
+
+	// The hash is bcrypt of the password followed by the salt, existing hashes stay valid
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password+salt)))
+	assert.NoError(t, BcryptHasher{}.Compare(hashedPassword, password, salt))
+	assert.Error(t, BcryptHasher{}.Compare(hashedPassword, password, "OtherSalt"))
+	assert.Error(t, BcryptHasher{}.Compare(hashedPassword, "WrongPassword", salt))
+}
+
+func TestUUIDGenerator(t *testing.T) {
+	id := UUIDGenerator{}.NewID()
+	_, err := uuid.Parse(id)
+	assert.NoError(t, err)
+	assert.NotEqual(t, id, UUIDGenerator{}.NewID())
+}
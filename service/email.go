@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/notification"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/labstack/gommon/log"
+)
+
+// emailVerificationTTL : how long the link sent by SendEmailVerification can be opened
+const emailVerificationTTL = 24 * time.Hour
+
+// SendEmailVerification : send verification link to the email of the user
+func (u *UserService) SendEmailVerification(ctx context.Context, id string) error {
+	user, err := u.GetUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	if user.Email == nil {
+		return ErrEmailNotSet
+	}
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+
+	// Link is bound to the current email, it become invalid when the email is changed
+	token, err := u.Tokens.IssueEmailVerificationToken(user.ID, *user.Email, u.Clock.Now().Add(emailVerificationTTL))
+	if err != nil {
+		return err
+	}
+
+	err = u.EmailNotifier.Notify(ctx, notification.Message{
+		To:      *user.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease verify your email by opening the link below. The link is valid for %d hours.\n\n%s/email/verify?token=%s\n",
+			user.Name, int(emailVerificationTTL.Hours()), u.BaseURL, url.QueryEscape(token)),
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotificationFailed, err)
+	}
+	return nil
+}
+
+// VerifyEmail : verify the email of the link sent by SendEmailVerification
+func (u *UserService) VerifyEmail(ctx context.Context, token string) error {
+	id, email, err := u.Tokens.ParseEmailVerificationToken(token)
+	if err != nil {
+		log.Error(err)
+		return ErrInvalidVerificationLink
+	}
+
+	err = u.Repository.VerifyEmail(ctx, id, email)
+	if errors.Is(err, repository.ErrNotFound) {
+		// Email has been changed after the link was sent
+		return ErrInvalidVerificationLink
+	}
+	if errors.Is(err, repository.ErrDuplicateEmail) {
+		// Unverified emails are not unique, the address belongs to the first user that verified it
+		return ErrDuplicateEmail
+	}
+	return err
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/SawitProRecruitment/UserService/notification"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserService_SendEmailVerification(t *testing.T) {
+	email := "user@example.com"
+	user := repository.User{ID: "id-1", Phone: "+62856712332", Name: "User", Email: &email}
+	userParam := repository.Param{Logic: "AND", Field: "id", Operator: "=", Value: "id-1"}
+
+	tests := []struct {
+		name    string
+		prepare func(f fields)
+		err     error
+	}{
+		{
+			name: "Success",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(user, nil)
+				f.tokens.EXPECT().IssueEmailVerificationToken("id-1", email, testNow.Add(emailVerificationTTL)).Return("token+1", nil)
+				f.emails.EXPECT().Notify(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, message notification.Message) error {
+					assert.Equal(t, email, message.To)
+					assert.Contains(t, message.Body, "http://localhost:8080/email/verify?token=token%2B1")
+					return nil
+				})
+			},
+		}, {
+			name: "Unknown user",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(repository.User{}, repository.ErrNotFound)
+			},
+			err: ErrUserNotFound,
+		}, {
+			name: "Email not set",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(repository.User{ID: "id-1"}, nil)
+			},
+			err: ErrEmailNotSet,
+		}, {
+			name: "Email already verified",
+			prepare: func(f fields) {
+				verified := user
+				verified.EmailVerifiedAt = &testNow
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(verified, nil)
+			},
+			err: ErrEmailAlreadyVerified,
+		}, {
+			name: "Failed issue token",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(user, nil)
+				f.tokens.EXPECT().IssueEmailVerificationToken("id-1", email, gomock.Any()).Return("", fmt.Errorf("sign"))
+			},
+			err: fmt.Errorf("sign"),
+		}, {
+			name: "Failed send email",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(user, nil)
+				f.tokens.EXPECT().IssueEmailVerificationToken("id-1", email, gomock.Any()).Return("token", nil)
+				f.emails.EXPECT().Notify(gomock.Any(), gomock.Any()).Return(fmt.Errorf("smtp"))
+			},
+			err: fmt.Errorf("%w: %v", ErrNotificationFailed, fmt.Errorf("smtp")),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, f := newTestService(t, false)
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			err := u.SendEmailVerification(context.Background(), "id-1")
+			assert.Equal(t, tt.err, err)
+		})
+	}
+}
+
+func TestUserService_VerifyEmail(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(f fields)
+		err     error
+	}{
+		{
+			name: "Success",
+			prepare: func(f fields) {
+				f.tokens.EXPECT().ParseEmailVerificationToken("token").Return("id-1", "user@example.com", nil)
+				f.repo.EXPECT().VerifyEmail(gomock.Any(), "id-1", "user@example.com").Return(nil)
+			},
+		}, {
+			name: "Invalid or expired token",
+			prepare: func(f fields) {
+				f.tokens.EXPECT().ParseEmailVerificationToken("token").Return("", "", fmt.Errorf("expired"))
+			},
+			err: ErrInvalidVerificationLink,
+		}, {
+			name: "Email changed after the link was sent",
+			prepare: func(f fields) {
+				f.tokens.EXPECT().ParseEmailVerificationToken("token").Return("id-1", "user@example.com", nil)
+				f.repo.EXPECT().VerifyEmail(gomock.Any(), "id-1", "user@example.com").Return(repository.ErrNotFound)
+			},
+			err: ErrInvalidVerificationLink,
+		}, {
+			name: "Email verified by another user",
+			prepare: func(f fields) {
+				f.tokens.EXPECT().ParseEmailVerificationToken("token").Return("id-1", "user@example.com", nil)
+				f.repo.EXPECT().VerifyEmail(gomock.Any(), "id-1", "user@example.com").Return(repository.ErrDuplicateEmail)
+			},
+			err: ErrDuplicateEmail,
+		}, {
+			name: "Failed verify email",
+			prepare: func(f fields) {
+				f.tokens.EXPECT().ParseEmailVerificationToken("token").Return("id-1", "user@example.com", nil)
+				f.repo.EXPECT().VerifyEmail(gomock.Any(), "id-1", "user@example.com").Return(fmt.Errorf("error"))
+			},
+			err: fmt.Errorf("error"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, f := newTestService(t, false)
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			err := u.VerifyEmail(context.Background(), "token")
+			assert.Equal(t, tt.err, err)
+		})
+	}
+}
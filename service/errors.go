@@ -0,0 +1,50 @@
+package service
+
+import "errors"
+
+var (
+	// ErrDuplicatePhone : the phone number is registered to another user
+	ErrDuplicatePhone = errors.New("phone number already exist")
+	// ErrDuplicateEmail : the email is used by another user
+	ErrDuplicateEmail = errors.New("email already exist")
+	// ErrUserNotFound : no user matches the phone number, email or id
+	ErrUserNotFound = errors.New("user not found")
+	// ErrInvalidPassword : the password does not match the user
+	ErrInvalidPassword = errors.New("invalid password")
+	// ErrInvalidCredentials : unknown user or wrong password when enumeration protection hides which one it is
+	ErrInvalidCredentials = errors.New("invalid phone number, email or password")
+	// ErrEmailNotVerified : unverified email cannot be used to login
+	ErrEmailNotVerified = errors.New("email is not verified")
+	// ErrUserDeactivated : the account is deactivated and cannot login
+	ErrUserDeactivated = errors.New("account is deactivated")
+	// ErrProfileModified : the profile changed since the version the client edited
+	ErrProfileModified = errors.New("profile has been modified")
+	// ErrInvalidOTP : the passcode is wrong, expired, used or out of attempts, or the phone cannot login with OTP when enumeration protection hides it
+	ErrInvalidOTP = errors.New("invalid or expired otp")
+	// ErrOTPLoginDisabled : the user did not allow login with OTP
+	ErrOTPLoginDisabled = errors.New("otp login is not enabled")
+	// ErrTooManyOTPRequests : OTPRateLimit passcodes were sent to the phone within OTPRateWindow
+	ErrTooManyOTPRequests = errors.New("too many otp requests")
+	// ErrEmailNotSet : the user has no email to verify
+	ErrEmailNotSet = errors.New("email is not set")
+	// ErrEmailAlreadyVerified : the email of the user is verified already
+	ErrEmailAlreadyVerified = errors.New("email already verified")
+	// ErrInvalidVerificationLink : the verification token is invalid or expired, or the email changed after it was sent
+	ErrInvalidVerificationLink = errors.New("invalid or expired verification link")
+	// ErrNotificationFailed : the SMS or email could not be sent
+	ErrNotificationFailed = errors.New("notification could not be sent")
+)
+
+// ValidationError : input rejected by a business rule, Message is shown to the client as is
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// invalid : validation error with the message
+func invalid(message string) error {
+	return &ValidationError{Message: message}
+}
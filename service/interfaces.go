@@ -0,0 +1,37 @@
+// This file contains the interfaces for the service layer.
+// The service layer holds the business rules shared by the REST and gRPC interfaces.
+// For testing purpose we will generate mock implementations of these
+// interfaces using mockgen. See the Makefile for more information.
+package service
+
+import "time"
+
+type PasswordHasher interface {
+	// Hash : hash of the password combined with the salt
+	Hash(password string, salt string) (hash string, err error)
+	// Compare : nil when the password combined with the salt matches the hash
+	Compare(hash string, password string, salt string) (err error)
+}
+
+type SaltGenerator interface {
+	// Generate : random salt stored next to the hash of a new password
+	Generate() (salt string, err error)
+}
+
+type TokenIssuer interface {
+	// IssueUserToken : signed access token of the user, organizationID is empty when the user has no active organization
+	IssueUserToken(userID string, organizationID string, exp time.Time) (token string, err error)
+	// IssueEmailVerificationToken : signed token of the email verification link, bound to the email it was sent to
+	IssueEmailVerificationToken(userID string, email string, exp time.Time) (token string, err error)
+	// ParseEmailVerificationToken : user id and email of a valid email verification token
+	ParseEmailVerificationToken(token string) (userID string, email string, err error)
+}
+
+type Clock interface {
+	Now() time.Time
+}
+
+type IDGenerator interface {
+	// NewID : id of a new user
+	NewID() string
+}
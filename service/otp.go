@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/notification"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/labstack/gommon/log"
+)
+
+const (
+	// OTPTTL : how long a login passcode can be used after it is sent
+	OTPTTL = 5 * time.Minute
+	// OTPMaxAttempts : wrong codes allowed before the passcode is no longer accepted
+	OTPMaxAttempts = 5
+	// OTPRateLimit : passcodes that can be sent to the same phone within OTPRateWindow
+	OTPRateLimit  = 3
+	OTPRateWindow = 15 * time.Minute
+)
+
+var otpCodeRegex = regexp.MustCompile(`^\d{6}$`)
+
+// generateOTPCode : random 6 digits passcode
+func generateOTPCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+func isValidOTPCode(code string) bool {
+	return otpCodeRegex.MatchString(code)
+}
+
+// NewLoginOTP : random passcode for the phone and its record to store, only the salted hash of the code is stored
+func (u *UserService) NewLoginOTP(phone string, ttl time.Duration) (string, repository.LoginOTP, error) {
+	code, err := generateOTPCode()
+	if err != nil {
+		return "", repository.LoginOTP{}, err
+	}
+	codeHash, salt, err := u.HashPassword(code)
+	if err != nil {
+		return "", repository.LoginOTP{}, err
+	}
+
+	return code, repository.LoginOTP{
+		Phone:     phone,
+		CodeHash:  codeHash,
+		Salt:      salt,
+		ExpiresAt: u.Clock.Now().Add(ttl),
+	}, nil
+}
+
+// StartLoginOTP : send one time passcode by SMS to login without password.
+// With enumeration protection a passcode is stored but never sent for phones that cannot login with OTP,
+// the rate limit counts them and the call takes the same work as a sent passcode.
+func (u *UserService) StartLoginOTP(ctx context.Context, phoneNumber string) error {
+	phoneNumber, err := u.NormalizePhone(phoneNumber)
+	if err != nil {
+		return err
+	}
+
+	// Rate limit per phone, every sent passcode cost an SMS
+	count, err := u.Repository.CountLoginOTP(ctx, phoneNumber, u.Clock.Now().Add(-OTPRateWindow))
+	if err != nil {
+		return err
+	}
+	if count >= OTPRateLimit {
+		return ErrTooManyOTPRequests
+	}
+
+	user, err := u.Repository.FindUser(ctx, repository.Param{
+		Logic:    "AND",
+		Field:    "phone",
+		Operator: "=",
+		Value:    phoneNumber,
+	})
+	if err != nil {
+		log.Error(err)
+	}
+	eligible := err == nil && user.OTPLoginEnabled
+	if !eligible && !u.EnumerationProtection {
+		if err != nil {
+			return ErrUserNotFound
+		}
+		return ErrOTPLoginDisabled
+	}
+
+	code, otp, err := u.NewLoginOTP(phoneNumber, OTPTTL)
+	if err != nil {
+		return err
+	}
+	if err := u.Repository.CreateLoginOTP(ctx, otp); err != nil {
+		return err
+	}
+
+	message := notification.Message{
+		To:   phoneNumber,
+		Body: fmt.Sprintf("Your SawitPro login code is %s. It expires in %d minutes, do not share it with anyone.", code, int(OTPTTL.Minutes())),
+	}
+	if u.EnumerationProtection {
+		// Sent in background, the response time and result must not depend on the SMS gateway
+		if eligible {
+			u.NotifyInBackground(message)
+		}
+		return nil
+	}
+
+	if err := u.SMSNotifier.Notify(ctx, message); err != nil {
+		return fmt.Errorf("%w: %v", ErrNotificationFailed, err)
+	}
+	return nil
+}
+
+// VerifyLoginOTP : login with the passcode sent by StartLoginOTP.
+// With enumeration protection unknown phones and phones that cannot login with OTP fail with ErrInvalidOTP.
+func (u *UserService) VerifyLoginOTP(ctx context.Context, phoneNumber string, code string) (LoginResult, error) {
+	phoneNumber, err := u.NormalizePhone(phoneNumber)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if !isValidOTPCode(code) {
+		return LoginResult{}, ErrInvalidOTP
+	}
+
+	user, err := u.Repository.FindUser(ctx, repository.Param{
+		Logic:    "AND",
+		Field:    "phone",
+		Operator: "=",
+		Value:    phoneNumber,
+	})
+	if err != nil {
+		log.Error(err)
+		if u.EnumerationProtection {
+			return LoginResult{}, ErrInvalidOTP
+		}
+		return LoginResult{}, ErrUserNotFound
+	}
+	// Setting may be turned off after the passcode was sent
+	if !user.OTPLoginEnabled {
+		if u.EnumerationProtection {
+			return LoginResult{}, ErrInvalidOTP
+		}
+		return LoginResult{}, ErrOTPLoginDisabled
+	}
+
+	otp, err := u.Repository.FindLoginOTP(ctx, user.Phone)
+	if errors.Is(err, repository.ErrNotFound) {
+		return LoginResult{}, ErrInvalidOTP
+	}
+	if err != nil {
+		return LoginResult{}, err
+	}
+	// The attempt is taken before the comparison, so concurrent guesses cannot exceed OTPMaxAttempts
+	err = u.Repository.IncreaseLoginOTPAttempt(ctx, otp.ID, OTPMaxAttempts)
+	if errors.Is(err, repository.ErrNotFound) {
+		return LoginResult{}, ErrInvalidOTP
+	}
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	if err := u.Hasher.Compare(otp.CodeHash, code, otp.Salt); err != nil {
+		return LoginResult{}, ErrInvalidOTP
+	}
+
+	// Passcode can only be used once, concurrent verification of the same code lose here
+	err = u.Repository.UseLoginOTP(ctx, otp.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return LoginResult{}, ErrInvalidOTP
+	}
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	token, err := u.IssueLoginToken(ctx, user)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	return LoginResult{Token: token, User: user}, nil
+}
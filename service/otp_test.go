@@ -0,0 +1,330 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/SawitProRecruitment/UserService/notification"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateOTPCode(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		code, err := generateOTPCode()
+		assert.NoError(t, err)
+		assert.True(t, isValidOTPCode(code), code)
+		seen[code] = true
+	}
+	assert.Greater(t, len(seen), 1)
+}
+
+func TestIsValidOTPCode(t *testing.T) {
+	assert.True(t, isValidOTPCode("012345"))
+	assert.False(t, isValidOTPCode("12345"))
+	assert.False(t, isValidOTPCode("1234567"))
+	assert.False(t, isValidOTPCode("12a456"))
+}
+
+func TestUserService_StartLoginOTP(t *testing.T) {
+	phone := "+62856712332"
+	phoneParam := repository.Param{Logic: "AND", Field: "phone", Operator: "=", Value: phone}
+	enabledUser := repository.User{ID: "id-1", Phone: phone, OTPLoginEnabled: true}
+	stored := repository.LoginOTP{Phone: phone, CodeHash: "code-hash", Salt: "salt", ExpiresAt: testNow.Add(OTPTTL)}
+
+	// hashed : expect the passcode to be hashed, the code is written to sent
+	hashed := func(f fields, sent *string) {
+		f.salts.EXPECT().Generate().Return("salt", nil)
+		f.hasher.EXPECT().Hash(gomock.Any(), "salt").DoAndReturn(func(code string, _ string) (string, error) {
+			*sent = code
+			return "code-hash", nil
+		})
+	}
+
+	tests := []struct {
+		name                  string
+		enumerationProtection bool
+		prepare               func(f fields, sent *string)
+		phone                 string
+		err                   error
+	}{
+		{
+			name: "Success",
+			prepare: func(f fields, sent *string) {
+				f.repo.EXPECT().CountLoginOTP(gomock.Any(), phone, testNow.Add(-OTPRateWindow)).Return(0, nil)
+				f.repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(enabledUser, nil)
+				hashed(f, sent)
+				f.repo.EXPECT().CreateLoginOTP(gomock.Any(), stored).Return(nil)
+				f.notifier.EXPECT().Notify(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, message notification.Message) error {
+					assert.Equal(t, phone, message.To)
+					assert.True(t, strings.Contains(message.Body, *sent), message.Body)
+					return nil
+				})
+			},
+			phone: "0856712332",
+		}, {
+			name:  "Invalid phone number",
+			phone: "123",
+			err:   &ValidationError{Message: invalidPhoneMessage},
+		}, {
+			name: "Too many requests",
+			prepare: func(f fields, _ *string) {
+				f.repo.EXPECT().CountLoginOTP(gomock.Any(), phone, testNow.Add(-OTPRateWindow)).Return(OTPRateLimit, nil)
+			},
+			phone: phone,
+			err:   ErrTooManyOTPRequests,
+		}, {
+			name: "Failed count passcodes",
+			prepare: func(f fields, _ *string) {
+				f.repo.EXPECT().CountLoginOTP(gomock.Any(), phone, gomock.Any()).Return(0, fmt.Errorf("error"))
+			},
+			phone: phone,
+			err:   fmt.Errorf("error"),
+		}, {
+			name: "Unknown user",
+			prepare: func(f fields, _ *string) {
+				f.repo.EXPECT().CountLoginOTP(gomock.Any(), phone, gomock.Any()).Return(0, nil)
+				f.repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(repository.User{}, repository.ErrNotFound)
+			},
+			phone: phone,
+			err:   ErrUserNotFound,
+		}, {
+			name: "OTP login not enabled",
+			prepare: func(f fields, _ *string) {
+				f.repo.EXPECT().CountLoginOTP(gomock.Any(), phone, gomock.Any()).Return(0, nil)
+				f.repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(repository.User{ID: "id-1", Phone: phone}, nil)
+			},
+			phone: phone,
+			err:   ErrOTPLoginDisabled,
+		}, {
+			name:                  "Unknown user with enumeration protection",
+			enumerationProtection: true,
+			prepare: func(f fields, sent *string) {
+				// Passcode is stored so the rate limit counts it, but never sent
+				f.repo.EXPECT().CountLoginOTP(gomock.Any(), phone, gomock.Any()).Return(0, nil)
+				f.repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(repository.User{}, repository.ErrNotFound)
+				hashed(f, sent)
+				f.repo.EXPECT().CreateLoginOTP(gomock.Any(), stored).Return(nil)
+			},
+			phone: phone,
+		}, {
+			name:                  "Success with enumeration protection",
+			enumerationProtection: true,
+			prepare: func(f fields, sent *string) {
+				f.repo.EXPECT().CountLoginOTP(gomock.Any(), phone, gomock.Any()).Return(0, nil)
+				f.repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(enabledUser, nil)
+				hashed(f, sent)
+				f.repo.EXPECT().CreateLoginOTP(gomock.Any(), stored).Return(nil)
+				// Failure of the background SMS is only logged
+				f.notifier.EXPECT().Notify(gomock.Any(), gomock.Any()).Return(fmt.Errorf("gateway"))
+			},
+			phone: phone,
+		}, {
+			name: "Failed store passcode",
+			prepare: func(f fields, sent *string) {
+				f.repo.EXPECT().CountLoginOTP(gomock.Any(), phone, gomock.Any()).Return(0, nil)
+				f.repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(enabledUser, nil)
+				hashed(f, sent)
+				f.repo.EXPECT().CreateLoginOTP(gomock.Any(), stored).Return(fmt.Errorf("error"))
+			},
+			phone: phone,
+			err:   fmt.Errorf("error"),
+		}, {
+			name: "Failed send SMS",
+			prepare: func(f fields, sent *string) {
+				f.repo.EXPECT().CountLoginOTP(gomock.Any(), phone, gomock.Any()).Return(0, nil)
+				f.repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(enabledUser, nil)
+				hashed(f, sent)
+				f.repo.EXPECT().CreateLoginOTP(gomock.Any(), stored).Return(nil)
+				f.notifier.EXPECT().Notify(gomock.Any(), gomock.Any()).Return(fmt.Errorf("gateway"))
+			},
+			phone: phone,
+			err:   fmt.Errorf("%w: %v", ErrNotificationFailed, fmt.Errorf("gateway")),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, f := newTestService(t, tt.enumerationProtection)
+			var sent string
+			if tt.prepare != nil {
+				tt.prepare(f, &sent)
+			}
+
+			err := u.StartLoginOTP(context.Background(), tt.phone)
+			u.Wait()
+			assert.Equal(t, tt.err, err)
+		})
+	}
+}
+
+func TestUserService_VerifyLoginOTP(t *testing.T) {
+	phone := "+62856712332"
+	phoneParam := repository.Param{Logic: "AND", Field: "phone", Operator: "=", Value: phone}
+	enabledUser := repository.User{ID: "id-1", Phone: phone, OTPLoginEnabled: true}
+	otp := repository.LoginOTP{ID: 7, Phone: phone, CodeHash: "code-hash", Salt: "salt", ExpiresAt: testNow.Add(OTPTTL)}
+
+	// found : expect the user and its passcode to be found
+	found := func(f fields) {
+		f.repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(enabledUser, nil)
+		f.repo.EXPECT().FindLoginOTP(gomock.Any(), phone).Return(otp, nil)
+	}
+
+	tests := []struct {
+		name                  string
+		enumerationProtection bool
+		prepare               func(f fields)
+		phone                 string
+		code                  string
+		result                LoginResult
+		err                   error
+	}{
+		{
+			name: "Success",
+			prepare: func(f fields) {
+				found(f)
+				f.repo.EXPECT().IncreaseLoginOTPAttempt(gomock.Any(), int64(7), OTPMaxAttempts).Return(nil)
+				f.hasher.EXPECT().Compare("code-hash", "123456", "salt").Return(nil)
+				f.repo.EXPECT().UseLoginOTP(gomock.Any(), int64(7)).Return(nil)
+				f.repo.EXPECT().ListUserMemberships(gomock.Any(), "id-1").Return(nil, nil)
+				f.tokens.EXPECT().IssueUserToken("id-1", "", testNow.Add(loginTokenTTL)).Return("token", nil)
+				f.repo.EXPECT().IncreaseLoginAttempt(gomock.Any(), phone).Return(nil)
+			},
+			phone:  "0856712332",
+			code:   "123456",
+			result: LoginResult{Token: "token", User: enabledUser},
+		}, {
+			name:  "Invalid phone number",
+			phone: "123",
+			code:  "123456",
+			err:   &ValidationError{Message: invalidPhoneMessage},
+		}, {
+			name:  "Malformed code",
+			phone: phone,
+			code:  "12ab",
+			err:   ErrInvalidOTP,
+		}, {
+			name: "Unknown user",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(repository.User{}, repository.ErrNotFound)
+			},
+			phone: phone,
+			code:  "123456",
+			err:   ErrUserNotFound,
+		}, {
+			name:                  "Unknown user with enumeration protection",
+			enumerationProtection: true,
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(repository.User{}, repository.ErrNotFound)
+			},
+			phone: phone,
+			code:  "123456",
+			err:   ErrInvalidOTP,
+		}, {
+			name: "OTP login disabled after code was sent",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(repository.User{ID: "id-1", Phone: phone}, nil)
+			},
+			phone: phone,
+			code:  "123456",
+			err:   ErrOTPLoginDisabled,
+		}, {
+			name:                  "OTP login disabled with enumeration protection",
+			enumerationProtection: true,
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(repository.User{ID: "id-1", Phone: phone}, nil)
+			},
+			phone: phone,
+			code:  "123456",
+			err:   ErrInvalidOTP,
+		}, {
+			name: "Expired or not sent",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(enabledUser, nil)
+				f.repo.EXPECT().FindLoginOTP(gomock.Any(), phone).Return(repository.LoginOTP{}, repository.ErrNotFound)
+			},
+			phone: phone,
+			code:  "123456",
+			err:   ErrInvalidOTP,
+		}, {
+			name: "Failed find passcode",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(enabledUser, nil)
+				f.repo.EXPECT().FindLoginOTP(gomock.Any(), phone).Return(repository.LoginOTP{}, fmt.Errorf("error"))
+			},
+			phone: phone,
+			code:  "123456",
+			err:   fmt.Errorf("error"),
+		}, {
+			name: "Too many attempts",
+			prepare: func(f fields) {
+				found(f)
+				f.repo.EXPECT().IncreaseLoginOTPAttempt(gomock.Any(), int64(7), OTPMaxAttempts).Return(repository.ErrNotFound)
+			},
+			phone: phone,
+			code:  "123456",
+			err:   ErrInvalidOTP,
+		}, {
+			name: "Failed count attempt",
+			prepare: func(f fields) {
+				found(f)
+				f.repo.EXPECT().IncreaseLoginOTPAttempt(gomock.Any(), int64(7), OTPMaxAttempts).Return(fmt.Errorf("error"))
+			},
+			phone: phone,
+			code:  "123456",
+			err:   fmt.Errorf("error"),
+		}, {
+			name: "Wrong code",
+			prepare: func(f fields) {
+				found(f)
+				f.repo.EXPECT().IncreaseLoginOTPAttempt(gomock.Any(), int64(7), OTPMaxAttempts).Return(nil)
+				f.hasher.EXPECT().Compare("code-hash", "654321", "salt").Return(fmt.Errorf("mismatch"))
+			},
+			phone: phone,
+			code:  "654321",
+			err:   ErrInvalidOTP,
+		}, {
+			name: "Already used",
+			prepare: func(f fields) {
+				found(f)
+				f.repo.EXPECT().IncreaseLoginOTPAttempt(gomock.Any(), int64(7), OTPMaxAttempts).Return(nil)
+				f.hasher.EXPECT().Compare("code-hash", "123456", "salt").Return(nil)
+				f.repo.EXPECT().UseLoginOTP(gomock.Any(), int64(7)).Return(repository.ErrNotFound)
+			},
+			phone: phone,
+			code:  "123456",
+			err:   ErrInvalidOTP,
+		}, {
+			name: "Deactivated user",
+			prepare: func(f fields) {
+				deactivated := enabledUser
+				deactivated.DeactivatedAt = &testNow
+				f.repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(deactivated, nil)
+				f.repo.EXPECT().FindLoginOTP(gomock.Any(), phone).Return(otp, nil)
+				f.repo.EXPECT().IncreaseLoginOTPAttempt(gomock.Any(), int64(7), OTPMaxAttempts).Return(nil)
+				f.hasher.EXPECT().Compare("code-hash", "123456", "salt").Return(nil)
+				f.repo.EXPECT().UseLoginOTP(gomock.Any(), int64(7)).Return(nil)
+			},
+			phone: phone,
+			code:  "123456",
+			err:   ErrUserDeactivated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, f := newTestService(t, tt.enumerationProtection)
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			result, err := u.VerifyLoginOTP(context.Background(), tt.phone, tt.code)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.result, result)
+		})
+	}
+}
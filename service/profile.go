@@ -0,0 +1,269 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// DateLayout : format of the date of birth
+const DateLayout = "2006-01-02"
+
+// profileFields : members of the profile document that can be changed by the user
+var profileFields = map[string]bool{
+	"phone":              true,
+	"name":               true,
+	"email":              true,
+	"preferred_language": true,
+	"avatar_url":         true,
+	"date_of_birth":      true,
+	"address":            true,
+	"estate":             true,
+	"region":             true,
+	"attributes":         true,
+}
+
+// LanguageTagRegex : simplified BCP 47 language tag, e.g. id, en-US
+var LanguageTagRegex = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+
+// Profile : profile of the user after validation, nil means the field is empty
+type Profile struct {
+	Phone             string
+	Name              string
+	Email             *string
+	PreferredLanguage *string
+	AvatarURL         *string
+	DateOfBirth       *time.Time
+	Address           *string
+	Estate            *string
+	Region            *string
+	Attributes        map[string]interface{}
+}
+
+// ProfileDocument : JSON profile document of the user, empty fields are omitted
+func ProfileDocument(user repository.User) map[string]interface{} {
+	doc := map[string]interface{}{"phone": user.Phone, "name": user.Name}
+	optional := map[string]*string{
+		"email":              user.Email,
+		"preferred_language": user.PreferredLanguage,
+		"avatar_url":         user.AvatarURL,
+		"address":            user.Address,
+		"estate":             user.Estate,
+		"region":             user.Region,
+	}
+	for key, value := range optional {
+		if value != nil {
+			doc[key] = *value
+		}
+	}
+	if user.DateOfBirth != nil {
+		doc["date_of_birth"] = user.DateOfBirth.Format(DateLayout)
+	}
+	if len(user.Attributes) > 0 {
+		doc["attributes"] = user.Attributes
+	}
+	return doc
+}
+
+// ProfileOf : current profile of the user
+func ProfileOf(user repository.User) Profile {
+	return Profile{
+		Phone:             user.Phone,
+		Name:              user.Name,
+		Email:             user.Email,
+		PreferredLanguage: user.PreferredLanguage,
+		AvatarURL:         user.AvatarURL,
+		DateOfBirth:       user.DateOfBirth,
+		Address:           user.Address,
+		Estate:            user.Estate,
+		Region:            user.Region,
+		Attributes:        user.Attributes,
+	}
+}
+
+// ApplyProfile : set profile fields to the user
+func ApplyProfile(user repository.User, profile Profile) repository.User {
+	user.Phone = profile.Phone
+	user.Name = profile.Name
+	user.Email = profile.Email
+	user.PreferredLanguage = profile.PreferredLanguage
+	user.AvatarURL = profile.AvatarURL
+	user.DateOfBirth = profile.DateOfBirth
+	user.Address = profile.Address
+	user.Estate = profile.Estate
+	user.Region = profile.Region
+	user.Attributes = profile.Attributes
+	return user
+}
+
+// ProfileChanges : columns and new values of the fields that differ between current and updated profile
+func ProfileChanges(current, updated Profile) map[string]interface{} {
+	changes := map[string]interface{}{}
+	if current.Phone != updated.Phone {
+		changes["phone"] = updated.Phone
+	}
+	if current.Name != updated.Name {
+		changes["name"] = updated.Name
+	}
+
+	optional := []struct {
+		column           string
+		current, updated *string
+	}{
+		{"email", current.Email, updated.Email},
+		{"preferred_language", current.PreferredLanguage, updated.PreferredLanguage},
+		{"avatar_url", current.AvatarURL, updated.AvatarURL},
+		{"address", current.Address, updated.Address},
+		{"estate", current.Estate, updated.Estate},
+		{"region", current.Region, updated.Region},
+	}
+	for _, field := range optional {
+		if field.current == nil && field.updated == nil {
+			continue
+		}
+		if field.updated == nil {
+			changes[field.column] = nil
+		} else if field.current == nil || *field.current != *field.updated {
+			changes[field.column] = *field.updated
+		}
+	}
+
+	if updated.DateOfBirth == nil && current.DateOfBirth != nil {
+		changes["date_of_birth"] = nil
+	} else if updated.DateOfBirth != nil && (current.DateOfBirth == nil || !current.DateOfBirth.Equal(*updated.DateOfBirth)) {
+		changes["date_of_birth"] = *updated.DateOfBirth
+	}
+
+	if (len(current.Attributes) > 0 || len(updated.Attributes) > 0) && !reflect.DeepEqual(current.Attributes, updated.Attributes) {
+		changes["attributes"] = updated.Attributes
+	}
+	return changes
+}
+
+// ValidateProfile : validate profile document, ValidationError when it is invalid
+func (u *UserService) ValidateProfile(doc map[string]interface{}) (profile Profile, err error) {
+	for key := range doc {
+		if !profileFields[key] {
+			return profile, invalid(fmt.Sprintf("Unknown profile field %s", key))
+		}
+	}
+
+	// Phone number is stored in E.164, so local format of the current number is not a change
+	phone, ok := doc["phone"].(string)
+	if !ok {
+		return profile, invalid(invalidPhoneMessage)
+	}
+	if profile.Phone, err = u.Phone.Normalize(phone); err != nil {
+		return profile, invalid(invalidPhoneMessage)
+	}
+
+	name, ok := doc["name"].(string)
+	if !ok || len(name) < 3 || len(name) > 60 {
+		return profile, invalid(invalidNameMessage)
+	}
+	profile.Name = name
+
+	if profile.Email, ok = optionalString(doc, "email"); !ok || (profile.Email != nil && !IsValidEmail(*profile.Email)) {
+		return profile, invalid(invalidEmailMessage)
+	}
+	if profile.Email != nil {
+		// Email is a login identifier, store it in lower case so lookup is case insensitive
+		email := strings.ToLower(*profile.Email)
+		profile.Email = &email
+	}
+
+	if profile.PreferredLanguage, ok = optionalString(doc, "preferred_language"); !ok || (profile.PreferredLanguage != nil && !LanguageTagRegex.MatchString(*profile.PreferredLanguage)) {
+		return profile, invalid("Invalid preferred language. Preferred language must be a language tag such as id or en-US")
+	}
+
+	if profile.AvatarURL, ok = optionalString(doc, "avatar_url"); !ok || (profile.AvatarURL != nil && !isValidAvatarURL(*profile.AvatarURL)) {
+		return profile, invalid("Invalid avatar url. Avatar url must be an http or https url of at most 255 characters")
+	}
+
+	dateOfBirth, ok := optionalString(doc, "date_of_birth")
+	if ok && dateOfBirth != nil {
+		profile.DateOfBirth, ok = u.parseDateOfBirth(*dateOfBirth)
+	}
+	if !ok {
+		return profile, invalid("Invalid date of birth. Date of birth must be formatted as YYYY-MM-DD and not in the future")
+	}
+
+	if profile.Address, ok = optionalString(doc, "address"); !ok || (profile.Address != nil && (len(*profile.Address) < 1 || len(*profile.Address) > 255)) {
+		return profile, invalid("Invalid address. Address must be 1 to 255 characters")
+	}
+
+	if profile.Estate, ok = optionalString(doc, "estate"); !ok || (profile.Estate != nil && (len(*profile.Estate) < 1 || len(*profile.Estate) > 100)) {
+		return profile, invalid("Invalid estate. Estate must be 1 to 100 characters")
+	}
+
+	if profile.Region, ok = optionalString(doc, "region"); !ok || (profile.Region != nil && (len(*profile.Region) < 1 || len(*profile.Region) > 100)) {
+		return profile, invalid("Invalid region. Region must be 1 to 100 characters")
+	}
+
+	if attributes, exist := doc["attributes"]; exist {
+		if profile.Attributes, ok = attributes.(map[string]interface{}); !ok {
+			return profile, invalid("Invalid attributes. Attributes must be an object")
+		}
+	}
+
+	return profile, nil
+}
+
+// ValidateAttributes : validate custom attributes against JSON Schema of the tenant, ValidationError when they are invalid
+func (u *UserService) ValidateAttributes(ctx context.Context, tenant string, attributes map[string]interface{}) error {
+	raw, err := u.Repository.FindAttributeSchema(ctx, tenant)
+	if errors.Is(err, repository.ErrNotFound) {
+		// Tenant without schema accept any attributes
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	schema := openapi3.NewSchema()
+	if err := json.Unmarshal(raw, schema); err != nil {
+		return err
+	}
+
+	if attributes == nil {
+		attributes = map[string]interface{}{}
+	}
+	if err := schema.VisitJSON(attributes); err != nil {
+		var schemaErr *openapi3.SchemaError
+		if errors.As(err, &schemaErr) {
+			return invalid(fmt.Sprintf("Invalid attributes. %s", schemaErr.Reason))
+		}
+		return invalid("Invalid attributes")
+	}
+	return nil
+}
+
+// optionalString : read optional string member, ok is false when the member is not a string
+func optionalString(doc map[string]interface{}, key string) (value *string, ok bool) {
+	raw, exist := doc[key]
+	if !exist || raw == nil {
+		return nil, true
+	}
+	str, ok := raw.(string)
+	if !ok {
+		return nil, false
+	}
+	return &str, true
+}
+
+// parseDateOfBirth : date of birth between 1900 and today
+func (u *UserService) parseDateOfBirth(value string) (*time.Time, bool) {
+	dateOfBirth, err := time.Parse(DateLayout, value)
+	if err != nil || dateOfBirth.After(u.Clock.Now()) || dateOfBirth.Year() < 1900 {
+		return nil, false
+	}
+	return &dateOfBirth, true
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateProfile(t *testing.T) {
+	// Fixed clock so the future date of birth does not depend on the day the test runs
+	now := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+	u := NewUserService(NewUserServiceOptions{Clock: fixedClock(now)})
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"phone":              "+62856712332",
+			"name":               "User",
+			"email":              "user@example.com",
+			"preferred_language": "en-US",
+			"avatar_url":         "https://cdn.example.com/avatar.png",
+			"date_of_birth":      "1990-05-17",
+			"address":            "Jl. Sudirman No. 1",
+			"estate":             "Kebun Sei Rampah",
+			"region":             "Sumatera Utara",
+			"attributes":         map[string]interface{}{"block": "A1"},
+		}
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		profile, err := u.ValidateProfile(valid())
+		assert.NoError(t, err)
+		assert.Equal(t, "user@example.com", *profile.Email)
+		assert.Equal(t, time.Date(1990, 5, 17, 0, 0, 0, 0, time.UTC), *profile.DateOfBirth)
+		assert.Equal(t, map[string]interface{}{"block": "A1"}, profile.Attributes)
+	})
+
+	t.Run("Optional fields absent", func(t *testing.T) {
+		profile, err := u.ValidateProfile(map[string]interface{}{"phone": "+62856712332", "name": "User"})
+		assert.NoError(t, err)
+		assert.Nil(t, profile.Email)
+		assert.Nil(t, profile.DateOfBirth)
+		assert.Nil(t, profile.Attributes)
+	})
+
+	t.Run("Local phone format", func(t *testing.T) {
+		doc := valid()
+		doc["phone"] = "0856-712-332"
+		profile, err := u.ValidateProfile(doc)
+		assert.NoError(t, err)
+		assert.Equal(t, "+62856712332", profile.Phone)
+	})
+
+	invalid := []struct {
+		field   string
+		value   interface{}
+		message string
+	}{
+		{"phone", "+60123456789", "Invalid phone number. Phone numbers must be a valid number of a supported country, e.g. +62812345678 or 0812345678"},
+		{"phone", 62856712332, "Invalid phone number. Phone numbers must be a valid number of a supported country, e.g. +62812345678 or 0812345678"},
+		{"email", "not-an-email", "Invalid email. Email must be a valid address of at most 254 characters"},
+		{"email", "User <user@example.com>", "Invalid email. Email must be a valid address of at most 254 characters"},
+		{"preferred_language", "english", "Invalid preferred language. Preferred language must be a language tag such as id or en-US"},
+		{"avatar_url", "ftp://example.com/avatar.png", "Invalid avatar url. Avatar url must be an http or https url of at most 255 characters"},
+		{"date_of_birth", "17-05-1990", "Invalid date of birth. Date of birth must be formatted as YYYY-MM-DD and not in the future"},
+		{"date_of_birth", "2024-06-02", "Invalid date of birth. Date of birth must be formatted as YYYY-MM-DD and not in the future"},
+		{"address", "", "Invalid address. Address must be 1 to 255 characters"},
+		{"estate", 12, "Invalid estate. Estate must be 1 to 100 characters"},
+		{"region", "", "Invalid region. Region must be 1 to 100 characters"},
+		{"attributes", "block A1", "Invalid attributes. Attributes must be an object"},
+		{"password", "Password1!", "Unknown profile field password"},
+	}
+
+	for _, tt := range invalid {
+		t.Run("Invalid "+tt.field, func(t *testing.T) {
+			doc := valid()
+			doc[tt.field] = tt.value
+			_, err := u.ValidateProfile(doc)
+			assert.Equal(t, &ValidationError{Message: tt.message}, err)
+		})
+	}
+}
+
+func TestProfileChanges(t *testing.T) {
+	email := "user@example.com"
+	otherEmail := "other@example.com"
+	dateOfBirth := time.Date(1990, 5, 17, 0, 0, 0, 0, time.UTC)
+
+	current := Profile{
+		Phone:       "+62856712332",
+		Name:        "User",
+		Email:       &email,
+		DateOfBirth: &dateOfBirth,
+		Attributes:  map[string]interface{}{"block": "A1"},
+	}
+
+	// No changes
+	assert.Equal(t, map[string]interface{}{}, ProfileChanges(current, current))
+
+	// Changed and cleared fields
+	updated := current
+	updated.Name = "New User"
+	updated.Email = &otherEmail
+	updated.DateOfBirth = nil
+	updated.Attributes = nil
+	assert.Equal(t, map[string]interface{}{
+		"name":          "New User",
+		"email":         "other@example.com",
+		"date_of_birth": nil,
+		"attributes":    map[string]interface{}(nil),
+	}, ProfileChanges(current, updated))
+}
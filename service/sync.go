@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/repository"
+)
+
+// SyncRule : how a field edited offline is merged when the server changed it too since the device last saw it
+type SyncRule string
+
+const (
+	// SyncLastWriterWins : the edit is applied when the device made it after the profile was last changed on the server
+	SyncLastWriterWins SyncRule = "last_writer_wins"
+	// SyncServerWins : the server value is kept, used for login identifiers whose owner may have been verified since
+	SyncServerWins SyncRule = "server_wins"
+)
+
+// SyncRules : conflict rule of every profile field
+var SyncRules = map[string]SyncRule{
+	"phone":              SyncServerWins,
+	"email":              SyncServerWins,
+	"name":               SyncLastWriterWins,
+	"preferred_language": SyncLastWriterWins,
+	"avatar_url":         SyncLastWriterWins,
+	"date_of_birth":      SyncLastWriterWins,
+	"address":            SyncLastWriterWins,
+	"estate":             SyncLastWriterWins,
+	"region":             SyncLastWriterWins,
+	"attributes":         SyncLastWriterWins,
+}
+
+const (
+	// MaxSyncMutations : mutations accepted in one sync, devices offline for longer send the rest in the next one
+	MaxSyncMutations = 500
+	// maxSyncMutationID : length of the mutation ids generated by devices
+	maxSyncMutationID = 64
+	// syncAttempts : merges tried when the profile changes while the mutations are being stored
+	syncAttempts = 3
+)
+
+// Reasons of rejected mutations
+const (
+	syncConflictMessage = "Field was changed on the server"
+	syncOutdatedMessage = "Field was changed on the server after the edit"
+)
+
+// SyncMutation : profile field edited on a device while it was offline
+type SyncMutation struct {
+	// ID is generated by the device, a replayed mutation is not applied again and gets the outcome of the first time
+	ID    string
+	Field string
+	// Value is the new value of the field as JSON, nil clears it
+	Value interface{}
+	// Base is the value the device had before the edit, nil when the field was empty
+	Base interface{}
+	// ChangedAt is when the edit was made according to the device clock
+	ChangedAt time.Time
+}
+
+// SyncRequest : mutations submitted by a device and the last change it pulled
+type SyncRequest struct {
+	UserID string
+	// Cursor is the change sequence returned by the last sync of the device, 0 when it never synced
+	Cursor    int64
+	Mutations []SyncMutation
+}
+
+// SyncResult : outcome of the mutations in the order they were submitted and the user after they were merged
+type SyncResult struct {
+	Mutations []repository.SyncMutation
+	User      repository.User
+	// Changed tells whether the profile changed since the cursor, the device replaces its copy with User then
+	Changed bool
+}
+
+// Sync : merge profile mutations made offline and return the changes since the cursor.
+// A mutation conflicts when the user changed since the cursor and the field no longer has the value the edit was based on,
+// conflicts are resolved by the SyncRules of the field. Mutations are merged in the order they were made and each is
+// validated on its own, so one invalid edit does not reject the others.
+func (u *UserService) Sync(ctx context.Context, request SyncRequest) (SyncResult, error) {
+	if len(request.Mutations) > MaxSyncMutations {
+		return SyncResult{}, invalid("Too many mutations. At most 500 mutations can be synced at once")
+	}
+	ids := make([]string, 0, len(request.Mutations))
+	seen := map[string]bool{}
+	for _, mutation := range request.Mutations {
+		if mutation.ID == "" || len(mutation.ID) > maxSyncMutationID {
+			return SyncResult{}, invalid("Invalid mutation id. Mutation id must be 1 to 64 characters")
+		}
+		if seen[mutation.ID] {
+			return SyncResult{}, invalid("Duplicate mutation id " + mutation.ID)
+		}
+		if _, ok := SyncRules[mutation.Field]; !ok {
+			return SyncResult{}, invalid("Unknown profile field " + mutation.Field)
+		}
+		seen[mutation.ID] = true
+		ids = append(ids, mutation.ID)
+	}
+
+	// Phone number or email taken by another user are refused on the next attempt
+	refused := map[string]string{}
+	for attempt := 0; attempt < syncAttempts; attempt++ {
+		user, err := u.GetUser(ctx, request.UserID)
+		if err != nil {
+			return SyncResult{}, err
+		}
+
+		recorded := map[string]repository.SyncMutation{}
+		if len(ids) > 0 {
+			stored, err := u.Repository.FindSyncMutations(ctx, user.ID, ids)
+			if err != nil {
+				return SyncResult{}, err
+			}
+			for _, mutation := range stored {
+				recorded[mutation.ID] = mutation
+			}
+		}
+
+		profile, outcomes, err := u.mergeMutations(ctx, user, request, recorded, refused)
+		if err != nil {
+			return SyncResult{}, err
+		}
+
+		fields := ProfileChanges(ProfileOf(user), profile)
+		var added []repository.SyncMutation
+		for _, mutation := range request.Mutations {
+			if _, replayed := recorded[mutation.ID]; !replayed {
+				added = append(added, outcomes[mutation.ID])
+			}
+		}
+		if len(added) > 0 {
+			err = u.Repository.SyncUser(ctx, repository.SyncUser{
+				PatchUser: repository.PatchUser{ID: user.ID, Version: user.Version, Fields: fields},
+				Mutations: added,
+			})
+			switch {
+			case errors.Is(err, repository.ErrVersionConflict):
+				// Profile changed between read and write, merge again on top of it
+				continue
+			case errors.Is(err, repository.ErrDuplicatePhone):
+				refusePending(refused, outcomes, "phone", "Phone number already exist")
+				continue
+			case errors.Is(err, repository.ErrDuplicateEmail):
+				refusePending(refused, outcomes, "email", "Email already exist")
+				continue
+			case err != nil:
+				return SyncResult{}, err
+			}
+			if len(fields) > 0 {
+				if user, err = u.GetUser(ctx, request.UserID); err != nil {
+					return SyncResult{}, err
+				}
+			}
+		}
+
+		result := SyncResult{User: user, Changed: user.ChangeSeq > request.Cursor}
+		for _, mutation := range request.Mutations {
+			if stored, replayed := recorded[mutation.ID]; replayed {
+				result.Mutations = append(result.Mutations, stored)
+			} else {
+				result.Mutations = append(result.Mutations, outcomes[mutation.ID])
+			}
+		}
+		return result, nil
+	}
+	return SyncResult{}, ErrProfileModified
+}
+
+// mergeMutations : profile with the mutations that were not recorded yet merged in the order they were made, with the outcome of each of them
+func (u *UserService) mergeMutations(ctx context.Context, user repository.User, request SyncRequest, recorded map[string]repository.SyncMutation, refused map[string]string) (Profile, map[string]repository.SyncMutation, error) {
+	pending := make([]SyncMutation, 0, len(request.Mutations))
+	for _, mutation := range request.Mutations {
+		if _, replayed := recorded[mutation.ID]; !replayed {
+			pending = append(pending, mutation)
+		}
+	}
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].ChangedAt.Before(pending[j].ChangedAt)
+	})
+
+	// The server knows when the profile was changed, not when each field was. Logins change UpdatedAt but not the profile
+	updatedAt := user.CreatedAt
+	if user.ProfileUpdatedAt != nil {
+		updatedAt = *user.ProfileUpdatedAt
+	}
+	now := u.Clock.Now()
+	changedOnServer := user.ChangeSeq > request.Cursor
+
+	doc := ProfileDocument(user)
+	outcomes := make(map[string]repository.SyncMutation, len(pending))
+	for _, mutation := range pending {
+		outcome := repository.SyncMutation{ID: mutation.ID, UserID: user.ID, Field: mutation.Field, Status: repository.SyncRejected}
+		if message, ok := refused[mutation.ID]; ok {
+			outcome.Message = message
+			outcomes[mutation.ID] = outcome
+			continue
+		}
+
+		if changedOnServer && !sameSyncValue(doc[mutation.Field], mutation.Base) {
+			if SyncRules[mutation.Field] == SyncServerWins {
+				outcome.Message = syncConflictMessage
+				outcomes[mutation.ID] = outcome
+				continue
+			}
+			// A device clock ahead of the server must not win every later conflict
+			changedAt := mutation.ChangedAt
+			if changedAt.After(now) {
+				changedAt = now
+			}
+			if !changedAt.After(updatedAt) {
+				outcome.Message = syncOutdatedMessage
+				outcomes[mutation.ID] = outcome
+				continue
+			}
+		}
+
+		merged := copySyncDocument(doc)
+		if mutation.Value == nil {
+			delete(merged, mutation.Field)
+		} else {
+			merged[mutation.Field] = mutation.Value
+		}
+		profile, err := u.ValidateProfile(merged)
+		if err == nil && mutation.Field == "attributes" {
+			err = u.ValidateAttributes(ctx, user.Tenant, profile.Attributes)
+		}
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			outcome.Message = validationErr.Message
+			outcomes[mutation.ID] = outcome
+			continue
+		}
+		if err != nil {
+			return Profile{}, nil, err
+		}
+
+		// Later edits are based on the stored value, e.g. the phone number in E.164
+		doc = ProfileDocument(ApplyProfile(user, profile))
+		outcome.Status = repository.SyncApplied
+		outcomes[mutation.ID] = outcome
+	}
+
+	profile, err := u.ValidateProfile(doc)
+	if err != nil {
+		return Profile{}, nil, err
+	}
+	return profile, outcomes, nil
+}
+
+// refusePending : refuse the applied mutations of the field on the next merge, e.g. the phone number belongs to another user
+func refusePending(refused map[string]string, outcomes map[string]repository.SyncMutation, field string, message string) {
+	for id, outcome := range outcomes {
+		if outcome.Field == field && outcome.Status == repository.SyncApplied {
+			refused[id] = message
+		}
+	}
+}
+
+// sameSyncValue : whether the current value of the field is the value the device based its edit on, empty attributes are the same as no attributes
+func sameSyncValue(current, base interface{}) bool {
+	if isEmptySyncValue(current) && isEmptySyncValue(base) {
+		return true
+	}
+	return reflect.DeepEqual(current, base)
+}
+
+func isEmptySyncValue(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	object, ok := value.(map[string]interface{})
+	return ok && len(object) == 0
+}
+
+// copySyncDocument : shallow copy of the profile document, values are replaced and never changed in place
+func copySyncDocument(doc map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(doc))
+	for key, value := range doc {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserService_Sync(t *testing.T) {
+	updatedAt := testNow.Add(-24 * time.Hour)
+	user := repository.User{ID: "id-1", Phone: "+62856712332", Name: "User", Version: 3, Tenant: "default", CreatedAt: testNow.Add(-48 * time.Hour), UpdatedAt: &updatedAt, ProfileUpdatedAt: &updatedAt, ChangeSeq: 10}
+	userParam := repository.Param{Logic: "AND", Field: "id", Operator: "=", Value: "id-1"}
+	synced := user
+	synced.Name = "New Name"
+	synced.Version = 4
+	synced.ChangeSeq = 11
+
+	rename := SyncMutation{ID: "m1", Field: "name", Value: "New Name", Base: "User", ChangedAt: testNow.Add(-time.Hour)}
+	applied := func(id, field string) repository.SyncMutation {
+		return repository.SyncMutation{ID: id, UserID: "id-1", Field: field, Status: repository.SyncApplied}
+	}
+	rejected := func(id, field, message string) repository.SyncMutation {
+		return repository.SyncMutation{ID: id, UserID: "id-1", Field: field, Status: repository.SyncRejected, Message: message}
+	}
+	renamed := func(f fields, mutations ...repository.SyncMutation) {
+		f.repo.EXPECT().SyncUser(gomock.Any(), repository.SyncUser{
+			PatchUser: repository.PatchUser{ID: "id-1", Version: 3, Fields: map[string]interface{}{"name": "New Name"}},
+			Mutations: mutations,
+		}).Return(nil)
+		f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(synced, nil)
+	}
+	unchanged := func(f fields, mutations ...repository.SyncMutation) {
+		f.repo.EXPECT().SyncUser(gomock.Any(), repository.SyncUser{
+			PatchUser: repository.PatchUser{ID: "id-1", Version: 3, Fields: map[string]interface{}{}},
+			Mutations: mutations,
+		}).Return(nil)
+	}
+	read := func(f fields, ids ...string) {
+		f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(user, nil)
+		f.repo.EXPECT().FindSyncMutations(gomock.Any(), "id-1", ids).Return(nil, nil)
+	}
+
+	tests := []struct {
+		name    string
+		prepare func(f fields)
+		request SyncRequest
+		result  SyncResult
+		err     error
+	}{
+		{
+			name: "Applied when the server did not change",
+			prepare: func(f fields) {
+				read(f, "m1")
+				renamed(f, applied("m1", "name"))
+			},
+			request: SyncRequest{UserID: "id-1", Cursor: 10, Mutations: []SyncMutation{rename}},
+			result:  SyncResult{Mutations: []repository.SyncMutation{applied("m1", "name")}, User: synced, Changed: true},
+		}, {
+			name: "Applied when the field still has its base value",
+			prepare: func(f fields) {
+				read(f, "m1")
+				renamed(f, applied("m1", "name"))
+			},
+			request: SyncRequest{UserID: "id-1", Cursor: 5, Mutations: []SyncMutation{
+				{ID: "m1", Field: "name", Value: "New Name", Base: "User", ChangedAt: testNow.Add(-72 * time.Hour)},
+			}},
+			result: SyncResult{Mutations: []repository.SyncMutation{applied("m1", "name")}, User: synced, Changed: true},
+		}, {
+			name: "Server wins conflict of phone",
+			prepare: func(f fields) {
+				read(f, "m1")
+				unchanged(f, rejected("m1", "phone", syncConflictMessage))
+			},
+			request: SyncRequest{UserID: "id-1", Cursor: 5, Mutations: []SyncMutation{
+				{ID: "m1", Field: "phone", Value: "+62811111111", Base: "+62800000000", ChangedAt: testNow.Add(-time.Hour)},
+			}},
+			result: SyncResult{Mutations: []repository.SyncMutation{rejected("m1", "phone", syncConflictMessage)}, User: user, Changed: true},
+		}, {
+			name: "Last writer wins conflict with later edit",
+			prepare: func(f fields) {
+				read(f, "m1")
+				renamed(f, applied("m1", "name"))
+			},
+			request: SyncRequest{UserID: "id-1", Cursor: 5, Mutations: []SyncMutation{
+				{ID: "m1", Field: "name", Value: "New Name", Base: "Old Name", ChangedAt: testNow.Add(-time.Hour)},
+			}},
+			result: SyncResult{Mutations: []repository.SyncMutation{applied("m1", "name")}, User: synced, Changed: true},
+		}, {
+			name: "Last writer wins conflict with earlier edit",
+			prepare: func(f fields) {
+				read(f, "m1")
+				unchanged(f, rejected("m1", "name", syncOutdatedMessage))
+			},
+			request: SyncRequest{UserID: "id-1", Cursor: 5, Mutations: []SyncMutation{
+				{ID: "m1", Field: "name", Value: "New Name", Base: "Old Name", ChangedAt: testNow.Add(-30 * time.Hour)},
+			}},
+			result: SyncResult{Mutations: []repository.SyncMutation{rejected("m1", "name", syncOutdatedMessage)}, User: user, Changed: true},
+		}, {
+			name: "Login after the server edit does not reject a later edit",
+			prepare: func(f fields) {
+				// Edited on the web 3 hours ago, edited offline 2 hours ago, logged in an hour ago
+				profileUpdatedAt, loggedInAt := testNow.Add(-3*time.Hour), testNow.Add(-time.Hour)
+				loggedIn := user
+				loggedIn.ProfileUpdatedAt = &profileUpdatedAt
+				loggedIn.UpdatedAt = &loggedInAt
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(loggedIn, nil)
+				f.repo.EXPECT().FindSyncMutations(gomock.Any(), "id-1", []string{"m1"}).Return(nil, nil)
+				renamed(f, applied("m1", "name"))
+			},
+			request: SyncRequest{UserID: "id-1", Cursor: 5, Mutations: []SyncMutation{
+				{ID: "m1", Field: "name", Value: "New Name", Base: "Old Name", ChangedAt: testNow.Add(-2 * time.Hour)},
+			}},
+			result: SyncResult{Mutations: []repository.SyncMutation{applied("m1", "name")}, User: synced, Changed: true},
+		}, {
+			name: "Device clock ahead of the server",
+			prepare: func(f fields) {
+				justUpdated := user
+				justUpdated.ProfileUpdatedAt = &testNow
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(justUpdated, nil)
+				f.repo.EXPECT().FindSyncMutations(gomock.Any(), "id-1", []string{"m1"}).Return(nil, nil)
+				unchanged(f, rejected("m1", "name", syncOutdatedMessage))
+			},
+			request: SyncRequest{UserID: "id-1", Cursor: 5, Mutations: []SyncMutation{
+				{ID: "m1", Field: "name", Value: "New Name", Base: "Old Name", ChangedAt: testNow.Add(time.Hour)},
+			}},
+			result: SyncResult{Mutations: []repository.SyncMutation{rejected("m1", "name", syncOutdatedMessage)}, User: func() repository.User {
+				justUpdated := user
+				justUpdated.ProfileUpdatedAt = &testNow
+				return justUpdated
+			}(), Changed: true},
+		}, {
+			name: "Invalid edit is rejected alone",
+			prepare: func(f fields) {
+				read(f, "m1", "m2")
+				f.repo.EXPECT().SyncUser(gomock.Any(), repository.SyncUser{
+					PatchUser: repository.PatchUser{ID: "id-1", Version: 3, Fields: map[string]interface{}{"region": "Riau"}},
+					Mutations: []repository.SyncMutation{rejected("m1", "name", invalidNameMessage), applied("m2", "region")},
+				}).Return(nil)
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(synced, nil)
+			},
+			request: SyncRequest{UserID: "id-1", Cursor: 10, Mutations: []SyncMutation{
+				{ID: "m1", Field: "name", Value: "ab", Base: "User", ChangedAt: testNow.Add(-time.Hour)},
+				{ID: "m2", Field: "region", Value: "Riau", ChangedAt: testNow.Add(-time.Hour)},
+			}},
+			result: SyncResult{Mutations: []repository.SyncMutation{rejected("m1", "name", invalidNameMessage), applied("m2", "region")}, User: synced, Changed: true},
+		}, {
+			name: "Edits are merged in the order they were made",
+			prepare: func(f fields) {
+				read(f, "m2", "m1")
+				f.repo.EXPECT().SyncUser(gomock.Any(), repository.SyncUser{
+					PatchUser: repository.PatchUser{ID: "id-1", Version: 3, Fields: map[string]interface{}{"name": "Newer Name"}},
+					Mutations: []repository.SyncMutation{applied("m2", "name"), applied("m1", "name")},
+				}).Return(nil)
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(synced, nil)
+			},
+			// m2 was based on the name set by m1, so it is applied last
+			request: SyncRequest{UserID: "id-1", Cursor: 5, Mutations: []SyncMutation{
+				{ID: "m2", Field: "name", Value: "Newer Name", Base: "New Name", ChangedAt: testNow.Add(-time.Minute)},
+				rename,
+			}},
+			result: SyncResult{Mutations: []repository.SyncMutation{applied("m2", "name"), applied("m1", "name")}, User: synced, Changed: true},
+		}, {
+			name: "Replayed mutation",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(synced, nil)
+				f.repo.EXPECT().FindSyncMutations(gomock.Any(), "id-1", []string{"m1"}).Return([]repository.SyncMutation{applied("m1", "name")}, nil)
+			},
+			request: SyncRequest{UserID: "id-1", Cursor: 11, Mutations: []SyncMutation{rename}},
+			result:  SyncResult{Mutations: []repository.SyncMutation{applied("m1", "name")}, User: synced},
+		}, {
+			name: "Pull only",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(user, nil)
+			},
+			request: SyncRequest{UserID: "id-1", Cursor: 4},
+			result:  SyncResult{User: user, Changed: true},
+		}, {
+			name: "Merged again when modified between read and write",
+			prepare: func(f fields) {
+				read(f, "m1")
+				f.repo.EXPECT().SyncUser(gomock.Any(), gomock.Any()).Return(repository.ErrVersionConflict)
+				read(f, "m1")
+				renamed(f, applied("m1", "name"))
+			},
+			request: SyncRequest{UserID: "id-1", Cursor: 10, Mutations: []SyncMutation{rename}},
+			result:  SyncResult{Mutations: []repository.SyncMutation{applied("m1", "name")}, User: synced, Changed: true},
+		}, {
+			name: "Phone number of another user",
+			prepare: func(f fields) {
+				read(f, "m1")
+				f.repo.EXPECT().SyncUser(gomock.Any(), gomock.Any()).Return(repository.ErrDuplicatePhone)
+				read(f, "m1")
+				unchanged(f, rejected("m1", "phone", "Phone number already exist"))
+			},
+			request: SyncRequest{UserID: "id-1", Cursor: 10, Mutations: []SyncMutation{
+				{ID: "m1", Field: "phone", Value: "+62811111111", Base: "+62856712332", ChangedAt: testNow.Add(-time.Hour)},
+			}},
+			result: SyncResult{Mutations: []repository.SyncMutation{rejected("m1", "phone", "Phone number already exist")}, User: user},
+		}, {
+			name: "Modified on every attempt",
+			prepare: func(f fields) {
+				for i := 0; i < syncAttempts; i++ {
+					read(f, "m1")
+					f.repo.EXPECT().SyncUser(gomock.Any(), gomock.Any()).Return(repository.ErrVersionConflict)
+				}
+			},
+			request: SyncRequest{UserID: "id-1", Cursor: 10, Mutations: []SyncMutation{rename}},
+			err:     ErrProfileModified,
+		}, {
+			name: "Failed sync user",
+			prepare: func(f fields) {
+				read(f, "m1")
+				f.repo.EXPECT().SyncUser(gomock.Any(), gomock.Any()).Return(fmt.Errorf("error"))
+			},
+			request: SyncRequest{UserID: "id-1", Cursor: 10, Mutations: []SyncMutation{rename}},
+			err:     fmt.Errorf("error"),
+		}, {
+			name: "User not found",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(repository.User{}, repository.ErrNotFound)
+			},
+			request: SyncRequest{UserID: "id-1"},
+			err:     ErrUserNotFound,
+		}, {
+			name:    "Duplicate mutation id",
+			request: SyncRequest{UserID: "id-1", Mutations: []SyncMutation{rename, rename}},
+			err:     &ValidationError{Message: "Duplicate mutation id m1"},
+		}, {
+			name:    "Unknown field",
+			request: SyncRequest{UserID: "id-1", Mutations: []SyncMutation{{ID: "m1", Field: "password", Value: "secret"}}},
+			err:     &ValidationError{Message: "Unknown profile field password"},
+		}, {
+			name:    "Missing mutation id",
+			request: SyncRequest{UserID: "id-1", Mutations: []SyncMutation{{Field: "name", Value: "New Name"}}},
+			err:     &ValidationError{Message: "Invalid mutation id. Mutation id must be 1 to 64 characters"},
+		}, {
+			name: "Too many mutations",
+			request: SyncRequest{UserID: "id-1", Mutations: func() (mutations []SyncMutation) {
+				for i := 0; i <= MaxSyncMutations; i++ {
+					mutations = append(mutations, SyncMutation{ID: strconv.Itoa(i), Field: "name", Value: "New Name"})
+				}
+				return
+			}()},
+			err: &ValidationError{Message: "Too many mutations. At most 500 mutations can be synced at once"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, f := newTestService(t, false)
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			result, err := u.Sync(context.Background(), tt.request)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.result, result)
+		})
+	}
+}
+
+func TestSameSyncValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		current interface{}
+		base    interface{}
+		same    bool
+	}{
+		{"Same string", "Riau", "Riau", true},
+		{"Different string", "Riau", "Jambi", false},
+		{"Both empty", nil, nil, true},
+		{"Cleared", "Riau", nil, false},
+		{"Empty attributes", nil, map[string]interface{}{}, true},
+		{"Same attributes", map[string]interface{}{"block": "A", "trees": 120.0}, map[string]interface{}{"block": "A", "trees": 120.0}, true},
+		{"Different attributes", map[string]interface{}{"block": "A"}, map[string]interface{}{"block": "B"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.same, sameSyncValue(tt.current, tt.base))
+		})
+	}
+}
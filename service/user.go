@@ -0,0 +1,470 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/notification"
+	"github.com/SawitProRecruitment/UserService/phone"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/SawitProRecruitment/UserService/storage"
+	"github.com/labstack/gommon/log"
+)
+
+// loginTokenTTL : lifetime of the token issued on login
+const loginTokenTTL = time.Hour
+
+// UserService : registration, login and profile rules of users, shared by the REST and gRPC interfaces
+type UserService struct {
+	Repository    repository.RepositoryInterface
+	SMSNotifier   notification.Notifier
+	EmailNotifier notification.Notifier
+	// BlobStore store the avatar thumbnails, see UpdateAvatar
+	BlobStore storage.BlobStore
+	// BaseURL is the public url of the service, used to build links sent to users
+	BaseURL string
+	// Phone normalize phone numbers of allowed countries to E.164 before they are stored or looked up
+	Phone *phone.Normalizer
+	// EnumerationProtection hide whether a phone number or email is registered, see Register and Login
+	EnumerationProtection bool
+
+	Hasher PasswordHasher
+	Salts  SaltGenerator
+	Tokens TokenIssuer
+	Clock  Clock
+	IDs    IDGenerator
+
+	// background track notifications sent after the call returned
+	background sync.WaitGroup
+	// dummyHashOnce hash a random password on first use, compared when the user does not exist
+	dummyHashOnce sync.Once
+	dummyHash     string
+	dummyHashErr  error
+}
+
+type NewUserServiceOptions struct {
+	Repository            repository.RepositoryInterface
+	SMSNotifier           notification.Notifier
+	EmailNotifier         notification.Notifier
+	BlobStore             storage.BlobStore
+	BaseURL               string
+	Phone                 *phone.Normalizer
+	EnumerationProtection bool
+	// Tokens is required, the other dependencies default to bcrypt, random salt, system clock and UUID
+	Tokens TokenIssuer
+	Hasher PasswordHasher
+	Salts  SaltGenerator
+	Clock  Clock
+	IDs    IDGenerator
+}
+
+func NewUserService(opts NewUserServiceOptions) *UserService {
+	if opts.Phone == nil {
+		opts.Phone = phone.DefaultNormalizer()
+	}
+	if opts.Hasher == nil {
+		opts.Hasher = BcryptHasher{}
+	}
+	if opts.Salts == nil {
+		opts.Salts = RandomSaltGenerator{}
+	}
+	if opts.Clock == nil {
+		opts.Clock = SystemClock{}
+	}
+	if opts.IDs == nil {
+		opts.IDs = UUIDGenerator{}
+	}
+	return &UserService{
+		Repository:            opts.Repository,
+		SMSNotifier:           opts.SMSNotifier,
+		EmailNotifier:         opts.EmailNotifier,
+		BlobStore:             opts.BlobStore,
+		BaseURL:               opts.BaseURL,
+		Phone:                 opts.Phone,
+		EnumerationProtection: opts.EnumerationProtection,
+		Hasher:                opts.Hasher,
+		Salts:                 opts.Salts,
+		Tokens:                opts.Tokens,
+		Clock:                 opts.Clock,
+		IDs:                   opts.IDs,
+	}
+}
+
+// Wait : wait for notifications still being sent in background
+func (u *UserService) Wait() {
+	u.background.Wait()
+}
+
+// HashPassword : hash the password with a new salt
+func (u *UserService) HashPassword(password string) (hash string, salt string, err error) {
+	salt, err = u.Salts.Generate()
+	if err != nil {
+		return "", "", err
+	}
+	hash, err = u.Hasher.Hash(password, salt)
+	if err != nil {
+		return "", "", err
+	}
+	return hash, salt, nil
+}
+
+// CheckPassword : check the password of the user, a nil user spends the same time as a wrong password so unknown users cannot be told apart
+func (u *UserService) CheckPassword(user *repository.User, password string) bool {
+	if user == nil {
+		u.dummyHashOnce.Do(func() {
+			u.dummyHash, _, u.dummyHashErr = u.HashPassword(u.IDs.NewID())
+		})
+		if u.dummyHashErr == nil {
+			_ = u.Hasher.Compare(u.dummyHash, password, "")
+		}
+		return false
+	}
+	return u.Hasher.Compare(user.Password, password, user.Salt) == nil
+}
+
+// NormalizePhone : phone number in E.164, ValidationError when it is not a valid number of an allowed country
+func (u *UserService) NormalizePhone(phoneNumber string) (string, error) {
+	normalized, err := u.Phone.Normalize(phoneNumber)
+	if err != nil {
+		return "", invalid(invalidPhoneMessage)
+	}
+	return normalized, nil
+}
+
+// NewRegistration : validate name and password of new user and hash the password, the phone number must be normalized already
+func (u *UserService) NewRegistration(phoneNumber string, name string, password string) (repository.RegistrationInput, error) {
+	if err := ValidateName(name); err != nil {
+		return repository.RegistrationInput{}, err
+	}
+	if err := ValidatePassword(password); err != nil {
+		return repository.RegistrationInput{}, err
+	}
+
+	hashedPassword, salt, err := u.HashPassword(password)
+	if err != nil {
+		return repository.RegistrationInput{}, err
+	}
+
+	return repository.RegistrationInput{
+		ID:       u.IDs.NewID(),
+		Phone:    phoneNumber,
+		Name:     name,
+		Password: hashedPassword,
+		Salt:     salt,
+	}, nil
+}
+
+// Register : validate and store new user, returning the id.
+// With enumeration protection a registered phone number looks like a successful registration, the owner of the number is told by SMS instead.
+func (u *UserService) Register(ctx context.Context, phoneNumber string, name string, password string) (string, error) {
+	// Phone number is stored in E.164
+	phoneNumber, err := u.NormalizePhone(phoneNumber)
+	if err != nil {
+		return "", err
+	}
+
+	input, err := u.NewRegistration(phoneNumber, name, password)
+	if err != nil {
+		return "", err
+	}
+
+	output, err := u.Repository.Registration(ctx, input)
+	if errors.Is(err, repository.ErrDuplicatePhone) {
+		if u.EnumerationProtection {
+			u.notifyDuplicateRegistration(phoneNumber)
+			return input.ID, nil
+		}
+		return "", ErrDuplicatePhone
+	}
+	if err != nil {
+		return "", err
+	}
+	return output.ID, nil
+}
+
+// notifyDuplicateRegistration : tell the owner of the phone number someone tried to register it, sent in background so the response time does not depend on it
+func (u *UserService) notifyDuplicateRegistration(phoneNumber string) {
+	u.NotifyInBackground(notification.Message{
+		To:   phoneNumber,
+		Body: "Someone tried to register a SawitPro account with your phone number. If it was you, login with your existing account instead. If not, you can ignore this message.",
+	})
+}
+
+// NotifyInBackground : send SMS after the call returned, failures are only logged. Wait block until it is sent
+func (u *UserService) NotifyInBackground(message notification.Message) {
+	u.background.Add(1)
+	go func() {
+		defer u.background.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if err := u.SMSNotifier.Notify(ctx, message); err != nil {
+			log.Error(err)
+		}
+	}()
+}
+
+// LoginInput : credentials of password login, either Phone or Email is set
+type LoginInput struct {
+	Phone    *string
+	Email    *string
+	Password string
+}
+
+// LoginResult : token of the logged in user
+type LoginResult struct {
+	Token string
+	User  repository.User
+}
+
+// Login : check the credentials and issue token.
+// With enumeration protection unknown users and wrong passwords both fail with ErrInvalidCredentials and take the same time.
+func (u *UserService) Login(ctx context.Context, input LoginInput) (LoginResult, error) {
+	// User login with either phone number or email
+	if (input.Phone == nil) == (input.Email == nil) {
+		return LoginResult{}, invalid("Either phone number or email is required")
+	}
+
+	identifier := repository.Param{
+		Logic:    "AND",
+		Operator: "=",
+	}
+	if input.Phone != nil {
+		phoneNumber, err := u.NormalizePhone(*input.Phone)
+		if err != nil {
+			return LoginResult{}, err
+		}
+		identifier.Field = "phone"
+		identifier.Value = phoneNumber
+	} else {
+		email := strings.ToLower(*input.Email)
+		if !IsValidEmail(email) {
+			return LoginResult{}, invalid(invalidEmailMessage)
+		}
+		identifier.Field = "email"
+		identifier.Value = email
+	}
+
+	if !IsValidPassword(input.Password) {
+		return LoginResult{}, invalid(invalidPasswordMessage)
+	}
+
+	user, err := u.FindLoginUser(ctx, identifier)
+	if err != nil {
+		log.Error(err)
+		if u.EnumerationProtection {
+			u.CheckPassword(nil, input.Password)
+			return LoginResult{}, ErrInvalidCredentials
+		}
+		return LoginResult{}, ErrUserNotFound
+	}
+
+	if !u.CheckPassword(&user, input.Password) {
+		if u.EnumerationProtection {
+			return LoginResult{}, ErrInvalidCredentials
+		}
+		return LoginResult{}, ErrInvalidPassword
+	}
+
+	// Unverified email cannot be used to login, checked after the password so it does not reveal the email is registered
+	if input.Email != nil && user.EmailVerifiedAt == nil {
+		return LoginResult{}, ErrEmailNotVerified
+	}
+
+	token, err := u.IssueLoginToken(ctx, user)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	return LoginResult{Token: token, User: user}, nil
+}
+
+// FindLoginUser : user of the phone or email login identifier. Unverified emails are not unique, so the user that
+// verified the email is preferred, another user that added it is only returned to tell it is not verified.
+func (u *UserService) FindLoginUser(ctx context.Context, identifier repository.Param) (repository.User, error) {
+	if email, ok := identifier.Value.(string); ok && identifier.Field == "email" {
+		user, err := u.Repository.FindVerifiedEmailUser(ctx, email)
+		if !errors.Is(err, repository.ErrNotFound) {
+			return user, err
+		}
+	}
+	return u.Repository.FindUser(ctx, identifier)
+}
+
+// IssueLoginToken : token of the authenticated user, shared by every login method
+func (u *UserService) IssueLoginToken(ctx context.Context, user repository.User) (string, error) {
+	// Checked after the credentials so it does not reveal the account exists
+	if user.DeactivatedAt != nil {
+		return "", ErrUserDeactivated
+	}
+
+	// The earliest joined organization is active until the user switches to another one
+	memberships, err := u.Repository.ListUserMemberships(ctx, user.ID)
+	if err != nil {
+		return "", err
+	}
+	organizationID := ""
+	if len(memberships) > 0 {
+		organizationID = memberships[0].OrganizationID
+	}
+
+	token, err := u.Tokens.IssueUserToken(user.ID, organizationID, u.Clock.Now().Add(loginTokenTTL))
+	if err != nil {
+		return "", err
+	}
+
+	// Login attempt increment
+	if err := u.Repository.IncreaseLoginAttempt(ctx, user.Phone); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// GetUser : user of the id, ErrUserNotFound when it cannot be found
+func (u *UserService) GetUser(ctx context.Context, id string) (repository.User, error) {
+	user, err := u.Repository.FindUser(ctx, repository.Param{
+		Logic:    "AND",
+		Field:    "id",
+		Operator: "=",
+		Value:    id,
+	})
+	if err != nil {
+		log.Error(err)
+		return repository.User{}, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// ProfileUpdate : requested change of the profile of the user, nil fields keep their current value
+type ProfileUpdate struct {
+	UserID string
+	// Fields : new values of the profile fields by name, e.g. phone or date_of_birth
+	Fields     map[string]*string
+	Attributes *map[string]interface{}
+	// Precondition : check the current version, e.g. against an If-Match header, the update fails with ErrProfileModified when it returns false
+	Precondition func(version int) bool
+}
+
+// UpdateProfile : apply the requested fields on top of the current profile, returning the new version
+func (u *UserService) UpdateProfile(ctx context.Context, update ProfileUpdate) (int, error) {
+	user, err := u.GetUser(ctx, update.UserID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Reject update when client is editing stale profile
+	if update.Precondition != nil && !update.Precondition(user.Version) {
+		return 0, ErrProfileModified
+	}
+
+	doc := ProfileDocument(user)
+	for key, value := range update.Fields {
+		if value != nil {
+			doc[key] = *value
+		}
+	}
+	if update.Attributes != nil {
+		doc["attributes"] = *update.Attributes
+	}
+
+	profile, err := u.ValidateProfile(doc)
+	if err != nil {
+		return 0, err
+	}
+	if update.Attributes != nil {
+		if err := u.ValidateAttributes(ctx, user.Tenant, profile.Attributes); err != nil {
+			return 0, err
+		}
+	}
+
+	err = u.Repository.UpdateUser(ctx, repository.UpdateUser{
+		ID:                user.ID,
+		Phone:             profile.Phone,
+		Name:              profile.Name,
+		Email:             profile.Email,
+		PreferredLanguage: profile.PreferredLanguage,
+		AvatarURL:         profile.AvatarURL,
+		DateOfBirth:       profile.DateOfBirth,
+		Address:           profile.Address,
+		Estate:            profile.Estate,
+		Region:            profile.Region,
+		Attributes:        profile.Attributes,
+		Version:           user.Version,
+	})
+	if err != nil {
+		// Profile changed between read and write
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return 0, ErrProfileModified
+		}
+		return 0, DuplicateError(err)
+	}
+	return user.Version + 1, nil
+}
+
+// ProfilePatch : requested change of the profile of the user as a patch of the profile document
+type ProfilePatch struct {
+	UserID string
+	// Apply : patched copy of the current profile document, e.g. JSON Merge Patch or JSON Patch
+	Apply        func(current map[string]interface{}) (map[string]interface{}, error)
+	Precondition func(version int) bool
+}
+
+// PatchProfile : store the changed fields of the patched profile, returning the user with the new profile and version
+func (u *UserService) PatchProfile(ctx context.Context, patch ProfilePatch) (repository.User, error) {
+	user, err := u.GetUser(ctx, patch.UserID)
+	if err != nil {
+		return repository.User{}, err
+	}
+
+	// Reject patch when client is editing stale profile
+	if patch.Precondition != nil && !patch.Precondition(user.Version) {
+		return repository.User{}, ErrProfileModified
+	}
+
+	patched, err := patch.Apply(ProfileDocument(user))
+	if err != nil {
+		return repository.User{}, err
+	}
+	profile, err := u.ValidateProfile(patched)
+	if err != nil {
+		return repository.User{}, err
+	}
+
+	// Collect changed columns only
+	fields := ProfileChanges(ProfileOf(user), profile)
+	if _, changed := fields["attributes"]; changed {
+		if err := u.ValidateAttributes(ctx, user.Tenant, profile.Attributes); err != nil {
+			return repository.User{}, err
+		}
+	}
+
+	if len(fields) > 0 {
+		err = u.Repository.PatchUser(ctx, repository.PatchUser{
+			ID:      user.ID,
+			Version: user.Version,
+			Fields:  fields,
+		})
+		if err != nil {
+			// Profile changed between read and write
+			if errors.Is(err, repository.ErrVersionConflict) {
+				return repository.User{}, ErrProfileModified
+			}
+			return repository.User{}, DuplicateError(err)
+		}
+		user.Version++
+	}
+	return ApplyProfile(user, profile), nil
+}
+
+// DuplicateError : ErrDuplicateEmail or ErrDuplicatePhone when the repository rejected a phone number or email used by another user, other errors are returned as is
+func DuplicateError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrDuplicatePhone):
+		return ErrDuplicatePhone
+	case errors.Is(err, repository.ErrDuplicateEmail):
+		return ErrDuplicateEmail
+	}
+	return err
+}
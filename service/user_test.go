@@ -0,0 +1,487 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/SawitProRecruitment/UserService/notification"
+	"github.com/SawitProRecruitment/UserService/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// fixedClock : clock that always returns the same time
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+type fields struct {
+	repo     *repository.MockRepositoryInterface
+	notifier *notification.MockNotifier
+	emails   *notification.MockNotifier
+	hasher   *MockPasswordHasher
+	salts    *MockSaltGenerator
+	tokens   *MockTokenIssuer
+	ids      *MockIDGenerator
+}
+
+var testNow = time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+
+func newTestService(t *testing.T, enumerationProtection bool) (*UserService, fields) {
+	ctrl := gomock.NewController(t)
+	f := fields{
+		repo:     repository.NewMockRepositoryInterface(ctrl),
+		notifier: notification.NewMockNotifier(ctrl),
+		emails:   notification.NewMockNotifier(ctrl),
+		hasher:   NewMockPasswordHasher(ctrl),
+		salts:    NewMockSaltGenerator(ctrl),
+		tokens:   NewMockTokenIssuer(ctrl),
+		ids:      NewMockIDGenerator(ctrl),
+	}
+	u := NewUserService(NewUserServiceOptions{
+		Repository:            f.repo,
+		SMSNotifier:           f.notifier,
+		EmailNotifier:         f.emails,
+		BaseURL:               "http://localhost:8080",
+		EnumerationProtection: enumerationProtection,
+		Hasher:                f.hasher,
+		Salts:                 f.salts,
+		Tokens:                f.tokens,
+		Clock:                 fixedClock(testNow),
+		IDs:                   f.ids,
+	})
+	return u, f
+}
+
+func TestUserService_Register(t *testing.T) {
+	password := "QWErty123!@#"
+	input := repository.RegistrationInput{ID: "id-1", Phone: "+62856712332", Name: "User", Password: "hash", Salt: "salt"}
+	hashed := func(f fields) {
+		f.salts.EXPECT().Generate().Return("salt", nil)
+		f.hasher.EXPECT().Hash(password, "salt").Return("hash", nil)
+		f.ids.EXPECT().NewID().Return("id-1")
+	}
+
+	tests := []struct {
+		name                  string
+		enumerationProtection bool
+		prepare               func(f fields)
+		phone                 string
+		userName              string
+		password              string
+		id                    string
+		err                   error
+	}{
+		{
+			name: "Success",
+			prepare: func(f fields) {
+				hashed(f)
+				f.repo.EXPECT().Registration(gomock.Any(), input).Return(repository.RegistrationOutput{ID: "id-1"}, nil)
+			},
+			phone:    "0856712332",
+			userName: "User",
+			password: password,
+			id:       "id-1",
+		}, {
+			name:     "Invalid phone number",
+			phone:    "+60123456789",
+			userName: "User",
+			password: password,
+			err:      &ValidationError{Message: invalidPhoneMessage},
+		}, {
+			name:     "Invalid name",
+			phone:    "0856712332",
+			userName: "Us",
+			password: password,
+			err:      &ValidationError{Message: invalidNameMessage},
+		}, {
+			name:     "Invalid password",
+			phone:    "0856712332",
+			userName: "User",
+			password: "short",
+			err:      &ValidationError{Message: invalidPasswordMessage},
+		}, {
+			name: "Failed generate salt",
+			prepare: func(f fields) {
+				f.salts.EXPECT().Generate().Return("", fmt.Errorf("entropy"))
+			},
+			phone:    "0856712332",
+			userName: "User",
+			password: password,
+			err:      fmt.Errorf("entropy"),
+		}, {
+			name: "Failed hash password",
+			prepare: func(f fields) {
+				f.salts.EXPECT().Generate().Return("salt", nil)
+				f.hasher.EXPECT().Hash(password, "salt").Return("", fmt.Errorf("hash"))
+			},
+			phone:    "0856712332",
+			userName: "User",
+			password: password,
+			err:      fmt.Errorf("hash"),
+		}, {
+			name: "Registered phone number",
+			prepare: func(f fields) {
+				hashed(f)
+				f.repo.EXPECT().Registration(gomock.Any(), input).Return(repository.RegistrationOutput{}, repository.ErrDuplicatePhone)
+			},
+			phone:    "0856712332",
+			userName: "User",
+			password: password,
+			err:      ErrDuplicatePhone,
+		}, {
+			name:                  "Registered phone number with enumeration protection",
+			enumerationProtection: true,
+			prepare: func(f fields) {
+				hashed(f)
+				f.repo.EXPECT().Registration(gomock.Any(), input).Return(repository.RegistrationOutput{}, repository.ErrDuplicatePhone)
+				f.notifier.EXPECT().Notify(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, message notification.Message) error {
+					assert.Equal(t, "+62856712332", message.To)
+					return nil
+				})
+			},
+			phone:    "0856712332",
+			userName: "User",
+			password: password,
+			id:       "id-1",
+		}, {
+			name: "Failed registration",
+			prepare: func(f fields) {
+				hashed(f)
+				f.repo.EXPECT().Registration(gomock.Any(), input).Return(repository.RegistrationOutput{}, fmt.Errorf("error"))
+			},
+			phone:    "0856712332",
+			userName: "User",
+			password: password,
+			err:      fmt.Errorf("error"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, f := newTestService(t, tt.enumerationProtection)
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			id, err := u.Register(context.Background(), tt.phone, tt.userName, tt.password)
+			u.Wait()
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.id, id)
+		})
+	}
+}
+
+func TestUserService_Login(t *testing.T) {
+	phone := "+62856712332"
+	email := "User@Example.com"
+	password := "QWErty123!@#"
+	verifiedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	user := repository.User{ID: "id-1", Phone: phone, Password: "hash", Salt: "salt", EmailVerifiedAt: &verifiedAt}
+	phoneParam := repository.Param{Logic: "AND", Field: "phone", Operator: "=", Value: phone}
+	emailParam := repository.Param{Logic: "AND", Field: "email", Operator: "=", Value: "user@example.com"}
+
+	tests := []struct {
+		name                  string
+		enumerationProtection bool
+		prepare               func(f fields)
+		input                 LoginInput
+		result                LoginResult
+		err                   error
+	}{
+		{
+			name: "Success with active organization",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(user, nil)
+				f.hasher.EXPECT().Compare("hash", password, "salt").Return(nil)
+				f.repo.EXPECT().ListUserMemberships(gomock.Any(), "id-1").Return([]repository.Membership{{OrganizationID: "org-1"}, {OrganizationID: "org-2"}}, nil)
+				f.tokens.EXPECT().IssueUserToken("id-1", "org-1", testNow.Add(time.Hour)).Return("token", nil)
+				f.repo.EXPECT().IncreaseLoginAttempt(gomock.Any(), phone).Return(nil)
+			},
+			input:  LoginInput{Phone: &phone, Password: password},
+			result: LoginResult{Token: "token", User: user},
+		}, {
+			name: "Success with email",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindVerifiedEmailUser(gomock.Any(), "user@example.com").Return(user, nil)
+				f.hasher.EXPECT().Compare("hash", password, "salt").Return(nil)
+				f.repo.EXPECT().ListUserMemberships(gomock.Any(), "id-1").Return(nil, nil)
+				f.tokens.EXPECT().IssueUserToken("id-1", "", testNow.Add(time.Hour)).Return("token", nil)
+				f.repo.EXPECT().IncreaseLoginAttempt(gomock.Any(), phone).Return(nil)
+			},
+			input:  LoginInput{Email: &email, Password: password},
+			result: LoginResult{Token: "token", User: user},
+		}, {
+			name:  "Without identifier",
+			input: LoginInput{Password: password},
+			err:   &ValidationError{Message: "Either phone number or email is required"},
+		}, {
+			name:  "Invalid password format",
+			input: LoginInput{Phone: &phone, Password: "short"},
+			err:   &ValidationError{Message: invalidPasswordMessage},
+		}, {
+			name: "Unknown user",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(repository.User{}, repository.ErrNotFound)
+			},
+			input: LoginInput{Phone: &phone, Password: password},
+			err:   ErrUserNotFound,
+		}, {
+			name:                  "Unknown user with enumeration protection",
+			enumerationProtection: true,
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(repository.User{}, repository.ErrNotFound)
+				// The password is compared against a dummy hash so the response time is the same
+				f.ids.EXPECT().NewID().Return("random")
+				f.salts.EXPECT().Generate().Return("salt", nil)
+				f.hasher.EXPECT().Hash("random", "salt").Return("dummy", nil)
+				f.hasher.EXPECT().Compare("dummy", password, "").Return(fmt.Errorf("mismatch"))
+			},
+			input: LoginInput{Phone: &phone, Password: password},
+			err:   ErrInvalidCredentials,
+		}, {
+			name: "Wrong password",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(user, nil)
+				f.hasher.EXPECT().Compare("hash", password, "salt").Return(fmt.Errorf("mismatch"))
+			},
+			input: LoginInput{Phone: &phone, Password: password},
+			err:   ErrInvalidPassword,
+		}, {
+			name:                  "Wrong password with enumeration protection",
+			enumerationProtection: true,
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(user, nil)
+				f.hasher.EXPECT().Compare("hash", password, "salt").Return(fmt.Errorf("mismatch"))
+			},
+			input: LoginInput{Phone: &phone, Password: password},
+			err:   ErrInvalidCredentials,
+		}, {
+			name: "Unverified email",
+			prepare: func(f fields) {
+				unverified := user
+				unverified.EmailVerifiedAt = nil
+				f.repo.EXPECT().FindVerifiedEmailUser(gomock.Any(), "user@example.com").Return(repository.User{}, repository.ErrNotFound)
+				f.repo.EXPECT().FindUser(gomock.Any(), emailParam).Return(unverified, nil)
+				f.hasher.EXPECT().Compare("hash", password, "salt").Return(nil)
+			},
+			input: LoginInput{Email: &email, Password: password},
+			err:   ErrEmailNotVerified,
+		}, {
+			name: "Deactivated user",
+			prepare: func(f fields) {
+				deactivated := user
+				deactivated.DeactivatedAt = &verifiedAt
+				f.repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(deactivated, nil)
+				f.hasher.EXPECT().Compare("hash", password, "salt").Return(nil)
+			},
+			input: LoginInput{Phone: &phone, Password: password},
+			err:   ErrUserDeactivated,
+		}, {
+			name: "Failed issue token",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(user, nil)
+				f.hasher.EXPECT().Compare("hash", password, "salt").Return(nil)
+				f.repo.EXPECT().ListUserMemberships(gomock.Any(), "id-1").Return(nil, nil)
+				f.tokens.EXPECT().IssueUserToken("id-1", "", testNow.Add(time.Hour)).Return("", fmt.Errorf("sign"))
+			},
+			input: LoginInput{Phone: &phone, Password: password},
+			err:   fmt.Errorf("sign"),
+		}, {
+			name: "Failed increase login attempt",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), phoneParam).Return(user, nil)
+				f.hasher.EXPECT().Compare("hash", password, "salt").Return(nil)
+				f.repo.EXPECT().ListUserMemberships(gomock.Any(), "id-1").Return(nil, nil)
+				f.tokens.EXPECT().IssueUserToken("id-1", "", testNow.Add(time.Hour)).Return("token", nil)
+				f.repo.EXPECT().IncreaseLoginAttempt(gomock.Any(), phone).Return(fmt.Errorf("error"))
+			},
+			input: LoginInput{Phone: &phone, Password: password},
+			err:   fmt.Errorf("error"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, f := newTestService(t, tt.enumerationProtection)
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			result, err := u.Login(context.Background(), tt.input)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.result, result)
+		})
+	}
+}
+
+func TestUserService_UpdateProfile(t *testing.T) {
+	user := repository.User{ID: "id-1", Phone: "+62856712332", Name: "User", Tenant: "default", Version: 3}
+	userParam := repository.Param{Logic: "AND", Field: "id", Operator: "=", Value: "id-1"}
+	newName := "New Name"
+	email := "user@example.com"
+	tomorrow := "2024-06-02"
+	dateOfBirth := "1990-05-17"
+	birthday := time.Date(1990, 5, 17, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		prepare func(f fields)
+		update  ProfileUpdate
+		version int
+		err     error
+	}{
+		{
+			name: "Success",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(user, nil)
+				f.repo.EXPECT().UpdateUser(gomock.Any(), repository.UpdateUser{ID: "id-1", Phone: "+62856712332", Name: newName, DateOfBirth: &birthday, Version: 3}).Return(nil)
+			},
+			update:  ProfileUpdate{UserID: "id-1", Fields: map[string]*string{"name": &newName, "date_of_birth": &dateOfBirth}},
+			version: 4,
+		}, {
+			name: "Unknown user",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(repository.User{}, repository.ErrNotFound)
+			},
+			update: ProfileUpdate{UserID: "id-1", Fields: map[string]*string{"name": &newName}},
+			err:    ErrUserNotFound,
+		}, {
+			name: "Failed precondition",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(user, nil)
+			},
+			update: ProfileUpdate{UserID: "id-1", Fields: map[string]*string{"name": &newName}, Precondition: func(version int) bool {
+				return version == 2
+			}},
+			err: ErrProfileModified,
+		}, {
+			name: "Date of birth in the future",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(user, nil)
+			},
+			update: ProfileUpdate{UserID: "id-1", Fields: map[string]*string{"date_of_birth": &tomorrow}},
+			err:    &ValidationError{Message: "Invalid date of birth. Date of birth must be formatted as YYYY-MM-DD and not in the future"},
+		}, {
+			name: "Modified between read and write",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(user, nil)
+				f.repo.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Return(repository.ErrVersionConflict)
+			},
+			update: ProfileUpdate{UserID: "id-1", Fields: map[string]*string{"name": &newName}},
+			err:    ErrProfileModified,
+		}, {
+			name: "Registered email",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(user, nil)
+				f.repo.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Return(repository.ErrDuplicateEmail)
+			},
+			update: ProfileUpdate{UserID: "id-1", Fields: map[string]*string{"email": &email}},
+			err:    ErrDuplicateEmail,
+		}, {
+			name: "Invalid attributes",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(user, nil)
+				f.repo.EXPECT().FindAttributeSchema(gomock.Any(), "default").Return([]byte(`{"type":"object","properties":{"block":{"type":"string"}}}`), nil)
+			},
+			update: ProfileUpdate{UserID: "id-1", Attributes: &map[string]interface{}{"block": 1.0}},
+			err:    &ValidationError{Message: "Invalid attributes. value must be a string"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, f := newTestService(t, false)
+			tt.prepare(f)
+
+			version, err := u.UpdateProfile(context.Background(), tt.update)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.version, version)
+		})
+	}
+}
+
+func TestUserService_PatchProfile(t *testing.T) {
+	user := repository.User{ID: "id-1", Phone: "+62856712332", Name: "User", Version: 3}
+	userParam := repository.Param{Logic: "AND", Field: "id", Operator: "=", Value: "id-1"}
+	rename := func(current map[string]interface{}) (map[string]interface{}, error) {
+		current["name"] = "New Name"
+		return current, nil
+	}
+
+	tests := []struct {
+		name    string
+		prepare func(f fields)
+		patch   ProfilePatch
+		user    repository.User
+		err     error
+	}{
+		{
+			name: "Success",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(user, nil)
+				f.repo.EXPECT().PatchUser(gomock.Any(), repository.PatchUser{ID: "id-1", Version: 3, Fields: map[string]interface{}{"name": "New Name"}}).Return(nil)
+			},
+			patch: ProfilePatch{UserID: "id-1", Apply: rename},
+			user:  repository.User{ID: "id-1", Phone: "+62856712332", Name: "New Name", Version: 4},
+		}, {
+			name: "Nothing changed",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(user, nil)
+			},
+			patch: ProfilePatch{UserID: "id-1", Apply: func(current map[string]interface{}) (map[string]interface{}, error) {
+				return current, nil
+			}},
+			user: user,
+		}, {
+			name: "Invalid patch",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(user, nil)
+			},
+			patch: ProfilePatch{UserID: "id-1", Apply: func(current map[string]interface{}) (map[string]interface{}, error) {
+				return nil, &ValidationError{Message: "Invalid patch document"}
+			}},
+			err: &ValidationError{Message: "Invalid patch document"},
+		}, {
+			name: "Failed precondition",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(user, nil)
+			},
+			patch: ProfilePatch{UserID: "id-1", Apply: rename, Precondition: func(version int) bool {
+				return false
+			}},
+			err: ErrProfileModified,
+		}, {
+			name: "Modified between read and write",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(user, nil)
+				f.repo.EXPECT().PatchUser(gomock.Any(), gomock.Any()).Return(repository.ErrVersionConflict)
+			},
+			patch: ProfilePatch{UserID: "id-1", Apply: rename},
+			err:   ErrProfileModified,
+		}, {
+			name: "Failed patch user",
+			prepare: func(f fields) {
+				f.repo.EXPECT().FindUser(gomock.Any(), userParam).Return(user, nil)
+				f.repo.EXPECT().PatchUser(gomock.Any(), gomock.Any()).Return(fmt.Errorf("error"))
+			},
+			patch: ProfilePatch{UserID: "id-1", Apply: rename},
+			err:   fmt.Errorf("error"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, f := newTestService(t, false)
+			tt.prepare(f)
+
+			patched, err := u.PatchProfile(context.Background(), tt.patch)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.user, patched)
+		})
+	}
+}
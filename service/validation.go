@@ -0,0 +1,64 @@
+package service
+
+import (
+	"net/mail"
+	"net/url"
+	"regexp"
+)
+
+const (
+	invalidPhoneMessage    = "Invalid phone number. Phone numbers must be a valid number of a supported country, e.g. +62812345678 or 0812345678"
+	invalidNameMessage     = "Invalid full name. Full names must be 3 to 60 characters"
+	invalidPasswordMessage = "Invalid password. Passwords must be 6 to 64 characters and contain at least 1 uppercase letter, 1 digit, and 1 special character"
+	invalidEmailMessage    = "Invalid email. Email must be a valid address of at most 254 characters"
+)
+
+var (
+	uppercaseRegex   = regexp.MustCompile(`[A-Z]`)
+	numberRegex      = regexp.MustCompile(`[0-9]`)
+	specialCharRegex = regexp.MustCompile(`[^a-zA-Z0-9]`)
+)
+
+// ValidateName : ValidationError when the full name of the user is invalid
+func ValidateName(name string) error {
+	if len(name) < 3 || len(name) > 60 {
+		return invalid(invalidNameMessage)
+	}
+	return nil
+}
+
+// ValidatePassword : ValidationError when the password does not follow the password rules
+func ValidatePassword(password string) error {
+	if !IsValidPassword(password) {
+		return invalid(invalidPasswordMessage)
+	}
+	return nil
+}
+
+// IsValidPassword : 6 to 64 characters with at least 1 uppercase letter, 1 digit and 1 special character
+func IsValidPassword(password string) bool {
+	// Check length
+	if len(password) < 6 || len(password) > 64 {
+		return false
+	}
+
+	// Check for at least one uppercase letter, one number and one special character
+	return uppercaseRegex.MatchString(password) && numberRegex.MatchString(password) && specialCharRegex.MatchString(password)
+}
+
+// IsValidEmail : single address of at most 254 characters without display name
+func IsValidEmail(email string) bool {
+	if len(email) > 254 {
+		return false
+	}
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email
+}
+
+func isValidAvatarURL(avatarURL string) bool {
+	if len(avatarURL) > 255 {
+		return false
+	}
+	parsed, err := url.Parse(avatarURL)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
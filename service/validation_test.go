@@ -0,0 +1,34 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsValidPassword(t *testing.T) {
+	// Valid passwords
+	validPasswords := []string{"Abcd123!", "StrongP@ss123", "SecurePwd987!"}
+
+	// Invalid passwords
+	invalidPasswords := []string{"short", "weakpassword", "NoSpecialCharacter123", "NoNumber!@#$%^&*()"}
+
+	for _, password := range validPasswords {
+		assert.True(t, IsValidPassword(password), "Expected %s to be a valid password", password)
+	}
+
+	for _, password := range invalidPasswords {
+		assert.False(t, IsValidPassword(password), "Expected %s to be an invalid password", password)
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	assert.NoError(t, ValidateName("Budi"))
+	assert.Equal(t, &ValidationError{Message: invalidNameMessage}, ValidateName("Bu"))
+}
+
+func TestIsValidEmail(t *testing.T) {
+	assert.True(t, IsValidEmail("user@example.com"))
+	assert.False(t, IsValidEmail("not-an-email"))
+	assert.False(t, IsValidEmail("User <user@example.com>"))
+}
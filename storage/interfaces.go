@@ -0,0 +1,14 @@
+// This file contains the interfaces for the storage layer.
+// The storage layer is responsible for storing binary objects such as avatar images.
+package storage
+
+import (
+	"context"
+	"io"
+)
+
+type BlobStore interface {
+	Put(ctx context.Context, key string, body io.Reader, contentType string) (err error)
+	Get(ctx context.Context, key string) (body io.ReadCloser, info ObjectInfo, err error)
+	Delete(ctx context.Context, key string) (err error)
+}
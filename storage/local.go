@@ -0,0 +1,106 @@
+// This file contains the local filesystem implementation of BlobStore.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+type LocalStore struct {
+	Root string
+}
+
+type NewLocalStoreOptions struct {
+	Root string
+}
+
+func NewLocalStore(opts NewLocalStoreOptions) *LocalStore {
+	return &LocalStore{
+		Root: opts.Root,
+	}
+}
+
+// Put : write object to file under root directory, content type is derived from key extension when read back
+func (s *LocalStore) Put(ctx context.Context, key string, body io.Reader, contentType string) (err error) {
+	filename, err := s.filename(key)
+	if err != nil {
+		return
+	}
+
+	if err = os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return
+	}
+
+	// Write to temporary file first so reader never see partial object
+	tmp, err := os.CreateTemp(filepath.Dir(filename), ".upload-*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string) (body io.ReadCloser, info ObjectInfo, err error) {
+	filename, err := s.filename(key)
+	if err != nil {
+		return
+	}
+
+	file, err := os.Open(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, info, ErrNotFound
+	}
+	if err != nil {
+		return
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return
+	}
+
+	info.Size = stat.Size()
+	info.ContentType = mime.TypeByExtension(path.Ext(key))
+	if info.ContentType == "" {
+		info.ContentType = "application/octet-stream"
+	}
+	return file, info, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) (err error) {
+	filename, err := s.filename(key)
+	if err != nil {
+		return
+	}
+
+	err = os.Remove(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return
+}
+
+// filename : map object key to file path, key must stay inside root directory
+func (s *LocalStore) filename(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if key == "" || strings.HasSuffix(key, "/") || cleaned != "/"+key {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(cleaned)), nil
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewLocalStore(NewLocalStoreOptions{Root: t.TempDir()})
+
+	// Put and get back the object
+	err := store.Put(ctx, "avatars/123/abc/64.jpg", strings.NewReader("image"), "image/jpeg")
+	assert.NoError(t, err)
+
+	body, info, err := store.Get(ctx, "avatars/123/abc/64.jpg")
+	assert.NoError(t, err)
+	content, _ := io.ReadAll(body)
+	body.Close()
+	assert.Equal(t, "image", string(content))
+	assert.Equal(t, "image/jpeg", info.ContentType)
+	assert.Equal(t, int64(5), info.Size)
+
+	// Delete the object, deleting twice is not an error
+	assert.NoError(t, store.Delete(ctx, "avatars/123/abc/64.jpg"))
+	assert.NoError(t, store.Delete(ctx, "avatars/123/abc/64.jpg"))
+
+	_, _, err = store.Get(ctx, "avatars/123/abc/64.jpg")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestLocalStoreInvalidKey(t *testing.T) {
+	ctx := context.Background()
+	store := NewLocalStore(NewLocalStoreOptions{Root: t.TempDir()})
+
+	for _, key := range []string{"", "../secret", "avatars/../../secret", "/absolute", "avatars/"} {
+		err := store.Put(ctx, key, strings.NewReader("image"), "image/jpeg")
+		assert.Error(t, err, "Expected %q to be rejected", key)
+	}
+}
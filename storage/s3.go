@@ -0,0 +1,221 @@
+// This file contains the S3 compatible implementation of BlobStore, requests are signed with AWS Signature Version 4.
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type S3Store struct {
+	Endpoint        *url.URL
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Client          *http.Client
+	now             func() time.Time
+}
+
+type NewS3StoreOptions struct {
+	// Endpoint is the base url of the S3 compatible service, e.g. https://s3.ap-southeast-1.amazonaws.com or http://minio:9000
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Client          *http.Client
+}
+
+func NewS3Store(opts NewS3StoreOptions) *S3Store {
+	endpoint, err := url.Parse(opts.Endpoint)
+	if err != nil {
+		panic(err)
+	}
+
+	client := opts.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &S3Store{
+		Endpoint:        endpoint,
+		Region:          opts.Region,
+		Bucket:          opts.Bucket,
+		AccessKeyID:     opts.AccessKeyID,
+		SecretAccessKey: opts.SecretAccessKey,
+		Client:          client,
+		now:             time.Now,
+	}
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, body io.Reader, contentType string) (err error) {
+	// Payload is buffered because the signature need the payload hash
+	payload, err := io.ReadAll(body)
+	if err != nil {
+		return
+	}
+
+	req, err := s.newRequest(ctx, http.MethodPut, key, payload)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	return
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (body io.ReadCloser, info ObjectInfo, err error) {
+	req, err := s.newRequest(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, info, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, info, responseError(resp)
+	}
+
+	info.ContentType = resp.Header.Get("Content-Type")
+	info.Size = resp.ContentLength
+	return resp.Body, info, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) (err error) {
+	req, err := s.newRequest(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	// Deleting missing object is not an error on S3
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	return
+}
+
+// newRequest : build signed path style request of the object
+func (s *S3Store) newRequest(ctx context.Context, method, key string, payload []byte) (*http.Request, error) {
+	target := *s.Endpoint
+	target.Path = strings.TrimSuffix(target.Path, "/") + "/" + s.Bucket + "/" + key
+	target.RawPath = strings.TrimSuffix(s.Endpoint.EscapedPath(), "/") + "/" + uriEncodePath(s.Bucket) + "/" + uriEncodePath(key)
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	s.sign(req, payload)
+	return req, nil
+}
+
+// sign : add AWS Signature Version 4 Authorization header to the request
+func (s *S3Store) sign(req *http.Request, payload []byte) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.SecretAccessKey), date)
+	signingKey = hmacSHA256(signingKey, s.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func canonicalQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	// url.Values.Encode sort by key, S3 additionally require %20 instead of +
+	return strings.ReplaceAll(query.Encode(), "+", "%20")
+}
+
+// uriEncodePath : percent encode everything except unreserved characters and slash
+func uriEncodePath(value string) string {
+	var builder strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', b == '-', b == '_', b == '.', b == '~', b == '/':
+			builder.WriteByte(b)
+		default:
+			fmt.Fprintf(&builder, "%%%02X", b)
+		}
+	}
+	return builder.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func responseError(resp *http.Response) error {
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 %s %s: %s: %s", resp.Request.Method, resp.Request.URL.Path, resp.Status, strings.TrimSpace(string(message)))
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 : in process stand-in of S3 compatible service with path style bucket addressing
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]fakeObject
+	t       *testing.T
+}
+
+type fakeObject struct {
+	contentType string
+	body        []byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Every request must be signed for the configured credential and carry the payload hash
+	body, _ := io.ReadAll(r.Body)
+	sum := sha256.Sum256(body)
+	assert.Equal(f.t, hex.EncodeToString(sum[:]), r.Header.Get("X-Amz-Content-Sha256"))
+	assert.True(f.t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/20231020/ap-southeast-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature="))
+	assert.Equal(f.t, "20231020T101500Z", r.Header.Get("X-Amz-Date"))
+
+	if !strings.HasPrefix(r.URL.Path, "/avatars-bucket/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/avatars-bucket/")
+
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[key] = fakeObject{contentType: r.Header.Get("Content-Type"), body: body}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		object, exist := f.objects[key]
+		if !exist {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "<Error><Code>NoSuchKey</Code></Error>")
+			return
+		}
+		w.Header().Set("Content-Type", object.contentType)
+		w.Write(object.body)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newTestS3Store(t *testing.T) (*S3Store, *fakeS3) {
+	fake := &fakeS3{objects: map[string]fakeObject{}, t: t}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	store := NewS3Store(NewS3StoreOptions{
+		Endpoint:        server.URL,
+		Region:          "ap-southeast-1",
+		Bucket:          "avatars-bucket",
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+	})
+	store.now = func() time.Time { return time.Date(2023, 10, 20, 10, 15, 0, 0, time.UTC) }
+	return store, fake
+}
+
+func TestS3Store(t *testing.T) {
+	ctx := context.Background()
+	store, fake := newTestS3Store(t)
+
+	// Put and get back the object
+	err := store.Put(ctx, "avatars/123/abc/64.jpg", strings.NewReader("image"), "image/jpeg")
+	assert.NoError(t, err)
+	assert.Equal(t, "image", string(fake.objects["avatars/123/abc/64.jpg"].body))
+
+	body, info, err := store.Get(ctx, "avatars/123/abc/64.jpg")
+	assert.NoError(t, err)
+	content, _ := io.ReadAll(body)
+	body.Close()
+	assert.Equal(t, "image", string(content))
+	assert.Equal(t, "image/jpeg", info.ContentType)
+	assert.Equal(t, int64(5), info.Size)
+
+	// Delete the object
+	assert.NoError(t, store.Delete(ctx, "avatars/123/abc/64.jpg"))
+
+	_, _, err = store.Get(ctx, "avatars/123/abc/64.jpg")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestS3StoreSignature(t *testing.T) {
+	store, _ := newTestS3Store(t)
+
+	req, err := store.newRequest(context.Background(), http.MethodGet, "avatars/a b/64.jpg", nil)
+	assert.NoError(t, err)
+
+	// Path is encoded once and the signature is stable for the same request and time
+	assert.Equal(t, "/avatars-bucket/avatars/a%20b/64.jpg", req.URL.EscapedPath())
+	first := req.Header.Get("Authorization")
+	store.sign(req, nil)
+	assert.Equal(t, first, req.Header.Get("Authorization"))
+
+	// Different secret produce different signature
+	store.SecretAccessKey = "other"
+	store.sign(req, nil)
+	assert.NotEqual(t, first, req.Header.Get("Authorization"))
+}
+
+func TestS3StoreError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>")
+	}))
+	defer server.Close()
+
+	store := NewS3Store(NewS3StoreOptions{Endpoint: server.URL, Region: "ap-southeast-1", Bucket: "avatars-bucket"})
+
+	err := store.Put(context.Background(), "avatars/123/abc/64.jpg", strings.NewReader("image"), "image/jpeg")
+	assert.ErrorContains(t, err, "SignatureDoesNotMatch")
+}
@@ -0,0 +1,12 @@
+// This file contains types that are used in the storage layer.
+package storage
+
+import "errors"
+
+// ErrNotFound is returned by Get when the object does not exist
+var ErrNotFound = errors.New("object not found")
+
+type ObjectInfo struct {
+	ContentType string
+	Size        int64
+}